@@ -0,0 +1,376 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net/http"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/google/uuid"
+	"gorm.io/gorm"
+)
+
+// =============================================================================
+// Address Book
+// =============================================================================
+
+// Buyers keep a book of shipping addresses, one of which may be their
+// default. An order ships to the address given by ID or inline at checkout,
+// or else to the buyer's default address; the address is copied onto the
+// order, so later edits to the book do not change where it ships.
+
+// ErrAddressNotFound is returned when an address ID does not exist or belongs
+// to another buyer.
+var ErrAddressNotFound = errors.New("address not found")
+
+// ErrInvalidAddress is returned when an address given at checkout is
+// incomplete.
+var ErrInvalidAddress = errors.New("invalid shipping address")
+
+// maxAddressFieldLength bounds every free-text address field.
+const maxAddressFieldLength = 200
+
+// AddressModel represents the addresses table in PostgreSQL. At most one of a
+// buyer's addresses is the default, which the partial unique index enforces.
+type AddressModel struct {
+	AddressID string    `gorm:"primaryKey;type:uuid;column:address_id" json:"addressId"`
+	BuyerID   string    `gorm:"not null;column:buyer_id;index;uniqueIndex:idx_addresses_buyer_default,where:is_default" json:"-"`
+	Label     string    `gorm:"column:label" json:"label,omitempty"`
+	Address   Address   `gorm:"type:jsonb;not null;column:address" json:"address"`
+	IsDefault bool      `gorm:"not null;default:false;column:is_default" json:"isDefault"`
+	CreatedAt time.Time `gorm:"autoCreateTime;column:created_at" json:"createdAt"`
+	UpdatedAt time.Time `gorm:"autoUpdateTime;column:updated_at" json:"updatedAt"`
+}
+
+// TableName specifies the table name for GORM.
+func (AddressModel) TableName() string {
+	return "addresses"
+}
+
+// AddressInput represents the expected JSON body for creating or replacing an
+// address book entry.
+type AddressInput struct {
+	Label     string  `json:"label,omitempty"`
+	Address   Address `json:"address"`
+	IsDefault bool    `json:"isDefault,omitempty"`
+}
+
+// Validate normalizes the address and checks it is complete enough to ship
+// to: a recipient, a street line, a city and a country.
+func (a *Address) Validate() error {
+	if err := a.Normalize(); err != nil {
+		return err
+	}
+
+	switch {
+	case a.Name == "":
+		return errors.New("name is required")
+	case a.Line1 == "":
+		return errors.New("line1 is required")
+	case a.City == "":
+		return errors.New("city is required")
+	}
+
+	for _, field := range []string{a.Name, a.Line1, a.Line2, a.City, a.Region, a.PostalCode, a.Phone} {
+		if len(field) > maxAddressFieldLength {
+			return fmt.Errorf("fields must be at most %d characters", maxAddressFieldLength)
+		}
+	}
+	return nil
+}
+
+// LoadAddress returns one of the buyer's addresses.
+func LoadAddress(tx *gorm.DB, buyerID, addressID string) (*AddressModel, error) {
+	if _, err := uuid.Parse(addressID); err != nil {
+		return nil, ErrAddressNotFound
+	}
+
+	var address AddressModel
+	err := tx.Where("address_id = ? AND buyer_id = ?", addressID, buyerID).First(&address).Error
+	if errors.Is(err, gorm.ErrRecordNotFound) {
+		return nil, ErrAddressNotFound
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to load address: %w", err)
+	}
+	return &address, nil
+}
+
+// LoadDefaultAddress returns the buyer's default address, or nil if they have
+// none.
+func LoadDefaultAddress(tx *gorm.DB, buyerID string) (*AddressModel, error) {
+	var address AddressModel
+	err := tx.Where("buyer_id = ? AND is_default", buyerID).First(&address).Error
+	if errors.Is(err, gorm.ErrRecordNotFound) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to load default address: %w", err)
+	}
+	return &address, nil
+}
+
+// ResolveShippingAddress returns the address an order ships to: the buyer's
+// saved address addressID, the inline address, or else the buyer's default
+// address, looked up through repo. Giving both addressID and inline is an
+// error. It returns nil when neither is given and the buyer has no default
+// address.
+func ResolveShippingAddress(ctx context.Context, repo OrderRepository, buyerID, addressID string, inline *Address) (*Address, error) {
+	switch {
+	case addressID != "" && inline != nil:
+		return nil, fmt.Errorf("%w: give either addressId or shippingAddress, not both", ErrInvalidAddress)
+	case addressID != "":
+		saved, err := repo.GetAddress(ctx, buyerID, addressID)
+		if err != nil {
+			return nil, err
+		}
+		return &saved.Address, nil
+	case inline != nil:
+		address := *inline
+		if err := address.Validate(); err != nil {
+			return nil, fmt.Errorf("%w: %v", ErrInvalidAddress, err)
+		}
+		return &address, nil
+	}
+
+	saved, err := repo.DefaultAddress(ctx, buyerID)
+	if err != nil || saved == nil {
+		return nil, err
+	}
+	return &saved.Address, nil
+}
+
+// saveAddress writes an address book entry. When it is the default, the
+// buyer's previous default is cleared first in the same transaction; a buyer's
+// first address always becomes the default.
+func saveAddress(address *AddressModel) error {
+	return db.Transaction(func(tx *gorm.DB) error {
+		if !address.IsDefault {
+			var others int64
+			if err := tx.Model(&AddressModel{}).
+				Where("buyer_id = ? AND address_id <> ?", address.BuyerID, address.AddressID).
+				Count(&others).Error; err != nil {
+				return fmt.Errorf("failed to count addresses: %w", err)
+			}
+			address.IsDefault = others == 0
+		}
+
+		if address.IsDefault {
+			if err := tx.Model(&AddressModel{}).
+				Where("buyer_id = ? AND address_id <> ? AND is_default", address.BuyerID, address.AddressID).
+				Update("is_default", false).Error; err != nil {
+				return fmt.Errorf("failed to clear default address: %w", err)
+			}
+		}
+
+		if err := tx.Save(address).Error; err != nil {
+			return fmt.Errorf("failed to save address: %w", err)
+		}
+		return nil
+	})
+}
+
+// bindAddressInput parses and validates an address book request body,
+// writing an error response on failure.
+func bindAddressInput(c *gin.Context) (AddressInput, bool) {
+	var input AddressInput
+	if err := c.ShouldBindJSON(&input); err != nil {
+		c.JSON(http.StatusBadRequest, ErrorResponse{Error: "Invalid request. Address is required."})
+		return input, false
+	}
+	if err := input.Address.Validate(); err != nil {
+		c.JSON(http.StatusBadRequest, ErrorResponse{Error: "Invalid address: " + err.Error()})
+		return input, false
+	}
+	if len(input.Label) > maxAddressFieldLength {
+		c.JSON(http.StatusBadRequest, ErrorResponse{Error: fmt.Sprintf("Invalid address: label must be at most %d characters", maxAddressFieldLength)})
+		return input, false
+	}
+	return input, true
+}
+
+// HandleGetAddresses godoc
+// @Summary List saved addresses
+// @Description Lists the buyer's address book, default address first
+// @Tags addresses
+// @Produce json
+// @Success 200 {object} []AddressModel
+// @Failure 401 {object} ErrorResponse
+// @Router /addresses [get]
+func HandleGetAddresses(c *gin.Context) {
+	buyerID, exists := c.Get("userId")
+	if !exists {
+		c.JSON(http.StatusUnauthorized, ErrorResponse{Error: "User ID not found in token"})
+		return
+	}
+
+	var addresses []AddressModel
+	if err := db.Where("buyer_id = ?", buyerID).
+		Order("is_default DESC, created_at DESC").
+		Find(&addresses).Error; err != nil {
+		c.JSON(http.StatusInternalServerError, ErrorResponse{Error: "Failed to fetch addresses"})
+		return
+	}
+
+	c.JSON(http.StatusOK, addresses)
+}
+
+// HandleCreateAddress godoc
+// @Summary Save an address
+// @Description Adds an address to the buyer's address book. The first address becomes the default.
+// @Tags addresses
+// @Accept json
+// @Produce json
+// @Param request body AddressInput true "Address"
+// @Success 201 {object} AddressModel
+// @Failure 400 {object} ErrorResponse
+// @Failure 401 {object} ErrorResponse
+// @Router /addresses [post]
+func HandleCreateAddress(c *gin.Context) {
+	input, ok := bindAddressInput(c)
+	if !ok {
+		return
+	}
+
+	buyerID, exists := c.Get("userId")
+	if !exists {
+		c.JSON(http.StatusUnauthorized, ErrorResponse{Error: "User ID not found in token"})
+		return
+	}
+
+	address := AddressModel{
+		AddressID: uuid.New().String(),
+		BuyerID:   buyerID.(string),
+		Label:     input.Label,
+		Address:   input.Address,
+		IsDefault: input.IsDefault,
+	}
+	if err := saveAddress(&address); err != nil {
+		c.JSON(http.StatusInternalServerError, ErrorResponse{Error: "Failed to save address"})
+		return
+	}
+
+	c.JSON(http.StatusCreated, address)
+}
+
+// HandleUpdateAddress godoc
+// @Summary Replace a saved address
+// @Description Replaces an address in the buyer's address book. Orders already placed keep the address they were shipped to.
+// @Tags addresses
+// @Accept json
+// @Produce json
+// @Param addressId path string true "Address ID"
+// @Param request body AddressInput true "Address"
+// @Success 200 {object} AddressModel
+// @Failure 400 {object} ErrorResponse
+// @Failure 401 {object} ErrorResponse
+// @Failure 404 {object} ErrorResponse
+// @Router /addresses/{addressId} [put]
+func HandleUpdateAddress(c *gin.Context) {
+	input, ok := bindAddressInput(c)
+	if !ok {
+		return
+	}
+
+	buyerID, exists := c.Get("userId")
+	if !exists {
+		c.JSON(http.StatusUnauthorized, ErrorResponse{Error: "User ID not found in token"})
+		return
+	}
+
+	address, err := LoadAddress(db, buyerID.(string), c.Param("addressId"))
+	if err != nil {
+		if errors.Is(err, ErrAddressNotFound) {
+			c.JSON(http.StatusNotFound, ErrorResponse{Error: "Address not found"})
+			return
+		}
+		c.JSON(http.StatusInternalServerError, ErrorResponse{Error: "Failed to fetch address"})
+		return
+	}
+
+	// The default flag is only ever set here; clearing it needs another
+	// address to be made the default instead
+	address.Label = input.Label
+	address.Address = input.Address
+	address.IsDefault = address.IsDefault || input.IsDefault
+	if err := saveAddress(address); err != nil {
+		c.JSON(http.StatusInternalServerError, ErrorResponse{Error: "Failed to save address"})
+		return
+	}
+
+	c.JSON(http.StatusOK, address)
+}
+
+// HandleSetDefaultAddress godoc
+// @Summary Set the default address
+// @Description Makes a saved address the one orders ship to when none is given
+// @Tags addresses
+// @Produce json
+// @Param addressId path string true "Address ID"
+// @Success 200 {object} AddressModel
+// @Failure 401 {object} ErrorResponse
+// @Failure 404 {object} ErrorResponse
+// @Router /addresses/{addressId}/default [post]
+func HandleSetDefaultAddress(c *gin.Context) {
+	buyerID, exists := c.Get("userId")
+	if !exists {
+		c.JSON(http.StatusUnauthorized, ErrorResponse{Error: "User ID not found in token"})
+		return
+	}
+
+	address, err := LoadAddress(db, buyerID.(string), c.Param("addressId"))
+	if err != nil {
+		if errors.Is(err, ErrAddressNotFound) {
+			c.JSON(http.StatusNotFound, ErrorResponse{Error: "Address not found"})
+			return
+		}
+		c.JSON(http.StatusInternalServerError, ErrorResponse{Error: "Failed to fetch address"})
+		return
+	}
+
+	address.IsDefault = true
+	if err := saveAddress(address); err != nil {
+		c.JSON(http.StatusInternalServerError, ErrorResponse{Error: "Failed to save address"})
+		return
+	}
+
+	c.JSON(http.StatusOK, address)
+}
+
+// HandleDeleteAddress godoc
+// @Summary Delete a saved address
+// @Description Removes an address from the buyer's address book. Deleting the default leaves the buyer without one.
+// @Tags addresses
+// @Produce json
+// @Param addressId path string true "Address ID"
+// @Success 200 {object} map[string]string
+// @Failure 401 {object} ErrorResponse
+// @Failure 404 {object} ErrorResponse
+// @Router /addresses/{addressId} [delete]
+func HandleDeleteAddress(c *gin.Context) {
+	buyerID, exists := c.Get("userId")
+	if !exists {
+		c.JSON(http.StatusUnauthorized, ErrorResponse{Error: "User ID not found in token"})
+		return
+	}
+
+	addressID := c.Param("addressId")
+	if _, err := uuid.Parse(addressID); err != nil {
+		c.JSON(http.StatusNotFound, ErrorResponse{Error: "Address not found"})
+		return
+	}
+
+	result := db.Where("address_id = ? AND buyer_id = ?", addressID, buyerID).Delete(&AddressModel{})
+	if result.Error != nil {
+		c.JSON(http.StatusInternalServerError, ErrorResponse{Error: "Failed to delete address"})
+		return
+	}
+	if result.RowsAffected == 0 {
+		c.JSON(http.StatusNotFound, ErrorResponse{Error: "Address not found"})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"message": "Address deleted", "addressId": addressID})
+}
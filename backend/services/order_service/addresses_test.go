@@ -0,0 +1,115 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/gin-gonic/gin"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestAddressValidate(t *testing.T) {
+	address := Address{Name: " Nimal Perera ", Line1: "12 Galle Rd", City: "Colombo", Region: "wp", Country: "lk", Phone: " +94 77 123 4567 "}
+	require.NoError(t, address.Validate())
+	assert.Equal(t, "Nimal Perera", address.Name)
+	assert.Equal(t, "+94 77 123 4567", address.Phone)
+	assert.Equal(t, "LK", address.Country)
+
+	tests := []struct {
+		name    string
+		address Address
+	}{
+		{"country_only", Address{Country: "LK"}},
+		{"missing_name", Address{Line1: "12 Galle Rd", City: "Colombo", Country: "LK"}},
+		{"missing_line1", Address{Name: "Nimal", City: "Colombo", Country: "LK"}},
+		{"missing_city", Address{Name: "Nimal", Line1: "12 Galle Rd", Country: "LK"}},
+		{"bad_country", Address{Name: "Nimal", Line1: "12 Galle Rd", City: "Colombo", Country: "Sri Lanka"}},
+		{"too_long", Address{Name: "Nimal", Line1: string(make([]byte, maxAddressFieldLength+1)), City: "Colombo", Country: "LK"}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			assert.Error(t, tt.address.Validate())
+		})
+	}
+}
+
+func TestResolveShippingAddress(t *testing.T) {
+	ctx := context.Background()
+	repo := NewMemoryOrderRepository()
+	inline := &Address{Name: "Nimal", Line1: "12 Galle Rd", City: "Colombo", Country: "lk"}
+
+	address, err := ResolveShippingAddress(ctx, repo, "buyer-1", "", inline)
+	require.NoError(t, err)
+	assert.Equal(t, "LK", address.Country)
+	assert.Equal(t, "lk", inline.Country, "the caller's address is not modified")
+
+	_, err = ResolveShippingAddress(ctx, repo, "buyer-1", "", &Address{Country: "LK"})
+	assert.ErrorIs(t, err, ErrInvalidAddress)
+
+	_, err = ResolveShippingAddress(ctx, repo, "buyer-1", "3f9a8e36-64a4-4f0c-9d57-0e6c1d1f2a10", inline)
+	assert.ErrorIs(t, err, ErrInvalidAddress)
+
+	_, err = ResolveShippingAddress(ctx, repo, "buyer-1", "3f9a8e36-64a4-4f0c-9d57-0e6c1d1f2a10", nil)
+	assert.ErrorIs(t, err, ErrAddressNotFound)
+
+	address, err = ResolveShippingAddress(ctx, repo, "buyer-1", "", nil)
+	require.NoError(t, err)
+	assert.Nil(t, address, "no default address")
+
+	home := Address{Name: "Nimal", Line1: "12 Galle Rd", City: "Colombo", Country: "LK"}
+	repo.AddAddress(AddressModel{AddressID: "3f9a8e36-64a4-4f0c-9d57-0e6c1d1f2a10", BuyerID: "buyer-1", Address: home, IsDefault: true})
+
+	address, err = ResolveShippingAddress(ctx, repo, "buyer-1", "", nil)
+	require.NoError(t, err)
+	assert.Equal(t, &home, address)
+
+	_, err = ResolveShippingAddress(ctx, repo, "buyer-2", "3f9a8e36-64a4-4f0c-9d57-0e6c1d1f2a10", nil)
+	assert.ErrorIs(t, err, ErrAddressNotFound, "another buyer's address")
+}
+
+func TestAddressEndpointsValidation(t *testing.T) {
+	tests := []struct {
+		name           string
+		method         string
+		path           string
+		requestBody    string
+		expectedStatus int
+	}{
+		{name: "create_missing_address", method: "POST", path: "/addresses", requestBody: `{"label": "Home"}`, expectedStatus: http.StatusBadRequest},
+		{name: "create_incomplete_address", method: "POST", path: "/addresses", requestBody: `{"address": {"country": "LK"}}`, expectedStatus: http.StatusBadRequest},
+		{name: "update_invalid_json", method: "PUT", path: "/addresses/3f9a8e36-64a4-4f0c-9d57-0e6c1d1f2a10", requestBody: `{"address":`, expectedStatus: http.StatusBadRequest},
+		{name: "update_unknown_id", method: "PUT", path: "/addresses/home", requestBody: `{"address": {"name": "Nimal", "line1": "12 Galle Rd", "city": "Colombo", "country": "LK"}}`, expectedStatus: http.StatusNotFound},
+		{name: "default_unknown_id", method: "POST", path: "/addresses/home/default", expectedStatus: http.StatusNotFound},
+		{name: "delete_unknown_id", method: "DELETE", path: "/addresses/home", expectedStatus: http.StatusNotFound},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			r := setupTestRouter()
+			r.Use(func(c *gin.Context) {
+				c.Set("userId", "buyer-1")
+				c.Next()
+			})
+			r.GET("/addresses", HandleGetAddresses)
+			r.POST("/addresses", HandleCreateAddress)
+			r.PUT("/addresses/:addressId", HandleUpdateAddress)
+			r.DELETE("/addresses/:addressId", HandleDeleteAddress)
+			r.POST("/addresses/:addressId/default", HandleSetDefaultAddress)
+
+			req, _ := http.NewRequest(tt.method, tt.path, bytes.NewBufferString(tt.requestBody))
+			req.Header.Set("Content-Type", "application/json")
+			w := httptest.NewRecorder()
+			r.ServeHTTP(w, req)
+
+			assert.Equal(t, tt.expectedStatus, w.Code)
+		})
+	}
+}
+
+func TestAddressTableName(t *testing.T) {
+	assert.Equal(t, "addresses", AddressModel{}.TableName())
+}
@@ -0,0 +1,441 @@
+package main
+
+import (
+	"fmt"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+	_ "time/tzdata" // the container image has no zoneinfo; ?tz= needs it
+
+	"github.com/gin-gonic/gin"
+	"gorm.io/gorm"
+)
+
+// =============================================================================
+// Seller Analytics
+// =============================================================================
+
+// Sales figures are aggregated in SQL over the seller's orders and their JSONB
+// items. Only orders that were paid count (see analyticsStatuses); revenue is
+// what the goods sold for after coupon discounts, without shipping and tax,
+// and before any refunds. Periods are calendar days, ISO weeks (starting
+// Monday) or months in the caller's time zone.
+
+const (
+	analyticsDateLayout     = "2006-01-02"
+	defaultAnalyticsDays    = 30
+	maxAnalyticsBuckets     = 366
+	defaultTopProductsLimit = 10
+	maxTopProductsLimit     = 100
+)
+
+// analyticsIntervals maps an interval to its Postgres date_trunc field.
+var analyticsIntervals = map[string]string{
+	"day":   "day",
+	"week":  "week",
+	"month": "month",
+}
+
+// analyticsStatuses are the order statuses counted as sales.
+var analyticsStatuses = []string{StatusPaid, StatusPartiallyShipped, StatusShipped, StatusDelivered}
+
+// AnalyticsParams holds the parsed query parameters of an analytics request.
+// From and To are the first and last local dates of the range; Start and End
+// are the instants that bound it, End being exclusive.
+type AnalyticsParams struct {
+	From     time.Time
+	To       time.Time
+	Start    time.Time
+	End      time.Time
+	Interval string
+	Location *time.Location
+	Currency string
+}
+
+// SalesBucket holds the sales figures of one period, or of the whole range.
+type SalesBucket struct {
+	Period            string `json:"period,omitempty"`
+	Orders            int64  `json:"orders"`
+	Units             int64  `json:"units"`
+	Revenue           Money  `json:"revenue"`
+	AverageOrderValue Money  `json:"averageOrderValue"`
+}
+
+// SalesReport is the response of GET /analytics/sales. Buckets covers every
+// period of the range in order, including periods without sales.
+type SalesReport struct {
+	From     string        `json:"from"`
+	To       string        `json:"to"`
+	Interval string        `json:"interval"`
+	Timezone string        `json:"timezone"`
+	Currency string        `json:"currency"`
+	Totals   SalesBucket   `json:"totals"`
+	Buckets  []SalesBucket `json:"buckets"`
+}
+
+// ProductSales holds the sales figures of one product.
+type ProductSales struct {
+	ProductID string `json:"productId"`
+	Name      string `json:"name"`
+	Units     int64  `json:"units"`
+	Orders    int64  `json:"orders"`
+	Revenue   Money  `json:"revenue"`
+}
+
+// TopProductsReport is the response of GET /analytics/top-products.
+type TopProductsReport struct {
+	From     string         `json:"from"`
+	To       string         `json:"to"`
+	Timezone string         `json:"timezone"`
+	Currency string         `json:"currency"`
+	Sort     string         `json:"sort"`
+	Products []ProductSales `json:"products"`
+}
+
+// salesRow is one period as aggregated by Postgres.
+type salesRow struct {
+	Period  string
+	Orders  int64
+	Units   int64
+	Revenue int64
+}
+
+// productRow is one product as aggregated by Postgres.
+type productRow struct {
+	ProductID string
+	Name      string
+	Units     int64
+	Orders    int64
+	Revenue   int64
+}
+
+// ParseAnalyticsParams reads from, to, interval, tz and currency from the
+// query string. from and to are YYYY-MM-DD dates in tz (default UTC), both
+// inclusive; without them the range is the last 30 days up to today.
+func ParseAnalyticsParams(c *gin.Context, now time.Time) (AnalyticsParams, error) {
+	params := AnalyticsParams{Interval: strings.ToLower(c.DefaultQuery("interval", "day"))}
+	if _, ok := analyticsIntervals[params.Interval]; !ok {
+		return params, fmt.Errorf("interval must be day, week or month")
+	}
+
+	tz := c.DefaultQuery("tz", "UTC")
+	loc, err := time.LoadLocation(tz)
+	if err != nil || tz == "Local" {
+		return params, fmt.Errorf("unknown time zone %q", tz)
+	}
+	params.Location = loc
+
+	currency, err := NormalizeCurrency(c.Query("currency"))
+	if err != nil {
+		return params, err
+	}
+	params.Currency = currency
+
+	today := now.In(loc)
+	params.To = time.Date(today.Year(), today.Month(), today.Day(), 0, 0, 0, 0, loc)
+	if to := c.Query("to"); to != "" {
+		if params.To, err = time.ParseInLocation(analyticsDateLayout, to, loc); err != nil {
+			return params, fmt.Errorf("invalid to date %q: use YYYY-MM-DD", to)
+		}
+	}
+	params.From = params.To.AddDate(0, 0, 1-defaultAnalyticsDays)
+	if from := c.Query("from"); from != "" {
+		if params.From, err = time.ParseInLocation(analyticsDateLayout, from, loc); err != nil {
+			return params, fmt.Errorf("invalid from date %q: use YYYY-MM-DD", from)
+		}
+	}
+	if params.From.After(params.To) {
+		return params, fmt.Errorf("from must not be after to")
+	}
+
+	params.Start = params.From
+	params.End = params.To.AddDate(0, 0, 1)
+	if len(AnalyticsPeriods(params)) > maxAnalyticsBuckets {
+		return params, fmt.Errorf("range has more than %d %ss; use a shorter range or a longer interval", maxAnalyticsBuckets, params.Interval)
+	}
+
+	return params, nil
+}
+
+// periodStart returns the start of the period containing t, matching
+// Postgres' date_trunc: weeks start on Monday.
+func periodStart(t time.Time, interval string) time.Time {
+	day := time.Date(t.Year(), t.Month(), t.Day(), 0, 0, 0, 0, t.Location())
+	switch interval {
+	case "week":
+		offset := (int(day.Weekday()) + 6) % 7
+		return day.AddDate(0, 0, -offset)
+	case "month":
+		return time.Date(t.Year(), t.Month(), 1, 0, 0, 0, 0, t.Location())
+	default:
+		return day
+	}
+}
+
+// nextPeriod returns the start of the period after the one starting at t.
+func nextPeriod(t time.Time, interval string) time.Time {
+	switch interval {
+	case "week":
+		return t.AddDate(0, 0, 7)
+	case "month":
+		return t.AddDate(0, 1, 0)
+	default:
+		return t.AddDate(0, 0, 1)
+	}
+}
+
+// AnalyticsPeriods returns the labels (the local start date) of every period
+// the range touches, oldest first. The first and last periods may extend
+// beyond the range, but only sales inside it are counted.
+func AnalyticsPeriods(params AnalyticsParams) []string {
+	var periods []string
+	for t := periodStart(params.From, params.Interval); !t.After(params.To); t = nextPeriod(t, params.Interval) {
+		periods = append(periods, t.Format(analyticsDateLayout))
+		if len(periods) > maxAnalyticsBuckets {
+			break
+		}
+	}
+	return periods
+}
+
+// averageOrderValue divides revenue by the number of orders, rounding to the
+// minor unit.
+func averageOrderValue(revenue Money, orders int64) Money {
+	if orders == 0 {
+		return Money{Currency: revenue.Currency}
+	}
+	return revenue.Scale(1, orders)
+}
+
+// BuildSalesReport lays the aggregated rows out over every period of the
+// range and works out averages and totals.
+func BuildSalesReport(params AnalyticsParams, rows []salesRow) SalesReport {
+	byPeriod := make(map[string]salesRow, len(rows))
+	for _, row := range rows {
+		byPeriod[row.Period] = row
+	}
+
+	report := SalesReport{
+		From:     params.From.Format(analyticsDateLayout),
+		To:       params.To.Format(analyticsDateLayout),
+		Interval: params.Interval,
+		Timezone: params.Location.String(),
+		Currency: params.Currency,
+		Buckets:  []SalesBucket{},
+	}
+
+	var totals salesRow
+	for _, period := range AnalyticsPeriods(params) {
+		row := byPeriod[period]
+		revenue := Money{Amount: row.Revenue, Currency: params.Currency}
+		report.Buckets = append(report.Buckets, SalesBucket{
+			Period:            period,
+			Orders:            row.Orders,
+			Units:             row.Units,
+			Revenue:           revenue,
+			AverageOrderValue: averageOrderValue(revenue, row.Orders),
+		})
+		totals.Orders += row.Orders
+		totals.Units += row.Units
+		totals.Revenue += row.Revenue
+	}
+
+	revenue := Money{Amount: totals.Revenue, Currency: params.Currency}
+	report.Totals = SalesBucket{
+		Orders:            totals.Orders,
+		Units:             totals.Units,
+		Revenue:           revenue,
+		AverageOrderValue: averageOrderValue(revenue, totals.Orders),
+	}
+
+	return report
+}
+
+// sellerSalesQuery selects the seller's counted orders in the range and
+// currency.
+func sellerSalesQuery(database *gorm.DB, sellerID string, params AnalyticsParams) *gorm.DB {
+	return database.Table("orders AS o").
+		Where("o.seller_id = ? AND o.status IN ?", sellerID, analyticsStatuses).
+		Where("o.subtotal_currency = ?", params.Currency).
+		Where("o.created_at >= ? AND o.created_at < ?", params.Start.UTC(), params.End.UTC())
+}
+
+// lineRevenueSQL is what an order line sold for. Lines stored before line
+// totals were snapshotted fall back to price x quantity.
+const lineRevenueSQL = `COALESCE((i->'lineTotal'->>'amount')::bigint, (i->'price'->>'amount')::bigint * (i->>'quantity')::bigint, 0)`
+
+// QuerySalesReport aggregates a seller's sales per period.
+func QuerySalesReport(database *gorm.DB, sellerID string, params AnalyticsParams) (SalesReport, error) {
+	var rows []salesRow
+	err := sellerSalesQuery(database, sellerID, params).
+		Select(`to_char(date_trunc(?, o.created_at AT TIME ZONE ?), 'YYYY-MM-DD') AS period,
+			COUNT(*) AS orders,
+			COALESCE(SUM(u.units), 0) AS units,
+			COALESCE(SUM(o.subtotal_amount - o.discount_amount), 0) AS revenue`,
+			analyticsIntervals[params.Interval], params.Location.String()).
+		Joins(`CROSS JOIN LATERAL (
+			SELECT COALESCE(SUM((i->>'quantity')::bigint), 0) AS units FROM jsonb_array_elements(o.items) AS i
+		) AS u`).
+		Group("period").
+		Order("period").
+		Scan(&rows).Error
+	if err != nil {
+		return SalesReport{}, fmt.Errorf("failed to aggregate sales: %w", err)
+	}
+
+	return BuildSalesReport(params, rows), nil
+}
+
+// QueryTopProducts ranks a seller's products by revenue or units sold in the
+// range. Each product is named as it was on its most recent order.
+func QueryTopProducts(database *gorm.DB, sellerID string, params AnalyticsParams, sortBy string, limit int) ([]ProductSales, error) {
+	order := "revenue DESC, units DESC"
+	if sortBy == "units" {
+		order = "units DESC, revenue DESC"
+	}
+
+	var rows []productRow
+	err := sellerSalesQuery(database, sellerID, params).
+		Select(`i->>'productId' AS product_id,
+			(array_agg(i->>'name' ORDER BY o.created_at DESC))[1] AS name,
+			SUM((i->>'quantity')::bigint) AS units,
+			COUNT(DISTINCT o.order_id) AS orders,
+			SUM(` + lineRevenueSQL + `) AS revenue`).
+		Joins("CROSS JOIN LATERAL jsonb_array_elements(o.items) AS i").
+		Group("product_id").
+		Order(order + ", product_id").
+		Limit(limit).
+		Scan(&rows).Error
+	if err != nil {
+		return nil, fmt.Errorf("failed to aggregate product sales: %w", err)
+	}
+
+	products := make([]ProductSales, len(rows))
+	for i, row := range rows {
+		products[i] = ProductSales{
+			ProductID: row.ProductID,
+			Name:      row.Name,
+			Units:     row.Units,
+			Orders:    row.Orders,
+			Revenue:   Money{Amount: row.Revenue, Currency: params.Currency},
+		}
+	}
+	return products, nil
+}
+
+// requireAnalyticsSeller returns the caller's user ID if they are a seller,
+// writing an error response otherwise.
+func requireAnalyticsSeller(c *gin.Context) (string, bool) {
+	userID, exists := c.Get("userId")
+	if !exists {
+		c.JSON(http.StatusUnauthorized, ErrorResponse{Error: "User ID not found in token"})
+		return "", false
+	}
+
+	customRole, _ := c.Get("customRole")
+	if customRole != "seller" {
+		c.JSON(http.StatusForbidden, ErrorResponse{Error: "Only sellers can view sales analytics"})
+		return "", false
+	}
+
+	return userID.(string), true
+}
+
+// HandleGetSalesAnalytics godoc
+// @Summary Get sales over time
+// @Description Returns the seller's orders, units sold, revenue and average order value per day, week or month, with totals for the range
+// @Tags analytics
+// @Produce json
+// @Param from query string false "First date, YYYY-MM-DD (default 29 days before to)"
+// @Param to query string false "Last date, YYYY-MM-DD (default today)"
+// @Param interval query string false "day, week or month (default day)"
+// @Param tz query string false "IANA time zone of the dates and periods (default UTC)"
+// @Param currency query string false "Currency of the orders to include (default DEFAULT_CURRENCY)"
+// @Success 200 {object} SalesReport
+// @Failure 400 {object} ErrorResponse
+// @Failure 401 {object} ErrorResponse
+// @Failure 403 {object} ErrorResponse
+// @Failure 500 {object} ErrorResponse
+// @Router /analytics/sales [get]
+func HandleGetSalesAnalytics(c *gin.Context) {
+	sellerID, ok := requireAnalyticsSeller(c)
+	if !ok {
+		return
+	}
+
+	params, err := ParseAnalyticsParams(c, time.Now())
+	if err != nil {
+		c.JSON(http.StatusBadRequest, ErrorResponse{Error: "Invalid query: " + err.Error()})
+		return
+	}
+
+	report, err := QuerySalesReport(db, sellerID, params)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, ErrorResponse{Error: "Failed to fetch sales analytics"})
+		return
+	}
+
+	c.JSON(http.StatusOK, report)
+}
+
+// HandleGetTopProducts godoc
+// @Summary Get top products
+// @Description Returns the seller's best-selling products in the range by revenue or units
+// @Tags analytics
+// @Produce json
+// @Param from query string false "First date, YYYY-MM-DD (default 29 days before to)"
+// @Param to query string false "Last date, YYYY-MM-DD (default today)"
+// @Param tz query string false "IANA time zone of the dates (default UTC)"
+// @Param currency query string false "Currency of the orders to include (default DEFAULT_CURRENCY)"
+// @Param sort query string false "revenue or units (default revenue)"
+// @Param limit query int false "Number of products (default 10, max 100)"
+// @Success 200 {object} TopProductsReport
+// @Failure 400 {object} ErrorResponse
+// @Failure 401 {object} ErrorResponse
+// @Failure 403 {object} ErrorResponse
+// @Failure 500 {object} ErrorResponse
+// @Router /analytics/top-products [get]
+func HandleGetTopProducts(c *gin.Context) {
+	sellerID, ok := requireAnalyticsSeller(c)
+	if !ok {
+		return
+	}
+
+	params, err := ParseAnalyticsParams(c, time.Now())
+	if err != nil {
+		c.JSON(http.StatusBadRequest, ErrorResponse{Error: "Invalid query: " + err.Error()})
+		return
+	}
+
+	sortBy := strings.ToLower(c.DefaultQuery("sort", "revenue"))
+	if sortBy != "revenue" && sortBy != "units" {
+		c.JSON(http.StatusBadRequest, ErrorResponse{Error: "Invalid query: sort must be revenue or units"})
+		return
+	}
+
+	limit := defaultTopProductsLimit
+	if v := c.Query("limit"); v != "" {
+		parsed, err := strconv.Atoi(v)
+		if err != nil || parsed < 1 || parsed > maxTopProductsLimit {
+			c.JSON(http.StatusBadRequest, ErrorResponse{Error: fmt.Sprintf("Invalid query: limit must be 1-%d", maxTopProductsLimit)})
+			return
+		}
+		limit = parsed
+	}
+
+	products, err := QueryTopProducts(db, sellerID, params, sortBy, limit)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, ErrorResponse{Error: "Failed to fetch top products"})
+		return
+	}
+
+	c.JSON(http.StatusOK, TopProductsReport{
+		From:     params.From.Format(analyticsDateLayout),
+		To:       params.To.Format(analyticsDateLayout),
+		Timezone: params.Location.String(),
+		Currency: params.Currency,
+		Sort:     sortBy,
+		Products: products,
+	})
+}
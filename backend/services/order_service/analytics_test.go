@@ -0,0 +1,147 @@
+package main
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func analyticsContext(rawQuery string) *gin.Context {
+	gin.SetMode(gin.TestMode)
+	c, _ := gin.CreateTestContext(httptest.NewRecorder())
+	c.Request, _ = http.NewRequest(http.MethodGet, "/analytics/sales?"+rawQuery, nil)
+	return c
+}
+
+func TestParseAnalyticsParams(t *testing.T) {
+	// 20:00 UTC on 10 March is already 11 March in Colombo
+	now := time.Date(2026, 3, 10, 20, 0, 0, 0, time.UTC)
+
+	params, err := ParseAnalyticsParams(analyticsContext(""), now)
+	require.NoError(t, err)
+	assert.Equal(t, "day", params.Interval)
+	assert.Equal(t, "UTC", params.Location.String())
+	assert.Equal(t, defaultCurrency, params.Currency)
+	assert.Equal(t, "2026-02-09", params.From.Format(analyticsDateLayout))
+	assert.Equal(t, "2026-03-10", params.To.Format(analyticsDateLayout))
+
+	params, err = ParseAnalyticsParams(analyticsContext("tz=Asia/Colombo&interval=week"), now)
+	require.NoError(t, err)
+	assert.Equal(t, "2026-03-11", params.To.Format(analyticsDateLayout), "today is taken in the requested time zone")
+
+	params, err = ParseAnalyticsParams(analyticsContext("from=2026-03-01&to=2026-03-31&tz=Asia/Colombo"), now)
+	require.NoError(t, err)
+	assert.Equal(t, time.Date(2026, 2, 28, 18, 30, 0, 0, time.UTC), params.Start.UTC(), "ranges start at local midnight")
+	assert.Equal(t, time.Date(2026, 3, 31, 18, 30, 0, 0, time.UTC), params.End.UTC(), "the to date is inclusive")
+
+	invalid := []string{
+		"interval=year",
+		"tz=Mars/Olympus",
+		"tz=Local",
+		"from=03/01/2026",
+		"to=2026-13-01",
+		"from=2026-03-10&to=2026-03-01",
+		"currency=rupees",
+		"from=2024-01-01&to=2026-01-01",
+	}
+	for _, q := range invalid {
+		_, err := ParseAnalyticsParams(analyticsContext(q), now)
+		assert.Error(t, err, q)
+	}
+
+	_, err = ParseAnalyticsParams(analyticsContext("from=2024-01-01&to=2026-01-01&interval=month"), now)
+	assert.NoError(t, err, "long ranges are fine with a longer interval")
+}
+
+func TestAnalyticsPeriods(t *testing.T) {
+	loc, _ := time.LoadLocation("Asia/Colombo")
+	params := AnalyticsParams{
+		From:     time.Date(2026, 3, 4, 0, 0, 0, 0, loc), // a Wednesday
+		To:       time.Date(2026, 3, 17, 0, 0, 0, 0, loc),
+		Location: loc,
+	}
+
+	params.Interval = "day"
+	periods := AnalyticsPeriods(params)
+	assert.Len(t, periods, 14)
+	assert.Equal(t, "2026-03-04", periods[0])
+	assert.Equal(t, "2026-03-17", periods[13])
+
+	params.Interval = "week"
+	assert.Equal(t, []string{"2026-03-02", "2026-03-09", "2026-03-16"}, AnalyticsPeriods(params), "weeks start on Monday")
+
+	params.Interval = "month"
+	params.To = time.Date(2026, 5, 1, 0, 0, 0, 0, loc)
+	assert.Equal(t, []string{"2026-03-01", "2026-04-01", "2026-05-01"}, AnalyticsPeriods(params))
+}
+
+func TestBuildSalesReport(t *testing.T) {
+	params := AnalyticsParams{
+		From:     time.Date(2026, 3, 1, 0, 0, 0, 0, time.UTC),
+		To:       time.Date(2026, 3, 3, 0, 0, 0, 0, time.UTC),
+		Interval: "day",
+		Location: time.UTC,
+		Currency: "LKR",
+	}
+	rows := []salesRow{
+		{Period: "2026-03-01", Orders: 3, Units: 7, Revenue: 1000},
+		{Period: "2026-03-03", Orders: 1, Units: 1, Revenue: 450},
+	}
+
+	report := BuildSalesReport(params, rows)
+	assert.Equal(t, "2026-03-01", report.From)
+	assert.Equal(t, "2026-03-03", report.To)
+	require.Len(t, report.Buckets, 3)
+
+	assert.Equal(t, cents(1000), report.Buckets[0].Revenue)
+	assert.Equal(t, cents(333), report.Buckets[0].AverageOrderValue)
+	assert.Equal(t, "2026-03-02", report.Buckets[1].Period)
+	assert.Zero(t, report.Buckets[1].Orders, "periods without sales are filled in")
+	assert.Equal(t, cents(0), report.Buckets[1].AverageOrderValue)
+
+	assert.Equal(t, int64(4), report.Totals.Orders)
+	assert.Equal(t, int64(8), report.Totals.Units)
+	assert.Equal(t, cents(1450), report.Totals.Revenue)
+	assert.Equal(t, cents(363), report.Totals.AverageOrderValue)
+	assert.Empty(t, report.Totals.Period)
+}
+
+func TestAnalyticsEndpointsValidation(t *testing.T) {
+	tests := []struct {
+		name           string
+		role           string
+		path           string
+		expectedStatus int
+	}{
+		{name: "buyer_cannot_view_sales", role: "buyer", path: "/analytics/sales", expectedStatus: http.StatusForbidden},
+		{name: "buyer_cannot_view_top_products", role: "buyer", path: "/analytics/top-products", expectedStatus: http.StatusForbidden},
+		{name: "sales_bad_interval", role: "seller", path: "/analytics/sales?interval=hour", expectedStatus: http.StatusBadRequest},
+		{name: "sales_bad_timezone", role: "seller", path: "/analytics/sales?tz=Nowhere", expectedStatus: http.StatusBadRequest},
+		{name: "top_products_bad_sort", role: "seller", path: "/analytics/top-products?sort=name", expectedStatus: http.StatusBadRequest},
+		{name: "top_products_bad_limit", role: "seller", path: "/analytics/top-products?limit=0", expectedStatus: http.StatusBadRequest},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			r := setupTestRouter()
+			r.Use(func(c *gin.Context) {
+				c.Set("customRole", tt.role)
+				c.Set("userId", "user-1")
+				c.Next()
+			})
+			r.GET("/analytics/sales", HandleGetSalesAnalytics)
+			r.GET("/analytics/top-products", HandleGetTopProducts)
+
+			req, _ := http.NewRequest(http.MethodGet, tt.path, nil)
+			w := httptest.NewRecorder()
+			r.ServeHTTP(w, req)
+
+			assert.Equal(t, tt.expectedStatus, w.Code)
+		})
+	}
+}
@@ -0,0 +1,428 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"net/http"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+)
+
+// =============================================================================
+// Shopping Cart
+// =============================================================================
+
+// maxCartLines caps the number of distinct products in a cart. It matches the
+// number of products ProductService will reserve in one call.
+const maxCartLines = 50
+
+// Cart line issues reported when a line can no longer be checked out as is.
+const (
+	CartIssueUnavailable       = "product_unavailable"
+	CartIssueInsufficientStock = "insufficient_stock"
+	CartIssueCurrency          = "currency_mismatch" // priced in another currency than the rest of the cart
+)
+
+// CartItemModel represents the cart_items table in PostgreSQL. A buyer has one
+// cart, stored as one row per product, so it follows them across devices.
+// Only the product and quantity are stored; name, price and stock are read
+// from ProductService whenever the cart is shown or checked out.
+type CartItemModel struct {
+	BuyerID   string    `gorm:"primaryKey;column:buyer_id" json:"-"`
+	ProductID string    `gorm:"primaryKey;column:product_id" json:"productId"`
+	Quantity  int       `gorm:"not null;column:quantity" json:"quantity"`
+	CreatedAt time.Time `gorm:"autoCreateTime;column:created_at" json:"createdAt"`
+	UpdatedAt time.Time `gorm:"autoUpdateTime;column:updated_at" json:"updatedAt"`
+}
+
+// TableName specifies the table name for GORM.
+func (CartItemModel) TableName() string {
+	return "cart_items"
+}
+
+// AddCartItemInput represents the expected JSON body for adding a product to
+// the cart. The quantity is added to any quantity already in the cart.
+type AddCartItemInput struct {
+	ProductID string `json:"productId" binding:"required"`
+	Quantity  int    `json:"quantity" binding:"required,min=1"`
+}
+
+// UpdateCartItemInput represents the expected JSON body for changing the
+// quantity of a cart line.
+type UpdateCartItemInput struct {
+	Quantity int `json:"quantity" binding:"required,min=1"`
+}
+
+// CartLine is a cart line priced with ProductService's current details.
+type CartLine struct {
+	ProductID string `json:"productId"`
+	Quantity  int    `json:"quantity"`
+	Name      string `json:"name,omitempty"`
+	Price     Money  `json:"price,omitzero"`
+	SellerID  string `json:"sellerId,omitempty"`
+	Available int    `json:"available"`
+	LineTotal Money  `json:"lineTotal,omitzero"`
+	Issue     string `json:"issue,omitempty"`
+}
+
+// CartResponse is the buyer's cart with current prices. Lines with an issue
+// are excluded from the subtotal and block checkout until they are fixed.
+type CartResponse struct {
+	Items     []CartLine `json:"items"`
+	Subtotal  Money      `json:"subtotal"`
+	Checkable bool       `json:"checkable"`
+}
+
+// CartCheckoutInput represents the optional JSON body for checking out the
+// cart. The shipping address is chosen as for CreateOrderInput.
+type CartCheckoutInput struct {
+	CouponCode      string   `json:"couponCode,omitempty"`
+	AddressID       string   `json:"addressId,omitempty"`
+	ShippingAddress *Address `json:"shippingAddress,omitempty"`
+}
+
+// cartCheckoutRequest is hashed for Idempotency-Key checks on cart checkout.
+// The cart's lines are not part of it, since a retry finds the cart empty.
+type cartCheckoutRequest struct {
+	Cart            bool     `json:"cart"`
+	CouponCode      string   `json:"couponCode,omitempty"`
+	AddressID       string   `json:"addressId,omitempty"`
+	ShippingAddress *Address `json:"shippingAddress,omitempty"`
+}
+
+// BuildCartResponse prices the stored cart lines with the given products.
+// Lines whose product no longer exists, or whose quantity exceeds the stock
+// still available, are flagged instead of dropped so the buyer can fix them.
+// The subtotal is in the currency of the first priced line; lines in another
+// currency are flagged too, since a checkout is paid in one currency.
+func BuildCartResponse(items []CartItemModel, products map[string]ProductDetails) CartResponse {
+	response := CartResponse{Items: make([]CartLine, 0, len(items)), Checkable: len(items) > 0}
+
+	for _, item := range items {
+		line := CartLine{ProductID: item.ProductID, Quantity: item.Quantity}
+
+		product, ok := products[item.ProductID]
+		switch {
+		case !ok:
+			line.Issue = CartIssueUnavailable
+		case product.Available < item.Quantity:
+			line.Issue = CartIssueInsufficientStock
+		}
+
+		if ok {
+			line.Name = product.Name
+			line.Price = product.Price
+			line.SellerID = product.SellerID
+			line.Available = product.Available
+			line.LineTotal = product.Price.Times(item.Quantity)
+		}
+
+		if line.Issue == "" {
+			subtotal, err := response.Subtotal.Add(line.LineTotal)
+			if err != nil {
+				line.Issue = CartIssueCurrency
+			} else {
+				response.Subtotal = subtotal
+			}
+		}
+		if line.Issue != "" {
+			response.Checkable = false
+		}
+		response.Items = append(response.Items, line)
+	}
+
+	return response
+}
+
+// loadCart returns the buyer's cart lines, oldest first.
+func loadCart(tx *gorm.DB, buyerID string) ([]CartItemModel, error) {
+	var items []CartItemModel
+	if err := tx.Where("buyer_id = ?", buyerID).Order("created_at ASC, product_id ASC").Find(&items).Error; err != nil {
+		return nil, err
+	}
+	return items, nil
+}
+
+// respondWithCart prices the buyer's cart and writes it as the response.
+func respondWithCart(c *gin.Context, buyerID string) {
+	items, err := loadCart(db, buyerID)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, ErrorResponse{Error: "Failed to fetch cart"})
+		return
+	}
+
+	products := map[string]ProductDetails{}
+	if len(items) > 0 {
+		productIDs := make([]string, len(items))
+		for i, item := range items {
+			productIDs[i] = item.ProductID
+		}
+
+		products, _, err = productCatalog.FetchProducts(c.Request.Context(), productIDs)
+		if err != nil {
+			c.JSON(http.StatusBadGateway, ErrorResponse{Error: fmt.Sprintf("Failed to look up products: %v", err)})
+			return
+		}
+	}
+
+	c.JSON(http.StatusOK, BuildCartResponse(items, products))
+}
+
+// validateCartQuantity checks a product and the quantity wanted against
+// ProductService. It writes an error response and returns false if the
+// product does not exist or does not have enough available stock.
+func validateCartQuantity(c *gin.Context, productID string, quantity int) bool {
+	products, missing, err := productCatalog.FetchProducts(c.Request.Context(), []string{productID})
+	if err != nil {
+		c.JSON(http.StatusBadGateway, ErrorResponse{Error: fmt.Sprintf("Failed to look up products: %v", err)})
+		return false
+	}
+	if len(missing) > 0 {
+		c.JSON(http.StatusNotFound, ErrorResponse{Error: "Product not found: " + productID})
+		return false
+	}
+
+	if available := products[productID].Available; available < quantity {
+		c.JSON(http.StatusConflict, ErrorResponse{
+			Error: fmt.Sprintf("Insufficient stock for product %s. Available: %d, Requested: %d",
+				productID, available, quantity),
+		})
+		return false
+	}
+
+	return true
+}
+
+// HandleGetCart godoc
+// @Summary Get the cart
+// @Description Returns the buyer's cart priced with current ProductService details
+// @Tags cart
+// @Produce json
+// @Success 200 {object} CartResponse
+// @Failure 401 {object} ErrorResponse
+// @Failure 502 {object} ErrorResponse
+// @Router /cart [get]
+func HandleGetCart(c *gin.Context) {
+	buyerID, exists := c.Get("userId")
+	if !exists {
+		c.JSON(http.StatusUnauthorized, ErrorResponse{Error: "User ID not found in token"})
+		return
+	}
+
+	respondWithCart(c, buyerID.(string))
+}
+
+// HandleAddCartItem godoc
+// @Summary Add a product to the cart
+// @Description Adds the quantity to the product's cart line, creating it if needed; the total is checked against available stock
+// @Tags cart
+// @Accept json
+// @Produce json
+// @Param request body AddCartItemInput true "Product and quantity"
+// @Success 200 {object} CartResponse
+// @Failure 400 {object} ErrorResponse
+// @Failure 401 {object} ErrorResponse
+// @Failure 404 {object} ErrorResponse
+// @Failure 409 {object} ErrorResponse
+// @Router /cart/items [post]
+func HandleAddCartItem(c *gin.Context) {
+	var input AddCartItemInput
+	if err := c.ShouldBindJSON(&input); err != nil {
+		c.JSON(http.StatusBadRequest, ErrorResponse{Error: "Invalid request. productId and a positive quantity are required."})
+		return
+	}
+
+	buyerID, exists := c.Get("userId")
+	if !exists {
+		c.JSON(http.StatusUnauthorized, ErrorResponse{Error: "User ID not found in token"})
+		return
+	}
+
+	var existing CartItemModel
+	err := db.Where("buyer_id = ? AND product_id = ?", buyerID, input.ProductID).First(&existing).Error
+	switch {
+	case errors.Is(err, gorm.ErrRecordNotFound):
+		var lines int64
+		if err := db.Model(&CartItemModel{}).Where("buyer_id = ?", buyerID).Count(&lines).Error; err != nil {
+			c.JSON(http.StatusInternalServerError, ErrorResponse{Error: "Failed to fetch cart"})
+			return
+		}
+		if lines >= maxCartLines {
+			c.JSON(http.StatusBadRequest, ErrorResponse{Error: fmt.Sprintf("Cart cannot hold more than %d products", maxCartLines)})
+			return
+		}
+	case err != nil:
+		c.JSON(http.StatusInternalServerError, ErrorResponse{Error: "Failed to fetch cart"})
+		return
+	}
+
+	quantity := existing.Quantity + input.Quantity
+	if !validateCartQuantity(c, input.ProductID, quantity) {
+		return
+	}
+
+	item := CartItemModel{BuyerID: buyerID.(string), ProductID: input.ProductID, Quantity: quantity}
+	err = db.Clauses(clause.OnConflict{
+		Columns:   []clause.Column{{Name: "buyer_id"}, {Name: "product_id"}},
+		DoUpdates: clause.AssignmentColumns([]string{"quantity", "updated_at"}),
+	}).Create(&item).Error
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, ErrorResponse{Error: "Failed to update cart"})
+		return
+	}
+
+	respondWithCart(c, buyerID.(string))
+}
+
+// HandleUpdateCartItem godoc
+// @Summary Change a cart line's quantity
+// @Description Sets the quantity of a product already in the cart; checked against available stock
+// @Tags cart
+// @Accept json
+// @Produce json
+// @Param productId path string true "Product ID"
+// @Param request body UpdateCartItemInput true "New quantity"
+// @Success 200 {object} CartResponse
+// @Failure 400 {object} ErrorResponse
+// @Failure 401 {object} ErrorResponse
+// @Failure 404 {object} ErrorResponse
+// @Failure 409 {object} ErrorResponse
+// @Router /cart/items/{productId} [put]
+func HandleUpdateCartItem(c *gin.Context) {
+	productID := c.Param("productId")
+
+	var input UpdateCartItemInput
+	if err := c.ShouldBindJSON(&input); err != nil {
+		c.JSON(http.StatusBadRequest, ErrorResponse{Error: "Invalid request. A positive quantity is required."})
+		return
+	}
+
+	buyerID, exists := c.Get("userId")
+	if !exists {
+		c.JSON(http.StatusUnauthorized, ErrorResponse{Error: "User ID not found in token"})
+		return
+	}
+
+	var item CartItemModel
+	if err := db.Where("buyer_id = ? AND product_id = ?", buyerID, productID).First(&item).Error; err != nil {
+		c.JSON(http.StatusNotFound, ErrorResponse{Error: "Product is not in the cart"})
+		return
+	}
+
+	if !validateCartQuantity(c, productID, input.Quantity) {
+		return
+	}
+
+	if err := db.Model(&item).Update("quantity", input.Quantity).Error; err != nil {
+		c.JSON(http.StatusInternalServerError, ErrorResponse{Error: "Failed to update cart"})
+		return
+	}
+
+	respondWithCart(c, buyerID.(string))
+}
+
+// HandleRemoveCartItem godoc
+// @Summary Remove a product from the cart
+// @Tags cart
+// @Produce json
+// @Param productId path string true "Product ID"
+// @Success 200 {object} CartResponse
+// @Failure 401 {object} ErrorResponse
+// @Failure 404 {object} ErrorResponse
+// @Router /cart/items/{productId} [delete]
+func HandleRemoveCartItem(c *gin.Context) {
+	productID := c.Param("productId")
+
+	buyerID, exists := c.Get("userId")
+	if !exists {
+		c.JSON(http.StatusUnauthorized, ErrorResponse{Error: "User ID not found in token"})
+		return
+	}
+
+	result := db.Where("buyer_id = ? AND product_id = ?", buyerID, productID).Delete(&CartItemModel{})
+	if result.Error != nil {
+		c.JSON(http.StatusInternalServerError, ErrorResponse{Error: "Failed to update cart"})
+		return
+	}
+	if result.RowsAffected == 0 {
+		c.JSON(http.StatusNotFound, ErrorResponse{Error: "Product is not in the cart"})
+		return
+	}
+
+	respondWithCart(c, buyerID.(string))
+}
+
+// HandleCartCheckout godoc
+// @Summary Check out the cart
+// @Description Places an order for every line in the cart, exactly like POST /createOrder, and empties the cart in the same transaction
+// @Tags cart
+// @Accept json
+// @Produce json
+// @Param request body CartCheckoutInput false "Optional coupon code and shipping address"
+// @Param Idempotency-Key header string false "Key that makes retries return the original response"
+// @Success 201 {object} CreateOrderResponse
+// @Failure 400 {object} ErrorResponse
+// @Failure 401 {object} ErrorResponse
+// @Failure 404 {object} ErrorResponse
+// @Failure 409 {object} ErrorResponse
+// @Failure 422 {object} ErrorResponse
+// @Failure 500 {object} ErrorResponse
+// @Router /cart/checkout [post]
+func HandleCartCheckout(c *gin.Context) {
+	var input CartCheckoutInput
+	if c.Request.ContentLength != 0 {
+		if err := c.ShouldBindJSON(&input); err != nil {
+			c.JSON(http.StatusBadRequest, ErrorResponse{Error: "Invalid request body"})
+			return
+		}
+	}
+
+	buyerID, exists := c.Get("userId")
+	if !exists {
+		c.JSON(http.StatusUnauthorized, ErrorResponse{Error: "User ID not found in token"})
+		return
+	}
+
+	// A retry after a successful checkout finds the cart empty, so the key is
+	// checked before the cart is read
+	idempotencyKey, requestHash, done := CheckIdempotencyKey(c, buyerID.(string), cartCheckoutRequest{
+		Cart:            true,
+		CouponCode:      NormalizeCouponCode(input.CouponCode),
+		AddressID:       input.AddressID,
+		ShippingAddress: input.ShippingAddress,
+	})
+	if done {
+		return
+	}
+
+	cart, err := orderRepo.CartItems(c.Request.Context(), buyerID.(string))
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, ErrorResponse{Error: "Failed to fetch cart"})
+		return
+	}
+	if len(cart) == 0 {
+		c.JSON(http.StatusBadRequest, ErrorResponse{Error: "Cart is empty"})
+		return
+	}
+
+	items := make([]OrderItem, len(cart))
+	productIDs := make([]string, len(cart))
+	for i, line := range cart {
+		items[i] = OrderItem{ProductID: line.ProductID, Quantity: line.Quantity}
+		productIDs[i] = line.ProductID
+	}
+
+	PlaceOrder(c, OrderRequest{
+		BuyerID:         buyerID.(string),
+		Items:           items,
+		CouponCode:      input.CouponCode,
+		AddressID:       input.AddressID,
+		ShippingAddress: input.ShippingAddress,
+		IdempotencyKey:  idempotencyKey,
+		RequestHash:     requestHash,
+		ClearCart:       productIDs,
+	})
+}
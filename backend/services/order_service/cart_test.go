@@ -0,0 +1,111 @@
+package main
+
+import (
+	"bytes"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestBuildCartResponse(t *testing.T) {
+	products := map[string]ProductDetails{
+		"p1": {ProductID: "p1", Name: "Headphones", Price: lkr(5999), Available: 10, SellerID: "s1"},
+		"p2": {ProductID: "p2", Name: "Cable", Price: lkr(500), Available: 1, SellerID: "s2"},
+	}
+
+	t.Run("all_lines_available", func(t *testing.T) {
+		cart := BuildCartResponse([]CartItemModel{
+			{ProductID: "p1", Quantity: 2},
+			{ProductID: "p2", Quantity: 1},
+		}, products)
+
+		require.Len(t, cart.Items, 2)
+		assert.Equal(t, CartLine{ProductID: "p1", Quantity: 2, Name: "Headphones", Price: lkr(5999), SellerID: "s1", Available: 10, LineTotal: lkr(11998)}, cart.Items[0])
+		assert.Equal(t, lkr(12498), cart.Subtotal)
+		assert.True(t, cart.Checkable)
+	})
+
+	t.Run("flags_problem_lines", func(t *testing.T) {
+		cart := BuildCartResponse([]CartItemModel{
+			{ProductID: "p1", Quantity: 1},
+			{ProductID: "p2", Quantity: 3},
+			{ProductID: "gone", Quantity: 1},
+		}, products)
+
+		require.Len(t, cart.Items, 3)
+		assert.Empty(t, cart.Items[0].Issue)
+		assert.Equal(t, CartIssueInsufficientStock, cart.Items[1].Issue)
+		assert.Equal(t, 1, cart.Items[1].Available)
+		assert.Equal(t, CartIssueUnavailable, cart.Items[2].Issue)
+		assert.Equal(t, lkr(5999), cart.Subtotal, "problem lines are left out of the subtotal")
+		assert.False(t, cart.Checkable)
+	})
+
+	t.Run("flags_other_currency", func(t *testing.T) {
+		priced := map[string]ProductDetails{
+			"p1": products["p1"],
+			"p3": {ProductID: "p3", Name: "Adapter", Price: Money{Amount: 1500, Currency: "USD"}, Available: 5, SellerID: "s3"},
+		}
+		cart := BuildCartResponse([]CartItemModel{
+			{ProductID: "p1", Quantity: 1},
+			{ProductID: "p3", Quantity: 1},
+		}, priced)
+
+		assert.Equal(t, CartIssueCurrency, cart.Items[1].Issue)
+		assert.Equal(t, lkr(5999), cart.Subtotal)
+		assert.False(t, cart.Checkable)
+	})
+
+	t.Run("empty_cart", func(t *testing.T) {
+		cart := BuildCartResponse(nil, products)
+
+		assert.NotNil(t, cart.Items)
+		assert.Empty(t, cart.Items)
+		assert.False(t, cart.Checkable)
+	})
+}
+
+func TestCartInputValidation(t *testing.T) {
+	tests := []struct {
+		name           string
+		method         string
+		path           string
+		requestBody    string
+		expectedStatus int
+	}{
+		{name: "add_missing_product", method: "POST", path: "/cart/items", requestBody: `{"quantity": 1}`, expectedStatus: http.StatusBadRequest},
+		{name: "add_zero_quantity", method: "POST", path: "/cart/items", requestBody: `{"productId": "p1", "quantity": 0}`, expectedStatus: http.StatusBadRequest},
+		{name: "add_no_user_in_context", method: "POST", path: "/cart/items", requestBody: `{"productId": "p1", "quantity": 1}`, expectedStatus: http.StatusUnauthorized},
+		{name: "update_negative_quantity", method: "PUT", path: "/cart/items/p1", requestBody: `{"quantity": -1}`, expectedStatus: http.StatusBadRequest},
+		{name: "update_no_user_in_context", method: "PUT", path: "/cart/items/p1", requestBody: `{"quantity": 2}`, expectedStatus: http.StatusUnauthorized},
+		{name: "remove_no_user_in_context", method: "DELETE", path: "/cart/items/p1", expectedStatus: http.StatusUnauthorized},
+		{name: "get_no_user_in_context", method: "GET", path: "/cart", expectedStatus: http.StatusUnauthorized},
+		{name: "checkout_no_user_in_context", method: "POST", path: "/cart/checkout", expectedStatus: http.StatusUnauthorized},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			r := setupTestRouter()
+			r.GET("/cart", HandleGetCart)
+			r.POST("/cart/items", HandleAddCartItem)
+			r.PUT("/cart/items/:productId", HandleUpdateCartItem)
+			r.DELETE("/cart/items/:productId", HandleRemoveCartItem)
+			r.POST("/cart/checkout", HandleCartCheckout)
+
+			req, _ := http.NewRequest(tt.method, tt.path, bytes.NewBufferString(tt.requestBody))
+			req.Header.Set("Content-Type", "application/json")
+			w := httptest.NewRecorder()
+			r.ServeHTTP(w, req)
+
+			assert.Equal(t, tt.expectedStatus, w.Code)
+		})
+	}
+}
+
+func TestCartItemTableName(t *testing.T) {
+	item := CartItemModel{}
+	assert.Equal(t, "cart_items", item.TableName())
+}
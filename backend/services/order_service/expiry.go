@@ -0,0 +1,89 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"log"
+	"time"
+)
+
+// =============================================================================
+// Pending Order Expiry
+// =============================================================================
+
+// OrderExpirer moves orders that stayed pending longer than Window to
+// "expired". Expiring an order queues an "order-expired" event, which the stock
+// updater Lambda uses to release the checkout's stock reservation.
+//
+// The Postgres repository claims candidate orders with SELECT ... FOR UPDATE
+// SKIP LOCKED, so several replicas can run an expirer at the same time without
+// expiring the same order twice or blocking each other. A payment webhook that
+// locks the same order waits for the expirer's transaction, then finds it no
+// longer pending (and the other way round).
+type OrderExpirer struct {
+	Repo      OrderRepository
+	Window    time.Duration
+	Interval  time.Duration
+	BatchSize int
+}
+
+// NewOrderExpirer creates an expirer with default batching settings.
+func NewOrderExpirer(repo OrderRepository, window, interval time.Duration) *OrderExpirer {
+	return &OrderExpirer{
+		Repo:      repo,
+		Window:    window,
+		Interval:  interval,
+		BatchSize: 100,
+	}
+}
+
+// Run expires overdue orders every Interval until the context is cancelled.
+func (e *OrderExpirer) Run(ctx context.Context) {
+	log.Printf("⏰ Order expirer started (window %s)", e.Window)
+
+	ticker := time.NewTicker(e.Interval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ctx.Done():
+			log.Println("Order expirer stopped")
+			return
+		case <-ticker.C:
+			e.ExpireOverdue(ctx)
+		}
+	}
+}
+
+// ExpireOverdue expires batches until no overdue orders are left.
+func (e *OrderExpirer) ExpireOverdue(ctx context.Context) {
+	for {
+		expired, err := e.ExpireBatch(ctx, time.Now().UTC())
+		if err != nil {
+			log.Printf("Order expirer error: %v", err)
+			return
+		}
+		if expired > 0 {
+			log.Printf("⏰ Expired %d unpaid orders", expired)
+		}
+		if expired < e.BatchSize {
+			return
+		}
+	}
+}
+
+// ExpireBatch moves up to BatchSize pending orders created before the expiry
+// cutoff to "expired". It returns the number of orders expired.
+func (e *OrderExpirer) ExpireBatch(ctx context.Context, now time.Time) (int, error) {
+	return e.Repo.ExpirePending(ctx, e.Cutoff(now), e.BatchSize, e.Reason())
+}
+
+// Cutoff returns the creation time before which a pending order is overdue.
+func (e *OrderExpirer) Cutoff(now time.Time) time.Time {
+	return now.Add(-e.Window)
+}
+
+// Reason is the status history reason recorded for expired orders.
+func (e *OrderExpirer) Reason() string {
+	return fmt.Sprintf("not paid within %s", e.Window)
+}
@@ -0,0 +1,68 @@
+package main
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestOrderExpirerCutoff(t *testing.T) {
+	expirer := NewOrderExpirer(nil, 15*time.Minute, time.Minute)
+	now := time.Date(2026, 2, 7, 10, 0, 0, 0, time.UTC)
+
+	assert.Equal(t, time.Date(2026, 2, 7, 9, 45, 0, 0, time.UTC), expirer.Cutoff(now))
+	assert.Equal(t, "not paid within 15m0s", expirer.Reason())
+	assert.Equal(t, 100, expirer.BatchSize)
+}
+
+func TestOrderExpiryDefaults(t *testing.T) {
+	assert.Greater(t, orderExpiryWindow, time.Duration(0))
+	assert.Greater(t, orderExpiryInterval, time.Duration(0))
+}
+
+func TestOrderExpirerExpireBatch(t *testing.T) {
+	ctx := context.Background()
+	now := time.Now().UTC()
+	repo := NewMemoryOrderRepository()
+	seedMemoryOrders(t, repo, "checkout-1",
+		OrderModel{OrderID: "old-1", BuyerID: "buyer-1", SellerID: "seller-1"},
+		OrderModel{OrderID: "old-2", BuyerID: "buyer-1", SellerID: "seller-2"},
+		OrderModel{OrderID: "old-paid", BuyerID: "buyer-1", SellerID: "seller-3"},
+		OrderModel{OrderID: "fresh", BuyerID: "buyer-1", SellerID: "seller-4"},
+	)
+	repo.orders["old-1"].CreatedAt = now.Add(-2 * time.Hour)
+	repo.orders["old-2"].CreatedAt = now.Add(-time.Hour)
+	repo.orders["old-paid"].CreatedAt = now.Add(-3 * time.Hour)
+	_, err := repo.UpdateStatus(ctx, "old-paid", StatusChange{To: StatusPaid, ActorID: "payment", Role: RoleSystem})
+	require.NoError(t, err)
+
+	expirer := NewOrderExpirer(repo, 15*time.Minute, time.Minute)
+	expirer.BatchSize = 1
+
+	expired, err := expirer.ExpireBatch(ctx, now)
+	require.NoError(t, err)
+	assert.Equal(t, 1, expired)
+	order, _ := repo.GetOrder(ctx, "old-1")
+	assert.Equal(t, StatusExpired, order.Status, "the oldest order goes first")
+	order, _ = repo.GetOrder(ctx, "old-2")
+	assert.Equal(t, StatusPending, order.Status)
+
+	expirer.ExpireOverdue(ctx)
+
+	for id, status := range map[string]string{"old-1": StatusExpired, "old-2": StatusExpired, "old-paid": StatusPaid, "fresh": StatusPending} {
+		order, err := repo.GetOrder(ctx, id)
+		require.NoError(t, err)
+		assert.Equal(t, status, order.Status, id)
+	}
+	assert.Equal(t, []string{"order-placed", "order-expired"}, repo.Events("old-2"))
+	assert.Equal(t, []string{"order-placed"}, repo.Events("fresh"))
+
+	history, err := repo.History(ctx, "old-2")
+	require.NoError(t, err)
+	require.Len(t, history, 2)
+	assert.Equal(t, "order-expirer", history[1].ActorID)
+	assert.Equal(t, "not paid within 15m0s", history[1].Reason)
+}
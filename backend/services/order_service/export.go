@@ -0,0 +1,326 @@
+package main
+
+import (
+	"compress/gzip"
+	"context"
+	"encoding/csv"
+	"encoding/json"
+	"fmt"
+	"io"
+	"log"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"gorm.io/gorm"
+)
+
+// =============================================================================
+// Order Export (streaming CSV / NDJSON)
+// =============================================================================
+
+// Sellers export their orders for accounting with one row per order line:
+// the JSONB items are flattened and each line carries its order's columns.
+// Orders are read from a database cursor and written to the response as they
+// are scanned, so an export of any date range runs in constant memory.
+
+const (
+	ExportFormatCSV    = "csv"
+	ExportFormatNDJSON = "ndjson"
+
+	// exportFlushEvery is how many orders are written between flushes to the
+	// client.
+	exportFlushEvery = 200
+)
+
+// exportContentTypes maps an export format to its response content type.
+var exportContentTypes = map[string]string{
+	ExportFormatCSV:    "text/csv; charset=utf-8",
+	ExportFormatNDJSON: "application/x-ndjson",
+}
+
+// exportCSVHeader names the CSV columns, in the order of OrderExportRow.Record.
+var exportCSVHeader = []string{
+	"order_id", "checkout_id", "created_at", "status", "buyer_id",
+	"line", "product_id", "name", "quantity", "unit_price", "line_discount", "coupon_code", "line_total",
+	"order_subtotal", "order_discount", "order_shipping", "order_tax", "order_total", "currency",
+	"ship_to_name", "ship_to_city", "ship_to_region", "ship_to_postal_code", "ship_to_country",
+}
+
+// OrderExportRow is one order line with its order's columns.
+type OrderExportRow struct {
+	OrderID          string    `json:"orderId"`
+	CheckoutID       string    `json:"checkoutId,omitempty"`
+	CreatedAt        time.Time `json:"createdAt"`
+	Status           string    `json:"status"`
+	BuyerID          string    `json:"buyerId"`
+	Line             int       `json:"line"`
+	ProductID        string    `json:"productId"`
+	Name             string    `json:"name,omitempty"`
+	Quantity         int       `json:"quantity"`
+	UnitPrice        Money     `json:"unitPrice"`
+	LineDiscount     Money     `json:"lineDiscount,omitzero"`
+	CouponCode       string    `json:"couponCode,omitempty"`
+	LineTotal        Money     `json:"lineTotal"`
+	OrderSubtotal    Money     `json:"orderSubtotal"`
+	OrderDiscount    Money     `json:"orderDiscount,omitzero"`
+	OrderShipping    Money     `json:"orderShipping"`
+	OrderTax         Money     `json:"orderTax"`
+	OrderTotal       Money     `json:"orderTotal"`
+	ShipToName       string    `json:"shipToName,omitempty"`
+	ShipToCity       string    `json:"shipToCity,omitempty"`
+	ShipToRegion     string    `json:"shipToRegion,omitempty"`
+	ShipToPostalCode string    `json:"shipToPostalCode,omitempty"`
+	ShipToCountry    string    `json:"shipToCountry,omitempty"`
+}
+
+// FlattenOrder returns one export row per line of the order, numbered from 1.
+// Line totals come from OrderItem.Total.
+func FlattenOrder(order OrderModel) []OrderExportRow {
+	rows := make([]OrderExportRow, 0, len(order.Items))
+	for i, item := range order.Items {
+		row := OrderExportRow{
+			OrderID:       order.OrderID,
+			CheckoutID:    order.CheckoutID,
+			CreatedAt:     order.CreatedAt.UTC(),
+			Status:        order.Status,
+			BuyerID:       order.BuyerID,
+			Line:          i + 1,
+			ProductID:     item.ProductID,
+			Name:          item.Name,
+			Quantity:      item.Quantity,
+			UnitPrice:     item.Price,
+			LineDiscount:  item.Discount,
+			CouponCode:    item.CouponCode,
+			LineTotal:     item.Total(),
+			OrderSubtotal: order.Subtotal,
+			OrderDiscount: order.Discount,
+			OrderShipping: order.Shipping,
+			OrderTax:      order.Tax,
+			OrderTotal:    order.TotalPrice,
+		}
+		if address := order.ShippingAddress; address != nil {
+			row.ShipToName = address.Name
+			row.ShipToCity = address.City
+			row.ShipToRegion = address.Region
+			row.ShipToPostalCode = address.PostalCode
+			row.ShipToCountry = address.Country
+		}
+		rows = append(rows, row)
+	}
+	return rows
+}
+
+// Record lays the row out as CSV fields matching exportCSVHeader. Amounts are
+// in major units of the order's currency. Free-text fields are passed through
+// csvText.
+func (r OrderExportRow) Record() []string {
+	currency := r.OrderTotal.Currency
+	decimal := func(m Money) string {
+		if m.Currency == "" {
+			m.Currency = currency // omitted discounts
+		}
+		return m.Decimal()
+	}
+
+	return []string{
+		r.OrderID, r.CheckoutID, r.CreatedAt.Format(time.RFC3339), r.Status, r.BuyerID,
+		strconv.Itoa(r.Line), csvText(r.ProductID), csvText(r.Name), strconv.Itoa(r.Quantity),
+		decimal(r.UnitPrice), decimal(r.LineDiscount), csvText(r.CouponCode), decimal(r.LineTotal),
+		decimal(r.OrderSubtotal), decimal(r.OrderDiscount), decimal(r.OrderShipping), decimal(r.OrderTax),
+		decimal(r.OrderTotal), currency,
+		csvText(r.ShipToName), csvText(r.ShipToCity), csvText(r.ShipToRegion), csvText(r.ShipToPostalCode), csvText(r.ShipToCountry),
+	}
+}
+
+// csvText stops spreadsheet apps from running a buyer- or seller-supplied
+// cell as a formula: a value starting with =, +, -, @, tab or carriage return
+// is prefixed with a single quote.
+func csvText(value string) string {
+	if value != "" && strings.ContainsRune("=+-@\t\r", rune(value[0])) {
+		return "'" + value
+	}
+	return value
+}
+
+// OrderExportWriter encodes export rows in one of the export formats.
+type OrderExportWriter interface {
+	WriteRow(row OrderExportRow) error
+	// Flush writes any buffered rows to the underlying writer.
+	Flush() error
+}
+
+// NewOrderExportWriter returns a writer for the format. A CSV export starts
+// with its header row.
+func NewOrderExportWriter(w io.Writer, format string) (OrderExportWriter, error) {
+	switch format {
+	case ExportFormatCSV:
+		cw := csv.NewWriter(w)
+		if err := cw.Write(exportCSVHeader); err != nil {
+			return nil, err
+		}
+		return csvExportWriter{cw}, nil
+	case ExportFormatNDJSON:
+		return ndjsonExportWriter{json.NewEncoder(w)}, nil
+	default:
+		return nil, fmt.Errorf("unknown export format %q", format)
+	}
+}
+
+type csvExportWriter struct{ w *csv.Writer }
+
+func (e csvExportWriter) WriteRow(row OrderExportRow) error { return e.w.Write(row.Record()) }
+
+func (e csvExportWriter) Flush() error {
+	e.w.Flush()
+	return e.w.Error()
+}
+
+// ndjsonExportWriter writes one JSON object per line; json.Encoder does not
+// buffer, so Flush has nothing to do.
+type ndjsonExportWriter struct{ enc *json.Encoder }
+
+func (e ndjsonExportWriter) WriteRow(row OrderExportRow) error { return e.enc.Encode(row) }
+
+func (e ndjsonExportWriter) Flush() error { return nil }
+
+// StreamOrderExport scans a seller's orders matching the filters oldest first
+// and writes their flattened lines to w, calling flush every exportFlushEvery
+// orders. It returns the number of orders written.
+func StreamOrderExport(ctx context.Context, database *gorm.DB, sellerID string, params OrderListParams, w OrderExportWriter, flush func() error) (int, error) {
+	query := applyOrderFilters(database.WithContext(ctx).Model(&OrderModel{}).Where("seller_id = ?", sellerID), params)
+	rows, err := query.Order("created_at ASC").Order("order_id ASC").Rows()
+	if err != nil {
+		return 0, fmt.Errorf("failed to query orders: %w", err)
+	}
+	defer rows.Close()
+
+	count := 0
+	for rows.Next() {
+		var order OrderModel
+		if err := database.ScanRows(rows, &order); err != nil {
+			return count, fmt.Errorf("failed to scan order: %w", err)
+		}
+		for _, row := range FlattenOrder(order) {
+			if err := w.WriteRow(row); err != nil {
+				return count, err
+			}
+		}
+
+		count++
+		if count%exportFlushEvery == 0 {
+			if err := flush(); err != nil {
+				return count, err
+			}
+		}
+	}
+	if err := rows.Err(); err != nil {
+		return count, fmt.Errorf("failed to read orders: %w", err)
+	}
+
+	return count, flush()
+}
+
+// acceptsGzip reports whether an Accept-Encoding header allows gzip, i.e.
+// lists it without q=0.
+func acceptsGzip(header string) bool {
+	for _, part := range strings.Split(header, ",") {
+		coding, params, _ := strings.Cut(part, ";")
+		if !strings.EqualFold(strings.TrimSpace(coding), "gzip") {
+			continue
+		}
+		name, value, _ := strings.Cut(strings.TrimSpace(params), "=")
+		if strings.TrimSpace(name) != "q" {
+			return true
+		}
+		q, err := strconv.ParseFloat(strings.TrimSpace(value), 64)
+		return err == nil && q > 0
+	}
+	return false
+}
+
+// HandleExportOrders godoc
+// @Summary Export seller orders
+// @Description Streams the seller's orders oldest first as CSV or NDJSON, one row per order line (seller only). The response is gzip-encoded when the client accepts it.
+// @Tags orders
+// @Produce text/csv
+// @Produce application/x-ndjson
+// @Param format query string false "csv or ndjson (default csv)"
+// @Param status query string false "Comma-separated statuses"
+// @Param from query string false "Created at or after (RFC3339 or YYYY-MM-DD)"
+// @Param to query string false "Created before (RFC3339, or YYYY-MM-DD inclusive)"
+// @Success 200 {string} string "CSV or NDJSON rows"
+// @Failure 400 {object} ErrorResponse
+// @Failure 401 {object} ErrorResponse
+// @Failure 403 {object} ErrorResponse
+// @Router /seller/orders/export [get]
+func HandleExportOrders(c *gin.Context) {
+	userID, exists := c.Get("userId")
+	if !exists {
+		c.JSON(http.StatusUnauthorized, ErrorResponse{Error: "User ID not found in token"})
+		return
+	}
+
+	customRole, _ := c.Get("customRole")
+	if customRole != "seller" {
+		c.JSON(http.StatusForbidden, ErrorResponse{Error: "Only sellers can export orders"})
+		return
+	}
+	sellerID := userID.(string)
+
+	format := strings.ToLower(c.DefaultQuery("format", ExportFormatCSV))
+	contentType, ok := exportContentTypes[format]
+	if !ok {
+		c.JSON(http.StatusBadRequest, ErrorResponse{Error: "Invalid format. Use csv or ndjson."})
+		return
+	}
+
+	var params OrderListParams
+	if err := parseOrderFilters(c, &params); err != nil {
+		c.JSON(http.StatusBadRequest, ErrorResponse{Error: "Invalid query: " + err.Error()})
+		return
+	}
+
+	filename := fmt.Sprintf("orders_%s.%s", time.Now().UTC().Format("20060102T150405Z"), format)
+	c.Header("Content-Type", contentType)
+	c.Header("Content-Disposition", fmt.Sprintf("attachment; filename=%q", filename))
+	c.Header("Cache-Control", "no-store")
+	c.Header("Vary", "Accept-Encoding")
+	c.Header("X-Accel-Buffering", "no")
+
+	var out io.Writer = c.Writer
+	var gz *gzip.Writer
+	if acceptsGzip(c.GetHeader("Accept-Encoding")) {
+		c.Header("Content-Encoding", "gzip")
+		gz = gzip.NewWriter(c.Writer)
+		defer gz.Close()
+		out = gz
+	}
+	c.Status(http.StatusOK)
+
+	writer, err := NewOrderExportWriter(out, format)
+	if err != nil {
+		log.Printf("Failed to start order export for seller %s: %v", sellerID, err)
+		return
+	}
+	flush := func() error {
+		if err := writer.Flush(); err != nil {
+			return err
+		}
+		if gz != nil {
+			if err := gz.Flush(); err != nil {
+				return err
+			}
+		}
+		c.Writer.Flush()
+		return nil
+	}
+
+	// The status is already sent, so a failure part way can only cut the
+	// export short
+	if count, err := StreamOrderExport(c.Request.Context(), db, sellerID, params, writer, flush); err != nil {
+		log.Printf("Order export for seller %s stopped after %d orders: %v", sellerID, count, err)
+	}
+}
@@ -0,0 +1,170 @@
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func exportOrder() OrderModel {
+	return OrderModel{
+		OrderID:    "order-1",
+		CheckoutID: "checkout-1",
+		BuyerID:    "buyer-1",
+		SellerID:   "seller-1",
+		Status:     StatusShipped,
+		Items: OrderItemsJSON{
+			{ProductID: "prod-1", Name: "Cable, USB-C", Quantity: 2, Price: cents(150000), Discount: cents(30000), CouponCode: "SAVE10", LineTotal: cents(270000)},
+			{ProductID: "prod-2", Name: "Charger", Quantity: 1, Price: cents(450000)},
+		},
+		Subtotal:        cents(750000),
+		Discount:        cents(30000),
+		Shipping:        cents(50000),
+		Tax:             cents(0),
+		TotalPrice:      cents(770000),
+		ShippingAddress: &Address{Name: "Nimal Perera", City: "Colombo", PostalCode: "00300", Country: "LK"},
+		CreatedAt:       time.Date(2026, 3, 1, 9, 30, 0, 0, time.FixedZone("+0530", 5*3600+1800)),
+	}
+}
+
+func TestFlattenOrder(t *testing.T) {
+	rows := FlattenOrder(exportOrder())
+	require.Len(t, rows, 2)
+
+	assert.Equal(t, 1, rows[0].Line)
+	assert.Equal(t, "prod-1", rows[0].ProductID)
+	assert.Equal(t, cents(270000), rows[0].LineTotal)
+	assert.Equal(t, cents(770000), rows[0].OrderTotal, "order columns are repeated on every line")
+	assert.Equal(t, "Colombo", rows[0].ShipToCity)
+	assert.Equal(t, time.UTC, rows[0].CreatedAt.Location())
+
+	assert.Equal(t, 2, rows[1].Line)
+	assert.Equal(t, cents(450000), rows[1].LineTotal, "a line without a line total falls back to price x quantity")
+	assert.Equal(t, "order-1", rows[1].OrderID)
+
+	order := exportOrder()
+	order.ShippingAddress = nil
+	assert.Empty(t, FlattenOrder(order)[0].ShipToCountry)
+}
+
+func TestOrderItemTotal(t *testing.T) {
+	assert.Equal(t, cents(270000), OrderItem{Quantity: 2, Price: cents(150000), Discount: cents(30000), LineTotal: cents(270000)}.Total())
+	assert.Equal(t, cents(450000), OrderItem{Quantity: 1, Price: cents(450000)}.Total(), "legacy lines fall back to price x quantity")
+
+	// A fully discounted line loses its zero lineTotal in the JSONB column,
+	// but is still free rather than full price
+	stored, err := json.Marshal(OrderItemsJSON{{ProductID: "prod-3", Quantity: 1, Price: cents(1000), Discount: cents(1000), LineTotal: cents(0)}})
+	require.NoError(t, err)
+	var items OrderItemsJSON
+	require.NoError(t, items.Scan(stored))
+	assert.Equal(t, cents(0), items[0].Total())
+
+	rows := FlattenOrder(OrderModel{Items: items})
+	assert.Equal(t, cents(0), rows[0].LineTotal)
+}
+
+func TestOrderExportRowRecordEscapesFormulas(t *testing.T) {
+	row := FlattenOrder(exportOrder())[0]
+	row.Name = "=HYPERLINK(\"http://evil.example\")"
+	row.ShipToName = "+94 77 123 4567"
+	row.ShipToCity = "@SUM(A1)"
+	row.ShipToRegion = "-Western"
+
+	record := row.Record()
+	assert.Equal(t, "'=HYPERLINK(\"http://evil.example\")", record[7])
+	assert.Equal(t, "'+94 77 123 4567", record[19])
+	assert.Equal(t, "'@SUM(A1)", record[20])
+	assert.Equal(t, "'-Western", record[21])
+	assert.Equal(t, "00300", record[22], "other cells are left alone")
+	assert.Equal(t, "300.00", record[10], "amounts are never escaped")
+}
+
+func TestOrderExportWriterCSV(t *testing.T) {
+	var buf bytes.Buffer
+	w, err := NewOrderExportWriter(&buf, ExportFormatCSV)
+	require.NoError(t, err)
+	for _, row := range FlattenOrder(exportOrder()) {
+		require.NoError(t, w.WriteRow(row))
+	}
+	require.NoError(t, w.Flush())
+
+	lines := strings.Split(strings.TrimSpace(buf.String()), "\n")
+	require.Len(t, lines, 3)
+	assert.Equal(t, strings.Join(exportCSVHeader, ","), lines[0])
+	assert.Equal(t, `order-1,checkout-1,2026-03-01T04:00:00Z,shipped,buyer-1,1,prod-1,"Cable, USB-C",2,1500.00,300.00,SAVE10,2700.00,`+
+		`7500.00,300.00,500.00,0.00,7700.00,LKR,Nimal Perera,Colombo,,00300,LK`, lines[1])
+	assert.Contains(t, lines[2], ",2,prod-2,Charger,1,4500.00,0.00,,4500.00,", "a line without a discount exports 0.00")
+}
+
+func TestOrderExportWriterNDJSON(t *testing.T) {
+	var buf bytes.Buffer
+	w, err := NewOrderExportWriter(&buf, ExportFormatNDJSON)
+	require.NoError(t, err)
+	for _, row := range FlattenOrder(exportOrder()) {
+		require.NoError(t, w.WriteRow(row))
+	}
+	require.NoError(t, w.Flush())
+
+	lines := strings.Split(strings.TrimSpace(buf.String()), "\n")
+	require.Len(t, lines, 2)
+
+	var row map[string]interface{}
+	require.NoError(t, json.Unmarshal([]byte(lines[1]), &row))
+	assert.Equal(t, "prod-2", row["productId"])
+	assert.Equal(t, float64(2), row["line"])
+	assert.NotContains(t, row, "lineDiscount")
+
+	_, err = NewOrderExportWriter(&buf, "xlsx")
+	assert.Error(t, err)
+}
+
+func TestAcceptsGzip(t *testing.T) {
+	assert.True(t, acceptsGzip("gzip"))
+	assert.True(t, acceptsGzip("gzip, deflate, br"))
+	assert.True(t, acceptsGzip("br;q=1.0, GZIP;q=0.5"))
+	assert.False(t, acceptsGzip(""))
+	assert.False(t, acceptsGzip("deflate, br"))
+	assert.False(t, acceptsGzip("gzip;q=0"))
+	assert.False(t, acceptsGzip("gzip; q=0.000"))
+}
+
+func TestExportOrdersValidation(t *testing.T) {
+	tests := []struct {
+		name           string
+		role           string
+		path           string
+		expectedStatus int
+	}{
+		{name: "buyer_cannot_export", role: "buyer", path: "/seller/orders/export", expectedStatus: http.StatusForbidden},
+		{name: "unknown_format", role: "seller", path: "/seller/orders/export?format=xlsx", expectedStatus: http.StatusBadRequest},
+		{name: "invalid_from", role: "seller", path: "/seller/orders/export?from=March", expectedStatus: http.StatusBadRequest},
+		{name: "invalid_to", role: "seller", path: "/seller/orders/export?format=ndjson&to=2026-13-01", expectedStatus: http.StatusBadRequest},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			r := setupTestRouter()
+			r.Use(func(c *gin.Context) {
+				c.Set("customRole", tt.role)
+				c.Set("userId", "user-1")
+				c.Next()
+			})
+			r.GET("/seller/orders/export", HandleExportOrders)
+
+			req, _ := http.NewRequest(http.MethodGet, tt.path, nil)
+			w := httptest.NewRecorder()
+			r.ServeHTTP(w, req)
+
+			assert.Equal(t, tt.expectedStatus, w.Code)
+			assert.Empty(t, w.Header().Get("Content-Disposition"), "errors are not sent as a download")
+		})
+	}
+}
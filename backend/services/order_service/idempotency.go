@@ -0,0 +1,170 @@
+package main
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log"
+	"net/http"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"gorm.io/gorm"
+)
+
+// =============================================================================
+// Idempotency Keys
+// =============================================================================
+
+// IdempotencyKeyHeader is the request header clients use to make a create
+// request safe to retry.
+const IdempotencyKeyHeader = "Idempotency-Key"
+
+// IdempotencyRecord represents the idempotency_keys table in PostgreSQL. It
+// stores the hash of the first request made with a key and the response that
+// was returned, so a retry can be answered without creating another order.
+// Keys are scoped to the buyer that sent them.
+type IdempotencyRecord struct {
+	BuyerID     string    `gorm:"primaryKey;column:buyer_id" json:"buyerId"`
+	Key         string    `gorm:"primaryKey;column:idempotency_key" json:"key"`
+	RequestHash string    `gorm:"not null;column:request_hash" json:"requestHash"`
+	StatusCode  int       `gorm:"not null;column:status_code" json:"statusCode"`
+	Response    string    `gorm:"type:jsonb;not null;column:response" json:"response"`
+	CreatedAt   time.Time `gorm:"autoCreateTime;column:created_at" json:"createdAt"`
+	ExpiresAt   time.Time `gorm:"not null;index;column:expires_at" json:"expiresAt"`
+}
+
+// TableName specifies the table name for GORM.
+func (IdempotencyRecord) TableName() string {
+	return "idempotency_keys"
+}
+
+// HashRequest returns a stable SHA-256 hash of a bound request body. Hashing
+// the decoded input rather than the raw bytes ignores whitespace and key order.
+func HashRequest(input interface{}) (string, error) {
+	body, err := json.Marshal(input)
+	if err != nil {
+		return "", fmt.Errorf("failed to hash request: %w", err)
+	}
+	sum := sha256.Sum256(body)
+	return hex.EncodeToString(sum[:]), nil
+}
+
+// LookupIdempotencyKey returns the unexpired record for a buyer's key, or nil
+// if the key has not been used.
+func LookupIdempotencyKey(tx *gorm.DB, buyerID, key string) (*IdempotencyRecord, error) {
+	var record IdempotencyRecord
+	err := tx.Where("buyer_id = ? AND idempotency_key = ? AND expires_at > ?", buyerID, key, time.Now().UTC()).
+		First(&record).Error
+	if errors.Is(err, gorm.ErrRecordNotFound) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	return &record, nil
+}
+
+// NewIdempotencyRecord builds the record that stores a response under a
+// buyer's key until idempotencyKeyTTL after now.
+func NewIdempotencyRecord(buyerID, key, requestHash string, statusCode int, response interface{}, now time.Time) (*IdempotencyRecord, error) {
+	body, err := json.Marshal(response)
+	if err != nil {
+		return nil, fmt.Errorf("failed to marshal idempotent response: %w", err)
+	}
+
+	return &IdempotencyRecord{
+		BuyerID:     buyerID,
+		Key:         key,
+		RequestHash: requestHash,
+		StatusCode:  statusCode,
+		Response:    string(body),
+		CreatedAt:   now,
+		ExpiresAt:   now.Add(idempotencyKeyTTL),
+	}, nil
+}
+
+// SaveIdempotencyRecord stores a response inside the transaction that
+// produced it. An expired record with the same key is replaced. If another
+// request committed the same key first, the insert fails and the transaction
+// rolls back.
+func SaveIdempotencyRecord(tx *gorm.DB, record *IdempotencyRecord) error {
+	if err := tx.Where("buyer_id = ? AND idempotency_key = ? AND expires_at <= ?", record.BuyerID, record.Key, time.Now().UTC()).
+		Delete(&IdempotencyRecord{}).Error; err != nil {
+		return fmt.Errorf("failed to clear expired idempotency key: %w", err)
+	}
+
+	if err := tx.Create(record).Error; err != nil {
+		return fmt.Errorf("failed to store idempotency key: %w", err)
+	}
+
+	return nil
+}
+
+// CheckIdempotencyKey reads the request's Idempotency-Key header and, if the
+// key was already used, answers the request with the stored response. It
+// returns the key and the hash of input for saving the new response, and done
+// if a response has already been written.
+func CheckIdempotencyKey(c *gin.Context, buyerID string, input interface{}) (key, requestHash string, done bool) {
+	key = c.GetHeader(IdempotencyKeyHeader)
+	if key == "" {
+		return "", "", false
+	}
+
+	requestHash, err := HashRequest(input)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, ErrorResponse{Error: err.Error()})
+		return "", "", true
+	}
+
+	record, err := orderRepo.LookupIdempotencyKey(c.Request.Context(), buyerID, key)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, ErrorResponse{Error: "Failed to check Idempotency-Key"})
+		return "", "", true
+	}
+	if record != nil {
+		ReplayIdempotentResponse(c, record, requestHash)
+		return "", "", true
+	}
+
+	return key, requestHash, false
+}
+
+// ReplayIdempotentResponse answers a request whose key has already been used.
+// The stored response is returned when the request body matches the original,
+// otherwise the request is rejected with 422.
+func ReplayIdempotentResponse(c *gin.Context, record *IdempotencyRecord, requestHash string) {
+	if record.RequestHash != requestHash {
+		c.JSON(http.StatusUnprocessableEntity, ErrorResponse{
+			Error: "Idempotency-Key has already been used with a different request body",
+		})
+		return
+	}
+
+	c.Header("Idempotent-Replayed", "true")
+	c.Data(record.StatusCode, "application/json; charset=utf-8", []byte(record.Response))
+}
+
+// purgeExpiredIdempotencyKeys periodically deletes expired keys until the
+// context is cancelled.
+func purgeExpiredIdempotencyKeys(ctx context.Context, interval time.Duration) {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+			result := db.Where("expires_at <= ?", time.Now().UTC()).Delete(&IdempotencyRecord{})
+			if result.Error != nil {
+				log.Printf("Failed to purge expired idempotency keys: %v", result.Error)
+			} else if result.RowsAffected > 0 {
+				log.Printf("🧹 Purged %d expired idempotency keys", result.RowsAffected)
+			}
+		}
+	}
+}
@@ -0,0 +1,78 @@
+package main
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/gin-gonic/gin"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestHashRequest(t *testing.T) {
+	a := CreateOrderInput{Items: []OrderItem{{ProductID: "prod-1", Quantity: 2}}}
+	b := CreateOrderInput{Items: []OrderItem{{ProductID: "prod-1", Quantity: 2}}}
+	c := CreateOrderInput{Items: []OrderItem{{ProductID: "prod-1", Quantity: 3}}}
+
+	hashA, err := HashRequest(a)
+	assert.NoError(t, err)
+	hashB, err := HashRequest(b)
+	assert.NoError(t, err)
+	hashC, err := HashRequest(c)
+	assert.NoError(t, err)
+
+	assert.Equal(t, hashA, hashB)
+	assert.NotEqual(t, hashA, hashC)
+	assert.Len(t, hashA, 64)
+}
+
+func TestReplayIdempotentResponse(t *testing.T) {
+	record := &IdempotencyRecord{
+		BuyerID:     "buyer-1",
+		Key:         "key-1",
+		RequestHash: "hash-1",
+		StatusCode:  http.StatusCreated,
+		Response:    `{"checkoutId":"checkout-1","orderIds":["order-1"],"totalPrice":10,"paymentUrl":"/payment/checkout-1"}`,
+	}
+
+	tests := []struct {
+		name           string
+		requestHash    string
+		expectedStatus int
+		bodyContains   string
+	}{
+		{
+			name:           "same_body_replays_response",
+			requestHash:    "hash-1",
+			expectedStatus: http.StatusCreated,
+			bodyContains:   "checkout-1",
+		},
+		{
+			name:           "different_body_rejected",
+			requestHash:    "hash-2",
+			expectedStatus: http.StatusUnprocessableEntity,
+			bodyContains:   "different request body",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			r := setupTestRouter()
+			r.POST("/createOrder", func(c *gin.Context) {
+				ReplayIdempotentResponse(c, record, tt.requestHash)
+			})
+
+			req, _ := http.NewRequest("POST", "/createOrder", nil)
+			w := httptest.NewRecorder()
+			r.ServeHTTP(w, req)
+
+			assert.Equal(t, tt.expectedStatus, w.Code)
+			assert.Contains(t, w.Body.String(), tt.bodyContains)
+		})
+	}
+}
+
+func TestIdempotencyDefaults(t *testing.T) {
+	assert.Equal(t, "idempotency_keys", IdempotencyRecord{}.TableName())
+	assert.Greater(t, idempotencyKeyTTL.Hours(), 0.0)
+}
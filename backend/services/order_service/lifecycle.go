@@ -0,0 +1,353 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/google/uuid"
+	"gorm.io/gorm"
+)
+
+// =============================================================================
+// Order Lifecycle
+// =============================================================================
+
+// Order statuses.
+const (
+	StatusPending          = "pending"
+	StatusPaid             = "paid"
+	StatusPartiallyShipped = "partially_shipped"
+	StatusShipped          = "shipped"
+	StatusDelivered        = "delivered"
+	StatusCancelled        = "cancelled"
+	StatusExpired          = "expired"
+)
+
+// Actor roles recorded against status transitions.
+const (
+	RoleBuyer  = "buyer"
+	RoleSeller = "seller"
+	RoleSystem = "system"
+)
+
+// orderTransitions is the order state machine: for each current status it
+// lists the statuses an order may move to and the roles allowed to do so.
+// Anything not listed here (e.g. cancelling a delivered order, shipping an
+// unpaid one) is rejected. Once an order is paid its status follows its
+// shipments (see FulfilmentStatus); the poller delivers orders as the system.
+var orderTransitions = map[string]map[string][]string{
+	StatusPending: {
+		StatusPaid:      {RoleSystem},
+		StatusCancelled: {RoleBuyer, RoleSeller, RoleSystem},
+		StatusExpired:   {RoleSystem},
+	},
+	StatusPaid: {
+		StatusPartiallyShipped: {RoleSeller},
+		StatusShipped:          {RoleSeller},
+		StatusCancelled:        {RoleBuyer, RoleSeller, RoleSystem},
+	},
+	StatusPartiallyShipped: {
+		StatusShipped: {RoleSeller},
+	},
+	StatusShipped: {
+		StatusDelivered: {RoleSeller, RoleSystem},
+	},
+}
+
+// ErrInvalidTransition is returned when the state machine does not allow a move
+// between two statuses.
+var ErrInvalidTransition = errors.New("invalid status transition")
+
+// ErrTransitionForbidden is returned when the transition exists but the actor's
+// role may not perform it.
+var ErrTransitionForbidden = errors.New("role not allowed to perform this transition")
+
+// ErrStaleStatus is returned when the order's status changed between reading
+// it and applying the transition.
+var ErrStaleStatus = errors.New("order status changed concurrently")
+
+// ErrVersionConflict is returned when a client's If-Match version no longer
+// matches the order's, because someone else changed it since the client read
+// it.
+var ErrVersionConflict = errors.New("order version conflict")
+
+// OrderStatusHistory represents the order_status_history table in PostgreSQL.
+// One row is written for every status change an order goes through.
+type OrderStatusHistory struct {
+	HistoryID  string    `gorm:"primaryKey;type:uuid;column:history_id" json:"historyId"`
+	OrderID    string    `gorm:"type:uuid;not null;index;column:order_id" json:"orderId"`
+	FromStatus string    `gorm:"column:from_status" json:"fromStatus"`
+	ToStatus   string    `gorm:"not null;column:to_status" json:"toStatus"`
+	ActorID    string    `gorm:"not null;column:actor_id" json:"actorId"`
+	ActorRole  string    `gorm:"not null;column:actor_role" json:"actorRole"`
+	Reason     string    `gorm:"column:reason" json:"reason,omitempty"`
+	CreatedAt  time.Time `gorm:"autoCreateTime;column:created_at" json:"createdAt"`
+}
+
+// TableName specifies the table name for GORM.
+func (OrderStatusHistory) TableName() string {
+	return "order_status_history"
+}
+
+// CanTransition checks the state machine for a move from one status to another
+// by an actor with the given role.
+func CanTransition(from, to, role string) error {
+	allowed, ok := orderTransitions[from][to]
+	if !ok {
+		return fmt.Errorf("%w: %s -> %s", ErrInvalidTransition, from, to)
+	}
+
+	for _, r := range allowed {
+		if r == role {
+			return nil
+		}
+	}
+
+	return fmt.Errorf("%w: %s cannot move order from %s to %s", ErrTransitionForbidden, role, from, to)
+}
+
+// TransitionOrder moves an order to a new status and records the change in the
+// status history. It must be called inside a transaction. The update is guarded
+// on the current status and version so two concurrent transitions cannot both
+// succeed, and bumps the version. Paying for an order queues an "order-paid"
+// event so its reserved stock is committed, and cancelling or expiring one
+// queues an "order-cancelled" or "order-expired" event so its stock is
+// returned. Shipping and delivery queue fulfilment events for seller webhooks.
+// Cancelling a paid order also queues a refund of its total for the
+// RefundWorker.
+func TransitionOrder(tx *gorm.DB, order *OrderModel, to, actorID, role, reason string) error {
+	from := order.Status
+	if err := CanTransition(from, to, role); err != nil {
+		return err
+	}
+
+	result := tx.Model(&OrderModel{}).
+		Where("order_id = ? AND status = ? AND version = ?", order.OrderID, from, order.Version).
+		Updates(map[string]interface{}{"status": to, "version": gorm.Expr("version + 1")})
+	if result.Error != nil {
+		return fmt.Errorf("failed to update order status: %w", result.Error)
+	}
+	if result.RowsAffected == 0 {
+		return ErrStaleStatus
+	}
+
+	if err := RecordStatusChange(tx, order.OrderID, from, to, actorID, role, reason); err != nil {
+		return err
+	}
+
+	order.Status = to
+	order.Version++
+
+	switch to {
+	case StatusPaid:
+		if err := EnqueueOrderPaidEvent(tx, *order); err != nil {
+			return err
+		}
+	case StatusCancelled:
+		if err := EnqueueOrderCancelledEvent(tx, *order, role, reason); err != nil {
+			return err
+		}
+		if from == StatusPaid {
+			if err := QueueOrderRefund(tx, *order, reason); err != nil {
+				return err
+			}
+		}
+	case StatusExpired:
+		if err := EnqueueOrderExpiredEvent(tx, *order, reason); err != nil {
+			return err
+		}
+	case StatusPartiallyShipped, StatusShipped, StatusDelivered:
+		if err := EnqueueOrderFulfilmentEvent(tx, *order, reason); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+// RecordStatusChange writes a row to the order status history.
+func RecordStatusChange(tx *gorm.DB, orderID, from, to, actorID, role, reason string) error {
+	entry := OrderStatusHistory{
+		HistoryID:  uuid.New().String(),
+		OrderID:    orderID,
+		FromStatus: from,
+		ToStatus:   to,
+		ActorID:    actorID,
+		ActorRole:  role,
+		Reason:     reason,
+	}
+
+	if err := tx.Create(&entry).Error; err != nil {
+		return fmt.Errorf("failed to record status history: %w", err)
+	}
+
+	return nil
+}
+
+// transitionErrorStatus maps a TransitionOrder error to an HTTP status code.
+func transitionErrorStatus(err error) int {
+	switch {
+	case errors.Is(err, ErrTransitionForbidden):
+		return http.StatusForbidden
+	case errors.Is(err, ErrInvalidTransition), errors.Is(err, ErrStaleStatus):
+		return http.StatusConflict
+	case errors.Is(err, ErrVersionConflict):
+		return http.StatusPreconditionFailed
+	case errors.Is(err, ErrOrderNotFound):
+		return http.StatusNotFound
+	default:
+		return http.StatusInternalServerError
+	}
+}
+
+// OrderETag is the entity tag of an order's current version, as sent in the
+// ETag header of order responses.
+func OrderETag(order OrderModel) string {
+	return `"` + strconv.FormatInt(order.Version, 10) + `"`
+}
+
+// ParseIfMatch reads the order version from an If-Match header. An empty
+// header or "*" returns 0, meaning the update applies to any version. Weak
+// tags (W/"3") are accepted since versions are compared exactly anyway.
+func ParseIfMatch(header string) (int64, error) {
+	header = strings.TrimSpace(header)
+	if header == "" || header == "*" {
+		return 0, nil
+	}
+
+	tag := strings.TrimPrefix(header, "W/")
+	if len(tag) < 2 || tag[0] != '"' || tag[len(tag)-1] != '"' {
+		return 0, errMalformedIfMatch
+	}
+	version, err := strconv.ParseInt(tag[1:len(tag)-1], 10, 64)
+	if err != nil || version < 1 {
+		return 0, errMalformedIfMatch
+	}
+	return version, nil
+}
+
+var errMalformedIfMatch = errors.New(`If-Match must be a single quoted order version such as "3"`)
+
+// HandleGetOrderHistory godoc
+// @Summary Get order status history
+// @Description Returns every status transition of an order (buyer or seller of the order only)
+// @Tags orders
+// @Produce json
+// @Param orderId path string true "Order ID"
+// @Success 200 {object} []OrderStatusHistory
+// @Failure 401 {object} ErrorResponse
+// @Failure 403 {object} ErrorResponse
+// @Failure 404 {object} ErrorResponse
+// @Failure 500 {object} ErrorResponse
+// @Router /orders/{orderId}/history [get]
+func HandleGetOrderHistory(c *gin.Context) {
+	orderID := c.Param("orderId")
+
+	userID, exists := c.Get("userId")
+	if !exists {
+		c.JSON(http.StatusUnauthorized, ErrorResponse{Error: "User ID not found in token"})
+		return
+	}
+
+	order, err := orderRepo.GetOrder(c.Request.Context(), orderID)
+	if err != nil {
+		c.JSON(http.StatusNotFound, ErrorResponse{Error: "Order not found"})
+		return
+	}
+
+	if order.BuyerID != userID.(string) && order.SellerID != userID.(string) {
+		c.JSON(http.StatusForbidden, ErrorResponse{Error: "You can only view history of your own orders"})
+		return
+	}
+
+	history, err := orderRepo.History(c.Request.Context(), orderID)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, ErrorResponse{Error: "Failed to fetch order history"})
+		return
+	}
+
+	c.JSON(http.StatusOK, history)
+}
+
+// CancelOrderInput represents the expected JSON body for cancelling an order.
+type CancelOrderInput struct {
+	Reason string `json:"reason" binding:"required"`
+}
+
+// HandleCancelOrder godoc
+// @Summary Cancel an order
+// @Description Lets the buyer cancel their order while it is pending or paid; stock is restored via an order-cancelled event and a paid order is refunded in full
+// @Tags orders
+// @Accept json
+// @Produce json
+// @Param orderId path string true "Order ID"
+// @Param If-Match header string false "Order version the cancellation expects, as returned in ETag"
+// @Param request body CancelOrderInput true "Cancellation reason"
+// @Success 200 {object} map[string]interface{}
+// @Header 200 {string} ETag "New order version"
+// @Failure 400 {object} ErrorResponse
+// @Failure 401 {object} ErrorResponse
+// @Failure 403 {object} ErrorResponse
+// @Failure 404 {object} ErrorResponse
+// @Failure 409 {object} ErrorResponse
+// @Failure 412 {object} ErrorResponse
+// @Router /orders/{orderId}/cancel [post]
+func HandleCancelOrder(c *gin.Context) {
+	orderID := c.Param("orderId")
+
+	var input CancelOrderInput
+	if err := c.ShouldBindJSON(&input); err != nil {
+		c.JSON(http.StatusBadRequest, ErrorResponse{Error: "Invalid request. Reason is required."})
+		return
+	}
+
+	expectedVersion, err := ParseIfMatch(c.GetHeader("If-Match"))
+	if err != nil {
+		c.JSON(http.StatusBadRequest, ErrorResponse{Error: err.Error()})
+		return
+	}
+
+	userID, exists := c.Get("userId")
+	if !exists {
+		c.JSON(http.StatusUnauthorized, ErrorResponse{Error: "User ID not found in token"})
+		return
+	}
+
+	order, err := orderRepo.GetOrder(c.Request.Context(), orderID)
+	if err != nil {
+		c.JSON(http.StatusNotFound, ErrorResponse{Error: "Order not found"})
+		return
+	}
+
+	// Verify buyer owns this order
+	if order.BuyerID != userID.(string) {
+		c.JSON(http.StatusForbidden, ErrorResponse{Error: "You can only cancel your own orders"})
+		return
+	}
+
+	order, err = orderRepo.UpdateStatus(c.Request.Context(), orderID, StatusChange{
+		To:      StatusCancelled,
+		ActorID: userID.(string),
+		Role:    RoleBuyer,
+		Reason:  input.Reason,
+
+		ExpectedVersion: expectedVersion,
+	})
+	if err != nil {
+		c.JSON(transitionErrorStatus(err), ErrorResponse{Error: "Cannot cancel order: " + err.Error()})
+		return
+	}
+
+	c.Header("ETag", OrderETag(*order))
+	c.JSON(http.StatusOK, gin.H{
+		"message": "Order cancelled successfully",
+		"orderId": orderID,
+		"status":  order.Status,
+		"version": order.Version,
+	})
+}
@@ -0,0 +1,144 @@
+package main
+
+import (
+	"bytes"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestCanTransition(t *testing.T) {
+	tests := []struct {
+		name        string
+		from        string
+		to          string
+		role        string
+		expectedErr error
+	}{
+		{name: "pending_to_paid_by_system", from: StatusPending, to: StatusPaid, role: RoleSystem},
+		{name: "paid_to_shipped_by_seller", from: StatusPaid, to: StatusShipped, role: RoleSeller},
+		{name: "shipped_to_delivered_by_seller", from: StatusShipped, to: StatusDelivered, role: RoleSeller},
+		{name: "shipped_to_delivered_by_system", from: StatusShipped, to: StatusDelivered, role: RoleSystem},
+		{name: "paid_to_partially_shipped_by_seller", from: StatusPaid, to: StatusPartiallyShipped, role: RoleSeller},
+		{name: "partially_shipped_to_shipped_by_seller", from: StatusPartiallyShipped, to: StatusShipped, role: RoleSeller},
+		{name: "cancel_partially_shipped_order", from: StatusPartiallyShipped, to: StatusCancelled, role: RoleBuyer, expectedErr: ErrInvalidTransition},
+		{name: "deliver_partially_shipped_order", from: StatusPartiallyShipped, to: StatusDelivered, role: RoleSystem, expectedErr: ErrInvalidTransition},
+		{name: "pending_to_cancelled_by_seller", from: StatusPending, to: StatusCancelled, role: RoleSeller},
+		{name: "paid_to_cancelled_by_seller", from: StatusPaid, to: StatusCancelled, role: RoleSeller},
+		{name: "ship_unpaid_order", from: StatusPending, to: StatusShipped, role: RoleSeller, expectedErr: ErrInvalidTransition},
+		{name: "cancel_delivered_order", from: StatusDelivered, to: StatusCancelled, role: RoleSeller, expectedErr: ErrInvalidTransition},
+		{name: "cancel_shipped_order", from: StatusShipped, to: StatusCancelled, role: RoleSeller, expectedErr: ErrInvalidTransition},
+		{name: "deliver_paid_order", from: StatusPaid, to: StatusDelivered, role: RoleSeller, expectedErr: ErrInvalidTransition},
+		{name: "reopen_cancelled_order", from: StatusCancelled, to: StatusPending, role: RoleSystem, expectedErr: ErrInvalidTransition},
+		{name: "seller_cannot_mark_paid", from: StatusPending, to: StatusPaid, role: RoleSeller, expectedErr: ErrTransitionForbidden},
+		{name: "buyer_cannot_ship", from: StatusPaid, to: StatusShipped, role: RoleBuyer, expectedErr: ErrTransitionForbidden},
+		{name: "buyer_cancels_pending", from: StatusPending, to: StatusCancelled, role: RoleBuyer},
+		{name: "buyer_cancels_paid", from: StatusPaid, to: StatusCancelled, role: RoleBuyer},
+		{name: "buyer_cannot_cancel_shipped", from: StatusShipped, to: StatusCancelled, role: RoleBuyer, expectedErr: ErrInvalidTransition},
+		{name: "buyer_cannot_cancel_delivered", from: StatusDelivered, to: StatusCancelled, role: RoleBuyer, expectedErr: ErrInvalidTransition},
+		{name: "pending_to_expired_by_system", from: StatusPending, to: StatusExpired, role: RoleSystem},
+		{name: "buyer_cannot_expire", from: StatusPending, to: StatusExpired, role: RoleBuyer, expectedErr: ErrTransitionForbidden},
+		{name: "expire_paid_order", from: StatusPaid, to: StatusExpired, role: RoleSystem, expectedErr: ErrInvalidTransition},
+		{name: "pay_expired_order", from: StatusExpired, to: StatusPaid, role: RoleSystem, expectedErr: ErrInvalidTransition},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			err := CanTransition(tt.from, tt.to, tt.role)
+			if tt.expectedErr == nil {
+				assert.NoError(t, err)
+			} else {
+				assert.ErrorIs(t, err, tt.expectedErr)
+			}
+		})
+	}
+}
+
+func TestTransitionErrorStatus(t *testing.T) {
+	tests := []struct {
+		name     string
+		err      error
+		expected int
+	}{
+		{name: "forbidden", err: CanTransition(StatusPending, StatusPaid, RoleBuyer), expected: http.StatusForbidden},
+		{name: "invalid", err: CanTransition(StatusDelivered, StatusCancelled, RoleSeller), expected: http.StatusConflict},
+		{name: "stale", err: ErrStaleStatus, expected: http.StatusConflict},
+		{name: "version_conflict", err: checkExpectedVersion(OrderModel{Version: 2}, 1), expected: http.StatusPreconditionFailed},
+		{name: "other", err: errors.New("db down"), expected: http.StatusInternalServerError},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			assert.Equal(t, tt.expected, transitionErrorStatus(tt.err))
+		})
+	}
+}
+
+func TestParseIfMatch(t *testing.T) {
+	tests := []struct {
+		header   string
+		expected int64
+		valid    bool
+	}{
+		{header: "", expected: 0, valid: true},
+		{header: "*", expected: 0, valid: true},
+		{header: `"3"`, expected: 3, valid: true},
+		{header: ` W/"12" `, expected: 12, valid: true},
+		{header: "3"},
+		{header: `"0"`},
+		{header: `"abc"`},
+		{header: `"1", "2"`},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.header, func(t *testing.T) {
+			version, err := ParseIfMatch(tt.header)
+			if !tt.valid {
+				assert.Error(t, err)
+				return
+			}
+			require.NoError(t, err)
+			assert.Equal(t, tt.expected, version)
+		})
+	}
+
+	version, err := ParseIfMatch(OrderETag(OrderModel{Version: 7}))
+	require.NoError(t, err)
+	assert.Equal(t, int64(7), version, "an ETag is a valid If-Match")
+}
+
+func TestOrderStatusHistoryTableName(t *testing.T) {
+	entry := OrderStatusHistory{}
+	assert.Equal(t, "order_status_history", entry.TableName())
+}
+
+func TestCancelOrderInputValidation(t *testing.T) {
+	tests := []struct {
+		name           string
+		requestBody    string
+		expectedStatus int
+	}{
+		{name: "missing_reason", requestBody: `{}`, expectedStatus: http.StatusBadRequest},
+		{name: "empty_reason", requestBody: `{"reason": ""}`, expectedStatus: http.StatusBadRequest},
+		{name: "invalid_json", requestBody: `{invalid}`, expectedStatus: http.StatusBadRequest},
+		{name: "no_user_in_context", requestBody: `{"reason": "changed my mind"}`, expectedStatus: http.StatusUnauthorized},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			r := setupTestRouter()
+			r.POST("/orders/:orderId/cancel", HandleCancelOrder)
+
+			req, _ := http.NewRequest("POST", "/orders/order-1/cancel", bytes.NewBufferString(tt.requestBody))
+			req.Header.Set("Content-Type", "application/json")
+			w := httptest.NewRecorder()
+			r.ServeHTTP(w, req)
+
+			assert.Equal(t, tt.expectedStatus, w.Code)
+		})
+	}
+}
@@ -1,8 +1,11 @@
 // Package main provides the entry point for the order microservice.
-// This service handles order creation, payment simulation, and order management
-// for the CloudRetail e-commerce platform. It integrates with ProductService
-// (stock checks via GraphQL), fires EventBridge events, and uses RDS PostgreSQL
-// with GORM for persistence. JWT validation uses Cognito JWKS.
+// This service handles the buyer's cart, order creation, payments (through a
+// pluggable payment provider), and order management for the CloudRetail
+// e-commerce platform.
+// It integrates with ProductService (stock checks via GraphQL), publishes
+// EventBridge events through a transactional outbox, and uses RDS PostgreSQL
+// with GORM for persistence.
+// JWT validation uses Cognito JWKS.
 //
 // Suggested folder structure for scaling:
 //
@@ -10,7 +13,7 @@
 //	├── main.go
 //	├── handlers/
 //	│   ├── order.go         # Order CRUD handlers
-//	│   └── payment.go       # Payment simulation handlers
+//	│   └── payment.go       # Payment provider and webhook handlers
 //	├── middleware/
 //	│   └── jwt.go           # JWT auth middleware (Cognito JWKS)
 //	├── models/
@@ -28,18 +31,18 @@ import (
 	"database/sql/driver"
 	"encoding/base64"
 	"encoding/json"
+	"errors"
 	"fmt"
 	"log"
 	"math/big"
 	"net/http"
 	"os"
+	"strconv"
 	"strings"
 	"time"
 
-	"github.com/aws/aws-sdk-go-v2/aws"
 	awsconfig "github.com/aws/aws-sdk-go-v2/config"
 	"github.com/aws/aws-sdk-go-v2/service/eventbridge"
-	"github.com/aws/aws-sdk-go-v2/service/eventbridge/types"
 	"github.com/gin-gonic/gin"
 	"github.com/golang-jwt/jwt/v5"
 	"github.com/google/uuid"
@@ -64,16 +67,88 @@ var (
 	jwksCache         map[string]*rsa.PublicKey
 	jwksCacheTime     time.Time
 	jwksCacheTTL      = 1 * time.Hour
+	idempotencyKeyTTL = 24 * time.Hour
+
+	// Pending schema migrations are applied on startup unless disabled, e.g.
+	// when `order_service migrate up` runs as a separate deploy step
+	migrateOnStart = true
+
+	// Unpaid orders are expired after orderExpiryWindow; 0 disables expiry
+	orderExpiryWindow   = 15 * time.Minute
+	orderExpiryInterval = 1 * time.Minute
+
+	// Undelivered shipments are checked with their carrier every
+	// shipmentPollInterval; 0 disables polling. The fake carrier is only
+	// registered when fakeCarrierEnabled is set.
+	shipmentPollInterval = 10 * time.Minute
+	carrierTrackers      = map[string]CarrierTracker{}
+	fakeCarrierEnabled   bool
+
+	// Orders are priced with these shipping and tax rules
+	pricer = Pricer{Shipping: DefaultShippingRates, Tax: DefaultTaxRates}
+
+	// Order handlers read and write orders through orderRepo and look up and
+	// reserve products through productCatalog
+	orderRepo      OrderRepository
+	productCatalog ProductCatalog = graphQLProductCatalog{}
+
+	// Amounts sent or stored without a currency are in defaultCurrency
+	defaultCurrency = "LKR"
+
+	// Payments
+	paymentProvider       PaymentProvider
+	paymentProviderName   = "stripe"
+	stripeAPIURL          = "https://api.stripe.com"
+	stripeSecretKey       string
+	stripeWebhookSecret   string
+	stripeConfirmMethod   string
+	fakePaymentAddr       = ":8093"
+	fakePaymentWebhookURL = "http://localhost:8083/payments/webhook"
+
+	// Seller webhooks are posted by webhookDispatcher; a delivery is given up
+	// after webhookMaxAttempts and a webhook is disabled after
+	// webhookDisableAfter failed deliveries in a row
+	webhookDispatcher   *WebhookDispatcher
+	webhookMaxAttempts  = 12
+	webhookDisableAfter = 50
+
+	// Order status changes are fanned out to open SSE streams through
+	// orderEvents, fed by a Postgres LISTEN on every replica
+	orderEvents = NewOrderEventBroker()
 )
 
 // =============================================================================
 // Models
 // =============================================================================
 
-// OrderItem represents a single item in an order.
+// OrderItem represents a single item in an order. Name, Price and SellerID
+// are snapshotted from ProductService when the order is created so the order
+// can be reconstructed after the product is later edited. Discount is the
+// amount a coupon took off the line and is already deducted from LineTotal.
 type OrderItem struct {
-	ProductID string `json:"productId"`
-	Quantity  int    `json:"quantity"`
+	ProductID  string `json:"productId"`
+	Quantity   int    `json:"quantity"`
+	Name       string `json:"name,omitempty"`
+	Price      Money  `json:"price,omitzero"` // unit price at order time
+	SellerID   string `json:"sellerId,omitempty"`
+	Discount   Money  `json:"discount,omitzero"`
+	CouponCode string `json:"couponCode,omitempty"`
+	LineTotal  Money  `json:"lineTotal,omitzero"`
+}
+
+// Total returns what the buyer pays for the line, after discounts. A line
+// stored before line totals were snapshotted has no lineTotal, and neither
+// has a fully discounted line (its zero total is omitted from the JSON), so
+// either falls back to price x quantity less the line's discount.
+func (item OrderItem) Total() Money {
+	if item.LineTotal.Currency != "" {
+		return item.LineTotal
+	}
+	total, err := item.Price.Times(item.Quantity).Sub(item.Discount)
+	if err != nil {
+		return item.Price.Times(item.Quantity)
+	}
+	return total
 }
 
 // OrderItemsJSON is a JSONB column type for storing order items in PostgreSQL.
@@ -94,15 +169,25 @@ func (o *OrderItemsJSON) Scan(value interface{}) error {
 }
 
 // OrderModel represents the Orders table in PostgreSQL.
+// Each order belongs to exactly one seller; a multi-seller cart produces one
+// OrderModel per seller, grouped under a CheckoutModel. TotalPrice is the
+// grand total: Subtotal - Discount + Shipping + Tax.
 type OrderModel struct {
-	OrderID    string         `gorm:"primaryKey;type:uuid;column:order_id" json:"orderId"`
-	BuyerID    string         `gorm:"not null;column:buyer_id" json:"buyerId"`
-	SellerID   string         `gorm:"not null;column:seller_id" json:"sellerId"`
-	Items      OrderItemsJSON `gorm:"type:jsonb;not null;column:items" json:"items"`
-	Status     string         `gorm:"not null;default:pending;column:status" json:"status"` // pending, paid, shipped, delivered
-	TotalPrice float64        `gorm:"not null;column:total_price" json:"totalPrice"`
-	CreatedAt  time.Time      `gorm:"autoCreateTime;column:created_at" json:"createdAt"`
-	UpdatedAt  time.Time      `gorm:"autoUpdateTime;column:updated_at" json:"updatedAt"`
+	OrderID         string         `gorm:"primaryKey;type:uuid;column:order_id;index:idx_orders_buyer_created,priority:3;index:idx_orders_seller_created,priority:3" json:"orderId"`
+	CheckoutID      string         `gorm:"type:uuid;index;column:checkout_id" json:"checkoutId"`
+	BuyerID         string         `gorm:"not null;column:buyer_id;index:idx_orders_buyer_created,priority:1" json:"buyerId"`
+	SellerID        string         `gorm:"not null;column:seller_id;index:idx_orders_seller_created,priority:1" json:"sellerId"`
+	Items           OrderItemsJSON `gorm:"type:jsonb;not null;column:items" json:"items"`
+	Status          string         `gorm:"not null;default:pending;column:status;index:idx_orders_status_created,priority:1" json:"status"` // pending, paid, partially_shipped, shipped, delivered, cancelled, expired
+	Subtotal        Money          `gorm:"embedded;embeddedPrefix:subtotal_" json:"subtotal"`
+	Discount        Money          `gorm:"embedded;embeddedPrefix:discount_" json:"discount,omitzero"`
+	Shipping        Money          `gorm:"embedded;embeddedPrefix:shipping_" json:"shipping"`
+	Tax             Money          `gorm:"embedded;embeddedPrefix:tax_" json:"tax"`
+	TotalPrice      Money          `gorm:"embedded;embeddedPrefix:total_price_" json:"totalPrice"`
+	ShippingAddress *Address       `gorm:"type:jsonb;column:shipping_address" json:"shippingAddress,omitempty"`
+	CreatedAt       time.Time      `gorm:"autoCreateTime;column:created_at;index:idx_orders_buyer_created,priority:2;index:idx_orders_seller_created,priority:2;index:idx_orders_status_created,priority:2" json:"createdAt"`
+	UpdatedAt       time.Time      `gorm:"autoUpdateTime;column:updated_at" json:"updatedAt"`
+	Version         int64          `gorm:"not null;default:1;column:version" json:"version"` // incremented by every status change, see TransitionOrder
 }
 
 // TableName specifies the table name for GORM.
@@ -110,34 +195,64 @@ func (OrderModel) TableName() string {
 	return "orders"
 }
 
+// CheckoutModel represents the Checkouts table in PostgreSQL.
+// A checkout is the buyer-facing parent of one or more per-seller orders; its
+// price fields are the sums of theirs.
+type CheckoutModel struct {
+	CheckoutID string       `gorm:"primaryKey;type:uuid;column:checkout_id" json:"checkoutId"`
+	BuyerID    string       `gorm:"not null;index;column:buyer_id" json:"buyerId"`
+	Subtotal   Money        `gorm:"embedded;embeddedPrefix:subtotal_" json:"subtotal"`
+	CouponCode string       `gorm:"column:coupon_code" json:"couponCode,omitempty"`
+	Discount   Money        `gorm:"embedded;embeddedPrefix:discount_" json:"discount,omitzero"`
+	Shipping   Money        `gorm:"embedded;embeddedPrefix:shipping_" json:"shipping"`
+	Tax        Money        `gorm:"embedded;embeddedPrefix:tax_" json:"tax"`
+	TotalPrice Money        `gorm:"embedded;embeddedPrefix:total_price_" json:"totalPrice"`
+	Orders     []OrderModel `gorm:"foreignKey:CheckoutID;references:CheckoutID" json:"orders"`
+	CreatedAt  time.Time    `gorm:"autoCreateTime;column:created_at" json:"createdAt"`
+	UpdatedAt  time.Time    `gorm:"autoUpdateTime;column:updated_at" json:"updatedAt"`
+}
+
+// TableName specifies the table name for GORM.
+func (CheckoutModel) TableName() string {
+	return "checkouts"
+}
+
 // =============================================================================
 // Request/Response Structs
 // =============================================================================
 
 // CreateOrderInput represents the expected JSON body for creating an order.
+// The order ships to the saved address AddressID or the inline
+// ShippingAddress; with neither it ships to the buyer's default address, and
+// is refused if they have none.
 type CreateOrderInput struct {
-	Items []OrderItem `json:"items" binding:"required,min=1"`
+	Items           []OrderItem `json:"items" binding:"required,min=1"`
+	CouponCode      string      `json:"couponCode,omitempty"`
+	AddressID       string      `json:"addressId,omitempty"`
+	ShippingAddress *Address    `json:"shippingAddress,omitempty"`
 }
 
 // CreateOrderResponse represents the response after creating an order.
+// Payment is taken once per checkout, covering every per-seller order.
 type CreateOrderResponse struct {
-	OrderID    string `json:"orderId"`
-	PaymentURL string `json:"paymentUrl"`
-}
-
-// MarkPaymentDoneInput represents the expected JSON body for marking payment as done.
-type MarkPaymentDoneInput struct {
-	Paid bool `json:"paid" binding:"required"`
-}
-
-// MarkPaymentDoneResponse represents the response after marking payment.
-type MarkPaymentDoneResponse struct {
-	Redirect string `json:"redirect"`
+	CheckoutID string   `json:"checkoutId"`
+	OrderIDs   []string `json:"orderIds"`
+	Subtotal   Money    `json:"subtotal"`
+	Discount   Money    `json:"discount,omitzero"`
+	Shipping   Money    `json:"shipping"`
+	Tax        Money    `json:"tax"`
+	TotalPrice Money    `json:"totalPrice"`
+	PaymentURL string   `json:"paymentUrl"`
 }
 
 // UpdateStatusInput represents the expected JSON body for updating order status.
+// Marking an order shipped ships every unit left on it, optionally with a
+// carrier and tracking number; see CreateShipmentInput for partial shipments.
 type UpdateStatusInput struct {
-	Status string `json:"status" binding:"required"`
+	Status         string `json:"status" binding:"required"`
+	Reason         string `json:"reason"`
+	Carrier        string `json:"carrier,omitempty"`
+	TrackingNumber string `json:"trackingNumber,omitempty"`
 }
 
 // ErrorResponse represents a standard error response.
@@ -145,6 +260,13 @@ type ErrorResponse struct {
 	Error string `json:"error"`
 }
 
+// ProductsNotFoundResponse is returned when a cart references products that
+// do not exist.
+type ProductsNotFoundResponse struct {
+	Error      string   `json:"error"`
+	ProductIDs []string `json:"productIds"`
+}
+
 // =============================================================================
 // JWT Structures
 // =============================================================================
@@ -176,15 +298,21 @@ type JWKS struct {
 // GraphQL Query Structures
 // =============================================================================
 
-// ProductQuery represents the GraphQL query for getting product details.
-type ProductQuery struct {
-	GetProductById struct {
-		ProductID string  `graphql:"productId"`
-		Name      string  `graphql:"name"`
-		Price     float64 `graphql:"price"`
-		Stock     int     `graphql:"stock"`
-		SellerID  string  `graphql:"sellerId"`
-	} `graphql:"getProductById(id: $id)"`
+// ProductDetails holds the product fields needed to check stock and snapshot
+// a cart line. Price is ProductService's Money scalar; Money implements
+// json.Unmarshaler, so the client does not expand it into subfields.
+type ProductDetails struct {
+	ProductID string `graphql:"productId"`
+	Name      string `graphql:"name"`
+	Price     Money  `graphql:"price"`
+	Available int    `graphql:"available"`
+	SellerID  string `graphql:"sellerId"`
+}
+
+// ProductsQuery represents the batched GraphQL query for every product in a
+// cart. Results line up with the requested IDs and are null for unknown IDs.
+type ProductsQuery struct {
+	GetProductsByIds []*ProductDetails `graphql:"getProductsByIds(ids: $ids)"`
 }
 
 // =============================================================================
@@ -194,6 +322,20 @@ type ProductQuery struct {
 func init() {
 	_ = godotenv.Load()
 
+	// Older float amounts are converted in defaultCurrency when migrating
+	if v := os.Getenv("DEFAULT_CURRENCY"); v != "" {
+		currency, err := NormalizeCurrency(v)
+		if err != nil {
+			log.Fatalf("Invalid DEFAULT_CURRENCY: %v", err)
+		}
+		defaultCurrency = currency
+	}
+
+	// The migrate subcommand only needs RDS_DSN
+	if isMigrateCommand(os.Args) {
+		return
+	}
+
 	// AWS Configuration
 	awsRegion := os.Getenv("AWS_REGION")
 	if awsRegion == "" {
@@ -221,6 +363,87 @@ func init() {
 		productGraphQLURL = "http://product-service:8082/graphql"
 	}
 
+	if v := os.Getenv("MIGRATE_ON_START"); v != "" {
+		parsed, err := strconv.ParseBool(v)
+		if err != nil {
+			log.Fatalf("Invalid MIGRATE_ON_START: %q", v)
+		}
+		migrateOnStart = parsed
+	}
+
+	if ttl := os.Getenv("IDEMPOTENCY_KEY_TTL"); ttl != "" {
+		parsed, err := time.ParseDuration(ttl)
+		if err != nil {
+			log.Fatalf("Invalid IDEMPOTENCY_KEY_TTL: %v", err)
+		}
+		idempotencyKeyTTL = parsed
+	}
+
+	if v := os.Getenv("ORDER_EXPIRY_WINDOW"); v != "" {
+		parsed, err := time.ParseDuration(v)
+		if err != nil || parsed < 0 {
+			log.Fatalf("Invalid ORDER_EXPIRY_WINDOW: %q", v)
+		}
+		orderExpiryWindow = parsed
+	}
+	if v := os.Getenv("ORDER_EXPIRY_INTERVAL"); v != "" {
+		parsed, err := time.ParseDuration(v)
+		if err != nil || parsed <= 0 {
+			log.Fatalf("Invalid ORDER_EXPIRY_INTERVAL: %q", v)
+		}
+		orderExpiryInterval = parsed
+	}
+
+	if v := os.Getenv("SHIPMENT_POLL_INTERVAL"); v != "" {
+		parsed, err := time.ParseDuration(v)
+		if err != nil || parsed < 0 {
+			log.Fatalf("Invalid SHIPMENT_POLL_INTERVAL: %q", v)
+		}
+		shipmentPollInterval = parsed
+	}
+	fakeCarrierEnabled = os.Getenv("FAKE_CARRIER") == "true"
+
+	if v := os.Getenv("WEBHOOK_MAX_ATTEMPTS"); v != "" {
+		parsed, err := strconv.Atoi(v)
+		if err != nil || parsed < 1 {
+			log.Fatalf("Invalid WEBHOOK_MAX_ATTEMPTS: %q", v)
+		}
+		webhookMaxAttempts = parsed
+	}
+	if v := os.Getenv("WEBHOOK_DISABLE_AFTER"); v != "" {
+		parsed, err := strconv.Atoi(v)
+		if err != nil || parsed < 1 {
+			log.Fatalf("Invalid WEBHOOK_DISABLE_AFTER: %q", v)
+		}
+		webhookDisableAfter = parsed
+	}
+
+	// Payment Configuration
+	if v := os.Getenv("PAYMENT_PROVIDER"); v != "" {
+		paymentProviderName = v
+	}
+	if v := os.Getenv("STRIPE_API_URL"); v != "" {
+		stripeAPIURL = v
+	}
+	if v := os.Getenv("FAKE_PAYMENT_ADDR"); v != "" {
+		fakePaymentAddr = v
+	}
+	if v := os.Getenv("FAKE_PAYMENT_WEBHOOK_URL"); v != "" {
+		fakePaymentWebhookURL = v
+	}
+	stripeSecretKey = os.Getenv("STRIPE_SECRET_KEY")
+	stripeWebhookSecret = os.Getenv("STRIPE_WEBHOOK_SECRET")
+	stripeConfirmMethod = os.Getenv("STRIPE_CONFIRM_PAYMENT_METHOD")
+
+	if paymentProviderName == "fake" {
+		if stripeSecretKey == "" {
+			stripeSecretKey = "sk_test_fake"
+		}
+		if stripeConfirmMethod == "" {
+			stripeConfirmMethod = "pm_card_visa"
+		}
+	}
+
 	// Initialize AWS clients
 	cfg, err := awsconfig.LoadDefaultConfig(context.Background(), awsconfig.WithRegion(awsRegion))
 	if err != nil {
@@ -250,22 +473,97 @@ func main() {
 	if err != nil {
 		log.Fatalf("Failed to connect to database: %v", err)
 	}
+	orderRepo = NewPostgresOrderRepository(db)
 
-	// Auto-migrate the schema
-	if err := db.AutoMigrate(&OrderModel{}); err != nil {
-		log.Fatalf("Failed to migrate database: %v", err)
+	// order_service migrate up|down|status
+	if isMigrateCommand(os.Args) {
+		if err := RunMigrateCommand(context.Background(), db, os.Args[2:], os.Stdout); err != nil {
+			log.Fatalf("Migration failed: %v", err)
+		}
+		return
+	}
+
+	// Apply pending schema migrations; replicas wait on the migration lock
+	if migrateOnStart {
+		migrator, err := NewMigrator(db)
+		if err != nil {
+			log.Fatalf("Failed to load migrations: %v", err)
+		}
+		if _, err := migrator.Up(context.Background(), 0); err != nil {
+			log.Fatalf("Failed to migrate database: %v", err)
+		}
 	}
 
 	log.Println("✅ Database connected and migrated")
 
-	// Set up Gin router
-	r := gin.Default()
+	// Fan order status changes out to SSE streams in background
+	go NewOrderStatusListener(dsn, orderEvents).Run(context.Background())
+
+	// Start outbox relay in background
+	relay := NewOutboxRelay(db, &EventBridgePublisher{
+		Client: eventBridgeClient,
+		BusArn: eventBusArn,
+		Source: "order-service",
+	})
+	go relay.Run(context.Background())
+
+	// Expire unpaid orders in background
+	if orderExpiryWindow > 0 {
+		go NewOrderExpirer(orderRepo, orderExpiryWindow, orderExpiryInterval).Run(context.Background())
+	}
+
+	// Track shipments with their carriers in background
+	if fakeCarrierEnabled {
+		carrierTrackers[FakeCarrierCode] = NewFakeCarrier()
+	}
+	if shipmentPollInterval > 0 {
+		go NewShipmentPoller(db, carrierTrackers, shipmentPollInterval).Run(context.Background())
+	}
+
+	// Deliver seller webhooks in background
+	webhookDispatcher = NewWebhookDispatcher(db)
+	webhookDispatcher.MaxAttempts = webhookMaxAttempts
+	webhookDispatcher.DisableAfter = webhookDisableAfter
+	go webhookDispatcher.Run(context.Background())
+
+	// Purge expired idempotency keys in background
+	go purgeExpiredIdempotencyKeys(context.Background(), 1*time.Hour)
+
+	if err := checkPaymentConfig(paymentProviderName, stripeSecretKey, stripeWebhookSecret); err != nil {
+		log.Fatal(err)
+	}
+
+	// Start the local fake payment provider when configured
+	apiURL := stripeAPIURL
+	if paymentProviderName == "fake" {
+		fake := NewFakePaymentServer(stripeSecretKey, stripeWebhookSecret, fakePaymentWebhookURL)
+		go func() {
+			log.Printf("💳 Fake payment provider listening on %s", fakePaymentAddr)
+			if err := http.ListenAndServe(fakePaymentAddr, fake); err != nil {
+				log.Fatalf("Fake payment provider failed: %v", err)
+			}
+		}()
+		apiURL = "http://localhost" + fakePaymentAddr
+	}
+
+	stripe := NewStripeProvider(apiURL, stripeSecretKey, stripeWebhookSecret)
+	stripe.ConfirmPaymentMethod = stripeConfirmMethod
+	paymentProvider = stripe
+	log.Printf("✅ Payment provider initialized: %s (%s)", paymentProviderName, apiURL)
+
+	// Pay out refunds of cancelled paid orders in background
+	go NewRefundWorker(orderRepo, paymentProvider).Run(context.Background())
+
+	// Set up Gin router. Stream tokens are taken out of the URL before the
+	// access log line is written
+	r := gin.New()
+	r.Use(streamTokenFromQuery("/orders/stream", "/seller/orders/stream"), gin.Logger(), gin.Recovery())
 
 	// CORS middleware
 	r.Use(func(c *gin.Context) {
 		c.Writer.Header().Set("Access-Control-Allow-Origin", "*")
 		c.Writer.Header().Set("Access-Control-Allow-Methods", "GET, POST, PUT, DELETE, OPTIONS")
-		c.Writer.Header().Set("Access-Control-Allow-Headers", "Content-Type, Authorization")
+		c.Writer.Header().Set("Access-Control-Allow-Headers", "Content-Type, Authorization, Idempotency-Key")
 		if c.Request.Method == "OPTIONS" {
 			c.AbortWithStatus(http.StatusOK)
 			return
@@ -276,10 +574,17 @@ func main() {
 	// Health check endpoint
 	r.GET("/health", HandleHealth)
 
-	// Public payment simulation endpoints (no JWT required for simplicity)
-	r.GET("/simulatePayment/:orderId", HandleSimulatePayment)
-	r.POST("/markPaymentDone/:orderId", HandleMarkPaymentDone)
-	r.GET("/orderConfirmed/:orderId", HandleOrderConfirmed)
+	// Public endpoint: the signed payment webhook
+	r.POST("/payments/webhook", HandlePaymentWebhook)
+
+	// Order status streams (require JWT, which EventSource clients can pass
+	// as ?access_token=)
+	streams := r.Group("/")
+	streams.Use(JWTMiddleware())
+	{
+		streams.GET("/orders/stream", HandleStreamBuyerOrders)
+		streams.GET("/seller/orders/stream", HandleStreamSellerOrders)
+	}
 
 	// Protected endpoints (require JWT)
 	protected := r.Group("/")
@@ -287,7 +592,47 @@ func main() {
 	{
 		protected.POST("/createOrder", HandleCreateOrder)
 		protected.GET("/getOrders", HandleGetOrders)
+		protected.GET("/orderConfirmed/:orderId", HandleOrderConfirmed)
+		protected.GET("/seller/orders/export", HandleExportOrders)
 		protected.PUT("/updateStatus/:orderId", HandleUpdateStatus)
+		protected.GET("/checkouts", HandleGetCheckouts)
+		protected.GET("/checkouts/:checkoutId", HandleGetCheckout)
+		protected.GET("/orders/:orderId/history", HandleGetOrderHistory)
+		protected.POST("/orders/:orderId/cancel", HandleCancelOrder)
+		protected.GET("/orders/:orderId/shipments", HandleGetShipments)
+		protected.POST("/orders/:orderId/shipments", HandleCreateShipment)
+		protected.POST("/orders/:orderId/returns", HandleCreateReturn)
+		protected.GET("/returns", HandleGetReturns)
+		protected.GET("/returns/:returnId", HandleGetReturn)
+		protected.POST("/returns/:returnId/approve", HandleApproveReturn)
+		protected.POST("/returns/:returnId/reject", HandleRejectReturn)
+		protected.POST("/returns/:returnId/cancel", HandleCancelReturn)
+		protected.POST("/returns/:returnId/receive", HandleReceiveReturn)
+		protected.POST("/returns/:returnId/refund", HandleRefundReturn)
+		protected.GET("/webhooks", HandleGetWebhooks)
+		protected.POST("/webhooks", HandleCreateWebhook)
+		protected.PUT("/webhooks/:webhookId", HandleUpdateWebhook)
+		protected.DELETE("/webhooks/:webhookId", HandleDeleteWebhook)
+		protected.GET("/webhooks/:webhookId/deliveries", HandleGetWebhookDeliveries)
+		protected.POST("/webhooks/:webhookId/deliveries/:deliveryId/redeliver", HandleRedeliverWebhook)
+		protected.GET("/analytics/sales", HandleGetSalesAnalytics)
+		protected.GET("/analytics/top-products", HandleGetTopProducts)
+		protected.GET("/payments/:id", HandleGetPayment)
+		protected.POST("/payments/:id/intent", HandleCreatePaymentIntent)
+		protected.POST("/payments/:id/confirm", HandleConfirmPayment)
+		protected.GET("/cart", HandleGetCart)
+		protected.POST("/cart/items", HandleAddCartItem)
+		protected.PUT("/cart/items/:productId", HandleUpdateCartItem)
+		protected.DELETE("/cart/items/:productId", HandleRemoveCartItem)
+		protected.POST("/cart/checkout", HandleCartCheckout)
+		protected.GET("/coupons", HandleGetCoupons)
+		protected.POST("/coupons", HandleCreateCoupon)
+		protected.DELETE("/coupons/:code", HandleDeactivateCoupon)
+		protected.GET("/addresses", HandleGetAddresses)
+		protected.POST("/addresses", HandleCreateAddress)
+		protected.PUT("/addresses/:addressId", HandleUpdateAddress)
+		protected.DELETE("/addresses/:addressId", HandleDeleteAddress)
+		protected.POST("/addresses/:addressId/default", HandleSetDefaultAddress)
 	}
 
 	port := os.Getenv("PORT")
@@ -459,14 +804,17 @@ func HandleHealth(c *gin.Context) {
 
 // HandleCreateOrder godoc
 // @Summary Create a new order
-// @Description Creates a new order, checks stock via ProductService GraphQL, fires EventBridge event
+// @Description Creates a new order, checks stock via ProductService GraphQL, queues an EventBridge event in the outbox
 // @Tags orders
 // @Accept json
 // @Produce json
 // @Param request body CreateOrderInput true "Order items"
+// @Param Idempotency-Key header string false "Key that makes retries return the original response"
 // @Success 201 {object} CreateOrderResponse
 // @Failure 400 {object} ErrorResponse
 // @Failure 401 {object} ErrorResponse
+// @Failure 404 {object} ErrorResponse
+// @Failure 422 {object} ErrorResponse
 // @Failure 500 {object} ErrorResponse
 // @Router /createOrder [post]
 func HandleCreateOrder(c *gin.Context) {
@@ -483,192 +831,457 @@ func HandleCreateOrder(c *gin.Context) {
 		return
 	}
 
-	// Validate items and check stock via GraphQL
-	var totalPrice float64
-	var sellerID string
-	productDetails := make(map[string]struct {
-		Price    float64
-		SellerID string
+	// Replay the original response if this Idempotency-Key was already used
+	idempotencyKey, requestHash, done := CheckIdempotencyKey(c, buyerID.(string), input)
+	if done {
+		return
+	}
+
+	PlaceOrder(c, OrderRequest{
+		BuyerID:         buyerID.(string),
+		Items:           input.Items,
+		CouponCode:      input.CouponCode,
+		AddressID:       input.AddressID,
+		ShippingAddress: input.ShippingAddress,
+		IdempotencyKey:  idempotencyKey,
+		RequestHash:     requestHash,
 	})
+}
 
-	for _, item := range input.Items {
-		// Query ProductService for product details
-		var query ProductQuery
-		variables := map[string]interface{}{
-			"id": graphql.ID(item.ProductID),
-		}
+// OrderRequest describes an order to place for a buyer.
+type OrderRequest struct {
+	BuyerID         string
+	Items           []OrderItem
+	CouponCode      string
+	AddressID       string
+	ShippingAddress *Address
+
+	// IdempotencyKey and RequestHash come from CheckIdempotencyKey; the
+	// response is stored under the key when one is given
+	IdempotencyKey string
+	RequestHash    string
+
+	// ClearCart lists the cart lines removed in the same transaction once the
+	// orders are written
+	ClearCart []string
+}
 
-		err := graphqlClient.Query(context.Background(), &query, variables)
-		if err != nil {
-			c.JSON(http.StatusBadRequest, ErrorResponse{Error: fmt.Sprintf("Product %s not found: %v", item.ProductID, err)})
-			return
+// PlaceOrder checks the items against ProductService, applies the coupon,
+// prices shipping and tax, reserves the stock and writes a checkout with one
+// pending order per seller, then responds with 201 and a CreateOrderResponse.
+func PlaceOrder(c *gin.Context, req OrderRequest) {
+	buyerID, items := req.BuyerID, req.Items
+	idempotencyKey, requestHash := req.IdempotencyKey, req.RequestHash
+
+	// Snapshot the shipping address onto the orders
+	shippingAddress, err := ResolveShippingAddress(c.Request.Context(), orderRepo, buyerID, req.AddressID, req.ShippingAddress)
+	if err != nil {
+		switch {
+		case errors.Is(err, ErrAddressNotFound):
+			c.JSON(http.StatusNotFound, ErrorResponse{Error: "Shipping address not found"})
+		case errors.Is(err, ErrInvalidAddress):
+			c.JSON(http.StatusBadRequest, ErrorResponse{Error: "Cannot ship order: " + err.Error()})
+		default:
+			c.JSON(http.StatusInternalServerError, ErrorResponse{Error: "Failed to fetch shipping address"})
 		}
+		return
+	}
+	if shippingAddress == nil {
+		c.JSON(http.StatusBadRequest, ErrorResponse{Error: "A shipping address is required: give addressId or shippingAddress, or save a default address"})
+		return
+	}
+
+	// Fetch every product in the cart from ProductService in one call
+	productIDs := make([]string, 0, len(items))
+	for _, item := range items {
+		productIDs = append(productIDs, item.ProductID)
+	}
+
+	products, missing, err := productCatalog.FetchProducts(c.Request.Context(), productIDs)
+	if err != nil {
+		c.JSON(http.StatusBadGateway, ErrorResponse{Error: fmt.Sprintf("Failed to look up products: %v", err)})
+		return
+	}
+	if len(missing) > 0 {
+		c.JSON(http.StatusBadRequest, ProductsNotFoundResponse{
+			Error:      fmt.Sprintf("Products not found: %s", strings.Join(missing, ", ")),
+			ProductIDs: missing,
+		})
+		return
+	}
 
-		product := query.GetProductById
+	// Validate items and check stock
+	lines := make([]OrderItem, 0, len(items))
+	currency := ""
 
-		// Check stock availability
-		if product.Stock < item.Quantity {
+	for _, item := range items {
+		product := products[item.ProductID]
+
+		// Check stock availability (the reservation below is authoritative)
+		if product.Available < item.Quantity {
 			c.JSON(http.StatusBadRequest, ErrorResponse{
 				Error: fmt.Sprintf("Insufficient stock for product %s. Available: %d, Requested: %d",
-					item.ProductID, product.Stock, item.Quantity),
+					item.ProductID, product.Available, item.Quantity),
 			})
 			return
 		}
 
-		// Calculate total price
-		totalPrice += product.Price * float64(item.Quantity)
+		// A checkout is paid in one currency
+		if currency == "" {
+			currency = product.Price.Currency
+		} else if product.Price.Currency != currency {
+			c.JSON(http.StatusUnprocessableEntity, ErrorResponse{
+				Error: fmt.Sprintf("Cannot check out products priced in %s and %s together", currency, product.Price.Currency),
+			})
+			return
+		}
 
-		// Store product details
-		productDetails[item.ProductID] = struct {
-			Price    float64
-			SellerID string
-		}{
-			Price:    product.Price,
-			SellerID: product.SellerID,
+		// Snapshot product details into the line and calculate its total
+		lines = append(lines, SnapshotOrderItem(item, product.Name, product.Price, product.SellerID))
+	}
+
+	// Apply the coupon to the snapshotted lines. Its usage limits are checked
+	// again, under a row lock, when the checkout is written.
+	couponCode := NormalizeCouponCode(req.CouponCode)
+	if couponCode != "" {
+		coupon, err := orderRepo.GetCoupon(c.Request.Context(), couponCode)
+		if err == nil {
+			err = coupon.CheckActive(time.Now().UTC())
+		}
+		if err == nil {
+			_, err = ApplyCoupon(coupon, lines)
+		}
+		if err != nil {
+			c.JSON(couponErrorStatus(err), ErrorResponse{Error: fmt.Sprintf("Cannot apply coupon %s: %v", couponCode, err)})
+			return
 		}
+	}
 
-		// Use first product's seller as order seller (simplified)
-		if sellerID == "" {
-			sellerID = product.SellerID
+	// Price shipping and tax for each seller's order, since each ships
+	// separately
+	groups := GroupItemsBySeller(lines)
+	prices := make([]PriceBreakdown, len(groups))
+	var total PriceBreakdown
+	for i, group := range groups {
+		price, err := pricer.PriceOrder(*shippingAddress, group.Items)
+		if err != nil {
+			if errors.Is(err, ErrUnsupportedDestination) {
+				c.JSON(http.StatusUnprocessableEntity, ErrorResponse{Error: fmt.Sprintf("Cannot ship order: %v", err)})
+				return
+			}
+			c.JSON(http.StatusInternalServerError, ErrorResponse{Error: fmt.Sprintf("Failed to price order: %v", err)})
+			return
+		}
+		prices[i] = price
+		if err := total.Add(price); err != nil {
+			c.JSON(http.StatusInternalServerError, ErrorResponse{Error: fmt.Sprintf("Failed to price order: %v", err)})
+			return
 		}
 	}
 
-	// Create order in database (with transaction)
-	orderID := uuid.New().String()
+	// Split the cart into one order per seller under a single checkout
+	checkoutID := uuid.New().String()
+	checkout := CheckoutModel{
+		CheckoutID: checkoutID,
+		BuyerID:    buyerID,
+		Subtotal:   total.Subtotal,
+		CouponCode: couponCode,
+		Discount:   total.Discount,
+		Shipping:   total.Shipping,
+		Tax:        total.Tax,
+		TotalPrice: total.Total,
+	}
 
-	order := OrderModel{
-		OrderID:    orderID,
-		BuyerID:    buyerID.(string),
-		SellerID:   sellerID,
-		Items:      input.Items,
-		Status:     "pending",
-		TotalPrice: totalPrice,
+	orders := make([]OrderModel, 0, len(groups))
+	orderIDs := make([]string, 0, len(groups))
+	for i, group := range groups {
+		orderID := uuid.New().String()
+		orders = append(orders, OrderModel{
+			OrderID:         orderID,
+			CheckoutID:      checkoutID,
+			BuyerID:         buyerID,
+			SellerID:        group.SellerID,
+			Items:           group.Items,
+			Status:          StatusPending,
+			Subtotal:        prices[i].Subtotal,
+			Discount:        prices[i].Discount,
+			Shipping:        prices[i].Shipping,
+			Tax:             prices[i].Tax,
+			TotalPrice:      prices[i].Total,
+			ShippingAddress: shippingAddress,
+		})
+		orderIDs = append(orderIDs, orderID)
 	}
 
-	err := db.Transaction(func(tx *gorm.DB) error {
-		if err := tx.Create(&order).Error; err != nil {
-			return fmt.Errorf("failed to create order: %w", err)
-		}
+	response := CreateOrderResponse{
+		CheckoutID: checkoutID,
+		OrderIDs:   orderIDs,
+		Subtotal:   total.Subtotal,
+		Discount:   total.Discount,
+		Shipping:   total.Shipping,
+		Tax:        total.Tax,
+		TotalPrice: total.Total,
+		PaymentURL: fmt.Sprintf("/payment/%s", checkoutID),
+	}
 
-		// Fire EventBridge event
-		if err := FireOrderPlacedEvent(orderID, input.Items); err != nil {
-			return fmt.Errorf("failed to fire EventBridge event: %w", err)
+	// Redeem the coupon, clear the cart and store the response under the
+	// Idempotency-Key in the same transaction as the orders
+	effects := CheckoutEffects{CouponCode: couponCode, ClearCart: req.ClearCart}
+	if idempotencyKey != "" {
+		effects.Idempotency, err = NewIdempotencyRecord(buyerID, idempotencyKey, requestHash, http.StatusCreated, response, time.Now().UTC())
+		if err != nil {
+			c.JSON(http.StatusInternalServerError, ErrorResponse{Error: err.Error()})
+			return
 		}
+	}
 
-		return nil
-	})
+	// Hold the stock until the checkout is paid. ProductService refuses the
+	// reservation if a concurrent checkout took the last units first.
+	authorization := c.GetHeader("Authorization")
+	if err := productCatalog.ReserveStock(c.Request.Context(), authorization, checkoutID, items); err != nil {
+		if IsInsufficientStock(err) {
+			c.JSON(http.StatusConflict, ErrorResponse{Error: fmt.Sprintf("Failed to reserve stock: %v", err)})
+			return
+		}
+		c.JSON(http.StatusBadGateway, ErrorResponse{Error: fmt.Sprintf("Failed to reserve stock: %v", err)})
+		return
+	}
 
+	// Create the checkout and its child orders
+	err = orderRepo.CreateCheckout(c.Request.Context(), &checkout, orders, buyerID, effects)
 	if err != nil {
+		// Nothing was written, so the held stock is handed back straight away
+		// rather than waiting for the reservation to expire
+		if releaseErr := productCatalog.ReleaseReservation(context.Background(), authorization, checkoutID); releaseErr != nil {
+			log.Printf("Warning: %v", releaseErr)
+		}
+
+		// A concurrent request with the same key may have committed first
+		if idempotencyKey != "" {
+			if record, lookupErr := orderRepo.LookupIdempotencyKey(c.Request.Context(), buyerID, idempotencyKey); lookupErr == nil && record != nil {
+				ReplayIdempotentResponse(c, record, requestHash)
+				return
+			}
+		}
+
+		// The coupon ran out or ended while the order was being placed
+		if status := couponErrorStatus(err); status != http.StatusInternalServerError {
+			c.JSON(status, ErrorResponse{Error: fmt.Sprintf("Cannot apply coupon %s: %v", couponCode, err)})
+			return
+		}
+
 		log.Printf("Transaction failed: %v", err)
 		c.JSON(http.StatusInternalServerError, ErrorResponse{Error: "Failed to create order: " + err.Error()})
 		return
 	}
 
-	c.JSON(http.StatusCreated, CreateOrderResponse{
-		OrderID:    orderID,
-		PaymentURL: fmt.Sprintf("/simulatePayment/%s", orderID),
-	})
+	c.JSON(http.StatusCreated, response)
 }
 
-// HandleSimulatePayment godoc
-// @Summary Simulate payment page
-// @Description Returns a message for payment simulation (frontend shows checkbox)
-// @Tags payment
-// @Produce json
-// @Param orderId path string true "Order ID"
-// @Success 200 {object} map[string]string
-// @Failure 404 {object} ErrorResponse
-// @Router /simulatePayment/{orderId} [get]
-func HandleSimulatePayment(c *gin.Context) {
-	orderID := c.Param("orderId")
+// FetchProducts loads the given products from ProductService with a single
+// getProductsByIds query. It returns the products by ID and the IDs that do
+// not exist, in request order without duplicates.
+func FetchProducts(ctx context.Context, ids []string) (map[string]ProductDetails, []string, error) {
+	gqlIDs := make([]graphql.ID, len(ids))
+	for i, id := range ids {
+		gqlIDs[i] = graphql.ID(id)
+	}
 
-	// Verify order exists
-	var order OrderModel
-	if err := db.First(&order, "order_id = ?", orderID).Error; err != nil {
-		c.JSON(http.StatusNotFound, ErrorResponse{Error: "Order not found"})
-		return
+	var query ProductsQuery
+	if err := graphqlClient.Query(ctx, &query, map[string]interface{}{"ids": gqlIDs}); err != nil {
+		return nil, nil, err
 	}
 
-	c.JSON(http.StatusOK, gin.H{
-		"message":    "Check box to mark paid",
-		"orderId":    orderID,
-		"totalPrice": order.TotalPrice,
-		"status":     order.Status,
-	})
+	if len(query.GetProductsByIds) != len(ids) {
+		return nil, nil, fmt.Errorf("expected %d products, got %d", len(ids), len(query.GetProductsByIds))
+	}
+
+	products, missing := MatchProducts(ids, query.GetProductsByIds)
+	return products, missing, nil
 }
 
-// HandleMarkPaymentDone godoc
-// @Summary Mark payment as done
-// @Description Marks the order as paid if checkbox is checked
-// @Tags payment
-// @Accept json
-// @Produce json
-// @Param orderId path string true "Order ID"
-// @Param request body MarkPaymentDoneInput true "Payment status"
-// @Success 200 {object} MarkPaymentDoneResponse
-// @Failure 400 {object} ErrorResponse
-// @Failure 404 {object} ErrorResponse
-// @Router /markPaymentDone/{orderId} [post]
-func HandleMarkPaymentDone(c *gin.Context) {
-	orderID := c.Param("orderId")
+// MatchProducts pairs the requested IDs with the positional results of
+// getProductsByIds.
+func MatchProducts(ids []string, results []*ProductDetails) (map[string]ProductDetails, []string) {
+	products := make(map[string]ProductDetails, len(ids))
+	var missing []string
+	seenMissing := make(map[string]bool)
 
-	var input MarkPaymentDoneInput
-	if err := c.ShouldBindJSON(&input); err != nil {
-		c.JSON(http.StatusBadRequest, ErrorResponse{Error: "Invalid request. 'paid' field is required."})
-		return
+	for i, id := range ids {
+		if i < len(results) && results[i] != nil {
+			products[id] = *results[i]
+			continue
+		}
+		if !seenMissing[id] {
+			seenMissing[id] = true
+			missing = append(missing, id)
+		}
 	}
 
-	if !input.Paid {
-		c.JSON(http.StatusBadRequest, ErrorResponse{Error: "Payment not confirmed"})
-		return
-	}
+	return products, missing
+}
 
-	// Update order status to "paid"
-	result := db.Model(&OrderModel{}).Where("order_id = ?", orderID).Update("status", "paid")
-	if result.Error != nil {
-		c.JSON(http.StatusInternalServerError, ErrorResponse{Error: "Failed to update order status"})
-		return
+// SellerItems holds the cart lines that belong to a single seller.
+type SellerItems struct {
+	SellerID string
+	Items    OrderItemsJSON
+}
+
+// SnapshotOrderItem copies the product's current name, unit price and seller
+// onto a cart line and computes its line total. Values sent by the client for
+// these fields are ignored.
+func SnapshotOrderItem(item OrderItem, name string, price Money, sellerID string) OrderItem {
+	return OrderItem{
+		ProductID: item.ProductID,
+		Quantity:  item.Quantity,
+		Name:      name,
+		Price:     price,
+		SellerID:  sellerID,
+		LineTotal: price.Times(item.Quantity),
 	}
+}
 
-	if result.RowsAffected == 0 {
-		c.JSON(http.StatusNotFound, ErrorResponse{Error: "Order not found"})
-		return
+// GroupItemsBySeller splits snapshotted cart lines by their seller.
+// Groups are returned in the order each seller first appears in the cart.
+func GroupItemsBySeller(items []OrderItem) []SellerItems {
+	var groups []SellerItems
+	index := make(map[string]int)
+
+	for _, item := range items {
+		sellerID := item.SellerID
+		i, ok := index[sellerID]
+		if !ok {
+			i = len(groups)
+			index[sellerID] = i
+			groups = append(groups, SellerItems{SellerID: sellerID})
+		}
+		groups[i].Items = append(groups[i].Items, item)
 	}
 
-	c.JSON(http.StatusOK, MarkPaymentDoneResponse{
-		Redirect: fmt.Sprintf("/orderConfirmed/%s", orderID),
-	})
+	return groups
 }
 
 // HandleOrderConfirmed godoc
 // @Summary Get confirmed order details
-// @Description Returns the confirmed order details
+// @Description Returns the confirmed order details, or the grouped checkout when given a checkout ID. A checkout is only shown to its buyer, an order to its buyer or seller. A single order comes with its version in the ETag header.
 // @Tags orders
 // @Produce json
-// @Param orderId path string true "Order ID"
+// @Param orderId path string true "Checkout ID or Order ID"
 // @Success 200 {object} OrderModel
+// @Header 200 {string} ETag "Order version, for If-Match on status updates"
+// @Success 200 {object} CheckoutModel
+// @Failure 401 {object} ErrorResponse
+// @Failure 403 {object} ErrorResponse
 // @Failure 404 {object} ErrorResponse
 // @Router /orderConfirmed/{orderId} [get]
 func HandleOrderConfirmed(c *gin.Context) {
 	orderID := c.Param("orderId")
 
-	var order OrderModel
-	if err := db.First(&order, "order_id = ?", orderID).Error; err != nil {
+	userID, exists := c.Get("userId")
+	if !exists {
+		c.JSON(http.StatusUnauthorized, ErrorResponse{Error: "User ID not found in token"})
+		return
+	}
+
+	if checkout, err := orderRepo.GetCheckout(c.Request.Context(), orderID); err == nil {
+		if checkout.BuyerID != userID.(string) {
+			c.JSON(http.StatusForbidden, ErrorResponse{Error: "You can only view your own orders"})
+			return
+		}
+		c.JSON(http.StatusOK, checkout)
+		return
+	}
+
+	order, err := orderRepo.GetOrder(c.Request.Context(), orderID)
+	if err != nil {
 		c.JSON(http.StatusNotFound, ErrorResponse{Error: "Order not found"})
 		return
 	}
 
+	if order.BuyerID != userID.(string) && order.SellerID != userID.(string) {
+		c.JSON(http.StatusForbidden, ErrorResponse{Error: "You can only view your own orders"})
+		return
+	}
+
+	c.Header("ETag", OrderETag(*order))
 	c.JSON(http.StatusOK, order)
 }
 
+// HandleGetCheckouts godoc
+// @Summary Get buyer checkouts
+// @Description Returns the buyer's checkouts, each with its per-seller orders grouped underneath
+// @Tags orders
+// @Produce json
+// @Success 200 {object} []CheckoutModel
+// @Failure 401 {object} ErrorResponse
+// @Failure 500 {object} ErrorResponse
+// @Router /checkouts [get]
+func HandleGetCheckouts(c *gin.Context) {
+	userID, exists := c.Get("userId")
+	if !exists {
+		c.JSON(http.StatusUnauthorized, ErrorResponse{Error: "User ID not found in token"})
+		return
+	}
+
+	checkouts, err := orderRepo.ListCheckouts(c.Request.Context(), userID.(string))
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, ErrorResponse{Error: "Failed to fetch checkouts"})
+		return
+	}
+
+	c.JSON(http.StatusOK, checkouts)
+}
+
+// HandleGetCheckout godoc
+// @Summary Get a checkout
+// @Description Returns a buyer's checkout with its per-seller orders grouped underneath
+// @Tags orders
+// @Produce json
+// @Param checkoutId path string true "Checkout ID"
+// @Success 200 {object} CheckoutModel
+// @Failure 401 {object} ErrorResponse
+// @Failure 403 {object} ErrorResponse
+// @Failure 404 {object} ErrorResponse
+// @Router /checkouts/{checkoutId} [get]
+func HandleGetCheckout(c *gin.Context) {
+	checkoutID := c.Param("checkoutId")
+
+	userID, exists := c.Get("userId")
+	if !exists {
+		c.JSON(http.StatusUnauthorized, ErrorResponse{Error: "User ID not found in token"})
+		return
+	}
+
+	checkout, err := orderRepo.GetCheckout(c.Request.Context(), checkoutID)
+	if err != nil {
+		c.JSON(http.StatusNotFound, ErrorResponse{Error: "Checkout not found"})
+		return
+	}
+
+	if checkout.BuyerID != userID.(string) {
+		c.JSON(http.StatusForbidden, ErrorResponse{Error: "You can only view your own checkouts"})
+		return
+	}
+
+	c.JSON(http.StatusOK, checkout)
+}
+
 // HandleGetOrders godoc
 // @Summary Get orders
-// @Description Returns orders filtered by buyer or seller ID from JWT claims
+// @Description Returns a page of orders filtered by buyer or seller ID from JWT claims
 // @Tags orders
 // @Produce json
 // @Param sellerId query string false "Seller ID (for seller role)"
-// @Success 200 {object} []OrderModel
+// @Param limit query int false "Page size (default 20, max 100)"
+// @Param cursor query string false "Cursor from a previous page's nextCursor"
+// @Param status query string false "Comma-separated statuses to include"
+// @Param from query string false "Created at or after (RFC3339 or YYYY-MM-DD)"
+// @Param to query string false "Created before (RFC3339, or YYYY-MM-DD inclusive)"
+// @Param sort query string false "asc or desc by creation time (default desc)"
+// @Success 200 {object} OrderPage
+// @Failure 400 {object} ErrorResponse
 // @Failure 401 {object} ErrorResponse
+// @Failure 403 {object} ErrorResponse
 // @Failure 500 {object} ErrorResponse
 // @Router /getOrders [get]
 func HandleGetOrders(c *gin.Context) {
@@ -680,52 +1293,54 @@ func HandleGetOrders(c *gin.Context) {
 
 	customRole, _ := c.Get("customRole")
 
-	var orders []OrderModel
+	params, err := ParseOrderListParams(c)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, ErrorResponse{Error: "Invalid query: " + err.Error()})
+		return
+	}
+
+	var filter OrderFilter
 
 	// If seller, filter by sellerId
 	if customRole == "seller" {
 		sellerIDParam := c.Query("sellerId")
-		if sellerIDParam != "" {
-			// Verify seller owns the orders
-			if sellerIDParam != userID.(string) {
-				c.JSON(http.StatusForbidden, ErrorResponse{Error: "Cannot view other seller's orders"})
-				return
-			}
-			if err := db.Where("seller_id = ?", sellerIDParam).Find(&orders).Error; err != nil {
-				c.JSON(http.StatusInternalServerError, ErrorResponse{Error: "Failed to fetch orders"})
-				return
-			}
-		} else {
-			// Return all orders for this seller
-			if err := db.Where("seller_id = ?", userID.(string)).Find(&orders).Error; err != nil {
-				c.JSON(http.StatusInternalServerError, ErrorResponse{Error: "Failed to fetch orders"})
-				return
-			}
+		// Verify seller owns the orders
+		if sellerIDParam != "" && sellerIDParam != userID.(string) {
+			c.JSON(http.StatusForbidden, ErrorResponse{Error: "Cannot view other seller's orders"})
+			return
 		}
+		filter.SellerID = userID.(string)
 	} else {
 		// Buyer: filter by buyerId
-		if err := db.Where("buyer_id = ?", userID.(string)).Find(&orders).Error; err != nil {
-			c.JSON(http.StatusInternalServerError, ErrorResponse{Error: "Failed to fetch orders"})
-			return
-		}
+		filter.BuyerID = userID.(string)
 	}
 
-	c.JSON(http.StatusOK, orders)
+	orders, err := orderRepo.ListOrders(c.Request.Context(), filter, params)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, ErrorResponse{Error: "Failed to fetch orders"})
+		return
+	}
+
+	c.JSON(http.StatusOK, BuildOrderPage(orders, params.Limit))
 }
 
 // HandleUpdateStatus godoc
 // @Summary Update order status
-// @Description Updates order status (seller only, ownership verified)
+// @Description Updates order status (seller only, ownership verified, transition checked against the order state machine)
 // @Tags orders
 // @Accept json
 // @Produce json
 // @Param orderId path string true "Order ID"
+// @Param If-Match header string false "Order version the update expects, as returned in ETag"
 // @Param request body UpdateStatusInput true "New status"
-// @Success 200 {object} map[string]string
+// @Success 200 {object} map[string]interface{}
+// @Header 200 {string} ETag "New order version"
 // @Failure 400 {object} ErrorResponse
 // @Failure 401 {object} ErrorResponse
 // @Failure 403 {object} ErrorResponse
 // @Failure 404 {object} ErrorResponse
+// @Failure 409 {object} ErrorResponse
+// @Failure 412 {object} ErrorResponse
 // @Router /updateStatus/{orderId} [put]
 func HandleUpdateStatus(c *gin.Context) {
 	orderID := c.Param("orderId")
@@ -743,6 +1358,12 @@ func HandleUpdateStatus(c *gin.Context) {
 		return
 	}
 
+	expectedVersion, err := ParseIfMatch(c.GetHeader("If-Match"))
+	if err != nil {
+		c.JSON(http.StatusBadRequest, ErrorResponse{Error: err.Error()})
+		return
+	}
+
 	// Verify seller role
 	customRole, _ := c.Get("customRole")
 	if customRole != "seller" {
@@ -757,8 +1378,8 @@ func HandleUpdateStatus(c *gin.Context) {
 	}
 
 	// Get order to verify ownership
-	var order OrderModel
-	if err := db.First(&order, "order_id = ?", orderID).Error; err != nil {
+	order, err := orderRepo.GetOrder(c.Request.Context(), orderID)
+	if err != nil {
 		c.JSON(http.StatusNotFound, ErrorResponse{Error: "Order not found"})
 		return
 	}
@@ -769,50 +1390,26 @@ func HandleUpdateStatus(c *gin.Context) {
 		return
 	}
 
-	// Update status
-	if err := db.Model(&order).Update("status", input.Status).Error; err != nil {
-		c.JSON(http.StatusInternalServerError, ErrorResponse{Error: "Failed to update order status"})
+	// Apply the transition through the order state machine
+	order, err = orderRepo.UpdateStatus(c.Request.Context(), orderID, StatusChange{
+		To:       input.Status,
+		ActorID:  userID.(string),
+		Role:     RoleSeller,
+		Reason:   input.Reason,
+		Shipment: CreateShipmentInput{Carrier: input.Carrier, TrackingNumber: input.TrackingNumber},
+
+		ExpectedVersion: expectedVersion,
+	})
+	if err != nil {
+		c.JSON(shipmentErrorStatus(err), ErrorResponse{Error: "Cannot update order status: " + err.Error()})
 		return
 	}
 
+	c.Header("ETag", OrderETag(*order))
 	c.JSON(http.StatusOK, gin.H{
 		"message": "Order status updated successfully",
 		"orderId": orderID,
-		"status":  input.Status,
+		"status":  order.Status,
+		"version": order.Version,
 	})
 }
-
-// =============================================================================
-// EventBridge Integration
-// =============================================================================
-
-// FireOrderPlacedEvent fires an "order-placed" event to EventBridge.
-func FireOrderPlacedEvent(orderID string, items []OrderItem) error {
-	detail := map[string]interface{}{
-		"orderId": orderID,
-		"items":   items,
-	}
-
-	detailBytes, err := json.Marshal(detail)
-	if err != nil {
-		return fmt.Errorf("failed to marshal event detail: %w", err)
-	}
-
-	entry := types.PutEventsRequestEntry{
-		Source:       aws.String("order-service"),
-		DetailType:   aws.String("order-placed"),
-		Detail:       aws.String(string(detailBytes)),
-		EventBusName: aws.String(eventBusArn),
-	}
-
-	_, err = eventBridgeClient.PutEvents(context.Background(), &eventbridge.PutEventsInput{
-		Entries: []types.PutEventsRequestEntry{entry},
-	})
-
-	if err != nil {
-		return fmt.Errorf("failed to put event: %w", err)
-	}
-
-	log.Printf("✅ EventBridge event fired: order-placed for order %s", orderID)
-	return nil
-}
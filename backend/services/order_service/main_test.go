@@ -2,7 +2,9 @@ package main
 
 import (
 	"bytes"
+	"context"
 	"encoding/json"
+	"errors"
 	"net/http"
 	"net/http/httptest"
 	"testing"
@@ -10,6 +12,7 @@ import (
 
 	"github.com/gin-gonic/gin"
 	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
 )
 
 func setupTestRouter() *gin.Engine {
@@ -82,58 +85,6 @@ func TestCreateOrderValidation(t *testing.T) {
 	}
 }
 
-func TestMarkPaymentDoneValidation(t *testing.T) {
-	tests := []struct {
-		name           string
-		requestBody    string
-		expectedStatus int
-		errorContains  string
-	}{
-		{
-			name:           "invalid_json",
-			requestBody:    `{invalid}`,
-			expectedStatus: http.StatusBadRequest,
-			errorContains:  "Invalid request",
-		},
-		{
-			name:           "paid_true",
-			requestBody:    `{"paid": true}`,
-			expectedStatus: http.StatusOK,
-			errorContains:  "",
-		},
-	}
-
-	for _, tt := range tests {
-		t.Run(tt.name, func(t *testing.T) {
-			r := setupTestRouter()
-			r.POST("/markPaymentDone/:orderId", func(c *gin.Context) {
-				var input MarkPaymentDoneInput
-				if err := c.ShouldBindJSON(&input); err != nil {
-					c.JSON(http.StatusBadRequest, ErrorResponse{Error: "Invalid request. 'paid' field is required."})
-					return
-				}
-
-				if !input.Paid {
-					c.JSON(http.StatusBadRequest, ErrorResponse{Error: "Payment not confirmed"})
-					return
-				}
-
-				c.JSON(http.StatusOK, gin.H{"redirect": "/orderConfirmed/123"})
-			})
-
-			req, _ := http.NewRequest("POST", "/markPaymentDone/test-order", bytes.NewBufferString(tt.requestBody))
-			req.Header.Set("Content-Type", "application/json")
-			w := httptest.NewRecorder()
-			r.ServeHTTP(w, req)
-
-			assert.Equal(t, tt.expectedStatus, w.Code)
-			if tt.errorContains != "" {
-				assert.Contains(t, w.Body.String(), tt.errorContains)
-			}
-		})
-	}
-}
-
 func TestUpdateStatusValidation(t *testing.T) {
 	tests := []struct {
 		name           string
@@ -358,7 +309,7 @@ func TestOrderModelStructure(t *testing.T) {
 					{ProductID: "prod-1", Quantity: 2},
 				},
 				Status:     "pending",
-				TotalPrice: 99.99,
+				TotalPrice: Money{Amount: 9999, Currency: "LKR"},
 				CreatedAt:  time.Now(),
 				UpdatedAt:  time.Now(),
 			},
@@ -374,7 +325,7 @@ func TestOrderModelStructure(t *testing.T) {
 					{ProductID: "prod-3", Quantity: 3},
 				},
 				Status:     "paid",
-				TotalPrice: 299.99,
+				TotalPrice: Money{Amount: 29999, Currency: "LKR"},
 				CreatedAt:  time.Now(),
 				UpdatedAt:  time.Now(),
 			},
@@ -389,7 +340,7 @@ func TestOrderModelStructure(t *testing.T) {
 			assert.NotEmpty(t, tt.order.SellerID)
 			assert.NotEmpty(t, tt.order.Items)
 			assert.NotEmpty(t, tt.order.Status)
-			assert.Greater(t, tt.order.TotalPrice, 0.0)
+			assert.Greater(t, tt.order.TotalPrice.Amount, int64(0))
 		})
 	}
 }
@@ -551,18 +502,749 @@ func TestEventBridgePayloadStructure(t *testing.T) {
 }
 
 func TestGraphQLQueryStructure(t *testing.T) {
-	// Test that ProductQuery structure is well-formed
-	query := ProductQuery{}
+	// Test that ProductsQuery structure is well-formed
+	query := ProductsQuery{}
 	assert.NotNil(t, query)
 
 	// Test field types
-	query.GetProductById.ProductID = "test-id"
-	query.GetProductById.Name = "Test Product"
-	query.GetProductById.Price = 99.99
-	query.GetProductById.Stock = 10
-	query.GetProductById.SellerID = "seller-id"
-
-	assert.Equal(t, "test-id", query.GetProductById.ProductID)
-	assert.Equal(t, 99.99, query.GetProductById.Price)
-	assert.Equal(t, 10, query.GetProductById.Stock)
+	query.GetProductsByIds = []*ProductDetails{
+		{ProductID: "test-id", Name: "Test Product", Price: Money{Amount: 9999, Currency: "LKR"}, Available: 10, SellerID: "seller-id"},
+		nil,
+	}
+
+	assert.Equal(t, "test-id", query.GetProductsByIds[0].ProductID)
+	assert.Equal(t, Money{Amount: 9999, Currency: "LKR"}, query.GetProductsByIds[0].Price)
+	assert.Equal(t, 10, query.GetProductsByIds[0].Available)
+	assert.Nil(t, query.GetProductsByIds[1])
+}
+
+func TestMatchProducts(t *testing.T) {
+	headphones := &ProductDetails{ProductID: "p1", Name: "Headphones", Price: lkr(17997), Available: 3, SellerID: "seller-a"}
+	charger := &ProductDetails{ProductID: "p2", Name: "Charger", Price: lkr(8997), Available: 5, SellerID: "seller-b"}
+
+	tests := []struct {
+		name            string
+		ids             []string
+		results         []*ProductDetails
+		expectedFound   []string
+		expectedMissing []string
+	}{
+		{
+			name:          "all_found",
+			ids:           []string{"p1", "p2"},
+			results:       []*ProductDetails{headphones, charger},
+			expectedFound: []string{"p1", "p2"},
+		},
+		{
+			name:            "one_missing",
+			ids:             []string{"p1", "gone", "p2"},
+			results:         []*ProductDetails{headphones, nil, charger},
+			expectedFound:   []string{"p1", "p2"},
+			expectedMissing: []string{"gone"},
+		},
+		{
+			name:            "missing_reported_once",
+			ids:             []string{"gone", "p1", "gone", "also-gone"},
+			results:         []*ProductDetails{nil, headphones, nil, nil},
+			expectedFound:   []string{"p1"},
+			expectedMissing: []string{"gone", "also-gone"},
+		},
+		{
+			name:            "short_result",
+			ids:             []string{"p1", "p2"},
+			results:         []*ProductDetails{headphones},
+			expectedFound:   []string{"p1"},
+			expectedMissing: []string{"p2"},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			found, missing := MatchProducts(tt.ids, tt.results)
+
+			assert.Len(t, found, len(tt.expectedFound))
+			for _, id := range tt.expectedFound {
+				assert.Equal(t, id, found[id].ProductID)
+			}
+			assert.Equal(t, tt.expectedMissing, missing)
+		})
+	}
+}
+
+func TestGroupItemsBySeller(t *testing.T) {
+	tests := []struct {
+		name            string
+		items           []OrderItem
+		expectedSellers []string
+		expectedCounts  []int
+	}{
+		{
+			name: "single_seller",
+			items: []OrderItem{
+				{ProductID: "prod-1", Quantity: 1, SellerID: "seller-a"},
+				{ProductID: "prod-3", Quantity: 2, SellerID: "seller-a"},
+			},
+			expectedSellers: []string{"seller-a"},
+			expectedCounts:  []int{2},
+		},
+		{
+			name: "multi_seller_keeps_first_seen_order",
+			items: []OrderItem{
+				{ProductID: "prod-2", Quantity: 1, SellerID: "seller-b"},
+				{ProductID: "prod-1", Quantity: 2, SellerID: "seller-a"},
+				{ProductID: "prod-3", Quantity: 1, SellerID: "seller-a"},
+			},
+			expectedSellers: []string{"seller-b", "seller-a"},
+			expectedCounts:  []int{1, 2},
+		},
+		{
+			name:            "empty_cart",
+			items:           []OrderItem{},
+			expectedSellers: []string{},
+			expectedCounts:  []int{},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			groups := GroupItemsBySeller(tt.items)
+			assert.Len(t, groups, len(tt.expectedSellers))
+			for i, group := range groups {
+				assert.Equal(t, tt.expectedSellers[i], group.SellerID)
+				assert.Len(t, group.Items, tt.expectedCounts[i])
+				for _, item := range group.Items {
+					assert.Equal(t, group.SellerID, item.SellerID)
+				}
+			}
+		})
+	}
+}
+
+func TestSnapshotOrderItem(t *testing.T) {
+	// Client-supplied name and price must be replaced by ProductService values
+	input := OrderItem{ProductID: "prod-1", Quantity: 3, Name: "Spoofed", Price: Money{Amount: 1, Currency: "LKR"}, SellerID: "someone-else"}
+
+	line := SnapshotOrderItem(input, "Wireless Headphones", lkr(17997), "seller-a")
+
+	assert.Equal(t, "prod-1", line.ProductID)
+	assert.Equal(t, 3, line.Quantity)
+	assert.Equal(t, "Wireless Headphones", line.Name)
+	assert.Equal(t, lkr(17997), line.Price)
+	assert.Equal(t, "seller-a", line.SellerID)
+	assert.Equal(t, lkr(53991), line.LineTotal)
+
+	jsonBytes, err := json.Marshal(line)
+	assert.NoError(t, err)
+	var decoded map[string]interface{}
+	assert.NoError(t, json.Unmarshal(jsonBytes, &decoded))
+	assert.Equal(t, "Wireless Headphones", decoded["name"])
+	assert.Equal(t, map[string]interface{}{"amount": 1799700.0, "currency": "LKR"}, decoded["price"])
+	assert.Equal(t, "seller-a", decoded["sellerId"])
+	assert.Equal(t, map[string]interface{}{"amount": 5399100.0, "currency": "LKR"}, decoded["lineTotal"])
+	assert.NotContains(t, decoded, "discount", "undiscounted lines leave the discount out")
+}
+
+func TestCheckoutTableName(t *testing.T) {
+	checkout := CheckoutModel{}
+	assert.Equal(t, "checkouts", checkout.TableName())
+}
+
+func TestCreateOrderResponseStructure(t *testing.T) {
+	resp := CreateOrderResponse{
+		CheckoutID: "checkout-1",
+		OrderIDs:   []string{"order-1", "order-2"},
+		TotalPrice: lkr(150),
+		PaymentURL: "/payment/checkout-1",
+	}
+
+	jsonBytes, err := json.Marshal(resp)
+	assert.NoError(t, err)
+
+	var decoded map[string]interface{}
+	err = json.Unmarshal(jsonBytes, &decoded)
+	assert.NoError(t, err)
+	assert.Equal(t, "checkout-1", decoded["checkoutId"])
+	assert.Len(t, decoded["orderIds"], 2)
+	assert.Equal(t, "/payment/checkout-1", decoded["paymentUrl"])
+	assert.Equal(t, map[string]interface{}{"amount": 15000.0, "currency": "LKR"}, decoded["totalPrice"])
+}
+
+// fakeProductCatalog serves products from a map and records reservations.
+type fakeProductCatalog struct {
+	products   map[string]ProductDetails
+	reserveErr error
+	reserved   []string
+	released   []string
+}
+
+func (f *fakeProductCatalog) FetchProducts(ctx context.Context, ids []string) (map[string]ProductDetails, []string, error) {
+	results := make([]*ProductDetails, len(ids))
+	for i, id := range ids {
+		if product, ok := f.products[id]; ok {
+			results[i] = &product
+		}
+	}
+	products, missing := MatchProducts(ids, results)
+	return products, missing, nil
+}
+
+func (f *fakeProductCatalog) ReserveStock(ctx context.Context, authorization, reservationID string, items []OrderItem) error {
+	if f.reserveErr != nil {
+		return f.reserveErr
+	}
+	f.reserved = append(f.reserved, reservationID)
+	return nil
+}
+
+func (f *fakeProductCatalog) ReleaseReservation(ctx context.Context, authorization, reservationID string) error {
+	f.released = append(f.released, reservationID)
+	return nil
+}
+
+// setupOrderFlow swaps in an in-memory order repository and a fake catalog
+// and returns a router with the order endpoints. Requests act as the user in
+// the X-User-Id and X-Role headers.
+func setupOrderFlow(t *testing.T) (*gin.Engine, *MemoryOrderRepository, *fakeProductCatalog) {
+	previousRepo, previousCatalog := orderRepo, productCatalog
+	repo := NewMemoryOrderRepository()
+	catalog := &fakeProductCatalog{products: map[string]ProductDetails{
+		"prod-1": {ProductID: "prod-1", Name: "Headphones", Price: lkr(1000), Available: 5, SellerID: "seller-1"},
+		"prod-2": {ProductID: "prod-2", Name: "Charger", Price: lkr(500), Available: 5, SellerID: "seller-2"},
+	}}
+	orderRepo, productCatalog = repo, catalog
+	t.Cleanup(func() { orderRepo, productCatalog = previousRepo, previousCatalog })
+
+	r := setupTestRouter()
+	r.Use(func(c *gin.Context) {
+		c.Set("userId", c.GetHeader("X-User-Id"))
+		c.Set("customRole", c.GetHeader("X-Role"))
+		c.Next()
+	})
+	r.POST("/createOrder", HandleCreateOrder)
+	r.GET("/getOrders", HandleGetOrders)
+	r.PUT("/updateStatus/:orderId", HandleUpdateStatus)
+	r.GET("/checkouts", HandleGetCheckouts)
+	r.GET("/checkouts/:checkoutId", HandleGetCheckout)
+	r.GET("/orders/:orderId/history", HandleGetOrderHistory)
+	r.POST("/orders/:orderId/cancel", HandleCancelOrder)
+	r.GET("/orderConfirmed/:orderId", HandleOrderConfirmed)
+	r.POST("/cart/checkout", HandleCartCheckout)
+	r.GET("/payments/:id", HandleGetPayment)
+	r.POST("/payments/:id/intent", HandleCreatePaymentIntent)
+	r.POST("/payments/:id/confirm", HandleConfirmPayment)
+	r.POST("/payments/webhook", HandlePaymentWebhook)
+	return r, repo, catalog
+}
+
+// useFakePayments points the payment provider at a fake Stripe server whose
+// signed webhooks are posted to the router's /payments/webhook.
+func useFakePayments(t *testing.T, r *gin.Engine) *FakePaymentServer {
+	routerServer := httptest.NewServer(r)
+	t.Cleanup(routerServer.Close)
+
+	fake := NewFakePaymentServer("sk_test_flow", "whsec_flow", routerServer.URL+"/payments/webhook")
+	apiServer := httptest.NewServer(fake)
+	t.Cleanup(apiServer.Close)
+
+	previous := paymentProvider
+	provider := NewStripeProvider(apiServer.URL, "sk_test_flow", "whsec_flow")
+	provider.ConfirmPaymentMethod = "pm_card_visa"
+	paymentProvider = provider
+	t.Cleanup(func() { paymentProvider = previous })
+
+	return fake
+}
+
+// payFlowCheckout pays for a checkout or order the way a buyer does: it opens
+// a payment intent, confirms it and waits for the provider's webhook.
+func payFlowCheckout(t *testing.T, r *gin.Engine, fake *FakePaymentServer, buyerID, reference string) {
+	t.Helper()
+
+	w := doFlowRequest(r, http.MethodPost, "/payments/"+reference+"/intent", buyerID, "buyer", "")
+	require.Equal(t, http.StatusOK, w.Code, w.Body.String())
+	w = doFlowRequest(r, http.MethodPost, "/payments/"+reference+"/confirm", buyerID, "buyer", "")
+	require.Equal(t, http.StatusAccepted, w.Code, w.Body.String())
+	fake.Wait()
+}
+
+func doFlowRequest(r *gin.Engine, method, path, userID, role, body string) *httptest.ResponseRecorder {
+	req, _ := http.NewRequest(method, path, bytes.NewBufferString(body))
+	req.Header.Set("Content-Type", "application/json")
+	req.Header.Set("X-User-Id", userID)
+	req.Header.Set("X-Role", role)
+	w := httptest.NewRecorder()
+	r.ServeHTTP(w, req)
+	return w
+}
+
+const flowOrderBody = `{
+	"items": [{"productId": "prod-1", "quantity": 2}, {"productId": "prod-2", "quantity": 1}],
+	"shippingAddress": {"name": "Nimal Perera", "line1": "12 Galle Road", "city": "Colombo", "country": "LK"}
+}`
+
+func TestOrderFlowCreatePayShip(t *testing.T) {
+	r, repo, catalog := setupOrderFlow(t)
+	fake := useFakePayments(t, r)
+
+	// Place a two-seller order
+	w := doFlowRequest(r, http.MethodPost, "/createOrder", "buyer-1", "buyer", flowOrderBody)
+	require.Equal(t, http.StatusCreated, w.Code, w.Body.String())
+	var created CreateOrderResponse
+	require.NoError(t, json.Unmarshal(w.Body.Bytes(), &created))
+	require.Len(t, created.OrderIDs, 2)
+	assert.Equal(t, []string{created.CheckoutID}, catalog.reserved)
+	assert.Empty(t, catalog.released)
+
+	w = doFlowRequest(r, http.MethodGet, "/checkouts/"+created.CheckoutID, "buyer-1", "buyer", "")
+	require.Equal(t, http.StatusOK, w.Code)
+	var checkout CheckoutModel
+	require.NoError(t, json.Unmarshal(w.Body.Bytes(), &checkout))
+	require.Len(t, checkout.Orders, 2)
+	assert.Equal(t, created.TotalPrice, checkout.TotalPrice)
+
+	var sellerOneOrder string
+	for _, order := range checkout.Orders {
+		assert.Equal(t, StatusPending, order.Status)
+		if order.SellerID == "seller-1" {
+			sellerOneOrder = order.OrderID
+			assert.Equal(t, lkr(2000), order.Subtotal)
+		}
+	}
+	require.NotEmpty(t, sellerOneOrder)
+
+	// A seller cannot ship before payment
+	w = doFlowRequest(r, http.MethodPut, "/updateStatus/"+sellerOneOrder, "seller-1", "seller", `{"status": "shipped"}`)
+	assert.Equal(t, http.StatusConflict, w.Code)
+
+	// Only the buyer can pay, and the orders are paid once the provider's
+	// signed webhook arrives
+	w = doFlowRequest(r, http.MethodPost, "/payments/"+created.CheckoutID+"/intent", "buyer-2", "buyer", "")
+	assert.Equal(t, http.StatusForbidden, w.Code)
+
+	payFlowCheckout(t, r, fake, "buyer-1", created.CheckoutID)
+
+	w = doFlowRequest(r, http.MethodGet, "/payments/"+created.CheckoutID, "buyer-1", "buyer", "")
+	require.Equal(t, http.StatusOK, w.Code)
+	var summary PaymentSummaryResponse
+	require.NoError(t, json.Unmarshal(w.Body.Bytes(), &summary))
+	assert.Equal(t, StatusPaid, summary.Status)
+	assert.Equal(t, created.TotalPrice, summary.Amount)
+	require.NotNil(t, summary.Payment)
+	assert.Equal(t, PaymentSucceeded, summary.Payment.Status)
+
+	w = doFlowRequest(r, http.MethodPost, "/payments/"+created.CheckoutID+"/intent", "buyer-1", "buyer", "")
+	assert.Equal(t, http.StatusConflict, w.Code, "a paid checkout cannot be paid again")
+
+	// Only the order's own seller can ship it
+	w = doFlowRequest(r, http.MethodPut, "/updateStatus/"+sellerOneOrder, "seller-2", "seller", `{"status": "shipped"}`)
+	assert.Equal(t, http.StatusForbidden, w.Code)
+
+	w = doFlowRequest(r, http.MethodPut, "/updateStatus/"+sellerOneOrder, "seller-1", "seller",
+		`{"status": "shipped", "carrier": "dhl", "trackingNumber": "TRK123"}`)
+	require.Equal(t, http.StatusOK, w.Code, w.Body.String())
+	assert.Contains(t, w.Body.String(), `"status":"shipped"`)
+
+	w = doFlowRequest(r, http.MethodPut, "/updateStatus/"+sellerOneOrder, "seller-1", "seller", `{"status": "delivered"}`)
+	require.Equal(t, http.StatusOK, w.Code, w.Body.String())
+
+	// The seller sees only their order, the buyer sees both
+	w = doFlowRequest(r, http.MethodGet, "/getOrders", "seller-1", "seller", "")
+	require.Equal(t, http.StatusOK, w.Code)
+	var page OrderPage
+	require.NoError(t, json.Unmarshal(w.Body.Bytes(), &page))
+	require.Len(t, page.Orders, 1)
+	assert.Equal(t, StatusDelivered, page.Orders[0].Status)
+
+	w = doFlowRequest(r, http.MethodGet, "/getOrders?status=paid", "buyer-1", "buyer", "")
+	require.Equal(t, http.StatusOK, w.Code)
+	require.NoError(t, json.Unmarshal(w.Body.Bytes(), &page))
+	require.Len(t, page.Orders, 1)
+	assert.Equal(t, "seller-2", page.Orders[0].SellerID)
+
+	w = doFlowRequest(r, http.MethodGet, "/orders/"+sellerOneOrder+"/history", "buyer-1", "buyer", "")
+	require.Equal(t, http.StatusOK, w.Code)
+	var history []OrderStatusHistory
+	require.NoError(t, json.Unmarshal(w.Body.Bytes(), &history))
+	var statuses []string
+	for _, entry := range history {
+		statuses = append(statuses, entry.ToStatus)
+	}
+	assert.Equal(t, []string{StatusPending, StatusPaid, StatusShipped, StatusDelivered}, statuses)
+	assert.Equal(t, "shipped with dhl, tracking TRK123", history[2].Reason)
+	assert.Equal(t, []string{"order-placed", "order-paid", "order-shipped", "order-delivered"}, repo.Events(sellerOneOrder))
+
+	w = doFlowRequest(r, http.MethodGet, "/orders/"+sellerOneOrder+"/history", "buyer-2", "buyer", "")
+	assert.Equal(t, http.StatusForbidden, w.Code)
+}
+
+func TestOrderFlowOrderConfirmedAccess(t *testing.T) {
+	r, _, _ := setupOrderFlow(t)
+
+	w := doFlowRequest(r, http.MethodPost, "/createOrder", "buyer-1", "buyer", flowOrderBody)
+	require.Equal(t, http.StatusCreated, w.Code, w.Body.String())
+	var created CreateOrderResponse
+	require.NoError(t, json.Unmarshal(w.Body.Bytes(), &created))
+	orderID := created.OrderIDs[0]
+
+	tests := []struct {
+		name           string
+		id             string
+		userID         string
+		role           string
+		expectedStatus int
+	}{
+		{name: "checkout_as_buyer", id: created.CheckoutID, userID: "buyer-1", role: "buyer", expectedStatus: http.StatusOK},
+		{name: "checkout_as_other_buyer", id: created.CheckoutID, userID: "buyer-2", role: "buyer", expectedStatus: http.StatusForbidden},
+		{name: "checkout_as_seller", id: created.CheckoutID, userID: "seller-1", role: "seller", expectedStatus: http.StatusForbidden},
+		{name: "order_as_buyer", id: orderID, userID: "buyer-1", role: "buyer", expectedStatus: http.StatusOK},
+		{name: "order_as_seller", id: orderID, userID: "seller-1", role: "seller", expectedStatus: http.StatusOK},
+		{name: "order_as_other_seller", id: orderID, userID: "seller-2", role: "seller", expectedStatus: http.StatusForbidden},
+		{name: "order_anonymous", id: orderID, expectedStatus: http.StatusForbidden},
+		{name: "missing", id: "missing", userID: "buyer-1", role: "buyer", expectedStatus: http.StatusNotFound},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			w := doFlowRequest(r, http.MethodGet, "/orderConfirmed/"+tt.id, tt.userID, tt.role, "")
+			assert.Equal(t, tt.expectedStatus, w.Code)
+			if tt.expectedStatus != http.StatusOK {
+				assert.NotContains(t, w.Body.String(), "Galle Road", "the shipping address is not shown")
+			}
+		})
+	}
+}
+
+func TestOrderFlowCancel(t *testing.T) {
+	r, repo, _ := setupOrderFlow(t)
+
+	w := doFlowRequest(r, http.MethodPost, "/createOrder", "buyer-1", "buyer", flowOrderBody)
+	require.Equal(t, http.StatusCreated, w.Code, w.Body.String())
+	var created CreateOrderResponse
+	require.NoError(t, json.Unmarshal(w.Body.Bytes(), &created))
+	orderID := created.OrderIDs[0]
+
+	w = doFlowRequest(r, http.MethodPost, "/orders/"+orderID+"/cancel", "buyer-2", "buyer", `{"reason": "not mine"}`)
+	assert.Equal(t, http.StatusForbidden, w.Code)
+
+	w = doFlowRequest(r, http.MethodPost, "/orders/"+orderID+"/cancel", "buyer-1", "buyer", `{"reason": "changed my mind"}`)
+	require.Equal(t, http.StatusOK, w.Code, w.Body.String())
+	assert.Contains(t, w.Body.String(), `"status":"cancelled"`)
+	assert.Equal(t, []string{"order-placed", "order-cancelled"}, repo.Events(orderID))
+
+	// A cancelled order can be neither cancelled again nor shipped
+	w = doFlowRequest(r, http.MethodPost, "/orders/"+orderID+"/cancel", "buyer-1", "buyer", `{"reason": "again"}`)
+	assert.Equal(t, http.StatusConflict, w.Code)
+
+	w = doFlowRequest(r, http.MethodGet, "/orderConfirmed/"+orderID, "buyer-1", "buyer", "")
+	require.Equal(t, http.StatusOK, w.Code)
+	assert.Contains(t, w.Body.String(), `"status":"cancelled"`)
+
+	w = doFlowRequest(r, http.MethodGet, "/orders/missing/history", "buyer-1", "buyer", "")
+	assert.Equal(t, http.StatusNotFound, w.Code)
+}
+
+func TestOrderFlowCancelPaidOrderRefunds(t *testing.T) {
+	r, repo, _ := setupOrderFlow(t)
+	fake := useFakePayments(t, r)
+	ctx := context.Background()
+
+	w := doFlowRequest(r, http.MethodPost, "/createOrder", "buyer-1", "buyer", flowOrderBody)
+	require.Equal(t, http.StatusCreated, w.Code, w.Body.String())
+	var created CreateOrderResponse
+	require.NoError(t, json.Unmarshal(w.Body.Bytes(), &created))
+	payFlowCheckout(t, r, fake, "buyer-1", created.CheckoutID)
+
+	cancelled, err := repo.GetOrder(ctx, created.OrderIDs[0])
+	require.NoError(t, err)
+	require.Equal(t, StatusPaid, cancelled.Status)
+
+	w = doFlowRequest(r, http.MethodPost, "/orders/"+cancelled.OrderID+"/cancel", "buyer-1", "buyer", `{"reason": "changed my mind"}`)
+	require.Equal(t, http.StatusOK, w.Code, w.Body.String())
+
+	// Cancelling queues a refund of just this order's total from the
+	// checkout's payment
+	refunds := repo.Refunds(cancelled.OrderID)
+	require.Len(t, refunds, 1)
+	assert.Equal(t, RefundPending, refunds[0].Status)
+	assert.Equal(t, cancelled.TotalPrice, refunds[0].Amount)
+	assert.Empty(t, repo.Refunds(created.OrderIDs[1]), "the other seller's order is still paid")
+
+	worker := NewRefundWorker(repo, paymentProvider)
+	issued, err := worker.ProcessBatch(ctx, time.Now().UTC())
+	require.NoError(t, err)
+	assert.Equal(t, 1, issued)
+
+	refunds = repo.Refunds(cancelled.OrderID)
+	require.Len(t, refunds, 1)
+	assert.Equal(t, RefundSucceeded, refunds[0].Status)
+	assert.NotEmpty(t, refunds[0].ProviderRefundID)
+	assert.Equal(t, 1, refunds[0].Attempts)
+
+	// The provider confirms the refund with a charge.refunded webhook. Only
+	// one seller's order was refunded, so the payment is partially refunded.
+	fake.Wait()
+	payment, err := repo.LatestPayment(ctx, created.CheckoutID, "")
+	require.NoError(t, err)
+	assert.Equal(t, PaymentPartiallyRefunded, payment.Status)
+	assert.Equal(t, cancelled.TotalPrice, payment.Refunded)
+
+	w = doFlowRequest(r, http.MethodGet, "/payments/"+created.CheckoutID, "buyer-1", "buyer", "")
+	require.Equal(t, http.StatusOK, w.Code, w.Body.String())
+	var summary PaymentSummaryResponse
+	require.NoError(t, json.Unmarshal(w.Body.Bytes(), &summary))
+	assert.Equal(t, PaymentPartiallyRefunded, summary.Status)
+
+	issued, err = worker.ProcessBatch(ctx, time.Now().UTC())
+	require.NoError(t, err)
+	assert.Zero(t, issued, "a refund is only paid once")
+
+	// Cancelling the other order refunds the rest of the payment
+	w = doFlowRequest(r, http.MethodPost, "/orders/"+created.OrderIDs[1]+"/cancel", "buyer-1", "buyer", `{"reason": "changed my mind"}`)
+	require.Equal(t, http.StatusOK, w.Code, w.Body.String())
+	issued, err = worker.ProcessBatch(ctx, time.Now().UTC())
+	require.NoError(t, err)
+	assert.Equal(t, 1, issued)
+
+	fake.Wait()
+	payment, err = repo.LatestPayment(ctx, created.CheckoutID, "")
+	require.NoError(t, err)
+	assert.Equal(t, PaymentRefunded, payment.Status)
+	assert.Equal(t, created.TotalPrice, payment.Refunded)
+
+	w = doFlowRequest(r, http.MethodGet, "/payments/"+created.CheckoutID, "buyer-1", "buyer", "")
+	require.Equal(t, http.StatusOK, w.Code, w.Body.String())
+	require.NoError(t, json.Unmarshal(w.Body.Bytes(), &summary))
+	assert.Equal(t, PaymentRefunded, summary.Status)
+}
+
+func TestOrderFlowLatePaymentRefunded(t *testing.T) {
+	r, repo, _ := setupOrderFlow(t)
+	fake := useFakePayments(t, r)
+	ctx := context.Background()
+
+	w := doFlowRequest(r, http.MethodPost, "/createOrder", "buyer-1", "buyer", flowOrderBody)
+	require.Equal(t, http.StatusCreated, w.Code, w.Body.String())
+	var created CreateOrderResponse
+	require.NoError(t, json.Unmarshal(w.Body.Bytes(), &created))
+
+	w = doFlowRequest(r, http.MethodPost, "/payments/"+created.CheckoutID+"/intent", "buyer-1", "buyer", "")
+	require.Equal(t, http.StatusOK, w.Code, w.Body.String())
+
+	// The orders expire while the buyer is still paying
+	expirer := NewOrderExpirer(repo, 15*time.Minute, time.Minute)
+	expired, err := expirer.ExpireBatch(ctx, time.Now().UTC().Add(time.Hour))
+	require.NoError(t, err)
+	require.Equal(t, 2, expired)
+
+	w = doFlowRequest(r, http.MethodPost, "/payments/"+created.CheckoutID+"/confirm", "buyer-1", "buyer", "")
+	require.Equal(t, http.StatusAccepted, w.Code, w.Body.String())
+	fake.Wait()
+
+	for _, orderID := range created.OrderIDs {
+		order, err := repo.GetOrder(ctx, orderID)
+		require.NoError(t, err)
+		assert.Equal(t, StatusExpired, order.Status)
+
+		refunds := repo.Refunds(orderID)
+		require.Len(t, refunds, 1, "the late payment is refunded")
+		assert.Equal(t, order.TotalPrice, refunds[0].Amount)
+		assert.Contains(t, refunds[0].Reason, "after the order was expired")
+	}
+
+	summaryStatus := func() string {
+		w := doFlowRequest(r, http.MethodGet, "/payments/"+created.CheckoutID, "buyer-1", "buyer", "")
+		require.Equal(t, http.StatusOK, w.Code, w.Body.String())
+		var summary PaymentSummaryResponse
+		require.NoError(t, json.Unmarshal(w.Body.Bytes(), &summary))
+		return summary.Status
+	}
+	assert.Equal(t, StatusExpired, summaryStatus())
+
+	issued, err := NewRefundWorker(repo, paymentProvider).ProcessBatch(ctx, time.Now().UTC())
+	require.NoError(t, err)
+	assert.Equal(t, 2, issued)
+	fake.Wait()
+	assert.Equal(t, PaymentRefunded, summaryStatus())
+}
+
+func TestOrderFlowIfMatch(t *testing.T) {
+	r, repo, _ := setupOrderFlow(t)
+
+	w := doFlowRequest(r, http.MethodPost, "/createOrder", "buyer-1", "buyer", flowOrderBody)
+	require.Equal(t, http.StatusCreated, w.Code, w.Body.String())
+	var created CreateOrderResponse
+	require.NoError(t, json.Unmarshal(w.Body.Bytes(), &created))
+	orderID := created.OrderIDs[0]
+
+	w = doFlowRequest(r, http.MethodGet, "/orderConfirmed/"+orderID, "buyer-1", "buyer", "")
+	require.Equal(t, http.StatusOK, w.Code)
+	assert.Equal(t, `"1"`, w.Header().Get("ETag"))
+
+	cancel := func(ifMatch string) *httptest.ResponseRecorder {
+		req, _ := http.NewRequest(http.MethodPost, "/orders/"+orderID+"/cancel", bytes.NewBufferString(`{"reason": "changed my mind"}`))
+		req.Header.Set("Content-Type", "application/json")
+		req.Header.Set("X-User-Id", "buyer-1")
+		req.Header.Set("X-Role", "buyer")
+		req.Header.Set("If-Match", ifMatch)
+		w := httptest.NewRecorder()
+		r.ServeHTTP(w, req)
+		return w
+	}
+
+	w = cancel("not-a-version")
+	assert.Equal(t, http.StatusBadRequest, w.Code)
+
+	// The system pays the order in the meantime, so the buyer's copy is stale
+	_, err := repo.UpdateStatus(context.Background(), orderID, StatusChange{To: StatusPaid, ActorID: "payment", Role: RoleSystem})
+	require.NoError(t, err)
+
+	w = cancel(`"1"`)
+	assert.Equal(t, http.StatusPreconditionFailed, w.Code, w.Body.String())
+	order, err := repo.GetOrder(context.Background(), orderID)
+	require.NoError(t, err)
+	assert.Equal(t, StatusPaid, order.Status, "a rejected update changes nothing")
+
+	w = cancel(`"2"`)
+	require.Equal(t, http.StatusOK, w.Code, w.Body.String())
+	assert.Equal(t, `"3"`, w.Header().Get("ETag"))
+	assert.Contains(t, w.Body.String(), `"version":3`)
+}
+
+func TestCreateOrderReservationFailure(t *testing.T) {
+	r, repo, catalog := setupOrderFlow(t)
+	catalog.reserveErr = errors.New("insufficient stock for product prod-1")
+
+	w := doFlowRequest(r, http.MethodPost, "/createOrder", "buyer-1", "buyer", flowOrderBody)
+	assert.Equal(t, http.StatusConflict, w.Code)
+
+	checkouts, err := repo.ListCheckouts(context.Background(), "buyer-1")
+	require.NoError(t, err)
+	assert.Empty(t, checkouts, "nothing is written when the stock cannot be held")
+
+	w = doFlowRequest(r, http.MethodPost, "/createOrder", "buyer-1", "buyer", `{
+		"items": [{"productId": "prod-9", "quantity": 1}],
+		"shippingAddress": {"name": "Nimal Perera", "line1": "12 Galle Road", "city": "Colombo", "country": "LK"}
+	}`)
+	assert.Equal(t, http.StatusBadRequest, w.Code)
+	assert.Contains(t, w.Body.String(), "prod-9")
+}
+
+func TestOrderFlowCoupon(t *testing.T) {
+	r, repo, catalog := setupOrderFlow(t)
+	repo.AddCoupon(CouponModel{Code: "SAVE10", SellerID: "seller-1", Type: CouponPercentage, Value: 10, UsageLimit: 1, Active: true})
+
+	w := doFlowRequest(r, http.MethodPost, "/createOrder", "buyer-1", "buyer", `{
+		"items": [{"productId": "prod-1", "quantity": 2}, {"productId": "prod-2", "quantity": 1}],
+		"couponCode": " save10 ",
+		"shippingAddress": {"name": "Nimal Perera", "line1": "12 Galle Road", "city": "Colombo", "country": "LK"}
+	}`)
+	require.Equal(t, http.StatusCreated, w.Code, w.Body.String())
+	var created CreateOrderResponse
+	require.NoError(t, json.Unmarshal(w.Body.Bytes(), &created))
+	assert.Equal(t, lkr(200), created.Discount, "10% off seller-1's lines only")
+
+	checkout, err := repo.GetCheckout(context.Background(), created.CheckoutID)
+	require.NoError(t, err)
+	assert.Equal(t, "SAVE10", checkout.CouponCode)
+	coupon, err := repo.GetCoupon(context.Background(), "SAVE10")
+	require.NoError(t, err)
+	assert.Equal(t, 1, coupon.UsedCount)
+
+	// The coupon's single use is gone, so the next checkout is refused and
+	// its stock handed back
+	w = doFlowRequest(r, http.MethodPost, "/createOrder", "buyer-2", "buyer", `{
+		"items": [{"productId": "prod-1", "quantity": 1}],
+		"couponCode": "SAVE10",
+		"shippingAddress": {"name": "Kamal Silva", "line1": "1 Temple Road", "city": "Kandy", "country": "LK"}
+	}`)
+	assert.Equal(t, http.StatusConflict, w.Code, w.Body.String())
+	require.Len(t, catalog.reserved, 2)
+	assert.Equal(t, catalog.reserved[1:], catalog.released)
+	checkouts, err := repo.ListCheckouts(context.Background(), "buyer-2")
+	require.NoError(t, err)
+	assert.Empty(t, checkouts)
+}
+
+func TestOrderFlowDefaultAddress(t *testing.T) {
+	r, repo, catalog := setupOrderFlow(t)
+	home := Address{Name: "Nimal Perera", Line1: "12 Galle Road", City: "Colombo", Country: "LK"}
+
+	// A buyer with no address at all is refused before any stock is reserved
+	w := doFlowRequest(r, http.MethodPost, "/createOrder", "buyer-2", "buyer", `{"items": [{"productId": "prod-1", "quantity": 1}]}`)
+	assert.Equal(t, http.StatusBadRequest, w.Code, w.Body.String())
+	assert.Contains(t, w.Body.String(), "shipping address is required")
+	assert.Empty(t, catalog.reserved)
+	checkouts, err := repo.ListCheckouts(context.Background(), "buyer-2")
+	require.NoError(t, err)
+	assert.Empty(t, checkouts)
+
+	repo.AddAddress(AddressModel{AddressID: "3f9a8e36-64a4-4f0c-9d57-0e6c1d1f2a10", BuyerID: "buyer-1", Address: home, IsDefault: true})
+
+	// Without addressId or shippingAddress the order ships to the default
+	w = doFlowRequest(r, http.MethodPost, "/createOrder", "buyer-1", "buyer", `{"items": [{"productId": "prod-1", "quantity": 1}]}`)
+	require.Equal(t, http.StatusCreated, w.Code, w.Body.String())
+	var created CreateOrderResponse
+	require.NoError(t, json.Unmarshal(w.Body.Bytes(), &created))
+	require.Len(t, created.OrderIDs, 1)
+
+	order, err := repo.GetOrder(context.Background(), created.OrderIDs[0])
+	require.NoError(t, err)
+	assert.Equal(t, &home, order.ShippingAddress)
+}
+
+func TestOrderFlowIdempotencyKey(t *testing.T) {
+	r, repo, catalog := setupOrderFlow(t)
+
+	create := func(body string) *httptest.ResponseRecorder {
+		req, _ := http.NewRequest(http.MethodPost, "/createOrder", bytes.NewBufferString(body))
+		req.Header.Set("Content-Type", "application/json")
+		req.Header.Set("X-User-Id", "buyer-1")
+		req.Header.Set("X-Role", "buyer")
+		req.Header.Set(IdempotencyKeyHeader, "order-attempt-1")
+		w := httptest.NewRecorder()
+		r.ServeHTTP(w, req)
+		return w
+	}
+
+	first := create(flowOrderBody)
+	require.Equal(t, http.StatusCreated, first.Code, first.Body.String())
+
+	retry := create(flowOrderBody)
+	assert.Equal(t, http.StatusCreated, retry.Code)
+	assert.Equal(t, "true", retry.Header().Get("Idempotent-Replayed"))
+	assert.JSONEq(t, first.Body.String(), retry.Body.String())
+
+	w := create(`{"items": [{"productId": "prod-2", "quantity": 1}], "shippingAddress": {"name": "Nimal Perera", "line1": "12 Galle Road", "city": "Colombo", "country": "LK"}}`)
+	assert.Equal(t, http.StatusUnprocessableEntity, w.Code, "a key cannot be reused for another order")
+
+	checkouts, err := repo.ListCheckouts(context.Background(), "buyer-1")
+	require.NoError(t, err)
+	assert.Len(t, checkouts, 1)
+	assert.Len(t, catalog.reserved, 1, "a replayed request reserves nothing")
+}
+
+func TestOrderFlowCartCheckout(t *testing.T) {
+	r, repo, catalog := setupOrderFlow(t)
+	repo.AddCartItem(CartItemModel{BuyerID: "buyer-1", ProductID: "prod-1", Quantity: 2})
+	repo.AddCartItem(CartItemModel{BuyerID: "buyer-1", ProductID: "prod-2", Quantity: 1})
+	repo.AddCartItem(CartItemModel{BuyerID: "buyer-2", ProductID: "prod-1", Quantity: 1})
+
+	body := `{"shippingAddress": {"name": "Nimal Perera", "line1": "12 Galle Road", "city": "Colombo", "country": "LK"}}`
+	w := doFlowRequest(r, http.MethodPost, "/cart/checkout", "buyer-1", "buyer", body)
+	require.Equal(t, http.StatusCreated, w.Code, w.Body.String())
+	var created CreateOrderResponse
+	require.NoError(t, json.Unmarshal(w.Body.Bytes(), &created))
+	assert.Len(t, created.OrderIDs, 2)
+	assert.Equal(t, []string{created.CheckoutID}, catalog.reserved)
+
+	cart, err := repo.CartItems(context.Background(), "buyer-1")
+	require.NoError(t, err)
+	assert.Empty(t, cart, "the checked out lines are removed with the orders")
+	cart, err = repo.CartItems(context.Background(), "buyer-2")
+	require.NoError(t, err)
+	assert.Len(t, cart, 1, "other buyers' carts are untouched")
+
+	w = doFlowRequest(r, http.MethodPost, "/cart/checkout", "buyer-1", "buyer", body)
+	assert.Equal(t, http.StatusBadRequest, w.Code)
+	assert.Contains(t, w.Body.String(), "Cart is empty")
 }
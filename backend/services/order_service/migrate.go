@@ -0,0 +1,455 @@
+package main
+
+import (
+	"context"
+	"embed"
+	"errors"
+	"fmt"
+	"io"
+	"io/fs"
+	"log"
+	"path"
+	"regexp"
+	"sort"
+	"strconv"
+	"text/tabwriter"
+	"time"
+
+	"gorm.io/gorm"
+)
+
+// =============================================================================
+// Schema Migrations
+// =============================================================================
+
+// The schema is defined by the numbered SQL files in migrations/, which are
+// embedded in the binary. Every NNNN_name.up.sql has a NNNN_name.down.sql that
+// reverses it. Applied versions are recorded in schema_migrations, and each
+// migration is committed together with its record, so a migration that fails
+// leaves nothing behind. A Postgres advisory lock is held while migrating, so
+// replicas starting together apply each migration exactly once.
+
+//go:embed migrations/*.sql
+var migrationFiles embed.FS
+
+// migrationLockID is the pg_advisory_lock key held while migrating. It only
+// has to differ from other advisory locks taken on the same database.
+const migrationLockID int64 = 0x6f726465725f6d67 // "order_mg"
+
+// migrationFilePattern matches NNNN_name.up.sql and NNNN_name.down.sql.
+var migrationFilePattern = regexp.MustCompile(`^(\d+)_([a-z0-9_]+)\.(up|down)\.sql$`)
+
+// schemaMigrationsSQL creates the table applied versions are recorded in.
+const schemaMigrationsSQL = `CREATE TABLE IF NOT EXISTS schema_migrations (
+  version    bigint PRIMARY KEY,
+  name       text NOT NULL,
+  applied_at timestamptz NOT NULL DEFAULT now()
+)`
+
+// ErrUnknownMigration is returned when rolling back a version that is applied
+// to the database but not embedded in this binary.
+var ErrUnknownMigration = errors.New("applied migration not found in this binary")
+
+// Migration is one versioned schema change.
+type Migration struct {
+	Version int64
+	Name    string
+	Up      string
+	Down    string
+}
+
+// String formats the migration as its file name prefix, e.g. 0001_baseline.
+func (m Migration) String() string {
+	return fmt.Sprintf("%04d_%s", m.Version, m.Name)
+}
+
+// SchemaMigration represents the schema_migrations table.
+type SchemaMigration struct {
+	Version   int64     `gorm:"primaryKey;autoIncrement:false;column:version"`
+	Name      string    `gorm:"not null;column:name"`
+	AppliedAt time.Time `gorm:"not null;column:applied_at"`
+}
+
+// TableName specifies the table name for GORM.
+func (SchemaMigration) TableName() string {
+	return "schema_migrations"
+}
+
+// MigrationStatus is a migration and when it was applied, if it was. Unknown
+// is set for versions applied to the database that this binary does not have,
+// e.g. after rolling the service back to an older release.
+type MigrationStatus struct {
+	Version   int64
+	Name      string
+	AppliedAt *time.Time
+	Unknown   bool
+}
+
+// LoadMigrations reads the migrations in dir of fsys, ordered by version.
+// Every migration needs both an up and a down file.
+func LoadMigrations(fsys fs.FS, dir string) ([]Migration, error) {
+	entries, err := fs.ReadDir(fsys, dir)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read migrations: %w", err)
+	}
+
+	byVersion := make(map[int64]*Migration)
+	for _, entry := range entries {
+		match := migrationFilePattern.FindStringSubmatch(entry.Name())
+		if entry.IsDir() || match == nil {
+			return nil, fmt.Errorf("unexpected migration file %q: use NNNN_name.up.sql or NNNN_name.down.sql", entry.Name())
+		}
+		version, _ := strconv.ParseInt(match[1], 10, 64)
+		if version < 1 {
+			return nil, fmt.Errorf("migration %q: versions start at 1", entry.Name())
+		}
+
+		data, err := fs.ReadFile(fsys, path.Join(dir, entry.Name()))
+		if err != nil {
+			return nil, fmt.Errorf("failed to read migration %q: %w", entry.Name(), err)
+		}
+
+		migration, ok := byVersion[version]
+		if !ok {
+			migration = &Migration{Version: version, Name: match[2]}
+			byVersion[version] = migration
+		}
+		if migration.Name != match[2] {
+			return nil, fmt.Errorf("migration version %d is used by both %q and %q", version, migration.Name, match[2])
+		}
+		if match[3] == "up" {
+			migration.Up = string(data)
+		} else {
+			migration.Down = string(data)
+		}
+	}
+
+	migrations := make([]Migration, 0, len(byVersion))
+	for _, migration := range byVersion {
+		if migration.Up == "" || migration.Down == "" {
+			return nil, fmt.Errorf("migration %s needs both an up and a down file", migration)
+		}
+		migrations = append(migrations, *migration)
+	}
+	sort.Slice(migrations, func(i, j int) bool { return migrations[i].Version < migrations[j].Version })
+
+	return migrations, nil
+}
+
+// PlanUp returns the migrations not yet applied, oldest first, limited to
+// steps when steps > 0.
+func PlanUp(migrations []Migration, applied map[int64]bool, steps int) []Migration {
+	var plan []Migration
+	for _, migration := range migrations {
+		if applied[migration.Version] {
+			continue
+		}
+		if steps > 0 && len(plan) == steps {
+			break
+		}
+		plan = append(plan, migration)
+	}
+	return plan
+}
+
+// PlanDown returns the last steps applied migrations, newest first.
+func PlanDown(migrations []Migration, applied map[int64]bool, steps int) ([]Migration, error) {
+	known := make(map[int64]Migration, len(migrations))
+	for _, migration := range migrations {
+		known[migration.Version] = migration
+	}
+
+	versions := make([]int64, 0, len(applied))
+	for version, ok := range applied {
+		if ok {
+			versions = append(versions, version)
+		}
+	}
+	sort.Slice(versions, func(i, j int) bool { return versions[i] > versions[j] })
+
+	var plan []Migration
+	for _, version := range versions {
+		if len(plan) == steps {
+			break
+		}
+		migration, ok := known[version]
+		if !ok {
+			return nil, fmt.Errorf("%w: version %d", ErrUnknownMigration, version)
+		}
+		plan = append(plan, migration)
+	}
+	return plan, nil
+}
+
+// Migrator applies and rolls back the embedded migrations.
+type Migrator struct {
+	DB         *gorm.DB
+	Migrations []Migration
+	// BeforeUp runs under the lock before pending migrations are applied.
+	BeforeUp func(tx *gorm.DB) error
+}
+
+// NewMigrator creates a migrator for the embedded migrations. Amounts stored
+// as floats by older releases are converted before migrating up.
+func NewMigrator(database *gorm.DB) (*Migrator, error) {
+	migrations, err := LoadMigrations(migrationFiles, "migrations")
+	if err != nil {
+		return nil, err
+	}
+	return &Migrator{DB: database, Migrations: migrations, BeforeUp: MigrateMoneyColumns}, nil
+}
+
+// Up applies pending migrations in order, at most steps of them when steps >
+// 0, and returns those it applied.
+func (m *Migrator) Up(ctx context.Context, steps int) ([]Migration, error) {
+	var done []Migration
+	err := m.withLock(ctx, func(conn *gorm.DB) error {
+		if m.BeforeUp != nil {
+			if err := m.BeforeUp(conn); err != nil {
+				return err
+			}
+		}
+
+		applied, err := appliedMigrations(conn)
+		if err != nil {
+			return err
+		}
+
+		for _, migration := range PlanUp(m.Migrations, appliedVersions(applied), steps) {
+			err := conn.Transaction(func(tx *gorm.DB) error {
+				if err := tx.Exec(migration.Up).Error; err != nil {
+					return err
+				}
+				return tx.Create(&SchemaMigration{Version: migration.Version, Name: migration.Name, AppliedAt: time.Now().UTC()}).Error
+			})
+			if err != nil {
+				return fmt.Errorf("migration %s failed: %w", migration, err)
+			}
+			log.Printf("Applied migration %s", migration)
+			done = append(done, migration)
+		}
+		return nil
+	})
+	return done, err
+}
+
+// Down rolls back the last steps applied migrations, newest first, and returns
+// those it rolled back.
+func (m *Migrator) Down(ctx context.Context, steps int) ([]Migration, error) {
+	var done []Migration
+	err := m.withLock(ctx, func(conn *gorm.DB) error {
+		applied, err := appliedMigrations(conn)
+		if err != nil {
+			return err
+		}
+
+		plan, err := PlanDown(m.Migrations, appliedVersions(applied), steps)
+		if err != nil {
+			return err
+		}
+		for _, migration := range plan {
+			err := conn.Transaction(func(tx *gorm.DB) error {
+				if err := tx.Exec(migration.Down).Error; err != nil {
+					return err
+				}
+				return tx.Delete(&SchemaMigration{}, "version = ?", migration.Version).Error
+			})
+			if err != nil {
+				return fmt.Errorf("rolling back migration %s failed: %w", migration, err)
+			}
+			log.Printf("Rolled back migration %s", migration)
+			done = append(done, migration)
+		}
+		return nil
+	})
+	return done, err
+}
+
+// Status lists every embedded migration with when it was applied, followed
+// by any applied versions this binary does not have.
+func (m *Migrator) Status(ctx context.Context) ([]MigrationStatus, error) {
+	conn := m.DB.WithContext(ctx)
+	applied := map[int64]SchemaMigration{}
+	if conn.Migrator().HasTable(&SchemaMigration{}) {
+		var err error
+		if applied, err = appliedMigrations(conn); err != nil {
+			return nil, err
+		}
+	}
+
+	statuses := make([]MigrationStatus, 0, len(m.Migrations))
+	for _, migration := range m.Migrations {
+		status := MigrationStatus{Version: migration.Version, Name: migration.Name}
+		if record, ok := applied[migration.Version]; ok {
+			appliedAt := record.AppliedAt
+			status.AppliedAt = &appliedAt
+			delete(applied, migration.Version)
+		}
+		statuses = append(statuses, status)
+	}
+
+	var unknown []MigrationStatus
+	for _, record := range applied {
+		appliedAt := record.AppliedAt
+		unknown = append(unknown, MigrationStatus{Version: record.Version, Name: record.Name, AppliedAt: &appliedAt, Unknown: true})
+	}
+	sort.Slice(unknown, func(i, j int) bool { return unknown[i].Version < unknown[j].Version })
+
+	return append(statuses, unknown...), nil
+}
+
+// withLock runs fn on a single connection holding the migration lock, once
+// schema_migrations exists. Session advisory locks belong to a connection, so
+// the lock is taken and released on the one fn uses.
+func (m *Migrator) withLock(ctx context.Context, fn func(conn *gorm.DB) error) error {
+	return m.DB.WithContext(ctx).Connection(func(conn *gorm.DB) error {
+		if err := conn.Exec("SELECT pg_advisory_lock(?)", migrationLockID).Error; err != nil {
+			return fmt.Errorf("failed to take migration lock: %w", err)
+		}
+		defer func() {
+			// Unlock even if ctx is done, so the lock does not go back to
+			// the pool with the connection
+			if err := conn.WithContext(context.Background()).Exec("SELECT pg_advisory_unlock(?)", migrationLockID).Error; err != nil {
+				log.Printf("Failed to release migration lock: %v", err)
+			}
+		}()
+
+		if err := conn.Exec(schemaMigrationsSQL).Error; err != nil {
+			return fmt.Errorf("failed to create schema_migrations: %w", err)
+		}
+		return fn(conn)
+	})
+}
+
+// appliedMigrations loads schema_migrations by version.
+func appliedMigrations(conn *gorm.DB) (map[int64]SchemaMigration, error) {
+	var records []SchemaMigration
+	if err := conn.Order("version").Find(&records).Error; err != nil {
+		return nil, fmt.Errorf("failed to read schema_migrations: %w", err)
+	}
+
+	applied := make(map[int64]SchemaMigration, len(records))
+	for _, record := range records {
+		applied[record.Version] = record
+	}
+	return applied, nil
+}
+
+func appliedVersions(applied map[int64]SchemaMigration) map[int64]bool {
+	versions := make(map[int64]bool, len(applied))
+	for version := range applied {
+		versions[version] = true
+	}
+	return versions
+}
+
+// =============================================================================
+// migrate Subcommand
+// =============================================================================
+
+const migrateUsage = "usage: order_service migrate up [N] | down [N] | status"
+
+// isMigrateCommand reports whether the binary was started as
+// `order_service migrate ...`.
+func isMigrateCommand(args []string) bool {
+	return len(args) > 1 && args[1] == "migrate"
+}
+
+// ParseMigrateArgs parses the arguments after `migrate`. up applies every
+// pending migration unless given a count; down rolls back one unless given a
+// count.
+func ParseMigrateArgs(args []string) (action string, steps int, err error) {
+	if len(args) == 0 {
+		return "", 0, errors.New(migrateUsage)
+	}
+
+	action = args[0]
+	switch action {
+	case "up":
+		steps = 0
+	case "down":
+		steps = 1
+	case "status":
+		if len(args) > 1 {
+			return "", 0, errors.New(migrateUsage)
+		}
+		return action, 0, nil
+	default:
+		return "", 0, errors.New(migrateUsage)
+	}
+
+	switch len(args) {
+	case 1:
+	case 2:
+		steps, err = strconv.Atoi(args[1])
+		if err != nil || steps < 1 {
+			return "", 0, fmt.Errorf("migrate %s: N must be a positive integer", action)
+		}
+	default:
+		return "", 0, errors.New(migrateUsage)
+	}
+	return action, steps, nil
+}
+
+// RunMigrateCommand runs `migrate up|down|status` against the database and
+// reports to out.
+func RunMigrateCommand(ctx context.Context, database *gorm.DB, args []string, out io.Writer) error {
+	action, steps, err := ParseMigrateArgs(args)
+	if err != nil {
+		return err
+	}
+
+	migrator, err := NewMigrator(database)
+	if err != nil {
+		return err
+	}
+
+	switch action {
+	case "up":
+		done, err := migrator.Up(ctx, steps)
+		if err != nil {
+			return err
+		}
+		if len(done) == 0 {
+			fmt.Fprintln(out, "No pending migrations")
+		}
+		for _, migration := range done {
+			fmt.Fprintf(out, "Applied %s\n", migration)
+		}
+	case "down":
+		done, err := migrator.Down(ctx, steps)
+		if err != nil {
+			return err
+		}
+		if len(done) == 0 {
+			fmt.Fprintln(out, "No migrations to roll back")
+		}
+		for _, migration := range done {
+			fmt.Fprintf(out, "Rolled back %s\n", migration)
+		}
+	case "status":
+		statuses, err := migrator.Status(ctx)
+		if err != nil {
+			return err
+		}
+		WriteMigrationStatus(out, statuses)
+	}
+	return nil
+}
+
+// WriteMigrationStatus prints statuses as a table.
+func WriteMigrationStatus(out io.Writer, statuses []MigrationStatus) {
+	w := tabwriter.NewWriter(out, 0, 0, 2, ' ', 0)
+	fmt.Fprintln(w, "VERSION\tNAME\tAPPLIED")
+	for _, status := range statuses {
+		applied := "pending"
+		if status.AppliedAt != nil {
+			applied = status.AppliedAt.UTC().Format(time.RFC3339)
+		}
+		if status.Unknown {
+			applied += " (not in this binary)"
+		}
+		fmt.Fprintf(w, "%04d\t%s\t%s\n", status.Version, status.Name, applied)
+	}
+	w.Flush()
+}
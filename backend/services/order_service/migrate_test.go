@@ -0,0 +1,334 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"net/url"
+	"os"
+	"regexp"
+	"strings"
+	"sync"
+	"testing"
+	"testing/fstest"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"gorm.io/driver/postgres"
+	"gorm.io/gorm"
+	"gorm.io/gorm/schema"
+)
+
+// originalOrderModel is the orders table as the first releases auto-migrated
+// it, before checkouts, Money columns and addresses.
+type originalOrderModel struct {
+	OrderID    string    `gorm:"primaryKey;type:uuid;column:order_id"`
+	BuyerID    string    `gorm:"not null;column:buyer_id"`
+	SellerID   string    `gorm:"not null;column:seller_id"`
+	Items      string    `gorm:"type:jsonb;not null;column:items"`
+	Status     string    `gorm:"not null;default:pending;column:status"`
+	TotalPrice float64   `gorm:"not null;column:total_price"`
+	CreatedAt  time.Time `gorm:"autoCreateTime;column:created_at"`
+	UpdatedAt  time.Time `gorm:"autoUpdateTime;column:updated_at"`
+}
+
+func (originalOrderModel) TableName() string {
+	return "orders"
+}
+
+func TestEmbeddedMigrations(t *testing.T) {
+	migrations, err := LoadMigrations(migrationFiles, "migrations")
+	require.NoError(t, err)
+	require.NotEmpty(t, migrations)
+
+	for i, migration := range migrations {
+		assert.Equal(t, int64(i+1), migration.Version, "versions have no gaps")
+		assert.NotEmpty(t, strings.TrimSpace(migration.Up), migration.String())
+		assert.NotEmpty(t, strings.TrimSpace(migration.Down), migration.String())
+	}
+	assert.Equal(t, "0001_baseline", migrations[0].String())
+}
+
+// Every column of every model must be created by some migration, or GORM
+// queries fail at runtime now that the schema is no longer auto-migrated.
+func TestMigrationsCoverModels(t *testing.T) {
+	migrations, err := LoadMigrations(migrationFiles, "migrations")
+	require.NoError(t, err)
+	var all strings.Builder
+	for _, migration := range migrations {
+		all.WriteString(migration.Up)
+	}
+	sql := all.String()
+
+	models := []interface{}{
+		&CheckoutModel{}, &OrderModel{}, &OrderStatusHistory{}, &OutboxMessage{}, &IdempotencyRecord{},
+		&PaymentModel{}, &PaymentWebhookEvent{}, &CartItemModel{}, &CouponModel{}, &CouponRedemption{},
+		&AddressModel{}, &ShipmentModel{}, &ReturnModel{}, &ReturnStatusHistory{},
+		&WebhookSubscription{}, &WebhookDelivery{}, &OrderRefund{},
+	}
+	for _, model := range models {
+		s, err := schema.Parse(model, &sync.Map{}, schema.NamingStrategy{})
+		require.NoError(t, err)
+
+		create := regexp.MustCompile(`(?s)CREATE TABLE IF NOT EXISTS ` + s.Table + ` \((.*?)\n\);`).FindStringSubmatch(sql)
+		require.NotNil(t, create, "no migration creates %s", s.Table)
+		for _, column := range s.DBNames {
+			inCreate := regexp.MustCompile(`(?m)^\s+` + column + `\s`).MatchString(create[1])
+			added := strings.Contains(sql, "ALTER TABLE "+s.Table+" ADD COLUMN "+column+" ") ||
+				strings.Contains(sql, "ALTER TABLE "+s.Table+" ADD COLUMN IF NOT EXISTS "+column+" ")
+			assert.True(t, inCreate || added, "no migration creates %s.%s", s.Table, column)
+		}
+	}
+}
+
+// The baseline skips CREATE TABLE orders on a database that still has the
+// original table, so every later column must also be added on its own before
+// the indexes and foreign key that use it.
+func TestBaselineUpgradesOriginalOrders(t *testing.T) {
+	migrations, err := LoadMigrations(migrationFiles, "migrations")
+	require.NoError(t, err)
+	baseline := migrations[0].Up
+
+	original, err := schema.Parse(&originalOrderModel{}, &sync.Map{}, schema.NamingStrategy{})
+	require.NoError(t, err)
+	existing := map[string]bool{}
+	for _, column := range original.DBNames {
+		existing[column] = true
+	}
+
+	create := regexp.MustCompile(`(?s)CREATE TABLE IF NOT EXISTS orders \((.*?)\n\);`).FindStringSubmatchIndex(baseline)
+	require.NotNil(t, create)
+	body := baseline[create[2]:create[3]]
+	assert.NotContains(t, body, "FOREIGN KEY", "constraints in CREATE TABLE are skipped with it")
+
+	firstIndex := strings.Index(baseline, " ON orders ")
+	fk := strings.Index(baseline, "ADD CONSTRAINT fk_checkouts_orders")
+	require.Positive(t, firstIndex)
+	require.Positive(t, fk)
+
+	for _, match := range regexp.MustCompile(`(?m)^\s+([a-z_]+)\s`).FindAllStringSubmatch(body, -1) {
+		column := match[1]
+		if column == "PRIMARY" || existing[column] {
+			continue
+		}
+		added := strings.Index(baseline, "ALTER TABLE orders ADD COLUMN IF NOT EXISTS "+column+" ")
+		if assert.Positive(t, added, "orders.%s is not added to an existing table", column) {
+			assert.Less(t, added, firstIndex, "orders.%s is added after the indexes", column)
+			assert.Less(t, added, fk, "orders.%s is added after the foreign key", column)
+		}
+	}
+}
+
+// Runs the migrations against the original auto-migrated orders table. Needs
+// a Postgres database in TEST_DATABASE_URL; it works in a scratch schema.
+func TestMigratorUpgradesOriginalSchema(t *testing.T) {
+	dsn := os.Getenv("TEST_DATABASE_URL")
+	if dsn == "" {
+		t.Skip("TEST_DATABASE_URL not set")
+	}
+
+	admin, err := gorm.Open(postgres.Open(dsn), &gorm.Config{})
+	require.NoError(t, err)
+	schemaName := fmt.Sprintf("migrate_test_%d", time.Now().UnixNano())
+	require.NoError(t, admin.Exec("CREATE SCHEMA "+schemaName).Error)
+	t.Cleanup(func() { admin.Exec("DROP SCHEMA " + schemaName + " CASCADE") })
+
+	scoped, err := url.Parse(dsn)
+	require.NoError(t, err)
+	query := scoped.Query()
+	query.Set("search_path", schemaName)
+	scoped.RawQuery = query.Encode()
+	database, err := gorm.Open(postgres.Open(scoped.String()), &gorm.Config{})
+	require.NoError(t, err)
+
+	require.NoError(t, database.AutoMigrate(&originalOrderModel{}))
+	orderID := uuid.New().String()
+	require.NoError(t, database.Create(&originalOrderModel{
+		OrderID: orderID, BuyerID: "buyer-1", SellerID: "seller-1", Status: StatusPaid,
+		Items: `[{"productId":"prod-1","quantity":2,"price":12.5}]`, TotalPrice: 25,
+	}).Error)
+
+	migrator, err := NewMigrator(database)
+	require.NoError(t, err)
+	_, err = migrator.Up(context.Background(), 0)
+	require.NoError(t, err)
+
+	var order struct {
+		CheckoutID       *string
+		TotalPriceAmount int64
+		Version          int64
+	}
+	require.NoError(t, database.Raw(`SELECT checkout_id, total_price_amount, version FROM orders WHERE order_id = ?`, orderID).Scan(&order).Error)
+	assert.Nil(t, order.CheckoutID)
+	assert.Equal(t, int64(2500), order.TotalPriceAmount)
+	assert.Equal(t, int64(1), order.Version)
+
+	statuses, err := migrator.Status(context.Background())
+	require.NoError(t, err)
+	for _, status := range statuses {
+		assert.NotNil(t, status.AppliedAt, "%04d_%s", status.Version, status.Name)
+	}
+}
+
+func TestOrderStatusCheckMatchesStateMachine(t *testing.T) {
+	migrations, err := LoadMigrations(migrationFiles, "migrations")
+	require.NoError(t, err)
+	var check string
+	for _, migration := range migrations {
+		if migration.Name == "orders_status_check" {
+			check = migration.Up
+		}
+	}
+	require.NotEmpty(t, check)
+
+	for from, targets := range orderTransitions {
+		assert.Contains(t, check, "'"+from+"'")
+		for to := range targets {
+			assert.Contains(t, check, "'"+to+"'")
+		}
+	}
+}
+
+func TestOrderStatusNotifyMigration(t *testing.T) {
+	migrations, err := LoadMigrations(migrationFiles, "migrations")
+	require.NoError(t, err)
+	assert.Contains(t, migrations[1].Up, "pg_notify('"+orderStatusChannel+"'", "the trigger notifies the channel the listener LISTENs on")
+}
+
+func TestLoadMigrationsErrors(t *testing.T) {
+	file := func(sql string) *fstest.MapFile { return &fstest.MapFile{Data: []byte(sql)} }
+
+	tests := []struct {
+		name  string
+		files fstest.MapFS
+	}{
+		{name: "missing_down", files: fstest.MapFS{"m/0001_init.up.sql": file("SELECT 1")}},
+		{name: "missing_up", files: fstest.MapFS{"m/0001_init.down.sql": file("SELECT 1")}},
+		{name: "bad_name", files: fstest.MapFS{"m/init.up.sql": file("SELECT 1")}},
+		{name: "version_zero", files: fstest.MapFS{"m/0000_init.up.sql": file("SELECT 1"), "m/0000_init.down.sql": file("SELECT 1")}},
+		{name: "duplicate_version", files: fstest.MapFS{
+			"m/0001_init.up.sql": file("SELECT 1"), "m/0001_init.down.sql": file("SELECT 1"),
+			"m/0001_other.up.sql": file("SELECT 1"), "m/0001_other.down.sql": file("SELECT 1"),
+		}},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			_, err := LoadMigrations(tt.files, "m")
+			assert.Error(t, err)
+		})
+	}
+}
+
+func TestLoadMigrationsOrdersByVersion(t *testing.T) {
+	files := fstest.MapFS{
+		"m/0010_ten.up.sql":   {Data: []byte("SELECT 10")},
+		"m/0010_ten.down.sql": {Data: []byte("SELECT -10")},
+		"m/0002_two.up.sql":   {Data: []byte("SELECT 2")},
+		"m/0002_two.down.sql": {Data: []byte("SELECT -2")},
+	}
+
+	migrations, err := LoadMigrations(files, "m")
+	require.NoError(t, err)
+	require.Len(t, migrations, 2)
+	assert.Equal(t, Migration{Version: 2, Name: "two", Up: "SELECT 2", Down: "SELECT -2"}, migrations[0])
+	assert.Equal(t, "0010_ten", migrations[1].String())
+}
+
+func TestPlanUp(t *testing.T) {
+	migrations := []Migration{{Version: 1}, {Version: 2}, {Version: 3}, {Version: 4}}
+
+	versions := func(plan []Migration) []int64 {
+		var v []int64
+		for _, m := range plan {
+			v = append(v, m.Version)
+		}
+		return v
+	}
+
+	assert.Equal(t, []int64{1, 2, 3, 4}, versions(PlanUp(migrations, nil, 0)))
+	assert.Equal(t, []int64{3, 4}, versions(PlanUp(migrations, map[int64]bool{1: true, 2: true}, 0)))
+	assert.Equal(t, []int64{2, 4}, versions(PlanUp(migrations, map[int64]bool{1: true, 3: true}, 0)), "a skipped version is still applied")
+	assert.Equal(t, []int64{3}, versions(PlanUp(migrations, map[int64]bool{1: true, 2: true}, 1)))
+	assert.Empty(t, PlanUp(migrations, map[int64]bool{1: true, 2: true, 3: true, 4: true}, 0))
+}
+
+func TestPlanDown(t *testing.T) {
+	migrations := []Migration{{Version: 1}, {Version: 2}, {Version: 3}}
+
+	plan, err := PlanDown(migrations, map[int64]bool{1: true, 2: true}, 1)
+	require.NoError(t, err)
+	require.Len(t, plan, 1)
+	assert.Equal(t, int64(2), plan[0].Version)
+
+	plan, err = PlanDown(migrations, map[int64]bool{1: true, 2: true}, 5)
+	require.NoError(t, err)
+	require.Len(t, plan, 2)
+	assert.Equal(t, int64(1), plan[1].Version, "newest first")
+
+	plan, err = PlanDown(migrations, nil, 1)
+	require.NoError(t, err)
+	assert.Empty(t, plan)
+
+	_, err = PlanDown(migrations, map[int64]bool{1: true, 7: true}, 1)
+	assert.ErrorIs(t, err, ErrUnknownMigration)
+}
+
+func TestParseMigrateArgs(t *testing.T) {
+	tests := []struct {
+		args   []string
+		action string
+		steps  int
+		valid  bool
+	}{
+		{args: []string{"up"}, action: "up", steps: 0, valid: true},
+		{args: []string{"up", "2"}, action: "up", steps: 2, valid: true},
+		{args: []string{"down"}, action: "down", steps: 1, valid: true},
+		{args: []string{"down", "3"}, action: "down", steps: 3, valid: true},
+		{args: []string{"status"}, action: "status", valid: true},
+		{args: nil},
+		{args: []string{"redo"}},
+		{args: []string{"down", "0"}},
+		{args: []string{"down", "all"}},
+		{args: []string{"up", "1", "2"}},
+		{args: []string{"status", "1"}},
+	}
+
+	for _, tt := range tests {
+		t.Run(strings.Join(tt.args, "_"), func(t *testing.T) {
+			action, steps, err := ParseMigrateArgs(tt.args)
+			if !tt.valid {
+				assert.Error(t, err)
+				return
+			}
+			require.NoError(t, err)
+			assert.Equal(t, tt.action, action)
+			assert.Equal(t, tt.steps, steps)
+		})
+	}
+}
+
+func TestIsMigrateCommand(t *testing.T) {
+	assert.True(t, isMigrateCommand([]string{"./order_service", "migrate", "up"}))
+	assert.False(t, isMigrateCommand([]string{"./order_service"}))
+	assert.False(t, isMigrateCommand([]string{"./order_service", "-test.v"}))
+}
+
+func TestWriteMigrationStatus(t *testing.T) {
+	appliedAt := time.Date(2026, 3, 1, 12, 0, 0, 0, time.UTC)
+	var out bytes.Buffer
+	WriteMigrationStatus(&out, []MigrationStatus{
+		{Version: 1, Name: "baseline", AppliedAt: &appliedAt},
+		{Version: 2, Name: "order_status_notify"},
+		{Version: 9, Name: "future", AppliedAt: &appliedAt, Unknown: true},
+	})
+
+	lines := strings.Split(strings.TrimSpace(out.String()), "\n")
+	require.Len(t, lines, 4)
+	assert.Regexp(t, `^VERSION\s+NAME\s+APPLIED$`, lines[0])
+	assert.Regexp(t, `^0001\s+baseline\s+2026-03-01T12:00:00Z$`, lines[1])
+	assert.Regexp(t, `^0002\s+order_status_notify\s+pending$`, lines[2])
+	assert.Regexp(t, `^0009\s+future\s+2026-03-01T12:00:00Z \(not in this binary\)$`, lines[3])
+}
@@ -0,0 +1,16 @@
+DROP TABLE IF EXISTS webhook_deliveries;
+DROP TABLE IF EXISTS seller_webhooks;
+DROP TABLE IF EXISTS return_status_history;
+DROP TABLE IF EXISTS returns;
+DROP TABLE IF EXISTS shipments;
+DROP TABLE IF EXISTS addresses;
+DROP TABLE IF EXISTS coupon_redemptions;
+DROP TABLE IF EXISTS coupons;
+DROP TABLE IF EXISTS cart_items;
+DROP TABLE IF EXISTS payment_webhook_events;
+DROP TABLE IF EXISTS payments;
+DROP TABLE IF EXISTS idempotency_keys;
+DROP TABLE IF EXISTS outbox;
+DROP TABLE IF EXISTS order_status_history;
+DROP TABLE IF EXISTS orders;
+DROP TABLE IF EXISTS checkouts;
@@ -0,0 +1,281 @@
+-- Schema as last created by GORM AutoMigrate. Every statement is IF NOT EXISTS
+-- so a database that AutoMigrate set up adopts this version unchanged. The
+-- first releases only auto-migrated orders, so its later columns are added
+-- separately for databases that still have that table.
+
+CREATE TABLE IF NOT EXISTS checkouts (
+  checkout_id          uuid,
+  buyer_id             text NOT NULL,
+  subtotal_amount      bigint NOT NULL DEFAULT 0,
+  subtotal_currency    varchar(3) NOT NULL DEFAULT '',
+  coupon_code          text,
+  discount_amount      bigint NOT NULL DEFAULT 0,
+  discount_currency    varchar(3) NOT NULL DEFAULT '',
+  shipping_amount      bigint NOT NULL DEFAULT 0,
+  shipping_currency    varchar(3) NOT NULL DEFAULT '',
+  tax_amount           bigint NOT NULL DEFAULT 0,
+  tax_currency         varchar(3) NOT NULL DEFAULT '',
+  total_price_amount   bigint NOT NULL DEFAULT 0,
+  total_price_currency varchar(3) NOT NULL DEFAULT '',
+  created_at           timestamptz,
+  updated_at           timestamptz,
+  PRIMARY KEY (checkout_id)
+);
+CREATE INDEX IF NOT EXISTS idx_checkouts_buyer_id ON checkouts (buyer_id);
+
+CREATE TABLE IF NOT EXISTS orders (
+  order_id             uuid,
+  checkout_id          uuid,
+  buyer_id             text NOT NULL,
+  seller_id            text NOT NULL,
+  items                jsonb NOT NULL,
+  status               text NOT NULL DEFAULT 'pending',
+  subtotal_amount      bigint NOT NULL DEFAULT 0,
+  subtotal_currency    varchar(3) NOT NULL DEFAULT '',
+  discount_amount      bigint NOT NULL DEFAULT 0,
+  discount_currency    varchar(3) NOT NULL DEFAULT '',
+  shipping_amount      bigint NOT NULL DEFAULT 0,
+  shipping_currency    varchar(3) NOT NULL DEFAULT '',
+  tax_amount           bigint NOT NULL DEFAULT 0,
+  tax_currency         varchar(3) NOT NULL DEFAULT '',
+  total_price_amount   bigint NOT NULL DEFAULT 0,
+  total_price_currency varchar(3) NOT NULL DEFAULT '',
+  shipping_address     jsonb,
+  created_at           timestamptz,
+  updated_at           timestamptz,
+  PRIMARY KEY (order_id)
+);
+ALTER TABLE orders ADD COLUMN IF NOT EXISTS checkout_id uuid;
+ALTER TABLE orders ADD COLUMN IF NOT EXISTS subtotal_amount bigint NOT NULL DEFAULT 0;
+ALTER TABLE orders ADD COLUMN IF NOT EXISTS subtotal_currency varchar(3) NOT NULL DEFAULT '';
+ALTER TABLE orders ADD COLUMN IF NOT EXISTS discount_amount bigint NOT NULL DEFAULT 0;
+ALTER TABLE orders ADD COLUMN IF NOT EXISTS discount_currency varchar(3) NOT NULL DEFAULT '';
+ALTER TABLE orders ADD COLUMN IF NOT EXISTS shipping_amount bigint NOT NULL DEFAULT 0;
+ALTER TABLE orders ADD COLUMN IF NOT EXISTS shipping_currency varchar(3) NOT NULL DEFAULT '';
+ALTER TABLE orders ADD COLUMN IF NOT EXISTS tax_amount bigint NOT NULL DEFAULT 0;
+ALTER TABLE orders ADD COLUMN IF NOT EXISTS tax_currency varchar(3) NOT NULL DEFAULT '';
+ALTER TABLE orders ADD COLUMN IF NOT EXISTS total_price_amount bigint NOT NULL DEFAULT 0;
+ALTER TABLE orders ADD COLUMN IF NOT EXISTS total_price_currency varchar(3) NOT NULL DEFAULT '';
+ALTER TABLE orders ADD COLUMN IF NOT EXISTS shipping_address jsonb;
+DO $$
+BEGIN
+  IF NOT EXISTS (SELECT 1 FROM pg_constraint WHERE conname = 'fk_checkouts_orders' AND conrelid = 'orders'::regclass) THEN
+    ALTER TABLE orders ADD CONSTRAINT fk_checkouts_orders
+      FOREIGN KEY (checkout_id) REFERENCES checkouts (checkout_id);
+  END IF;
+END
+$$;
+CREATE INDEX IF NOT EXISTS idx_orders_status_created ON orders (status, created_at);
+CREATE INDEX IF NOT EXISTS idx_orders_checkout_id ON orders (checkout_id);
+CREATE INDEX IF NOT EXISTS idx_orders_seller_created ON orders (seller_id, created_at, order_id);
+CREATE INDEX IF NOT EXISTS idx_orders_buyer_created ON orders (buyer_id, created_at, order_id);
+
+CREATE TABLE IF NOT EXISTS order_status_history (
+  history_id  uuid,
+  order_id    uuid NOT NULL,
+  from_status text,
+  to_status   text NOT NULL,
+  actor_id    text NOT NULL,
+  actor_role  text NOT NULL,
+  reason      text,
+  created_at  timestamptz,
+  PRIMARY KEY (history_id)
+);
+CREATE INDEX IF NOT EXISTS idx_order_status_history_order_id ON order_status_history (order_id);
+
+CREATE TABLE IF NOT EXISTS outbox (
+  message_id      uuid,
+  detail_type     text NOT NULL,
+  detail          jsonb NOT NULL,
+  status          text NOT NULL DEFAULT 'pending',
+  attempts        bigint NOT NULL DEFAULT 0,
+  next_attempt_at timestamptz NOT NULL,
+  last_error      text,
+  sent_at         timestamptz,
+  created_at      timestamptz,
+  PRIMARY KEY (message_id)
+);
+CREATE INDEX IF NOT EXISTS idx_outbox_pending ON outbox (status, next_attempt_at);
+
+CREATE TABLE IF NOT EXISTS idempotency_keys (
+  buyer_id        text,
+  idempotency_key text,
+  request_hash    text NOT NULL,
+  status_code     bigint NOT NULL,
+  response        jsonb NOT NULL,
+  created_at      timestamptz,
+  expires_at      timestamptz NOT NULL,
+  PRIMARY KEY (buyer_id, idempotency_key)
+);
+CREATE INDEX IF NOT EXISTS idx_idempotency_keys_expires_at ON idempotency_keys (expires_at);
+
+CREATE TABLE IF NOT EXISTS payments (
+  payment_id    uuid,
+  reference     text NOT NULL,
+  buyer_id      text NOT NULL,
+  provider      text NOT NULL,
+  intent_id     text NOT NULL,
+  client_secret text,
+  amount        bigint NOT NULL DEFAULT 0,
+  currency      varchar(3) NOT NULL DEFAULT '',
+  status        text NOT NULL DEFAULT 'pending',
+  created_at    timestamptz,
+  updated_at    timestamptz,
+  PRIMARY KEY (payment_id)
+);
+CREATE UNIQUE INDEX IF NOT EXISTS idx_payments_intent_id ON payments (intent_id);
+CREATE INDEX IF NOT EXISTS idx_payments_reference ON payments (reference);
+
+CREATE TABLE IF NOT EXISTS payment_webhook_events (
+  event_id    text,
+  type        text NOT NULL,
+  intent_id   text,
+  received_at timestamptz,
+  PRIMARY KEY (event_id)
+);
+
+CREATE TABLE IF NOT EXISTS cart_items (
+  buyer_id   text,
+  product_id text,
+  quantity   bigint NOT NULL,
+  created_at timestamptz,
+  updated_at timestamptz,
+  PRIMARY KEY (buyer_id, product_id)
+);
+
+CREATE TABLE IF NOT EXISTS coupons (
+  code            text,
+  seller_id       text NOT NULL,
+  type            text NOT NULL,
+  value           decimal NOT NULL DEFAULT 0,
+  amount_amount   bigint NOT NULL DEFAULT 0,
+  amount_currency varchar(3) NOT NULL DEFAULT '',
+  buy_quantity    bigint NOT NULL DEFAULT 0,
+  get_quantity    bigint NOT NULL DEFAULT 0,
+  product_ids     jsonb NOT NULL DEFAULT '[]',
+  usage_limit     bigint NOT NULL DEFAULT 0,
+  per_buyer_limit bigint NOT NULL DEFAULT 0,
+  used_count      bigint NOT NULL DEFAULT 0,
+  starts_at       timestamptz,
+  ends_at         timestamptz,
+  active          boolean NOT NULL DEFAULT true,
+  created_at      timestamptz,
+  updated_at      timestamptz,
+  PRIMARY KEY (code)
+);
+CREATE INDEX IF NOT EXISTS idx_coupons_seller_id ON coupons (seller_id);
+
+CREATE TABLE IF NOT EXISTS coupon_redemptions (
+  redemption_id     uuid,
+  code              text NOT NULL,
+  buyer_id          text NOT NULL,
+  checkout_id       uuid NOT NULL,
+  discount_amount   bigint NOT NULL DEFAULT 0,
+  discount_currency varchar(3) NOT NULL DEFAULT '',
+  created_at        timestamptz,
+  PRIMARY KEY (redemption_id)
+);
+CREATE UNIQUE INDEX IF NOT EXISTS idx_coupon_redemptions_checkout_id ON coupon_redemptions (checkout_id);
+CREATE INDEX IF NOT EXISTS idx_redemptions_code_buyer ON coupon_redemptions (code, buyer_id);
+
+CREATE TABLE IF NOT EXISTS addresses (
+  address_id uuid,
+  buyer_id   text NOT NULL,
+  label      text,
+  address    jsonb NOT NULL,
+  is_default boolean NOT NULL DEFAULT false,
+  created_at timestamptz,
+  updated_at timestamptz,
+  PRIMARY KEY (address_id)
+);
+CREATE UNIQUE INDEX IF NOT EXISTS idx_addresses_buyer_default ON addresses (buyer_id) WHERE is_default;
+CREATE INDEX IF NOT EXISTS idx_addresses_buyer_id ON addresses (buyer_id);
+
+CREATE TABLE IF NOT EXISTS shipments (
+  shipment_id     uuid,
+  order_id        uuid NOT NULL,
+  seller_id       text NOT NULL,
+  carrier         text NOT NULL,
+  tracking_number text NOT NULL,
+  items           jsonb NOT NULL,
+  status          text NOT NULL DEFAULT 'created',
+  last_checked_at timestamptz,
+  delivered_at    timestamptz,
+  created_at      timestamptz,
+  updated_at      timestamptz,
+  PRIMARY KEY (shipment_id)
+);
+CREATE INDEX IF NOT EXISTS idx_shipments_status_checked ON shipments (status, last_checked_at);
+CREATE UNIQUE INDEX IF NOT EXISTS idx_shipments_carrier_tracking ON shipments (carrier, tracking_number) WHERE tracking_number <> '';
+CREATE INDEX IF NOT EXISTS idx_shipments_order_id ON shipments (order_id);
+
+CREATE TABLE IF NOT EXISTS returns (
+  return_id       uuid,
+  order_id        uuid NOT NULL,
+  buyer_id        text NOT NULL,
+  seller_id       text NOT NULL,
+  product_id      text NOT NULL,
+  quantity        bigint NOT NULL,
+  reason          text NOT NULL,
+  status          text NOT NULL DEFAULT 'requested',
+  restock         boolean NOT NULL DEFAULT false,
+  refund_amount   bigint NOT NULL DEFAULT 0,
+  refund_currency varchar(3) NOT NULL DEFAULT '',
+  refund_id       text,
+  created_at      timestamptz,
+  updated_at      timestamptz,
+  PRIMARY KEY (return_id)
+);
+CREATE INDEX IF NOT EXISTS idx_returns_seller_created ON returns (seller_id, created_at);
+CREATE INDEX IF NOT EXISTS idx_returns_buyer_created ON returns (buyer_id, created_at);
+CREATE INDEX IF NOT EXISTS idx_returns_order_id ON returns (order_id);
+
+CREATE TABLE IF NOT EXISTS return_status_history (
+  history_id  uuid,
+  return_id   uuid NOT NULL,
+  from_status text,
+  to_status   text NOT NULL,
+  actor_id    text NOT NULL,
+  actor_role  text NOT NULL,
+  reason      text,
+  created_at  timestamptz,
+  PRIMARY KEY (history_id)
+);
+CREATE INDEX IF NOT EXISTS idx_return_status_history_return_id ON return_status_history (return_id);
+
+CREATE TABLE IF NOT EXISTS seller_webhooks (
+  webhook_id           uuid,
+  seller_id            text NOT NULL,
+  url                  text NOT NULL,
+  secret               text NOT NULL,
+  event_types          jsonb NOT NULL DEFAULT '[]',
+  active               boolean NOT NULL DEFAULT true,
+  disabled_reason      text,
+  disabled_at          timestamptz,
+  consecutive_failures bigint NOT NULL DEFAULT 0,
+  created_at           timestamptz,
+  updated_at           timestamptz,
+  PRIMARY KEY (webhook_id)
+);
+CREATE INDEX IF NOT EXISTS idx_seller_webhooks_seller_id ON seller_webhooks (seller_id);
+
+CREATE TABLE IF NOT EXISTS webhook_deliveries (
+  delivery_id      uuid,
+  webhook_id       uuid NOT NULL,
+  event_id         uuid NOT NULL,
+  event_type       text NOT NULL,
+  payload          jsonb NOT NULL,
+  status           text NOT NULL DEFAULT 'pending',
+  attempts         bigint NOT NULL DEFAULT 0,
+  next_attempt_at  timestamptz NOT NULL,
+  last_status_code bigint,
+  last_error       text,
+  last_response    text,
+  delivered_at     timestamptz,
+  created_at       timestamptz,
+  updated_at       timestamptz,
+  PRIMARY KEY (delivery_id)
+);
+CREATE INDEX IF NOT EXISTS idx_webhook_deliveries_due ON webhook_deliveries (status, next_attempt_at);
+CREATE INDEX IF NOT EXISTS idx_webhook_deliveries_webhook_created ON webhook_deliveries (webhook_id, created_at);
+CREATE UNIQUE INDEX IF NOT EXISTS idx_webhook_deliveries_event ON webhook_deliveries (webhook_id, event_id);
@@ -0,0 +1,29 @@
+-- NOTIFY order_status_changed for every status history row (see stream.go).
+-- The payload is kept under Postgres' 8000 byte NOTIFY limit by cutting the
+-- reason to 500 characters.
+
+CREATE OR REPLACE FUNCTION notify_order_status_changed() RETURNS trigger AS $$
+DECLARE
+  o orders%ROWTYPE;
+BEGIN
+  SELECT * INTO o FROM orders WHERE order_id = NEW.order_id;
+  PERFORM pg_notify('order_status_changed', json_build_object(
+    'historyId', NEW.history_id,
+    'orderId', NEW.order_id,
+    'checkoutId', o.checkout_id,
+    'buyerId', o.buyer_id,
+    'sellerId', o.seller_id,
+    'fromStatus', NEW.from_status,
+    'toStatus', NEW.to_status,
+    'actorRole', NEW.actor_role,
+    'reason', left(NEW.reason, 500),
+    'createdAt', NEW.created_at
+  )::text);
+  RETURN NEW;
+END;
+$$ LANGUAGE plpgsql;
+
+DROP TRIGGER IF EXISTS order_status_history_notify ON order_status_history;
+CREATE TRIGGER order_status_history_notify
+  AFTER INSERT ON order_status_history
+  FOR EACH ROW EXECUTE FUNCTION notify_order_status_changed();
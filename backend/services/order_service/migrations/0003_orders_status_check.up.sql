@@ -0,0 +1,7 @@
+-- Only the statuses of the order state machine (lifecycle.go). Adding the
+-- constraint checks the existing rows, so it fails if any order has another
+-- status.
+
+ALTER TABLE orders ADD CONSTRAINT orders_status_check CHECK (
+  status IN ('pending', 'paid', 'partially_shipped', 'shipped', 'delivered', 'cancelled', 'expired')
+);
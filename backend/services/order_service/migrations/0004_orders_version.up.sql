@@ -0,0 +1,5 @@
+-- Optimistic concurrency for orders: every status change bumps the version
+-- (see TransitionOrder) and clients send it back in If-Match. Existing orders
+-- start at version 1.
+
+ALTER TABLE orders ADD COLUMN IF NOT EXISTS version bigint NOT NULL DEFAULT 1;
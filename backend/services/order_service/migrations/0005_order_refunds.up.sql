@@ -0,0 +1,23 @@
+-- Refunds of cancelled paid orders, queued in the cancelling transaction and
+-- paid out by the refund worker (see refunds.go).
+
+CREATE TABLE IF NOT EXISTS order_refunds (
+  refund_id          uuid,
+  order_id           uuid NOT NULL,
+  payment_id         uuid NOT NULL,
+  intent_id          text NOT NULL,
+  amount             bigint NOT NULL DEFAULT 0,
+  currency           varchar(3) NOT NULL DEFAULT '',
+  reason             text,
+  status             text NOT NULL DEFAULT 'pending',
+  attempts           bigint NOT NULL DEFAULT 0,
+  next_attempt_at    timestamptz NOT NULL,
+  last_error         text,
+  provider_refund_id text,
+  refunded_at        timestamptz,
+  created_at         timestamptz,
+  updated_at         timestamptz,
+  PRIMARY KEY (refund_id)
+);
+CREATE UNIQUE INDEX IF NOT EXISTS idx_order_refunds_order_payment ON order_refunds (order_id, payment_id);
+CREATE INDEX IF NOT EXISTS idx_order_refunds_due ON order_refunds (status, next_attempt_at);
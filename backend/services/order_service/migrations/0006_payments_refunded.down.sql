@@ -0,0 +1,3 @@
+UPDATE payments SET status = 'refunded' WHERE status = 'partially_refunded';
+ALTER TABLE payments DROP COLUMN IF EXISTS refunded_currency;
+ALTER TABLE payments DROP COLUMN IF EXISTS refunded_amount;
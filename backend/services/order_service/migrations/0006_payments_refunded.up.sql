@@ -0,0 +1,7 @@
+-- How much of each payment has been refunded, from the provider's
+-- charge.refunded events. Payments already marked refunded were assumed to be
+-- refunded in full.
+
+ALTER TABLE payments ADD COLUMN IF NOT EXISTS refunded_amount bigint NOT NULL DEFAULT 0;
+ALTER TABLE payments ADD COLUMN IF NOT EXISTS refunded_currency varchar(3) NOT NULL DEFAULT '';
+UPDATE payments SET refunded_amount = amount, refunded_currency = currency WHERE status = 'refunded';
@@ -0,0 +1,350 @@
+package main
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"math"
+	"regexp"
+	"strconv"
+	"strings"
+
+	"gorm.io/gorm"
+)
+
+// =============================================================================
+// Money
+// =============================================================================
+
+// Money is an exact amount: Amount minor units (cents) of the ISO 4217
+// Currency. Models embed it with a column prefix, so TotalPrice is stored as
+// total_price_amount and total_price_currency. In JSON it is written as
+//
+//	{"amount": 1799700, "currency": "LKR"}
+//
+// which is also the shape of ProductService's Money GraphQL scalar.
+type Money struct {
+	Amount   int64  `gorm:"not null;default:0" json:"amount"`
+	Currency string `gorm:"size:3;not null;default:''" json:"currency"`
+}
+
+// ErrCurrencyMismatch is returned when amounts in different currencies are
+// combined.
+var ErrCurrencyMismatch = errors.New("currency mismatch")
+
+// currencyExponents lists the currencies whose minor unit is not a hundredth.
+var currencyExponents = map[string]int{
+	"BHD": 3, "JOD": 3, "KWD": 3, "OMR": 3, "TND": 3,
+	"JPY": 0, "KRW": 0, "VND": 0, "CLP": 0, "ISK": 0,
+}
+
+var currencyPattern = regexp.MustCompile(`^[A-Z]{3}$`)
+
+// CurrencyExponent returns the number of minor-unit digits of currency.
+func CurrencyExponent(currency string) int {
+	if exp, ok := currencyExponents[currency]; ok {
+		return exp
+	}
+	return 2
+}
+
+// NormalizeCurrency upper-cases an ISO 4217 code, defaulting to
+// defaultCurrency when empty.
+func NormalizeCurrency(currency string) (string, error) {
+	currency = strings.ToUpper(strings.TrimSpace(currency))
+	if currency == "" {
+		return defaultCurrency, nil
+	}
+	if !currencyPattern.MatchString(currency) {
+		return "", fmt.Errorf("invalid currency %q", currency)
+	}
+	return currency, nil
+}
+
+// ParseMoney parses a decimal amount in major units, such as "17997.5",
+// without going through float64. More fraction digits than the currency has
+// are rejected.
+func ParseMoney(decimal, currency string) (Money, error) {
+	currency, err := NormalizeCurrency(currency)
+	if err != nil {
+		return Money{}, err
+	}
+	exp := CurrencyExponent(currency)
+
+	s := strings.TrimSpace(decimal)
+	negative := strings.HasPrefix(s, "-")
+	s = strings.TrimPrefix(s, "-")
+
+	whole, fraction, _ := strings.Cut(s, ".")
+	if whole == "" {
+		whole = "0"
+	}
+	if len(fraction) > exp {
+		if strings.Trim(fraction[exp:], "0") != "" {
+			return Money{}, fmt.Errorf("amount %q has more than %d decimal places for %s", decimal, exp, currency)
+		}
+		fraction = fraction[:exp]
+	}
+	fraction += strings.Repeat("0", exp-len(fraction))
+
+	digits := whole + fraction
+	for _, r := range digits {
+		if r < '0' || r > '9' {
+			return Money{}, fmt.Errorf("invalid amount %q", decimal)
+		}
+	}
+
+	amount, err := strconv.ParseInt(digits, 10, 64)
+	if err != nil {
+		return Money{}, fmt.Errorf("invalid amount %q", decimal)
+	}
+	if negative {
+		amount = -amount
+	}
+	return Money{Amount: amount, Currency: currency}, nil
+}
+
+// IsZero reports whether the amount is zero, so `omitzero` JSON fields are
+// left out when nothing was charged or discounted.
+func (m Money) IsZero() bool {
+	return m.Amount == 0
+}
+
+// Add returns m + other. A Money with no currency (the zero value) takes the
+// other operand's currency, so totals can start from Money{}.
+func (m Money) Add(other Money) (Money, error) {
+	currency, err := commonCurrency(m, other)
+	if err != nil {
+		return Money{}, err
+	}
+	return Money{Amount: m.Amount + other.Amount, Currency: currency}, nil
+}
+
+// Sub returns m - other.
+func (m Money) Sub(other Money) (Money, error) {
+	return m.Add(Money{Amount: -other.Amount, Currency: other.Currency})
+}
+
+// Times returns m multiplied by a quantity.
+func (m Money) Times(quantity int) Money {
+	return Money{Amount: m.Amount * int64(quantity), Currency: m.Currency}
+}
+
+// Scale returns m * numerator / denominator, rounded half away from zero to
+// the minor unit.
+func (m Money) Scale(numerator, denominator int64) Money {
+	product := m.Amount * numerator
+	half := denominator / 2
+	if product < 0 {
+		half = -half
+	}
+	return Money{Amount: (product + half) / denominator, Currency: m.Currency}
+}
+
+// Decimal formats the amount in major units, e.g. "17997.00".
+func (m Money) Decimal() string {
+	exp := CurrencyExponent(m.Currency)
+	sign := ""
+	amount := m.Amount
+	if amount < 0 {
+		sign = "-"
+		amount = -amount
+	}
+	if exp == 0 {
+		return sign + strconv.FormatInt(amount, 10)
+	}
+
+	unit := int64(math.Pow10(exp))
+	return fmt.Sprintf("%s%d.%0*d", sign, amount/unit, exp, amount%unit)
+}
+
+// String formats the amount with its currency, e.g. "LKR 17997.00".
+func (m Money) String() string {
+	return m.Currency + " " + m.Decimal()
+}
+
+// UnmarshalJSON accepts the object form, or a plain decimal number in major
+// units of defaultCurrency as clients and stored items used before amounts had
+// a currency.
+func (m *Money) UnmarshalJSON(data []byte) error {
+	if string(data) == "null" {
+		return nil
+	}
+
+	var number json.Number
+	if err := json.Unmarshal(data, &number); err == nil {
+		parsed, err := ParseMoney(number.String(), "")
+		if err != nil {
+			return err
+		}
+		*m = parsed
+		return nil
+	}
+
+	var object struct {
+		Amount   int64  `json:"amount"`
+		Currency string `json:"currency"`
+	}
+	if err := json.Unmarshal(data, &object); err != nil {
+		return fmt.Errorf("money must be an object or a number: %w", err)
+	}
+	currency, err := NormalizeCurrency(object.Currency)
+	if err != nil {
+		return err
+	}
+	*m = Money{Amount: object.Amount, Currency: currency}
+	return nil
+}
+
+// commonCurrency returns the currency two amounts share.
+func commonCurrency(a, b Money) (string, error) {
+	switch {
+	case a.Currency == "":
+		return b.Currency, nil
+	case b.Currency == "" || a.Currency == b.Currency:
+		return a.Currency, nil
+	default:
+		return "", fmt.Errorf("%w: %s and %s", ErrCurrencyMismatch, a.Currency, b.Currency)
+	}
+}
+
+// =============================================================================
+// Money Migration
+// =============================================================================
+
+// legacyMoneyColumn is a float column, in major units of defaultCurrency, that
+// was replaced by an embedded Money with the given column prefix.
+type legacyMoneyColumn struct {
+	Table  string
+	Column string
+	Prefix string
+}
+
+// legacyMoneyColumns lists every amount that used to be stored as a float.
+var legacyMoneyColumns = []legacyMoneyColumn{
+	{Table: "orders", Column: "subtotal", Prefix: "subtotal_"},
+	{Table: "orders", Column: "discount", Prefix: "discount_"},
+	{Table: "orders", Column: "shipping", Prefix: "shipping_"},
+	{Table: "orders", Column: "tax", Prefix: "tax_"},
+	{Table: "orders", Column: "total_price", Prefix: "total_price_"},
+	{Table: "checkouts", Column: "subtotal", Prefix: "subtotal_"},
+	{Table: "checkouts", Column: "discount", Prefix: "discount_"},
+	{Table: "checkouts", Column: "shipping", Prefix: "shipping_"},
+	{Table: "checkouts", Column: "tax", Prefix: "tax_"},
+	{Table: "checkouts", Column: "total_price", Prefix: "total_price_"},
+	{Table: "coupon_redemptions", Column: "discount", Prefix: "discount_"},
+	{Table: "payments", Column: "amount", Prefix: ""},
+}
+
+// MigrateMoneyColumns converts amounts stored as floats to Money columns.
+// Migrator.Up runs it before applying migrations, so the baseline finds the
+// Money columns in place. Each step checks the current schema, so running it
+// again is a no-op.
+func MigrateMoneyColumns(database *gorm.DB) error {
+	exp := CurrencyExponent(defaultCurrency)
+	scale := strconv.FormatInt(int64(math.Pow10(exp)), 10)
+
+	return database.Transaction(func(tx *gorm.DB) error {
+		for _, col := range legacyMoneyColumns {
+			legacy, err := isFloatColumn(tx, col.Table, col.Column)
+			if err != nil {
+				return err
+			}
+			if !legacy {
+				continue
+			}
+
+			amount, currency := col.Prefix+"amount", col.Prefix+"currency"
+			var steps []string
+			if amount == col.Column {
+				// payments.amount keeps its name and changes type in place
+				steps = []string{
+					fmt.Sprintf(`ALTER TABLE %s ALTER COLUMN %s TYPE bigint USING round(%s * %s)`, col.Table, amount, amount, scale),
+					fmt.Sprintf(`ALTER TABLE %s ADD COLUMN IF NOT EXISTS %s varchar(3) NOT NULL DEFAULT ''`, col.Table, currency),
+					fmt.Sprintf(`UPDATE %s SET %s = upper(%s)`, col.Table, currency, currency),
+				}
+			} else {
+				steps = []string{
+					fmt.Sprintf(`ALTER TABLE %s ADD COLUMN IF NOT EXISTS %s bigint NOT NULL DEFAULT 0`, col.Table, amount),
+					fmt.Sprintf(`ALTER TABLE %s ADD COLUMN IF NOT EXISTS %s varchar(3) NOT NULL DEFAULT ''`, col.Table, currency),
+					fmt.Sprintf(`UPDATE %s SET %s = round(%s * %s), %s = '%s'`, col.Table, amount, col.Column, scale, currency, defaultCurrency),
+					fmt.Sprintf(`ALTER TABLE %s DROP COLUMN %s`, col.Table, col.Column),
+				}
+			}
+			for _, step := range steps {
+				if err := tx.Exec(step).Error; err != nil {
+					return fmt.Errorf("failed to migrate %s.%s: %w", col.Table, col.Column, err)
+				}
+			}
+		}
+
+		// Fixed coupons kept their amount in value
+		legacyCoupons, err := isFloatColumn(tx, "coupons", "value")
+		if err != nil {
+			return err
+		}
+		hasAmount, err := columnExists(tx, "coupons", "amount_amount")
+		if err != nil {
+			return err
+		}
+		if legacyCoupons && !hasAmount {
+			steps := []string{
+				`ALTER TABLE coupons ADD COLUMN amount_amount bigint NOT NULL DEFAULT 0`,
+				`ALTER TABLE coupons ADD COLUMN amount_currency varchar(3) NOT NULL DEFAULT ''`,
+				fmt.Sprintf(`UPDATE coupons SET amount_amount = round(value * %s), amount_currency = '%s', value = 0 WHERE type = '%s'`, scale, defaultCurrency, CouponFixed),
+			}
+			for _, step := range steps {
+				if err := tx.Exec(step).Error; err != nil {
+					return fmt.Errorf("failed to migrate fixed coupon amounts: %w", err)
+				}
+			}
+		}
+
+		// Order items kept price, discount and lineTotal as JSON numbers
+		if ok, err := columnExists(tx, "orders", "items"); err != nil || !ok {
+			return err
+		}
+		err = tx.Exec(fmt.Sprintf(`
+			UPDATE orders SET items = (
+				SELECT jsonb_agg(item || jsonb_build_object(
+					'price', jsonb_build_object('amount', round(COALESCE((item->>'price')::numeric, 0) * %[1]s), 'currency', '%[2]s'),
+					'discount', jsonb_build_object('amount', round(COALESCE((item->>'discount')::numeric, 0) * %[1]s), 'currency', '%[2]s'),
+					'lineTotal', jsonb_build_object('amount', round(COALESCE((item->>'lineTotal')::numeric, 0) * %[1]s), 'currency', '%[2]s')
+				) ORDER BY ordinality)
+				FROM jsonb_array_elements(items) WITH ORDINALITY AS elements(item, ordinality)
+			)
+			WHERE jsonb_typeof(items->0->'price') = 'number'`, scale, defaultCurrency)).Error
+		if err != nil {
+			return fmt.Errorf("failed to migrate order items: %w", err)
+		}
+
+		return nil
+	})
+}
+
+// isFloatColumn reports whether table.column exists and holds floating point
+// or numeric values.
+func isFloatColumn(tx *gorm.DB, table, column string) (bool, error) {
+	var dataType string
+	err := tx.Raw(`SELECT data_type FROM information_schema.columns
+		WHERE table_schema = current_schema() AND table_name = ? AND column_name = ?`, table, column).Scan(&dataType).Error
+	if err != nil {
+		return false, fmt.Errorf("failed to inspect %s.%s: %w", table, column, err)
+	}
+	switch dataType {
+	case "double precision", "real", "numeric":
+		return true, nil
+	}
+	return false, nil
+}
+
+// columnExists reports whether table.column exists.
+func columnExists(tx *gorm.DB, table, column string) (bool, error) {
+	var count int64
+	err := tx.Raw(`SELECT count(*) FROM information_schema.columns
+		WHERE table_schema = current_schema() AND table_name = ? AND column_name = ?`, table, column).Scan(&count).Error
+	if err != nil {
+		return false, fmt.Errorf("failed to inspect %s.%s: %w", table, column, err)
+	}
+	return count > 0, nil
+}
@@ -0,0 +1,95 @@
+package main
+
+import (
+	"encoding/json"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestParseMoney(t *testing.T) {
+	tests := []struct {
+		decimal  string
+		currency string
+		want     Money
+		wantErr  bool
+	}{
+		{"17997", "LKR", Money{Amount: 1799700, Currency: "LKR"}, false},
+		{"359.94", "lkr", Money{Amount: 35994, Currency: "LKR"}, false},
+		{".5", "", Money{Amount: 50, Currency: "LKR"}, false},
+		{"1500", "JPY", Money{Amount: 1500, Currency: "JPY"}, false},
+		{"1.250", "KWD", Money{Amount: 1250, Currency: "KWD"}, false},
+		{"0.999", "LKR", Money{}, true},
+		{"1e3", "LKR", Money{}, true},
+		{"10", "Rs", Money{}, true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.decimal+"_"+tt.currency, func(t *testing.T) {
+			got, err := ParseMoney(tt.decimal, tt.currency)
+			if tt.wantErr {
+				assert.Error(t, err)
+				return
+			}
+			require.NoError(t, err)
+			assert.Equal(t, tt.want, got)
+		})
+	}
+}
+
+func TestMoneyArithmetic(t *testing.T) {
+	price := Money{Amount: 1999, Currency: "LKR"}
+
+	sum, err := Money{}.Add(price)
+	require.NoError(t, err)
+	assert.Equal(t, price, sum, "the zero value takes the other currency")
+
+	diff, err := price.Sub(Money{Amount: 499, Currency: "LKR"})
+	require.NoError(t, err)
+	assert.Equal(t, Money{Amount: 1500, Currency: "LKR"}, diff)
+
+	_, err = price.Add(Money{Amount: 1, Currency: "USD"})
+	assert.ErrorIs(t, err, ErrCurrencyMismatch)
+
+	assert.Equal(t, Money{Amount: 5997, Currency: "LKR"}, price.Times(3))
+
+	// 18% of 19.99 is 3.5982; of -19.99, -3.5982
+	assert.Equal(t, Money{Amount: 360, Currency: "LKR"}, price.Scale(1800, 10000))
+	assert.Equal(t, Money{Amount: -360, Currency: "LKR"}, Money{Amount: -1999, Currency: "LKR"}.Scale(1800, 10000))
+	assert.Equal(t, Money{Amount: 1, Currency: "LKR"}, Money{Amount: 1, Currency: "LKR"}.Scale(1, 2), "halves round away from zero")
+}
+
+func TestMoneyFormatting(t *testing.T) {
+	assert.Equal(t, "17997.00", Money{Amount: 1799700, Currency: "LKR"}.Decimal())
+	assert.Equal(t, "-0.05", Money{Amount: -5, Currency: "LKR"}.Decimal())
+	assert.Equal(t, "1500", Money{Amount: 1500, Currency: "JPY"}.Decimal())
+	assert.Equal(t, "1.250", Money{Amount: 1250, Currency: "KWD"}.Decimal())
+	assert.Equal(t, "LKR 359.94", Money{Amount: 35994, Currency: "LKR"}.String())
+}
+
+func TestMoneyJSON(t *testing.T) {
+	data, err := json.Marshal(Money{Amount: 35994, Currency: "LKR"})
+	require.NoError(t, err)
+	assert.JSONEq(t, `{"amount":35994,"currency":"LKR"}`, string(data))
+
+	var m Money
+	require.NoError(t, json.Unmarshal([]byte(`{"amount":2500,"currency":"usd"}`), &m))
+	assert.Equal(t, Money{Amount: 2500, Currency: "USD"}, m)
+
+	require.NoError(t, json.Unmarshal([]byte(`{"amount":2500}`), &m))
+	assert.Equal(t, Money{Amount: 2500, Currency: "LKR"}, m)
+
+	// Plain numbers are major units, as order items were stored before
+	require.NoError(t, json.Unmarshal([]byte(`17997.5`), &m))
+	assert.Equal(t, Money{Amount: 1799750, Currency: "LKR"}, m)
+
+	assert.Error(t, json.Unmarshal([]byte(`{"amount":10.5,"currency":"LKR"}`), &m), "object amounts are minor units")
+	assert.Error(t, json.Unmarshal([]byte(`"LKR 10"`), &m))
+
+	var line OrderItem
+	require.NoError(t, json.Unmarshal([]byte(`{"productId":"p1","quantity":2,"price":17997,"lineTotal":35994}`), &line))
+	assert.Equal(t, lkr(17997), line.Price)
+	assert.Equal(t, lkr(35994), line.LineTotal)
+	assert.Zero(t, line.Discount)
+}
@@ -0,0 +1,323 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"log"
+	"time"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/service/eventbridge"
+	"github.com/aws/aws-sdk-go-v2/service/eventbridge/types"
+	"github.com/google/uuid"
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+)
+
+// =============================================================================
+// Transactional Outbox
+// =============================================================================
+
+// Outbox message statuses.
+const (
+	OutboxPending = "pending"
+	OutboxSent    = "sent"
+	OutboxFailed  = "failed"
+)
+
+// OutboxMessage represents the outbox table in PostgreSQL. Events are written
+// here in the same transaction as the order change that produced them and
+// published to EventBridge afterwards by the OutboxRelay.
+type OutboxMessage struct {
+	MessageID     string     `gorm:"primaryKey;type:uuid;column:message_id" json:"messageId"`
+	DetailType    string     `gorm:"not null;column:detail_type" json:"detailType"`
+	Detail        string     `gorm:"type:jsonb;not null;column:detail" json:"detail"`
+	Status        string     `gorm:"not null;default:pending;index:idx_outbox_pending,priority:1;column:status" json:"status"` // pending, sent, failed
+	Attempts      int        `gorm:"not null;default:0;column:attempts" json:"attempts"`
+	NextAttemptAt time.Time  `gorm:"not null;index:idx_outbox_pending,priority:2;column:next_attempt_at" json:"nextAttemptAt"`
+	LastError     string     `gorm:"column:last_error" json:"lastError,omitempty"`
+	SentAt        *time.Time `gorm:"column:sent_at" json:"sentAt,omitempty"`
+	CreatedAt     time.Time  `gorm:"autoCreateTime;column:created_at" json:"createdAt"`
+}
+
+// TableName specifies the table name for GORM.
+func (OutboxMessage) TableName() string {
+	return "outbox"
+}
+
+// EnqueueEvent writes an event to the outbox using the given transaction,
+// along with a delivery for each seller webhook subscribed to it.
+func EnqueueEvent(tx *gorm.DB, detailType string, detail interface{}) error {
+	detailBytes, err := json.Marshal(detail)
+	if err != nil {
+		return fmt.Errorf("failed to marshal event detail: %w", err)
+	}
+
+	msg := OutboxMessage{
+		MessageID:     uuid.New().String(),
+		DetailType:    detailType,
+		Detail:        string(detailBytes),
+		Status:        OutboxPending,
+		NextAttemptAt: time.Now().UTC(),
+	}
+
+	if err := tx.Create(&msg).Error; err != nil {
+		return fmt.Errorf("failed to write outbox message: %w", err)
+	}
+
+	return EnqueueWebhookDeliveries(tx, msg)
+}
+
+// EnqueueOrderPlacedEvent queues an "order-placed" event for the given order,
+// including the snapshotted line items.
+func EnqueueOrderPlacedEvent(tx *gorm.DB, order OrderModel) error {
+	return EnqueueEvent(tx, "order-placed", map[string]interface{}{
+		"orderId":    order.OrderID,
+		"checkoutId": order.CheckoutID,
+		"userId":     order.BuyerID,
+		"sellerId":   order.SellerID,
+		"items":      order.Items,
+		"total":      order.TotalPrice,
+	})
+}
+
+// EnqueueOrderPaidEvent queues an "order-paid" event for the given order so
+// the stock reserved for it at checkout is committed.
+func EnqueueOrderPaidEvent(tx *gorm.DB, order OrderModel) error {
+	return EnqueueEvent(tx, "order-paid", map[string]interface{}{
+		"orderId":    order.OrderID,
+		"checkoutId": order.CheckoutID,
+		"userId":     order.BuyerID,
+		"sellerId":   order.SellerID,
+		"items":      order.Items,
+		"total":      order.TotalPrice,
+	})
+}
+
+// EnqueueOrderCancelledEvent queues an "order-cancelled" event carrying the
+// order's line items so consumers can restore stock.
+func EnqueueOrderCancelledEvent(tx *gorm.DB, order OrderModel, cancelledBy, reason string) error {
+	return EnqueueEvent(tx, "order-cancelled", map[string]interface{}{
+		"orderId":     order.OrderID,
+		"checkoutId":  order.CheckoutID,
+		"userId":      order.BuyerID,
+		"sellerId":    order.SellerID,
+		"items":       order.Items,
+		"total":       order.TotalPrice,
+		"cancelledBy": cancelledBy,
+		"reason":      reason,
+	})
+}
+
+// EnqueueOrderExpiredEvent queues an "order-expired" event for an order that
+// was never paid, carrying its line items so consumers can restore stock.
+func EnqueueOrderExpiredEvent(tx *gorm.DB, order OrderModel, reason string) error {
+	return EnqueueEvent(tx, "order-expired", map[string]interface{}{
+		"orderId":    order.OrderID,
+		"checkoutId": order.CheckoutID,
+		"userId":     order.BuyerID,
+		"sellerId":   order.SellerID,
+		"items":      order.Items,
+		"total":      order.TotalPrice,
+		"reason":     reason,
+	})
+}
+
+// fulfilmentEventTypes are the events queued as a paid order moves through
+// shipping and delivery.
+var fulfilmentEventTypes = map[string]string{
+	StatusPartiallyShipped: "order-partially-shipped",
+	StatusShipped:          "order-shipped",
+	StatusDelivered:        "order-delivered",
+}
+
+// EnqueueOrderFulfilmentEvent queues an "order-partially-shipped",
+// "order-shipped" or "order-delivered" event for an order that just moved to
+// that status. Nothing on the bus consumes them yet; sellers receive them
+// through webhooks.
+func EnqueueOrderFulfilmentEvent(tx *gorm.DB, order OrderModel, reason string) error {
+	detailType, ok := fulfilmentEventTypes[order.Status]
+	if !ok {
+		return fmt.Errorf("no fulfilment event for status %s", order.Status)
+	}
+	return EnqueueEvent(tx, detailType, map[string]interface{}{
+		"orderId":    order.OrderID,
+		"checkoutId": order.CheckoutID,
+		"userId":     order.BuyerID,
+		"sellerId":   order.SellerID,
+		"status":     order.Status,
+		"reason":     reason,
+	})
+}
+
+// EnqueueReturnRestockedEvent queues a "return-restocked" event for a received
+// return whose units the seller put back in stock. The return ID lets
+// consumers apply it once.
+func EnqueueReturnRestockedEvent(tx *gorm.DB, ret ReturnModel) error {
+	return EnqueueEvent(tx, "return-restocked", map[string]interface{}{
+		"returnId":  ret.ReturnID,
+		"orderId":   ret.OrderID,
+		"userId":    ret.BuyerID,
+		"sellerId":  ret.SellerID,
+		"productId": ret.ProductID,
+		"quantity":  ret.Quantity,
+	})
+}
+
+// EventPublisher delivers a single event to the event bus.
+type EventPublisher interface {
+	Publish(ctx context.Context, detailType string, detail string) error
+}
+
+// EventBridgePublisher publishes events to an EventBridge bus.
+type EventBridgePublisher struct {
+	Client *eventbridge.Client
+	BusArn string
+	Source string
+}
+
+// Publish sends the event with PutEvents and treats a failed entry as an error.
+func (p *EventBridgePublisher) Publish(ctx context.Context, detailType string, detail string) error {
+	entry := types.PutEventsRequestEntry{
+		Source:       aws.String(p.Source),
+		DetailType:   aws.String(detailType),
+		Detail:       aws.String(detail),
+		EventBusName: aws.String(p.BusArn),
+	}
+
+	out, err := p.Client.PutEvents(ctx, &eventbridge.PutEventsInput{
+		Entries: []types.PutEventsRequestEntry{entry},
+	})
+	if err != nil {
+		return fmt.Errorf("failed to put event: %w", err)
+	}
+
+	if out.FailedEntryCount > 0 && len(out.Entries) > 0 {
+		return fmt.Errorf("event rejected: %s: %s",
+			aws.ToString(out.Entries[0].ErrorCode), aws.ToString(out.Entries[0].ErrorMessage))
+	}
+
+	return nil
+}
+
+// OutboxRelay polls the outbox and publishes pending messages, retrying
+// failures with exponential backoff. Rows are claimed with SKIP LOCKED so
+// several replicas can run a relay at the same time.
+type OutboxRelay struct {
+	DB           *gorm.DB
+	Publisher    EventPublisher
+	BatchSize    int
+	PollInterval time.Duration
+	MaxAttempts  int
+	BaseBackoff  time.Duration
+	MaxBackoff   time.Duration
+}
+
+// NewOutboxRelay creates a relay with default batching and retry settings.
+func NewOutboxRelay(database *gorm.DB, publisher EventPublisher) *OutboxRelay {
+	return &OutboxRelay{
+		DB:           database,
+		Publisher:    publisher,
+		BatchSize:    50,
+		PollInterval: 2 * time.Second,
+		MaxAttempts:  10,
+		BaseBackoff:  1 * time.Second,
+		MaxBackoff:   5 * time.Minute,
+	}
+}
+
+// Run polls the outbox until the context is cancelled.
+func (r *OutboxRelay) Run(ctx context.Context) {
+	log.Println("📤 Outbox relay started")
+
+	ticker := time.NewTicker(r.PollInterval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ctx.Done():
+			log.Println("Outbox relay stopped")
+			return
+		case <-ticker.C:
+			if _, err := r.ProcessBatch(ctx); err != nil {
+				log.Printf("Outbox relay error: %v", err)
+			}
+		}
+	}
+}
+
+// ProcessBatch claims up to BatchSize due messages, publishes them and saves
+// the outcome. It returns the number of messages published successfully.
+func (r *OutboxRelay) ProcessBatch(ctx context.Context) (int, error) {
+	sent := 0
+
+	err := r.DB.WithContext(ctx).Transaction(func(tx *gorm.DB) error {
+		var messages []OutboxMessage
+		err := tx.Clauses(clause.Locking{Strength: "UPDATE", Options: "SKIP LOCKED"}).
+			Where("status = ? AND next_attempt_at <= ?", OutboxPending, time.Now().UTC()).
+			Order("created_at ASC").
+			Limit(r.BatchSize).
+			Find(&messages).Error
+		if err != nil {
+			return fmt.Errorf("failed to load outbox messages: %w", err)
+		}
+
+		for i := range messages {
+			if r.Deliver(ctx, &messages[i], time.Now().UTC()) {
+				sent++
+			}
+
+			if err := tx.Save(&messages[i]).Error; err != nil {
+				return fmt.Errorf("failed to update outbox message: %w", err)
+			}
+		}
+
+		return nil
+	})
+
+	return sent, err
+}
+
+// Deliver publishes a single message and updates its status, attempt count and
+// next attempt time in place. It reports whether the message was sent.
+func (r *OutboxRelay) Deliver(ctx context.Context, msg *OutboxMessage, now time.Time) bool {
+	msg.Attempts++
+
+	if err := r.Publisher.Publish(ctx, msg.DetailType, msg.Detail); err != nil {
+		msg.LastError = err.Error()
+		if msg.Attempts >= r.MaxAttempts {
+			msg.Status = OutboxFailed
+			log.Printf("❌ Outbox message %s (%s) failed permanently after %d attempts: %v",
+				msg.MessageID, msg.DetailType, msg.Attempts, err)
+		} else {
+			msg.NextAttemptAt = now.Add(r.Backoff(msg.Attempts))
+		}
+		return false
+	}
+
+	msg.Status = OutboxSent
+	msg.LastError = ""
+	msg.SentAt = &now
+	log.Printf("✅ EventBridge event fired: %s (outbox message %s)", msg.DetailType, msg.MessageID)
+	return true
+}
+
+// Backoff returns the delay before the next attempt, doubling from BaseBackoff
+// and capped at MaxBackoff.
+func (r *OutboxRelay) Backoff(attempts int) time.Duration {
+	return exponentialBackoff(r.BaseBackoff, r.MaxBackoff, attempts)
+}
+
+// exponentialBackoff returns base doubled for every attempt after the first,
+// capped at max.
+func exponentialBackoff(base, max time.Duration, attempts int) time.Duration {
+	delay := base
+	for i := 1; i < attempts; i++ {
+		delay *= 2
+		if delay >= max {
+			return max
+		}
+	}
+	return delay
+}
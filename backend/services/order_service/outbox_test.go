@@ -0,0 +1,117 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+// memoryPublisher is an in-memory EventPublisher that records published events
+// and can be told to fail.
+type memoryPublisher struct {
+	mu        sync.Mutex
+	published []string
+	err       error
+}
+
+func (p *memoryPublisher) Publish(ctx context.Context, detailType string, detail string) error {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	if p.err != nil {
+		return p.err
+	}
+	p.published = append(p.published, detailType)
+	return nil
+}
+
+func TestOutboxRelayDeliver(t *testing.T) {
+	now := time.Date(2026, 2, 7, 10, 0, 0, 0, time.UTC)
+
+	tests := []struct {
+		name             string
+		publishErr       error
+		priorAttempts    int
+		expectedSent     bool
+		expectedStatus   string
+		expectedAttempts int
+		expectedNext     time.Time
+	}{
+		{
+			name:             "publish_succeeds",
+			expectedSent:     true,
+			expectedStatus:   OutboxSent,
+			expectedAttempts: 1,
+		},
+		{
+			name:             "first_failure_schedules_retry",
+			publishErr:       errors.New("throttled"),
+			expectedStatus:   OutboxPending,
+			expectedAttempts: 1,
+			expectedNext:     now.Add(1 * time.Second),
+		},
+		{
+			name:             "third_failure_backs_off",
+			publishErr:       errors.New("throttled"),
+			priorAttempts:    2,
+			expectedStatus:   OutboxPending,
+			expectedAttempts: 3,
+			expectedNext:     now.Add(4 * time.Second),
+		},
+		{
+			name:             "last_attempt_marks_failed",
+			publishErr:       errors.New("throttled"),
+			priorAttempts:    9,
+			expectedStatus:   OutboxFailed,
+			expectedAttempts: 10,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			publisher := &memoryPublisher{err: tt.publishErr}
+			relay := NewOutboxRelay(nil, publisher)
+			msg := &OutboxMessage{
+				MessageID:  "msg-1",
+				DetailType: "order-placed",
+				Detail:     `{"orderId":"order-1"}`,
+				Status:     OutboxPending,
+				Attempts:   tt.priorAttempts,
+			}
+
+			sent := relay.Deliver(context.Background(), msg, now)
+
+			assert.Equal(t, tt.expectedSent, sent)
+			assert.Equal(t, tt.expectedStatus, msg.Status)
+			assert.Equal(t, tt.expectedAttempts, msg.Attempts)
+			if tt.expectedSent {
+				assert.Equal(t, []string{"order-placed"}, publisher.published)
+				assert.NotNil(t, msg.SentAt)
+				assert.Empty(t, msg.LastError)
+			} else {
+				assert.Empty(t, publisher.published)
+				assert.Equal(t, "throttled", msg.LastError)
+			}
+			if !tt.expectedNext.IsZero() {
+				assert.Equal(t, tt.expectedNext, msg.NextAttemptAt)
+			}
+		})
+	}
+}
+
+func TestOutboxRelayBackoff(t *testing.T) {
+	relay := NewOutboxRelay(nil, &memoryPublisher{})
+
+	assert.Equal(t, 1*time.Second, relay.Backoff(1))
+	assert.Equal(t, 2*time.Second, relay.Backoff(2))
+	assert.Equal(t, 8*time.Second, relay.Backoff(4))
+	assert.Equal(t, relay.MaxBackoff, relay.Backoff(20))
+}
+
+func TestOutboxTableName(t *testing.T) {
+	msg := OutboxMessage{}
+	assert.Equal(t, "outbox", msg.TableName())
+}
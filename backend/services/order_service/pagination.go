@@ -0,0 +1,209 @@
+package main
+
+import (
+	"encoding/base64"
+	"encoding/json"
+	"fmt"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"gorm.io/gorm"
+)
+
+// =============================================================================
+// Order Listing (cursor pagination, filters, sorting)
+// =============================================================================
+
+const (
+	defaultOrderPageSize = 20
+	maxOrderPageSize     = 100
+)
+
+// OrderCursor is the keyset position of the last order on a page. Pages are
+// ordered by (created_at, order_id), so the pair uniquely identifies a row.
+type OrderCursor struct {
+	CreatedAt time.Time `json:"createdAt"`
+	OrderID   string    `json:"orderId"`
+}
+
+// OrderListParams holds the parsed query parameters for listing orders.
+type OrderListParams struct {
+	Limit       int
+	Cursor      *OrderCursor
+	Statuses    []string
+	CreatedFrom *time.Time
+	CreatedTo   *time.Time
+	Descending  bool
+}
+
+// OrderPage is the response envelope for a page of orders.
+type OrderPage struct {
+	Orders     []OrderModel `json:"orders"`
+	NextCursor string       `json:"nextCursor,omitempty"`
+}
+
+// EncodeOrderCursor encodes a cursor as an opaque URL-safe string.
+func EncodeOrderCursor(cursor OrderCursor) string {
+	data, _ := json.Marshal(cursor)
+	return base64.RawURLEncoding.EncodeToString(data)
+}
+
+// DecodeOrderCursor decodes a cursor produced by EncodeOrderCursor.
+func DecodeOrderCursor(s string) (*OrderCursor, error) {
+	data, err := base64.RawURLEncoding.DecodeString(s)
+	if err != nil {
+		return nil, fmt.Errorf("invalid cursor")
+	}
+
+	var cursor OrderCursor
+	if err := json.Unmarshal(data, &cursor); err != nil || cursor.OrderID == "" || cursor.CreatedAt.IsZero() {
+		return nil, fmt.Errorf("invalid cursor")
+	}
+
+	return &cursor, nil
+}
+
+// parseTimeParam accepts either an RFC3339 timestamp or a YYYY-MM-DD date.
+// A bare date used as an upper bound covers the whole day.
+func parseTimeParam(value string, endOfDay bool) (*time.Time, error) {
+	if t, err := time.Parse(time.RFC3339, value); err == nil {
+		return &t, nil
+	}
+
+	t, err := time.Parse("2006-01-02", value)
+	if err != nil {
+		return nil, fmt.Errorf("invalid date %q: use RFC3339 or YYYY-MM-DD", value)
+	}
+	if endOfDay {
+		t = t.AddDate(0, 0, 1)
+	}
+	return &t, nil
+}
+
+// ParseOrderListParams reads limit, cursor, status, from, to and sort from the
+// query string.
+func ParseOrderListParams(c *gin.Context) (OrderListParams, error) {
+	params := OrderListParams{
+		Limit:      defaultOrderPageSize,
+		Descending: true,
+	}
+
+	if limit := c.Query("limit"); limit != "" {
+		n, err := strconv.Atoi(limit)
+		if err != nil || n < 1 {
+			return params, fmt.Errorf("limit must be a positive integer")
+		}
+		if n > maxOrderPageSize {
+			n = maxOrderPageSize
+		}
+		params.Limit = n
+	}
+
+	if cursor := c.Query("cursor"); cursor != "" {
+		decoded, err := DecodeOrderCursor(cursor)
+		if err != nil {
+			return params, err
+		}
+		params.Cursor = decoded
+	}
+
+	if err := parseOrderFilters(c, &params); err != nil {
+		return params, err
+	}
+
+	switch strings.ToLower(c.DefaultQuery("sort", "desc")) {
+	case "desc":
+		params.Descending = true
+	case "asc":
+		params.Descending = false
+	default:
+		return params, fmt.Errorf("sort must be asc or desc")
+	}
+
+	return params, nil
+}
+
+// parseOrderFilters reads the status, from and to filters shared by order
+// listing and export.
+func parseOrderFilters(c *gin.Context, params *OrderListParams) error {
+	if status := c.Query("status"); status != "" {
+		for _, s := range strings.Split(status, ",") {
+			if s = strings.TrimSpace(s); s != "" {
+				params.Statuses = append(params.Statuses, s)
+			}
+		}
+	}
+
+	if from := c.Query("from"); from != "" {
+		t, err := parseTimeParam(from, false)
+		if err != nil {
+			return err
+		}
+		params.CreatedFrom = t
+	}
+
+	if to := c.Query("to"); to != "" {
+		t, err := parseTimeParam(to, true)
+		if err != nil {
+			return err
+		}
+		params.CreatedTo = t
+	}
+
+	return nil
+}
+
+// applyOrderFilters adds the status and creation time filters to an orders
+// query.
+func applyOrderFilters(q *gorm.DB, params OrderListParams) *gorm.DB {
+	if len(params.Statuses) > 0 {
+		q = q.Where("status IN ?", params.Statuses)
+	}
+	if params.CreatedFrom != nil {
+		q = q.Where("created_at >= ?", *params.CreatedFrom)
+	}
+	if params.CreatedTo != nil {
+		q = q.Where("created_at < ?", *params.CreatedTo)
+	}
+	return q
+}
+
+// ApplyOrderListParams adds filters, keyset pagination and ordering to an
+// orders query. It fetches one row more than the limit so the caller can tell
+// whether another page exists.
+func ApplyOrderListParams(q *gorm.DB, params OrderListParams) *gorm.DB {
+	q = applyOrderFilters(q, params)
+
+	direction := "ASC"
+	comparison := ">"
+	if params.Descending {
+		direction = "DESC"
+		comparison = "<"
+	}
+
+	if params.Cursor != nil {
+		q = q.Where(fmt.Sprintf("(created_at, order_id) %s (?, ?)", comparison),
+			params.Cursor.CreatedAt, params.Cursor.OrderID)
+	}
+
+	return q.Order("created_at " + direction).Order("order_id " + direction).Limit(params.Limit + 1)
+}
+
+// BuildOrderPage trims the extra row fetched by ApplyOrderListParams and sets
+// the cursor for the next page.
+func BuildOrderPage(orders []OrderModel, limit int) OrderPage {
+	if orders == nil {
+		orders = []OrderModel{}
+	}
+
+	page := OrderPage{Orders: orders}
+	if len(orders) > limit {
+		page.Orders = orders[:limit]
+		last := page.Orders[limit-1]
+		page.NextCursor = EncodeOrderCursor(OrderCursor{CreatedAt: last.CreatedAt, OrderID: last.OrderID})
+	}
+
+	return page
+}
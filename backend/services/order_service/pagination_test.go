@@ -0,0 +1,170 @@
+package main
+
+import (
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/stretchr/testify/assert"
+	"gorm.io/driver/postgres"
+	"gorm.io/gorm"
+)
+
+// dryRunDB returns a GORM handle that builds SQL without a database connection.
+func dryRunDB(t *testing.T) *gorm.DB {
+	t.Helper()
+	d, err := gorm.Open(postgres.New(postgres.Config{DSN: "host=localhost dbname=test"}), &gorm.Config{
+		DryRun:               true,
+		DisableAutomaticPing: true,
+	})
+	assert.NoError(t, err)
+	return d
+}
+
+func TestOrderCursorRoundTrip(t *testing.T) {
+	cursor := OrderCursor{
+		CreatedAt: time.Date(2026, 2, 7, 10, 30, 0, 123456000, time.UTC),
+		OrderID:   "order-1",
+	}
+
+	decoded, err := DecodeOrderCursor(EncodeOrderCursor(cursor))
+	assert.NoError(t, err)
+	assert.True(t, cursor.CreatedAt.Equal(decoded.CreatedAt))
+	assert.Equal(t, cursor.OrderID, decoded.OrderID)
+
+	_, err = DecodeOrderCursor("not-a-cursor!")
+	assert.Error(t, err)
+
+	_, err = DecodeOrderCursor(EncodeOrderCursor(OrderCursor{}))
+	assert.Error(t, err)
+}
+
+func TestParseOrderListParams(t *testing.T) {
+	tests := []struct {
+		name        string
+		query       string
+		expectError bool
+		check       func(t *testing.T, p OrderListParams)
+	}{
+		{
+			name:  "defaults",
+			query: "",
+			check: func(t *testing.T, p OrderListParams) {
+				assert.Equal(t, defaultOrderPageSize, p.Limit)
+				assert.True(t, p.Descending)
+				assert.Nil(t, p.Cursor)
+				assert.Empty(t, p.Statuses)
+			},
+		},
+		{
+			name:  "limit_capped",
+			query: "limit=1000",
+			check: func(t *testing.T, p OrderListParams) {
+				assert.Equal(t, maxOrderPageSize, p.Limit)
+			},
+		},
+		{
+			name:  "status_and_sort",
+			query: "status=paid,%20shipped&sort=asc",
+			check: func(t *testing.T, p OrderListParams) {
+				assert.Equal(t, []string{"paid", "shipped"}, p.Statuses)
+				assert.False(t, p.Descending)
+			},
+		},
+		{
+			name:  "date_range_inclusive_end",
+			query: "from=2026-02-01&to=2026-02-07",
+			check: func(t *testing.T, p OrderListParams) {
+				assert.Equal(t, time.Date(2026, 2, 1, 0, 0, 0, 0, time.UTC), *p.CreatedFrom)
+				assert.Equal(t, time.Date(2026, 2, 8, 0, 0, 0, 0, time.UTC), *p.CreatedTo)
+			},
+		},
+		{
+			name:  "rfc3339_range",
+			query: "from=2026-02-01T10:00:00Z",
+			check: func(t *testing.T, p OrderListParams) {
+				assert.Equal(t, time.Date(2026, 2, 1, 10, 0, 0, 0, time.UTC), *p.CreatedFrom)
+			},
+		},
+		{name: "invalid_limit", query: "limit=0", expectError: true},
+		{name: "invalid_sort", query: "sort=sideways", expectError: true},
+		{name: "invalid_date", query: "from=yesterday", expectError: true},
+		{name: "invalid_cursor", query: "cursor=bm90LWpzb24", expectError: true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			c, _ := gin.CreateTestContext(httptest.NewRecorder())
+			c.Request = httptest.NewRequest("GET", "/getOrders?"+tt.query, nil)
+
+			params, err := ParseOrderListParams(c)
+			if tt.expectError {
+				assert.Error(t, err)
+				return
+			}
+			assert.NoError(t, err)
+			tt.check(t, params)
+		})
+	}
+}
+
+func TestApplyOrderListParamsSQL(t *testing.T) {
+	cursor := &OrderCursor{CreatedAt: time.Now(), OrderID: "order-1"}
+
+	tests := []struct {
+		name          string
+		params        OrderListParams
+		contains      []string
+		expectedLimit int
+	}{
+		{
+			name:          "descending_with_cursor",
+			params:        OrderListParams{Limit: 10, Descending: true, Cursor: cursor},
+			contains:      []string{"(created_at, order_id) <", "ORDER BY created_at DESC,order_id DESC"},
+			expectedLimit: 11,
+		},
+		{
+			name:          "ascending_with_filters",
+			params:        OrderListParams{Limit: 5, Cursor: cursor, Statuses: []string{"paid"}},
+			contains:      []string{"(created_at, order_id) >", "status IN", "ORDER BY created_at ASC,order_id ASC"},
+			expectedLimit: 6,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var orders []OrderModel
+			stmt := ApplyOrderListParams(dryRunDB(t).Model(&OrderModel{}), tt.params).Find(&orders).Statement
+			sql := stmt.SQL.String()
+			for _, fragment := range tt.contains {
+				assert.Contains(t, sql, fragment)
+			}
+			assert.Equal(t, tt.expectedLimit, stmt.Vars[len(stmt.Vars)-1])
+		})
+	}
+}
+
+func TestBuildOrderPage(t *testing.T) {
+	base := time.Date(2026, 2, 7, 10, 0, 0, 0, time.UTC)
+	orders := []OrderModel{
+		{OrderID: "order-3", CreatedAt: base.Add(3 * time.Minute)},
+		{OrderID: "order-2", CreatedAt: base.Add(2 * time.Minute)},
+		{OrderID: "order-1", CreatedAt: base.Add(1 * time.Minute)},
+	}
+
+	page := BuildOrderPage(orders, 2)
+	assert.Len(t, page.Orders, 2)
+	assert.NotEmpty(t, page.NextCursor)
+
+	cursor, err := DecodeOrderCursor(page.NextCursor)
+	assert.NoError(t, err)
+	assert.Equal(t, "order-2", cursor.OrderID)
+
+	lastPage := BuildOrderPage(orders[2:], 2)
+	assert.Len(t, lastPage.Orders, 1)
+	assert.Empty(t, lastPage.NextCursor)
+
+	empty := BuildOrderPage(nil, 2)
+	assert.NotNil(t, empty.Orders)
+}
@@ -0,0 +1,505 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"log"
+	"net/http"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/google/uuid"
+	"gorm.io/gorm"
+)
+
+// =============================================================================
+// Payments
+// =============================================================================
+
+// Payment statuses stored on PaymentModel.
+const (
+	PaymentPending           = "pending"
+	PaymentSucceeded         = "succeeded"
+	PaymentFailed            = "failed"
+	PaymentPartiallyRefunded = "partially_refunded"
+	PaymentRefunded          = "refunded"
+)
+
+// capturedPaymentStatuses are the statuses of a payment that took the buyer's
+// money, whether or not some or all of it has been refunded since.
+var capturedPaymentStatuses = []string{PaymentSucceeded, PaymentPartiallyRefunded, PaymentRefunded}
+
+// Payment event types reported by a provider webhook.
+const (
+	PaymentEventSucceeded = "payment_intent.succeeded"
+	PaymentEventFailed    = "payment_intent.payment_failed"
+	PaymentEventRefunded  = "charge.refunded"
+)
+
+// maxWebhookBodyBytes caps the size of a webhook payload that will be read.
+const maxWebhookBodyBytes = 64 * 1024
+
+// ErrInvalidWebhookSignature is returned when a webhook payload cannot be
+// verified against the shared webhook secret.
+var ErrInvalidWebhookSignature = errors.New("invalid webhook signature")
+
+// ErrPaymentNotFound is returned when no payment matches a reference.
+var ErrPaymentNotFound = errors.New("payment not found")
+
+// PaymentIntentRequest describes a payment to be collected.
+type PaymentIntentRequest struct {
+	Amount         Money
+	Reference      string // checkout ID or order ID being paid
+	IdempotencyKey string
+}
+
+// PaymentIntent is the provider's view of a payment.
+type PaymentIntent struct {
+	ID           string
+	ClientSecret string
+	Amount       Money
+	Status       string
+}
+
+// Refund is the provider's record of a refunded amount.
+type Refund struct {
+	ID       string
+	IntentID string
+	Amount   Money
+	Status   string
+}
+
+// PaymentEvent is a verified webhook notification. AmountRefunded is only set
+// for charge.refunded: the total refunded on the charge so far.
+type PaymentEvent struct {
+	ID             string
+	Type           string
+	IntentID       string
+	AmountRefunded Money
+}
+
+// PaymentProvider is implemented by payment gateways. Orders are only marked
+// paid from a verified webhook, never from the client.
+type PaymentProvider interface {
+	Name() string
+	CreatePaymentIntent(ctx context.Context, req PaymentIntentRequest) (*PaymentIntent, error)
+	ConfirmPaymentIntent(ctx context.Context, intentID string) (*PaymentIntent, error)
+	RefundPayment(ctx context.Context, intentID string, amount Money, idempotencyKey string) (*Refund, error)
+	VerifyWebhook(header http.Header, payload []byte) (*PaymentEvent, error)
+}
+
+// PaymentModel represents the payments table in PostgreSQL. One row is kept
+// per payment intent created for a checkout (or single order).
+type PaymentModel struct {
+	PaymentID    string    `gorm:"primaryKey;type:uuid;column:payment_id" json:"paymentId"`
+	Reference    string    `gorm:"not null;index;column:reference" json:"reference"`
+	BuyerID      string    `gorm:"not null;column:buyer_id" json:"buyerId"`
+	Provider     string    `gorm:"not null;column:provider" json:"provider"`
+	IntentID     string    `gorm:"not null;uniqueIndex;column:intent_id" json:"intentId"`
+	ClientSecret string    `gorm:"column:client_secret" json:"clientSecret,omitempty"`
+	Amount       Money     `gorm:"embedded" json:"amount"`
+	Refunded     Money     `gorm:"embedded;embeddedPrefix:refunded_" json:"refunded,omitzero"`
+	Status       string    `gorm:"not null;default:pending;column:status" json:"status"` // pending, succeeded, failed, partially_refunded, refunded
+	CreatedAt    time.Time `gorm:"autoCreateTime;column:created_at" json:"createdAt"`
+	UpdatedAt    time.Time `gorm:"autoUpdateTime;column:updated_at" json:"updatedAt"`
+}
+
+// TableName specifies the table name for GORM.
+func (PaymentModel) TableName() string {
+	return "payments"
+}
+
+// Captured reports whether the payment took the buyer's money, whether or not
+// it has been refunded since.
+func (p PaymentModel) Captured() bool {
+	for _, status := range capturedPaymentStatuses {
+		if p.Status == status {
+			return true
+		}
+	}
+	return false
+}
+
+// ApplyRefunded records the total a charge.refunded event reports refunded.
+// The total only grows and events may arrive out of order, so a smaller one
+// is ignored. The payment is refunded once refunds cover its amount and
+// partially refunded until then.
+func (p *PaymentModel) ApplyRefunded(total Money) {
+	if total.Amount > p.Refunded.Amount {
+		p.Refunded = Money{Amount: total.Amount, Currency: p.Amount.Currency}
+	}
+	if p.Refunded.Amount >= p.Amount.Amount {
+		p.Status = PaymentRefunded
+	} else {
+		p.Status = PaymentPartiallyRefunded
+	}
+}
+
+// PaymentWebhookEvent represents the payment_webhook_events table in
+// PostgreSQL. It records processed event IDs so redelivered webhooks are
+// acknowledged without being applied twice.
+type PaymentWebhookEvent struct {
+	EventID    string    `gorm:"primaryKey;column:event_id" json:"eventId"`
+	Type       string    `gorm:"not null;column:type" json:"type"`
+	IntentID   string    `gorm:"column:intent_id" json:"intentId"`
+	ReceivedAt time.Time `gorm:"autoCreateTime;column:received_at" json:"receivedAt"`
+}
+
+// TableName specifies the table name for GORM.
+func (PaymentWebhookEvent) TableName() string {
+	return "payment_webhook_events"
+}
+
+// checkPaymentConfig reports a payment provider the service must not start
+// with. The webhook secret is required by the fake provider too: anyone who
+// knows it can sign a payment_intent.succeeded and mark orders paid, so it is
+// never defaulted to a value that is public in this repository.
+func checkPaymentConfig(provider, secretKey, webhookSecret string) error {
+	switch provider {
+	case "stripe":
+		if secretKey == "" || webhookSecret == "" {
+			return errors.New("STRIPE_SECRET_KEY and STRIPE_WEBHOOK_SECRET are required when PAYMENT_PROVIDER=stripe")
+		}
+	case "fake":
+		if webhookSecret == "" {
+			return errors.New("STRIPE_WEBHOOK_SECRET is required when PAYMENT_PROVIDER=fake; set it to a random value")
+		}
+	default:
+		return fmt.Errorf("unknown PAYMENT_PROVIDER %q (use stripe or fake)", provider)
+	}
+	return nil
+}
+
+// PaymentSummaryResponse is returned by GET /payments/:id.
+type PaymentSummaryResponse struct {
+	Reference string        `json:"reference"`
+	Amount    Money         `json:"amount"`
+	Status    string        `json:"status"`
+	Payment   *PaymentModel `json:"payment,omitempty"`
+}
+
+// findPayableOrders returns the orders covered by a payment ID, which is
+// either a checkout ID (all child orders) or a single order ID.
+func findPayableOrders(tx *gorm.DB, id string) ([]OrderModel, error) {
+	var orders []OrderModel
+	if err := tx.Where("checkout_id = ? OR order_id = ?", id, id).Find(&orders).Error; err != nil {
+		return nil, err
+	}
+	return orders, nil
+}
+
+// loadBuyerPayableOrders loads the orders for a payment ID and checks that
+// they belong to the buyer, writing an error response if not.
+func loadBuyerPayableOrders(c *gin.Context, id string) ([]OrderModel, string, bool) {
+	userID, exists := c.Get("userId")
+	if !exists {
+		c.JSON(http.StatusUnauthorized, ErrorResponse{Error: "User ID not found in token"})
+		return nil, "", false
+	}
+
+	orders, err := orderRepo.PayableOrders(c.Request.Context(), id)
+	if err != nil || len(orders) == 0 {
+		c.JSON(http.StatusNotFound, ErrorResponse{Error: "Order not found"})
+		return nil, "", false
+	}
+
+	for _, order := range orders {
+		if order.BuyerID != userID.(string) {
+			c.JSON(http.StatusForbidden, ErrorResponse{Error: "You can only pay for your own orders"})
+			return nil, "", false
+		}
+	}
+
+	return orders, userID.(string), true
+}
+
+// amountDue sums the totals of the orders still awaiting payment. Orders of
+// one checkout share a currency, so a mismatch means the data is corrupt.
+func amountDue(orders []OrderModel) (Money, error) {
+	var total Money
+	for _, order := range orders {
+		if order.Status != StatusPending {
+			continue
+		}
+		sum, err := total.Add(order.TotalPrice)
+		if err != nil {
+			return Money{}, err
+		}
+		total = sum
+	}
+	return total, nil
+}
+
+// paymentSummaryStatus is the status polled by the client: pending while any
+// order awaits payment, then the refund state of the payment, then cancelled
+// or expired when no order went ahead, and paid otherwise.
+func paymentSummaryStatus(orders []OrderModel, payment *PaymentModel) string {
+	cancelled, expired := 0, 0
+	for _, order := range orders {
+		switch order.Status {
+		case StatusPending:
+			return StatusPending
+		case StatusCancelled:
+			cancelled++
+		case StatusExpired:
+			expired++
+		}
+	}
+
+	if payment != nil && (payment.Status == PaymentRefunded || payment.Status == PaymentPartiallyRefunded) {
+		return payment.Status
+	}
+	switch {
+	case expired == len(orders):
+		return StatusExpired
+	case cancelled+expired == len(orders):
+		return StatusCancelled
+	}
+	return StatusPaid
+}
+
+// HandleGetPayment godoc
+// @Summary Get payment details
+// @Description Returns the amount due and payment status for a checkout or order
+// @Tags payment
+// @Produce json
+// @Param id path string true "Checkout ID or Order ID"
+// @Success 200 {object} PaymentSummaryResponse
+// @Failure 401 {object} ErrorResponse
+// @Failure 403 {object} ErrorResponse
+// @Failure 404 {object} ErrorResponse
+// @Router /payments/{id} [get]
+func HandleGetPayment(c *gin.Context) {
+	id := c.Param("id")
+
+	orders, _, ok := loadBuyerPayableOrders(c, id)
+	if !ok {
+		return
+	}
+
+	summary := PaymentSummaryResponse{Reference: id}
+	for _, order := range orders {
+		amount, err := summary.Amount.Add(order.TotalPrice)
+		if err != nil {
+			c.JSON(http.StatusInternalServerError, ErrorResponse{Error: "Order totals are in different currencies"})
+			return
+		}
+		summary.Amount = amount
+	}
+
+	if payment, err := orderRepo.LatestPayment(c.Request.Context(), id, ""); err == nil {
+		summary.Payment = payment
+	}
+	summary.Status = paymentSummaryStatus(orders, summary.Payment)
+
+	c.JSON(http.StatusOK, summary)
+}
+
+// HandleCreatePaymentIntent godoc
+// @Summary Create a payment intent
+// @Description Creates (or returns the open) provider payment intent for the pending orders of a checkout or order
+// @Tags payment
+// @Produce json
+// @Param id path string true "Checkout ID or Order ID"
+// @Success 200 {object} PaymentModel
+// @Failure 401 {object} ErrorResponse
+// @Failure 403 {object} ErrorResponse
+// @Failure 404 {object} ErrorResponse
+// @Failure 409 {object} ErrorResponse
+// @Failure 502 {object} ErrorResponse
+// @Router /payments/{id}/intent [post]
+func HandleCreatePaymentIntent(c *gin.Context) {
+	id := c.Param("id")
+
+	orders, buyerID, ok := loadBuyerPayableOrders(c, id)
+	if !ok {
+		return
+	}
+
+	amount, err := amountDue(orders)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, ErrorResponse{Error: "Order totals are in different currencies"})
+		return
+	}
+	if amount.Amount <= 0 {
+		c.JSON(http.StatusConflict, ErrorResponse{Error: "Order is not awaiting payment"})
+		return
+	}
+
+	// Reuse an open intent for the same amount so retries don't double-charge
+	existing, err := orderRepo.LatestPayment(c.Request.Context(), id, PaymentPending)
+	if err == nil && existing.Amount == amount {
+		c.JSON(http.StatusOK, existing)
+		return
+	}
+
+	paymentID := uuid.New().String()
+	intent, err := paymentProvider.CreatePaymentIntent(c.Request.Context(), PaymentIntentRequest{
+		Amount:         amount,
+		Reference:      id,
+		IdempotencyKey: paymentID,
+	})
+	if err != nil {
+		log.Printf("Failed to create payment intent for %s: %v", id, err)
+		c.JSON(http.StatusBadGateway, ErrorResponse{Error: "Failed to create payment"})
+		return
+	}
+
+	payment := PaymentModel{
+		PaymentID:    paymentID,
+		Reference:    id,
+		BuyerID:      buyerID,
+		Provider:     paymentProvider.Name(),
+		IntentID:     intent.ID,
+		ClientSecret: intent.ClientSecret,
+		Amount:       amount,
+		Status:       PaymentPending,
+	}
+	if err := orderRepo.CreatePayment(c.Request.Context(), &payment); err != nil {
+		c.JSON(http.StatusInternalServerError, ErrorResponse{Error: "Failed to save payment"})
+		return
+	}
+
+	c.JSON(http.StatusOK, payment)
+}
+
+// HandleConfirmPayment godoc
+// @Summary Confirm a payment
+// @Description Asks the provider to confirm the open payment intent. The order is marked paid when the provider's webhook arrives.
+// @Tags payment
+// @Produce json
+// @Param id path string true "Checkout ID or Order ID"
+// @Success 202 {object} map[string]string
+// @Failure 401 {object} ErrorResponse
+// @Failure 403 {object} ErrorResponse
+// @Failure 404 {object} ErrorResponse
+// @Failure 502 {object} ErrorResponse
+// @Router /payments/{id}/confirm [post]
+func HandleConfirmPayment(c *gin.Context) {
+	id := c.Param("id")
+
+	if _, _, ok := loadBuyerPayableOrders(c, id); !ok {
+		return
+	}
+
+	payment, err := orderRepo.LatestPayment(c.Request.Context(), id, PaymentPending)
+	if err != nil {
+		c.JSON(http.StatusNotFound, ErrorResponse{Error: "No open payment for this order"})
+		return
+	}
+
+	intent, err := paymentProvider.ConfirmPaymentIntent(c.Request.Context(), payment.IntentID)
+	if err != nil {
+		log.Printf("Failed to confirm payment intent %s: %v", payment.IntentID, err)
+		c.JSON(http.StatusBadGateway, ErrorResponse{Error: "Failed to confirm payment"})
+		return
+	}
+
+	c.JSON(http.StatusAccepted, gin.H{
+		"message":   "Payment submitted; the order is marked paid once the provider confirms it",
+		"paymentId": payment.PaymentID,
+		"status":    intent.Status,
+	})
+}
+
+// HandlePaymentWebhook godoc
+// @Summary Payment provider webhook
+// @Description Receives signed payment events from the provider and moves orders from pending to paid
+// @Tags payment
+// @Accept json
+// @Produce json
+// @Success 200 {object} map[string]interface{}
+// @Failure 400 {object} ErrorResponse
+// @Failure 500 {object} ErrorResponse
+// @Router /payments/webhook [post]
+func HandlePaymentWebhook(c *gin.Context) {
+	payload, err := io.ReadAll(io.LimitReader(c.Request.Body, maxWebhookBodyBytes))
+	if err != nil {
+		c.JSON(http.StatusBadRequest, ErrorResponse{Error: "Failed to read webhook body"})
+		return
+	}
+
+	event, err := paymentProvider.VerifyWebhook(c.Request.Header, payload)
+	if err != nil {
+		log.Printf("Rejected payment webhook: %v", err)
+		c.JSON(http.StatusBadRequest, ErrorResponse{Error: "Invalid webhook signature"})
+		return
+	}
+
+	duplicate, err := orderRepo.ApplyPaymentEvent(c.Request.Context(), event)
+	if err != nil {
+		log.Printf("Failed to apply payment event %s: %v", event.ID, err)
+		c.JSON(http.StatusInternalServerError, ErrorResponse{Error: "Failed to process webhook"})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"received": true, "duplicate": duplicate})
+}
+
+// ApplyPaymentEvent updates the payment and its orders for a verified event.
+// A succeeded payment moves every pending order it covers to "paid" and
+// queues refunds for what it took for orders that expired or were cancelled
+// meanwhile (see LatePaymentRefunds). Events for unknown intents are ignored.
+func ApplyPaymentEvent(tx *gorm.DB, event *PaymentEvent) error {
+	var payment PaymentModel
+	err := tx.Where("intent_id = ?", event.IntentID).First(&payment).Error
+	if errors.Is(err, gorm.ErrRecordNotFound) {
+		log.Printf("Ignoring payment event %s for unknown intent %s", event.ID, event.IntentID)
+		return nil
+	}
+	if err != nil {
+		return fmt.Errorf("failed to load payment: %w", err)
+	}
+
+	switch event.Type {
+	case PaymentEventSucceeded:
+		// A payment is applied once, however many events report it
+		if payment.Captured() {
+			return nil
+		}
+
+		orders, err := findPayableOrders(tx, payment.Reference)
+		if err != nil {
+			return fmt.Errorf("failed to load orders: %w", err)
+		}
+
+		// Money taken for orders that expired or were cancelled meanwhile
+		// goes back to the buyer
+		refunds, err := LatePaymentRefunds(payment, orders, time.Now().UTC())
+		if err != nil {
+			return fmt.Errorf("failed to work out refunds: %w", err)
+		}
+		for _, refund := range refunds {
+			if err := QueueRefund(tx, refund); err != nil {
+				return err
+			}
+			log.Printf("⚠️ Payment %s succeeded for an order no longer awaiting it (%s); queued refund of %s",
+				payment.IntentID, refund.OrderID, refund.Amount)
+		}
+
+		for i := range orders {
+			if orders[i].Status != StatusPending {
+				continue
+			}
+			reason := fmt.Sprintf("payment %s confirmed by %s", payment.IntentID, payment.Provider)
+			if err := TransitionOrder(tx, &orders[i], StatusPaid, "payment", RoleSystem, reason); err != nil {
+				return err
+			}
+		}
+		payment.Status = PaymentSucceeded
+	case PaymentEventFailed:
+		payment.Status = PaymentFailed
+	case PaymentEventRefunded:
+		payment.ApplyRefunded(event.AmountRefunded)
+	default:
+		return nil
+	}
+
+	if err := tx.Save(&payment).Error; err != nil {
+		return fmt.Errorf("failed to update payment: %w", err)
+	}
+
+	return nil
+}
@@ -0,0 +1,294 @@
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"log"
+	"net/http"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/google/uuid"
+)
+
+// =============================================================================
+// Fake Payment Provider Server
+// =============================================================================
+
+// FakeDeclinedPaymentMethod makes the fake server decline a confirmation, the
+// same as Stripe's test card of that name.
+const FakeDeclinedPaymentMethod = "pm_card_chargeDeclined"
+
+// FakePaymentServer is a local stand-in for the Stripe API used in development
+// and tests. It implements the endpoints StripeProvider calls and sends signed
+// webhooks to WebhookURL when an intent is confirmed or refunded.
+type FakePaymentServer struct {
+	SecretKey     string
+	WebhookSecret string
+	WebhookURL    string
+	HTTPClient    *http.Client
+
+	mu          sync.Mutex
+	intents     map[string]*stripeIntent
+	idempotency map[string]string        // idempotency key -> intent ID
+	refunds     map[string]*stripeRefund // idempotency key -> refund
+	refunded    map[string]int64         // intent ID -> total refunded
+	mux         *http.ServeMux
+	wg          sync.WaitGroup
+}
+
+// NewFakePaymentServer creates a fake provider that authenticates requests with
+// secretKey and signs webhooks with webhookSecret.
+func NewFakePaymentServer(secretKey, webhookSecret, webhookURL string) *FakePaymentServer {
+	s := &FakePaymentServer{
+		SecretKey:     secretKey,
+		WebhookSecret: webhookSecret,
+		WebhookURL:    webhookURL,
+		HTTPClient:    &http.Client{Timeout: 10 * time.Second},
+		intents:       make(map[string]*stripeIntent),
+		idempotency:   make(map[string]string),
+		refunds:       make(map[string]*stripeRefund),
+		refunded:      make(map[string]int64),
+		mux:           http.NewServeMux(),
+	}
+
+	s.mux.HandleFunc("POST /v1/payment_intents", s.handleCreateIntent)
+	s.mux.HandleFunc("GET /v1/payment_intents/{id}", s.handleGetIntent)
+	s.mux.HandleFunc("POST /v1/payment_intents/{id}/confirm", s.handleConfirmIntent)
+	s.mux.HandleFunc("POST /v1/refunds", s.handleRefund)
+
+	return s
+}
+
+// ServeHTTP authenticates the request and routes it.
+func (s *FakePaymentServer) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	if r.Header.Get("Authorization") != "Bearer "+s.SecretKey {
+		writeFakeError(w, http.StatusUnauthorized, "authentication_error", "Invalid API key provided")
+		return
+	}
+	s.mux.ServeHTTP(w, r)
+}
+
+// Wait blocks until all pending webhooks have been delivered.
+func (s *FakePaymentServer) Wait() {
+	s.wg.Wait()
+}
+
+func (s *FakePaymentServer) handleCreateIntent(w http.ResponseWriter, r *http.Request) {
+	if err := r.ParseForm(); err != nil {
+		writeFakeError(w, http.StatusBadRequest, "invalid_request_error", "Invalid form body")
+		return
+	}
+
+	amount, err := strconv.ParseInt(r.PostForm.Get("amount"), 10, 64)
+	if err != nil || amount <= 0 {
+		writeFakeError(w, http.StatusBadRequest, "invalid_request_error", "Invalid amount")
+		return
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	key := r.Header.Get(IdempotencyKeyHeader)
+	if id, ok := s.idempotency[key]; ok && key != "" {
+		writeFakeJSON(w, http.StatusOK, s.intents[id])
+		return
+	}
+
+	id := "pi_" + strings.ReplaceAll(uuid.New().String(), "-", "")
+	intent := &stripeIntent{
+		ID:           id,
+		ClientSecret: id + "_secret_" + strings.ReplaceAll(uuid.New().String(), "-", "")[:12],
+		Amount:       amount,
+		Currency:     r.PostForm.Get("currency"),
+		Status:       "requires_payment_method",
+	}
+	s.intents[id] = intent
+	if key != "" {
+		s.idempotency[key] = id
+	}
+
+	writeFakeJSON(w, http.StatusOK, intent)
+}
+
+func (s *FakePaymentServer) handleGetIntent(w http.ResponseWriter, r *http.Request) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	intent, ok := s.intents[r.PathValue("id")]
+	if !ok {
+		writeFakeError(w, http.StatusNotFound, "invalid_request_error", "No such payment_intent")
+		return
+	}
+	writeFakeJSON(w, http.StatusOK, intent)
+}
+
+func (s *FakePaymentServer) handleConfirmIntent(w http.ResponseWriter, r *http.Request) {
+	if err := r.ParseForm(); err != nil {
+		writeFakeError(w, http.StatusBadRequest, "invalid_request_error", "Invalid form body")
+		return
+	}
+
+	s.mu.Lock()
+	intent, ok := s.intents[r.PathValue("id")]
+	if !ok {
+		s.mu.Unlock()
+		writeFakeError(w, http.StatusNotFound, "invalid_request_error", "No such payment_intent")
+		return
+	}
+	if intent.Status == "succeeded" {
+		s.mu.Unlock()
+		writeFakeError(w, http.StatusBadRequest, "invalid_request_error", "PaymentIntent has already succeeded")
+		return
+	}
+
+	eventType := PaymentEventSucceeded
+	intent.Status = "succeeded"
+	if r.PostForm.Get("payment_method") == FakeDeclinedPaymentMethod {
+		eventType = PaymentEventFailed
+		intent.Status = "requires_payment_method"
+	}
+	snapshot := *intent
+	s.mu.Unlock()
+
+	s.sendWebhook(eventType, map[string]interface{}{
+		"id":       snapshot.ID,
+		"object":   "payment_intent",
+		"amount":   snapshot.Amount,
+		"currency": snapshot.Currency,
+		"status":   snapshot.Status,
+	})
+
+	writeFakeJSON(w, http.StatusOK, snapshot)
+}
+
+func (s *FakePaymentServer) handleRefund(w http.ResponseWriter, r *http.Request) {
+	if err := r.ParseForm(); err != nil {
+		writeFakeError(w, http.StatusBadRequest, "invalid_request_error", "Invalid form body")
+		return
+	}
+
+	s.mu.Lock()
+	key := r.Header.Get(IdempotencyKeyHeader)
+	if refund, ok := s.refunds[key]; ok && key != "" {
+		s.mu.Unlock()
+		writeFakeJSON(w, http.StatusOK, refund)
+		return
+	}
+	intent, ok := s.intents[r.PostForm.Get("payment_intent")]
+	if !ok || intent.Status != "succeeded" {
+		s.mu.Unlock()
+		writeFakeError(w, http.StatusBadRequest, "invalid_request_error", "PaymentIntent has not succeeded")
+		return
+	}
+
+	// Without an amount, whatever has not been refunded yet is refunded
+	remaining := intent.Amount - s.refunded[intent.ID]
+	amount := remaining
+	if v := r.PostForm.Get("amount"); v != "" {
+		parsed, err := strconv.ParseInt(v, 10, 64)
+		if err != nil || parsed <= 0 || parsed > remaining {
+			s.mu.Unlock()
+			writeFakeError(w, http.StatusBadRequest, "invalid_request_error", "Invalid refund amount")
+			return
+		}
+		amount = parsed
+	}
+	if amount <= 0 {
+		s.mu.Unlock()
+		writeFakeError(w, http.StatusBadRequest, "invalid_request_error", "Charge has already been refunded")
+		return
+	}
+
+	refund := &stripeRefund{
+		ID:            "re_" + strings.ReplaceAll(uuid.New().String(), "-", ""),
+		PaymentIntent: intent.ID,
+		Amount:        amount,
+		Currency:      intent.Currency,
+		Status:        "succeeded",
+	}
+	if key != "" {
+		s.refunds[key] = refund
+	}
+	s.refunded[intent.ID] += amount
+	total := s.refunded[intent.ID]
+	s.mu.Unlock()
+
+	// Like Stripe's charge, the event carries the total refunded so far
+	s.sendWebhook(PaymentEventRefunded, map[string]interface{}{
+		"id":              "ch_" + strings.ReplaceAll(uuid.New().String(), "-", ""),
+		"object":          "charge",
+		"payment_intent":  intent.ID,
+		"amount":          intent.Amount,
+		"amount_refunded": total,
+		"currency":        intent.Currency,
+		"refunded":        total == intent.Amount,
+	})
+
+	writeFakeJSON(w, http.StatusOK, refund)
+}
+
+// sendWebhook delivers a signed event in the background, retrying a few times
+// like a real provider would.
+func (s *FakePaymentServer) sendWebhook(eventType string, object map[string]interface{}) {
+	if s.WebhookURL == "" {
+		return
+	}
+
+	payload, _ := json.Marshal(map[string]interface{}{
+		"id":      "evt_" + strings.ReplaceAll(uuid.New().String(), "-", ""),
+		"object":  "event",
+		"type":    eventType,
+		"created": time.Now().Unix(),
+		"data":    map[string]interface{}{"object": object},
+	})
+
+	s.wg.Add(1)
+	go func() {
+		defer s.wg.Done()
+		for attempt := 1; attempt <= 3; attempt++ {
+			req, err := http.NewRequest(http.MethodPost, s.WebhookURL, bytes.NewReader(payload))
+			if err != nil {
+				log.Printf("Fake payment webhook: %v", err)
+				return
+			}
+			req.Header.Set("Content-Type", "application/json")
+			req.Header.Set(StripeSignatureHeader, SignWebhookPayload(s.WebhookSecret, payload, time.Now()))
+
+			resp, err := s.HTTPClient.Do(req)
+			if err == nil {
+				resp.Body.Close()
+				if resp.StatusCode < 300 {
+					return
+				}
+				err = &webhookStatusError{StatusCode: resp.StatusCode}
+			}
+			log.Printf("Fake payment webhook %s attempt %d failed: %v", eventType, attempt, err)
+			time.Sleep(time.Duration(attempt) * 500 * time.Millisecond)
+		}
+	}()
+}
+
+// webhookStatusError reports a non-2xx webhook response.
+type webhookStatusError struct {
+	StatusCode int
+}
+
+func (e *webhookStatusError) Error() string {
+	return "webhook endpoint returned " + strconv.Itoa(e.StatusCode)
+}
+
+func writeFakeJSON(w http.ResponseWriter, status int, v interface{}) {
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(status)
+	_ = json.NewEncoder(w).Encode(v)
+}
+
+func writeFakeError(w http.ResponseWriter, status int, errType, message string) {
+	var body stripeErrorResponse
+	body.Error.Type = errType
+	body.Error.Message = message
+	writeFakeJSON(w, status, body)
+}
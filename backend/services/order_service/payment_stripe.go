@@ -0,0 +1,268 @@
+package main
+
+import (
+	"context"
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/url"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// =============================================================================
+// Stripe Payment Provider
+// =============================================================================
+
+// StripeSignatureHeader carries the webhook signature in the form
+// "t=<unix timestamp>,v1=<hex HMAC-SHA256>".
+const StripeSignatureHeader = "Stripe-Signature"
+
+// defaultWebhookTolerance is how old a signed webhook may be before it is
+// rejected as a possible replay.
+const defaultWebhookTolerance = 5 * time.Minute
+
+// StripeProvider talks to the Stripe REST API (or any server speaking the same
+// subset of it, such as FakePaymentServer).
+type StripeProvider struct {
+	BaseURL       string
+	SecretKey     string
+	WebhookSecret string
+	// ConfirmPaymentMethod is attached when confirming server-side, e.g.
+	// "pm_card_visa" in test mode. Live clients confirm with Stripe.js instead.
+	ConfirmPaymentMethod string
+	WebhookTolerance     time.Duration
+	HTTPClient           *http.Client
+}
+
+// stripeIntent is the subset of a Stripe PaymentIntent object that is used.
+type stripeIntent struct {
+	ID           string `json:"id"`
+	ClientSecret string `json:"client_secret"`
+	Amount       int64  `json:"amount"`
+	Currency     string `json:"currency"`
+	Status       string `json:"status"`
+}
+
+// stripeRefund is the subset of a Stripe Refund object that is used.
+type stripeRefund struct {
+	ID            string `json:"id"`
+	PaymentIntent string `json:"payment_intent"`
+	Amount        int64  `json:"amount"`
+	Currency      string `json:"currency"`
+	Status        string `json:"status"`
+}
+
+// stripeEvent is the subset of a Stripe webhook Event that is used. The data
+// object is a PaymentIntent or, for refunds, a Charge referencing one.
+type stripeEvent struct {
+	ID   string `json:"id"`
+	Type string `json:"type"`
+	Data struct {
+		Object struct {
+			ID             string `json:"id"`
+			PaymentIntent  string `json:"payment_intent"`
+			AmountRefunded int64  `json:"amount_refunded"`
+			Currency       string `json:"currency"`
+		} `json:"object"`
+	} `json:"data"`
+}
+
+// stripeErrorResponse is the error envelope returned by the Stripe API.
+type stripeErrorResponse struct {
+	Error struct {
+		Type    string `json:"type"`
+		Message string `json:"message"`
+	} `json:"error"`
+}
+
+// NewStripeProvider creates a provider for the given API base URL.
+func NewStripeProvider(baseURL, secretKey, webhookSecret string) *StripeProvider {
+	return &StripeProvider{
+		BaseURL:          strings.TrimRight(baseURL, "/"),
+		SecretKey:        secretKey,
+		WebhookSecret:    webhookSecret,
+		WebhookTolerance: defaultWebhookTolerance,
+		HTTPClient:       &http.Client{Timeout: 15 * time.Second},
+	}
+}
+
+// Name identifies the provider on stored payments.
+func (p *StripeProvider) Name() string {
+	return "stripe"
+}
+
+// CreatePaymentIntent creates a PaymentIntent for the amount due. Stripe takes
+// amounts in the currency's smallest unit, as Money stores them.
+func (p *StripeProvider) CreatePaymentIntent(ctx context.Context, req PaymentIntentRequest) (*PaymentIntent, error) {
+	form := url.Values{}
+	form.Set("amount", strconv.FormatInt(req.Amount.Amount, 10))
+	form.Set("currency", strings.ToLower(req.Amount.Currency))
+	form.Set("metadata[reference]", req.Reference)
+
+	var intent stripeIntent
+	if err := p.post(ctx, "/v1/payment_intents", form, req.IdempotencyKey, &intent); err != nil {
+		return nil, err
+	}
+	return intent.toPaymentIntent(), nil
+}
+
+// ConfirmPaymentIntent confirms a PaymentIntent server-side.
+func (p *StripeProvider) ConfirmPaymentIntent(ctx context.Context, intentID string) (*PaymentIntent, error) {
+	form := url.Values{}
+	if p.ConfirmPaymentMethod != "" {
+		form.Set("payment_method", p.ConfirmPaymentMethod)
+	}
+
+	var intent stripeIntent
+	if err := p.post(ctx, "/v1/payment_intents/"+url.PathEscape(intentID)+"/confirm", form, "", &intent); err != nil {
+		return nil, err
+	}
+	return intent.toPaymentIntent(), nil
+}
+
+// RefundPayment refunds part or all of a PaymentIntent. An amount of zero
+// refunds the full amount. Retrying with the same idempotency key returns the
+// original refund instead of refunding again.
+func (p *StripeProvider) RefundPayment(ctx context.Context, intentID string, amount Money, idempotencyKey string) (*Refund, error) {
+	form := url.Values{}
+	form.Set("payment_intent", intentID)
+	if amount.Amount > 0 {
+		form.Set("amount", strconv.FormatInt(amount.Amount, 10))
+	}
+
+	var refund stripeRefund
+	if err := p.post(ctx, "/v1/refunds", form, idempotencyKey, &refund); err != nil {
+		return nil, err
+	}
+
+	return &Refund{
+		ID:       refund.ID,
+		IntentID: refund.PaymentIntent,
+		Amount:   Money{Amount: refund.Amount, Currency: strings.ToUpper(refund.Currency)},
+		Status:   refund.Status,
+	}, nil
+}
+
+// VerifyWebhook checks the Stripe-Signature header against the payload and
+// returns the decoded event.
+func (p *StripeProvider) VerifyWebhook(header http.Header, payload []byte) (*PaymentEvent, error) {
+	if err := VerifyWebhookSignature(p.WebhookSecret, header.Get(StripeSignatureHeader), payload, p.WebhookTolerance, time.Now()); err != nil {
+		return nil, err
+	}
+
+	var event stripeEvent
+	if err := json.Unmarshal(payload, &event); err != nil {
+		return nil, fmt.Errorf("invalid webhook payload: %w", err)
+	}
+
+	intentID := event.Data.Object.PaymentIntent
+	if intentID == "" {
+		intentID = event.Data.Object.ID
+	}
+
+	paymentEvent := &PaymentEvent{ID: event.ID, Type: event.Type, IntentID: intentID}
+	if event.Type == PaymentEventRefunded {
+		object := event.Data.Object
+		paymentEvent.AmountRefunded = Money{Amount: object.AmountRefunded, Currency: strings.ToUpper(object.Currency)}
+	}
+	return paymentEvent, nil
+}
+
+// post sends a form-encoded request and decodes the JSON response into out.
+func (p *StripeProvider) post(ctx context.Context, path string, form url.Values, idempotencyKey string, out interface{}) error {
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, p.BaseURL+path, strings.NewReader(form.Encode()))
+	if err != nil {
+		return fmt.Errorf("failed to build request: %w", err)
+	}
+	req.Header.Set("Authorization", "Bearer "+p.SecretKey)
+	req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+	if idempotencyKey != "" {
+		req.Header.Set(IdempotencyKeyHeader, idempotencyKey)
+	}
+
+	resp, err := p.HTTPClient.Do(req)
+	if err != nil {
+		return fmt.Errorf("stripe request failed: %w", err)
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode >= 400 {
+		var apiErr stripeErrorResponse
+		_ = json.NewDecoder(resp.Body).Decode(&apiErr)
+		return fmt.Errorf("stripe returned %d: %s", resp.StatusCode, apiErr.Error.Message)
+	}
+
+	if err := json.NewDecoder(resp.Body).Decode(out); err != nil {
+		return fmt.Errorf("failed to decode stripe response: %w", err)
+	}
+
+	return nil
+}
+
+func (i stripeIntent) toPaymentIntent() *PaymentIntent {
+	return &PaymentIntent{
+		ID:           i.ID,
+		ClientSecret: i.ClientSecret,
+		Amount:       Money{Amount: i.Amount, Currency: strings.ToUpper(i.Currency)},
+		Status:       i.Status,
+	}
+}
+
+// SignWebhookPayload returns a Stripe-Signature header value for the payload.
+func SignWebhookPayload(secret string, payload []byte, timestamp time.Time) string {
+	ts := strconv.FormatInt(timestamp.Unix(), 10)
+	return fmt.Sprintf("t=%s,v1=%s", ts, computeWebhookSignature(secret, ts, payload))
+}
+
+// VerifyWebhookSignature checks a Stripe-Signature header value. The signature
+// must match one of the v1 entries and the timestamp must be within tolerance.
+func VerifyWebhookSignature(secret, signatureHeader string, payload []byte, tolerance time.Duration, now time.Time) error {
+	var timestamp string
+	var signatures []string
+	for _, part := range strings.Split(signatureHeader, ",") {
+		key, value, found := strings.Cut(strings.TrimSpace(part), "=")
+		if !found {
+			continue
+		}
+		switch key {
+		case "t":
+			timestamp = value
+		case "v1":
+			signatures = append(signatures, value)
+		}
+	}
+
+	if timestamp == "" || len(signatures) == 0 {
+		return fmt.Errorf("%w: malformed header", ErrInvalidWebhookSignature)
+	}
+
+	ts, err := strconv.ParseInt(timestamp, 10, 64)
+	if err != nil {
+		return fmt.Errorf("%w: bad timestamp", ErrInvalidWebhookSignature)
+	}
+	if age := now.Sub(time.Unix(ts, 0)); age > tolerance || age < -tolerance {
+		return fmt.Errorf("%w: timestamp outside tolerance", ErrInvalidWebhookSignature)
+	}
+
+	expected := computeWebhookSignature(secret, timestamp, payload)
+	for _, sig := range signatures {
+		if hmac.Equal([]byte(sig), []byte(expected)) {
+			return nil
+		}
+	}
+
+	return fmt.Errorf("%w: signature mismatch", ErrInvalidWebhookSignature)
+}
+
+func computeWebhookSignature(secret, timestamp string, payload []byte) string {
+	mac := hmac.New(sha256.New, []byte(secret))
+	mac.Write([]byte(timestamp))
+	mac.Write([]byte("."))
+	mac.Write(payload)
+	return hex.EncodeToString(mac.Sum(nil))
+}
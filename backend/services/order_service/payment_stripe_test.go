@@ -0,0 +1,182 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// webhookRecorder is a webhook endpoint that verifies and records events.
+type webhookRecorder struct {
+	mu       sync.Mutex
+	provider *StripeProvider
+	events   []*PaymentEvent
+	rejected int
+}
+
+func (w *webhookRecorder) ServeHTTP(rw http.ResponseWriter, r *http.Request) {
+	payload, _ := io.ReadAll(r.Body)
+	event, err := w.provider.VerifyWebhook(r.Header, payload)
+
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	if err != nil {
+		w.rejected++
+		rw.WriteHeader(http.StatusBadRequest)
+		return
+	}
+	w.events = append(w.events, event)
+	rw.WriteHeader(http.StatusOK)
+}
+
+// newFakeStripe starts a fake provider wired to a recording webhook endpoint
+// and returns a StripeProvider that talks to it.
+func newFakeStripe(t *testing.T) (*StripeProvider, *FakePaymentServer, *webhookRecorder) {
+	recorder := &webhookRecorder{}
+	webhookServer := httptest.NewServer(recorder)
+	t.Cleanup(webhookServer.Close)
+
+	fake := NewFakePaymentServer("sk_test_123", "whsec_123", webhookServer.URL)
+	apiServer := httptest.NewServer(fake)
+	t.Cleanup(apiServer.Close)
+
+	provider := NewStripeProvider(apiServer.URL, "sk_test_123", "whsec_123")
+	provider.ConfirmPaymentMethod = "pm_card_visa"
+	recorder.provider = provider
+
+	return provider, fake, recorder
+}
+
+func TestVerifyWebhookSignature(t *testing.T) {
+	now := time.Date(2026, 2, 7, 10, 0, 0, 0, time.UTC)
+	payload := []byte(`{"id":"evt_1","type":"payment_intent.succeeded"}`)
+	valid := SignWebhookPayload("whsec_123", payload, now)
+
+	tests := []struct {
+		name    string
+		secret  string
+		header  string
+		payload []byte
+		wantErr bool
+	}{
+		{name: "valid", secret: "whsec_123", header: valid, payload: payload},
+		{name: "wrong_secret", secret: "whsec_other", header: valid, payload: payload, wantErr: true},
+		{name: "tampered_payload", secret: "whsec_123", header: valid, payload: []byte(`{"id":"evt_2"}`), wantErr: true},
+		{name: "expired", secret: "whsec_123", header: SignWebhookPayload("whsec_123", payload, now.Add(-10*time.Minute)), payload: payload, wantErr: true},
+		{name: "malformed_header", secret: "whsec_123", header: "garbage", payload: payload, wantErr: true},
+		{name: "empty_header", secret: "whsec_123", header: "", payload: payload, wantErr: true},
+		{name: "second_signature_matches", secret: "whsec_123", header: valid + ",v1=deadbeef", payload: payload},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			err := VerifyWebhookSignature(tt.secret, tt.header, tt.payload, defaultWebhookTolerance, now)
+			if tt.wantErr {
+				assert.True(t, errors.Is(err, ErrInvalidWebhookSignature), "expected invalid signature, got %v", err)
+			} else {
+				assert.NoError(t, err)
+			}
+		})
+	}
+}
+
+func TestStripeProviderPaymentFlow(t *testing.T) {
+	provider, fake, recorder := newFakeStripe(t)
+	ctx := context.Background()
+
+	intent, err := provider.CreatePaymentIntent(ctx, PaymentIntentRequest{
+		Amount:         Money{Amount: 35994, Currency: "LKR"},
+		Reference:      "checkout-1",
+		IdempotencyKey: "payment-1",
+	})
+	require.NoError(t, err)
+	assert.NotEmpty(t, intent.ID)
+	assert.NotEmpty(t, intent.ClientSecret)
+	assert.Equal(t, Money{Amount: 35994, Currency: "LKR"}, intent.Amount)
+	assert.Equal(t, "requires_payment_method", intent.Status)
+
+	// Same idempotency key returns the same intent
+	again, err := provider.CreatePaymentIntent(ctx, PaymentIntentRequest{
+		Amount: Money{Amount: 35994, Currency: "LKR"}, Reference: "checkout-1", IdempotencyKey: "payment-1",
+	})
+	require.NoError(t, err)
+	assert.Equal(t, intent.ID, again.ID)
+
+	confirmed, err := provider.ConfirmPaymentIntent(ctx, intent.ID)
+	require.NoError(t, err)
+	assert.Equal(t, "succeeded", confirmed.Status)
+
+	refund, err := provider.RefundPayment(ctx, intent.ID, lkr(100), "return-1")
+	require.NoError(t, err)
+	assert.Equal(t, intent.ID, refund.IntentID)
+	assert.Equal(t, lkr(100), refund.Amount)
+
+	// Same idempotency key returns the same refund without refunding again
+	refundAgain, err := provider.RefundPayment(ctx, intent.ID, lkr(100), "return-1")
+	require.NoError(t, err)
+	assert.Equal(t, refund.ID, refundAgain.ID)
+
+	// Nothing beyond what is left can be refunded
+	_, err = provider.RefundPayment(ctx, intent.ID, Money{Amount: 25995, Currency: "LKR"}, "return-2")
+	assert.Error(t, err)
+	_, err = provider.RefundPayment(ctx, intent.ID, lkr(200), "return-2")
+	require.NoError(t, err)
+
+	fake.Wait()
+
+	recorder.mu.Lock()
+	defer recorder.mu.Unlock()
+	assert.Equal(t, 0, recorder.rejected)
+	require.Len(t, recorder.events, 3)
+	assert.Equal(t, PaymentEventSucceeded, recorder.events[0].Type)
+	assert.Equal(t, intent.ID, recorder.events[0].IntentID)
+
+	// Each charge.refunded carries the total refunded so far
+	var refunded []Money
+	for _, event := range recorder.events[1:] {
+		assert.Equal(t, PaymentEventRefunded, event.Type)
+		assert.Equal(t, intent.ID, event.IntentID)
+		refunded = append(refunded, event.AmountRefunded)
+	}
+	assert.ElementsMatch(t, []Money{lkr(100), lkr(300)}, refunded)
+}
+
+func TestStripeProviderDeclinedPayment(t *testing.T) {
+	provider, fake, recorder := newFakeStripe(t)
+	provider.ConfirmPaymentMethod = FakeDeclinedPaymentMethod
+	ctx := context.Background()
+
+	intent, err := provider.CreatePaymentIntent(ctx, PaymentIntentRequest{Amount: lkr(10), Reference: "order-1"})
+	require.NoError(t, err)
+
+	confirmed, err := provider.ConfirmPaymentIntent(ctx, intent.ID)
+	require.NoError(t, err)
+	assert.Equal(t, "requires_payment_method", confirmed.Status)
+
+	_, err = provider.RefundPayment(ctx, intent.ID, Money{}, "")
+	assert.Error(t, err, "an unpaid intent cannot be refunded")
+
+	fake.Wait()
+
+	recorder.mu.Lock()
+	defer recorder.mu.Unlock()
+	require.Len(t, recorder.events, 1)
+	assert.Equal(t, PaymentEventFailed, recorder.events[0].Type)
+}
+
+func TestStripeProviderRejectsBadAPIKey(t *testing.T) {
+	provider, _, _ := newFakeStripe(t)
+	provider.SecretKey = "sk_test_wrong"
+
+	_, err := provider.CreatePaymentIntent(context.Background(), PaymentIntentRequest{Amount: lkr(10)})
+	require.Error(t, err)
+	assert.Contains(t, err.Error(), "401")
+}
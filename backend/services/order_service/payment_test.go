@@ -0,0 +1,129 @@
+package main
+
+import (
+	"bytes"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestAmountDue(t *testing.T) {
+	orders := []OrderModel{
+		{OrderID: "o1", Status: StatusPending, TotalPrice: lkr(100)},
+		{OrderID: "o2", Status: StatusPaid, TotalPrice: lkr(50)},
+		{OrderID: "o3", Status: StatusPending, TotalPrice: Money{Amount: 2550, Currency: "LKR"}},
+		{OrderID: "o4", Status: StatusCancelled, TotalPrice: lkr(10)},
+	}
+
+	due, err := amountDue(orders)
+	require.NoError(t, err)
+	assert.Equal(t, Money{Amount: 12550, Currency: "LKR"}, due)
+
+	due, err = amountDue(orders[1:2])
+	require.NoError(t, err)
+	assert.Zero(t, due.Amount)
+
+	orders[3] = OrderModel{OrderID: "o5", Status: StatusPending, TotalPrice: Money{Amount: 500, Currency: "USD"}}
+	_, err = amountDue(orders)
+	assert.ErrorIs(t, err, ErrCurrencyMismatch)
+}
+
+func TestPaymentSummaryStatus(t *testing.T) {
+	order := func(status string) OrderModel { return OrderModel{Status: status} }
+	succeeded := &PaymentModel{Status: PaymentSucceeded}
+
+	tests := []struct {
+		name    string
+		orders  []OrderModel
+		payment *PaymentModel
+		want    string
+	}{
+		{"awaiting payment", []OrderModel{order(StatusPending), order(StatusPaid)}, nil, StatusPending},
+		{"paid", []OrderModel{order(StatusPaid), order(StatusShipped)}, succeeded, StatusPaid},
+		{"one order cancelled", []OrderModel{order(StatusCancelled), order(StatusPaid)}, succeeded, StatusPaid},
+		{"all cancelled", []OrderModel{order(StatusCancelled), order(StatusExpired)}, nil, StatusCancelled},
+		{"all expired", []OrderModel{order(StatusExpired), order(StatusExpired)}, nil, StatusExpired},
+		{"partially refunded", []OrderModel{order(StatusCancelled), order(StatusPaid)}, &PaymentModel{Status: PaymentPartiallyRefunded}, PaymentPartiallyRefunded},
+		{"refunded", []OrderModel{order(StatusCancelled), order(StatusCancelled)}, &PaymentModel{Status: PaymentRefunded}, PaymentRefunded},
+		{"late payment refunded", []OrderModel{order(StatusExpired)}, &PaymentModel{Status: PaymentRefunded}, PaymentRefunded},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			assert.Equal(t, tt.want, paymentSummaryStatus(tt.orders, tt.payment))
+		})
+	}
+}
+
+func TestCheckPaymentConfig(t *testing.T) {
+	assert.NoError(t, checkPaymentConfig("stripe", "sk_live_x", "whsec_x"))
+	assert.Error(t, checkPaymentConfig("stripe", "sk_live_x", ""))
+	assert.Error(t, checkPaymentConfig("stripe", "", "whsec_x"))
+
+	assert.NoError(t, checkPaymentConfig("fake", "", "a-random-secret"))
+	assert.Error(t, checkPaymentConfig("fake", "sk_test_fake", ""), "the fake provider has no well-known webhook secret")
+
+	assert.Error(t, checkPaymentConfig("paypal", "sk", "whsec"))
+}
+
+func TestPaymentWebhookRejectsBadSignature(t *testing.T) {
+	previous := paymentProvider
+	paymentProvider = NewStripeProvider("http://unused", "sk_test_123", "whsec_123")
+	defer func() { paymentProvider = previous }()
+
+	payload := []byte(`{"id":"evt_1","type":"payment_intent.succeeded","data":{"object":{"id":"pi_1"}}}`)
+
+	tests := []struct {
+		name      string
+		signature string
+	}{
+		{name: "missing_signature", signature: ""},
+		{name: "wrong_secret", signature: SignWebhookPayload("whsec_other", payload, time.Now())},
+		{name: "stale_timestamp", signature: SignWebhookPayload("whsec_123", payload, time.Now().Add(-time.Hour))},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			r := setupTestRouter()
+			r.POST("/payments/webhook", HandlePaymentWebhook)
+
+			req, _ := http.NewRequest("POST", "/payments/webhook", bytes.NewReader(payload))
+			if tt.signature != "" {
+				req.Header.Set(StripeSignatureHeader, tt.signature)
+			}
+			w := httptest.NewRecorder()
+			r.ServeHTTP(w, req)
+
+			assert.Equal(t, http.StatusBadRequest, w.Code)
+			assert.Contains(t, w.Body.String(), "Invalid webhook signature")
+		})
+	}
+}
+
+func TestPaymentEndpointsRequireUser(t *testing.T) {
+	r := setupTestRouter()
+	r.GET("/payments/:id", HandleGetPayment)
+	r.POST("/payments/:id/intent", HandleCreatePaymentIntent)
+	r.POST("/payments/:id/confirm", HandleConfirmPayment)
+	r.POST("/payments/webhook", HandlePaymentWebhook)
+
+	for _, route := range []struct{ method, path string }{
+		{"GET", "/payments/checkout-1"},
+		{"POST", "/payments/checkout-1/intent"},
+		{"POST", "/payments/checkout-1/confirm"},
+	} {
+		req, _ := http.NewRequest(route.method, route.path, nil)
+		w := httptest.NewRecorder()
+		r.ServeHTTP(w, req)
+
+		assert.Equal(t, http.StatusUnauthorized, w.Code, route.path)
+	}
+}
+
+func TestPaymentTableNames(t *testing.T) {
+	assert.Equal(t, "payments", PaymentModel{}.TableName())
+	assert.Equal(t, "payment_webhook_events", PaymentWebhookEvent{}.TableName())
+}
@@ -0,0 +1,275 @@
+package main
+
+import (
+	"database/sql/driver"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"strings"
+)
+
+// =============================================================================
+// Pricing: Shipping and Tax
+// =============================================================================
+
+// Every per-seller order is priced on its own, since each seller ships their
+// part of the checkout separately:
+//
+//	subtotal - discount + shipping + tax = total
+//
+// Shipping is quoted by a ShippingRateProvider and tax by a TaxCalculator,
+// both for the order's destination. The default implementations look the
+// destination up in a table keyed by "COUNTRY-REGION", then "COUNTRY", then
+// "*"; a destination with no entry cannot be shipped to.
+
+// ErrUnsupportedDestination is returned when there is no shipping rate or tax
+// rate for an address.
+var ErrUnsupportedDestination = errors.New("destination is not supported")
+
+// Address is a postal address an order is shipped to. Country is an ISO 3166-1
+// alpha-2 code; Region is the state or province code within it.
+type Address struct {
+	Name       string `json:"name,omitempty"`
+	Line1      string `json:"line1,omitempty"`
+	Line2      string `json:"line2,omitempty"`
+	City       string `json:"city,omitempty"`
+	Region     string `json:"region,omitempty"`
+	PostalCode string `json:"postalCode,omitempty"`
+	Country    string `json:"country"`
+	Phone      string `json:"phone,omitempty"`
+}
+
+// Value implements driver.Valuer interface for GORM.
+func (a Address) Value() (driver.Value, error) {
+	return json.Marshal(a)
+}
+
+// Scan implements sql.Scanner interface for GORM.
+func (a *Address) Scan(value interface{}) error {
+	bytes, ok := value.([]byte)
+	if !ok {
+		return fmt.Errorf("failed to unmarshal JSONB value: %v", value)
+	}
+	return json.Unmarshal(bytes, a)
+}
+
+// Normalize trims the address and upper-cases its country and region codes.
+func (a *Address) Normalize() error {
+	a.Name = strings.TrimSpace(a.Name)
+	a.Line1 = strings.TrimSpace(a.Line1)
+	a.Line2 = strings.TrimSpace(a.Line2)
+	a.City = strings.TrimSpace(a.City)
+	a.PostalCode = strings.TrimSpace(a.PostalCode)
+	a.Phone = strings.TrimSpace(a.Phone)
+	a.Region = strings.ToUpper(strings.TrimSpace(a.Region))
+	a.Country = strings.ToUpper(strings.TrimSpace(a.Country))
+
+	if len(a.Country) != 2 {
+		return errors.New("country must be a two-letter ISO country code")
+	}
+	return nil
+}
+
+// destinationKeys returns the table keys to try for an address, most specific
+// first.
+func destinationKeys(dest Address) []string {
+	keys := make([]string, 0, 3)
+	if dest.Region != "" {
+		keys = append(keys, dest.Country+"-"+dest.Region)
+	}
+	return append(keys, dest.Country, "*")
+}
+
+// ShippingRateProvider quotes the cost of shipping a seller's order.
+type ShippingRateProvider interface {
+	// Rate returns the shipping cost for the lines to dest, in the currency
+	// of goodsTotal (the lines' total after discounts).
+	Rate(dest Address, lines []OrderItem, goodsTotal Money) (Money, error)
+}
+
+// TaxCalculator works out the tax due on a seller's order.
+type TaxCalculator interface {
+	// Tax returns the tax due on goodsTotal (the lines' total after
+	// discounts) and the shipping cost for delivery to dest.
+	Tax(dest Address, lines []OrderItem, goodsTotal, shipping Money) (Money, error)
+}
+
+// ShippingRate is a flat shipping charge: Base for the first unit plus
+// PerItem for each further unit. Orders whose goods total reaches FreeOver
+// ship free; zero means never. All three are in the same currency.
+type ShippingRate struct {
+	Base     Money
+	PerItem  Money
+	FreeOver Money
+}
+
+// ShippingRateTable is a ShippingRateProvider keyed by destination. Orders in
+// a currency other than the rate's cannot be shipped.
+type ShippingRateTable map[string]ShippingRate
+
+// Rate implements ShippingRateProvider.
+func (t ShippingRateTable) Rate(dest Address, lines []OrderItem, goodsTotal Money) (Money, error) {
+	rate, ok := lookupDestination(t, dest)
+	if !ok {
+		return Money{}, fmt.Errorf("%w: no shipping to %s", ErrUnsupportedDestination, dest.Country)
+	}
+	if rate.Base.Currency != goodsTotal.Currency {
+		return Money{}, fmt.Errorf("%w: no %s shipping rates to %s", ErrUnsupportedDestination, goodsTotal.Currency, dest.Country)
+	}
+
+	free := Money{Currency: goodsTotal.Currency}
+	if rate.FreeOver.Amount > 0 && goodsTotal.Amount >= rate.FreeOver.Amount {
+		return free, nil
+	}
+
+	units := 0
+	for _, line := range lines {
+		units += line.Quantity
+	}
+	if units == 0 {
+		return free, nil
+	}
+
+	return rate.Base.Add(rate.PerItem.Times(units - 1))
+}
+
+// TaxRate is a sales tax or VAT rate in basis points (1800 = 18%). When
+// IncludeShipping is set the shipping cost is taxed along with the goods.
+type TaxRate struct {
+	BasisPoints     int64
+	IncludeShipping bool
+}
+
+// TaxTable is a TaxCalculator keyed by destination.
+type TaxTable map[string]TaxRate
+
+// Tax implements TaxCalculator. Tax is rounded half up to the minor unit.
+func (t TaxTable) Tax(dest Address, lines []OrderItem, goodsTotal, shipping Money) (Money, error) {
+	rate, ok := lookupDestination(t, dest)
+	if !ok {
+		return Money{}, fmt.Errorf("%w: no tax rate for %s", ErrUnsupportedDestination, dest.Country)
+	}
+
+	taxable := goodsTotal
+	if rate.IncludeShipping {
+		var err error
+		if taxable, err = taxable.Add(shipping); err != nil {
+			return Money{}, err
+		}
+	}
+	return taxable.Scale(rate.BasisPoints, 10000), nil
+}
+
+// lookupDestination returns the most specific table entry for dest.
+func lookupDestination[T any](table map[string]T, dest Address) (T, bool) {
+	for _, key := range destinationKeys(dest) {
+		if entry, ok := table[key]; ok {
+			return entry, true
+		}
+	}
+	var zero T
+	return zero, false
+}
+
+// lkr returns an amount of whole Sri Lankan rupees.
+func lkr(rupees int64) Money {
+	return Money{Amount: rupees * 100, Currency: "LKR"}
+}
+
+// DefaultShippingRates are the built-in shipping charges in LKR. Deliveries
+// within Sri Lanka are cheapest in the Western Province, where the warehouses
+// are.
+var DefaultShippingRates = ShippingRateTable{
+	"LK-WP": {Base: lkr(250), PerItem: lkr(50), FreeOver: lkr(15000)},
+	"LK":    {Base: lkr(450), PerItem: lkr(100), FreeOver: lkr(25000)},
+	"*":     {Base: lkr(6500), PerItem: lkr(1500)},
+}
+
+// DefaultTaxRates are the built-in tax rates. Sri Lankan orders carry 18% VAT
+// on goods and delivery; exports are zero-rated.
+var DefaultTaxRates = TaxTable{
+	"LK": {BasisPoints: 1800, IncludeShipping: true},
+	"*":  {BasisPoints: 0},
+}
+
+// PriceBreakdown is the priced total of an order or checkout.
+type PriceBreakdown struct {
+	Subtotal Money `json:"subtotal"`
+	Discount Money `json:"discount,omitzero"`
+	Shipping Money `json:"shipping"`
+	Tax      Money `json:"tax"`
+	Total    Money `json:"total"`
+}
+
+// Add accumulates another breakdown into b. It fails if the two are in
+// different currencies.
+func (b *PriceBreakdown) Add(other PriceBreakdown) error {
+	sum := *b
+	var err error
+	for _, pair := range []struct{ into, from *Money }{
+		{&sum.Subtotal, &other.Subtotal},
+		{&sum.Discount, &other.Discount},
+		{&sum.Shipping, &other.Shipping},
+		{&sum.Tax, &other.Tax},
+		{&sum.Total, &other.Total},
+	} {
+		if *pair.into, err = pair.into.Add(*pair.from); err != nil {
+			return err
+		}
+	}
+	*b = sum
+	return nil
+}
+
+// Pricer prices orders with pluggable shipping and tax rules.
+type Pricer struct {
+	Shipping ShippingRateProvider
+	Tax      TaxCalculator
+}
+
+// PriceOrder prices one seller's snapshotted lines for delivery to dest. Line
+// totals are expected to already have any coupon discount deducted, and all
+// lines must be in one currency.
+func (p Pricer) PriceOrder(dest Address, lines []OrderItem) (PriceBreakdown, error) {
+	var goods, discount Money
+	var err error
+	for _, line := range lines {
+		if goods, err = goods.Add(line.LineTotal); err != nil {
+			return PriceBreakdown{}, err
+		}
+		if discount, err = discount.Add(line.Discount); err != nil {
+			return PriceBreakdown{}, err
+		}
+	}
+	discount.Currency = goods.Currency
+
+	shipping, err := p.Shipping.Rate(dest, lines, goods)
+	if err != nil {
+		return PriceBreakdown{}, err
+	}
+
+	tax, err := p.Tax.Tax(dest, lines, goods, shipping)
+	if err != nil {
+		return PriceBreakdown{}, err
+	}
+
+	subtotal, err := goods.Add(discount)
+	if err != nil {
+		return PriceBreakdown{}, err
+	}
+	total, err := goods.Add(shipping)
+	if err == nil {
+		total, err = total.Add(tax)
+	}
+	if err != nil {
+		return PriceBreakdown{}, err
+	}
+
+	return PriceBreakdown{
+		Subtotal: subtotal,
+		Discount: discount,
+		Shipping: shipping,
+		Tax:      tax,
+		Total:    total,
+	}, nil
+}
@@ -0,0 +1,118 @@
+package main
+
+import (
+	"errors"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestAddressNormalize(t *testing.T) {
+	address := Address{Line1: " 12 Galle Rd ", City: "Colombo", Region: " wp", Country: "lk "}
+	require.NoError(t, address.Normalize())
+	assert.Equal(t, "12 Galle Rd", address.Line1)
+	assert.Equal(t, "WP", address.Region)
+	assert.Equal(t, "LK", address.Country)
+
+	assert.Error(t, (&Address{Country: "Sri Lanka"}).Normalize())
+	assert.Error(t, (&Address{}).Normalize())
+}
+
+func TestShippingRateTable(t *testing.T) {
+	table := ShippingRateTable{
+		"LK-WP": {Base: lkr(250), PerItem: lkr(50), FreeOver: lkr(15000)},
+		"LK":    {Base: lkr(450), PerItem: lkr(100)},
+	}
+	lines := []OrderItem{{Quantity: 2}, {Quantity: 1}}
+
+	tests := []struct {
+		name  string
+		dest  Address
+		goods Money
+		want  Money
+	}{
+		{"region rate", Address{Country: "LK", Region: "WP"}, lkr(1000), lkr(350)},
+		{"free over threshold", Address{Country: "LK", Region: "WP"}, lkr(15000), lkr(0)},
+		{"falls back to country", Address{Country: "LK", Region: "CP"}, lkr(1000), lkr(650)},
+		{"country without region", Address{Country: "LK"}, lkr(50000), lkr(650)},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			rate, err := table.Rate(tt.dest, lines, tt.goods)
+			require.NoError(t, err)
+			assert.Equal(t, tt.want, rate)
+		})
+	}
+
+	_, err := table.Rate(Address{Country: "US"}, lines, lkr(1000))
+	assert.True(t, errors.Is(err, ErrUnsupportedDestination))
+
+	_, err = table.Rate(Address{Country: "LK"}, lines, Money{Amount: 1000, Currency: "USD"})
+	assert.True(t, errors.Is(err, ErrUnsupportedDestination), "no rates in the order's currency")
+}
+
+func TestTaxTable(t *testing.T) {
+	table := TaxTable{
+		"US-CA": {BasisPoints: 725},
+		"LK":    {BasisPoints: 1800, IncludeShipping: true},
+		"*":     {BasisPoints: 0},
+	}
+
+	tax, err := table.Tax(Address{Country: "LK"}, nil, lkr(1000), lkr(250))
+	require.NoError(t, err)
+	assert.Equal(t, lkr(225), tax)
+
+	tax, err = table.Tax(Address{Country: "US", Region: "CA"}, nil, lkr(1000), lkr(250))
+	require.NoError(t, err)
+	assert.Equal(t, Money{Amount: 7250, Currency: "LKR"}, tax)
+
+	tax, err = table.Tax(Address{Country: "US", Region: "CA"}, nil, Money{Amount: 1999, Currency: "USD"}, Money{})
+	require.NoError(t, err)
+	assert.Equal(t, Money{Amount: 145, Currency: "USD"}, tax, "144.93 cents rounds to 145")
+
+	tax, err = table.Tax(Address{Country: "DE"}, nil, lkr(1000), lkr(250))
+	require.NoError(t, err)
+	assert.Equal(t, lkr(0), tax)
+
+	_, err = TaxTable{"LK": {BasisPoints: 1800}}.Tax(Address{Country: "IN"}, nil, lkr(1000), lkr(0))
+	assert.True(t, errors.Is(err, ErrUnsupportedDestination))
+}
+
+func TestPriceOrder(t *testing.T) {
+	p := Pricer{
+		Shipping: ShippingRateTable{"LK": {Base: lkr(400), PerItem: lkr(100)}},
+		Tax:      TaxTable{"LK": {BasisPoints: 1800, IncludeShipping: true}},
+	}
+	lines := []OrderItem{
+		{ProductID: "p1", Quantity: 2, Price: lkr(1000), LineTotal: lkr(1800), Discount: lkr(200)},
+		{ProductID: "p2", Quantity: 1, Price: lkr(500), LineTotal: lkr(500)},
+	}
+
+	price, err := p.PriceOrder(Address{Country: "LK"}, lines)
+	require.NoError(t, err)
+	assert.Equal(t, PriceBreakdown{
+		Subtotal: lkr(2500),
+		Discount: lkr(200),
+		Shipping: lkr(600),
+		Tax:      lkr(522),
+		Total:    lkr(3422),
+	}, price)
+
+	_, err = p.PriceOrder(Address{Country: "GB"}, lines)
+	assert.True(t, errors.Is(err, ErrUnsupportedDestination))
+}
+
+func TestPriceBreakdownAdd(t *testing.T) {
+	cents := func(amount int64) Money { return Money{Amount: amount, Currency: "LKR"} }
+
+	var total PriceBreakdown
+	require.NoError(t, total.Add(PriceBreakdown{Subtotal: cents(1010), Shipping: cents(220), Tax: cents(30), Total: cents(1260)}))
+	require.NoError(t, total.Add(PriceBreakdown{Subtotal: cents(2020), Discount: cents(100), Shipping: cents(0), Tax: cents(10), Total: cents(1930)}))
+
+	assert.Equal(t, PriceBreakdown{Subtotal: cents(3030), Discount: cents(100), Shipping: cents(220), Tax: cents(40), Total: cents(3190)}, total)
+
+	err := total.Add(PriceBreakdown{Subtotal: Money{Amount: 100, Currency: "USD"}})
+	assert.ErrorIs(t, err, ErrCurrencyMismatch)
+	assert.Equal(t, cents(3030), total.Subtotal, "a failed Add leaves the breakdown unchanged")
+}
@@ -0,0 +1,505 @@
+package main
+
+import (
+	"database/sql/driver"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"math"
+	"net/http"
+	"regexp"
+	"strings"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/google/uuid"
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+)
+
+// =============================================================================
+// Coupons and Promotions
+// =============================================================================
+
+// Coupon types.
+const (
+	CouponPercentage = "percentage"  // Value percent off each eligible line
+	CouponFixed      = "fixed"       // Amount off the eligible lines, spread by line total
+	CouponBuyXGetY   = "buy_x_get_y" // for every BuyQuantity+GetQuantity units of a product, GetQuantity are free
+)
+
+// ErrCouponNotFound is returned when a code does not exist or was deactivated.
+var ErrCouponNotFound = errors.New("coupon not found")
+
+// ErrCouponNotActive is returned outside a coupon's validity window.
+var ErrCouponNotActive = errors.New("coupon is not active")
+
+// ErrCouponNotApplicable is returned when no item in the order qualifies for
+// the coupon.
+var ErrCouponNotApplicable = errors.New("coupon does not apply to these items")
+
+// ErrCouponExhausted is returned when a coupon's total or per-buyer usage
+// limit has been reached.
+var ErrCouponExhausted = errors.New("coupon usage limit reached")
+
+// couponCodePattern is the accepted format for coupon codes, after upper-casing.
+var couponCodePattern = regexp.MustCompile(`^[A-Z0-9_-]{3,32}$`)
+
+// StringList is a JSONB column type for storing a list of strings.
+type StringList []string
+
+// Value implements driver.Valuer interface for GORM.
+func (s StringList) Value() (driver.Value, error) {
+	if s == nil {
+		return []byte("[]"), nil
+	}
+	return json.Marshal(s)
+}
+
+// Scan implements sql.Scanner interface for GORM.
+func (s *StringList) Scan(value interface{}) error {
+	bytes, ok := value.([]byte)
+	if !ok {
+		return fmt.Errorf("failed to unmarshal JSONB value: %v", value)
+	}
+	return json.Unmarshal(bytes, s)
+}
+
+// CouponModel represents the coupons table in PostgreSQL. Every coupon belongs
+// to a seller and only discounts that seller's products: all of them, or just
+// ProductIDs when set.
+type CouponModel struct {
+	Code          string     `gorm:"primaryKey;column:code" json:"code"`
+	SellerID      string     `gorm:"not null;index;column:seller_id" json:"sellerId"`
+	Type          string     `gorm:"not null;column:type" json:"type"`
+	Value         float64    `gorm:"not null;default:0;column:value" json:"value,omitempty"`
+	Amount        Money      `gorm:"embedded;embeddedPrefix:amount_" json:"amount,omitzero"`
+	BuyQuantity   int        `gorm:"not null;default:0;column:buy_quantity" json:"buyQuantity,omitempty"`
+	GetQuantity   int        `gorm:"not null;default:0;column:get_quantity" json:"getQuantity,omitempty"`
+	ProductIDs    StringList `gorm:"type:jsonb;not null;default:'[]';column:product_ids" json:"productIds"`
+	UsageLimit    int        `gorm:"not null;default:0;column:usage_limit" json:"usageLimit"`        // 0 = unlimited
+	PerBuyerLimit int        `gorm:"not null;default:0;column:per_buyer_limit" json:"perBuyerLimit"` // 0 = unlimited
+	UsedCount     int        `gorm:"not null;default:0;column:used_count" json:"usedCount"`
+	StartsAt      *time.Time `gorm:"column:starts_at" json:"startsAt,omitempty"`
+	EndsAt        *time.Time `gorm:"column:ends_at" json:"endsAt,omitempty"`
+	Active        bool       `gorm:"not null;default:true;column:active" json:"active"`
+	CreatedAt     time.Time  `gorm:"autoCreateTime;column:created_at" json:"createdAt"`
+	UpdatedAt     time.Time  `gorm:"autoUpdateTime;column:updated_at" json:"updatedAt"`
+}
+
+// TableName specifies the table name for GORM.
+func (CouponModel) TableName() string {
+	return "coupons"
+}
+
+// CouponRedemption represents the coupon_redemptions table in PostgreSQL.
+// One row is written for every checkout that used a coupon.
+type CouponRedemption struct {
+	RedemptionID string    `gorm:"primaryKey;type:uuid;column:redemption_id" json:"redemptionId"`
+	Code         string    `gorm:"not null;index:idx_redemptions_code_buyer,priority:1;column:code" json:"code"`
+	BuyerID      string    `gorm:"not null;index:idx_redemptions_code_buyer,priority:2;column:buyer_id" json:"buyerId"`
+	CheckoutID   string    `gorm:"type:uuid;not null;uniqueIndex;column:checkout_id" json:"checkoutId"`
+	Discount     Money     `gorm:"embedded;embeddedPrefix:discount_" json:"discount"`
+	CreatedAt    time.Time `gorm:"autoCreateTime;column:created_at" json:"createdAt"`
+}
+
+// TableName specifies the table name for GORM.
+func (CouponRedemption) TableName() string {
+	return "coupon_redemptions"
+}
+
+// CreateCouponInput represents the expected JSON body for creating a coupon.
+type CreateCouponInput struct {
+	Code          string     `json:"code" binding:"required"`
+	Type          string     `json:"type" binding:"required"`
+	Value         float64    `json:"value"`
+	Amount        *Money     `json:"amount"`
+	BuyQuantity   int        `json:"buyQuantity"`
+	GetQuantity   int        `json:"getQuantity"`
+	ProductIDs    []string   `json:"productIds"`
+	UsageLimit    int        `json:"usageLimit"`
+	PerBuyerLimit int        `json:"perBuyerLimit"`
+	StartsAt      *time.Time `json:"startsAt"`
+	EndsAt        *time.Time `json:"endsAt"`
+}
+
+// NormalizeCouponCode trims and upper-cases a code so codes match regardless of
+// how the buyer typed them.
+func NormalizeCouponCode(code string) string {
+	return strings.ToUpper(strings.TrimSpace(code))
+}
+
+// Validate checks a coupon definition and returns the first problem found.
+func (in CreateCouponInput) Validate() error {
+	if !couponCodePattern.MatchString(NormalizeCouponCode(in.Code)) {
+		return errors.New("code must be 3-32 letters, digits, '-' or '_'")
+	}
+
+	switch in.Type {
+	case CouponPercentage:
+		if in.Value <= 0 || in.Value > 100 {
+			return errors.New("percentage value must be greater than 0 and at most 100")
+		}
+	case CouponFixed:
+		if in.Amount == nil || in.Amount.Amount <= 0 {
+			return errors.New("fixed amount must be greater than 0")
+		}
+		if _, err := NormalizeCurrency(in.Amount.Currency); err != nil {
+			return err
+		}
+	case CouponBuyXGetY:
+		if in.BuyQuantity < 1 || in.GetQuantity < 1 {
+			return errors.New("buyQuantity and getQuantity must be at least 1")
+		}
+	default:
+		return fmt.Errorf("type must be %s, %s or %s", CouponPercentage, CouponFixed, CouponBuyXGetY)
+	}
+
+	if in.UsageLimit < 0 || in.PerBuyerLimit < 0 {
+		return errors.New("usage limits cannot be negative")
+	}
+	if in.StartsAt != nil && in.EndsAt != nil && !in.EndsAt.After(*in.StartsAt) {
+		return errors.New("endsAt must be after startsAt")
+	}
+
+	return nil
+}
+
+// CheckActive reports whether the coupon can be used at the given time.
+func (cp *CouponModel) CheckActive(now time.Time) error {
+	if !cp.Active {
+		return ErrCouponNotFound
+	}
+	if cp.StartsAt != nil && now.Before(*cp.StartsAt) {
+		return fmt.Errorf("%w: starts at %s", ErrCouponNotActive, cp.StartsAt.UTC().Format(time.RFC3339))
+	}
+	if cp.EndsAt != nil && !now.Before(*cp.EndsAt) {
+		return fmt.Errorf("%w: ended at %s", ErrCouponNotActive, cp.EndsAt.UTC().Format(time.RFC3339))
+	}
+	return nil
+}
+
+// CheckRedeemable reports whether the coupon can be used once more at the
+// given time by a buyer who has already used it buyerUses times.
+func (cp *CouponModel) CheckRedeemable(now time.Time, buyerUses int64) error {
+	if err := cp.CheckActive(now); err != nil {
+		return err
+	}
+	if cp.UsageLimit > 0 && cp.UsedCount >= cp.UsageLimit {
+		return ErrCouponExhausted
+	}
+	if cp.PerBuyerLimit > 0 && buyerUses >= int64(cp.PerBuyerLimit) {
+		return ErrCouponExhausted
+	}
+	return nil
+}
+
+// Eligible reports whether an order line qualifies for the coupon.
+func (cp *CouponModel) Eligible(line OrderItem) bool {
+	if line.SellerID != cp.SellerID {
+		return false
+	}
+	if len(cp.ProductIDs) == 0 {
+		return true
+	}
+	for _, id := range cp.ProductIDs {
+		if id == line.ProductID {
+			return true
+		}
+	}
+	return false
+}
+
+// ApplyCoupon discounts the eligible snapshotted lines in place, setting each
+// line's Discount and CouponCode and reducing its LineTotal. It returns the
+// total discount, or ErrCouponNotApplicable if nothing was discounted.
+func ApplyCoupon(coupon *CouponModel, lines []OrderItem) (Money, error) {
+	discounts := make([]Money, len(lines))
+
+	switch coupon.Type {
+	case CouponPercentage:
+		basisPoints := int64(math.Round(coupon.Value * 100))
+		for i, line := range lines {
+			if coupon.Eligible(line) {
+				discounts[i] = line.LineTotal.Scale(basisPoints, 10000)
+			}
+		}
+	case CouponFixed:
+		// Spread the amount over the eligible lines in proportion to their
+		// totals; the last eligible line takes the rounding remainder
+		var eligibleTotal Money
+		last := -1
+		for i, line := range lines {
+			if !coupon.Eligible(line) {
+				continue
+			}
+			total, err := eligibleTotal.Add(line.LineTotal)
+			if err != nil {
+				return Money{}, err
+			}
+			eligibleTotal = total
+			last = i
+		}
+		if last < 0 || eligibleTotal.Amount <= 0 {
+			break
+		}
+		if eligibleTotal.Currency != coupon.Amount.Currency {
+			return Money{}, fmt.Errorf("%w: coupon is in %s", ErrCouponNotApplicable, coupon.Amount.Currency)
+		}
+
+		amount := coupon.Amount
+		if amount.Amount > eligibleTotal.Amount {
+			amount = eligibleTotal
+		}
+		remaining := amount
+		for i, line := range lines {
+			if !coupon.Eligible(line) {
+				continue
+			}
+			if i == last {
+				discounts[i] = remaining
+				break
+			}
+			discounts[i] = amount.Scale(line.LineTotal.Amount, eligibleTotal.Amount)
+			remaining.Amount -= discounts[i].Amount
+		}
+	case CouponBuyXGetY:
+		group := coupon.BuyQuantity + coupon.GetQuantity
+		for i, line := range lines {
+			if coupon.Eligible(line) && group > 0 {
+				free := line.Quantity / group * coupon.GetQuantity
+				discounts[i] = line.Price.Times(free)
+			}
+		}
+	}
+
+	var total Money
+	for i, discount := range discounts {
+		if discount.Amount <= 0 {
+			continue
+		}
+		lineTotal, err := lines[i].LineTotal.Sub(discount)
+		if err != nil {
+			return Money{}, err
+		}
+		if total, err = total.Add(discount); err != nil {
+			return Money{}, err
+		}
+		lines[i].Discount = discount
+		lines[i].CouponCode = coupon.Code
+		lines[i].LineTotal = lineTotal
+	}
+
+	if total.Amount <= 0 {
+		return Money{}, ErrCouponNotApplicable
+	}
+	return total, nil
+}
+
+// LoadCoupon returns the active coupon with the given code.
+func LoadCoupon(tx *gorm.DB, code string) (*CouponModel, error) {
+	var coupon CouponModel
+	err := tx.Where("code = ? AND active", NormalizeCouponCode(code)).First(&coupon).Error
+	if errors.Is(err, gorm.ErrRecordNotFound) {
+		return nil, ErrCouponNotFound
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to load coupon: %w", err)
+	}
+	return &coupon, nil
+}
+
+// RedeemCoupon records a coupon use for a checkout. It must be called inside
+// the transaction that creates the checkout. The coupon row is locked so
+// concurrent checkouts cannot exceed its usage limits.
+func RedeemCoupon(tx *gorm.DB, code, buyerID, checkoutID string, discount Money, now time.Time) error {
+	var coupon CouponModel
+	err := tx.Clauses(clause.Locking{Strength: "UPDATE"}).
+		Where("code = ? AND active", code).
+		First(&coupon).Error
+	if errors.Is(err, gorm.ErrRecordNotFound) {
+		return ErrCouponNotFound
+	}
+	if err != nil {
+		return fmt.Errorf("failed to load coupon: %w", err)
+	}
+
+	var used int64
+	if coupon.PerBuyerLimit > 0 {
+		if err := tx.Model(&CouponRedemption{}).Where("code = ? AND buyer_id = ?", code, buyerID).Count(&used).Error; err != nil {
+			return fmt.Errorf("failed to count coupon uses: %w", err)
+		}
+	}
+	if err := coupon.CheckRedeemable(now, used); err != nil {
+		return err
+	}
+
+	if err := tx.Model(&coupon).Update("used_count", gorm.Expr("used_count + 1")).Error; err != nil {
+		return fmt.Errorf("failed to update coupon usage: %w", err)
+	}
+
+	redemption := CouponRedemption{
+		RedemptionID: uuid.New().String(),
+		Code:         code,
+		BuyerID:      buyerID,
+		CheckoutID:   checkoutID,
+		Discount:     discount,
+	}
+	if err := tx.Create(&redemption).Error; err != nil {
+		return fmt.Errorf("failed to record coupon use: %w", err)
+	}
+
+	return nil
+}
+
+// couponErrorStatus maps a coupon error to an HTTP status code.
+func couponErrorStatus(err error) int {
+	switch {
+	case errors.Is(err, ErrCouponNotFound):
+		return http.StatusNotFound
+	case errors.Is(err, ErrCouponNotActive), errors.Is(err, ErrCouponNotApplicable):
+		return http.StatusUnprocessableEntity
+	case errors.Is(err, ErrCouponExhausted):
+		return http.StatusConflict
+	default:
+		return http.StatusInternalServerError
+	}
+}
+
+// sellerID returns the caller's user ID if they have the seller role, writing
+// an error response otherwise.
+func sellerID(c *gin.Context) (string, bool) {
+	customRole, _ := c.Get("customRole")
+	if customRole != "seller" {
+		c.JSON(http.StatusForbidden, ErrorResponse{Error: "Only sellers can manage coupons"})
+		return "", false
+	}
+
+	userID, exists := c.Get("userId")
+	if !exists {
+		c.JSON(http.StatusUnauthorized, ErrorResponse{Error: "User ID not found in token"})
+		return "", false
+	}
+
+	return userID.(string), true
+}
+
+// HandleCreateCoupon godoc
+// @Summary Create a coupon
+// @Description Creates a coupon code that discounts the calling seller's products
+// @Tags coupons
+// @Accept json
+// @Produce json
+// @Param request body CreateCouponInput true "Coupon definition"
+// @Success 201 {object} CouponModel
+// @Failure 400 {object} ErrorResponse
+// @Failure 401 {object} ErrorResponse
+// @Failure 403 {object} ErrorResponse
+// @Failure 409 {object} ErrorResponse
+// @Router /coupons [post]
+func HandleCreateCoupon(c *gin.Context) {
+	var input CreateCouponInput
+	if err := c.ShouldBindJSON(&input); err != nil {
+		c.JSON(http.StatusBadRequest, ErrorResponse{Error: "Invalid request. Code and type are required."})
+		return
+	}
+	if err := input.Validate(); err != nil {
+		c.JSON(http.StatusBadRequest, ErrorResponse{Error: "Invalid coupon: " + err.Error()})
+		return
+	}
+
+	seller, ok := sellerID(c)
+	if !ok {
+		return
+	}
+
+	coupon := CouponModel{
+		Code:          NormalizeCouponCode(input.Code),
+		SellerID:      seller,
+		Type:          input.Type,
+		Value:         input.Value,
+		BuyQuantity:   input.BuyQuantity,
+		GetQuantity:   input.GetQuantity,
+		ProductIDs:    StringList(input.ProductIDs),
+		UsageLimit:    input.UsageLimit,
+		PerBuyerLimit: input.PerBuyerLimit,
+		StartsAt:      input.StartsAt,
+		EndsAt:        input.EndsAt,
+		Active:        true,
+	}
+	if input.Type == CouponFixed {
+		coupon.Value = 0
+		coupon.Amount = *input.Amount
+		coupon.Amount.Currency, _ = NormalizeCurrency(input.Amount.Currency)
+	}
+
+	result := db.Clauses(clause.OnConflict{DoNothing: true}).Create(&coupon)
+	if result.Error != nil {
+		c.JSON(http.StatusInternalServerError, ErrorResponse{Error: "Failed to create coupon"})
+		return
+	}
+	if result.RowsAffected == 0 {
+		c.JSON(http.StatusConflict, ErrorResponse{Error: "Coupon code already exists"})
+		return
+	}
+
+	c.JSON(http.StatusCreated, coupon)
+}
+
+// HandleGetCoupons godoc
+// @Summary List coupons
+// @Description Lists the calling seller's coupons, newest first
+// @Tags coupons
+// @Produce json
+// @Success 200 {object} []CouponModel
+// @Failure 401 {object} ErrorResponse
+// @Failure 403 {object} ErrorResponse
+// @Router /coupons [get]
+func HandleGetCoupons(c *gin.Context) {
+	seller, ok := sellerID(c)
+	if !ok {
+		return
+	}
+
+	var coupons []CouponModel
+	if err := db.Where("seller_id = ?", seller).Order("created_at DESC").Find(&coupons).Error; err != nil {
+		c.JSON(http.StatusInternalServerError, ErrorResponse{Error: "Failed to fetch coupons"})
+		return
+	}
+
+	c.JSON(http.StatusOK, coupons)
+}
+
+// HandleDeactivateCoupon godoc
+// @Summary Deactivate a coupon
+// @Description Stops a coupon from being used; past redemptions are kept
+// @Tags coupons
+// @Produce json
+// @Param code path string true "Coupon code"
+// @Success 200 {object} map[string]string
+// @Failure 401 {object} ErrorResponse
+// @Failure 403 {object} ErrorResponse
+// @Failure 404 {object} ErrorResponse
+// @Router /coupons/{code} [delete]
+func HandleDeactivateCoupon(c *gin.Context) {
+	code := NormalizeCouponCode(c.Param("code"))
+
+	seller, ok := sellerID(c)
+	if !ok {
+		return
+	}
+
+	result := db.Model(&CouponModel{}).
+		Where("code = ? AND seller_id = ?", code, seller).
+		Update("active", false)
+	if result.Error != nil {
+		c.JSON(http.StatusInternalServerError, ErrorResponse{Error: "Failed to deactivate coupon"})
+		return
+	}
+	if result.RowsAffected == 0 {
+		c.JSON(http.StatusNotFound, ErrorResponse{Error: "Coupon not found"})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"message": "Coupon deactivated", "code": code})
+}
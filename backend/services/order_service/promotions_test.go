@@ -0,0 +1,213 @@
+package main
+
+import (
+	"bytes"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func couponLines() []OrderItem {
+	return []OrderItem{
+		SnapshotOrderItem(OrderItem{ProductID: "p1", Quantity: 2}, "Headphones", lkr(5000), "s1"),
+		SnapshotOrderItem(OrderItem{ProductID: "p2", Quantity: 5}, "Cable", lkr(300), "s1"),
+		SnapshotOrderItem(OrderItem{ProductID: "p3", Quantity: 1}, "Mouse", lkr(2000), "s2"),
+	}
+}
+
+func TestCreateCouponInputValidate(t *testing.T) {
+	start := time.Date(2026, 3, 1, 0, 0, 0, 0, time.UTC)
+	end := start.Add(24 * time.Hour)
+
+	tests := []struct {
+		name      string
+		input     CreateCouponInput
+		expectErr bool
+	}{
+		{name: "percentage", input: CreateCouponInput{Code: "spring10", Type: CouponPercentage, Value: 10}},
+		{name: "fixed_with_window", input: CreateCouponInput{Code: "LKR500", Type: CouponFixed, Amount: &Money{Amount: 50000, Currency: "LKR"}, StartsAt: &start, EndsAt: &end}},
+		{name: "buy_x_get_y", input: CreateCouponInput{Code: "B2G1", Type: CouponBuyXGetY, BuyQuantity: 2, GetQuantity: 1}},
+		{name: "short_code", input: CreateCouponInput{Code: "AB", Type: CouponFixed, Amount: &Money{Amount: 100}}, expectErr: true},
+		{name: "code_with_space", input: CreateCouponInput{Code: "TEN OFF", Type: CouponFixed, Amount: &Money{Amount: 100}}, expectErr: true},
+		{name: "percentage_over_100", input: CreateCouponInput{Code: "ALLFREE", Type: CouponPercentage, Value: 150}, expectErr: true},
+		{name: "fixed_zero", input: CreateCouponInput{Code: "ZERO", Type: CouponFixed}, expectErr: true},
+		{name: "fixed_value_without_amount", input: CreateCouponInput{Code: "VALUE", Type: CouponFixed, Value: 500}, expectErr: true},
+		{name: "fixed_bad_currency", input: CreateCouponInput{Code: "RUPEES", Type: CouponFixed, Amount: &Money{Amount: 100, Currency: "RS"}}, expectErr: true},
+		{name: "buy_x_get_zero", input: CreateCouponInput{Code: "B2G0", Type: CouponBuyXGetY, BuyQuantity: 2}, expectErr: true},
+		{name: "unknown_type", input: CreateCouponInput{Code: "FREESHIP", Type: "shipping", Value: 1}, expectErr: true},
+		{name: "negative_limit", input: CreateCouponInput{Code: "LIMIT", Type: CouponFixed, Amount: &Money{Amount: 100}, UsageLimit: -1}, expectErr: true},
+		{name: "ends_before_start", input: CreateCouponInput{Code: "WINDOW", Type: CouponFixed, Amount: &Money{Amount: 100}, StartsAt: &end, EndsAt: &start}, expectErr: true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			err := tt.input.Validate()
+			if tt.expectErr {
+				assert.Error(t, err)
+			} else {
+				assert.NoError(t, err)
+			}
+		})
+	}
+}
+
+func TestCouponCheckActive(t *testing.T) {
+	start := time.Date(2026, 3, 1, 0, 0, 0, 0, time.UTC)
+	end := start.Add(24 * time.Hour)
+	coupon := CouponModel{Active: true, StartsAt: &start, EndsAt: &end}
+
+	assert.NoError(t, coupon.CheckActive(start))
+	assert.ErrorIs(t, coupon.CheckActive(start.Add(-time.Second)), ErrCouponNotActive)
+	assert.ErrorIs(t, coupon.CheckActive(end), ErrCouponNotActive)
+
+	coupon.Active = false
+	assert.ErrorIs(t, coupon.CheckActive(start), ErrCouponNotFound)
+}
+
+func TestCouponCheckRedeemable(t *testing.T) {
+	now := time.Date(2026, 3, 1, 0, 0, 0, 0, time.UTC)
+	coupon := CouponModel{Active: true, UsageLimit: 2, PerBuyerLimit: 1, UsedCount: 1}
+
+	assert.NoError(t, coupon.CheckRedeemable(now, 0))
+	assert.ErrorIs(t, coupon.CheckRedeemable(now, 1), ErrCouponExhausted, "the buyer has used their one redemption")
+
+	coupon.UsedCount = 2
+	assert.ErrorIs(t, coupon.CheckRedeemable(now, 0), ErrCouponExhausted)
+
+	unlimited := CouponModel{Active: true, UsedCount: 500}
+	assert.NoError(t, unlimited.CheckRedeemable(now, 500))
+}
+
+func TestCouponEligible(t *testing.T) {
+	sellerWide := CouponModel{SellerID: "s1"}
+	assert.True(t, sellerWide.Eligible(OrderItem{ProductID: "p1", SellerID: "s1"}))
+	assert.False(t, sellerWide.Eligible(OrderItem{ProductID: "p3", SellerID: "s2"}), "other sellers' products never qualify")
+
+	productScoped := CouponModel{SellerID: "s1", ProductIDs: StringList{"p2"}}
+	assert.True(t, productScoped.Eligible(OrderItem{ProductID: "p2", SellerID: "s1"}))
+	assert.False(t, productScoped.Eligible(OrderItem{ProductID: "p1", SellerID: "s1"}))
+}
+
+func TestApplyCoupon(t *testing.T) {
+	t.Run("percentage_seller_scoped", func(t *testing.T) {
+		lines := couponLines()
+		discount, err := ApplyCoupon(&CouponModel{Code: "TEN", SellerID: "s1", Type: CouponPercentage, Value: 10}, lines)
+
+		require.NoError(t, err)
+		assert.Equal(t, lkr(1150), discount)
+		assert.Equal(t, lkr(1000), lines[0].Discount)
+		assert.Equal(t, lkr(9000), lines[0].LineTotal)
+		assert.Equal(t, "TEN", lines[0].CouponCode)
+		assert.Equal(t, lkr(150), lines[1].Discount)
+		assert.Zero(t, lines[2].Discount)
+		assert.Empty(t, lines[2].CouponCode)
+		assert.Equal(t, lkr(2000), lines[2].LineTotal)
+	})
+
+	t.Run("fixed_spread_by_line_total", func(t *testing.T) {
+		lines := couponLines()
+		discount, err := ApplyCoupon(&CouponModel{Code: "OFF1000", SellerID: "s1", Type: CouponFixed, Amount: lkr(1000)}, lines)
+
+		require.NoError(t, err)
+		assert.Equal(t, lkr(1000), discount)
+		assert.Equal(t, Money{Amount: 86957, Currency: "LKR"}, lines[0].Discount)
+		assert.Equal(t, Money{Amount: 13043, Currency: "LKR"}, lines[1].Discount)
+		assert.Zero(t, lines[2].Discount)
+	})
+
+	t.Run("fixed_capped_at_eligible_total", func(t *testing.T) {
+		lines := couponLines()
+		discount, err := ApplyCoupon(&CouponModel{Code: "BIG", SellerID: "s2", Type: CouponFixed, Amount: lkr(5000)}, lines)
+
+		require.NoError(t, err)
+		assert.Equal(t, lkr(2000), discount)
+		assert.Zero(t, lines[2].LineTotal.Amount)
+	})
+
+	t.Run("fixed_in_other_currency", func(t *testing.T) {
+		lines := couponLines()
+		_, err := ApplyCoupon(&CouponModel{Code: "USD10", SellerID: "s1", Type: CouponFixed, Amount: Money{Amount: 1000, Currency: "USD"}}, lines)
+		assert.ErrorIs(t, err, ErrCouponNotApplicable)
+	})
+
+	t.Run("buy_x_get_y_product_scoped", func(t *testing.T) {
+		lines := couponLines()
+		discount, err := ApplyCoupon(&CouponModel{Code: "B2G1", SellerID: "s1", Type: CouponBuyXGetY, BuyQuantity: 2, GetQuantity: 1, ProductIDs: StringList{"p2"}}, lines)
+
+		require.NoError(t, err)
+		assert.Equal(t, lkr(300), discount, "5 cables = one full group of 3, so one free")
+		assert.Equal(t, lkr(1200), lines[1].LineTotal)
+		assert.Zero(t, lines[0].Discount)
+	})
+
+	t.Run("not_applicable", func(t *testing.T) {
+		lines := couponLines()
+		_, err := ApplyCoupon(&CouponModel{Code: "OTHER", SellerID: "s9", Type: CouponPercentage, Value: 10}, lines)
+		assert.ErrorIs(t, err, ErrCouponNotApplicable)
+
+		_, err = ApplyCoupon(&CouponModel{Code: "B5G1", SellerID: "s1", Type: CouponBuyXGetY, BuyQuantity: 5, GetQuantity: 1}, lines)
+		assert.ErrorIs(t, err, ErrCouponNotApplicable, "no line has a full group of 6")
+		assert.Equal(t, couponLines(), lines, "lines are untouched when the coupon does not apply")
+	})
+}
+
+func TestCouponErrorStatus(t *testing.T) {
+	assert.Equal(t, http.StatusNotFound, couponErrorStatus(ErrCouponNotFound))
+	assert.Equal(t, http.StatusUnprocessableEntity, couponErrorStatus(fmt.Errorf("%w: ended", ErrCouponNotActive)))
+	assert.Equal(t, http.StatusUnprocessableEntity, couponErrorStatus(ErrCouponNotApplicable))
+	assert.Equal(t, http.StatusConflict, couponErrorStatus(ErrCouponExhausted))
+	assert.Equal(t, http.StatusInternalServerError, couponErrorStatus(fmt.Errorf("db down")))
+}
+
+func TestNormalizeCouponCode(t *testing.T) {
+	assert.Equal(t, "SPRING10", NormalizeCouponCode("  spring10 "))
+}
+
+func TestCouponEndpointsValidation(t *testing.T) {
+	tests := []struct {
+		name           string
+		method         string
+		path           string
+		role           string
+		requestBody    string
+		expectedStatus int
+	}{
+		{name: "create_missing_type", method: "POST", path: "/coupons", role: "seller", requestBody: `{"code": "SPRING10"}`, expectedStatus: http.StatusBadRequest},
+		{name: "create_invalid_value", method: "POST", path: "/coupons", role: "seller", requestBody: `{"code": "SPRING10", "type": "percentage", "value": 0}`, expectedStatus: http.StatusBadRequest},
+		{name: "create_as_buyer", method: "POST", path: "/coupons", role: "buyer", requestBody: `{"code": "SPRING10", "type": "percentage", "value": 10}`, expectedStatus: http.StatusForbidden},
+		{name: "list_as_buyer", method: "GET", path: "/coupons", role: "buyer", expectedStatus: http.StatusForbidden},
+		{name: "deactivate_as_buyer", method: "DELETE", path: "/coupons/SPRING10", role: "buyer", expectedStatus: http.StatusForbidden},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			r := setupTestRouter()
+			r.Use(func(c *gin.Context) {
+				c.Set("customRole", tt.role)
+				c.Set("userId", "user-1")
+				c.Next()
+			})
+			r.GET("/coupons", HandleGetCoupons)
+			r.POST("/coupons", HandleCreateCoupon)
+			r.DELETE("/coupons/:code", HandleDeactivateCoupon)
+
+			req, _ := http.NewRequest(tt.method, tt.path, bytes.NewBufferString(tt.requestBody))
+			req.Header.Set("Content-Type", "application/json")
+			w := httptest.NewRecorder()
+			r.ServeHTTP(w, req)
+
+			assert.Equal(t, tt.expectedStatus, w.Code)
+		})
+	}
+}
+
+func TestCouponTableNames(t *testing.T) {
+	assert.Equal(t, "coupons", CouponModel{}.TableName())
+	assert.Equal(t, "coupon_redemptions", CouponRedemption{}.TableName())
+}
@@ -0,0 +1,238 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log"
+	"time"
+
+	"github.com/google/uuid"
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+)
+
+// =============================================================================
+// Order Refunds
+// =============================================================================
+
+// Order refund statuses.
+const (
+	RefundPending   = "pending"
+	RefundSucceeded = "succeeded"
+	RefundFailed    = "failed"
+)
+
+// OrderRefund represents the order_refunds table in PostgreSQL. A refund of
+// the whole order is queued in the same transaction that cancels a paid order
+// or applies a payment that arrived after the order expired or was cancelled,
+// and the RefundWorker pays it back through the payment provider afterwards.
+// A refund that keeps failing is left "failed" with its last error for an
+// operator to settle by hand.
+type OrderRefund struct {
+	RefundID         string     `gorm:"primaryKey;type:uuid;column:refund_id" json:"refundId"`
+	OrderID          string     `gorm:"type:uuid;not null;uniqueIndex:idx_order_refunds_order_payment,priority:1;column:order_id" json:"orderId"`
+	PaymentID        string     `gorm:"type:uuid;not null;uniqueIndex:idx_order_refunds_order_payment,priority:2;column:payment_id" json:"paymentId"`
+	IntentID         string     `gorm:"not null;column:intent_id" json:"intentId"`
+	Amount           Money      `gorm:"embedded" json:"amount"`
+	Reason           string     `gorm:"column:reason" json:"reason,omitempty"`
+	Status           string     `gorm:"not null;default:pending;index:idx_order_refunds_due,priority:1;column:status" json:"status"` // pending, succeeded, failed
+	Attempts         int        `gorm:"not null;default:0;column:attempts" json:"attempts"`
+	NextAttemptAt    time.Time  `gorm:"not null;index:idx_order_refunds_due,priority:2;column:next_attempt_at" json:"nextAttemptAt"`
+	LastError        string     `gorm:"column:last_error" json:"lastError,omitempty"`
+	ProviderRefundID string     `gorm:"column:provider_refund_id" json:"providerRefundId,omitempty"`
+	RefundedAt       *time.Time `gorm:"column:refunded_at" json:"refundedAt,omitempty"`
+	CreatedAt        time.Time  `gorm:"autoCreateTime;column:created_at" json:"createdAt"`
+	UpdatedAt        time.Time  `gorm:"autoUpdateTime;column:updated_at" json:"updatedAt"`
+}
+
+// TableName specifies the table name for GORM.
+func (OrderRefund) TableName() string {
+	return "order_refunds"
+}
+
+// NewOrderRefund builds a pending refund of an order's total from the payment
+// that covered it, due straight away.
+func NewOrderRefund(order OrderModel, payment PaymentModel, reason string, now time.Time) OrderRefund {
+	return OrderRefund{
+		RefundID:      uuid.New().String(),
+		OrderID:       order.OrderID,
+		PaymentID:     payment.PaymentID,
+		IntentID:      payment.IntentID,
+		Amount:        order.TotalPrice,
+		Reason:        reason,
+		Status:        RefundPending,
+		NextAttemptAt: now,
+	}
+}
+
+// LatePaymentRefunds works out the refunds owed when a payment succeeds after
+// some of the orders it was taken for expired or were cancelled. orders are
+// the payment's orders before it is applied. A payment is created for the
+// orders pending at the time, so whatever it took beyond the orders still
+// pending belongs to the expired and cancelled ones and is refunded from
+// them in turn, each up to its total.
+func LatePaymentRefunds(payment PaymentModel, orders []OrderModel, now time.Time) ([]OrderRefund, error) {
+	surplus := payment.Amount
+	for _, order := range orders {
+		if order.Status != StatusPending {
+			continue
+		}
+		var err error
+		if surplus, err = surplus.Sub(order.TotalPrice); err != nil {
+			return nil, err
+		}
+	}
+
+	var refunds []OrderRefund
+	for _, order := range orders {
+		if surplus.Amount <= 0 {
+			break
+		}
+		if order.Status != StatusExpired && order.Status != StatusCancelled {
+			continue
+		}
+
+		reason := fmt.Sprintf("payment %s succeeded after the order was %s", payment.IntentID, order.Status)
+		refund := NewOrderRefund(order, payment, reason, now)
+		if refund.Amount.Amount > surplus.Amount {
+			refund.Amount.Amount = surplus.Amount
+		}
+		var err error
+		if surplus, err = surplus.Sub(refund.Amount); err != nil {
+			return nil, err
+		}
+		refunds = append(refunds, refund)
+	}
+
+	if surplus.Amount > 0 {
+		log.Printf("⚠️ Payment %s took %s more than its orders are owed; it needs a manual refund", payment.IntentID, surplus)
+	}
+	return refunds, nil
+}
+
+// QueueOrderRefund queues a refund of a cancelled order's total. It must be
+// called inside the transaction that cancels the order. An order with no
+// succeeded payment is logged and left alone.
+func QueueOrderRefund(tx *gorm.DB, order OrderModel, reason string) error {
+	payment, err := findRefundablePayment(tx, order)
+	if errors.Is(err, ErrNoRefundablePayment) {
+		log.Printf("⚠️ Paid order %s was cancelled but has no succeeded payment to refund", order.OrderID)
+		return nil
+	}
+	if err != nil {
+		return err
+	}
+
+	return QueueRefund(tx, NewOrderRefund(order, *payment, reason, time.Now().UTC()))
+}
+
+// QueueRefund stores a pending refund. Queueing a refund for the same order
+// and payment twice keeps the first one.
+func QueueRefund(tx *gorm.DB, refund OrderRefund) error {
+	if err := tx.Clauses(clause.OnConflict{DoNothing: true}).Create(&refund).Error; err != nil {
+		return fmt.Errorf("failed to queue refund: %w", err)
+	}
+	return nil
+}
+
+// RefundWorker pays out queued order refunds through the payment provider,
+// retrying failures with exponential backoff. Like the webhook dispatcher it
+// leases due refunds by pushing their next attempt back by ClaimLease, so
+// several replicas can run a worker and no lock is held while the provider is
+// called. The refund ID is the provider's idempotency key, so a refund retried
+// after a crash is never paid twice.
+type RefundWorker struct {
+	Repo         OrderRepository
+	Provider     PaymentProvider
+	BatchSize    int
+	PollInterval time.Duration
+	MaxAttempts  int
+	BaseBackoff  time.Duration
+	MaxBackoff   time.Duration
+	ClaimLease   time.Duration
+}
+
+// NewRefundWorker creates a worker with default batching and retry settings.
+// The lease covers a whole batch of provider calls timing out one after the
+// other.
+func NewRefundWorker(repo OrderRepository, provider PaymentProvider) *RefundWorker {
+	return &RefundWorker{
+		Repo:         repo,
+		Provider:     provider,
+		BatchSize:    10,
+		PollInterval: 10 * time.Second,
+		MaxAttempts:  8,
+		BaseBackoff:  30 * time.Second,
+		MaxBackoff:   time.Hour,
+		ClaimLease:   5 * time.Minute,
+	}
+}
+
+// Run pays out due refunds every PollInterval until the context is cancelled.
+func (w *RefundWorker) Run(ctx context.Context) {
+	log.Println("💸 Refund worker started")
+
+	ticker := time.NewTicker(w.PollInterval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ctx.Done():
+			log.Println("Refund worker stopped")
+			return
+		case <-ticker.C:
+			if _, err := w.ProcessBatch(ctx, time.Now().UTC()); err != nil {
+				log.Printf("Refund worker error: %v", err)
+			}
+		}
+	}
+}
+
+// ProcessBatch claims up to BatchSize due refunds, pays them out and saves the
+// outcomes. It returns the number of refunds that succeeded.
+func (w *RefundWorker) ProcessBatch(ctx context.Context, now time.Time) (int, error) {
+	refunds, err := w.Repo.ClaimRefunds(ctx, now, w.BatchSize, w.ClaimLease)
+	if err != nil {
+		return 0, err
+	}
+
+	succeeded := 0
+	for i := range refunds {
+		if w.Issue(ctx, &refunds[i], now) {
+			succeeded++
+		}
+		if err := w.Repo.SaveRefund(ctx, &refunds[i]); err != nil {
+			log.Printf("Failed to save refund %s: %v", refunds[i].RefundID, err)
+		}
+	}
+
+	return succeeded, nil
+}
+
+// Issue asks the provider for a single refund and updates its status, attempt
+// count and next attempt time in place. It reports whether the refund was
+// paid.
+func (w *RefundWorker) Issue(ctx context.Context, refund *OrderRefund, now time.Time) bool {
+	refund.Attempts++
+
+	result, err := w.Provider.RefundPayment(ctx, refund.IntentID, refund.Amount, refund.RefundID)
+	if err != nil {
+		refund.LastError = err.Error()
+		if refund.Attempts >= w.MaxAttempts {
+			refund.Status = RefundFailed
+			log.Printf("❌ Refund %s of %s for order %s failed after %d attempts and needs a manual refund: %v",
+				refund.RefundID, refund.Amount, refund.OrderID, refund.Attempts, err)
+		} else {
+			refund.NextAttemptAt = now.Add(exponentialBackoff(w.BaseBackoff, w.MaxBackoff, refund.Attempts))
+		}
+		return false
+	}
+
+	refund.Status = RefundSucceeded
+	refund.LastError = ""
+	refund.ProviderRefundID = result.ID
+	refund.RefundedAt = &now
+	log.Printf("💸 Refunded %s for order %s via %s refund %s", refund.Amount, refund.OrderID, w.Provider.Name(), result.ID)
+	return true
+}
@@ -0,0 +1,145 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// refundingProvider is a PaymentProvider that only refunds, failing while err
+// is set.
+type refundingProvider struct {
+	err  error
+	keys []string
+}
+
+func (p *refundingProvider) Name() string { return "test" }
+
+func (p *refundingProvider) CreatePaymentIntent(ctx context.Context, req PaymentIntentRequest) (*PaymentIntent, error) {
+	return nil, errors.New("not implemented")
+}
+
+func (p *refundingProvider) ConfirmPaymentIntent(ctx context.Context, intentID string) (*PaymentIntent, error) {
+	return nil, errors.New("not implemented")
+}
+
+func (p *refundingProvider) RefundPayment(ctx context.Context, intentID string, amount Money, idempotencyKey string) (*Refund, error) {
+	p.keys = append(p.keys, idempotencyKey)
+	if p.err != nil {
+		return nil, p.err
+	}
+	return &Refund{ID: "re_1", IntentID: intentID, Amount: amount, Status: "succeeded"}, nil
+}
+
+func (p *refundingProvider) VerifyWebhook(header http.Header, payload []byte) (*PaymentEvent, error) {
+	return nil, ErrInvalidWebhookSignature
+}
+
+func TestNewOrderRefund(t *testing.T) {
+	now := time.Date(2026, 3, 1, 10, 0, 0, 0, time.UTC)
+	order := OrderModel{OrderID: "order-1", CheckoutID: "checkout-1", TotalPrice: lkr(1500)}
+	payment := PaymentModel{PaymentID: "payment-1", IntentID: "pi_1", Amount: lkr(4000)}
+
+	refund := NewOrderRefund(order, payment, "changed my mind", now)
+	assert.NotEmpty(t, refund.RefundID)
+	assert.Equal(t, "order-1", refund.OrderID)
+	assert.Equal(t, "pi_1", refund.IntentID)
+	assert.Equal(t, lkr(1500), refund.Amount, "only the order's share of the payment is refunded")
+	assert.Equal(t, RefundPending, refund.Status)
+	assert.Equal(t, now, refund.NextAttemptAt)
+}
+
+func TestLatePaymentRefunds(t *testing.T) {
+	now := time.Date(2026, 3, 1, 10, 0, 0, 0, time.UTC)
+	payment := PaymentModel{PaymentID: "payment-1", IntentID: "pi_1", Amount: lkr(4000)}
+
+	t.Run("expired_after_intent", func(t *testing.T) {
+		refunds, err := LatePaymentRefunds(payment, []OrderModel{
+			{OrderID: "order-1", Status: StatusPending, TotalPrice: lkr(1500)},
+			{OrderID: "order-2", Status: StatusExpired, TotalPrice: lkr(2500)},
+		}, now)
+		require.NoError(t, err)
+		require.Len(t, refunds, 1)
+		assert.Equal(t, "order-2", refunds[0].OrderID)
+		assert.Equal(t, lkr(2500), refunds[0].Amount)
+		assert.Equal(t, "payment pi_1 succeeded after the order was expired", refunds[0].Reason)
+	})
+
+	t.Run("cancelled_before_intent", func(t *testing.T) {
+		// The intent only covered the pending order, so nothing is owed for
+		// the one cancelled earlier
+		refunds, err := LatePaymentRefunds(PaymentModel{IntentID: "pi_2", Amount: lkr(1500)}, []OrderModel{
+			{OrderID: "order-1", Status: StatusPending, TotalPrice: lkr(1500)},
+			{OrderID: "order-2", Status: StatusCancelled, TotalPrice: lkr(2500)},
+		}, now)
+		require.NoError(t, err)
+		assert.Empty(t, refunds)
+	})
+
+	t.Run("capped_at_surplus", func(t *testing.T) {
+		refunds, err := LatePaymentRefunds(payment, []OrderModel{
+			{OrderID: "order-1", Status: StatusCancelled, TotalPrice: lkr(1500)},
+			{OrderID: "order-2", Status: StatusExpired, TotalPrice: lkr(3000)},
+		}, now)
+		require.NoError(t, err)
+		require.Len(t, refunds, 2)
+		assert.Equal(t, lkr(1500), refunds[0].Amount)
+		assert.Equal(t, lkr(2500), refunds[1].Amount, "never more than the payment took")
+	})
+}
+
+func TestRefundWorkerIssue(t *testing.T) {
+	now := time.Date(2026, 3, 1, 10, 0, 0, 0, time.UTC)
+	provider := &refundingProvider{err: errors.New("provider unavailable")}
+	worker := NewRefundWorker(nil, provider)
+	worker.MaxAttempts = 2
+
+	refund := OrderRefund{RefundID: "refund-1", OrderID: "order-1", IntentID: "pi_1", Amount: lkr(1500), Status: RefundPending}
+	assert.False(t, worker.Issue(context.Background(), &refund, now))
+	assert.Equal(t, RefundPending, refund.Status)
+	assert.Equal(t, 1, refund.Attempts)
+	assert.Equal(t, "provider unavailable", refund.LastError)
+	assert.Equal(t, now.Add(worker.BaseBackoff), refund.NextAttemptAt)
+
+	assert.False(t, worker.Issue(context.Background(), &refund, now))
+	assert.Equal(t, RefundFailed, refund.Status, "left for an operator after MaxAttempts")
+
+	provider.err = nil
+	refund.Status = RefundPending
+	assert.True(t, worker.Issue(context.Background(), &refund, now))
+	assert.Equal(t, RefundSucceeded, refund.Status)
+	assert.Equal(t, "re_1", refund.ProviderRefundID)
+	assert.Empty(t, refund.LastError)
+	require.NotNil(t, refund.RefundedAt)
+	assert.Equal(t, []string{"refund-1", "refund-1", "refund-1"}, provider.keys, "every attempt reuses the refund ID as idempotency key")
+}
+
+func TestMemoryOrderRepositoryClaimRefunds(t *testing.T) {
+	ctx := context.Background()
+	now := time.Now().UTC()
+	repo := NewMemoryOrderRepository()
+	seedMemoryOrders(t, repo, "checkout-1", OrderModel{OrderID: "order-1", BuyerID: "buyer-1", SellerID: "seller-1", TotalPrice: lkr(1500)})
+	require.NoError(t, repo.CreatePayment(ctx, &PaymentModel{PaymentID: "payment-1", Reference: "checkout-1", IntentID: "pi_1", Status: PaymentPending}))
+	_, err := repo.ApplyPaymentEvent(ctx, &PaymentEvent{ID: "evt_1", Type: PaymentEventSucceeded, IntentID: "pi_1"})
+	require.NoError(t, err)
+	_, err = repo.UpdateStatus(ctx, "order-1", StatusChange{To: StatusCancelled, ActorID: "seller-1", Role: RoleSeller, Reason: "out of stock"})
+	require.NoError(t, err)
+
+	claimed, err := repo.ClaimRefunds(ctx, now.Add(time.Second), 10, time.Minute)
+	require.NoError(t, err)
+	require.Len(t, claimed, 1)
+	assert.Equal(t, "out of stock", claimed[0].Reason)
+
+	claimed, err = repo.ClaimRefunds(ctx, now.Add(time.Second), 10, time.Minute)
+	require.NoError(t, err)
+	assert.Empty(t, claimed, "a claimed refund is leased to its worker")
+
+	claimed, err = repo.ClaimRefunds(ctx, now.Add(2*time.Minute), 10, time.Minute)
+	require.NoError(t, err)
+	assert.Len(t, claimed, 1, "and claimable again once the lease runs out")
+}
@@ -0,0 +1,441 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"time"
+
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+)
+
+// =============================================================================
+// Order Repository
+// =============================================================================
+
+// The order and payment handlers only use orderRepo, never the database
+// handle, so the whole create, pay and ship flow (including coupons, cart
+// checkouts, saved and default shipping addresses, Idempotency-Key replays
+// and the payment webhook) can run against the in-memory repository in tests,
+// as can the order expirer and refund worker. That is why, besides creating,
+// reading, listing and updating orders and their history, the repository has
+// the lookups order placement needs and the payment and refund writes. The
+// shipment, return, cart, address book, coupon, webhook and report endpoints
+// manage their own tables on the database directly; no handler uses both.
+
+// ErrOrderNotFound is returned when no order has the requested ID.
+var ErrOrderNotFound = errors.New("order not found")
+
+// ErrCheckoutNotFound is returned when no checkout has the requested ID.
+var ErrCheckoutNotFound = errors.New("checkout not found")
+
+// CheckoutEffects is the rest of the work a checkout commits or rolls back
+// together with its orders.
+type CheckoutEffects struct {
+	// CouponCode, when set, is redeemed for the checkout's discount; its usage
+	// limits are checked again under a lock
+	CouponCode string
+
+	// ClearCart lists the products removed from the buyer's cart when the
+	// cart is checked out
+	ClearCart []string
+
+	// Idempotency, when set, stores the response under the buyer's
+	// Idempotency-Key; the checkout fails if another request took the key
+	Idempotency *IdempotencyRecord
+}
+
+// OrderFilter selects whose orders are listed. Exactly one of the IDs is set.
+type OrderFilter struct {
+	BuyerID  string
+	SellerID string
+}
+
+// StatusChange is a status update applied through an OrderRepository.
+type StatusChange struct {
+	To      string
+	ActorID string
+	Role    string
+	Reason  string
+
+	// Shipment carries the carrier and tracking number when To is shipped;
+	// every unit left on the order is shipped
+	Shipment CreateShipmentInput
+
+	// ExpectedVersion, when set, is the version the order must still be at
+	// (from an If-Match header); otherwise the update fails with
+	// ErrVersionConflict
+	ExpectedVersion int64
+}
+
+// OrderRepository stores checkouts, their per-seller orders and the orders'
+// status history.
+type OrderRepository interface {
+	// CreateCheckout writes a checkout and its pending orders, recording the
+	// first history entry and queueing an "order-placed" event for each
+	// order. The effects are applied in the same transaction.
+	CreateCheckout(ctx context.Context, checkout *CheckoutModel, orders []OrderModel, actorID string, effects CheckoutEffects) error
+
+	// GetOrder returns an order or ErrOrderNotFound.
+	GetOrder(ctx context.Context, orderID string) (*OrderModel, error)
+
+	// GetCheckout returns a checkout with its orders or ErrCheckoutNotFound.
+	GetCheckout(ctx context.Context, checkoutID string) (*CheckoutModel, error)
+
+	// ListCheckouts returns a buyer's checkouts with their orders, newest
+	// first.
+	ListCheckouts(ctx context.Context, buyerID string) ([]CheckoutModel, error)
+
+	// ListOrders returns a page of orders as described by ApplyOrderListParams,
+	// including the extra row BuildOrderPage uses to set the next cursor.
+	ListOrders(ctx context.Context, filter OrderFilter, params OrderListParams) ([]OrderModel, error)
+
+	// UpdateStatus moves an order through the state machine and returns it
+	// with its new status and version. Shipping creates a shipment for
+	// everything left on the order and delivery marks its shipments
+	// delivered.
+	UpdateStatus(ctx context.Context, orderID string, change StatusChange) (*OrderModel, error)
+
+	// History returns an order's status changes, oldest first.
+	History(ctx context.Context, orderID string) ([]OrderStatusHistory, error)
+
+	// GetCoupon returns the active coupon with the given code or
+	// ErrCouponNotFound.
+	GetCoupon(ctx context.Context, code string) (*CouponModel, error)
+
+	// CartItems returns the buyer's cart lines, oldest first.
+	CartItems(ctx context.Context, buyerID string) ([]CartItemModel, error)
+
+	// GetAddress returns one of the buyer's saved addresses or
+	// ErrAddressNotFound.
+	GetAddress(ctx context.Context, buyerID, addressID string) (*AddressModel, error)
+
+	// DefaultAddress returns the buyer's default address, or nil if they have
+	// none.
+	DefaultAddress(ctx context.Context, buyerID string) (*AddressModel, error)
+
+	// LookupIdempotencyKey returns the unexpired record for a buyer's key, or
+	// nil if the key has not been used.
+	LookupIdempotencyKey(ctx context.Context, buyerID, key string) (*IdempotencyRecord, error)
+
+	// PayableOrders returns the orders a payment reference covers: every
+	// order of a checkout, or a single order.
+	PayableOrders(ctx context.Context, reference string) ([]OrderModel, error)
+
+	// LatestPayment returns the newest payment for a reference, only
+	// considering payments in the given status unless it is empty, or
+	// ErrPaymentNotFound.
+	LatestPayment(ctx context.Context, reference, status string) (*PaymentModel, error)
+
+	// CreatePayment stores a new payment intent.
+	CreatePayment(ctx context.Context, payment *PaymentModel) error
+
+	// ApplyPaymentEvent records a verified webhook event and applies it to
+	// its payment and orders, as ApplyPaymentEvent describes. It reports
+	// whether the event had already been applied.
+	ApplyPaymentEvent(ctx context.Context, event *PaymentEvent) (duplicate bool, err error)
+
+	// ExpirePending moves up to limit orders that have been pending since
+	// cutoff or earlier to "expired", oldest first, queueing an
+	// "order-expired" event for each. It returns how many it expired.
+	ExpirePending(ctx context.Context, cutoff time.Time, limit int, reason string) (int, error)
+
+	// ClaimRefunds leases up to limit pending refunds that are due at now by
+	// pushing their next attempt back by lease, and returns them.
+	ClaimRefunds(ctx context.Context, now time.Time, limit int, lease time.Duration) ([]OrderRefund, error)
+
+	// SaveRefund stores the outcome of a refund attempt.
+	SaveRefund(ctx context.Context, refund *OrderRefund) error
+}
+
+// PostgresOrderRepository is the OrderRepository backed by the orders tables.
+type PostgresOrderRepository struct {
+	db *gorm.DB
+}
+
+// NewPostgresOrderRepository creates a repository on the given database.
+func NewPostgresOrderRepository(database *gorm.DB) *PostgresOrderRepository {
+	return &PostgresOrderRepository{db: database}
+}
+
+func (r *PostgresOrderRepository) CreateCheckout(ctx context.Context, checkout *CheckoutModel, orders []OrderModel, actorID string, effects CheckoutEffects) error {
+	return r.db.WithContext(ctx).Transaction(func(tx *gorm.DB) error {
+		if err := tx.Create(checkout).Error; err != nil {
+			return fmt.Errorf("failed to create checkout: %w", err)
+		}
+
+		for i := range orders {
+			if err := tx.Create(&orders[i]).Error; err != nil {
+				return fmt.Errorf("failed to create order: %w", err)
+			}
+
+			if err := RecordStatusChange(tx, orders[i].OrderID, "", StatusPending, actorID, RoleBuyer, "order placed"); err != nil {
+				return err
+			}
+
+			// Queue one order-placed event per seller order; the outbox relay
+			// publishes it to EventBridge once this transaction commits
+			if err := EnqueueOrderPlacedEvent(tx, orders[i]); err != nil {
+				return err
+			}
+		}
+
+		if effects.CouponCode != "" {
+			if err := RedeemCoupon(tx, effects.CouponCode, checkout.BuyerID, checkout.CheckoutID, checkout.Discount, time.Now().UTC()); err != nil {
+				return err
+			}
+		}
+
+		// Only the lines that were checked out are removed, so a product
+		// added from another device meanwhile stays in the cart
+		if len(effects.ClearCart) > 0 {
+			if err := tx.Where("buyer_id = ? AND product_id IN ?", checkout.BuyerID, effects.ClearCart).Delete(&CartItemModel{}).Error; err != nil {
+				return fmt.Errorf("failed to clear cart: %w", err)
+			}
+		}
+
+		if effects.Idempotency != nil {
+			return SaveIdempotencyRecord(tx, effects.Idempotency)
+		}
+		return nil
+	})
+}
+
+func (r *PostgresOrderRepository) GetOrder(ctx context.Context, orderID string) (*OrderModel, error) {
+	var order OrderModel
+	err := r.db.WithContext(ctx).First(&order, "order_id = ?", orderID).Error
+	if errors.Is(err, gorm.ErrRecordNotFound) {
+		return nil, ErrOrderNotFound
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to load order: %w", err)
+	}
+	return &order, nil
+}
+
+func (r *PostgresOrderRepository) GetCheckout(ctx context.Context, checkoutID string) (*CheckoutModel, error) {
+	var checkout CheckoutModel
+	err := r.db.WithContext(ctx).Preload("Orders").First(&checkout, "checkout_id = ?", checkoutID).Error
+	if errors.Is(err, gorm.ErrRecordNotFound) {
+		return nil, ErrCheckoutNotFound
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to load checkout: %w", err)
+	}
+	return &checkout, nil
+}
+
+func (r *PostgresOrderRepository) ListCheckouts(ctx context.Context, buyerID string) ([]CheckoutModel, error) {
+	var checkouts []CheckoutModel
+	if err := r.db.WithContext(ctx).Preload("Orders").Where("buyer_id = ?", buyerID).Order("created_at DESC").Find(&checkouts).Error; err != nil {
+		return nil, fmt.Errorf("failed to list checkouts: %w", err)
+	}
+	return checkouts, nil
+}
+
+func (r *PostgresOrderRepository) ListOrders(ctx context.Context, filter OrderFilter, params OrderListParams) ([]OrderModel, error) {
+	query := r.db.WithContext(ctx).Model(&OrderModel{})
+	if filter.SellerID != "" {
+		query = query.Where("seller_id = ?", filter.SellerID)
+	} else {
+		query = query.Where("buyer_id = ?", filter.BuyerID)
+	}
+
+	var orders []OrderModel
+	if err := ApplyOrderListParams(query, params).Find(&orders).Error; err != nil {
+		return nil, fmt.Errorf("failed to list orders: %w", err)
+	}
+	return orders, nil
+}
+
+func (r *PostgresOrderRepository) UpdateStatus(ctx context.Context, orderID string, change StatusChange) (*OrderModel, error) {
+	var order *OrderModel
+	err := r.db.WithContext(ctx).Transaction(func(tx *gorm.DB) error {
+		locked, err := lockOrder(tx, orderID)
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			return ErrOrderNotFound
+		}
+		if err != nil {
+			return err
+		}
+		if err := checkExpectedVersion(*locked, change.ExpectedVersion); err != nil {
+			return err
+		}
+
+		// Shipping and delivery go through the order's shipments, which its
+		// status follows
+		switch change.To {
+		case StatusShipped:
+			_, err = CreateShipment(tx, locked, change.Shipment, change.ActorID)
+		case StatusDelivered:
+			err = MarkOrderDelivered(tx, locked, change.ActorID, change.Role, change.Reason)
+		default:
+			err = TransitionOrder(tx, locked, change.To, change.ActorID, change.Role, change.Reason)
+		}
+		order = locked
+		return err
+	})
+	if err != nil {
+		return nil, err
+	}
+	return order, nil
+}
+
+func (r *PostgresOrderRepository) History(ctx context.Context, orderID string) ([]OrderStatusHistory, error) {
+	var history []OrderStatusHistory
+	if err := r.db.WithContext(ctx).Where("order_id = ?", orderID).Order("created_at ASC").Find(&history).Error; err != nil {
+		return nil, fmt.Errorf("failed to load order history: %w", err)
+	}
+	return history, nil
+}
+
+func (r *PostgresOrderRepository) GetCoupon(ctx context.Context, code string) (*CouponModel, error) {
+	return LoadCoupon(r.db.WithContext(ctx), code)
+}
+
+func (r *PostgresOrderRepository) CartItems(ctx context.Context, buyerID string) ([]CartItemModel, error) {
+	items, err := loadCart(r.db.WithContext(ctx), buyerID)
+	if err != nil {
+		return nil, fmt.Errorf("failed to load cart: %w", err)
+	}
+	return items, nil
+}
+
+func (r *PostgresOrderRepository) GetAddress(ctx context.Context, buyerID, addressID string) (*AddressModel, error) {
+	return LoadAddress(r.db.WithContext(ctx), buyerID, addressID)
+}
+
+func (r *PostgresOrderRepository) DefaultAddress(ctx context.Context, buyerID string) (*AddressModel, error) {
+	return LoadDefaultAddress(r.db.WithContext(ctx), buyerID)
+}
+
+func (r *PostgresOrderRepository) LookupIdempotencyKey(ctx context.Context, buyerID, key string) (*IdempotencyRecord, error) {
+	return LookupIdempotencyKey(r.db.WithContext(ctx), buyerID, key)
+}
+
+func (r *PostgresOrderRepository) PayableOrders(ctx context.Context, reference string) ([]OrderModel, error) {
+	orders, err := findPayableOrders(r.db.WithContext(ctx), reference)
+	if err != nil {
+		return nil, fmt.Errorf("failed to load orders: %w", err)
+	}
+	return orders, nil
+}
+
+func (r *PostgresOrderRepository) LatestPayment(ctx context.Context, reference, status string) (*PaymentModel, error) {
+	query := r.db.WithContext(ctx).Where("reference = ?", reference)
+	if status != "" {
+		query = query.Where("status = ?", status)
+	}
+
+	var payment PaymentModel
+	err := query.Order("created_at DESC").First(&payment).Error
+	if errors.Is(err, gorm.ErrRecordNotFound) {
+		return nil, ErrPaymentNotFound
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to load payment: %w", err)
+	}
+	return &payment, nil
+}
+
+func (r *PostgresOrderRepository) CreatePayment(ctx context.Context, payment *PaymentModel) error {
+	if err := r.db.WithContext(ctx).Create(payment).Error; err != nil {
+		return fmt.Errorf("failed to save payment: %w", err)
+	}
+	return nil
+}
+
+func (r *PostgresOrderRepository) ApplyPaymentEvent(ctx context.Context, event *PaymentEvent) (bool, error) {
+	duplicate := false
+	err := r.db.WithContext(ctx).Transaction(func(tx *gorm.DB) error {
+		result := tx.Clauses(clause.OnConflict{DoNothing: true}).Create(&PaymentWebhookEvent{
+			EventID:  event.ID,
+			Type:     event.Type,
+			IntentID: event.IntentID,
+		})
+		if result.Error != nil {
+			return fmt.Errorf("failed to record webhook event: %w", result.Error)
+		}
+		if result.RowsAffected == 0 {
+			duplicate = true
+			return nil
+		}
+		return ApplyPaymentEvent(tx, event)
+	})
+	return duplicate, err
+}
+
+func (r *PostgresOrderRepository) ExpirePending(ctx context.Context, cutoff time.Time, limit int, reason string) (int, error) {
+	expired := 0
+	err := r.db.WithContext(ctx).Transaction(func(tx *gorm.DB) error {
+		var orders []OrderModel
+		err := tx.Clauses(clause.Locking{Strength: "UPDATE", Options: "SKIP LOCKED"}).
+			Where("status = ? AND created_at <= ?", StatusPending, cutoff).
+			Order("created_at ASC").
+			Limit(limit).
+			Find(&orders).Error
+		if err != nil {
+			return fmt.Errorf("failed to load pending orders: %w", err)
+		}
+
+		for i := range orders {
+			if err := TransitionOrder(tx, &orders[i], StatusExpired, "order-expirer", RoleSystem, reason); err != nil {
+				return fmt.Errorf("failed to expire order %s: %w", orders[i].OrderID, err)
+			}
+			expired++
+		}
+		return nil
+	})
+	if err != nil {
+		return 0, err
+	}
+	return expired, nil
+}
+
+func (r *PostgresOrderRepository) ClaimRefunds(ctx context.Context, now time.Time, limit int, lease time.Duration) ([]OrderRefund, error) {
+	var refunds []OrderRefund
+	err := r.db.WithContext(ctx).Transaction(func(tx *gorm.DB) error {
+		err := tx.Clauses(clause.Locking{Strength: "UPDATE", Options: "SKIP LOCKED"}).
+			Where("status = ? AND next_attempt_at <= ?", RefundPending, now).
+			Order("next_attempt_at ASC").
+			Limit(limit).
+			Find(&refunds).Error
+		if err != nil {
+			return fmt.Errorf("failed to load due refunds: %w", err)
+		}
+		if len(refunds) == 0 {
+			return nil
+		}
+
+		ids := make([]string, len(refunds))
+		for i, refund := range refunds {
+			ids[i] = refund.RefundID
+		}
+		if err := tx.Model(&OrderRefund{}).Where("refund_id IN ?", ids).
+			Update("next_attempt_at", now.Add(lease)).Error; err != nil {
+			return fmt.Errorf("failed to claim refunds: %w", err)
+		}
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+	return refunds, nil
+}
+
+func (r *PostgresOrderRepository) SaveRefund(ctx context.Context, refund *OrderRefund) error {
+	if err := r.db.WithContext(ctx).Save(refund).Error; err != nil {
+		return fmt.Errorf("failed to update refund: %w", err)
+	}
+	return nil
+}
+
+// checkExpectedVersion fails with ErrVersionConflict when the client expects
+// the order at a version it is no longer at. Zero expects no version.
+func checkExpectedVersion(order OrderModel, expected int64) error {
+	if expected != 0 && order.Version != expected {
+		return fmt.Errorf("%w: order %s is at version %d, not %d", ErrVersionConflict, order.OrderID, order.Version, expected)
+	}
+	return nil
+}
@@ -0,0 +1,631 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+)
+
+// MemoryOrderRepository is an OrderRepository that keeps everything in memory,
+// for tests. It follows the same state machine as the Postgres repository but
+// records no shipments: shipping moves the order straight to shipped. Events
+// are recorded per order instead of being written to the outbox. Coupons, cart
+// lines and saved addresses are added with AddCoupon, AddCartItem and
+// AddAddress.
+type MemoryOrderRepository struct {
+	mu            sync.Mutex
+	checkouts     map[string]*CheckoutModel
+	orders        map[string]*OrderModel
+	orderIDs      []string // in creation order
+	history       map[string][]OrderStatusHistory
+	events        map[string][]string
+	coupons       map[string]*CouponModel
+	redemptions   map[string][]string // coupon code -> buyer IDs
+	carts         map[string][]CartItemModel
+	addresses     map[string][]AddressModel       // by buyer ID
+	idempotency   map[[2]string]IdempotencyRecord // buyer ID and key -> record
+	payments      []*PaymentModel                 // in creation order
+	webhookEvents map[string]bool
+	refunds       []*OrderRefund // in creation order
+	nextID        int
+}
+
+// NewMemoryOrderRepository creates an empty in-memory repository.
+func NewMemoryOrderRepository() *MemoryOrderRepository {
+	return &MemoryOrderRepository{
+		checkouts:     map[string]*CheckoutModel{},
+		orders:        map[string]*OrderModel{},
+		history:       map[string][]OrderStatusHistory{},
+		events:        map[string][]string{},
+		coupons:       map[string]*CouponModel{},
+		redemptions:   map[string][]string{},
+		carts:         map[string][]CartItemModel{},
+		addresses:     map[string][]AddressModel{},
+		idempotency:   map[[2]string]IdempotencyRecord{},
+		webhookEvents: map[string]bool{},
+	}
+}
+
+func (r *MemoryOrderRepository) CreateCheckout(ctx context.Context, checkout *CheckoutModel, orders []OrderModel, actorID string, effects CheckoutEffects) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	now := time.Now().UTC()
+
+	// Every check runs before anything is written, so a failed checkout
+	// leaves the repository as it was, like a rolled back transaction
+	if _, ok := r.checkouts[checkout.CheckoutID]; ok {
+		return fmt.Errorf("failed to create checkout: duplicate checkout %s", checkout.CheckoutID)
+	}
+	for _, order := range orders {
+		if _, ok := r.orders[order.OrderID]; ok {
+			return fmt.Errorf("failed to create order: duplicate order %s", order.OrderID)
+		}
+	}
+
+	var coupon *CouponModel
+	if effects.CouponCode != "" {
+		coupon = r.coupons[effects.CouponCode]
+		if coupon == nil {
+			return ErrCouponNotFound
+		}
+		uses := 0
+		for _, buyerID := range r.redemptions[effects.CouponCode] {
+			if buyerID == checkout.BuyerID {
+				uses++
+			}
+		}
+		if err := coupon.CheckRedeemable(now, int64(uses)); err != nil {
+			return err
+		}
+	}
+
+	if record := effects.Idempotency; record != nil {
+		if existing, ok := r.idempotency[[2]string{record.BuyerID, record.Key}]; ok && existing.ExpiresAt.After(now) {
+			return fmt.Errorf("failed to store idempotency key: duplicate key %s", record.Key)
+		}
+	}
+
+	checkout.CreatedAt, checkout.UpdatedAt = now, now
+	stored := *checkout
+	stored.Orders = nil
+	r.checkouts[checkout.CheckoutID] = &stored
+
+	for i := range orders {
+		orders[i].CreatedAt, orders[i].UpdatedAt = now, now
+		orders[i].Version = 1
+		order := cloneOrder(orders[i])
+		r.orders[order.OrderID] = &order
+		r.orderIDs = append(r.orderIDs, order.OrderID)
+
+		r.recordLocked(order.OrderID, "", StatusPending, actorID, RoleBuyer, "order placed", now)
+		r.events[order.OrderID] = append(r.events[order.OrderID], "order-placed")
+	}
+
+	if coupon != nil {
+		coupon.UsedCount++
+		r.redemptions[coupon.Code] = append(r.redemptions[coupon.Code], checkout.BuyerID)
+	}
+
+	if len(effects.ClearCart) > 0 {
+		cleared := map[string]bool{}
+		for _, productID := range effects.ClearCart {
+			cleared[productID] = true
+		}
+		var kept []CartItemModel
+		for _, item := range r.carts[checkout.BuyerID] {
+			if !cleared[item.ProductID] {
+				kept = append(kept, item)
+			}
+		}
+		r.carts[checkout.BuyerID] = kept
+	}
+
+	if record := effects.Idempotency; record != nil {
+		r.idempotency[[2]string{record.BuyerID, record.Key}] = *record
+	}
+
+	return nil
+}
+
+func (r *MemoryOrderRepository) GetOrder(ctx context.Context, orderID string) (*OrderModel, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	order, ok := r.orders[orderID]
+	if !ok {
+		return nil, ErrOrderNotFound
+	}
+	clone := cloneOrder(*order)
+	return &clone, nil
+}
+
+func (r *MemoryOrderRepository) GetCheckout(ctx context.Context, checkoutID string) (*CheckoutModel, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	checkout, ok := r.checkouts[checkoutID]
+	if !ok {
+		return nil, ErrCheckoutNotFound
+	}
+	clone := r.checkoutLocked(checkout)
+	return &clone, nil
+}
+
+func (r *MemoryOrderRepository) ListCheckouts(ctx context.Context, buyerID string) ([]CheckoutModel, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	checkouts := []CheckoutModel{}
+	for _, checkout := range r.checkouts {
+		if checkout.BuyerID == buyerID {
+			checkouts = append(checkouts, r.checkoutLocked(checkout))
+		}
+	}
+	sort.Slice(checkouts, func(i, j int) bool {
+		if !checkouts[i].CreatedAt.Equal(checkouts[j].CreatedAt) {
+			return checkouts[i].CreatedAt.After(checkouts[j].CreatedAt)
+		}
+		return checkouts[i].CheckoutID > checkouts[j].CheckoutID
+	})
+	return checkouts, nil
+}
+
+func (r *MemoryOrderRepository) ListOrders(ctx context.Context, filter OrderFilter, params OrderListParams) ([]OrderModel, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	statuses := map[string]bool{}
+	for _, status := range params.Statuses {
+		statuses[status] = true
+	}
+
+	// before reports whether a sorts ahead of b in the requested direction
+	before := func(a, b OrderCursor) bool {
+		if !a.CreatedAt.Equal(b.CreatedAt) {
+			return a.CreatedAt.Before(b.CreatedAt) != params.Descending
+		}
+		if a.OrderID == b.OrderID {
+			return false
+		}
+		return (a.OrderID < b.OrderID) != params.Descending
+	}
+
+	var orders []OrderModel
+	for _, order := range r.orders {
+		switch {
+		case filter.SellerID != "" && order.SellerID != filter.SellerID,
+			filter.SellerID == "" && order.BuyerID != filter.BuyerID,
+			len(statuses) > 0 && !statuses[order.Status],
+			params.CreatedFrom != nil && order.CreatedAt.Before(*params.CreatedFrom),
+			params.CreatedTo != nil && !order.CreatedAt.Before(*params.CreatedTo),
+			params.Cursor != nil && !before(*params.Cursor, OrderCursor{CreatedAt: order.CreatedAt, OrderID: order.OrderID}):
+			continue
+		}
+		orders = append(orders, cloneOrder(*order))
+	}
+
+	sort.Slice(orders, func(i, j int) bool {
+		return before(
+			OrderCursor{CreatedAt: orders[i].CreatedAt, OrderID: orders[i].OrderID},
+			OrderCursor{CreatedAt: orders[j].CreatedAt, OrderID: orders[j].OrderID},
+		)
+	})
+	if len(orders) > params.Limit+1 {
+		orders = orders[:params.Limit+1]
+	}
+	return orders, nil
+}
+
+func (r *MemoryOrderRepository) UpdateStatus(ctx context.Context, orderID string, change StatusChange) (*OrderModel, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	order, ok := r.orders[orderID]
+	if !ok {
+		return nil, ErrOrderNotFound
+	}
+	if err := checkExpectedVersion(*order, change.ExpectedVersion); err != nil {
+		return nil, err
+	}
+	if err := r.updateLocked(order, change); err != nil {
+		return nil, err
+	}
+
+	clone := cloneOrder(*order)
+	return &clone, nil
+}
+
+func (r *MemoryOrderRepository) History(ctx context.Context, orderID string) ([]OrderStatusHistory, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	return append([]OrderStatusHistory{}, r.history[orderID]...), nil
+}
+
+// Events returns the detail types of the events queued for an order, in the
+// order they were queued.
+func (r *MemoryOrderRepository) Events(orderID string) []string {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	return append([]string(nil), r.events[orderID]...)
+}
+
+func (r *MemoryOrderRepository) GetCoupon(ctx context.Context, code string) (*CouponModel, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	coupon, ok := r.coupons[NormalizeCouponCode(code)]
+	if !ok || !coupon.Active {
+		return nil, ErrCouponNotFound
+	}
+	clone := *coupon
+	return &clone, nil
+}
+
+func (r *MemoryOrderRepository) CartItems(ctx context.Context, buyerID string) ([]CartItemModel, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	return append([]CartItemModel{}, r.carts[buyerID]...), nil
+}
+
+func (r *MemoryOrderRepository) GetAddress(ctx context.Context, buyerID, addressID string) (*AddressModel, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	for _, address := range r.addresses[buyerID] {
+		if address.AddressID == addressID {
+			return &address, nil
+		}
+	}
+	return nil, ErrAddressNotFound
+}
+
+func (r *MemoryOrderRepository) DefaultAddress(ctx context.Context, buyerID string) (*AddressModel, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	for _, address := range r.addresses[buyerID] {
+		if address.IsDefault {
+			return &address, nil
+		}
+	}
+	return nil, nil
+}
+
+func (r *MemoryOrderRepository) LookupIdempotencyKey(ctx context.Context, buyerID, key string) (*IdempotencyRecord, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	record, ok := r.idempotency[[2]string{buyerID, key}]
+	if !ok || !record.ExpiresAt.After(time.Now().UTC()) {
+		return nil, nil
+	}
+	return &record, nil
+}
+
+func (r *MemoryOrderRepository) PayableOrders(ctx context.Context, reference string) ([]OrderModel, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	return r.payableLocked(reference), nil
+}
+
+func (r *MemoryOrderRepository) LatestPayment(ctx context.Context, reference, status string) (*PaymentModel, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	for i := len(r.payments) - 1; i >= 0; i-- {
+		if payment := r.payments[i]; payment.Reference == reference && (status == "" || payment.Status == status) {
+			clone := *payment
+			return &clone, nil
+		}
+	}
+	return nil, ErrPaymentNotFound
+}
+
+func (r *MemoryOrderRepository) CreatePayment(ctx context.Context, payment *PaymentModel) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	for _, existing := range r.payments {
+		if existing.PaymentID == payment.PaymentID || existing.IntentID == payment.IntentID {
+			return fmt.Errorf("failed to save payment: duplicate payment %s", payment.PaymentID)
+		}
+	}
+
+	now := time.Now().UTC()
+	payment.CreatedAt, payment.UpdatedAt = now, now
+	stored := *payment
+	r.payments = append(r.payments, &stored)
+	return nil
+}
+
+func (r *MemoryOrderRepository) ApplyPaymentEvent(ctx context.Context, event *PaymentEvent) (bool, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	if r.webhookEvents[event.ID] {
+		return true, nil
+	}
+	r.webhookEvents[event.ID] = true
+
+	var payment *PaymentModel
+	for _, p := range r.payments {
+		if p.IntentID == event.IntentID {
+			payment = p
+		}
+	}
+	if payment == nil {
+		return false, nil
+	}
+
+	switch event.Type {
+	case PaymentEventSucceeded:
+		if payment.Captured() {
+			return false, nil
+		}
+
+		now := time.Now().UTC()
+		orders := r.payableLocked(payment.Reference)
+		refunds, err := LatePaymentRefunds(*payment, orders, now)
+		if err != nil {
+			return false, err
+		}
+		for _, refund := range refunds {
+			r.addRefundLocked(refund, now)
+		}
+
+		for _, order := range orders {
+			if order.Status != StatusPending {
+				continue
+			}
+			reason := fmt.Sprintf("payment %s confirmed by %s", payment.IntentID, payment.Provider)
+			change := StatusChange{To: StatusPaid, ActorID: "payment", Role: RoleSystem, Reason: reason}
+			if err := r.updateLocked(r.orders[order.OrderID], change); err != nil {
+				return false, err
+			}
+		}
+		payment.Status = PaymentSucceeded
+	case PaymentEventFailed:
+		payment.Status = PaymentFailed
+	case PaymentEventRefunded:
+		payment.ApplyRefunded(event.AmountRefunded)
+	default:
+		return false, nil
+	}
+	payment.UpdatedAt = time.Now().UTC()
+
+	return false, nil
+}
+
+func (r *MemoryOrderRepository) ExpirePending(ctx context.Context, cutoff time.Time, limit int, reason string) (int, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	var due []*OrderModel
+	for _, id := range r.orderIDs {
+		if order := r.orders[id]; order.Status == StatusPending && !order.CreatedAt.After(cutoff) {
+			due = append(due, order)
+		}
+	}
+	sort.SliceStable(due, func(i, j int) bool { return due[i].CreatedAt.Before(due[j].CreatedAt) })
+	if len(due) > limit {
+		due = due[:limit]
+	}
+
+	for _, order := range due {
+		change := StatusChange{To: StatusExpired, ActorID: "order-expirer", Role: RoleSystem, Reason: reason}
+		if err := r.updateLocked(order, change); err != nil {
+			return 0, fmt.Errorf("failed to expire order %s: %w", order.OrderID, err)
+		}
+	}
+	return len(due), nil
+}
+
+func (r *MemoryOrderRepository) ClaimRefunds(ctx context.Context, now time.Time, limit int, lease time.Duration) ([]OrderRefund, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	var claimed []OrderRefund
+	for _, refund := range r.refunds {
+		if len(claimed) == limit {
+			break
+		}
+		if refund.Status != RefundPending || refund.NextAttemptAt.After(now) {
+			continue
+		}
+		claimed = append(claimed, *refund)
+		refund.NextAttemptAt = now.Add(lease)
+	}
+	return claimed, nil
+}
+
+func (r *MemoryOrderRepository) SaveRefund(ctx context.Context, refund *OrderRefund) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	for i, stored := range r.refunds {
+		if stored.RefundID == refund.RefundID {
+			saved := *refund
+			saved.UpdatedAt = time.Now().UTC()
+			r.refunds[i] = &saved
+			return nil
+		}
+	}
+	return fmt.Errorf("failed to update refund: refund %s not found", refund.RefundID)
+}
+
+// Refunds returns the refunds queued for an order, oldest first.
+func (r *MemoryOrderRepository) Refunds(orderID string) []OrderRefund {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	var refunds []OrderRefund
+	for _, refund := range r.refunds {
+		if refund.OrderID == orderID {
+			refunds = append(refunds, *refund)
+		}
+	}
+	return refunds
+}
+
+// AddCoupon stores a coupon for GetCoupon and checkouts to find.
+func (r *MemoryOrderRepository) AddCoupon(coupon CouponModel) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	r.coupons[coupon.Code] = &coupon
+}
+
+// AddCartItem appends a line to a buyer's cart.
+func (r *MemoryOrderRepository) AddCartItem(item CartItemModel) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	r.carts[item.BuyerID] = append(r.carts[item.BuyerID], item)
+}
+
+// AddAddress saves an address to a buyer's address book.
+func (r *MemoryOrderRepository) AddAddress(address AddressModel) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	r.addresses[address.BuyerID] = append(r.addresses[address.BuyerID], address)
+}
+
+// updateLocked applies a status change to a stored order, recording the
+// history entry and event. The caller holds r.mu.
+func (r *MemoryOrderRepository) updateLocked(order *OrderModel, change StatusChange) error {
+	reason := change.Reason
+	if change.To == StatusShipped {
+		if order.Status != StatusPaid && order.Status != StatusPartiallyShipped {
+			return fmt.Errorf("%w: cannot ship a %s order", ErrInvalidTransition, order.Status)
+		}
+		reason = "shipment created"
+		if tracking := strings.TrimSpace(change.Shipment.TrackingNumber); tracking != "" {
+			carrier := NormalizeCarrier(change.Shipment.Carrier)
+			if carrier == "" {
+				carrier = CarrierManual
+			}
+			reason = fmt.Sprintf("shipped with %s, tracking %s", carrier, tracking)
+		}
+	}
+
+	if err := CanTransition(order.Status, change.To, change.Role); err != nil {
+		return err
+	}
+
+	now := time.Now().UTC()
+	from := order.Status
+	r.recordLocked(order.OrderID, from, change.To, change.ActorID, change.Role, reason, now)
+	order.Status = change.To
+	order.UpdatedAt = now
+	order.Version++
+	r.events[order.OrderID] = append(r.events[order.OrderID], orderEventType(change.To))
+
+	if from == StatusPaid && change.To == StatusCancelled {
+		r.queueRefundLocked(*order, reason, now)
+	}
+	return nil
+}
+
+// queueRefundLocked queues a refund of the order's total from the newest
+// succeeded payment that covered it, as QueueOrderRefund does. The caller
+// holds r.mu.
+func (r *MemoryOrderRepository) queueRefundLocked(order OrderModel, reason string, now time.Time) {
+	for i := len(r.payments) - 1; i >= 0; i-- {
+		payment := r.payments[i]
+		if payment.Reference != order.OrderID && (order.CheckoutID == "" || payment.Reference != order.CheckoutID) {
+			continue
+		}
+		if !payment.Captured() {
+			continue
+		}
+		r.addRefundLocked(NewOrderRefund(order, *payment, reason, now), now)
+		return
+	}
+}
+
+// addRefundLocked stores a pending refund unless one already exists for the
+// same order and payment, as QueueRefund does. The caller holds r.mu.
+func (r *MemoryOrderRepository) addRefundLocked(refund OrderRefund, now time.Time) {
+	for _, existing := range r.refunds {
+		if existing.OrderID == refund.OrderID && existing.PaymentID == refund.PaymentID {
+			return
+		}
+	}
+	refund.CreatedAt, refund.UpdatedAt = now, now
+	r.refunds = append(r.refunds, &refund)
+}
+
+// payableLocked copies the orders a payment reference covers, in creation
+// order. The caller holds r.mu.
+func (r *MemoryOrderRepository) payableLocked(reference string) []OrderModel {
+	var orders []OrderModel
+	for _, id := range r.orderIDs {
+		if order := r.orders[id]; order.CheckoutID == reference || order.OrderID == reference {
+			orders = append(orders, cloneOrder(*order))
+		}
+	}
+	return orders
+}
+
+// recordLocked appends a status history entry. The caller holds r.mu.
+func (r *MemoryOrderRepository) recordLocked(orderID, from, to, actorID, role, reason string, at time.Time) {
+	r.nextID++
+	r.history[orderID] = append(r.history[orderID], OrderStatusHistory{
+		HistoryID:  fmt.Sprintf("history-%d", r.nextID),
+		OrderID:    orderID,
+		FromStatus: from,
+		ToStatus:   to,
+		ActorID:    actorID,
+		ActorRole:  role,
+		Reason:     reason,
+		CreatedAt:  at,
+	})
+}
+
+// checkoutLocked copies a checkout with its orders in creation order. The
+// caller holds r.mu.
+func (r *MemoryOrderRepository) checkoutLocked(checkout *CheckoutModel) CheckoutModel {
+	clone := *checkout
+	clone.Orders = []OrderModel{}
+	for _, id := range r.orderIDs {
+		if order := r.orders[id]; order.CheckoutID == checkout.CheckoutID {
+			clone.Orders = append(clone.Orders, cloneOrder(*order))
+		}
+	}
+	return clone
+}
+
+// cloneOrder copies an order so the caller cannot change the stored one
+// through its items or address.
+func cloneOrder(order OrderModel) OrderModel {
+	order.Items = append(OrderItemsJSON(nil), order.Items...)
+	if order.ShippingAddress != nil {
+		address := *order.ShippingAddress
+		order.ShippingAddress = &address
+	}
+	return order
+}
+
+// orderEventType is the event TransitionOrder queues when an order moves to
+// the status.
+func orderEventType(status string) string {
+	switch status {
+	case StatusPaid:
+		return "order-paid"
+	case StatusCancelled:
+		return "order-cancelled"
+	case StatusExpired:
+		return "order-expired"
+	default:
+		return fulfilmentEventTypes[status]
+	}
+}
@@ -0,0 +1,255 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func seedMemoryOrders(t *testing.T, repo *MemoryOrderRepository, checkoutID string, orders ...OrderModel) {
+	t.Helper()
+	for i := range orders {
+		orders[i].CheckoutID = checkoutID
+		orders[i].Status = StatusPending
+	}
+	checkout := CheckoutModel{CheckoutID: checkoutID, BuyerID: orders[0].BuyerID}
+	require.NoError(t, repo.CreateCheckout(context.Background(), &checkout, orders, orders[0].BuyerID, CheckoutEffects{}))
+}
+
+func TestMemoryOrderRepositoryCreateCheckout(t *testing.T) {
+	ctx := context.Background()
+	repo := NewMemoryOrderRepository()
+	seedMemoryOrders(t, repo, "checkout-1",
+		OrderModel{OrderID: "order-1", BuyerID: "buyer-1", SellerID: "seller-1", Items: OrderItemsJSON{{ProductID: "p1", Quantity: 1}}},
+		OrderModel{OrderID: "order-2", BuyerID: "buyer-1", SellerID: "seller-2"},
+	)
+
+	checkout, err := repo.GetCheckout(ctx, "checkout-1")
+	require.NoError(t, err)
+	require.Len(t, checkout.Orders, 2)
+	assert.Equal(t, "order-1", checkout.Orders[0].OrderID)
+	assert.False(t, checkout.CreatedAt.IsZero())
+
+	history, err := repo.History(ctx, "order-2")
+	require.NoError(t, err)
+	require.Len(t, history, 1)
+	assert.Equal(t, StatusPending, history[0].ToStatus)
+	assert.Equal(t, "order placed", history[0].Reason)
+	assert.Equal(t, []string{"order-placed"}, repo.Events("order-1"))
+
+	// Orders handed out are copies
+	order, err := repo.GetOrder(ctx, "order-1")
+	require.NoError(t, err)
+	order.Items[0].Quantity = 99
+	order, _ = repo.GetOrder(ctx, "order-1")
+	assert.Equal(t, 1, order.Items[0].Quantity)
+
+	_, err = repo.GetOrder(ctx, "missing")
+	assert.ErrorIs(t, err, ErrOrderNotFound)
+	_, err = repo.GetCheckout(ctx, "missing")
+	assert.ErrorIs(t, err, ErrCheckoutNotFound)
+
+	duplicate := CheckoutModel{CheckoutID: "checkout-2", BuyerID: "buyer-1"}
+	assert.Error(t, repo.CreateCheckout(ctx, &duplicate, []OrderModel{{OrderID: "order-1"}}, "buyer-1", CheckoutEffects{}))
+}
+
+func TestMemoryOrderRepositoryCheckoutEffects(t *testing.T) {
+	ctx := context.Background()
+	repo := NewMemoryOrderRepository()
+	repo.AddCoupon(CouponModel{Code: "ONCE", SellerID: "seller-1", Type: CouponPercentage, Value: 10, UsageLimit: 1, Active: true})
+	repo.AddCartItem(CartItemModel{BuyerID: "buyer-1", ProductID: "p1", Quantity: 1})
+	repo.AddCartItem(CartItemModel{BuyerID: "buyer-1", ProductID: "p2", Quantity: 2})
+
+	record, err := NewIdempotencyRecord("buyer-1", "key-1", "hash-1", 201, map[string]string{"checkoutId": "checkout-1"}, time.Now().UTC())
+	require.NoError(t, err)
+
+	checkout := CheckoutModel{CheckoutID: "checkout-1", BuyerID: "buyer-1"}
+	require.NoError(t, repo.CreateCheckout(ctx, &checkout, []OrderModel{{OrderID: "order-1", BuyerID: "buyer-1"}}, "buyer-1", CheckoutEffects{
+		CouponCode:  "ONCE",
+		ClearCart:   []string{"p1"},
+		Idempotency: record,
+	}))
+
+	coupon, err := repo.GetCoupon(ctx, "once")
+	require.NoError(t, err)
+	assert.Equal(t, 1, coupon.UsedCount)
+
+	cart, err := repo.CartItems(ctx, "buyer-1")
+	require.NoError(t, err)
+	require.Len(t, cart, 1)
+	assert.Equal(t, "p2", cart[0].ProductID, "only the checked out lines are removed")
+
+	stored, err := repo.LookupIdempotencyKey(ctx, "buyer-1", "key-1")
+	require.NoError(t, err)
+	require.NotNil(t, stored)
+	assert.JSONEq(t, `{"checkoutId": "checkout-1"}`, stored.Response)
+	stored, err = repo.LookupIdempotencyKey(ctx, "buyer-2", "key-1")
+	require.NoError(t, err)
+	assert.Nil(t, stored, "keys are scoped to the buyer")
+
+	// A failed effect writes nothing at all
+	second := CheckoutModel{CheckoutID: "checkout-2", BuyerID: "buyer-1"}
+	err = repo.CreateCheckout(ctx, &second, []OrderModel{{OrderID: "order-2", BuyerID: "buyer-1"}}, "buyer-1", CheckoutEffects{
+		CouponCode: "ONCE",
+		ClearCart:  []string{"p2"},
+	})
+	assert.ErrorIs(t, err, ErrCouponExhausted)
+	_, err = repo.GetCheckout(ctx, "checkout-2")
+	assert.ErrorIs(t, err, ErrCheckoutNotFound)
+	cart, _ = repo.CartItems(ctx, "buyer-1")
+	assert.Len(t, cart, 1)
+
+	err = repo.CreateCheckout(ctx, &second, []OrderModel{{OrderID: "order-2", BuyerID: "buyer-1"}}, "buyer-1", CheckoutEffects{Idempotency: record})
+	assert.Error(t, err, "a key can only be stored once")
+}
+
+func TestMemoryOrderRepositoryPaymentEvents(t *testing.T) {
+	ctx := context.Background()
+	repo := NewMemoryOrderRepository()
+	seedMemoryOrders(t, repo, "checkout-1",
+		OrderModel{OrderID: "order-1", BuyerID: "buyer-1", SellerID: "seller-1"},
+		OrderModel{OrderID: "order-2", BuyerID: "buyer-1", SellerID: "seller-2"},
+	)
+	_, err := repo.UpdateStatus(ctx, "order-2", StatusChange{To: StatusCancelled, ActorID: "buyer-1", Role: RoleBuyer})
+	require.NoError(t, err)
+
+	orders, err := repo.PayableOrders(ctx, "checkout-1")
+	require.NoError(t, err)
+	assert.Len(t, orders, 2)
+	orders, err = repo.PayableOrders(ctx, "order-1")
+	require.NoError(t, err)
+	assert.Len(t, orders, 1)
+
+	_, err = repo.LatestPayment(ctx, "checkout-1", "")
+	assert.ErrorIs(t, err, ErrPaymentNotFound)
+	require.NoError(t, repo.CreatePayment(ctx, &PaymentModel{
+		PaymentID: "payment-1", Reference: "checkout-1", BuyerID: "buyer-1", Provider: "stripe", IntentID: "pi_1", Status: PaymentPending,
+	}))
+	assert.Error(t, repo.CreatePayment(ctx, &PaymentModel{PaymentID: "payment-2", IntentID: "pi_1"}), "intents are unique")
+
+	duplicate, err := repo.ApplyPaymentEvent(ctx, &PaymentEvent{ID: "evt_1", Type: PaymentEventSucceeded, IntentID: "pi_1"})
+	require.NoError(t, err)
+	assert.False(t, duplicate)
+	duplicate, err = repo.ApplyPaymentEvent(ctx, &PaymentEvent{ID: "evt_1", Type: PaymentEventSucceeded, IntentID: "pi_1"})
+	require.NoError(t, err)
+	assert.True(t, duplicate)
+
+	order, _ := repo.GetOrder(ctx, "order-1")
+	assert.Equal(t, StatusPaid, order.Status)
+	order, _ = repo.GetOrder(ctx, "order-2")
+	assert.Equal(t, StatusCancelled, order.Status, "only pending orders are paid")
+	assert.Empty(t, repo.Refunds("order-2"), "the payment did not cover the order cancelled before it")
+	assert.Equal(t, []string{"order-placed", "order-paid"}, repo.Events("order-1"))
+
+	payment, err := repo.LatestPayment(ctx, "checkout-1", PaymentSucceeded)
+	require.NoError(t, err)
+	assert.Equal(t, "pi_1", payment.IntentID)
+
+	// Events for intents this service did not create are ignored
+	duplicate, err = repo.ApplyPaymentEvent(ctx, &PaymentEvent{ID: "evt_2", Type: PaymentEventSucceeded, IntentID: "pi_other"})
+	require.NoError(t, err)
+	assert.False(t, duplicate)
+}
+
+func TestMemoryOrderRepositoryUpdateStatus(t *testing.T) {
+	ctx := context.Background()
+	repo := NewMemoryOrderRepository()
+	seedMemoryOrders(t, repo, "checkout-1", OrderModel{OrderID: "order-1", BuyerID: "buyer-1", SellerID: "seller-1"})
+
+	_, err := repo.UpdateStatus(ctx, "order-1", StatusChange{To: StatusShipped, ActorID: "seller-1", Role: RoleSeller})
+	assert.ErrorIs(t, err, ErrInvalidTransition, "an unpaid order cannot ship")
+	_, err = repo.UpdateStatus(ctx, "order-1", StatusChange{To: StatusPaid, ActorID: "buyer-1", Role: RoleBuyer})
+	assert.ErrorIs(t, err, ErrTransitionForbidden)
+	_, err = repo.UpdateStatus(ctx, "missing", StatusChange{To: StatusPaid, Role: RoleSystem})
+	assert.ErrorIs(t, err, ErrOrderNotFound)
+
+	order, err := repo.UpdateStatus(ctx, "order-1", StatusChange{To: StatusPaid, ActorID: "payment", Role: RoleSystem, Reason: "paid"})
+	require.NoError(t, err)
+	assert.Equal(t, StatusPaid, order.Status)
+
+	order, err = repo.UpdateStatus(ctx, "order-1", StatusChange{
+		To: StatusShipped, ActorID: "seller-1", Role: RoleSeller,
+		Shipment: CreateShipmentInput{Carrier: " DHL ", TrackingNumber: "TRK1"},
+	})
+	require.NoError(t, err)
+	assert.Equal(t, StatusShipped, order.Status)
+
+	history, err := repo.History(ctx, "order-1")
+	require.NoError(t, err)
+	require.Len(t, history, 3)
+	assert.Equal(t, StatusPaid, history[2].FromStatus)
+	assert.Equal(t, "shipped with dhl, tracking TRK1", history[2].Reason)
+	assert.Equal(t, []string{"order-placed", "order-paid", "order-shipped"}, repo.Events("order-1"))
+	assert.Equal(t, int64(3), order.Version, "every status change bumps the version")
+}
+
+func TestMemoryOrderRepositoryExpectedVersion(t *testing.T) {
+	ctx := context.Background()
+	repo := NewMemoryOrderRepository()
+	seedMemoryOrders(t, repo, "checkout-1", OrderModel{OrderID: "order-1", BuyerID: "buyer-1", SellerID: "seller-1"})
+
+	_, err := repo.UpdateStatus(ctx, "order-1", StatusChange{To: StatusPaid, ActorID: "payment", Role: RoleSystem, ExpectedVersion: 2})
+	assert.ErrorIs(t, err, ErrVersionConflict)
+
+	order, err := repo.UpdateStatus(ctx, "order-1", StatusChange{To: StatusPaid, ActorID: "payment", Role: RoleSystem, ExpectedVersion: 1})
+	require.NoError(t, err)
+	assert.Equal(t, int64(2), order.Version)
+
+	// Of two writers that read version 2 only the first gets through
+	_, err = repo.UpdateStatus(ctx, "order-1", StatusChange{To: StatusCancelled, ActorID: "buyer-1", Role: RoleBuyer, ExpectedVersion: 2})
+	require.NoError(t, err)
+	_, err = repo.UpdateStatus(ctx, "order-1", StatusChange{To: StatusShipped, ActorID: "seller-1", Role: RoleSeller, ExpectedVersion: 2})
+	assert.ErrorIs(t, err, ErrVersionConflict)
+}
+
+func TestMemoryOrderRepositoryListOrders(t *testing.T) {
+	ctx := context.Background()
+	repo := NewMemoryOrderRepository()
+	for i := 1; i <= 5; i++ {
+		seedMemoryOrders(t, repo, fmt.Sprintf("checkout-%d", i),
+			OrderModel{OrderID: fmt.Sprintf("order-%d", i), BuyerID: "buyer-1", SellerID: "seller-1"})
+	}
+	seedMemoryOrders(t, repo, "checkout-other", OrderModel{OrderID: "order-other", BuyerID: "buyer-2", SellerID: "seller-2"})
+
+	// Spread the creation times out so the order is unambiguous
+	base := time.Date(2026, 3, 1, 0, 0, 0, 0, time.UTC)
+	for i := 1; i <= 5; i++ {
+		repo.orders[fmt.Sprintf("order-%d", i)].CreatedAt = base.Add(time.Duration(i) * time.Hour)
+	}
+	_, err := repo.UpdateStatus(ctx, "order-4", StatusChange{To: StatusCancelled, ActorID: "buyer-1", Role: RoleBuyer})
+	require.NoError(t, err)
+
+	ids := func(orders []OrderModel) []string {
+		var out []string
+		for _, order := range orders {
+			out = append(out, order.OrderID)
+		}
+		return out
+	}
+
+	orders, err := repo.ListOrders(ctx, OrderFilter{BuyerID: "buyer-1"}, OrderListParams{Limit: 2, Descending: true})
+	require.NoError(t, err)
+	assert.Equal(t, []string{"order-5", "order-4", "order-3"}, ids(orders), "one extra row marks another page")
+
+	page := BuildOrderPage(orders, 2)
+	cursor, err := DecodeOrderCursor(page.NextCursor)
+	require.NoError(t, err)
+	orders, err = repo.ListOrders(ctx, OrderFilter{BuyerID: "buyer-1"}, OrderListParams{Limit: 2, Descending: true, Cursor: cursor})
+	require.NoError(t, err)
+	assert.Equal(t, []string{"order-3", "order-2", "order-1"}, ids(orders))
+
+	from, to := base.Add(2*time.Hour), base.Add(5*time.Hour)
+	orders, err = repo.ListOrders(ctx, OrderFilter{SellerID: "seller-1"}, OrderListParams{
+		Limit: 10, Statuses: []string{StatusPending}, CreatedFrom: &from, CreatedTo: &to,
+	})
+	require.NoError(t, err)
+	assert.Equal(t, []string{"order-2", "order-3"}, ids(orders))
+
+	orders, err = repo.ListOrders(ctx, OrderFilter{SellerID: "seller-2"}, OrderListParams{Limit: 10})
+	require.NoError(t, err)
+	assert.Equal(t, []string{"order-other"}, ids(orders))
+}
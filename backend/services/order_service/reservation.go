@@ -0,0 +1,115 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"strings"
+
+	graphql "github.com/hasura/go-graphql-client"
+)
+
+// =============================================================================
+// Stock Reservations (ProductService)
+// =============================================================================
+
+// Checkout holds the cart's stock in ProductService before the orders are
+// written, using the checkout ID as the reservation ID. The stock updater
+// Lambda commits the reservation when an order-paid event arrives and returns
+// it on order-cancelled; ProductService releases it if it expires unpaid.
+
+// ProductCatalog is the part of ProductService that placing an order uses.
+// Handlers go through productCatalog so tests can place orders without it.
+type ProductCatalog interface {
+	FetchProducts(ctx context.Context, ids []string) (map[string]ProductDetails, []string, error)
+	ReserveStock(ctx context.Context, authorization, reservationID string, items []OrderItem) error
+	ReleaseReservation(ctx context.Context, authorization, reservationID string) error
+}
+
+// graphQLProductCatalog calls ProductService over GraphQL.
+type graphQLProductCatalog struct{}
+
+func (graphQLProductCatalog) FetchProducts(ctx context.Context, ids []string) (map[string]ProductDetails, []string, error) {
+	return FetchProducts(ctx, ids)
+}
+
+func (graphQLProductCatalog) ReserveStock(ctx context.Context, authorization, reservationID string, items []OrderItem) error {
+	return ReserveStock(ctx, authorization, reservationID, items)
+}
+
+func (graphQLProductCatalog) ReleaseReservation(ctx context.Context, authorization, reservationID string) error {
+	return ReleaseReservation(ctx, authorization, reservationID)
+}
+
+// StockItemInput mirrors ProductService's StockItemInput GraphQL input.
+type StockItemInput struct {
+	ProductID graphql.ID `json:"productId"`
+	Quantity  int        `json:"quantity"`
+}
+
+// ReserveStockMutation represents the reserveStock GraphQL mutation.
+type ReserveStockMutation struct {
+	ReserveStock struct {
+		ReservationID string `graphql:"reservationId"`
+		ExpiresAt     string `graphql:"expiresAt"`
+	} `graphql:"reserveStock(reservationId: $reservationId, items: $items)"`
+}
+
+// ReleaseReservationMutation represents the releaseReservation GraphQL mutation.
+type ReleaseReservationMutation struct {
+	ReleaseReservation struct {
+		ReservationID string `graphql:"reservationId"`
+	} `graphql:"releaseReservation(reservationId: $reservationId)"`
+}
+
+// StockItemsFor converts cart lines to reservation items.
+func StockItemsFor(items []OrderItem) []StockItemInput {
+	stockItems := make([]StockItemInput, len(items))
+	for i, item := range items {
+		stockItems[i] = StockItemInput{ProductID: graphql.ID(item.ProductID), Quantity: item.Quantity}
+	}
+	return stockItems
+}
+
+// ReserveStock holds stock for every cart line under reservationID. The
+// buyer's Authorization header is forwarded because ProductService only
+// accepts reservations from authenticated users.
+func ReserveStock(ctx context.Context, authorization, reservationID string, items []OrderItem) error {
+	var mutation ReserveStockMutation
+	variables := map[string]interface{}{
+		"reservationId": graphql.ID(reservationID),
+		"items":         StockItemsFor(items),
+	}
+
+	if err := productClientAs(authorization).Mutate(ctx, &mutation, variables); err != nil {
+		return err
+	}
+	return nil
+}
+
+// ReleaseReservation gives back stock held under reservationID.
+func ReleaseReservation(ctx context.Context, authorization, reservationID string) error {
+	var mutation ReleaseReservationMutation
+	variables := map[string]interface{}{
+		"reservationId": graphql.ID(reservationID),
+	}
+
+	if err := productClientAs(authorization).Mutate(ctx, &mutation, variables); err != nil {
+		return fmt.Errorf("failed to release reservation %s: %w", reservationID, err)
+	}
+	return nil
+}
+
+// IsInsufficientStock reports whether ProductService rejected a reservation
+// because a product does not have enough unreserved stock.
+func IsInsufficientStock(err error) bool {
+	return err != nil && strings.Contains(err.Error(), "insufficient stock")
+}
+
+// productClientAs returns the ProductService client with the caller's
+// Authorization header attached to every request.
+func productClientAs(authorization string) *graphql.Client {
+	return graphqlClient.WithRequestModifier(func(r *http.Request) {
+		r.Header.Set("Authorization", authorization)
+	})
+}
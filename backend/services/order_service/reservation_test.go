@@ -0,0 +1,36 @@
+package main
+
+import (
+	"errors"
+	"testing"
+
+	graphql "github.com/hasura/go-graphql-client"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestStockItemsFor(t *testing.T) {
+	items := StockItemsFor([]OrderItem{
+		{ProductID: "p1", Quantity: 2, Name: "Headphones"},
+		{ProductID: "p2", Quantity: 1},
+	})
+
+	assert.Equal(t, []StockItemInput{
+		{ProductID: graphql.ID("p1"), Quantity: 2},
+		{ProductID: graphql.ID("p2"), Quantity: 1},
+	}, items)
+}
+
+func TestIsInsufficientStock(t *testing.T) {
+	assert.True(t, IsInsufficientStock(errors.New("insufficient stock for product p1: available=0, requested=2")))
+	assert.False(t, IsInsufficientStock(errors.New("unauthorized: missing authentication")))
+	assert.False(t, IsInsufficientStock(nil))
+}
+
+func TestReserveStockMutationStructure(t *testing.T) {
+	var mutation ReserveStockMutation
+	mutation.ReserveStock.ReservationID = "checkout-1"
+	mutation.ReserveStock.ExpiresAt = "2026-03-01T12:15:00Z"
+
+	assert.Equal(t, "checkout-1", mutation.ReserveStock.ReservationID)
+	assert.Equal(t, "2026-03-01T12:15:00Z", mutation.ReserveStock.ExpiresAt)
+}
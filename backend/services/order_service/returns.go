@@ -0,0 +1,870 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log"
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/google/uuid"
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+)
+
+// =============================================================================
+// Returns
+// =============================================================================
+
+// A buyer returns units of one product of a delivered order by opening a
+// return with a reason. The seller approves or rejects it, and marks an
+// approved return received once the units are back, optionally putting them
+// back in stock. Receiving a return refunds its share of the order through the
+// payment provider; if the refund fails the return stays received and the
+// seller can retry it.
+
+// Return statuses.
+const (
+	ReturnRequested = "requested"
+	ReturnApproved  = "approved"
+	ReturnRejected  = "rejected"
+	ReturnCancelled = "cancelled"
+	ReturnReceived  = "received"
+	ReturnRefunded  = "refunded"
+)
+
+// returnTransitions is the return state machine, in the same form as
+// orderTransitions. Rejected and cancelled returns are closed and no longer
+// count against the units that can be returned.
+var returnTransitions = map[string]map[string][]string{
+	ReturnRequested: {
+		ReturnApproved:  {RoleSeller},
+		ReturnRejected:  {RoleSeller},
+		ReturnCancelled: {RoleBuyer},
+	},
+	ReturnApproved: {
+		ReturnReceived: {RoleSeller},
+	},
+	ReturnReceived: {
+		ReturnRefunded: {RoleSeller},
+	},
+}
+
+// maxReturnReasonLength caps the length of a return reason or seller note.
+const maxReturnReasonLength = 500
+
+// ErrNotReturnable is returned when a return is opened on an order that has
+// not been delivered.
+var ErrNotReturnable = errors.New("only delivered orders can be returned")
+
+// ErrInvalidReturn is returned when a return's product or quantity does not
+// match what is left to return on the order.
+var ErrInvalidReturn = errors.New("invalid return")
+
+// ErrNoRefundablePayment is returned when a received return has no succeeded
+// payment to refund against.
+var ErrNoRefundablePayment = errors.New("no refundable payment for order")
+
+// errForbiddenReturn aborts a transaction when the caller is not the buyer or
+// seller a return action belongs to.
+var errForbiddenReturn = errors.New("return belongs to another user")
+
+// ReturnModel represents the returns table in PostgreSQL. One row is kept per
+// return request. Refund is estimated when the return is opened and fixed when
+// it is received; RefundID is the provider's refund once it has been paid.
+type ReturnModel struct {
+	ReturnID  string    `gorm:"primaryKey;type:uuid;column:return_id" json:"returnId"`
+	OrderID   string    `gorm:"type:uuid;not null;index;column:order_id" json:"orderId"`
+	BuyerID   string    `gorm:"not null;column:buyer_id;index:idx_returns_buyer_created,priority:1" json:"buyerId"`
+	SellerID  string    `gorm:"not null;column:seller_id;index:idx_returns_seller_created,priority:1" json:"sellerId"`
+	ProductID string    `gorm:"not null;column:product_id" json:"productId"`
+	Quantity  int       `gorm:"not null;column:quantity" json:"quantity"`
+	Reason    string    `gorm:"not null;column:reason" json:"reason"`
+	Status    string    `gorm:"not null;default:requested;column:status" json:"status"` // requested, approved, rejected, cancelled, received, refunded
+	Restock   bool      `gorm:"not null;default:false;column:restock" json:"restock"`
+	Refund    Money     `gorm:"embedded;embeddedPrefix:refund_" json:"refund"`
+	RefundID  string    `gorm:"column:refund_id" json:"refundId,omitempty"`
+	CreatedAt time.Time `gorm:"autoCreateTime;column:created_at;index:idx_returns_buyer_created,priority:2;index:idx_returns_seller_created,priority:2" json:"createdAt"`
+	UpdatedAt time.Time `gorm:"autoUpdateTime;column:updated_at" json:"updatedAt"`
+}
+
+// TableName specifies the table name for GORM.
+func (ReturnModel) TableName() string {
+	return "returns"
+}
+
+// ReturnStatusHistory represents the return_status_history table in
+// PostgreSQL. One row is written for every status change a return goes
+// through, starting with the request itself.
+type ReturnStatusHistory struct {
+	HistoryID  string    `gorm:"primaryKey;type:uuid;column:history_id" json:"historyId"`
+	ReturnID   string    `gorm:"type:uuid;not null;index;column:return_id" json:"returnId"`
+	FromStatus string    `gorm:"column:from_status" json:"fromStatus"`
+	ToStatus   string    `gorm:"not null;column:to_status" json:"toStatus"`
+	ActorID    string    `gorm:"not null;column:actor_id" json:"actorId"`
+	ActorRole  string    `gorm:"not null;column:actor_role" json:"actorRole"`
+	Reason     string    `gorm:"column:reason" json:"reason,omitempty"`
+	CreatedAt  time.Time `gorm:"autoCreateTime;column:created_at" json:"createdAt"`
+}
+
+// TableName specifies the table name for GORM.
+func (ReturnStatusHistory) TableName() string {
+	return "return_status_history"
+}
+
+// CreateReturnInput represents the expected JSON body for opening a return.
+type CreateReturnInput struct {
+	ProductID string `json:"productId" binding:"required"`
+	Quantity  int    `json:"quantity" binding:"required,min=1"`
+	Reason    string `json:"reason" binding:"required"`
+}
+
+// ReturnActionInput represents the optional JSON body of the seller's return
+// actions. A note is required to reject a return; Restock only applies when
+// receiving one.
+type ReturnActionInput struct {
+	Note    string `json:"note,omitempty"`
+	Restock bool   `json:"restock,omitempty"`
+}
+
+// ReturnDetailResponse is a return with its status history.
+type ReturnDetailResponse struct {
+	Return  ReturnModel           `json:"return"`
+	History []ReturnStatusHistory `json:"history"`
+}
+
+// CanTransitionReturn checks the return state machine for a move from one
+// status to another by an actor with the given role.
+func CanTransitionReturn(from, to, role string) error {
+	allowed, ok := returnTransitions[from][to]
+	if !ok {
+		return fmt.Errorf("%w: %s -> %s", ErrInvalidTransition, from, to)
+	}
+
+	for _, r := range allowed {
+		if r == role {
+			return nil
+		}
+	}
+
+	return fmt.Errorf("%w: %s cannot move return from %s to %s", ErrTransitionForbidden, role, from, to)
+}
+
+// TransitionReturn moves a return to a new status and records the change in
+// its history. It must be called inside a transaction. The update is guarded
+// on the current status so two concurrent transitions cannot both succeed.
+func TransitionReturn(tx *gorm.DB, ret *ReturnModel, to, actorID, role, reason string) error {
+	from := ret.Status
+	if err := CanTransitionReturn(from, to, role); err != nil {
+		return err
+	}
+
+	result := tx.Model(&ReturnModel{}).
+		Where("return_id = ? AND status = ?", ret.ReturnID, from).
+		Update("status", to)
+	if result.Error != nil {
+		return fmt.Errorf("failed to update return status: %w", result.Error)
+	}
+	if result.RowsAffected == 0 {
+		return ErrStaleStatus
+	}
+
+	if err := RecordReturnStatusChange(tx, ret.ReturnID, from, to, actorID, role, reason); err != nil {
+		return err
+	}
+
+	ret.Status = to
+	return nil
+}
+
+// RecordReturnStatusChange writes a row to the return status history.
+func RecordReturnStatusChange(tx *gorm.DB, returnID, from, to, actorID, role, reason string) error {
+	entry := ReturnStatusHistory{
+		HistoryID:  uuid.New().String(),
+		ReturnID:   returnID,
+		FromStatus: from,
+		ToStatus:   to,
+		ActorID:    actorID,
+		ActorRole:  role,
+		Reason:     reason,
+	}
+
+	if err := tx.Create(&entry).Error; err != nil {
+		return fmt.Errorf("failed to record return history: %w", err)
+	}
+
+	return nil
+}
+
+// isOpenReturn reports whether a return still counts against the units that
+// can be returned.
+func isOpenReturn(ret ReturnModel) bool {
+	return ret.Status != ReturnRejected && ret.Status != ReturnCancelled
+}
+
+// isReceivedReturn reports whether a return's units are back with the seller.
+func isReceivedReturn(ret ReturnModel) bool {
+	return ret.Status == ReturnReceived || ret.Status == ReturnRefunded
+}
+
+// returnedQuantities returns the units of each product across the returns
+// that match.
+func returnedQuantities(returns []ReturnModel, match func(ReturnModel) bool) map[string]int {
+	returned := make(map[string]int)
+	for _, ret := range returns {
+		if match(ret) {
+			returned[ret.ProductID] += ret.Quantity
+		}
+	}
+	return returned
+}
+
+// lineTotals returns what was paid for each product's lines, after discounts
+// (see OrderItem.Total).
+func lineTotals(items []OrderItem) (map[string]Money, error) {
+	totals := make(map[string]Money, len(items))
+	for _, item := range items {
+		sum, err := totals[item.ProductID].Add(item.Total())
+		if err != nil {
+			return nil, err
+		}
+		totals[item.ProductID] = sum
+	}
+	return totals, nil
+}
+
+// ReturnRefundAmount works out the refund for returning quantity units of a
+// product, given the units of each product already refunded or about to be.
+// The refund is the units' share of what was paid for the product's lines plus
+// the same share of the order's tax; shipping is not refunded. Amounts are
+// taken as the difference between running totals, so refunding every unit of
+// an order across several returns adds up to exactly what was paid.
+func ReturnRefundAmount(order OrderModel, refunded map[string]int, productID string, quantity int) (Money, error) {
+	ordered := orderedQuantities(order.Items)
+	totals, err := lineTotals(order.Items)
+	if err != nil {
+		return Money{}, err
+	}
+
+	goods := func(productID string, units int) Money {
+		return totals[productID].Scale(int64(units), int64(ordered[productID]))
+	}
+
+	var goodsTotal, goodsBefore Money
+	for productID := range ordered {
+		if goodsTotal, err = goodsTotal.Add(totals[productID]); err != nil {
+			return Money{}, err
+		}
+		if goodsBefore, err = goodsBefore.Add(goods(productID, refunded[productID])); err != nil {
+			return Money{}, err
+		}
+	}
+
+	refund, err := goods(productID, refunded[productID]+quantity).Sub(goods(productID, refunded[productID]))
+	if err != nil {
+		return Money{}, err
+	}
+	if goodsTotal.Amount <= 0 || order.Tax.IsZero() {
+		return refund, nil
+	}
+
+	goodsAfter, err := goodsBefore.Add(refund)
+	if err != nil {
+		return Money{}, err
+	}
+	tax, err := order.Tax.Scale(goodsAfter.Amount, goodsTotal.Amount).Sub(order.Tax.Scale(goodsBefore.Amount, goodsTotal.Amount))
+	if err != nil {
+		return Money{}, err
+	}
+	return refund.Add(tax)
+}
+
+// PlanReturn checks a new return against the order and its existing returns
+// and returns the estimated refund.
+func PlanReturn(order OrderModel, returns []ReturnModel, input CreateReturnInput) (Money, error) {
+	if order.Status != StatusDelivered {
+		return Money{}, fmt.Errorf("%w: order is %s", ErrNotReturnable, order.Status)
+	}
+
+	reason := strings.TrimSpace(input.Reason)
+	if reason == "" || len(reason) > maxReturnReasonLength {
+		return Money{}, fmt.Errorf("%w: reason must be 1-%d characters", ErrInvalidReturn, maxReturnReasonLength)
+	}
+	if input.Quantity <= 0 {
+		return Money{}, fmt.Errorf("%w: quantity must be positive", ErrInvalidReturn)
+	}
+
+	ordered, ok := orderedQuantities(order.Items)[input.ProductID]
+	if !ok {
+		return Money{}, fmt.Errorf("%w: product %s is not in the order", ErrInvalidReturn, input.ProductID)
+	}
+
+	open := returnedQuantities(returns, isOpenReturn)
+	if remaining := ordered - open[input.ProductID]; input.Quantity > remaining {
+		return Money{}, fmt.Errorf("%w: only %d of product %s left to return, requested %d",
+			ErrInvalidReturn, remaining, input.ProductID, input.Quantity)
+	}
+
+	return ReturnRefundAmount(order, open, input.ProductID, input.Quantity)
+}
+
+// loadReturns returns an order's returns, oldest first.
+func loadReturns(tx *gorm.DB, orderID string) ([]ReturnModel, error) {
+	var returns []ReturnModel
+	if err := tx.Where("order_id = ?", orderID).Order("created_at ASC").Find(&returns).Error; err != nil {
+		return nil, fmt.Errorf("failed to load returns: %w", err)
+	}
+	return returns, nil
+}
+
+// lockReturn loads a return with a row lock for the rest of the transaction.
+// An ID that is not a UUID is reported as not found.
+func lockReturn(tx *gorm.DB, returnID string) (*ReturnModel, error) {
+	if _, err := uuid.Parse(returnID); err != nil {
+		return nil, gorm.ErrRecordNotFound
+	}
+
+	var ret ReturnModel
+	err := tx.Clauses(clause.Locking{Strength: "UPDATE"}).First(&ret, "return_id = ?", returnID).Error
+	if err != nil {
+		return nil, err
+	}
+	return &ret, nil
+}
+
+// CreateReturn opens a return on a delivered order. It must be called inside a
+// transaction holding the order's row lock, so concurrent returns cannot
+// return a unit twice.
+func CreateReturn(tx *gorm.DB, order *OrderModel, input CreateReturnInput, buyerID string) (*ReturnModel, error) {
+	existing, err := loadReturns(tx, order.OrderID)
+	if err != nil {
+		return nil, err
+	}
+
+	refund, err := PlanReturn(*order, existing, input)
+	if err != nil {
+		return nil, err
+	}
+
+	ret := ReturnModel{
+		ReturnID:  uuid.New().String(),
+		OrderID:   order.OrderID,
+		BuyerID:   order.BuyerID,
+		SellerID:  order.SellerID,
+		ProductID: input.ProductID,
+		Quantity:  input.Quantity,
+		Reason:    strings.TrimSpace(input.Reason),
+		Status:    ReturnRequested,
+		Refund:    refund,
+	}
+	if err := tx.Create(&ret).Error; err != nil {
+		return nil, fmt.Errorf("failed to create return: %w", err)
+	}
+
+	if err := RecordReturnStatusChange(tx, ret.ReturnID, "", ReturnRequested, buyerID, RoleBuyer, ret.Reason); err != nil {
+		return nil, err
+	}
+
+	return &ret, nil
+}
+
+// ReceiveReturn marks an approved return received and fixes its refund
+// against the returns already received. With restock set a "return-restocked"
+// event is queued so the units are put back in stock. It must be called inside
+// a transaction.
+func ReceiveReturn(tx *gorm.DB, ret *ReturnModel, actorID, note string, restock bool) error {
+	order, err := lockOrder(tx, ret.OrderID)
+	if err != nil {
+		return fmt.Errorf("failed to load order: %w", err)
+	}
+
+	returns, err := loadReturns(tx, ret.OrderID)
+	if err != nil {
+		return err
+	}
+	refund, err := ReturnRefundAmount(*order, returnedQuantities(returns, isReceivedReturn), ret.ProductID, ret.Quantity)
+	if err != nil {
+		return fmt.Errorf("failed to work out refund: %w", err)
+	}
+
+	if err := TransitionReturn(tx, ret, ReturnReceived, actorID, RoleSeller, note); err != nil {
+		return err
+	}
+
+	ret.Restock = restock
+	ret.Refund = refund
+	if err := tx.Model(&ReturnModel{}).Where("return_id = ?", ret.ReturnID).Updates(map[string]interface{}{
+		"restock":         restock,
+		"refund_amount":   refund.Amount,
+		"refund_currency": refund.Currency,
+	}).Error; err != nil {
+		return fmt.Errorf("failed to update return: %w", err)
+	}
+
+	if restock {
+		return EnqueueReturnRestockedEvent(tx, *ret)
+	}
+	return nil
+}
+
+// findRefundablePayment returns the succeeded payment that covered an order,
+// paid either for its checkout or for the order alone. A payment already
+// partly or fully refunded still counts; the provider refuses a refund larger
+// than what is left.
+func findRefundablePayment(tx *gorm.DB, order OrderModel) (*PaymentModel, error) {
+	references := []string{order.OrderID}
+	if order.CheckoutID != "" {
+		references = append(references, order.CheckoutID)
+	}
+
+	var payment PaymentModel
+	err := tx.Where("reference IN ? AND status IN ?", references, capturedPaymentStatuses).
+		Order("created_at DESC").
+		First(&payment).Error
+	if errors.Is(err, gorm.ErrRecordNotFound) {
+		return nil, ErrNoRefundablePayment
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to load payment: %w", err)
+	}
+	return &payment, nil
+}
+
+// RefundReturn pays out a received return's refund through the payment
+// provider and marks it refunded. The provider is called outside any
+// transaction with the return ID as idempotency key, so retrying after a
+// failure never refunds twice.
+func RefundReturn(ctx context.Context, database *gorm.DB, provider PaymentProvider, ret *ReturnModel, actorID string) error {
+	if err := CanTransitionReturn(ret.Status, ReturnRefunded, RoleSeller); err != nil {
+		return err
+	}
+
+	reason := "nothing to refund"
+	refundID := ""
+	if ret.Refund.Amount > 0 {
+		var order OrderModel
+		if err := database.WithContext(ctx).First(&order, "order_id = ?", ret.OrderID).Error; err != nil {
+			return fmt.Errorf("failed to load order: %w", err)
+		}
+		payment, err := findRefundablePayment(database.WithContext(ctx), order)
+		if err != nil {
+			return err
+		}
+
+		refund, err := provider.RefundPayment(ctx, payment.IntentID, ret.Refund, ret.ReturnID)
+		if err != nil {
+			return fmt.Errorf("refund failed: %w", err)
+		}
+		refundID = refund.ID
+		reason = fmt.Sprintf("refunded %s via %s refund %s", refund.Amount, provider.Name(), refund.ID)
+	}
+
+	return database.WithContext(ctx).Transaction(func(tx *gorm.DB) error {
+		if err := TransitionReturn(tx, ret, ReturnRefunded, actorID, RoleSeller, reason); err != nil {
+			return err
+		}
+		ret.RefundID = refundID
+		if err := tx.Model(&ReturnModel{}).Where("return_id = ?", ret.ReturnID).Update("refund_id", refundID).Error; err != nil {
+			return fmt.Errorf("failed to update return: %w", err)
+		}
+		return nil
+	})
+}
+
+// returnErrorStatus maps a return error to an HTTP status code.
+func returnErrorStatus(err error) int {
+	switch {
+	case errors.Is(err, ErrInvalidReturn):
+		return http.StatusBadRequest
+	case errors.Is(err, ErrNotReturnable), errors.Is(err, ErrNoRefundablePayment):
+		return http.StatusConflict
+	default:
+		return transitionErrorStatus(err)
+	}
+}
+
+// HandleCreateReturn godoc
+// @Summary Open a return
+// @Description Lets the buyer of a delivered order ask to return units of one of its products, with a reason
+// @Tags returns
+// @Accept json
+// @Produce json
+// @Param orderId path string true "Order ID"
+// @Param request body CreateReturnInput true "Product, quantity and reason"
+// @Success 201 {object} ReturnModel
+// @Failure 400 {object} ErrorResponse
+// @Failure 401 {object} ErrorResponse
+// @Failure 403 {object} ErrorResponse
+// @Failure 404 {object} ErrorResponse
+// @Failure 409 {object} ErrorResponse
+// @Router /orders/{orderId}/returns [post]
+func HandleCreateReturn(c *gin.Context) {
+	orderID := c.Param("orderId")
+
+	var input CreateReturnInput
+	if err := c.ShouldBindJSON(&input); err != nil {
+		c.JSON(http.StatusBadRequest, ErrorResponse{Error: "Invalid request. Product, quantity and reason are required."})
+		return
+	}
+
+	userID, exists := c.Get("userId")
+	if !exists {
+		c.JSON(http.StatusUnauthorized, ErrorResponse{Error: "User ID not found in token"})
+		return
+	}
+
+	var ret *ReturnModel
+	err := db.Transaction(func(tx *gorm.DB) error {
+		order, err := lockOrder(tx, orderID)
+		if err != nil {
+			return err
+		}
+		if order.BuyerID != userID.(string) {
+			return errForbiddenOrder
+		}
+
+		ret, err = CreateReturn(tx, order, input, userID.(string))
+		return err
+	})
+	switch {
+	case errors.Is(err, gorm.ErrRecordNotFound):
+		c.JSON(http.StatusNotFound, ErrorResponse{Error: "Order not found"})
+		return
+	case errors.Is(err, errForbiddenOrder):
+		c.JSON(http.StatusForbidden, ErrorResponse{Error: "You can only return your own orders"})
+		return
+	case err != nil:
+		c.JSON(returnErrorStatus(err), ErrorResponse{Error: "Cannot open return: " + err.Error()})
+		return
+	}
+
+	c.JSON(http.StatusCreated, ret)
+}
+
+// HandleGetReturns godoc
+// @Summary List returns
+// @Description Returns the caller's returns, newest first: a buyer's own returns or those on a seller's orders
+// @Tags returns
+// @Produce json
+// @Param status query string false "Only returns with this status"
+// @Param orderId query string false "Only returns of this order"
+// @Success 200 {object} []ReturnModel
+// @Failure 401 {object} ErrorResponse
+// @Failure 500 {object} ErrorResponse
+// @Router /returns [get]
+func HandleGetReturns(c *gin.Context) {
+	userID, exists := c.Get("userId")
+	if !exists {
+		c.JSON(http.StatusUnauthorized, ErrorResponse{Error: "User ID not found in token"})
+		return
+	}
+
+	query := db.Model(&ReturnModel{})
+	if customRole, _ := c.Get("customRole"); customRole == "seller" {
+		query = query.Where("seller_id = ?", userID.(string))
+	} else {
+		query = query.Where("buyer_id = ?", userID.(string))
+	}
+	if status := c.Query("status"); status != "" {
+		query = query.Where("status = ?", status)
+	}
+	if orderID := c.Query("orderId"); orderID != "" {
+		if _, err := uuid.Parse(orderID); err != nil {
+			c.JSON(http.StatusOK, []ReturnModel{})
+			return
+		}
+		query = query.Where("order_id = ?", orderID)
+	}
+
+	returns := []ReturnModel{}
+	if err := query.Order("created_at DESC").Find(&returns).Error; err != nil {
+		c.JSON(http.StatusInternalServerError, ErrorResponse{Error: "Failed to fetch returns"})
+		return
+	}
+
+	c.JSON(http.StatusOK, returns)
+}
+
+// HandleGetReturn godoc
+// @Summary Get a return
+// @Description Returns a return with its status history (buyer or seller of the return only)
+// @Tags returns
+// @Produce json
+// @Param returnId path string true "Return ID"
+// @Success 200 {object} ReturnDetailResponse
+// @Failure 401 {object} ErrorResponse
+// @Failure 403 {object} ErrorResponse
+// @Failure 404 {object} ErrorResponse
+// @Failure 500 {object} ErrorResponse
+// @Router /returns/{returnId} [get]
+func HandleGetReturn(c *gin.Context) {
+	returnID := c.Param("returnId")
+
+	userID, exists := c.Get("userId")
+	if !exists {
+		c.JSON(http.StatusUnauthorized, ErrorResponse{Error: "User ID not found in token"})
+		return
+	}
+
+	var ret ReturnModel
+	if _, err := uuid.Parse(returnID); err != nil || db.First(&ret, "return_id = ?", returnID).Error != nil {
+		c.JSON(http.StatusNotFound, ErrorResponse{Error: "Return not found"})
+		return
+	}
+
+	if ret.BuyerID != userID.(string) && ret.SellerID != userID.(string) {
+		c.JSON(http.StatusForbidden, ErrorResponse{Error: "You can only view your own returns"})
+		return
+	}
+
+	var history []ReturnStatusHistory
+	if err := db.Where("return_id = ?", returnID).Order("created_at ASC").Find(&history).Error; err != nil {
+		c.JSON(http.StatusInternalServerError, ErrorResponse{Error: "Failed to fetch return history"})
+		return
+	}
+
+	c.JSON(http.StatusOK, ReturnDetailResponse{Return: ret, History: history})
+}
+
+// bindReturnActionInput reads the optional body of a return action, writing
+// an error response if it is malformed or the note is too long.
+func bindReturnActionInput(c *gin.Context) (ReturnActionInput, bool) {
+	var input ReturnActionInput
+	if c.Request.ContentLength != 0 {
+		if err := c.ShouldBindJSON(&input); err != nil {
+			c.JSON(http.StatusBadRequest, ErrorResponse{Error: "Invalid request body"})
+			return input, false
+		}
+	}
+
+	input.Note = strings.TrimSpace(input.Note)
+	if len(input.Note) > maxReturnReasonLength {
+		c.JSON(http.StatusBadRequest, ErrorResponse{Error: fmt.Sprintf("Note must be at most %d characters", maxReturnReasonLength)})
+		return input, false
+	}
+	return input, true
+}
+
+// updateReturn locks a return, checks that the caller is its buyer or seller
+// (by role) and applies action to it in one transaction, writing an error
+// response if anything fails.
+func updateReturn(c *gin.Context, role, verb string, action func(tx *gorm.DB, ret *ReturnModel, actorID string) error) (*ReturnModel, bool) {
+	customRole, _ := c.Get("customRole")
+	if (role == RoleSeller) != (customRole == "seller") {
+		c.JSON(http.StatusForbidden, ErrorResponse{Error: fmt.Sprintf("Only the %s can %s a return", role, verb)})
+		return nil, false
+	}
+
+	userID, exists := c.Get("userId")
+	if !exists {
+		c.JSON(http.StatusUnauthorized, ErrorResponse{Error: "User ID not found in token"})
+		return nil, false
+	}
+
+	var ret *ReturnModel
+	err := db.Transaction(func(tx *gorm.DB) error {
+		var err error
+		ret, err = lockReturn(tx, c.Param("returnId"))
+		if err != nil {
+			return err
+		}
+
+		owner := ret.BuyerID
+		if role == RoleSeller {
+			owner = ret.SellerID
+		}
+		if owner != userID.(string) {
+			return errForbiddenReturn
+		}
+
+		return action(tx, ret, userID.(string))
+	})
+	switch {
+	case errors.Is(err, gorm.ErrRecordNotFound):
+		c.JSON(http.StatusNotFound, ErrorResponse{Error: "Return not found"})
+		return nil, false
+	case errors.Is(err, errForbiddenReturn):
+		c.JSON(http.StatusForbidden, ErrorResponse{Error: fmt.Sprintf("You can only %s your own returns", verb)})
+		return nil, false
+	case err != nil:
+		c.JSON(returnErrorStatus(err), ErrorResponse{Error: fmt.Sprintf("Cannot %s return: %s", verb, err.Error())})
+		return nil, false
+	}
+
+	return ret, true
+}
+
+// HandleApproveReturn godoc
+// @Summary Approve a return
+// @Description Lets the seller accept a requested return so the buyer can send the units back
+// @Tags returns
+// @Accept json
+// @Produce json
+// @Param returnId path string true "Return ID"
+// @Param request body ReturnActionInput false "Optional note"
+// @Success 200 {object} ReturnModel
+// @Failure 400 {object} ErrorResponse
+// @Failure 401 {object} ErrorResponse
+// @Failure 403 {object} ErrorResponse
+// @Failure 404 {object} ErrorResponse
+// @Failure 409 {object} ErrorResponse
+// @Router /returns/{returnId}/approve [post]
+func HandleApproveReturn(c *gin.Context) {
+	input, ok := bindReturnActionInput(c)
+	if !ok {
+		return
+	}
+
+	ret, ok := updateReturn(c, RoleSeller, "approve", func(tx *gorm.DB, ret *ReturnModel, actorID string) error {
+		return TransitionReturn(tx, ret, ReturnApproved, actorID, RoleSeller, input.Note)
+	})
+	if !ok {
+		return
+	}
+
+	c.JSON(http.StatusOK, ret)
+}
+
+// HandleRejectReturn godoc
+// @Summary Reject a return
+// @Description Lets the seller turn down a requested return, with a note for the buyer
+// @Tags returns
+// @Accept json
+// @Produce json
+// @Param returnId path string true "Return ID"
+// @Param request body ReturnActionInput true "Reason for rejecting"
+// @Success 200 {object} ReturnModel
+// @Failure 400 {object} ErrorResponse
+// @Failure 401 {object} ErrorResponse
+// @Failure 403 {object} ErrorResponse
+// @Failure 404 {object} ErrorResponse
+// @Failure 409 {object} ErrorResponse
+// @Router /returns/{returnId}/reject [post]
+func HandleRejectReturn(c *gin.Context) {
+	input, ok := bindReturnActionInput(c)
+	if !ok {
+		return
+	}
+	if input.Note == "" {
+		c.JSON(http.StatusBadRequest, ErrorResponse{Error: "Invalid request. A note is required to reject a return."})
+		return
+	}
+
+	ret, ok := updateReturn(c, RoleSeller, "reject", func(tx *gorm.DB, ret *ReturnModel, actorID string) error {
+		return TransitionReturn(tx, ret, ReturnRejected, actorID, RoleSeller, input.Note)
+	})
+	if !ok {
+		return
+	}
+
+	c.JSON(http.StatusOK, ret)
+}
+
+// HandleCancelReturn godoc
+// @Summary Cancel a return
+// @Description Lets the buyer withdraw a return the seller has not acted on yet
+// @Tags returns
+// @Accept json
+// @Produce json
+// @Param returnId path string true "Return ID"
+// @Param request body ReturnActionInput false "Optional note"
+// @Success 200 {object} ReturnModel
+// @Failure 400 {object} ErrorResponse
+// @Failure 401 {object} ErrorResponse
+// @Failure 403 {object} ErrorResponse
+// @Failure 404 {object} ErrorResponse
+// @Failure 409 {object} ErrorResponse
+// @Router /returns/{returnId}/cancel [post]
+func HandleCancelReturn(c *gin.Context) {
+	input, ok := bindReturnActionInput(c)
+	if !ok {
+		return
+	}
+
+	ret, ok := updateReturn(c, RoleBuyer, "cancel", func(tx *gorm.DB, ret *ReturnModel, actorID string) error {
+		return TransitionReturn(tx, ret, ReturnCancelled, actorID, RoleBuyer, input.Note)
+	})
+	if !ok {
+		return
+	}
+
+	c.JSON(http.StatusOK, ret)
+}
+
+// HandleReceiveReturn godoc
+// @Summary Receive a return
+// @Description Lets the seller confirm an approved return's units arrived, optionally restocking them, and refunds the buyer. If the refund fails the return stays received and 202 is returned; retry with POST /returns/{returnId}/refund.
+// @Tags returns
+// @Accept json
+// @Produce json
+// @Param returnId path string true "Return ID"
+// @Param request body ReturnActionInput false "Restock flag and optional note"
+// @Success 200 {object} ReturnModel
+// @Success 202 {object} ReturnModel
+// @Failure 400 {object} ErrorResponse
+// @Failure 401 {object} ErrorResponse
+// @Failure 403 {object} ErrorResponse
+// @Failure 404 {object} ErrorResponse
+// @Failure 409 {object} ErrorResponse
+// @Router /returns/{returnId}/receive [post]
+func HandleReceiveReturn(c *gin.Context) {
+	input, ok := bindReturnActionInput(c)
+	if !ok {
+		return
+	}
+
+	ret, ok := updateReturn(c, RoleSeller, "receive", func(tx *gorm.DB, ret *ReturnModel, actorID string) error {
+		return ReceiveReturn(tx, ret, actorID, input.Note, input.Restock)
+	})
+	if !ok {
+		return
+	}
+
+	userID, _ := c.Get("userId")
+	if err := RefundReturn(c.Request.Context(), db, paymentProvider, ret, userID.(string)); err != nil {
+		log.Printf("Failed to refund return %s: %v", ret.ReturnID, err)
+		c.JSON(http.StatusAccepted, ret)
+		return
+	}
+
+	c.JSON(http.StatusOK, ret)
+}
+
+// HandleRefundReturn godoc
+// @Summary Refund a return
+// @Description Retries the refund of a received return whose refund failed
+// @Tags returns
+// @Produce json
+// @Param returnId path string true "Return ID"
+// @Success 200 {object} ReturnModel
+// @Failure 401 {object} ErrorResponse
+// @Failure 403 {object} ErrorResponse
+// @Failure 404 {object} ErrorResponse
+// @Failure 409 {object} ErrorResponse
+// @Failure 502 {object} ErrorResponse
+// @Router /returns/{returnId}/refund [post]
+func HandleRefundReturn(c *gin.Context) {
+	ret, ok := updateReturn(c, RoleSeller, "refund", func(tx *gorm.DB, ret *ReturnModel, actorID string) error {
+		return CanTransitionReturn(ret.Status, ReturnRefunded, RoleSeller)
+	})
+	if !ok {
+		return
+	}
+
+	userID, _ := c.Get("userId")
+	err := RefundReturn(c.Request.Context(), db, paymentProvider, ret, userID.(string))
+	switch {
+	case errors.Is(err, ErrNoRefundablePayment), errors.Is(err, ErrStaleStatus):
+		c.JSON(http.StatusConflict, ErrorResponse{Error: "Cannot refund return: " + err.Error()})
+		return
+	case err != nil:
+		log.Printf("Failed to refund return %s: %v", ret.ReturnID, err)
+		c.JSON(http.StatusBadGateway, ErrorResponse{Error: "Failed to refund return"})
+		return
+	}
+
+	c.JSON(http.StatusOK, ret)
+}
@@ -0,0 +1,179 @@
+package main
+
+import (
+	"bytes"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/gin-gonic/gin"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func cents(amount int64) Money {
+	return Money{Amount: amount, Currency: "LKR"}
+}
+
+func returnOrder() OrderModel {
+	return OrderModel{
+		OrderID: "order-1",
+		Status:  StatusDelivered,
+		Items: OrderItemsJSON{
+			{ProductID: "p1", Quantity: 3, LineTotal: cents(3000)},
+			{ProductID: "p2", Quantity: 1, LineTotal: cents(1000)},
+		},
+		Tax: cents(720),
+	}
+}
+
+func TestCanTransitionReturn(t *testing.T) {
+	tests := []struct {
+		name    string
+		from    string
+		to      string
+		role    string
+		wantErr error
+	}{
+		{"seller_approves", ReturnRequested, ReturnApproved, RoleSeller, nil},
+		{"seller_rejects", ReturnRequested, ReturnRejected, RoleSeller, nil},
+		{"buyer_cancels", ReturnRequested, ReturnCancelled, RoleBuyer, nil},
+		{"seller_receives", ReturnApproved, ReturnReceived, RoleSeller, nil},
+		{"seller_refunds", ReturnReceived, ReturnRefunded, RoleSeller, nil},
+		{"buyer_cannot_approve", ReturnRequested, ReturnApproved, RoleBuyer, ErrTransitionForbidden},
+		{"seller_cannot_cancel", ReturnRequested, ReturnCancelled, RoleSeller, ErrTransitionForbidden},
+		{"cannot_receive_unapproved", ReturnRequested, ReturnReceived, RoleSeller, ErrInvalidTransition},
+		{"cannot_cancel_approved", ReturnApproved, ReturnCancelled, RoleBuyer, ErrInvalidTransition},
+		{"rejected_is_final", ReturnRejected, ReturnApproved, RoleSeller, ErrInvalidTransition},
+		{"refunded_is_final", ReturnRefunded, ReturnReceived, RoleSeller, ErrInvalidTransition},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			err := CanTransitionReturn(tt.from, tt.to, tt.role)
+			if tt.wantErr == nil {
+				assert.NoError(t, err)
+			} else {
+				assert.ErrorIs(t, err, tt.wantErr)
+			}
+		})
+	}
+}
+
+func TestReturnRefundAmount(t *testing.T) {
+	order := returnOrder()
+
+	// Each refund is the units' share of the line plus the same share of tax
+	refund, err := ReturnRefundAmount(order, nil, "p1", 1)
+	require.NoError(t, err)
+	assert.Equal(t, cents(1180), refund)
+
+	refund, err = ReturnRefundAmount(order, map[string]int{"p1": 1}, "p1", 2)
+	require.NoError(t, err)
+	assert.Equal(t, cents(2360), refund)
+
+	refund, err = ReturnRefundAmount(order, map[string]int{"p1": 3}, "p2", 1)
+	require.NoError(t, err)
+	assert.Equal(t, cents(1180), refund)
+
+	// Refunds one unit at a time add up to the line total despite rounding
+	order = OrderModel{Items: OrderItemsJSON{{ProductID: "p1", Quantity: 3, LineTotal: cents(1000)}}}
+	var total Money
+	for i := 0; i < 3; i++ {
+		refund, err := ReturnRefundAmount(order, map[string]int{"p1": i}, "p1", 1)
+		require.NoError(t, err)
+		total, err = total.Add(refund)
+		require.NoError(t, err)
+	}
+	assert.Equal(t, cents(1000), total)
+
+	// Lines without a stored total fall back to price x quantity
+	order = OrderModel{Items: OrderItemsJSON{{ProductID: "p1", Quantity: 2, Price: cents(450)}}}
+	refund, err = ReturnRefundAmount(order, nil, "p1", 1)
+	require.NoError(t, err)
+	assert.Equal(t, cents(450), refund)
+}
+
+func TestPlanReturn(t *testing.T) {
+	order := returnOrder()
+
+	refund, err := PlanReturn(order, nil, CreateReturnInput{ProductID: "p1", Quantity: 1, Reason: "Damaged"})
+	require.NoError(t, err)
+	assert.Equal(t, cents(1180), refund)
+
+	open := []ReturnModel{{ProductID: "p1", Quantity: 2, Status: ReturnApproved}}
+	_, err = PlanReturn(order, open, CreateReturnInput{ProductID: "p1", Quantity: 2, Reason: "Damaged"})
+	assert.ErrorIs(t, err, ErrInvalidReturn, "open returns count against the units left")
+
+	closed := []ReturnModel{{ProductID: "p1", Quantity: 3, Status: ReturnRejected}, {ProductID: "p1", Quantity: 3, Status: ReturnCancelled}}
+	_, err = PlanReturn(order, closed, CreateReturnInput{ProductID: "p1", Quantity: 3, Reason: "Damaged"})
+	assert.NoError(t, err, "rejected and cancelled returns free their units")
+
+	_, err = PlanReturn(order, nil, CreateReturnInput{ProductID: "p9", Quantity: 1, Reason: "Damaged"})
+	assert.ErrorIs(t, err, ErrInvalidReturn)
+
+	_, err = PlanReturn(order, nil, CreateReturnInput{ProductID: "p1", Quantity: 1, Reason: "   "})
+	assert.ErrorIs(t, err, ErrInvalidReturn)
+
+	order.Status = StatusShipped
+	_, err = PlanReturn(order, nil, CreateReturnInput{ProductID: "p1", Quantity: 1, Reason: "Damaged"})
+	assert.ErrorIs(t, err, ErrNotReturnable)
+}
+
+func TestReturnErrorStatus(t *testing.T) {
+	assert.Equal(t, http.StatusBadRequest, returnErrorStatus(ErrInvalidReturn))
+	assert.Equal(t, http.StatusConflict, returnErrorStatus(ErrNotReturnable))
+	assert.Equal(t, http.StatusConflict, returnErrorStatus(ErrNoRefundablePayment))
+	assert.Equal(t, http.StatusConflict, returnErrorStatus(ErrStaleStatus))
+	assert.Equal(t, http.StatusForbidden, returnErrorStatus(ErrTransitionForbidden))
+}
+
+func TestReturnEndpointsValidation(t *testing.T) {
+	tests := []struct {
+		name           string
+		role           string
+		method         string
+		path           string
+		requestBody    string
+		expectedStatus int
+	}{
+		{name: "create_missing_reason", role: "buyer", method: "POST", path: "/orders/order-1/returns", requestBody: `{"productId": "p1", "quantity": 1}`, expectedStatus: http.StatusBadRequest},
+		{name: "create_zero_quantity", role: "buyer", method: "POST", path: "/orders/order-1/returns", requestBody: `{"productId": "p1", "quantity": 0, "reason": "Damaged"}`, expectedStatus: http.StatusBadRequest},
+		{name: "buyer_cannot_approve", role: "buyer", method: "POST", path: "/returns/3f9a8e36-64a4-4f0c-9d57-0e6c1d1f2a10/approve", expectedStatus: http.StatusForbidden},
+		{name: "seller_cannot_cancel", role: "seller", method: "POST", path: "/returns/3f9a8e36-64a4-4f0c-9d57-0e6c1d1f2a10/cancel", expectedStatus: http.StatusForbidden},
+		{name: "reject_without_note", role: "seller", method: "POST", path: "/returns/3f9a8e36-64a4-4f0c-9d57-0e6c1d1f2a10/reject", requestBody: `{}`, expectedStatus: http.StatusBadRequest},
+		{name: "receive_invalid_json", role: "seller", method: "POST", path: "/returns/3f9a8e36-64a4-4f0c-9d57-0e6c1d1f2a10/receive", requestBody: `{"restock":`, expectedStatus: http.StatusBadRequest},
+		{name: "buyer_cannot_refund", role: "buyer", method: "POST", path: "/returns/3f9a8e36-64a4-4f0c-9d57-0e6c1d1f2a10/refund", expectedStatus: http.StatusForbidden},
+		{name: "get_unknown_id", role: "buyer", method: "GET", path: "/returns/rma-1", expectedStatus: http.StatusNotFound},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			r := setupTestRouter()
+			r.Use(func(c *gin.Context) {
+				c.Set("customRole", tt.role)
+				c.Set("userId", "user-1")
+				c.Next()
+			})
+			r.POST("/orders/:orderId/returns", HandleCreateReturn)
+			r.GET("/returns/:returnId", HandleGetReturn)
+			r.POST("/returns/:returnId/approve", HandleApproveReturn)
+			r.POST("/returns/:returnId/reject", HandleRejectReturn)
+			r.POST("/returns/:returnId/cancel", HandleCancelReturn)
+			r.POST("/returns/:returnId/receive", HandleReceiveReturn)
+			r.POST("/returns/:returnId/refund", HandleRefundReturn)
+
+			req, _ := http.NewRequest(tt.method, tt.path, bytes.NewBufferString(tt.requestBody))
+			req.Header.Set("Content-Type", "application/json")
+			w := httptest.NewRecorder()
+			r.ServeHTTP(w, req)
+
+			assert.Equal(t, tt.expectedStatus, w.Code)
+		})
+	}
+}
+
+func TestReturnTableNames(t *testing.T) {
+	assert.Equal(t, "returns", ReturnModel{}.TableName())
+	assert.Equal(t, "return_status_history", ReturnStatusHistory{}.TableName())
+}
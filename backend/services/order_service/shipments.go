@@ -0,0 +1,479 @@
+package main
+
+import (
+	"database/sql/driver"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"regexp"
+	"strings"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/google/uuid"
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+)
+
+// =============================================================================
+// Shipments
+// =============================================================================
+
+// A seller fulfils a paid order with one or more shipments, each sent with a
+// carrier under a tracking number and covering some of the order's units.
+// The order's status follows its shipments: partially_shipped while units are
+// left to ship, shipped once every unit is in a shipment, and delivered once
+// every shipment is. Shipment statuses are kept up to date by the
+// ShipmentPoller (tracking.go).
+
+// Shipment statuses.
+const (
+	ShipmentCreated        = "created"
+	ShipmentInTransit      = "in_transit"
+	ShipmentOutForDelivery = "out_for_delivery"
+	ShipmentDelivered      = "delivered"
+	ShipmentException      = "exception"
+)
+
+// shipmentStatuses are the statuses a carrier may report.
+var shipmentStatuses = map[string]bool{
+	ShipmentCreated:        true,
+	ShipmentInTransit:      true,
+	ShipmentOutForDelivery: true,
+	ShipmentDelivered:      true,
+	ShipmentException:      true,
+}
+
+// ErrNothingToShip is returned when a shipment would contain no units, because
+// none were requested or every unit of the order has already shipped.
+var ErrNothingToShip = errors.New("nothing left to ship")
+
+// ErrDuplicateTracking is returned when the carrier's tracking number is
+// already used by another shipment.
+var ErrDuplicateTracking = errors.New("tracking number already used")
+
+// ErrInvalidShipment is returned when a shipment's lines do not match what is
+// left to ship on the order.
+var ErrInvalidShipment = errors.New("invalid shipment")
+
+// CarrierManual is recorded for shipments sent without carrier tracking, such
+// as orders marked shipped through PUT /updateStatus. They are never polled.
+const CarrierManual = "manual"
+
+// carrierCodePattern is the accepted format for carrier codes, after
+// lower-casing.
+var carrierCodePattern = regexp.MustCompile(`^[a-z0-9_-]{2,32}$`)
+
+// ShipmentItem is a quantity of one of the order's products in a shipment.
+type ShipmentItem struct {
+	ProductID string `json:"productId"`
+	Quantity  int    `json:"quantity"`
+}
+
+// ShipmentItemsJSON is a JSONB column type for storing shipment lines in
+// PostgreSQL.
+type ShipmentItemsJSON []ShipmentItem
+
+// Value implements driver.Valuer interface for GORM.
+func (s ShipmentItemsJSON) Value() (driver.Value, error) {
+	return json.Marshal(s)
+}
+
+// Scan implements sql.Scanner interface for GORM.
+func (s *ShipmentItemsJSON) Scan(value interface{}) error {
+	bytes, ok := value.([]byte)
+	if !ok {
+		return fmt.Errorf("failed to unmarshal JSONB value: %v", value)
+	}
+	return json.Unmarshal(bytes, s)
+}
+
+// ShipmentModel represents the shipments table in PostgreSQL. A tracking
+// number is unique per carrier. LastCheckedAt is when the poller last asked
+// the carrier for the shipment's status.
+type ShipmentModel struct {
+	ShipmentID     string            `gorm:"primaryKey;type:uuid;column:shipment_id" json:"shipmentId"`
+	OrderID        string            `gorm:"type:uuid;not null;index;column:order_id" json:"orderId"`
+	SellerID       string            `gorm:"not null;column:seller_id" json:"sellerId"`
+	Carrier        string            `gorm:"not null;column:carrier;uniqueIndex:idx_shipments_carrier_tracking,where:tracking_number <> ''" json:"carrier"`
+	TrackingNumber string            `gorm:"not null;column:tracking_number;uniqueIndex:idx_shipments_carrier_tracking" json:"trackingNumber"`
+	Items          ShipmentItemsJSON `gorm:"type:jsonb;not null;column:items" json:"items"`
+	Status         string            `gorm:"not null;default:created;column:status;index:idx_shipments_status_checked,priority:1" json:"status"`
+	LastCheckedAt  *time.Time        `gorm:"column:last_checked_at;index:idx_shipments_status_checked,priority:2" json:"lastCheckedAt,omitempty"`
+	DeliveredAt    *time.Time        `gorm:"column:delivered_at" json:"deliveredAt,omitempty"`
+	CreatedAt      time.Time         `gorm:"autoCreateTime;column:created_at" json:"createdAt"`
+	UpdatedAt      time.Time         `gorm:"autoUpdateTime;column:updated_at" json:"updatedAt"`
+}
+
+// TableName specifies the table name for GORM.
+func (ShipmentModel) TableName() string {
+	return "shipments"
+}
+
+// CreateShipmentInput represents the expected JSON body for creating a
+// shipment. Without Items the shipment covers every unit left to ship.
+type CreateShipmentInput struct {
+	Carrier        string         `json:"carrier" binding:"required"`
+	TrackingNumber string         `json:"trackingNumber" binding:"required"`
+	Items          []ShipmentItem `json:"items,omitempty"`
+}
+
+// CreateShipmentResponse represents the response after creating a shipment.
+type CreateShipmentResponse struct {
+	Shipment    ShipmentModel `json:"shipment"`
+	OrderStatus string        `json:"orderStatus"`
+}
+
+// NormalizeCarrier trims and lower-cases a carrier code.
+func NormalizeCarrier(carrier string) string {
+	return strings.ToLower(strings.TrimSpace(carrier))
+}
+
+// orderedQuantities returns the units ordered of each product.
+func orderedQuantities(items []OrderItem) map[string]int {
+	ordered := make(map[string]int, len(items))
+	for _, item := range items {
+		ordered[item.ProductID] += item.Quantity
+	}
+	return ordered
+}
+
+// shippedQuantities returns the units of each product across the shipments.
+func shippedQuantities(shipments []ShipmentModel) map[string]int {
+	shipped := make(map[string]int)
+	for _, shipment := range shipments {
+		for _, item := range shipment.Items {
+			shipped[item.ProductID] += item.Quantity
+		}
+	}
+	return shipped
+}
+
+// PlanShipment works out the lines of a new shipment for an order that
+// already has the given shipments. Requested lines for the same product are
+// merged; with no requested lines the shipment takes every unit left to ship.
+// Lines are returned in the order's product order.
+func PlanShipment(order OrderModel, shipments []ShipmentModel, requested []ShipmentItem) ([]ShipmentItem, error) {
+	ordered := orderedQuantities(order.Items)
+	shipped := shippedQuantities(shipments)
+
+	wanted := make(map[string]int, len(requested))
+	for _, item := range requested {
+		if item.Quantity <= 0 {
+			return nil, fmt.Errorf("%w: quantity for product %s must be positive", ErrInvalidShipment, item.ProductID)
+		}
+		if _, ok := ordered[item.ProductID]; !ok {
+			return nil, fmt.Errorf("%w: product %s is not in the order", ErrInvalidShipment, item.ProductID)
+		}
+		wanted[item.ProductID] += item.Quantity
+	}
+
+	lines := make([]ShipmentItem, 0, len(ordered))
+	seen := make(map[string]bool, len(ordered))
+	for _, item := range order.Items {
+		if seen[item.ProductID] {
+			continue
+		}
+		seen[item.ProductID] = true
+
+		remaining := ordered[item.ProductID] - shipped[item.ProductID]
+		quantity := remaining
+		if len(requested) > 0 {
+			quantity = wanted[item.ProductID]
+			if quantity > remaining {
+				return nil, fmt.Errorf("%w: only %d of product %s left to ship, requested %d",
+					ErrInvalidShipment, remaining, item.ProductID, quantity)
+			}
+		}
+		if quantity > 0 {
+			lines = append(lines, ShipmentItem{ProductID: item.ProductID, Quantity: quantity})
+		}
+	}
+
+	if len(lines) == 0 {
+		return nil, ErrNothingToShip
+	}
+	return lines, nil
+}
+
+// FulfilmentStatus derives an order's status from its shipments. Orders that
+// are not yet paid, or are cancelled or delivered, keep their status, as do
+// paid orders with no shipments.
+func FulfilmentStatus(order OrderModel, shipments []ShipmentModel) string {
+	switch order.Status {
+	case StatusPaid, StatusPartiallyShipped, StatusShipped:
+	default:
+		return order.Status
+	}
+	if len(shipments) == 0 {
+		return order.Status
+	}
+
+	shipped := shippedQuantities(shipments)
+	for productID, quantity := range orderedQuantities(order.Items) {
+		if shipped[productID] < quantity {
+			return StatusPartiallyShipped
+		}
+	}
+
+	for _, shipment := range shipments {
+		if shipment.Status != ShipmentDelivered {
+			return StatusShipped
+		}
+	}
+	return StatusDelivered
+}
+
+// loadShipments returns an order's shipments, oldest first.
+func loadShipments(tx *gorm.DB, orderID string) ([]ShipmentModel, error) {
+	var shipments []ShipmentModel
+	if err := tx.Where("order_id = ?", orderID).Order("created_at ASC").Find(&shipments).Error; err != nil {
+		return nil, fmt.Errorf("failed to load shipments: %w", err)
+	}
+	return shipments, nil
+}
+
+// lockOrder loads an order with a row lock for the rest of the transaction.
+func lockOrder(tx *gorm.DB, orderID string) (*OrderModel, error) {
+	var order OrderModel
+	err := tx.Clauses(clause.Locking{Strength: "UPDATE"}).First(&order, "order_id = ?", orderID).Error
+	if err != nil {
+		return nil, err
+	}
+	return &order, nil
+}
+
+// SyncFulfilmentStatus moves the order to the status its shipments call for,
+// through the state machine. It must be called inside a transaction holding
+// the order's row lock.
+func SyncFulfilmentStatus(tx *gorm.DB, order *OrderModel, actorID, role, reason string) error {
+	shipments, err := loadShipments(tx, order.OrderID)
+	if err != nil {
+		return err
+	}
+
+	to := FulfilmentStatus(*order, shipments)
+	if to == order.Status {
+		return nil
+	}
+	return TransitionOrder(tx, order, to, actorID, role, reason)
+}
+
+// CreateShipment ships part or all of what is left of a paid order and
+// updates the order's status. It must be called inside a transaction holding
+// the order's row lock, so concurrent shipments cannot ship a unit twice.
+func CreateShipment(tx *gorm.DB, order *OrderModel, input CreateShipmentInput, actorID string) (*ShipmentModel, error) {
+	if order.Status != StatusPaid && order.Status != StatusPartiallyShipped {
+		return nil, fmt.Errorf("%w: cannot ship a %s order", ErrInvalidTransition, order.Status)
+	}
+
+	existing, err := loadShipments(tx, order.OrderID)
+	if err != nil {
+		return nil, err
+	}
+
+	items, err := PlanShipment(*order, existing, input.Items)
+	if err != nil {
+		return nil, err
+	}
+
+	shipment := ShipmentModel{
+		ShipmentID:     uuid.New().String(),
+		OrderID:        order.OrderID,
+		SellerID:       order.SellerID,
+		Carrier:        NormalizeCarrier(input.Carrier),
+		TrackingNumber: strings.TrimSpace(input.TrackingNumber),
+		Items:          items,
+		Status:         ShipmentCreated,
+	}
+	if shipment.Carrier == "" {
+		shipment.Carrier = CarrierManual
+	}
+
+	// The unique index backs this up if two sellers race for one number
+	if shipment.TrackingNumber != "" {
+		var taken int64
+		if err := tx.Model(&ShipmentModel{}).
+			Where("carrier = ? AND tracking_number = ?", shipment.Carrier, shipment.TrackingNumber).
+			Count(&taken).Error; err != nil {
+			return nil, fmt.Errorf("failed to check tracking number: %w", err)
+		}
+		if taken > 0 {
+			return nil, ErrDuplicateTracking
+		}
+	}
+
+	if err := tx.Create(&shipment).Error; err != nil {
+		return nil, fmt.Errorf("failed to create shipment: %w", err)
+	}
+
+	reason := fmt.Sprintf("shipment %s created", shipment.ShipmentID)
+	if shipment.TrackingNumber != "" {
+		reason = fmt.Sprintf("shipped with %s, tracking %s", shipment.Carrier, shipment.TrackingNumber)
+	}
+	if err := SyncFulfilmentStatus(tx, order, actorID, RoleSeller, reason); err != nil {
+		return nil, err
+	}
+
+	return &shipment, nil
+}
+
+// MarkOrderDelivered marks every shipment of a fully shipped order delivered.
+// Orders shipped before shipments were recorded have none and are moved to
+// delivered directly. It must be called inside a transaction holding the
+// order's row lock.
+func MarkOrderDelivered(tx *gorm.DB, order *OrderModel, actorID, role, reason string) error {
+	shipments, err := loadShipments(tx, order.OrderID)
+	if err != nil {
+		return err
+	}
+	if len(shipments) == 0 {
+		return TransitionOrder(tx, order, StatusDelivered, actorID, role, reason)
+	}
+	if order.Status != StatusShipped {
+		return fmt.Errorf("%w: %s -> %s", ErrInvalidTransition, order.Status, StatusDelivered)
+	}
+
+	now := time.Now().UTC()
+	if err := tx.Model(&ShipmentModel{}).
+		Where("order_id = ? AND status <> ?", order.OrderID, ShipmentDelivered).
+		Updates(map[string]interface{}{"status": ShipmentDelivered, "delivered_at": now}).Error; err != nil {
+		return fmt.Errorf("failed to update shipments: %w", err)
+	}
+
+	return SyncFulfilmentStatus(tx, order, actorID, role, reason)
+}
+
+// shipmentErrorStatus maps a shipment error to an HTTP status code.
+func shipmentErrorStatus(err error) int {
+	switch {
+	case errors.Is(err, ErrInvalidShipment):
+		return http.StatusBadRequest
+	case errors.Is(err, ErrNothingToShip), errors.Is(err, ErrDuplicateTracking):
+		return http.StatusConflict
+	default:
+		return transitionErrorStatus(err)
+	}
+}
+
+// HandleCreateShipment godoc
+// @Summary Create a shipment
+// @Description Ships some or all of the units left on a paid order with a carrier and tracking number; the order becomes partially_shipped or shipped
+// @Tags shipments
+// @Accept json
+// @Produce json
+// @Param orderId path string true "Order ID"
+// @Param request body CreateShipmentInput true "Carrier, tracking number and lines"
+// @Success 201 {object} CreateShipmentResponse
+// @Failure 400 {object} ErrorResponse
+// @Failure 401 {object} ErrorResponse
+// @Failure 403 {object} ErrorResponse
+// @Failure 404 {object} ErrorResponse
+// @Failure 409 {object} ErrorResponse
+// @Router /orders/{orderId}/shipments [post]
+func HandleCreateShipment(c *gin.Context) {
+	orderID := c.Param("orderId")
+
+	var input CreateShipmentInput
+	if err := c.ShouldBindJSON(&input); err != nil {
+		c.JSON(http.StatusBadRequest, ErrorResponse{Error: "Invalid request. Carrier and tracking number are required."})
+		return
+	}
+	if !carrierCodePattern.MatchString(NormalizeCarrier(input.Carrier)) {
+		c.JSON(http.StatusBadRequest, ErrorResponse{Error: "Invalid carrier. Use 2-32 letters, digits, '-' or '_'."})
+		return
+	}
+	if len(strings.TrimSpace(input.TrackingNumber)) > 64 {
+		c.JSON(http.StatusBadRequest, ErrorResponse{Error: "Invalid tracking number. Use at most 64 characters."})
+		return
+	}
+
+	customRole, _ := c.Get("customRole")
+	if customRole != "seller" {
+		c.JSON(http.StatusForbidden, ErrorResponse{Error: "Only sellers can ship orders"})
+		return
+	}
+
+	userID, exists := c.Get("userId")
+	if !exists {
+		c.JSON(http.StatusUnauthorized, ErrorResponse{Error: "User ID not found in token"})
+		return
+	}
+
+	var response CreateShipmentResponse
+	err := db.Transaction(func(tx *gorm.DB) error {
+		order, err := lockOrder(tx, orderID)
+		if err != nil {
+			return err
+		}
+		if order.SellerID != userID.(string) {
+			return errForbiddenOrder
+		}
+
+		shipment, err := CreateShipment(tx, order, input, userID.(string))
+		if err != nil {
+			return err
+		}
+		response = CreateShipmentResponse{Shipment: *shipment, OrderStatus: order.Status}
+		return nil
+	})
+	switch {
+	case errors.Is(err, gorm.ErrRecordNotFound):
+		c.JSON(http.StatusNotFound, ErrorResponse{Error: "Order not found"})
+		return
+	case errors.Is(err, errForbiddenOrder):
+		c.JSON(http.StatusForbidden, ErrorResponse{Error: "You can only ship your own orders"})
+		return
+	case err != nil:
+		c.JSON(shipmentErrorStatus(err), ErrorResponse{Error: "Cannot create shipment: " + err.Error()})
+		return
+	}
+
+	c.JSON(http.StatusCreated, response)
+}
+
+// errForbiddenOrder aborts a transaction when the caller does not own the
+// order.
+var errForbiddenOrder = errors.New("order belongs to another user")
+
+// HandleGetShipments godoc
+// @Summary List an order's shipments
+// @Description Returns the shipments of an order with their tracking status (buyer or seller of the order only)
+// @Tags shipments
+// @Produce json
+// @Param orderId path string true "Order ID"
+// @Success 200 {object} []ShipmentModel
+// @Failure 401 {object} ErrorResponse
+// @Failure 403 {object} ErrorResponse
+// @Failure 404 {object} ErrorResponse
+// @Failure 500 {object} ErrorResponse
+// @Router /orders/{orderId}/shipments [get]
+func HandleGetShipments(c *gin.Context) {
+	orderID := c.Param("orderId")
+
+	userID, exists := c.Get("userId")
+	if !exists {
+		c.JSON(http.StatusUnauthorized, ErrorResponse{Error: "User ID not found in token"})
+		return
+	}
+
+	var order OrderModel
+	if err := db.First(&order, "order_id = ?", orderID).Error; err != nil {
+		c.JSON(http.StatusNotFound, ErrorResponse{Error: "Order not found"})
+		return
+	}
+
+	if order.BuyerID != userID.(string) && order.SellerID != userID.(string) {
+		c.JSON(http.StatusForbidden, ErrorResponse{Error: "You can only view shipments of your own orders"})
+		return
+	}
+
+	shipments, err := loadShipments(db, orderID)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, ErrorResponse{Error: "Failed to fetch shipments"})
+		return
+	}
+
+	c.JSON(http.StatusOK, shipments)
+}
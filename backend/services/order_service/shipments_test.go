@@ -0,0 +1,128 @@
+package main
+
+import (
+	"bytes"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/gin-gonic/gin"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func shipmentOrder() OrderModel {
+	return OrderModel{
+		OrderID: "order-1",
+		Status:  StatusPaid,
+		Items: OrderItemsJSON{
+			{ProductID: "p1", Quantity: 3},
+			{ProductID: "p2", Quantity: 1},
+		},
+	}
+}
+
+func TestPlanShipment(t *testing.T) {
+	order := shipmentOrder()
+
+	lines, err := PlanShipment(order, nil, nil)
+	require.NoError(t, err)
+	assert.Equal(t, []ShipmentItem{{ProductID: "p1", Quantity: 3}, {ProductID: "p2", Quantity: 1}}, lines, "no lines ships everything")
+
+	lines, err = PlanShipment(order, nil, []ShipmentItem{{ProductID: "p1", Quantity: 1}, {ProductID: "p1", Quantity: 1}})
+	require.NoError(t, err)
+	assert.Equal(t, []ShipmentItem{{ProductID: "p1", Quantity: 2}}, lines, "lines for one product are merged")
+
+	first := []ShipmentModel{{Items: ShipmentItemsJSON{{ProductID: "p1", Quantity: 2}}}}
+	lines, err = PlanShipment(order, first, nil)
+	require.NoError(t, err)
+	assert.Equal(t, []ShipmentItem{{ProductID: "p1", Quantity: 1}, {ProductID: "p2", Quantity: 1}}, lines, "only what is left is shipped")
+
+	_, err = PlanShipment(order, first, []ShipmentItem{{ProductID: "p1", Quantity: 2}})
+	assert.ErrorIs(t, err, ErrInvalidShipment)
+
+	_, err = PlanShipment(order, nil, []ShipmentItem{{ProductID: "p9", Quantity: 1}})
+	assert.ErrorIs(t, err, ErrInvalidShipment)
+
+	_, err = PlanShipment(order, nil, []ShipmentItem{{ProductID: "p1", Quantity: 0}})
+	assert.ErrorIs(t, err, ErrInvalidShipment)
+
+	all := []ShipmentModel{{Items: ShipmentItemsJSON{{ProductID: "p1", Quantity: 3}, {ProductID: "p2", Quantity: 1}}}}
+	_, err = PlanShipment(order, all, nil)
+	assert.ErrorIs(t, err, ErrNothingToShip)
+}
+
+func TestFulfilmentStatus(t *testing.T) {
+	partial := ShipmentModel{Status: ShipmentInTransit, Items: ShipmentItemsJSON{{ProductID: "p1", Quantity: 3}}}
+	rest := ShipmentModel{Status: ShipmentCreated, Items: ShipmentItemsJSON{{ProductID: "p2", Quantity: 1}}}
+	restDelivered := ShipmentModel{Status: ShipmentDelivered, Items: rest.Items}
+	partialDelivered := ShipmentModel{Status: ShipmentDelivered, Items: partial.Items}
+
+	tests := []struct {
+		name      string
+		status    string
+		shipments []ShipmentModel
+		expected  string
+	}{
+		{"paid_without_shipments", StatusPaid, nil, StatusPaid},
+		{"some_units_shipped", StatusPaid, []ShipmentModel{partial}, StatusPartiallyShipped},
+		{"some_units_delivered", StatusPartiallyShipped, []ShipmentModel{partialDelivered}, StatusPartiallyShipped},
+		{"every_unit_shipped", StatusPartiallyShipped, []ShipmentModel{partial, rest}, StatusShipped},
+		{"one_shipment_delivered", StatusShipped, []ShipmentModel{partialDelivered, rest}, StatusShipped},
+		{"every_shipment_delivered", StatusShipped, []ShipmentModel{partialDelivered, restDelivered}, StatusDelivered},
+		{"pending_is_unchanged", StatusPending, []ShipmentModel{partial}, StatusPending},
+		{"cancelled_is_unchanged", StatusCancelled, nil, StatusCancelled},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			order := shipmentOrder()
+			order.Status = tt.status
+			assert.Equal(t, tt.expected, FulfilmentStatus(order, tt.shipments))
+		})
+	}
+}
+
+func TestShipmentErrorStatus(t *testing.T) {
+	assert.Equal(t, http.StatusBadRequest, shipmentErrorStatus(ErrInvalidShipment))
+	assert.Equal(t, http.StatusConflict, shipmentErrorStatus(ErrNothingToShip))
+	assert.Equal(t, http.StatusConflict, shipmentErrorStatus(ErrDuplicateTracking))
+	assert.Equal(t, http.StatusConflict, shipmentErrorStatus(ErrInvalidTransition))
+}
+
+func TestShipmentEndpointsValidation(t *testing.T) {
+	tests := []struct {
+		name           string
+		role           string
+		requestBody    string
+		expectedStatus int
+	}{
+		{name: "missing_tracking_number", role: "seller", requestBody: `{"carrier": "dhl"}`, expectedStatus: http.StatusBadRequest},
+		{name: "invalid_carrier", role: "seller", requestBody: `{"carrier": "D H L", "trackingNumber": "1Z999"}`, expectedStatus: http.StatusBadRequest},
+		{name: "buyer_cannot_ship", role: "buyer", requestBody: `{"carrier": "dhl", "trackingNumber": "1Z999"}`, expectedStatus: http.StatusForbidden},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			r := setupTestRouter()
+			r.Use(func(c *gin.Context) {
+				c.Set("customRole", tt.role)
+				c.Set("userId", "user-1")
+				c.Next()
+			})
+			r.POST("/orders/:orderId/shipments", HandleCreateShipment)
+
+			req, _ := http.NewRequest("POST", "/orders/order-1/shipments", bytes.NewBufferString(tt.requestBody))
+			req.Header.Set("Content-Type", "application/json")
+			w := httptest.NewRecorder()
+			r.ServeHTTP(w, req)
+
+			assert.Equal(t, tt.expectedStatus, w.Code)
+		})
+	}
+}
+
+func TestShipmentTableName(t *testing.T) {
+	assert.Equal(t, "shipments", ShipmentModel{}.TableName())
+	assert.Equal(t, "dhl", NormalizeCarrier(" DHL "))
+}
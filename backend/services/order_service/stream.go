@@ -0,0 +1,438 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"log"
+	"net/http"
+	"sync"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/jackc/pgx/v5"
+	"gorm.io/gorm"
+)
+
+// =============================================================================
+// Order Status Stream
+// =============================================================================
+
+// Every row written to order_status_history fires a Postgres NOTIFY from a
+// trigger (migrations/0002_order_status_notify.up.sql) once its transaction
+// commits. Each replica LISTENs on the channel and hands notifications to an
+// in-process OrderEventBroker, which fans them out to the Server-Sent Events
+// streams open on that replica. A status change made on any replica therefore
+// reaches every connected client.
+
+// orderStatusChannel is the Postgres NOTIFY channel status changes go to.
+const orderStatusChannel = "order_status_changed"
+
+// orderStatusEventName is the SSE event name of a status change.
+const orderStatusEventName = "order-status"
+
+const (
+	orderStreamBuffer       = 32
+	orderStreamKeepAlive    = 25 * time.Second
+	orderStreamRetry        = 3 * time.Second
+	maxOrderStreamReplay    = 100
+	listenerBaseBackoff     = 1 * time.Second
+	listenerMaxBackoff      = 30 * time.Second
+	listenerHealthyDuration = time.Minute
+)
+
+// OrderStatusEvent is a status change as sent to stream clients.
+type OrderStatusEvent struct {
+	HistoryID  string    `json:"historyId"`
+	OrderID    string    `json:"orderId"`
+	CheckoutID string    `json:"checkoutId"`
+	BuyerID    string    `json:"buyerId"`
+	SellerID   string    `json:"sellerId"`
+	FromStatus string    `json:"fromStatus"`
+	ToStatus   string    `json:"toStatus"`
+	ActorRole  string    `json:"actorRole"`
+	Reason     string    `json:"reason,omitempty"`
+	CreatedAt  time.Time `json:"createdAt"`
+}
+
+// OrderStreamFilter selects the events a stream receives: those of one buyer
+// or one seller, optionally narrowed to a single order or checkout.
+type OrderStreamFilter struct {
+	BuyerID  string
+	SellerID string
+	OrderID  string
+}
+
+// Matches reports whether an event passes the filter.
+func (f OrderStreamFilter) Matches(event OrderStatusEvent) bool {
+	if f.BuyerID != "" && event.BuyerID != f.BuyerID {
+		return false
+	}
+	if f.SellerID != "" && event.SellerID != f.SellerID {
+		return false
+	}
+	if f.OrderID != "" && event.OrderID != f.OrderID && event.CheckoutID != f.OrderID {
+		return false
+	}
+	return true
+}
+
+// orderSubscription is one open stream registered with the broker.
+type orderSubscription struct {
+	filter OrderStreamFilter
+	events chan OrderStatusEvent
+}
+
+// OrderEventBroker fans status changes out to the streams open on this
+// replica. A stream that falls more than its buffer behind is closed rather
+// than allowed to hold up the others; the client reconnects with Last-Event-ID
+// and is replayed what it missed.
+type OrderEventBroker struct {
+	mu     sync.Mutex
+	subs   map[*orderSubscription]struct{}
+	buffer int
+}
+
+// NewOrderEventBroker creates a broker with no subscribers.
+func NewOrderEventBroker() *OrderEventBroker {
+	return &OrderEventBroker{
+		subs:   make(map[*orderSubscription]struct{}),
+		buffer: orderStreamBuffer,
+	}
+}
+
+// Subscribe registers a stream for events matching the filter. The returned
+// channel is closed when the stream is unsubscribed or falls behind; the
+// returned function unsubscribes it and may be called more than once.
+func (b *OrderEventBroker) Subscribe(filter OrderStreamFilter) (<-chan OrderStatusEvent, func()) {
+	sub := &orderSubscription{filter: filter, events: make(chan OrderStatusEvent, b.buffer)}
+
+	b.mu.Lock()
+	b.subs[sub] = struct{}{}
+	b.mu.Unlock()
+
+	return sub.events, func() {
+		b.mu.Lock()
+		defer b.mu.Unlock()
+		b.remove(sub)
+	}
+}
+
+// Publish sends an event to every matching subscriber without blocking.
+func (b *OrderEventBroker) Publish(event OrderStatusEvent) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	for sub := range b.subs {
+		if !sub.filter.Matches(event) {
+			continue
+		}
+		select {
+		case sub.events <- event:
+		default:
+			log.Printf("⚠️ Order stream fell behind, closing it")
+			b.remove(sub)
+		}
+	}
+}
+
+// Subscribers returns the number of open streams.
+func (b *OrderEventBroker) Subscribers() int {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	return len(b.subs)
+}
+
+// CloseAll closes every open stream so its client reconnects.
+func (b *OrderEventBroker) CloseAll() {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	for sub := range b.subs {
+		b.remove(sub)
+	}
+}
+
+// remove drops a subscriber and closes its channel. The caller must hold mu.
+func (b *OrderEventBroker) remove(sub *orderSubscription) {
+	if _, ok := b.subs[sub]; ok {
+		delete(b.subs, sub)
+		close(sub.events)
+	}
+}
+
+// ParseOrderStatusNotification decodes the payload of a status notification.
+func ParseOrderStatusNotification(payload string) (OrderStatusEvent, error) {
+	var event OrderStatusEvent
+	if err := json.Unmarshal([]byte(payload), &event); err != nil {
+		return OrderStatusEvent{}, fmt.Errorf("invalid order status notification: %w", err)
+	}
+	if event.HistoryID == "" || event.OrderID == "" {
+		return OrderStatusEvent{}, fmt.Errorf("invalid order status notification: missing ids")
+	}
+	return event, nil
+}
+
+// OrderStatusListener LISTENs for status notifications on a dedicated
+// connection and publishes them to a broker, reconnecting with backoff when
+// the connection drops. Notifications sent while it is down are lost, so open
+// streams are closed when it drops and their clients reconnect with
+// Last-Event-ID to be replayed what they missed.
+type OrderStatusListener struct {
+	DSN         string
+	Broker      *OrderEventBroker
+	BaseBackoff time.Duration
+	MaxBackoff  time.Duration
+}
+
+// NewOrderStatusListener creates a listener for the database at dsn.
+func NewOrderStatusListener(dsn string, broker *OrderEventBroker) *OrderStatusListener {
+	return &OrderStatusListener{
+		DSN:         dsn,
+		Broker:      broker,
+		BaseBackoff: listenerBaseBackoff,
+		MaxBackoff:  listenerMaxBackoff,
+	}
+}
+
+// Run listens until the context is cancelled.
+func (l *OrderStatusListener) Run(ctx context.Context) {
+	log.Println("📡 Order status listener started")
+
+	failures := 0
+	for {
+		started := time.Now()
+		err := l.listen(ctx)
+		if ctx.Err() != nil {
+			log.Println("Order status listener stopped")
+			return
+		}
+		l.Broker.CloseAll()
+
+		// A connection that stayed up for a while starts the backoff over
+		if time.Since(started) > listenerHealthyDuration {
+			failures = 0
+		}
+		failures++
+		delay := exponentialBackoff(l.BaseBackoff, l.MaxBackoff, failures)
+		log.Printf("Order status listener error: %v (reconnecting in %s)", err, delay)
+
+		select {
+		case <-ctx.Done():
+			log.Println("Order status listener stopped")
+			return
+		case <-time.After(delay):
+		}
+	}
+}
+
+// listen holds one connection open and publishes its notifications until it
+// fails.
+func (l *OrderStatusListener) listen(ctx context.Context) error {
+	conn, err := pgx.Connect(ctx, l.DSN)
+	if err != nil {
+		return fmt.Errorf("failed to connect: %w", err)
+	}
+	defer conn.Close(context.Background())
+
+	if _, err := conn.Exec(ctx, "LISTEN "+orderStatusChannel); err != nil {
+		return fmt.Errorf("failed to listen: %w", err)
+	}
+
+	for {
+		notification, err := conn.WaitForNotification(ctx)
+		if err != nil {
+			return err
+		}
+
+		event, err := ParseOrderStatusNotification(notification.Payload)
+		if err != nil {
+			log.Printf("Skipping order status notification: %v", err)
+			continue
+		}
+		l.Broker.Publish(event)
+	}
+}
+
+// =============================================================================
+// Order Stream Handlers
+// =============================================================================
+
+// HandleStreamBuyerOrders godoc
+// @Summary Stream the buyer's order status changes
+// @Description Server-Sent Events stream of status changes to the caller's orders. Each event is named "order-status" with an OrderStatusEvent as data and the history ID as its id; reconnecting with Last-Event-ID replays what was missed.
+// @Tags orders
+// @Produce text/event-stream
+// @Param orderId query string false "Only this order or checkout"
+// @Param access_token query string false "JWT, for clients that cannot send an Authorization header"
+// @Success 200 {object} OrderStatusEvent
+// @Failure 401 {object} ErrorResponse
+// @Router /orders/stream [get]
+func HandleStreamBuyerOrders(c *gin.Context) {
+	userID, exists := c.Get("userId")
+	if !exists {
+		c.JSON(http.StatusUnauthorized, ErrorResponse{Error: "User ID not found in token"})
+		return
+	}
+
+	streamOrderEvents(c, OrderStreamFilter{BuyerID: userID.(string), OrderID: c.Query("orderId")})
+}
+
+// HandleStreamSellerOrders godoc
+// @Summary Stream the seller's order status changes
+// @Description Server-Sent Events stream of status changes to orders of the caller's products, in the same format as /orders/stream
+// @Tags orders
+// @Produce text/event-stream
+// @Param orderId query string false "Only this order"
+// @Param access_token query string false "JWT, for clients that cannot send an Authorization header"
+// @Success 200 {object} OrderStatusEvent
+// @Failure 401 {object} ErrorResponse
+// @Failure 403 {object} ErrorResponse
+// @Router /seller/orders/stream [get]
+func HandleStreamSellerOrders(c *gin.Context) {
+	userID, exists := c.Get("userId")
+	if !exists {
+		c.JSON(http.StatusUnauthorized, ErrorResponse{Error: "User ID not found in token"})
+		return
+	}
+
+	customRole, _ := c.Get("customRole")
+	if customRole != "seller" {
+		c.JSON(http.StatusForbidden, ErrorResponse{Error: "Only sellers can stream seller orders"})
+		return
+	}
+
+	streamOrderEvents(c, OrderStreamFilter{SellerID: userID.(string), OrderID: c.Query("orderId")})
+}
+
+// streamOrderEvents writes matching status changes to the response as
+// Server-Sent Events until the client goes away, with a comment line every
+// orderStreamKeepAlive so proxies keep the connection open.
+func streamOrderEvents(c *gin.Context, filter OrderStreamFilter) {
+	// Subscribe before replaying so nothing falls between the two
+	events, unsubscribe := orderEvents.Subscribe(filter)
+	defer unsubscribe()
+
+	var missed []OrderStatusEvent
+	if lastID := c.GetHeader("Last-Event-ID"); lastID != "" {
+		var err error
+		missed, err = loadMissedOrderEvents(db, filter, lastID)
+		if err != nil {
+			log.Printf("Failed to replay order events after %s: %v", lastID, err)
+		}
+	}
+
+	c.Header("Content-Type", "text/event-stream")
+	c.Header("Cache-Control", "no-cache")
+	c.Header("Connection", "keep-alive")
+	c.Header("X-Accel-Buffering", "no")
+	c.Status(http.StatusOK)
+
+	fmt.Fprintf(c.Writer, "retry: %d\n\n", orderStreamRetry.Milliseconds())
+	sent := make(map[string]bool, len(missed))
+	for _, event := range missed {
+		if err := writeOrderEvent(c.Writer, event); err != nil {
+			return
+		}
+		sent[event.HistoryID] = true
+	}
+	c.Writer.Flush()
+
+	keepAlive := time.NewTicker(orderStreamKeepAlive)
+	defer keepAlive.Stop()
+
+	ctx := c.Request.Context()
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case event, ok := <-events:
+			if !ok {
+				return
+			}
+			if sent[event.HistoryID] {
+				continue
+			}
+			if err := writeOrderEvent(c.Writer, event); err != nil {
+				return
+			}
+			c.Writer.Flush()
+		case <-keepAlive.C:
+			if _, err := io.WriteString(c.Writer, ": keep-alive\n\n"); err != nil {
+				return
+			}
+			c.Writer.Flush()
+		}
+	}
+}
+
+// writeOrderEvent writes one status change in SSE format.
+func writeOrderEvent(w io.Writer, event OrderStatusEvent) error {
+	data, err := json.Marshal(event)
+	if err != nil {
+		return err
+	}
+	_, err = fmt.Fprintf(w, "id: %s\nevent: %s\ndata: %s\n\n", event.HistoryID, orderStatusEventName, data)
+	return err
+}
+
+// loadMissedOrderEvents returns the status changes matching the filter that
+// were recorded after the history entry lastID, oldest first and at most
+// maxOrderStreamReplay of them. An unknown lastID replays nothing.
+func loadMissedOrderEvents(database *gorm.DB, filter OrderStreamFilter, lastID string) ([]OrderStatusEvent, error) {
+	var last OrderStatusHistory
+	if err := database.First(&last, "history_id = ?", lastID).Error; err != nil {
+		return nil, nil
+	}
+
+	query := database.Table("order_status_history AS h").
+		Select("h.history_id, h.order_id, COALESCE(o.checkout_id::text, '') AS checkout_id, o.buyer_id, o.seller_id, "+
+			"COALESCE(h.from_status, '') AS from_status, h.to_status, h.actor_role, COALESCE(h.reason, '') AS reason, h.created_at").
+		Joins("JOIN orders o ON o.order_id = h.order_id").
+		Where("h.created_at > ?", last.CreatedAt)
+	if filter.BuyerID != "" {
+		query = query.Where("o.buyer_id = ?", filter.BuyerID)
+	}
+	if filter.SellerID != "" {
+		query = query.Where("o.seller_id = ?", filter.SellerID)
+	}
+	if filter.OrderID != "" {
+		query = query.Where("o.order_id::text = ? OR o.checkout_id::text = ?", filter.OrderID, filter.OrderID)
+	}
+
+	var events []OrderStatusEvent
+	if err := query.Order("h.created_at ASC").Limit(maxOrderStreamReplay).Scan(&events).Error; err != nil {
+		return nil, fmt.Errorf("failed to load missed order events: %w", err)
+	}
+	return events, nil
+}
+
+// streamTokenFromQuery lets clients that cannot set headers, such as the
+// browser EventSource, pass their JWT as ?access_token= on the given stream
+// paths. An Authorization header takes precedence. The parameter is removed
+// from every request's URL, so it must run before the access logger to keep
+// tokens out of the logs.
+func streamTokenFromQuery(paths ...string) gin.HandlerFunc {
+	streamPaths := make(map[string]bool, len(paths))
+	for _, path := range paths {
+		streamPaths[path] = true
+	}
+
+	return func(c *gin.Context) {
+		query := c.Request.URL.Query()
+		if !query.Has("access_token") {
+			c.Next()
+			return
+		}
+
+		token := query.Get("access_token")
+		query.Del("access_token")
+		c.Request.URL.RawQuery = query.Encode()
+
+		if token != "" && streamPaths[c.Request.URL.Path] && c.GetHeader("Authorization") == "" {
+			c.Request.Header.Set("Authorization", "Bearer "+token)
+		}
+		c.Next()
+	}
+}
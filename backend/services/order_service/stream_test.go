@@ -0,0 +1,188 @@
+package main
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func statusEvent(historyID, buyerID, sellerID string) OrderStatusEvent {
+	return OrderStatusEvent{
+		HistoryID:  historyID,
+		OrderID:    "order-1",
+		CheckoutID: "checkout-1",
+		BuyerID:    buyerID,
+		SellerID:   sellerID,
+		FromStatus: StatusPaid,
+		ToStatus:   StatusShipped,
+		ActorRole:  RoleSeller,
+	}
+}
+
+func TestOrderStreamFilterMatches(t *testing.T) {
+	event := statusEvent("h-1", "buyer-1", "seller-1")
+
+	assert.True(t, OrderStreamFilter{BuyerID: "buyer-1"}.Matches(event))
+	assert.False(t, OrderStreamFilter{BuyerID: "buyer-2"}.Matches(event))
+	assert.True(t, OrderStreamFilter{SellerID: "seller-1"}.Matches(event))
+	assert.False(t, OrderStreamFilter{SellerID: "seller-2"}.Matches(event))
+	assert.True(t, OrderStreamFilter{BuyerID: "buyer-1", OrderID: "order-1"}.Matches(event))
+	assert.True(t, OrderStreamFilter{BuyerID: "buyer-1", OrderID: "checkout-1"}.Matches(event), "a checkout ID matches its orders")
+	assert.False(t, OrderStreamFilter{BuyerID: "buyer-1", OrderID: "order-2"}.Matches(event))
+}
+
+func TestOrderEventBroker(t *testing.T) {
+	broker := NewOrderEventBroker()
+
+	buyer, unsubscribeBuyer := broker.Subscribe(OrderStreamFilter{BuyerID: "buyer-1"})
+	seller, unsubscribeSeller := broker.Subscribe(OrderStreamFilter{SellerID: "seller-2"})
+	assert.Equal(t, 2, broker.Subscribers())
+
+	broker.Publish(statusEvent("h-1", "buyer-1", "seller-1"))
+	assert.Equal(t, "h-1", (<-buyer).HistoryID)
+	assert.Len(t, seller, 0, "events for other sellers are not delivered")
+
+	unsubscribeBuyer()
+	unsubscribeBuyer()
+	_, open := <-buyer
+	assert.False(t, open, "unsubscribing closes the channel")
+	assert.Equal(t, 1, broker.Subscribers())
+
+	broker.CloseAll()
+	_, open = <-seller
+	assert.False(t, open)
+	assert.Zero(t, broker.Subscribers())
+	unsubscribeSeller()
+}
+
+func TestOrderEventBrokerClosesSlowSubscribers(t *testing.T) {
+	broker := NewOrderEventBroker()
+	slow, _ := broker.Subscribe(OrderStreamFilter{BuyerID: "buyer-1"})
+
+	for i := 0; i <= orderStreamBuffer; i++ {
+		broker.Publish(statusEvent("h", "buyer-1", "seller-1"))
+	}
+	assert.Zero(t, broker.Subscribers(), "a subscriber that falls behind is dropped")
+
+	received := 0
+	for range slow {
+		received++
+	}
+	assert.Equal(t, orderStreamBuffer, received, "buffered events are still delivered before the close")
+}
+
+func TestParseOrderStatusNotification(t *testing.T) {
+	payload := `{"historyId":"h-1","orderId":"order-1","checkoutId":null,"buyerId":"buyer-1","sellerId":"seller-1",` +
+		`"fromStatus":"paid","toStatus":"shipped","actorRole":"seller","reason":"Shipped with DHL","createdAt":"2026-03-10T09:00:00.123456+00:00"}`
+
+	event, err := ParseOrderStatusNotification(payload)
+	require.NoError(t, err)
+	assert.Equal(t, "order-1", event.OrderID)
+	assert.Empty(t, event.CheckoutID)
+	assert.Equal(t, StatusShipped, event.ToStatus)
+	assert.Equal(t, 2026, event.CreatedAt.Year())
+
+	_, err = ParseOrderStatusNotification(`{"orderId":"order-1"}`)
+	assert.Error(t, err)
+	_, err = ParseOrderStatusNotification(`not json`)
+	assert.Error(t, err)
+}
+
+func TestStreamBuyerOrders(t *testing.T) {
+	r := setupTestRouter()
+	r.Use(func(c *gin.Context) {
+		c.Set("customRole", "buyer")
+		c.Set("userId", "buyer-1")
+		c.Next()
+	})
+	r.GET("/orders/stream", HandleStreamBuyerOrders)
+	server := httptest.NewServer(r)
+	defer server.Close()
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	req, _ := http.NewRequestWithContext(ctx, http.MethodGet, server.URL+"/orders/stream?orderId=order-1", nil)
+	resp, err := http.DefaultClient.Do(req)
+	require.NoError(t, err)
+	defer resp.Body.Close()
+	assert.Equal(t, http.StatusOK, resp.StatusCode)
+	assert.Equal(t, "text/event-stream", resp.Header.Get("Content-Type"))
+
+	require.Eventually(t, func() bool { return orderEvents.Subscribers() > 0 }, time.Second, 10*time.Millisecond)
+	orderEvents.Publish(statusEvent("h-other", "buyer-2", "seller-1"))
+	orderEvents.Publish(statusEvent("h-1", "buyer-1", "seller-1"))
+
+	reader := bufio.NewReader(resp.Body)
+	var lines []string
+	for len(lines) < 3 {
+		line, err := reader.ReadString('\n')
+		require.NoError(t, err)
+		line = strings.TrimSpace(line)
+		if strings.HasPrefix(line, "id:") || strings.HasPrefix(line, "event:") || strings.HasPrefix(line, "data:") {
+			lines = append(lines, line)
+		}
+	}
+
+	assert.Equal(t, "id: h-1", lines[0], "other buyers' events are not streamed")
+	assert.Equal(t, "event: "+orderStatusEventName, lines[1])
+	assert.Contains(t, lines[2], `"toStatus":"shipped"`)
+
+	cancel()
+	assert.Eventually(t, func() bool { return orderEvents.Subscribers() == 0 }, time.Second, 10*time.Millisecond,
+		"the subscription ends with the request")
+}
+
+func TestStreamSellerOrdersRequiresSeller(t *testing.T) {
+	r := setupTestRouter()
+	r.Use(func(c *gin.Context) {
+		c.Set("customRole", "buyer")
+		c.Set("userId", "buyer-1")
+		c.Next()
+	})
+	r.GET("/seller/orders/stream", HandleStreamSellerOrders)
+
+	req, _ := http.NewRequest(http.MethodGet, "/seller/orders/stream", nil)
+	w := httptest.NewRecorder()
+	r.ServeHTTP(w, req)
+
+	assert.Equal(t, http.StatusForbidden, w.Code)
+}
+
+func TestStreamTokenFromQuery(t *testing.T) {
+	var logged bytes.Buffer
+	r := setupTestRouter()
+	r.Use(streamTokenFromQuery("/orders/stream"), gin.LoggerWithWriter(&logged))
+	echo := func(c *gin.Context) {
+		c.String(http.StatusOK, c.GetHeader("Authorization")+"|"+c.Request.URL.RawQuery)
+	}
+	r.GET("/orders/stream", echo)
+	r.GET("/getOrders", echo)
+
+	req, _ := http.NewRequest(http.MethodGet, "/orders/stream?orderId=order-1&access_token=abc", nil)
+	w := httptest.NewRecorder()
+	r.ServeHTTP(w, req)
+	assert.Equal(t, "Bearer abc|orderId=order-1", w.Body.String())
+
+	req, _ = http.NewRequest(http.MethodGet, "/orders/stream?access_token=abc", nil)
+	req.Header.Set("Authorization", "Bearer header")
+	w = httptest.NewRecorder()
+	r.ServeHTTP(w, req)
+	assert.Equal(t, "Bearer header|", w.Body.String(), "the header takes precedence")
+
+	req, _ = http.NewRequest(http.MethodGet, "/getOrders?access_token=abc", nil)
+	w = httptest.NewRecorder()
+	r.ServeHTTP(w, req)
+	assert.Equal(t, "|", w.Body.String(), "only stream endpoints accept the parameter")
+
+	assert.Contains(t, logged.String(), "/orders/stream?orderId=order-1")
+	assert.NotContains(t, logged.String(), "abc", "tokens are never logged")
+}
@@ -0,0 +1,247 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log"
+	"sync"
+	"time"
+
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+)
+
+// =============================================================================
+// Carrier Tracking
+// =============================================================================
+
+// CarrierTracker looks up a shipment's status with a carrier. Each carrier code
+// sellers ship with maps to one tracker; shipments with other carriers are not
+// polled.
+type CarrierTracker interface {
+	// Track returns the shipment status (one of the Shipment* statuses) for a
+	// tracking number.
+	Track(ctx context.Context, trackingNumber string) (string, error)
+}
+
+// ErrUnknownTrackingNumber is returned by a tracker that has no record of a
+// tracking number.
+var ErrUnknownTrackingNumber = errors.New("unknown tracking number")
+
+// FakeCarrierCode is the carrier code the fake carrier is registered under.
+const FakeCarrierCode = "fake"
+
+// fakeCarrierProgression is the order in which the fake carrier moves a
+// shipment along, one step per lookup.
+var fakeCarrierProgression = []string{ShipmentCreated, ShipmentInTransit, ShipmentOutForDelivery, ShipmentDelivered}
+
+// FakeCarrier is an in-memory carrier used in development and tests. A
+// tracking number set with SetStatus reports that status; any other tracking
+// number moves one step from created towards delivered each time it is
+// tracked.
+type FakeCarrier struct {
+	mu       sync.Mutex
+	statuses map[string]string
+	pinned   map[string]bool
+}
+
+// NewFakeCarrier creates an empty fake carrier.
+func NewFakeCarrier() *FakeCarrier {
+	return &FakeCarrier{
+		statuses: make(map[string]string),
+		pinned:   make(map[string]bool),
+	}
+}
+
+// SetStatus makes the fake carrier report status for a tracking number until it
+// is set again.
+func (f *FakeCarrier) SetStatus(trackingNumber, status string) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	f.statuses[trackingNumber] = status
+	f.pinned[trackingNumber] = true
+}
+
+// Track implements CarrierTracker.
+func (f *FakeCarrier) Track(ctx context.Context, trackingNumber string) (string, error) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	if trackingNumber == "" {
+		return "", ErrUnknownTrackingNumber
+	}
+	if f.pinned[trackingNumber] {
+		return f.statuses[trackingNumber], nil
+	}
+
+	next := fakeCarrierProgression[0]
+	if current, ok := f.statuses[trackingNumber]; ok {
+		next = current
+		for i, status := range fakeCarrierProgression[:len(fakeCarrierProgression)-1] {
+			if status == current {
+				next = fakeCarrierProgression[i+1]
+			}
+		}
+	}
+	f.statuses[trackingNumber] = next
+	return next, nil
+}
+
+// =============================================================================
+// Shipment Poller
+// =============================================================================
+
+// ShipmentPoller asks carriers for the status of undelivered shipments that
+// were last checked at least Interval ago, and delivers an order once all of
+// its shipments are delivered.
+//
+// Due shipments are claimed with SELECT ... FOR UPDATE SKIP LOCKED and stamped
+// with last_checked_at before the carriers are called, so several replicas can
+// poll at the same time without checking a shipment twice, and no row lock is
+// held while waiting on a carrier. Each status change is then applied in its
+// own transaction under the order's row lock.
+type ShipmentPoller struct {
+	DB        *gorm.DB
+	Carriers  map[string]CarrierTracker
+	Interval  time.Duration
+	BatchSize int
+}
+
+// NewShipmentPoller creates a poller with default batching settings.
+func NewShipmentPoller(database *gorm.DB, carriers map[string]CarrierTracker, interval time.Duration) *ShipmentPoller {
+	return &ShipmentPoller{
+		DB:        database,
+		Carriers:  carriers,
+		Interval:  interval,
+		BatchSize: 100,
+	}
+}
+
+// Run polls due shipments every Interval until the context is cancelled.
+func (p *ShipmentPoller) Run(ctx context.Context) {
+	log.Printf("🚚 Shipment poller started (interval %s, %d carriers)", p.Interval, len(p.Carriers))
+
+	ticker := time.NewTicker(p.Interval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ctx.Done():
+			log.Println("Shipment poller stopped")
+			return
+		case <-ticker.C:
+			p.PollDue(ctx)
+		}
+	}
+}
+
+// PollDue polls batches until no due shipments are left.
+func (p *ShipmentPoller) PollDue(ctx context.Context) {
+	for {
+		polled, err := p.PollBatch(ctx, time.Now().UTC())
+		if err != nil {
+			log.Printf("Shipment poller error: %v", err)
+			return
+		}
+		if polled < p.BatchSize {
+			return
+		}
+	}
+}
+
+// PollBatch claims up to BatchSize due shipments, tracks them with their
+// carriers and applies any status changes. It returns the number of
+// shipments claimed.
+func (p *ShipmentPoller) PollBatch(ctx context.Context, now time.Time) (int, error) {
+	if len(p.Carriers) == 0 {
+		return 0, nil
+	}
+	carriers := make([]string, 0, len(p.Carriers))
+	for code := range p.Carriers {
+		carriers = append(carriers, code)
+	}
+
+	var shipments []ShipmentModel
+	err := p.DB.WithContext(ctx).Transaction(func(tx *gorm.DB) error {
+		err := tx.Clauses(clause.Locking{Strength: "UPDATE", Options: "SKIP LOCKED"}).
+			Where("status <> ? AND carrier IN ? AND tracking_number <> ''", ShipmentDelivered, carriers).
+			Where("(last_checked_at IS NULL OR last_checked_at <= ?)", p.Cutoff(now)).
+			Order("last_checked_at ASC NULLS FIRST").
+			Limit(p.BatchSize).
+			Find(&shipments).Error
+		if err != nil {
+			return fmt.Errorf("failed to load due shipments: %w", err)
+		}
+		if len(shipments) == 0 {
+			return nil
+		}
+
+		ids := make([]string, len(shipments))
+		for i, shipment := range shipments {
+			ids[i] = shipment.ShipmentID
+		}
+		if err := tx.Model(&ShipmentModel{}).Where("shipment_id IN ?", ids).Update("last_checked_at", now).Error; err != nil {
+			return fmt.Errorf("failed to claim shipments: %w", err)
+		}
+		return nil
+	})
+	if err != nil {
+		return 0, err
+	}
+
+	for _, shipment := range shipments {
+		status, err := p.Carriers[shipment.Carrier].Track(ctx, shipment.TrackingNumber)
+		if err != nil {
+			log.Printf("Failed to track shipment %s (%s %s): %v", shipment.ShipmentID, shipment.Carrier, shipment.TrackingNumber, err)
+			continue
+		}
+		if !shipmentStatuses[status] {
+			log.Printf("Carrier %s reported unknown status %q for shipment %s", shipment.Carrier, status, shipment.ShipmentID)
+			continue
+		}
+		if status == shipment.Status {
+			continue
+		}
+
+		if err := p.DB.WithContext(ctx).Transaction(func(tx *gorm.DB) error {
+			return ApplyShipmentStatus(tx, shipment, status, now)
+		}); err != nil {
+			log.Printf("Failed to update shipment %s: %v", shipment.ShipmentID, err)
+		}
+	}
+
+	return len(shipments), nil
+}
+
+// Cutoff returns the time before which a shipment's last check is stale.
+func (p *ShipmentPoller) Cutoff(now time.Time) time.Time {
+	return now.Add(-p.Interval)
+}
+
+// ApplyShipmentStatus records a carrier-reported status on a shipment and
+// brings its order's status in line. It must be called inside a transaction.
+// A delivered shipment is never moved back.
+func ApplyShipmentStatus(tx *gorm.DB, shipment ShipmentModel, status string, now time.Time) error {
+	order, err := lockOrder(tx, shipment.OrderID)
+	if err != nil {
+		return fmt.Errorf("failed to load order: %w", err)
+	}
+
+	updates := map[string]interface{}{"status": status}
+	if status == ShipmentDelivered {
+		updates["delivered_at"] = now
+	}
+	result := tx.Model(&ShipmentModel{}).
+		Where("shipment_id = ? AND status <> ?", shipment.ShipmentID, ShipmentDelivered).
+		Updates(updates)
+	if result.Error != nil {
+		return fmt.Errorf("failed to update shipment: %w", result.Error)
+	}
+	if result.RowsAffected == 0 || status != ShipmentDelivered {
+		return nil
+	}
+
+	reason := fmt.Sprintf("%s reported %s delivered", shipment.Carrier, shipment.TrackingNumber)
+	return SyncFulfilmentStatus(tx, order, "shipment-poller", RoleSystem, reason)
+}
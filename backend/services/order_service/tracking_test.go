@@ -0,0 +1,50 @@
+package main
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestFakeCarrierProgression(t *testing.T) {
+	carrier := NewFakeCarrier()
+	ctx := context.Background()
+
+	for _, expected := range []string{ShipmentCreated, ShipmentInTransit, ShipmentOutForDelivery, ShipmentDelivered, ShipmentDelivered} {
+		status, err := carrier.Track(ctx, "FAKE-1")
+		require.NoError(t, err)
+		assert.Equal(t, expected, status)
+	}
+
+	_, err := carrier.Track(ctx, "")
+	assert.ErrorIs(t, err, ErrUnknownTrackingNumber)
+}
+
+func TestFakeCarrierSetStatus(t *testing.T) {
+	carrier := NewFakeCarrier()
+	carrier.SetStatus("FAKE-2", ShipmentException)
+
+	for i := 0; i < 2; i++ {
+		status, err := carrier.Track(context.Background(), "FAKE-2")
+		require.NoError(t, err)
+		assert.Equal(t, ShipmentException, status, "a set status does not advance")
+	}
+
+	var _ CarrierTracker = carrier
+}
+
+func TestShipmentPollerCutoff(t *testing.T) {
+	poller := NewShipmentPoller(nil, map[string]CarrierTracker{FakeCarrierCode: NewFakeCarrier()}, 10*time.Minute)
+	now := time.Date(2026, 3, 1, 12, 0, 0, 0, time.UTC)
+
+	assert.Equal(t, time.Date(2026, 3, 1, 11, 50, 0, 0, time.UTC), poller.Cutoff(now))
+	assert.Equal(t, 100, poller.BatchSize)
+
+	// Without carriers there is nothing to poll, and the database is not used
+	polled, err := NewShipmentPoller(nil, nil, time.Minute).PollBatch(context.Background(), now)
+	require.NoError(t, err)
+	assert.Zero(t, polled)
+}
@@ -0,0 +1,947 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"crypto/rand"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"log"
+	"net"
+	"net/http"
+	"net/url"
+	"strconv"
+	"strings"
+	"syscall"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/google/uuid"
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+)
+
+// =============================================================================
+// Seller Webhooks
+// =============================================================================
+
+// Sellers subscribe an HTTPS endpoint to order events instead of polling for
+// changes. Every event written to the outbox for a seller's order also gets a
+// delivery row per subscribed webhook, in the same transaction, so no event is
+// missed. The WebhookDispatcher posts due deliveries signed with the webhook's
+// secret, retries failures with exponential backoff, and disables a webhook
+// after too many failures in a row.
+
+// Webhook delivery statuses.
+const (
+	WebhookDeliveryPending   = "pending"
+	WebhookDeliverySucceeded = "succeeded"
+	WebhookDeliveryFailed    = "failed"
+)
+
+// Headers sent with every webhook delivery. The signature header has the same
+// "t=<unix>,v1=<hex>" format as Stripe's, an HMAC-SHA256 of
+// "<timestamp>.<body>" keyed with the webhook secret.
+const (
+	WebhookSignatureHeader = "X-CloudRetail-Signature"
+	WebhookEventHeader     = "X-CloudRetail-Event"
+	WebhookDeliveryHeader  = "X-CloudRetail-Delivery"
+)
+
+// WebhookEventAll subscribes a webhook to every event type.
+const WebhookEventAll = "*"
+
+// webhookEventTypes are the events a webhook can subscribe to.
+var webhookEventTypes = map[string]bool{
+	"order-placed":            true,
+	"order-paid":              true,
+	"order-partially-shipped": true,
+	"order-shipped":           true,
+	"order-delivered":         true,
+	"order-cancelled":         true,
+	"order-expired":           true,
+	"return-restocked":        true,
+}
+
+const (
+	maxWebhooksPerSeller        = 10
+	maxWebhookURLLength         = 2048
+	maxWebhookResponseLogBytes  = 256
+	defaultWebhookDeliveryLimit = 50
+	maxWebhookDeliveryLimit     = 100
+)
+
+// ErrInvalidWebhook is returned when a subscription's URL or event types are
+// not accepted.
+var ErrInvalidWebhook = errors.New("invalid webhook")
+
+// ErrWebhookAddressBlocked is returned when a webhook would connect to a
+// loopback, private, link-local or otherwise non-public address.
+var ErrWebhookAddressBlocked = errors.New("webhook address not allowed")
+
+// blockedWebhookNetworks are non-public ranges the net.IP predicates used by
+// publicWebhookIP do not cover.
+var blockedWebhookNetworks = []*net.IPNet{
+	mustParseCIDR("0.0.0.0/8"),     // "this network"
+	mustParseCIDR("100.64.0.0/10"), // carrier-grade NAT
+	mustParseCIDR("192.0.0.0/24"),  // IETF protocol assignments
+	mustParseCIDR("198.18.0.0/15"), // benchmarking
+	mustParseCIDR("64:ff9b::/96"),  // NAT64, which can reach IPv4 private ranges
+}
+
+func mustParseCIDR(cidr string) *net.IPNet {
+	_, network, err := net.ParseCIDR(cidr)
+	if err != nil {
+		panic(err)
+	}
+	return network
+}
+
+// ErrTooManyWebhooks is returned when a seller already has the maximum number
+// of webhooks.
+var ErrTooManyWebhooks = errors.New("too many webhooks")
+
+// WebhookSubscription represents the seller_webhooks table in PostgreSQL.
+// ConsecutiveFailures counts failed delivery attempts since the last success;
+// the dispatcher sets Active to false once it reaches its DisableAfter.
+type WebhookSubscription struct {
+	WebhookID           string     `gorm:"primaryKey;type:uuid;column:webhook_id" json:"webhookId"`
+	SellerID            string     `gorm:"not null;index;column:seller_id" json:"sellerId"`
+	URL                 string     `gorm:"not null;column:url" json:"url"`
+	Secret              string     `gorm:"not null;column:secret" json:"-"`
+	EventTypes          StringList `gorm:"type:jsonb;not null;default:'[]';column:event_types" json:"eventTypes"`
+	Active              bool       `gorm:"not null;default:true;column:active" json:"active"`
+	DisabledReason      string     `gorm:"column:disabled_reason" json:"disabledReason,omitempty"`
+	DisabledAt          *time.Time `gorm:"column:disabled_at" json:"disabledAt,omitempty"`
+	ConsecutiveFailures int        `gorm:"not null;default:0;column:consecutive_failures" json:"consecutiveFailures"`
+	CreatedAt           time.Time  `gorm:"autoCreateTime;column:created_at" json:"createdAt"`
+	UpdatedAt           time.Time  `gorm:"autoUpdateTime;column:updated_at" json:"updatedAt"`
+}
+
+// TableName specifies the table name for GORM.
+func (WebhookSubscription) TableName() string {
+	return "seller_webhooks"
+}
+
+// Subscribes reports whether the webhook wants events of the given type.
+func (w WebhookSubscription) Subscribes(eventType string) bool {
+	for _, t := range w.EventTypes {
+		if t == eventType || t == WebhookEventAll {
+			return true
+		}
+	}
+	return false
+}
+
+// WebhookDelivery represents the webhook_deliveries table in PostgreSQL. One
+// row is kept per event and webhook; Payload is the exact body posted, so a
+// redelivery is byte-for-byte the same.
+type WebhookDelivery struct {
+	DeliveryID     string     `gorm:"primaryKey;type:uuid;column:delivery_id" json:"deliveryId"`
+	WebhookID      string     `gorm:"type:uuid;not null;column:webhook_id;uniqueIndex:idx_webhook_deliveries_event,priority:1;index:idx_webhook_deliveries_webhook_created,priority:1" json:"webhookId"`
+	EventID        string     `gorm:"type:uuid;not null;column:event_id;uniqueIndex:idx_webhook_deliveries_event,priority:2" json:"eventId"`
+	EventType      string     `gorm:"not null;column:event_type" json:"eventType"`
+	Payload        string     `gorm:"type:jsonb;not null;column:payload" json:"payload"`
+	Status         string     `gorm:"not null;default:pending;column:status;index:idx_webhook_deliveries_due,priority:1" json:"status"` // pending, succeeded, failed
+	Attempts       int        `gorm:"not null;default:0;column:attempts" json:"attempts"`
+	NextAttemptAt  time.Time  `gorm:"not null;column:next_attempt_at;index:idx_webhook_deliveries_due,priority:2" json:"nextAttemptAt"`
+	LastStatusCode int        `gorm:"column:last_status_code" json:"lastStatusCode,omitempty"`
+	LastError      string     `gorm:"column:last_error" json:"lastError,omitempty"`
+	LastResponse   string     `gorm:"column:last_response" json:"lastResponse,omitempty"`
+	DeliveredAt    *time.Time `gorm:"column:delivered_at" json:"deliveredAt,omitempty"`
+	CreatedAt      time.Time  `gorm:"autoCreateTime;column:created_at;index:idx_webhook_deliveries_webhook_created,priority:2" json:"createdAt"`
+	UpdatedAt      time.Time  `gorm:"autoUpdateTime;column:updated_at" json:"updatedAt"`
+}
+
+// TableName specifies the table name for GORM.
+func (WebhookDelivery) TableName() string {
+	return "webhook_deliveries"
+}
+
+// WebhookEvent is the JSON body posted to a webhook.
+type WebhookEvent struct {
+	ID        string          `json:"id"`
+	Type      string          `json:"type"`
+	CreatedAt time.Time       `json:"createdAt"`
+	Data      json.RawMessage `json:"data"`
+}
+
+// WebhookInput represents the expected JSON body for creating a webhook.
+type WebhookInput struct {
+	URL        string   `json:"url" binding:"required"`
+	EventTypes []string `json:"eventTypes" binding:"required,min=1"`
+}
+
+// UpdateWebhookInput represents the expected JSON body for changing a
+// webhook. Omitted fields are left as they are; setting Active re-enables a
+// disabled webhook and clears its failure count.
+type UpdateWebhookInput struct {
+	URL        *string  `json:"url,omitempty"`
+	EventTypes []string `json:"eventTypes,omitempty"`
+	Active     *bool    `json:"active,omitempty"`
+}
+
+// CreateWebhookResponse is a new webhook with its signing secret, which is
+// only ever returned here.
+type CreateWebhookResponse struct {
+	WebhookSubscription
+	Secret string `json:"secret"`
+}
+
+// ValidateWebhookURL checks that a webhook URL is absolute, uses HTTPS and
+// does not name localhost or a non-public IP address. Hostnames are resolved
+// and checked again when the dispatcher connects (see newWebhookClient).
+func ValidateWebhookURL(raw string) error {
+	if len(raw) > maxWebhookURLLength {
+		return fmt.Errorf("%w: url must be at most %d characters", ErrInvalidWebhook, maxWebhookURLLength)
+	}
+
+	u, err := url.Parse(raw)
+	if err != nil || u.Host == "" {
+		return fmt.Errorf("%w: url must be absolute", ErrInvalidWebhook)
+	}
+	if u.User != nil {
+		return fmt.Errorf("%w: url must not contain credentials", ErrInvalidWebhook)
+	}
+	if u.Scheme != "https" {
+		return fmt.Errorf("%w: url must use https", ErrInvalidWebhook)
+	}
+
+	host := strings.TrimSuffix(strings.ToLower(u.Hostname()), ".")
+	if host == "localhost" || strings.HasSuffix(host, ".localhost") {
+		return fmt.Errorf("%w: url must not point at localhost", ErrInvalidWebhook)
+	}
+	if ip := net.ParseIP(host); ip != nil && !publicWebhookIP(ip) {
+		return fmt.Errorf("%w: url must not point at a private address", ErrInvalidWebhook)
+	}
+	return nil
+}
+
+// publicWebhookIP reports whether a webhook may connect to ip.
+func publicWebhookIP(ip net.IP) bool {
+	if ip.IsLoopback() || ip.IsPrivate() || ip.IsUnspecified() ||
+		ip.IsLinkLocalUnicast() || ip.IsLinkLocalMulticast() ||
+		ip.IsInterfaceLocalMulticast() || ip.IsMulticast() {
+		return false
+	}
+	for _, network := range blockedWebhookNetworks {
+		if network.Contains(ip) {
+			return false
+		}
+	}
+	return true
+}
+
+// checkWebhookDial refuses connections to non-public addresses. It runs on the
+// resolved address of every connection, so a hostname that resolves (or is
+// rebound) to an internal address is refused as well.
+func checkWebhookDial(network, address string, _ syscall.RawConn) error {
+	host, _, err := net.SplitHostPort(address)
+	if err != nil {
+		return err
+	}
+	if ip := net.ParseIP(host); ip == nil || !publicWebhookIP(ip) {
+		return fmt.Errorf("%w: %s", ErrWebhookAddressBlocked, host)
+	}
+	return nil
+}
+
+// newWebhookClient returns the HTTP client webhooks are posted with. It only
+// connects to public addresses, ignores proxy settings (a proxy would connect
+// on its behalf) and does not follow redirects, which count as a failed
+// delivery.
+func newWebhookClient(timeout time.Duration) *http.Client {
+	dialer := &net.Dialer{Timeout: timeout, Control: checkWebhookDial}
+
+	transport := http.DefaultTransport.(*http.Transport).Clone()
+	transport.Proxy = nil
+	transport.DialContext = dialer.DialContext
+
+	return &http.Client{
+		Timeout:   timeout,
+		Transport: transport,
+		CheckRedirect: func(req *http.Request, via []*http.Request) error {
+			return http.ErrUseLastResponse
+		},
+	}
+}
+
+// NormalizeWebhookEventTypes checks the event types of a subscription and
+// returns them without duplicates. "*" on its own subscribes to everything.
+func NormalizeWebhookEventTypes(eventTypes []string) (StringList, error) {
+	if len(eventTypes) == 0 {
+		return nil, fmt.Errorf("%w: at least one event type is required", ErrInvalidWebhook)
+	}
+
+	normalized := make(StringList, 0, len(eventTypes))
+	seen := make(map[string]bool, len(eventTypes))
+	for _, t := range eventTypes {
+		t = strings.ToLower(strings.TrimSpace(t))
+		if t != WebhookEventAll && !webhookEventTypes[t] {
+			return nil, fmt.Errorf("%w: unknown event type %q", ErrInvalidWebhook, t)
+		}
+		if !seen[t] {
+			seen[t] = true
+			normalized = append(normalized, t)
+		}
+	}
+	if seen[WebhookEventAll] {
+		return StringList{WebhookEventAll}, nil
+	}
+	return normalized, nil
+}
+
+// newWebhookSecret returns a random signing secret.
+func newWebhookSecret() (string, error) {
+	buf := make([]byte, 32)
+	if _, err := rand.Read(buf); err != nil {
+		return "", err
+	}
+	return "whsec_" + hex.EncodeToString(buf), nil
+}
+
+// EnqueueWebhookDeliveries creates a pending delivery of an outbox event for
+// each active webhook of the event's seller that subscribes to it. It must be
+// called in the transaction that wrote the event. Events without a sellerId
+// are not delivered.
+func EnqueueWebhookDeliveries(tx *gorm.DB, msg OutboxMessage) error {
+	if !webhookEventTypes[msg.DetailType] {
+		return nil
+	}
+
+	var detail struct {
+		SellerID string `json:"sellerId"`
+	}
+	if err := json.Unmarshal([]byte(msg.Detail), &detail); err != nil || detail.SellerID == "" {
+		return nil
+	}
+
+	var webhooks []WebhookSubscription
+	if err := tx.Where("seller_id = ? AND active", detail.SellerID).Find(&webhooks).Error; err != nil {
+		return fmt.Errorf("failed to load webhooks: %w", err)
+	}
+
+	var payload []byte
+	for _, webhook := range webhooks {
+		if !webhook.Subscribes(msg.DetailType) {
+			continue
+		}
+
+		if payload == nil {
+			var err error
+			payload, err = json.Marshal(WebhookEvent{
+				ID:        msg.MessageID,
+				Type:      msg.DetailType,
+				CreatedAt: msg.NextAttemptAt,
+				Data:      json.RawMessage(msg.Detail),
+			})
+			if err != nil {
+				return fmt.Errorf("failed to marshal webhook payload: %w", err)
+			}
+		}
+
+		delivery := WebhookDelivery{
+			DeliveryID:    uuid.New().String(),
+			WebhookID:     webhook.WebhookID,
+			EventID:       msg.MessageID,
+			EventType:     msg.DetailType,
+			Payload:       string(payload),
+			Status:        WebhookDeliveryPending,
+			NextAttemptAt: msg.NextAttemptAt,
+		}
+		if err := tx.Create(&delivery).Error; err != nil {
+			return fmt.Errorf("failed to write webhook delivery: %w", err)
+		}
+	}
+
+	return nil
+}
+
+// =============================================================================
+// Webhook Dispatcher
+// =============================================================================
+
+// WebhookDispatcher posts due webhook deliveries. Due deliveries of active
+// webhooks are claimed with SELECT ... FOR UPDATE SKIP LOCKED and leased by
+// pushing their next attempt back by Lease, so several replicas can run a
+// dispatcher and no row lock is held while waiting on a seller's endpoint.
+// Each outcome is then saved in its own transaction.
+type WebhookDispatcher struct {
+	DB           *gorm.DB
+	Client       *http.Client
+	BatchSize    int
+	PollInterval time.Duration
+	MaxAttempts  int
+	BaseBackoff  time.Duration
+	MaxBackoff   time.Duration
+	DisableAfter int
+	ClaimLease   time.Duration
+}
+
+// NewWebhookDispatcher creates a dispatcher with default batching, retry and
+// disabling settings. With the defaults a delivery is retried for about a day.
+func NewWebhookDispatcher(database *gorm.DB) *WebhookDispatcher {
+	return &WebhookDispatcher{
+		DB:           database,
+		Client:       newWebhookClient(10 * time.Second),
+		BatchSize:    50,
+		PollInterval: 5 * time.Second,
+		MaxAttempts:  12,
+		BaseBackoff:  30 * time.Second,
+		MaxBackoff:   6 * time.Hour,
+		DisableAfter: 50,
+		ClaimLease:   10 * time.Minute,
+	}
+}
+
+// Lease returns how long a batch of deliveries is claimed for: ClaimLease, but
+// never less than a full batch of endpoints timing out one after the other
+// plus a minute, so another replica cannot pick up a delivery still waiting
+// its turn.
+func (d *WebhookDispatcher) Lease() time.Duration {
+	if minimum := time.Duration(d.BatchSize)*d.Client.Timeout + time.Minute; d.ClaimLease < minimum {
+		return minimum
+	}
+	return d.ClaimLease
+}
+
+// WebhookAttempt is the outcome of posting a delivery once.
+type WebhookAttempt struct {
+	StatusCode int
+	Response   string
+	Err        error
+}
+
+// Succeeded reports whether the endpoint accepted the delivery with a 2xx.
+func (a WebhookAttempt) Succeeded() bool {
+	return a.Err == nil && a.StatusCode >= 200 && a.StatusCode < 300
+}
+
+// Run dispatches due deliveries every PollInterval until the context is
+// cancelled.
+func (d *WebhookDispatcher) Run(ctx context.Context) {
+	log.Println("🪝 Webhook dispatcher started")
+
+	ticker := time.NewTicker(d.PollInterval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ctx.Done():
+			log.Println("Webhook dispatcher stopped")
+			return
+		case <-ticker.C:
+			if _, err := d.ProcessBatch(ctx, time.Now().UTC()); err != nil {
+				log.Printf("Webhook dispatcher error: %v", err)
+			}
+		}
+	}
+}
+
+// ProcessBatch claims up to BatchSize due deliveries, posts them and saves the
+// outcomes. It returns the number of deliveries that succeeded.
+func (d *WebhookDispatcher) ProcessBatch(ctx context.Context, now time.Time) (int, error) {
+	var deliveries []WebhookDelivery
+	err := d.DB.WithContext(ctx).Transaction(func(tx *gorm.DB) error {
+		err := tx.Clauses(clause.Locking{Strength: "UPDATE", Options: "SKIP LOCKED"}).
+			Where("status = ? AND next_attempt_at <= ?", WebhookDeliveryPending, now).
+			Where("webhook_id IN (?)", tx.Model(&WebhookSubscription{}).Select("webhook_id").Where("active")).
+			Order("next_attempt_at ASC").
+			Limit(d.BatchSize).
+			Find(&deliveries).Error
+		if err != nil {
+			return fmt.Errorf("failed to load due webhook deliveries: %w", err)
+		}
+		if len(deliveries) == 0 {
+			return nil
+		}
+
+		ids := make([]string, len(deliveries))
+		for i, delivery := range deliveries {
+			ids[i] = delivery.DeliveryID
+		}
+		if err := tx.Model(&WebhookDelivery{}).Where("delivery_id IN ?", ids).
+			Update("next_attempt_at", now.Add(d.Lease())).Error; err != nil {
+			return fmt.Errorf("failed to claim webhook deliveries: %w", err)
+		}
+		return nil
+	})
+	if err != nil {
+		return 0, err
+	}
+
+	succeeded := 0
+	for i := range deliveries {
+		ok, err := d.Redeliver(ctx, &deliveries[i], now)
+		if err != nil {
+			log.Printf("Failed to save webhook delivery %s: %v", deliveries[i].DeliveryID, err)
+			continue
+		}
+		if ok {
+			succeeded++
+		}
+	}
+
+	return succeeded, nil
+}
+
+// Redeliver posts a delivery to its webhook now and saves the outcome,
+// whatever the delivery's status. It reports whether the endpoint accepted it.
+func (d *WebhookDispatcher) Redeliver(ctx context.Context, delivery *WebhookDelivery, now time.Time) (bool, error) {
+	var webhook WebhookSubscription
+	if err := d.DB.WithContext(ctx).First(&webhook, "webhook_id = ?", delivery.WebhookID).Error; err != nil {
+		return false, fmt.Errorf("failed to load webhook: %w", err)
+	}
+
+	attempt := d.Post(ctx, webhook, *delivery, now)
+	d.ApplyAttempt(delivery, attempt, now)
+
+	err := d.DB.WithContext(ctx).Transaction(func(tx *gorm.DB) error {
+		if err := tx.Save(delivery).Error; err != nil {
+			return fmt.Errorf("failed to update webhook delivery: %w", err)
+		}
+		return d.recordWebhookOutcome(tx, webhook.WebhookID, attempt.Succeeded(), now)
+	})
+	return attempt.Succeeded(), err
+}
+
+// Post sends a delivery's payload to the webhook, signed with its secret.
+func (d *WebhookDispatcher) Post(ctx context.Context, webhook WebhookSubscription, delivery WebhookDelivery, now time.Time) WebhookAttempt {
+	payload := []byte(delivery.Payload)
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, webhook.URL, bytes.NewReader(payload))
+	if err != nil {
+		return WebhookAttempt{Err: err}
+	}
+	req.Header.Set("Content-Type", "application/json")
+	req.Header.Set("User-Agent", "CloudRetail-Webhooks/1.0")
+	req.Header.Set(WebhookSignatureHeader, SignWebhookPayload(webhook.Secret, payload, now))
+	req.Header.Set(WebhookEventHeader, delivery.EventType)
+	req.Header.Set(WebhookDeliveryHeader, delivery.DeliveryID)
+
+	resp, err := d.Client.Do(req)
+	if err != nil {
+		return WebhookAttempt{Err: err}
+	}
+	defer resp.Body.Close()
+
+	body, _ := io.ReadAll(io.LimitReader(resp.Body, maxWebhookResponseLogBytes))
+	attempt := WebhookAttempt{StatusCode: resp.StatusCode, Response: string(body)}
+	if !attempt.Succeeded() {
+		attempt.Err = fmt.Errorf("endpoint returned %d", resp.StatusCode)
+	}
+	return attempt
+}
+
+// ApplyAttempt updates a delivery's status, attempt count and next attempt
+// time in place after an attempt.
+func (d *WebhookDispatcher) ApplyAttempt(delivery *WebhookDelivery, attempt WebhookAttempt, now time.Time) {
+	delivery.Attempts++
+	delivery.LastStatusCode = attempt.StatusCode
+	delivery.LastResponse = attempt.Response
+
+	if attempt.Succeeded() {
+		delivery.Status = WebhookDeliverySucceeded
+		delivery.LastError = ""
+		delivery.DeliveredAt = &now
+		return
+	}
+
+	delivery.LastError = attempt.Err.Error()
+	if delivery.Status == WebhookDeliveryFailed || delivery.Attempts >= d.MaxAttempts {
+		delivery.Status = WebhookDeliveryFailed
+		log.Printf("❌ Webhook delivery %s (%s) failed after %d attempts: %v",
+			delivery.DeliveryID, delivery.EventType, delivery.Attempts, attempt.Err)
+		return
+	}
+	delivery.Status = WebhookDeliveryPending
+	delivery.NextAttemptAt = now.Add(exponentialBackoff(d.BaseBackoff, d.MaxBackoff, delivery.Attempts))
+}
+
+// recordWebhookOutcome resets a webhook's failure count after a success, or
+// counts a failure and disables the webhook once DisableAfter failures have
+// happened in a row.
+func (d *WebhookDispatcher) recordWebhookOutcome(tx *gorm.DB, webhookID string, succeeded bool, now time.Time) error {
+	if succeeded {
+		return tx.Model(&WebhookSubscription{}).Where("webhook_id = ?", webhookID).
+			Update("consecutive_failures", 0).Error
+	}
+
+	if err := tx.Model(&WebhookSubscription{}).Where("webhook_id = ?", webhookID).
+		Update("consecutive_failures", gorm.Expr("consecutive_failures + 1")).Error; err != nil {
+		return fmt.Errorf("failed to count webhook failure: %w", err)
+	}
+
+	result := tx.Model(&WebhookSubscription{}).
+		Where("webhook_id = ? AND active AND consecutive_failures >= ?", webhookID, d.DisableAfter).
+		Updates(map[string]interface{}{
+			"active":          false,
+			"disabled_reason": fmt.Sprintf("disabled after %d failed deliveries in a row", d.DisableAfter),
+			"disabled_at":     now,
+		})
+	if result.Error != nil {
+		return fmt.Errorf("failed to disable webhook: %w", result.Error)
+	}
+	if result.RowsAffected > 0 {
+		log.Printf("⚠️ Webhook %s disabled after %d failed deliveries in a row", webhookID, d.DisableAfter)
+	}
+	return nil
+}
+
+// =============================================================================
+// Webhook Handlers
+// =============================================================================
+
+// errWebhookNotFound aborts a transaction when a webhook does not exist or
+// belongs to another seller.
+var errWebhookNotFound = errors.New("webhook not found")
+
+// requireSeller returns the caller's user ID if they are a seller, writing an
+// error response otherwise.
+func requireSeller(c *gin.Context) (string, bool) {
+	userID, exists := c.Get("userId")
+	if !exists {
+		c.JSON(http.StatusUnauthorized, ErrorResponse{Error: "User ID not found in token"})
+		return "", false
+	}
+
+	customRole, _ := c.Get("customRole")
+	if customRole != "seller" {
+		c.JSON(http.StatusForbidden, ErrorResponse{Error: "Only sellers can manage webhooks"})
+		return "", false
+	}
+
+	return userID.(string), true
+}
+
+// loadSellerWebhook loads one of a seller's webhooks. An ID that is not a UUID
+// or belongs to another seller is reported as errWebhookNotFound.
+func loadSellerWebhook(tx *gorm.DB, sellerID, webhookID string) (*WebhookSubscription, error) {
+	if _, err := uuid.Parse(webhookID); err != nil {
+		return nil, errWebhookNotFound
+	}
+
+	var webhook WebhookSubscription
+	err := tx.First(&webhook, "webhook_id = ? AND seller_id = ?", webhookID, sellerID).Error
+	if errors.Is(err, gorm.ErrRecordNotFound) {
+		return nil, errWebhookNotFound
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to load webhook: %w", err)
+	}
+	return &webhook, nil
+}
+
+// webhookErrorStatus maps a webhook error to an HTTP status code.
+func webhookErrorStatus(err error) int {
+	switch {
+	case errors.Is(err, ErrInvalidWebhook):
+		return http.StatusBadRequest
+	case errors.Is(err, errWebhookNotFound):
+		return http.StatusNotFound
+	case errors.Is(err, ErrTooManyWebhooks):
+		return http.StatusConflict
+	default:
+		return http.StatusInternalServerError
+	}
+}
+
+// HandleGetWebhooks godoc
+// @Summary List webhooks
+// @Description Returns the seller's webhook subscriptions, oldest first
+// @Tags webhooks
+// @Produce json
+// @Success 200 {object} []WebhookSubscription
+// @Failure 401 {object} ErrorResponse
+// @Failure 403 {object} ErrorResponse
+// @Failure 500 {object} ErrorResponse
+// @Router /webhooks [get]
+func HandleGetWebhooks(c *gin.Context) {
+	sellerID, ok := requireSeller(c)
+	if !ok {
+		return
+	}
+
+	webhooks := []WebhookSubscription{}
+	if err := db.Where("seller_id = ?", sellerID).Order("created_at ASC").Find(&webhooks).Error; err != nil {
+		c.JSON(http.StatusInternalServerError, ErrorResponse{Error: "Failed to fetch webhooks"})
+		return
+	}
+
+	c.JSON(http.StatusOK, webhooks)
+}
+
+// HandleCreateWebhook godoc
+// @Summary Create a webhook
+// @Description Subscribes an HTTPS endpoint to the seller's order events. The response carries the signing secret, which is not shown again.
+// @Tags webhooks
+// @Accept json
+// @Produce json
+// @Param request body WebhookInput true "Endpoint URL and event types"
+// @Success 201 {object} CreateWebhookResponse
+// @Failure 400 {object} ErrorResponse
+// @Failure 401 {object} ErrorResponse
+// @Failure 403 {object} ErrorResponse
+// @Failure 409 {object} ErrorResponse
+// @Router /webhooks [post]
+func HandleCreateWebhook(c *gin.Context) {
+	var input WebhookInput
+	if err := c.ShouldBindJSON(&input); err != nil {
+		c.JSON(http.StatusBadRequest, ErrorResponse{Error: "Invalid request. URL and event types are required."})
+		return
+	}
+
+	sellerID, ok := requireSeller(c)
+	if !ok {
+		return
+	}
+
+	input.URL = strings.TrimSpace(input.URL)
+	if err := ValidateWebhookURL(input.URL); err != nil {
+		c.JSON(http.StatusBadRequest, ErrorResponse{Error: err.Error()})
+		return
+	}
+	eventTypes, err := NormalizeWebhookEventTypes(input.EventTypes)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, ErrorResponse{Error: err.Error()})
+		return
+	}
+
+	secret, err := newWebhookSecret()
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, ErrorResponse{Error: "Failed to generate webhook secret"})
+		return
+	}
+
+	webhook := WebhookSubscription{
+		WebhookID:  uuid.New().String(),
+		SellerID:   sellerID,
+		URL:        input.URL,
+		Secret:     secret,
+		EventTypes: eventTypes,
+		Active:     true,
+	}
+	err = db.Transaction(func(tx *gorm.DB) error {
+		var count int64
+		if err := tx.Model(&WebhookSubscription{}).Where("seller_id = ?", sellerID).Count(&count).Error; err != nil {
+			return err
+		}
+		if count >= maxWebhooksPerSeller {
+			return fmt.Errorf("%w: a seller can have at most %d webhooks", ErrTooManyWebhooks, maxWebhooksPerSeller)
+		}
+		return tx.Create(&webhook).Error
+	})
+	if err != nil {
+		c.JSON(webhookErrorStatus(err), ErrorResponse{Error: "Cannot create webhook: " + err.Error()})
+		return
+	}
+
+	c.JSON(http.StatusCreated, CreateWebhookResponse{WebhookSubscription: webhook, Secret: secret})
+}
+
+// HandleUpdateWebhook godoc
+// @Summary Update a webhook
+// @Description Changes a webhook's URL or event types, or enables or disables it. Enabling clears its failure count.
+// @Tags webhooks
+// @Accept json
+// @Produce json
+// @Param webhookId path string true "Webhook ID"
+// @Param request body UpdateWebhookInput true "Fields to change"
+// @Success 200 {object} WebhookSubscription
+// @Failure 400 {object} ErrorResponse
+// @Failure 401 {object} ErrorResponse
+// @Failure 403 {object} ErrorResponse
+// @Failure 404 {object} ErrorResponse
+// @Router /webhooks/{webhookId} [put]
+func HandleUpdateWebhook(c *gin.Context) {
+	var input UpdateWebhookInput
+	if err := c.ShouldBindJSON(&input); err != nil {
+		c.JSON(http.StatusBadRequest, ErrorResponse{Error: "Invalid request body"})
+		return
+	}
+
+	sellerID, ok := requireSeller(c)
+	if !ok {
+		return
+	}
+
+	updates := map[string]interface{}{}
+	if input.URL != nil {
+		u := strings.TrimSpace(*input.URL)
+		if err := ValidateWebhookURL(u); err != nil {
+			c.JSON(http.StatusBadRequest, ErrorResponse{Error: err.Error()})
+			return
+		}
+		updates["url"] = u
+	}
+	if input.EventTypes != nil {
+		eventTypes, err := NormalizeWebhookEventTypes(input.EventTypes)
+		if err != nil {
+			c.JSON(http.StatusBadRequest, ErrorResponse{Error: err.Error()})
+			return
+		}
+		updates["event_types"] = eventTypes
+	}
+	if input.Active != nil {
+		updates["active"] = *input.Active
+		if *input.Active {
+			updates["consecutive_failures"] = 0
+			updates["disabled_reason"] = ""
+			updates["disabled_at"] = nil
+		} else {
+			updates["disabled_reason"] = "disabled by seller"
+			updates["disabled_at"] = time.Now().UTC()
+		}
+	}
+
+	var webhook *WebhookSubscription
+	err := db.Transaction(func(tx *gorm.DB) error {
+		var err error
+		webhook, err = loadSellerWebhook(tx, sellerID, c.Param("webhookId"))
+		if err != nil {
+			return err
+		}
+		if len(updates) == 0 {
+			return nil
+		}
+		if err := tx.Model(webhook).Updates(updates).Error; err != nil {
+			return fmt.Errorf("failed to update webhook: %w", err)
+		}
+		return tx.First(webhook, "webhook_id = ?", webhook.WebhookID).Error
+	})
+	if err != nil {
+		c.JSON(webhookErrorStatus(err), ErrorResponse{Error: "Cannot update webhook: " + err.Error()})
+		return
+	}
+
+	c.JSON(http.StatusOK, webhook)
+}
+
+// HandleDeleteWebhook godoc
+// @Summary Delete a webhook
+// @Description Removes a webhook subscription and its delivery log
+// @Tags webhooks
+// @Produce json
+// @Param webhookId path string true "Webhook ID"
+// @Success 200 {object} map[string]string
+// @Failure 401 {object} ErrorResponse
+// @Failure 403 {object} ErrorResponse
+// @Failure 404 {object} ErrorResponse
+// @Router /webhooks/{webhookId} [delete]
+func HandleDeleteWebhook(c *gin.Context) {
+	sellerID, ok := requireSeller(c)
+	if !ok {
+		return
+	}
+
+	webhookID := c.Param("webhookId")
+	err := db.Transaction(func(tx *gorm.DB) error {
+		if _, err := loadSellerWebhook(tx, sellerID, webhookID); err != nil {
+			return err
+		}
+		if err := tx.Where("webhook_id = ?", webhookID).Delete(&WebhookDelivery{}).Error; err != nil {
+			return fmt.Errorf("failed to delete webhook deliveries: %w", err)
+		}
+		return tx.Where("webhook_id = ?", webhookID).Delete(&WebhookSubscription{}).Error
+	})
+	if err != nil {
+		c.JSON(webhookErrorStatus(err), ErrorResponse{Error: "Cannot delete webhook: " + err.Error()})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"message": "Webhook deleted", "webhookId": webhookID})
+}
+
+// HandleGetWebhookDeliveries godoc
+// @Summary List webhook deliveries
+// @Description Returns a webhook's delivery log, newest first, with the outcome of the last attempt of each delivery
+// @Tags webhooks
+// @Produce json
+// @Param webhookId path string true "Webhook ID"
+// @Param status query string false "Only deliveries with this status (pending, succeeded, failed)"
+// @Param limit query int false "Number of deliveries (default 50, max 100)"
+// @Success 200 {object} []WebhookDelivery
+// @Failure 400 {object} ErrorResponse
+// @Failure 401 {object} ErrorResponse
+// @Failure 403 {object} ErrorResponse
+// @Failure 404 {object} ErrorResponse
+// @Router /webhooks/{webhookId}/deliveries [get]
+func HandleGetWebhookDeliveries(c *gin.Context) {
+	limit := defaultWebhookDeliveryLimit
+	if v := c.Query("limit"); v != "" {
+		parsed, err := strconv.Atoi(v)
+		if err != nil || parsed < 1 || parsed > maxWebhookDeliveryLimit {
+			c.JSON(http.StatusBadRequest, ErrorResponse{Error: fmt.Sprintf("Invalid limit. Use 1-%d.", maxWebhookDeliveryLimit)})
+			return
+		}
+		limit = parsed
+	}
+
+	sellerID, ok := requireSeller(c)
+	if !ok {
+		return
+	}
+
+	webhook, err := loadSellerWebhook(db, sellerID, c.Param("webhookId"))
+	if err != nil {
+		c.JSON(webhookErrorStatus(err), ErrorResponse{Error: "Cannot list deliveries: " + err.Error()})
+		return
+	}
+
+	query := db.Where("webhook_id = ?", webhook.WebhookID)
+	if status := c.Query("status"); status != "" {
+		query = query.Where("status = ?", status)
+	}
+
+	deliveries := []WebhookDelivery{}
+	if err := query.Order("created_at DESC").Limit(limit).Find(&deliveries).Error; err != nil {
+		c.JSON(http.StatusInternalServerError, ErrorResponse{Error: "Failed to fetch webhook deliveries"})
+		return
+	}
+
+	c.JSON(http.StatusOK, deliveries)
+}
+
+// HandleRedeliverWebhook godoc
+// @Summary Redeliver a webhook event
+// @Description Posts a delivery to the webhook again right away, whatever its status, and returns the updated delivery
+// @Tags webhooks
+// @Produce json
+// @Param webhookId path string true "Webhook ID"
+// @Param deliveryId path string true "Delivery ID"
+// @Success 200 {object} WebhookDelivery
+// @Failure 401 {object} ErrorResponse
+// @Failure 403 {object} ErrorResponse
+// @Failure 404 {object} ErrorResponse
+// @Failure 500 {object} ErrorResponse
+// @Router /webhooks/{webhookId}/deliveries/{deliveryId}/redeliver [post]
+func HandleRedeliverWebhook(c *gin.Context) {
+	sellerID, ok := requireSeller(c)
+	if !ok {
+		return
+	}
+
+	webhook, err := loadSellerWebhook(db, sellerID, c.Param("webhookId"))
+	if err != nil {
+		c.JSON(webhookErrorStatus(err), ErrorResponse{Error: "Cannot redeliver: " + err.Error()})
+		return
+	}
+
+	deliveryID := c.Param("deliveryId")
+	var delivery WebhookDelivery
+	if _, err := uuid.Parse(deliveryID); err != nil ||
+		db.First(&delivery, "delivery_id = ? AND webhook_id = ?", deliveryID, webhook.WebhookID).Error != nil {
+		c.JSON(http.StatusNotFound, ErrorResponse{Error: "Delivery not found"})
+		return
+	}
+
+	if _, err := webhookDispatcher.Redeliver(c.Request.Context(), &delivery, time.Now().UTC()); err != nil {
+		c.JSON(http.StatusInternalServerError, ErrorResponse{Error: "Failed to save delivery"})
+		return
+	}
+
+	c.JSON(http.StatusOK, delivery)
+}
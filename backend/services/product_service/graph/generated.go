@@ -47,28 +47,46 @@ type DirectiveRoot struct {
 
 type ComplexityRoot struct {
 	Mutation struct {
-		AddProduct  func(childComplexity int, input model.AddProductInput) int
-		AddReview   func(childComplexity int, input model.AddReviewInput) int
-		EditProduct func(childComplexity int, input model.EditProductInput) int
+		AddProduct         func(childComplexity int, input model.AddProductInput) int
+		AddReview          func(childComplexity int, input model.AddReviewInput) int
+		EditProduct        func(childComplexity int, input model.EditProductInput) int
+		ReleaseReservation func(childComplexity int, reservationID string) int
+		ReserveStock       func(childComplexity int, reservationID string, items []*model.StockItemInput) int
 	}
 
 	Product struct {
+		Available   func(childComplexity int) int
 		CreatedAt   func(childComplexity int) int
 		Description func(childComplexity int) int
 		ImageURL    func(childComplexity int) int
 		Name        func(childComplexity int) int
 		Price       func(childComplexity int) int
 		ProductID   func(childComplexity int) int
+		Reserved    func(childComplexity int) int
 		Reviews     func(childComplexity int) int
 		SellerID    func(childComplexity int) int
 		Stock       func(childComplexity int) int
 		UpdatedAt   func(childComplexity int) int
+		Version     func(childComplexity int) int
 	}
 
 	Query struct {
-		GetAllProducts func(childComplexity int, filter *model.ProductFilter) int
-		GetProductByID func(childComplexity int, id string) int
-		Health         func(childComplexity int) int
+		GetAllProducts   func(childComplexity int, filter *model.ProductFilter) int
+		GetProductByID   func(childComplexity int, id string) int
+		GetProductsByIDs func(childComplexity int, ids []string) int
+		Health           func(childComplexity int) int
+	}
+
+	Reservation struct {
+		ExpiresAt     func(childComplexity int) int
+		Items         func(childComplexity int) int
+		ReservationID func(childComplexity int) int
+	}
+
+	ReservationItem struct {
+		ProductID func(childComplexity int) int
+		Quantity  func(childComplexity int) int
+		Status    func(childComplexity int) int
 	}
 
 	Review struct {
@@ -85,9 +103,12 @@ type MutationResolver interface {
 	AddProduct(ctx context.Context, input model.AddProductInput) (*model.Product, error)
 	EditProduct(ctx context.Context, input model.EditProductInput) (*model.Product, error)
 	AddReview(ctx context.Context, input model.AddReviewInput) (*model.Review, error)
+	ReserveStock(ctx context.Context, reservationID string, items []*model.StockItemInput) (*model.Reservation, error)
+	ReleaseReservation(ctx context.Context, reservationID string) (*model.Reservation, error)
 }
 type QueryResolver interface {
 	GetProductByID(ctx context.Context, id string) (*model.Product, error)
+	GetProductsByIDs(ctx context.Context, ids []string) ([]*model.Product, error)
 	GetAllProducts(ctx context.Context, filter *model.ProductFilter) ([]*model.Product, error)
 	Health(ctx context.Context) (string, error)
 }
@@ -144,7 +165,35 @@ func (e *executableSchema) Complexity(ctx context.Context, typeName, field strin
 		}
 
 		return e.complexity.Mutation.EditProduct(childComplexity, args["input"].(model.EditProductInput)), true
+	case "Mutation.releaseReservation":
+		if e.complexity.Mutation.ReleaseReservation == nil {
+			break
+		}
+
+		args, err := ec.field_Mutation_releaseReservation_args(ctx, rawArgs)
+		if err != nil {
+			return 0, false
+		}
+
+		return e.complexity.Mutation.ReleaseReservation(childComplexity, args["reservationId"].(string)), true
+	case "Mutation.reserveStock":
+		if e.complexity.Mutation.ReserveStock == nil {
+			break
+		}
+
+		args, err := ec.field_Mutation_reserveStock_args(ctx, rawArgs)
+		if err != nil {
+			return 0, false
+		}
+
+		return e.complexity.Mutation.ReserveStock(childComplexity, args["reservationId"].(string), args["items"].([]*model.StockItemInput)), true
+
+	case "Product.available":
+		if e.complexity.Product.Available == nil {
+			break
+		}
 
+		return e.complexity.Product.Available(childComplexity), true
 	case "Product.createdAt":
 		if e.complexity.Product.CreatedAt == nil {
 			break
@@ -181,6 +230,12 @@ func (e *executableSchema) Complexity(ctx context.Context, typeName, field strin
 		}
 
 		return e.complexity.Product.ProductID(childComplexity), true
+	case "Product.reserved":
+		if e.complexity.Product.Reserved == nil {
+			break
+		}
+
+		return e.complexity.Product.Reserved(childComplexity), true
 	case "Product.reviews":
 		if e.complexity.Product.Reviews == nil {
 			break
@@ -205,6 +260,12 @@ func (e *executableSchema) Complexity(ctx context.Context, typeName, field strin
 		}
 
 		return e.complexity.Product.UpdatedAt(childComplexity), true
+	case "Product.version":
+		if e.complexity.Product.Version == nil {
+			break
+		}
+
+		return e.complexity.Product.Version(childComplexity), true
 
 	case "Query.getAllProducts":
 		if e.complexity.Query.GetAllProducts == nil {
@@ -228,6 +289,17 @@ func (e *executableSchema) Complexity(ctx context.Context, typeName, field strin
 		}
 
 		return e.complexity.Query.GetProductByID(childComplexity, args["id"].(string)), true
+	case "Query.getProductsByIds":
+		if e.complexity.Query.GetProductsByIDs == nil {
+			break
+		}
+
+		args, err := ec.field_Query_getProductsByIds_args(ctx, rawArgs)
+		if err != nil {
+			return 0, false
+		}
+
+		return e.complexity.Query.GetProductsByIDs(childComplexity, args["ids"].([]string)), true
 	case "Query.health":
 		if e.complexity.Query.Health == nil {
 			break
@@ -235,6 +307,44 @@ func (e *executableSchema) Complexity(ctx context.Context, typeName, field strin
 
 		return e.complexity.Query.Health(childComplexity), true
 
+	case "Reservation.expiresAt":
+		if e.complexity.Reservation.ExpiresAt == nil {
+			break
+		}
+
+		return e.complexity.Reservation.ExpiresAt(childComplexity), true
+	case "Reservation.items":
+		if e.complexity.Reservation.Items == nil {
+			break
+		}
+
+		return e.complexity.Reservation.Items(childComplexity), true
+	case "Reservation.reservationId":
+		if e.complexity.Reservation.ReservationID == nil {
+			break
+		}
+
+		return e.complexity.Reservation.ReservationID(childComplexity), true
+
+	case "ReservationItem.productId":
+		if e.complexity.ReservationItem.ProductID == nil {
+			break
+		}
+
+		return e.complexity.ReservationItem.ProductID(childComplexity), true
+	case "ReservationItem.quantity":
+		if e.complexity.ReservationItem.Quantity == nil {
+			break
+		}
+
+		return e.complexity.ReservationItem.Quantity(childComplexity), true
+	case "ReservationItem.status":
+		if e.complexity.ReservationItem.Status == nil {
+			break
+		}
+
+		return e.complexity.ReservationItem.Status(childComplexity), true
+
 	case "Review.createdAt":
 		if e.complexity.Review.CreatedAt == nil {
 			break
@@ -284,6 +394,7 @@ func (e *executableSchema) Exec(ctx context.Context) graphql.ResponseHandler {
 		ec.unmarshalInputAddReviewInput,
 		ec.unmarshalInputEditProductInput,
 		ec.unmarshalInputProductFilter,
+		ec.unmarshalInputStockItemInput,
 	)
 	first := true
 
@@ -384,6 +495,11 @@ var sources = []*ast.Source{
 	{Name: "../schema.graphql", Input: `# GraphQL schema for ProductService
 # This schema defines product and review operations for the CloudRetail platform
 
+# An exact amount of money: integer minor units (cents) of an ISO 4217
+# currency, written as {"amount": 1799700, "currency": "LKR"}. Inputs also
+# accept a plain decimal number, read as major units of the default currency.
+scalar Money
+
 # Product filter input for getAllProducts query
 input ProductFilter {
   sellerId: String
@@ -392,7 +508,7 @@ input ProductFilter {
 # Input for adding a new product
 input AddProductInput {
   name: String!
-  price: Float!
+  price: Money!
   description: String
   stock: Int!
   sellerId: String!
@@ -403,10 +519,13 @@ input AddProductInput {
 input EditProductInput {
   productId: ID!
   name: String
-  price: Float
+  price: Money
   description: String
   stock: Int
   imageUrl: String
+  # Version the product must still be at, as read from Product.version; the
+  # edit fails with a version conflict if the product changed since
+  expectedVersion: Int
 }
 
 # Input for adding a product review
@@ -417,6 +536,12 @@ input AddReviewInput {
   userId: String!
 }
 
+# Quantity of a product to reserve at checkout
+input StockItemInput {
+  productId: ID!
+  quantity: Int!
+}
+
 #Product review type
 type Review {
   reviewId: ID!
@@ -431,14 +556,35 @@ type Review {
 type Product {
   productId: ID!
   name: String!
-  price: Float!
+  price: Money!
   description: String
   stock: Int!
+  # Units held by unpaid checkouts
+  reserved: Int!
+  # Units that can still be bought (stock minus reserved)
+  available: Int!
   sellerId: String!
   imageUrl: String
   reviews: [Review!]!
   createdAt: String
   updatedAt: String
+  # Incremented by every edit, for optimistic concurrency (see editProduct)
+  version: Int!
+}
+
+# One product held by a reservation. Status is active, committed, released
+# or restocked.
+type ReservationItem {
+  productId: ID!
+  quantity: Int!
+  status: String!
+}
+
+# Stock held for a checkout until it is paid, released or expires
+type Reservation {
+  reservationId: ID!
+  expiresAt: String!
+  items: [ReservationItem!]!
 }
 
 # Query operations  
@@ -446,6 +592,10 @@ type Query {
   # Get a single product by ID
   getProductById(id: ID!): Product
   
+  # Get several products in one call. The result has one entry per requested
+  # ID, in the same order, and the entry is null when that product does not exist.
+  getProductsByIds(ids: [ID!]!): [Product]!
+  
   # Get all products with optional filtering
   getAllProducts(filter: ProductFilter): [Product!]!
   
@@ -463,6 +613,12 @@ type Mutation {
   
   # Add a review to a product (requires user authentication)
   addReview(input: AddReviewInput!): Review!
+  
+  # Hold stock for a checkout until it is paid or expires (requires user JWT)
+  reserveStock(reservationId: ID!, items: [StockItemInput!]!): Reservation!
+  
+  # Release a checkout's unpaid holds early (requires the reserving user's JWT)
+  releaseReservation(reservationId: ID!): Reservation!
 }
 `, BuiltIn: false},
 }
@@ -505,6 +661,33 @@ func (ec *executionContext) field_Mutation_editProduct_args(ctx context.Context,
 	return args, nil
 }
 
+func (ec *executionContext) field_Mutation_releaseReservation_args(ctx context.Context, rawArgs map[string]any) (map[string]any, error) {
+	var err error
+	args := map[string]any{}
+	arg0, err := graphql.ProcessArgField(ctx, rawArgs, "reservationId", ec.unmarshalNID2string)
+	if err != nil {
+		return nil, err
+	}
+	args["reservationId"] = arg0
+	return args, nil
+}
+
+func (ec *executionContext) field_Mutation_reserveStock_args(ctx context.Context, rawArgs map[string]any) (map[string]any, error) {
+	var err error
+	args := map[string]any{}
+	arg0, err := graphql.ProcessArgField(ctx, rawArgs, "reservationId", ec.unmarshalNID2string)
+	if err != nil {
+		return nil, err
+	}
+	args["reservationId"] = arg0
+	arg1, err := graphql.ProcessArgField(ctx, rawArgs, "items", ec.unmarshalNStockItemInput2ᚕᚖproduct_serviceᚋgraphᚋmodelᚐStockItemInputᚄ)
+	if err != nil {
+		return nil, err
+	}
+	args["items"] = arg1
+	return args, nil
+}
+
 func (ec *executionContext) field_Query___type_args(ctx context.Context, rawArgs map[string]any) (map[string]any, error) {
 	var err error
 	args := map[string]any{}
@@ -538,6 +721,17 @@ func (ec *executionContext) field_Query_getProductById_args(ctx context.Context,
 	return args, nil
 }
 
+func (ec *executionContext) field_Query_getProductsByIds_args(ctx context.Context, rawArgs map[string]any) (map[string]any, error) {
+	var err error
+	args := map[string]any{}
+	arg0, err := graphql.ProcessArgField(ctx, rawArgs, "ids", ec.unmarshalNID2ᚕstringᚄ)
+	if err != nil {
+		return nil, err
+	}
+	args["ids"] = arg0
+	return args, nil
+}
+
 func (ec *executionContext) field___Directive_args_args(ctx context.Context, rawArgs map[string]any) (map[string]any, error) {
 	var err error
 	args := map[string]any{}
@@ -625,6 +819,10 @@ func (ec *executionContext) fieldContext_Mutation_addProduct(ctx context.Context
 				return ec.fieldContext_Product_description(ctx, field)
 			case "stock":
 				return ec.fieldContext_Product_stock(ctx, field)
+			case "reserved":
+				return ec.fieldContext_Product_reserved(ctx, field)
+			case "available":
+				return ec.fieldContext_Product_available(ctx, field)
 			case "sellerId":
 				return ec.fieldContext_Product_sellerId(ctx, field)
 			case "imageUrl":
@@ -635,6 +833,8 @@ func (ec *executionContext) fieldContext_Mutation_addProduct(ctx context.Context
 				return ec.fieldContext_Product_createdAt(ctx, field)
 			case "updatedAt":
 				return ec.fieldContext_Product_updatedAt(ctx, field)
+			case "version":
+				return ec.fieldContext_Product_version(ctx, field)
 			}
 			return nil, fmt.Errorf("no field named %q was found under type Product", field.Name)
 		},
@@ -688,6 +888,10 @@ func (ec *executionContext) fieldContext_Mutation_editProduct(ctx context.Contex
 				return ec.fieldContext_Product_description(ctx, field)
 			case "stock":
 				return ec.fieldContext_Product_stock(ctx, field)
+			case "reserved":
+				return ec.fieldContext_Product_reserved(ctx, field)
+			case "available":
+				return ec.fieldContext_Product_available(ctx, field)
 			case "sellerId":
 				return ec.fieldContext_Product_sellerId(ctx, field)
 			case "imageUrl":
@@ -698,6 +902,8 @@ func (ec *executionContext) fieldContext_Mutation_editProduct(ctx context.Contex
 				return ec.fieldContext_Product_createdAt(ctx, field)
 			case "updatedAt":
 				return ec.fieldContext_Product_updatedAt(ctx, field)
+			case "version":
+				return ec.fieldContext_Product_version(ctx, field)
 			}
 			return nil, fmt.Errorf("no field named %q was found under type Product", field.Name)
 		},
@@ -771,6 +977,104 @@ func (ec *executionContext) fieldContext_Mutation_addReview(ctx context.Context,
 	return fc, nil
 }
 
+func (ec *executionContext) _Mutation_reserveStock(ctx context.Context, field graphql.CollectedField) (ret graphql.Marshaler) {
+	return graphql.ResolveField(
+		ctx,
+		ec.OperationContext,
+		field,
+		ec.fieldContext_Mutation_reserveStock,
+		func(ctx context.Context) (any, error) {
+			fc := graphql.GetFieldContext(ctx)
+			return ec.resolvers.Mutation().ReserveStock(ctx, fc.Args["reservationId"].(string), fc.Args["items"].([]*model.StockItemInput))
+		},
+		nil,
+		ec.marshalNReservation2ᚖproduct_serviceᚋgraphᚋmodelᚐReservation,
+		true,
+		true,
+	)
+}
+
+func (ec *executionContext) fieldContext_Mutation_reserveStock(ctx context.Context, field graphql.CollectedField) (fc *graphql.FieldContext, err error) {
+	fc = &graphql.FieldContext{
+		Object:     "Mutation",
+		Field:      field,
+		IsMethod:   true,
+		IsResolver: true,
+		Child: func(ctx context.Context, field graphql.CollectedField) (*graphql.FieldContext, error) {
+			switch field.Name {
+			case "reservationId":
+				return ec.fieldContext_Reservation_reservationId(ctx, field)
+			case "expiresAt":
+				return ec.fieldContext_Reservation_expiresAt(ctx, field)
+			case "items":
+				return ec.fieldContext_Reservation_items(ctx, field)
+			}
+			return nil, fmt.Errorf("no field named %q was found under type Reservation", field.Name)
+		},
+	}
+	defer func() {
+		if r := recover(); r != nil {
+			err = ec.Recover(ctx, r)
+			ec.Error(ctx, err)
+		}
+	}()
+	ctx = graphql.WithFieldContext(ctx, fc)
+	if fc.Args, err = ec.field_Mutation_reserveStock_args(ctx, field.ArgumentMap(ec.Variables)); err != nil {
+		ec.Error(ctx, err)
+		return fc, err
+	}
+	return fc, nil
+}
+
+func (ec *executionContext) _Mutation_releaseReservation(ctx context.Context, field graphql.CollectedField) (ret graphql.Marshaler) {
+	return graphql.ResolveField(
+		ctx,
+		ec.OperationContext,
+		field,
+		ec.fieldContext_Mutation_releaseReservation,
+		func(ctx context.Context) (any, error) {
+			fc := graphql.GetFieldContext(ctx)
+			return ec.resolvers.Mutation().ReleaseReservation(ctx, fc.Args["reservationId"].(string))
+		},
+		nil,
+		ec.marshalNReservation2ᚖproduct_serviceᚋgraphᚋmodelᚐReservation,
+		true,
+		true,
+	)
+}
+
+func (ec *executionContext) fieldContext_Mutation_releaseReservation(ctx context.Context, field graphql.CollectedField) (fc *graphql.FieldContext, err error) {
+	fc = &graphql.FieldContext{
+		Object:     "Mutation",
+		Field:      field,
+		IsMethod:   true,
+		IsResolver: true,
+		Child: func(ctx context.Context, field graphql.CollectedField) (*graphql.FieldContext, error) {
+			switch field.Name {
+			case "reservationId":
+				return ec.fieldContext_Reservation_reservationId(ctx, field)
+			case "expiresAt":
+				return ec.fieldContext_Reservation_expiresAt(ctx, field)
+			case "items":
+				return ec.fieldContext_Reservation_items(ctx, field)
+			}
+			return nil, fmt.Errorf("no field named %q was found under type Reservation", field.Name)
+		},
+	}
+	defer func() {
+		if r := recover(); r != nil {
+			err = ec.Recover(ctx, r)
+			ec.Error(ctx, err)
+		}
+	}()
+	ctx = graphql.WithFieldContext(ctx, fc)
+	if fc.Args, err = ec.field_Mutation_releaseReservation_args(ctx, field.ArgumentMap(ec.Variables)); err != nil {
+		ec.Error(ctx, err)
+		return fc, err
+	}
+	return fc, nil
+}
+
 func (ec *executionContext) _Product_productId(ctx context.Context, field graphql.CollectedField, obj *model.Product) (ret graphql.Marshaler) {
 	return graphql.ResolveField(
 		ctx,
@@ -839,7 +1143,7 @@ func (ec *executionContext) _Product_price(ctx context.Context, field graphql.Co
 			return obj.Price, nil
 		},
 		nil,
-		ec.marshalNFloat2float64,
+		ec.marshalNMoney2product_serviceᚋgraphᚋmodelᚐMoney,
 		true,
 		true,
 	)
@@ -852,7 +1156,7 @@ func (ec *executionContext) fieldContext_Product_price(_ context.Context, field
 		IsMethod:   false,
 		IsResolver: false,
 		Child: func(ctx context.Context, field graphql.CollectedField) (*graphql.FieldContext, error) {
-			return nil, errors.New("field of type Float does not have child fields")
+			return nil, errors.New("field of type Money does not have child fields")
 		},
 	}
 	return fc, nil
@@ -916,6 +1220,64 @@ func (ec *executionContext) fieldContext_Product_stock(_ context.Context, field
 	return fc, nil
 }
 
+func (ec *executionContext) _Product_reserved(ctx context.Context, field graphql.CollectedField, obj *model.Product) (ret graphql.Marshaler) {
+	return graphql.ResolveField(
+		ctx,
+		ec.OperationContext,
+		field,
+		ec.fieldContext_Product_reserved,
+		func(ctx context.Context) (any, error) {
+			return obj.Reserved, nil
+		},
+		nil,
+		ec.marshalNInt2int,
+		true,
+		true,
+	)
+}
+
+func (ec *executionContext) fieldContext_Product_reserved(_ context.Context, field graphql.CollectedField) (fc *graphql.FieldContext, err error) {
+	fc = &graphql.FieldContext{
+		Object:     "Product",
+		Field:      field,
+		IsMethod:   false,
+		IsResolver: false,
+		Child: func(ctx context.Context, field graphql.CollectedField) (*graphql.FieldContext, error) {
+			return nil, errors.New("field of type Int does not have child fields")
+		},
+	}
+	return fc, nil
+}
+
+func (ec *executionContext) _Product_available(ctx context.Context, field graphql.CollectedField, obj *model.Product) (ret graphql.Marshaler) {
+	return graphql.ResolveField(
+		ctx,
+		ec.OperationContext,
+		field,
+		ec.fieldContext_Product_available,
+		func(ctx context.Context) (any, error) {
+			return obj.Available, nil
+		},
+		nil,
+		ec.marshalNInt2int,
+		true,
+		true,
+	)
+}
+
+func (ec *executionContext) fieldContext_Product_available(_ context.Context, field graphql.CollectedField) (fc *graphql.FieldContext, err error) {
+	fc = &graphql.FieldContext{
+		Object:     "Product",
+		Field:      field,
+		IsMethod:   false,
+		IsResolver: false,
+		Child: func(ctx context.Context, field graphql.CollectedField) (*graphql.FieldContext, error) {
+			return nil, errors.New("field of type Int does not have child fields")
+		},
+	}
+	return fc, nil
+}
+
 func (ec *executionContext) _Product_sellerId(ctx context.Context, field graphql.CollectedField, obj *model.Product) (ret graphql.Marshaler) {
 	return graphql.ResolveField(
 		ctx,
@@ -1075,6 +1437,35 @@ func (ec *executionContext) fieldContext_Product_updatedAt(_ context.Context, fi
 	return fc, nil
 }
 
+func (ec *executionContext) _Product_version(ctx context.Context, field graphql.CollectedField, obj *model.Product) (ret graphql.Marshaler) {
+	return graphql.ResolveField(
+		ctx,
+		ec.OperationContext,
+		field,
+		ec.fieldContext_Product_version,
+		func(ctx context.Context) (any, error) {
+			return obj.Version, nil
+		},
+		nil,
+		ec.marshalNInt2int,
+		true,
+		true,
+	)
+}
+
+func (ec *executionContext) fieldContext_Product_version(_ context.Context, field graphql.CollectedField) (fc *graphql.FieldContext, err error) {
+	fc = &graphql.FieldContext{
+		Object:     "Product",
+		Field:      field,
+		IsMethod:   false,
+		IsResolver: false,
+		Child: func(ctx context.Context, field graphql.CollectedField) (*graphql.FieldContext, error) {
+			return nil, errors.New("field of type Int does not have child fields")
+		},
+	}
+	return fc, nil
+}
+
 func (ec *executionContext) _Query_getProductById(ctx context.Context, field graphql.CollectedField) (ret graphql.Marshaler) {
 	return graphql.ResolveField(
 		ctx,
@@ -1110,6 +1501,10 @@ func (ec *executionContext) fieldContext_Query_getProductById(ctx context.Contex
 				return ec.fieldContext_Product_description(ctx, field)
 			case "stock":
 				return ec.fieldContext_Product_stock(ctx, field)
+			case "reserved":
+				return ec.fieldContext_Product_reserved(ctx, field)
+			case "available":
+				return ec.fieldContext_Product_available(ctx, field)
 			case "sellerId":
 				return ec.fieldContext_Product_sellerId(ctx, field)
 			case "imageUrl":
@@ -1120,6 +1515,8 @@ func (ec *executionContext) fieldContext_Query_getProductById(ctx context.Contex
 				return ec.fieldContext_Product_createdAt(ctx, field)
 			case "updatedAt":
 				return ec.fieldContext_Product_updatedAt(ctx, field)
+			case "version":
+				return ec.fieldContext_Product_version(ctx, field)
 			}
 			return nil, fmt.Errorf("no field named %q was found under type Product", field.Name)
 		},
@@ -1138,24 +1535,24 @@ func (ec *executionContext) fieldContext_Query_getProductById(ctx context.Contex
 	return fc, nil
 }
 
-func (ec *executionContext) _Query_getAllProducts(ctx context.Context, field graphql.CollectedField) (ret graphql.Marshaler) {
+func (ec *executionContext) _Query_getProductsByIds(ctx context.Context, field graphql.CollectedField) (ret graphql.Marshaler) {
 	return graphql.ResolveField(
 		ctx,
 		ec.OperationContext,
 		field,
-		ec.fieldContext_Query_getAllProducts,
+		ec.fieldContext_Query_getProductsByIds,
 		func(ctx context.Context) (any, error) {
 			fc := graphql.GetFieldContext(ctx)
-			return ec.resolvers.Query().GetAllProducts(ctx, fc.Args["filter"].(*model.ProductFilter))
+			return ec.resolvers.Query().GetProductsByIDs(ctx, fc.Args["ids"].([]string))
 		},
 		nil,
-		ec.marshalNProduct2ᚕᚖproduct_serviceᚋgraphᚋmodelᚐProductᚄ,
+		ec.marshalNProduct2ᚕᚖproduct_serviceᚋgraphᚋmodelᚐProduct,
 		true,
 		true,
 	)
 }
 
-func (ec *executionContext) fieldContext_Query_getAllProducts(ctx context.Context, field graphql.CollectedField) (fc *graphql.FieldContext, err error) {
+func (ec *executionContext) fieldContext_Query_getProductsByIds(ctx context.Context, field graphql.CollectedField) (fc *graphql.FieldContext, err error) {
 	fc = &graphql.FieldContext{
 		Object:     "Query",
 		Field:      field,
@@ -1173,6 +1570,10 @@ func (ec *executionContext) fieldContext_Query_getAllProducts(ctx context.Contex
 				return ec.fieldContext_Product_description(ctx, field)
 			case "stock":
 				return ec.fieldContext_Product_stock(ctx, field)
+			case "reserved":
+				return ec.fieldContext_Product_reserved(ctx, field)
+			case "available":
+				return ec.fieldContext_Product_available(ctx, field)
 			case "sellerId":
 				return ec.fieldContext_Product_sellerId(ctx, field)
 			case "imageUrl":
@@ -1183,6 +1584,8 @@ func (ec *executionContext) fieldContext_Query_getAllProducts(ctx context.Contex
 				return ec.fieldContext_Product_createdAt(ctx, field)
 			case "updatedAt":
 				return ec.fieldContext_Product_updatedAt(ctx, field)
+			case "version":
+				return ec.fieldContext_Product_version(ctx, field)
 			}
 			return nil, fmt.Errorf("no field named %q was found under type Product", field.Name)
 		},
@@ -1194,24 +1597,93 @@ func (ec *executionContext) fieldContext_Query_getAllProducts(ctx context.Contex
 		}
 	}()
 	ctx = graphql.WithFieldContext(ctx, fc)
-	if fc.Args, err = ec.field_Query_getAllProducts_args(ctx, field.ArgumentMap(ec.Variables)); err != nil {
+	if fc.Args, err = ec.field_Query_getProductsByIds_args(ctx, field.ArgumentMap(ec.Variables)); err != nil {
 		ec.Error(ctx, err)
 		return fc, err
 	}
 	return fc, nil
 }
 
-func (ec *executionContext) _Query_health(ctx context.Context, field graphql.CollectedField) (ret graphql.Marshaler) {
+func (ec *executionContext) _Query_getAllProducts(ctx context.Context, field graphql.CollectedField) (ret graphql.Marshaler) {
 	return graphql.ResolveField(
 		ctx,
 		ec.OperationContext,
 		field,
-		ec.fieldContext_Query_health,
+		ec.fieldContext_Query_getAllProducts,
 		func(ctx context.Context) (any, error) {
-			return ec.resolvers.Query().Health(ctx)
+			fc := graphql.GetFieldContext(ctx)
+			return ec.resolvers.Query().GetAllProducts(ctx, fc.Args["filter"].(*model.ProductFilter))
 		},
 		nil,
-		ec.marshalNString2string,
+		ec.marshalNProduct2ᚕᚖproduct_serviceᚋgraphᚋmodelᚐProductᚄ,
+		true,
+		true,
+	)
+}
+
+func (ec *executionContext) fieldContext_Query_getAllProducts(ctx context.Context, field graphql.CollectedField) (fc *graphql.FieldContext, err error) {
+	fc = &graphql.FieldContext{
+		Object:     "Query",
+		Field:      field,
+		IsMethod:   true,
+		IsResolver: true,
+		Child: func(ctx context.Context, field graphql.CollectedField) (*graphql.FieldContext, error) {
+			switch field.Name {
+			case "productId":
+				return ec.fieldContext_Product_productId(ctx, field)
+			case "name":
+				return ec.fieldContext_Product_name(ctx, field)
+			case "price":
+				return ec.fieldContext_Product_price(ctx, field)
+			case "description":
+				return ec.fieldContext_Product_description(ctx, field)
+			case "stock":
+				return ec.fieldContext_Product_stock(ctx, field)
+			case "reserved":
+				return ec.fieldContext_Product_reserved(ctx, field)
+			case "available":
+				return ec.fieldContext_Product_available(ctx, field)
+			case "sellerId":
+				return ec.fieldContext_Product_sellerId(ctx, field)
+			case "imageUrl":
+				return ec.fieldContext_Product_imageUrl(ctx, field)
+			case "reviews":
+				return ec.fieldContext_Product_reviews(ctx, field)
+			case "createdAt":
+				return ec.fieldContext_Product_createdAt(ctx, field)
+			case "updatedAt":
+				return ec.fieldContext_Product_updatedAt(ctx, field)
+			case "version":
+				return ec.fieldContext_Product_version(ctx, field)
+			}
+			return nil, fmt.Errorf("no field named %q was found under type Product", field.Name)
+		},
+	}
+	defer func() {
+		if r := recover(); r != nil {
+			err = ec.Recover(ctx, r)
+			ec.Error(ctx, err)
+		}
+	}()
+	ctx = graphql.WithFieldContext(ctx, fc)
+	if fc.Args, err = ec.field_Query_getAllProducts_args(ctx, field.ArgumentMap(ec.Variables)); err != nil {
+		ec.Error(ctx, err)
+		return fc, err
+	}
+	return fc, nil
+}
+
+func (ec *executionContext) _Query_health(ctx context.Context, field graphql.CollectedField) (ret graphql.Marshaler) {
+	return graphql.ResolveField(
+		ctx,
+		ec.OperationContext,
+		field,
+		ec.fieldContext_Query_health,
+		func(ctx context.Context) (any, error) {
+			return ec.resolvers.Query().Health(ctx)
+		},
+		nil,
+		ec.marshalNString2string,
 		true,
 		true,
 	)
@@ -1338,6 +1810,188 @@ func (ec *executionContext) fieldContext_Query___schema(_ context.Context, field
 	return fc, nil
 }
 
+func (ec *executionContext) _Reservation_reservationId(ctx context.Context, field graphql.CollectedField, obj *model.Reservation) (ret graphql.Marshaler) {
+	return graphql.ResolveField(
+		ctx,
+		ec.OperationContext,
+		field,
+		ec.fieldContext_Reservation_reservationId,
+		func(ctx context.Context) (any, error) {
+			return obj.ReservationID, nil
+		},
+		nil,
+		ec.marshalNID2string,
+		true,
+		true,
+	)
+}
+
+func (ec *executionContext) fieldContext_Reservation_reservationId(_ context.Context, field graphql.CollectedField) (fc *graphql.FieldContext, err error) {
+	fc = &graphql.FieldContext{
+		Object:     "Reservation",
+		Field:      field,
+		IsMethod:   false,
+		IsResolver: false,
+		Child: func(ctx context.Context, field graphql.CollectedField) (*graphql.FieldContext, error) {
+			return nil, errors.New("field of type ID does not have child fields")
+		},
+	}
+	return fc, nil
+}
+
+func (ec *executionContext) _Reservation_expiresAt(ctx context.Context, field graphql.CollectedField, obj *model.Reservation) (ret graphql.Marshaler) {
+	return graphql.ResolveField(
+		ctx,
+		ec.OperationContext,
+		field,
+		ec.fieldContext_Reservation_expiresAt,
+		func(ctx context.Context) (any, error) {
+			return obj.ExpiresAt, nil
+		},
+		nil,
+		ec.marshalNString2string,
+		true,
+		true,
+	)
+}
+
+func (ec *executionContext) fieldContext_Reservation_expiresAt(_ context.Context, field graphql.CollectedField) (fc *graphql.FieldContext, err error) {
+	fc = &graphql.FieldContext{
+		Object:     "Reservation",
+		Field:      field,
+		IsMethod:   false,
+		IsResolver: false,
+		Child: func(ctx context.Context, field graphql.CollectedField) (*graphql.FieldContext, error) {
+			return nil, errors.New("field of type String does not have child fields")
+		},
+	}
+	return fc, nil
+}
+
+func (ec *executionContext) _Reservation_items(ctx context.Context, field graphql.CollectedField, obj *model.Reservation) (ret graphql.Marshaler) {
+	return graphql.ResolveField(
+		ctx,
+		ec.OperationContext,
+		field,
+		ec.fieldContext_Reservation_items,
+		func(ctx context.Context) (any, error) {
+			return obj.Items, nil
+		},
+		nil,
+		ec.marshalNReservationItem2ᚕᚖproduct_serviceᚋgraphᚋmodelᚐReservationItemᚄ,
+		true,
+		true,
+	)
+}
+
+func (ec *executionContext) fieldContext_Reservation_items(_ context.Context, field graphql.CollectedField) (fc *graphql.FieldContext, err error) {
+	fc = &graphql.FieldContext{
+		Object:     "Reservation",
+		Field:      field,
+		IsMethod:   false,
+		IsResolver: false,
+		Child: func(ctx context.Context, field graphql.CollectedField) (*graphql.FieldContext, error) {
+			switch field.Name {
+			case "productId":
+				return ec.fieldContext_ReservationItem_productId(ctx, field)
+			case "quantity":
+				return ec.fieldContext_ReservationItem_quantity(ctx, field)
+			case "status":
+				return ec.fieldContext_ReservationItem_status(ctx, field)
+			}
+			return nil, fmt.Errorf("no field named %q was found under type ReservationItem", field.Name)
+		},
+	}
+	return fc, nil
+}
+
+func (ec *executionContext) _ReservationItem_productId(ctx context.Context, field graphql.CollectedField, obj *model.ReservationItem) (ret graphql.Marshaler) {
+	return graphql.ResolveField(
+		ctx,
+		ec.OperationContext,
+		field,
+		ec.fieldContext_ReservationItem_productId,
+		func(ctx context.Context) (any, error) {
+			return obj.ProductID, nil
+		},
+		nil,
+		ec.marshalNID2string,
+		true,
+		true,
+	)
+}
+
+func (ec *executionContext) fieldContext_ReservationItem_productId(_ context.Context, field graphql.CollectedField) (fc *graphql.FieldContext, err error) {
+	fc = &graphql.FieldContext{
+		Object:     "ReservationItem",
+		Field:      field,
+		IsMethod:   false,
+		IsResolver: false,
+		Child: func(ctx context.Context, field graphql.CollectedField) (*graphql.FieldContext, error) {
+			return nil, errors.New("field of type ID does not have child fields")
+		},
+	}
+	return fc, nil
+}
+
+func (ec *executionContext) _ReservationItem_quantity(ctx context.Context, field graphql.CollectedField, obj *model.ReservationItem) (ret graphql.Marshaler) {
+	return graphql.ResolveField(
+		ctx,
+		ec.OperationContext,
+		field,
+		ec.fieldContext_ReservationItem_quantity,
+		func(ctx context.Context) (any, error) {
+			return obj.Quantity, nil
+		},
+		nil,
+		ec.marshalNInt2int,
+		true,
+		true,
+	)
+}
+
+func (ec *executionContext) fieldContext_ReservationItem_quantity(_ context.Context, field graphql.CollectedField) (fc *graphql.FieldContext, err error) {
+	fc = &graphql.FieldContext{
+		Object:     "ReservationItem",
+		Field:      field,
+		IsMethod:   false,
+		IsResolver: false,
+		Child: func(ctx context.Context, field graphql.CollectedField) (*graphql.FieldContext, error) {
+			return nil, errors.New("field of type Int does not have child fields")
+		},
+	}
+	return fc, nil
+}
+
+func (ec *executionContext) _ReservationItem_status(ctx context.Context, field graphql.CollectedField, obj *model.ReservationItem) (ret graphql.Marshaler) {
+	return graphql.ResolveField(
+		ctx,
+		ec.OperationContext,
+		field,
+		ec.fieldContext_ReservationItem_status,
+		func(ctx context.Context) (any, error) {
+			return obj.Status, nil
+		},
+		nil,
+		ec.marshalNString2string,
+		true,
+		true,
+	)
+}
+
+func (ec *executionContext) fieldContext_ReservationItem_status(_ context.Context, field graphql.CollectedField) (fc *graphql.FieldContext, err error) {
+	fc = &graphql.FieldContext{
+		Object:     "ReservationItem",
+		Field:      field,
+		IsMethod:   false,
+		IsResolver: false,
+		Child: func(ctx context.Context, field graphql.CollectedField) (*graphql.FieldContext, error) {
+			return nil, errors.New("field of type String does not have child fields")
+		},
+	}
+	return fc, nil
+}
+
 func (ec *executionContext) _Review_reviewId(ctx context.Context, field graphql.CollectedField, obj *model.Review) (ret graphql.Marshaler) {
 	return graphql.ResolveField(
 		ctx,
@@ -2981,7 +3635,7 @@ func (ec *executionContext) unmarshalInputAddProductInput(ctx context.Context, o
 			it.Name = data
 		case "price":
 			ctx := graphql.WithPathContext(ctx, graphql.NewPathWithField("price"))
-			data, err := ec.unmarshalNFloat2float64(ctx, v)
+			data, err := ec.unmarshalNMoney2product_serviceᚋgraphᚋmodelᚐMoney(ctx, v)
 			if err != nil {
 				return it, err
 			}
@@ -3075,7 +3729,7 @@ func (ec *executionContext) unmarshalInputEditProductInput(ctx context.Context,
 		asMap[k] = v
 	}
 
-	fieldsInOrder := [...]string{"productId", "name", "price", "description", "stock", "imageUrl"}
+	fieldsInOrder := [...]string{"productId", "name", "price", "description", "stock", "imageUrl", "expectedVersion"}
 	for _, k := range fieldsInOrder {
 		v, ok := asMap[k]
 		if !ok {
@@ -3098,7 +3752,7 @@ func (ec *executionContext) unmarshalInputEditProductInput(ctx context.Context,
 			it.Name = data
 		case "price":
 			ctx := graphql.WithPathContext(ctx, graphql.NewPathWithField("price"))
-			data, err := ec.unmarshalOFloat2ᚖfloat64(ctx, v)
+			data, err := ec.unmarshalOMoney2ᚖproduct_serviceᚋgraphᚋmodelᚐMoney(ctx, v)
 			if err != nil {
 				return it, err
 			}
@@ -3124,6 +3778,13 @@ func (ec *executionContext) unmarshalInputEditProductInput(ctx context.Context,
 				return it, err
 			}
 			it.ImageURL = data
+		case "expectedVersion":
+			ctx := graphql.WithPathContext(ctx, graphql.NewPathWithField("expectedVersion"))
+			data, err := ec.unmarshalOInt2ᚖint(ctx, v)
+			if err != nil {
+				return it, err
+			}
+			it.ExpectedVersion = data
 		}
 	}
 
@@ -3157,6 +3818,40 @@ func (ec *executionContext) unmarshalInputProductFilter(ctx context.Context, obj
 	return it, nil
 }
 
+func (ec *executionContext) unmarshalInputStockItemInput(ctx context.Context, obj any) (model.StockItemInput, error) {
+	var it model.StockItemInput
+	asMap := map[string]any{}
+	for k, v := range obj.(map[string]any) {
+		asMap[k] = v
+	}
+
+	fieldsInOrder := [...]string{"productId", "quantity"}
+	for _, k := range fieldsInOrder {
+		v, ok := asMap[k]
+		if !ok {
+			continue
+		}
+		switch k {
+		case "productId":
+			ctx := graphql.WithPathContext(ctx, graphql.NewPathWithField("productId"))
+			data, err := ec.unmarshalNID2string(ctx, v)
+			if err != nil {
+				return it, err
+			}
+			it.ProductID = data
+		case "quantity":
+			ctx := graphql.WithPathContext(ctx, graphql.NewPathWithField("quantity"))
+			data, err := ec.unmarshalNInt2int(ctx, v)
+			if err != nil {
+				return it, err
+			}
+			it.Quantity = data
+		}
+	}
+
+	return it, nil
+}
+
 // endregion **************************** input.gotpl *****************************
 
 // region    ************************** interface.gotpl ***************************
@@ -3205,6 +3900,20 @@ func (ec *executionContext) _Mutation(ctx context.Context, sel ast.SelectionSet)
 			if out.Values[i] == graphql.Null {
 				out.Invalids++
 			}
+		case "reserveStock":
+			out.Values[i] = ec.OperationContext.RootResolverMiddleware(innerCtx, func(ctx context.Context) (res graphql.Marshaler) {
+				return ec._Mutation_reserveStock(ctx, field)
+			})
+			if out.Values[i] == graphql.Null {
+				out.Invalids++
+			}
+		case "releaseReservation":
+			out.Values[i] = ec.OperationContext.RootResolverMiddleware(innerCtx, func(ctx context.Context) (res graphql.Marshaler) {
+				return ec._Mutation_releaseReservation(ctx, field)
+			})
+			if out.Values[i] == graphql.Null {
+				out.Invalids++
+			}
 		default:
 			panic("unknown field " + strconv.Quote(field.Name))
 		}
@@ -3261,6 +3970,16 @@ func (ec *executionContext) _Product(ctx context.Context, sel ast.SelectionSet,
 			if out.Values[i] == graphql.Null {
 				out.Invalids++
 			}
+		case "reserved":
+			out.Values[i] = ec._Product_reserved(ctx, field, obj)
+			if out.Values[i] == graphql.Null {
+				out.Invalids++
+			}
+		case "available":
+			out.Values[i] = ec._Product_available(ctx, field, obj)
+			if out.Values[i] == graphql.Null {
+				out.Invalids++
+			}
 		case "sellerId":
 			out.Values[i] = ec._Product_sellerId(ctx, field, obj)
 			if out.Values[i] == graphql.Null {
@@ -3277,6 +3996,11 @@ func (ec *executionContext) _Product(ctx context.Context, sel ast.SelectionSet,
 			out.Values[i] = ec._Product_createdAt(ctx, field, obj)
 		case "updatedAt":
 			out.Values[i] = ec._Product_updatedAt(ctx, field, obj)
+		case "version":
+			out.Values[i] = ec._Product_version(ctx, field, obj)
+			if out.Values[i] == graphql.Null {
+				out.Invalids++
+			}
 		default:
 			panic("unknown field " + strconv.Quote(field.Name))
 		}
@@ -3337,6 +4061,28 @@ func (ec *executionContext) _Query(ctx context.Context, sel ast.SelectionSet) gr
 					func(ctx context.Context) graphql.Marshaler { return innerFunc(ctx, out) })
 			}
 
+			out.Concurrently(i, func(ctx context.Context) graphql.Marshaler { return rrm(innerCtx) })
+		case "getProductsByIds":
+			field := field
+
+			innerFunc := func(ctx context.Context, fs *graphql.FieldSet) (res graphql.Marshaler) {
+				defer func() {
+					if r := recover(); r != nil {
+						ec.Error(ctx, ec.Recover(ctx, r))
+					}
+				}()
+				res = ec._Query_getProductsByIds(ctx, field)
+				if res == graphql.Null {
+					atomic.AddUint32(&fs.Invalids, 1)
+				}
+				return res
+			}
+
+			rrm := func(ctx context.Context) graphql.Marshaler {
+				return ec.OperationContext.RootResolverMiddleware(ctx,
+					func(ctx context.Context) graphql.Marshaler { return innerFunc(ctx, out) })
+			}
+
 			out.Concurrently(i, func(ctx context.Context) graphql.Marshaler { return rrm(innerCtx) })
 		case "getAllProducts":
 			field := field
@@ -3413,6 +4159,104 @@ func (ec *executionContext) _Query(ctx context.Context, sel ast.SelectionSet) gr
 	return out
 }
 
+var reservationImplementors = []string{"Reservation"}
+
+func (ec *executionContext) _Reservation(ctx context.Context, sel ast.SelectionSet, obj *model.Reservation) graphql.Marshaler {
+	fields := graphql.CollectFields(ec.OperationContext, sel, reservationImplementors)
+
+	out := graphql.NewFieldSet(fields)
+	deferred := make(map[string]*graphql.FieldSet)
+	for i, field := range fields {
+		switch field.Name {
+		case "__typename":
+			out.Values[i] = graphql.MarshalString("Reservation")
+		case "reservationId":
+			out.Values[i] = ec._Reservation_reservationId(ctx, field, obj)
+			if out.Values[i] == graphql.Null {
+				out.Invalids++
+			}
+		case "expiresAt":
+			out.Values[i] = ec._Reservation_expiresAt(ctx, field, obj)
+			if out.Values[i] == graphql.Null {
+				out.Invalids++
+			}
+		case "items":
+			out.Values[i] = ec._Reservation_items(ctx, field, obj)
+			if out.Values[i] == graphql.Null {
+				out.Invalids++
+			}
+		default:
+			panic("unknown field " + strconv.Quote(field.Name))
+		}
+	}
+	out.Dispatch(ctx)
+	if out.Invalids > 0 {
+		return graphql.Null
+	}
+
+	atomic.AddInt32(&ec.deferred, int32(len(deferred)))
+
+	for label, dfs := range deferred {
+		ec.processDeferredGroup(graphql.DeferredGroup{
+			Label:    label,
+			Path:     graphql.GetPath(ctx),
+			FieldSet: dfs,
+			Context:  ctx,
+		})
+	}
+
+	return out
+}
+
+var reservationItemImplementors = []string{"ReservationItem"}
+
+func (ec *executionContext) _ReservationItem(ctx context.Context, sel ast.SelectionSet, obj *model.ReservationItem) graphql.Marshaler {
+	fields := graphql.CollectFields(ec.OperationContext, sel, reservationItemImplementors)
+
+	out := graphql.NewFieldSet(fields)
+	deferred := make(map[string]*graphql.FieldSet)
+	for i, field := range fields {
+		switch field.Name {
+		case "__typename":
+			out.Values[i] = graphql.MarshalString("ReservationItem")
+		case "productId":
+			out.Values[i] = ec._ReservationItem_productId(ctx, field, obj)
+			if out.Values[i] == graphql.Null {
+				out.Invalids++
+			}
+		case "quantity":
+			out.Values[i] = ec._ReservationItem_quantity(ctx, field, obj)
+			if out.Values[i] == graphql.Null {
+				out.Invalids++
+			}
+		case "status":
+			out.Values[i] = ec._ReservationItem_status(ctx, field, obj)
+			if out.Values[i] == graphql.Null {
+				out.Invalids++
+			}
+		default:
+			panic("unknown field " + strconv.Quote(field.Name))
+		}
+	}
+	out.Dispatch(ctx)
+	if out.Invalids > 0 {
+		return graphql.Null
+	}
+
+	atomic.AddInt32(&ec.deferred, int32(len(deferred)))
+
+	for label, dfs := range deferred {
+		ec.processDeferredGroup(graphql.DeferredGroup{
+			Label:    label,
+			Path:     graphql.GetPath(ctx),
+			FieldSet: dfs,
+			Context:  ctx,
+		})
+	}
+
+	return out
+}
+
 var reviewImplementors = []string{"Review"}
 
 func (ec *executionContext) _Review(ctx context.Context, sel ast.SelectionSet, obj *model.Review) graphql.Marshaler {
@@ -3831,25 +4675,24 @@ func (ec *executionContext) unmarshalNEditProductInput2product_serviceᚋgraph
 	return res, graphql.ErrorOnPath(ctx, err)
 }
 
-func (ec *executionContext) unmarshalNFloat2float64(ctx context.Context, v any) (float64, error) {
-	res, err := graphql.UnmarshalFloatContext(ctx, v)
+func (ec *executionContext) unmarshalNID2string(ctx context.Context, v any) (string, error) {
+	res, err := graphql.UnmarshalID(v)
 	return res, graphql.ErrorOnPath(ctx, err)
 }
 
-func (ec *executionContext) marshalNFloat2float64(ctx context.Context, sel ast.SelectionSet, v float64) graphql.Marshaler {
-	_ = sel
-	res := graphql.MarshalFloatContext(v)
-	if res == graphql.Null {
-		if !graphql.HasFieldError(ctx, graphql.GetFieldContext(ctx)) {
-			graphql.AddErrorf(ctx, "the requested element is null which the schema does not allow")
+func (ec *executionContext) unmarshalNID2ᚕstringᚄ(ctx context.Context, v any) ([]string, error) {
+	var vSlice []any
+	vSlice = graphql.CoerceList(v)
+	var err error
+	res := make([]string, len(vSlice))
+	for i := range vSlice {
+		ctx := graphql.WithPathContext(ctx, graphql.NewPathWithIndex(i))
+		res[i], err = ec.unmarshalNID2string(ctx, vSlice[i])
+		if err != nil {
+			return nil, err
 		}
 	}
-	return graphql.WrapContextMarshaler(ctx, res)
-}
-
-func (ec *executionContext) unmarshalNID2string(ctx context.Context, v any) (string, error) {
-	res, err := graphql.UnmarshalID(v)
-	return res, graphql.ErrorOnPath(ctx, err)
+	return res, nil
 }
 
 func (ec *executionContext) marshalNID2string(ctx context.Context, sel ast.SelectionSet, v string) graphql.Marshaler {
@@ -3879,10 +4722,58 @@ func (ec *executionContext) marshalNInt2int(ctx context.Context, sel ast.Selecti
 	return res
 }
 
+func (ec *executionContext) unmarshalNMoney2product_serviceᚋgraphᚋmodelᚐMoney(ctx context.Context, v any) (model.Money, error) {
+	var res model.Money
+	err := res.UnmarshalGQL(v)
+	return res, graphql.ErrorOnPath(ctx, err)
+}
+
+func (ec *executionContext) marshalNMoney2product_serviceᚋgraphᚋmodelᚐMoney(ctx context.Context, sel ast.SelectionSet, v model.Money) graphql.Marshaler {
+	return v
+}
+
 func (ec *executionContext) marshalNProduct2product_serviceᚋgraphᚋmodelᚐProduct(ctx context.Context, sel ast.SelectionSet, v model.Product) graphql.Marshaler {
 	return ec._Product(ctx, sel, &v)
 }
 
+func (ec *executionContext) marshalNProduct2ᚕᚖproduct_serviceᚋgraphᚋmodelᚐProduct(ctx context.Context, sel ast.SelectionSet, v []*model.Product) graphql.Marshaler {
+	ret := make(graphql.Array, len(v))
+	var wg sync.WaitGroup
+	isLen1 := len(v) == 1
+	if !isLen1 {
+		wg.Add(len(v))
+	}
+	for i := range v {
+		i := i
+		fc := &graphql.FieldContext{
+			Index:  &i,
+			Result: &v[i],
+		}
+		ctx := graphql.WithFieldContext(ctx, fc)
+		f := func(i int) {
+			defer func() {
+				if r := recover(); r != nil {
+					ec.Error(ctx, ec.Recover(ctx, r))
+					ret = nil
+				}
+			}()
+			if !isLen1 {
+				defer wg.Done()
+			}
+			ret[i] = ec.marshalOProduct2ᚖproduct_serviceᚋgraphᚋmodelᚐProduct(ctx, sel, v[i])
+		}
+		if isLen1 {
+			f(i)
+		} else {
+			go f(i)
+		}
+
+	}
+	wg.Wait()
+
+	return ret
+}
+
 func (ec *executionContext) marshalNProduct2ᚕᚖproduct_serviceᚋgraphᚋmodelᚐProductᚄ(ctx context.Context, sel ast.SelectionSet, v []*model.Product) graphql.Marshaler {
 	ret := make(graphql.Array, len(v))
 	var wg sync.WaitGroup
@@ -3937,6 +4828,74 @@ func (ec *executionContext) marshalNProduct2ᚖproduct_serviceᚋgraphᚋmodel
 	return ec._Product(ctx, sel, v)
 }
 
+func (ec *executionContext) marshalNReservation2product_serviceᚋgraphᚋmodelᚐReservation(ctx context.Context, sel ast.SelectionSet, v model.Reservation) graphql.Marshaler {
+	return ec._Reservation(ctx, sel, &v)
+}
+
+func (ec *executionContext) marshalNReservation2ᚖproduct_serviceᚋgraphᚋmodelᚐReservation(ctx context.Context, sel ast.SelectionSet, v *model.Reservation) graphql.Marshaler {
+	if v == nil {
+		if !graphql.HasFieldError(ctx, graphql.GetFieldContext(ctx)) {
+			graphql.AddErrorf(ctx, "the requested element is null which the schema does not allow")
+		}
+		return graphql.Null
+	}
+	return ec._Reservation(ctx, sel, v)
+}
+
+func (ec *executionContext) marshalNReservationItem2ᚕᚖproduct_serviceᚋgraphᚋmodelᚐReservationItemᚄ(ctx context.Context, sel ast.SelectionSet, v []*model.ReservationItem) graphql.Marshaler {
+	ret := make(graphql.Array, len(v))
+	var wg sync.WaitGroup
+	isLen1 := len(v) == 1
+	if !isLen1 {
+		wg.Add(len(v))
+	}
+	for i := range v {
+		i := i
+		fc := &graphql.FieldContext{
+			Index:  &i,
+			Result: &v[i],
+		}
+		ctx := graphql.WithFieldContext(ctx, fc)
+		f := func(i int) {
+			defer func() {
+				if r := recover(); r != nil {
+					ec.Error(ctx, ec.Recover(ctx, r))
+					ret = nil
+				}
+			}()
+			if !isLen1 {
+				defer wg.Done()
+			}
+			ret[i] = ec.marshalNReservationItem2ᚖproduct_serviceᚋgraphᚋmodelᚐReservationItem(ctx, sel, v[i])
+		}
+		if isLen1 {
+			f(i)
+		} else {
+			go f(i)
+		}
+
+	}
+	wg.Wait()
+
+	for _, e := range ret {
+		if e == graphql.Null {
+			return graphql.Null
+		}
+	}
+
+	return ret
+}
+
+func (ec *executionContext) marshalNReservationItem2ᚖproduct_serviceᚋgraphᚋmodelᚐReservationItem(ctx context.Context, sel ast.SelectionSet, v *model.ReservationItem) graphql.Marshaler {
+	if v == nil {
+		if !graphql.HasFieldError(ctx, graphql.GetFieldContext(ctx)) {
+			graphql.AddErrorf(ctx, "the requested element is null which the schema does not allow")
+		}
+		return graphql.Null
+	}
+	return ec._ReservationItem(ctx, sel, v)
+}
+
 func (ec *executionContext) marshalNReview2product_serviceᚋgraphᚋmodelᚐReview(ctx context.Context, sel ast.SelectionSet, v model.Review) graphql.Marshaler {
 	return ec._Review(ctx, sel, &v)
 }
@@ -3995,6 +4954,26 @@ func (ec *executionContext) marshalNReview2ᚖproduct_serviceᚋgraphᚋmodelᚐ
 	return ec._Review(ctx, sel, v)
 }
 
+func (ec *executionContext) unmarshalNStockItemInput2ᚕᚖproduct_serviceᚋgraphᚋmodelᚐStockItemInputᚄ(ctx context.Context, v any) ([]*model.StockItemInput, error) {
+	var vSlice []any
+	vSlice = graphql.CoerceList(v)
+	var err error
+	res := make([]*model.StockItemInput, len(vSlice))
+	for i := range vSlice {
+		ctx := graphql.WithPathContext(ctx, graphql.NewPathWithIndex(i))
+		res[i], err = ec.unmarshalNStockItemInput2ᚖproduct_serviceᚋgraphᚋmodelᚐStockItemInput(ctx, vSlice[i])
+		if err != nil {
+			return nil, err
+		}
+	}
+	return res, nil
+}
+
+func (ec *executionContext) unmarshalNStockItemInput2ᚖproduct_serviceᚋgraphᚋmodelᚐStockItemInput(ctx context.Context, v any) (*model.StockItemInput, error) {
+	res, err := ec.unmarshalInputStockItemInput(ctx, v)
+	return &res, graphql.ErrorOnPath(ctx, err)
+}
+
 func (ec *executionContext) unmarshalNString2string(ctx context.Context, v any) (string, error) {
 	res, err := graphql.UnmarshalString(v)
 	return res, graphql.ErrorOnPath(ctx, err)
@@ -4294,23 +5273,6 @@ func (ec *executionContext) marshalOBoolean2ᚖbool(ctx context.Context, sel ast
 	return res
 }
 
-func (ec *executionContext) unmarshalOFloat2ᚖfloat64(ctx context.Context, v any) (*float64, error) {
-	if v == nil {
-		return nil, nil
-	}
-	res, err := graphql.UnmarshalFloatContext(ctx, v)
-	return &res, graphql.ErrorOnPath(ctx, err)
-}
-
-func (ec *executionContext) marshalOFloat2ᚖfloat64(ctx context.Context, sel ast.SelectionSet, v *float64) graphql.Marshaler {
-	if v == nil {
-		return graphql.Null
-	}
-	_ = sel
-	res := graphql.MarshalFloatContext(*v)
-	return graphql.WrapContextMarshaler(ctx, res)
-}
-
 func (ec *executionContext) unmarshalOInt2ᚖint(ctx context.Context, v any) (*int, error) {
 	if v == nil {
 		return nil, nil
@@ -4329,6 +5291,15 @@ func (ec *executionContext) marshalOInt2ᚖint(ctx context.Context, sel ast.Sele
 	return res
 }
 
+func (ec *executionContext) unmarshalOMoney2ᚖproduct_serviceᚋgraphᚋmodelᚐMoney(ctx context.Context, v any) (*model.Money, error) {
+	if v == nil {
+		return nil, nil
+	}
+	var res = new(model.Money)
+	err := res.UnmarshalGQL(v)
+	return res, graphql.ErrorOnPath(ctx, err)
+}
+
 func (ec *executionContext) marshalOProduct2ᚖproduct_serviceᚋgraphᚋmodelᚐProduct(ctx context.Context, sel ast.SelectionSet, v *model.Product) graphql.Marshaler {
 	if v == nil {
 		return graphql.Null
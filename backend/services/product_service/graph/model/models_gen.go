@@ -4,7 +4,7 @@ package model
 
 type AddProductInput struct {
 	Name        string  `json:"name"`
-	Price       float64 `json:"price"`
+	Price       Money   `json:"price"`
 	Description *string `json:"description,omitempty"`
 	Stock       int     `json:"stock"`
 	SellerID    string  `json:"sellerId"`
@@ -19,12 +19,13 @@ type AddReviewInput struct {
 }
 
 type EditProductInput struct {
-	ProductID   string   `json:"productId"`
-	Name        *string  `json:"name,omitempty"`
-	Price       *float64 `json:"price,omitempty"`
-	Description *string  `json:"description,omitempty"`
-	Stock       *int     `json:"stock,omitempty"`
-	ImageURL    *string  `json:"imageUrl,omitempty"`
+	ProductID       string  `json:"productId"`
+	Name            *string `json:"name,omitempty"`
+	Price           *Money  `json:"price,omitempty"`
+	Description     *string `json:"description,omitempty"`
+	Stock           *int    `json:"stock,omitempty"`
+	ImageURL        *string `json:"imageUrl,omitempty"`
+	ExpectedVersion *int    `json:"expectedVersion,omitempty"`
 }
 
 type Mutation struct {
@@ -33,14 +34,17 @@ type Mutation struct {
 type Product struct {
 	ProductID   string    `json:"productId"`
 	Name        string    `json:"name"`
-	Price       float64   `json:"price"`
+	Price       Money     `json:"price"`
 	Description *string   `json:"description,omitempty"`
 	Stock       int       `json:"stock"`
+	Reserved    int       `json:"reserved"`
+	Available   int       `json:"available"`
 	SellerID    string    `json:"sellerId"`
 	ImageURL    *string   `json:"imageUrl,omitempty"`
 	Reviews     []*Review `json:"reviews"`
 	CreatedAt   *string   `json:"createdAt,omitempty"`
 	UpdatedAt   *string   `json:"updatedAt,omitempty"`
+	Version     int       `json:"version"`
 }
 
 type ProductFilter struct {
@@ -50,6 +54,18 @@ type ProductFilter struct {
 type Query struct {
 }
 
+type Reservation struct {
+	ReservationID string             `json:"reservationId"`
+	ExpiresAt     string             `json:"expiresAt"`
+	Items         []*ReservationItem `json:"items"`
+}
+
+type ReservationItem struct {
+	ProductID string `json:"productId"`
+	Quantity  int    `json:"quantity"`
+	Status    string `json:"status"`
+}
+
 type Review struct {
 	ReviewID  string  `json:"reviewId"`
 	ProductID string  `json:"productId"`
@@ -58,3 +74,8 @@ type Review struct {
 	UserID    *string `json:"userId,omitempty"`
 	CreatedAt *string `json:"createdAt,omitempty"`
 }
+
+type StockItemInput struct {
+	ProductID string `json:"productId"`
+	Quantity  int    `json:"quantity"`
+}
@@ -0,0 +1,183 @@
+package model
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"math"
+	"regexp"
+	"strconv"
+	"strings"
+)
+
+// Money is an exact amount: Amount minor units (cents) of the ISO 4217
+// Currency. It backs the GraphQL Money scalar, written as
+//
+//	{"amount": 1799700, "currency": "LKR"}
+//
+// OrderService and SellerService use the same JSON shape.
+type Money struct {
+	Amount   int64  `json:"amount"`
+	Currency string `json:"currency"`
+}
+
+// DefaultCurrency is assumed for amounts sent without a currency.
+var DefaultCurrency = "LKR"
+
+// currencyExponents lists the currencies whose minor unit is not a hundredth.
+var currencyExponents = map[string]int{
+	"BHD": 3, "JOD": 3, "KWD": 3, "OMR": 3, "TND": 3,
+	"JPY": 0, "KRW": 0, "VND": 0, "CLP": 0, "ISK": 0,
+}
+
+var currencyPattern = regexp.MustCompile(`^[A-Z]{3}$`)
+
+// CurrencyExponent returns the number of minor-unit digits of currency.
+func CurrencyExponent(currency string) int {
+	if exp, ok := currencyExponents[currency]; ok {
+		return exp
+	}
+	return 2
+}
+
+// NormalizeCurrency upper-cases an ISO 4217 code, defaulting to
+// DefaultCurrency when empty.
+func NormalizeCurrency(currency string) (string, error) {
+	currency = strings.ToUpper(strings.TrimSpace(currency))
+	if currency == "" {
+		return DefaultCurrency, nil
+	}
+	if !currencyPattern.MatchString(currency) {
+		return "", fmt.Errorf("invalid currency %q", currency)
+	}
+	return currency, nil
+}
+
+// ParseMoney parses a decimal amount in major units, such as "17997.5", without
+// going through float64. More fraction digits than the currency has are
+// rejected.
+func ParseMoney(decimal, currency string) (Money, error) {
+	currency, err := NormalizeCurrency(currency)
+	if err != nil {
+		return Money{}, err
+	}
+	exp := CurrencyExponent(currency)
+
+	s := strings.TrimSpace(decimal)
+	negative := strings.HasPrefix(s, "-")
+	s = strings.TrimPrefix(s, "-")
+
+	whole, fraction, _ := strings.Cut(s, ".")
+	if whole == "" {
+		whole = "0"
+	}
+	if len(fraction) > exp {
+		if strings.Trim(fraction[exp:], "0") != "" {
+			return Money{}, fmt.Errorf("amount %q has more than %d decimal places for %s", decimal, exp, currency)
+		}
+		fraction = fraction[:exp]
+	}
+	fraction += strings.Repeat("0", exp-len(fraction))
+
+	digits := whole + fraction
+	for _, r := range digits {
+		if r < '0' || r > '9' {
+			return Money{}, fmt.Errorf("invalid amount %q", decimal)
+		}
+	}
+
+	amount, err := strconv.ParseInt(digits, 10, 64)
+	if err != nil {
+		return Money{}, fmt.Errorf("invalid amount %q", decimal)
+	}
+	if negative {
+		amount = -amount
+	}
+	return Money{Amount: amount, Currency: currency}, nil
+}
+
+// Decimal formats the amount in major units, e.g. "17997.00".
+func (m Money) Decimal() string {
+	exp := CurrencyExponent(m.Currency)
+	sign := ""
+	amount := m.Amount
+	if amount < 0 {
+		sign = "-"
+		amount = -amount
+	}
+	if exp == 0 {
+		return sign + strconv.FormatInt(amount, 10)
+	}
+
+	unit := int64(math.Pow10(exp))
+	return fmt.Sprintf("%s%d.%0*d", sign, amount/unit, exp, amount%unit)
+}
+
+// String formats the amount with its currency, e.g. "LKR 17997.00".
+func (m Money) String() string {
+	return m.Currency + " " + m.Decimal()
+}
+
+// MarshalGQL implements graphql.Marshaler.
+func (m Money) MarshalGQL(w io.Writer) {
+	data, _ := json.Marshal(struct {
+		Amount   int64  `json:"amount"`
+		Currency string `json:"currency"`
+	}{m.Amount, m.Currency})
+	_, _ = w.Write(data)
+}
+
+// UnmarshalGQL implements graphql.Unmarshaler. It accepts the object form, or
+// a plain decimal number in major units of DefaultCurrency as clients sent
+// before prices had a currency.
+func (m *Money) UnmarshalGQL(v any) error {
+	object, ok := v.(map[string]any)
+	if !ok {
+		decimal, err := decimalString(v)
+		if err != nil {
+			return err
+		}
+		parsed, err := ParseMoney(decimal, "")
+		if err != nil {
+			return err
+		}
+		*m = parsed
+		return nil
+	}
+
+	currency, _ := object["currency"].(string)
+	currency, err := NormalizeCurrency(currency)
+	if err != nil {
+		return err
+	}
+
+	decimal, err := decimalString(object["amount"])
+	if err != nil {
+		return err
+	}
+	amount, err := strconv.ParseInt(decimal, 10, 64)
+	if err != nil {
+		return fmt.Errorf("money amount must be an integer number of minor units, got %v", object["amount"])
+	}
+
+	*m = Money{Amount: amount, Currency: currency}
+	return nil
+}
+
+// decimalString returns the text of a GraphQL numeric input value.
+func decimalString(v any) (string, error) {
+	switch n := v.(type) {
+	case json.Number:
+		return n.String(), nil
+	case string:
+		return n, nil
+	case int:
+		return strconv.Itoa(n), nil
+	case int64:
+		return strconv.FormatInt(n, 10), nil
+	case float64:
+		return strconv.FormatFloat(n, 'f', -1, 64), nil
+	default:
+		return "", fmt.Errorf("money must be an object or a number, got %T", v)
+	}
+}
@@ -26,11 +26,26 @@ func (r *mutationResolver) AddReview(ctx context.Context, input model.AddReviewI
 	panic(fmt.Errorf("not implemented: AddReview - addReview"))
 }
 
+// ReserveStock is the resolver for the reserveStock field.
+func (r *mutationResolver) ReserveStock(ctx context.Context, reservationID string, items []*model.StockItemInput) (*model.Reservation, error) {
+	panic(fmt.Errorf("not implemented: ReserveStock - reserveStock"))
+}
+
+// ReleaseReservation is the resolver for the releaseReservation field.
+func (r *mutationResolver) ReleaseReservation(ctx context.Context, reservationID string) (*model.Reservation, error) {
+	panic(fmt.Errorf("not implemented: ReleaseReservation - releaseReservation"))
+}
+
 // GetProductByID is the resolver for the getProductById field.
 func (r *queryResolver) GetProductByID(ctx context.Context, id string) (*model.Product, error) {
 	panic(fmt.Errorf("not implemented: GetProductByID - getProductById"))
 }
 
+// GetProductsByIDs is the resolver for the getProductsByIds field.
+func (r *queryResolver) GetProductsByIDs(ctx context.Context, ids []string) ([]*model.Product, error) {
+	panic(fmt.Errorf("not implemented: GetProductsByIDs - getProductsByIds"))
+}
+
 // GetAllProducts is the resolver for the getAllProducts field.
 func (r *queryResolver) GetAllProducts(ctx context.Context, filter *model.ProductFilter) ([]*model.Product, error) {
 	panic(fmt.Errorf("not implemented: GetAllProducts - getAllProducts"))
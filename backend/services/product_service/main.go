@@ -5,17 +5,20 @@ import (
 	"crypto/rsa"
 	"encoding/base64"
 	"encoding/json"
+	"errors"
 	"fmt"
 	"log"
 	"math/big"
 	"net/http"
 	"os"
+	"strconv"
 	"strings"
 	"time"
 
 	"product_service/graph"
 	"product_service/graph/model"
 
+	"github.com/99designs/gqlgen/graphql"
 	"github.com/99designs/gqlgen/graphql/handler"
 	"github.com/99designs/gqlgen/graphql/playground"
 	"github.com/aws/aws-sdk-go-v2/aws"
@@ -31,17 +34,26 @@ import (
 )
 
 var (
-	dynamoClient     *dynamodb.Client
+	dynamoClient      *dynamodb.Client
 	eventBridgeClient *eventbridge.Client
-	productsTable    string
-	reviewsTable     string
-	eventBusName     string
-	awsRegion        string
-	cognitoRegion    string
-	userPoolID       string
-	jwksCache        map[string]*rsa.PublicKey
-	jwksCacheTime    time.Time
-	jwksCacheTTL     = 1 * time.Hour
+	productsTable     string
+	reviewsTable      string
+	eventBusName      string
+	awsRegion         string
+	cognitoRegion     string
+	userPoolID        string
+	jwksCache         map[string]*rsa.PublicKey
+	jwksCacheTime     time.Time
+	jwksCacheTTL      = 1 * time.Hour
+)
+
+const (
+	// maxBatchProductIDs caps the number of distinct IDs getProductsByIds accepts.
+	maxBatchProductIDs = 100
+	// dynamoBatchGetLimit is the most keys DynamoDB accepts in one BatchGetItem call.
+	dynamoBatchGetLimit = 100
+	// maxBatchGetAttempts bounds the retries for keys DynamoDB leaves unprocessed.
+	maxBatchGetAttempts = 5
 )
 
 type JWTClaims struct {
@@ -66,15 +78,19 @@ type JWKS struct {
 
 // DynamoDB Product struct
 type DynamoProduct struct {
-	ProductID   string   `dynamodbav:"productId"`
-	Name        string   `dynamodbav:"name"`
-	Price       float64  `dynamodbav:"price"`
-	Description string   `dynamodbav:"description"`
-	Stock       int      `dynamodbav:"stock"`
-	SellerID    string   `dynamodbav:"sellerId"`
-	ImageURL    string   `dynamodbav:"imageUrl"`
-	CreatedAt   string   `dynamodbav:"createdAt"`
-	UpdatedAt   string   `dynamodbav:"updatedAt"`
+	ProductID   string  `dynamodbav:"productId"`
+	Name        string  `dynamodbav:"name"`
+	PriceAmount int64   `dynamodbav:"priceAmount"` // minor units of Currency
+	Currency    string  `dynamodbav:"currency"`
+	LegacyPrice float64 `dynamodbav:"price,omitempty"` // decimal price of items not yet migrated
+	Description string  `dynamodbav:"description"`
+	Stock       int     `dynamodbav:"stock"`
+	Reserved    int     `dynamodbav:"reserved"` // Units held by active reservations
+	SellerID    string  `dynamodbav:"sellerId"`
+	ImageURL    string  `dynamodbav:"imageUrl"`
+	CreatedAt   string  `dynamodbav:"createdAt"`
+	UpdatedAt   string  `dynamodbav:"updatedAt"`
+	Version     int     `dynamodbav:"version"` // Incremented by every edit; absent (0) on items created before versioning
 }
 
 // DynamoDB Review struct
@@ -130,6 +146,35 @@ func init() {
 		eventBusName = "default"
 	}
 
+	if v := os.Getenv("DEFAULT_CURRENCY"); v != "" {
+		currency, err := model.NormalizeCurrency(v)
+		if err != nil {
+			log.Fatalf("Invalid DEFAULT_CURRENCY: %v", err)
+		}
+		model.DefaultCurrency = currency
+	}
+
+	reservationsTable = os.Getenv("RESERVATIONS_TABLE")
+	if reservationsTable == "" {
+		reservationsTable = "Reservations"
+	}
+
+	if v := os.Getenv("RESERVATION_TTL"); v != "" {
+		ttl, err := time.ParseDuration(v)
+		if err != nil || ttl <= 0 {
+			log.Fatalf("Invalid RESERVATION_TTL %q", v)
+		}
+		reservationTTL = ttl
+	}
+
+	if v := os.Getenv("RESERVATION_SWEEP_INTERVAL"); v != "" {
+		interval, err := time.ParseDuration(v)
+		if err != nil || interval <= 0 {
+			log.Fatalf("Invalid RESERVATION_SWEEP_INTERVAL %q", v)
+		}
+		reservationSweepInterval = interval
+	}
+
 	jwksCache = make(map[string]*rsa.PublicKey)
 }
 
@@ -150,6 +195,21 @@ func main() {
 	// Start EventBridge listener in background
 	go listenToEventBridge(ctx)
 
+	// Release expired stock reservations in background
+	go runReservationSweeper(ctx, reservationSweepInterval)
+
+	// Move products still priced with a decimal "price" to minor units
+	go func() {
+		migrated, err := migrateProductPrices(ctx)
+		if err != nil {
+			log.Printf("Warning: product price migration failed: %v", err)
+			return
+		}
+		if migrated > 0 {
+			log.Printf("💱 Migrated %d product prices to minor units", migrated)
+		}
+	}()
+
 	// Set up GraphQL server with Gin
 	r := gin.Default()
 
@@ -438,27 +498,58 @@ func (r *queryResolver) GetProductByID(ctx context.Context, id string) (*model.P
 		return nil, fmt.Errorf("failed to unmarshal product: %w", err)
 	}
 
-	// Fetch reviews for this product
-	reviews, err := getReviewsForProduct(ctx, id)
-	if err != nil {
-		log.Printf("Warning: failed to fetch reviews for product %s: %v", id, err)
-		reviews = []*model.Review{} // Return empty reviews on error
+	// Fetch reviews for this product (skipped when the query doesn't ask for them)
+	reviews := []*model.Review{}
+	if fieldRequested(ctx, "reviews") {
+		reviews, err = getReviewsForProduct(ctx, id)
+		if err != nil {
+			log.Printf("Warning: failed to fetch reviews for product %s: %v", id, err)
+			reviews = []*model.Review{} // Return empty reviews on error
+		}
 	}
 
 	return &model.Product{
 		ProductID:   product.ProductID,
 		Name:        product.Name,
-		Price:       product.Price,
+		Price:       productPrice(product),
 		Description: &product.Description,
 		Stock:       product.Stock,
+		Reserved:    product.Reserved,
+		Available:   availableStock(product),
 		SellerID:    product.SellerID,
 		ImageURL:    &product.ImageURL,
 		Reviews:     reviews,
 		CreatedAt:   &product.CreatedAt,
 		UpdatedAt:   &product.UpdatedAt,
+		Version:     product.Version,
 	}, nil
 }
 
+// GetProductsByIDs resolver. Products are loaded with BatchGetItem and returned
+// in the order requested, with nil for IDs that don't exist.
+func (r *queryResolver) GetProductsByIDs(ctx context.Context, ids []string) ([]*model.Product, error) {
+	unique := uniqueIDs(ids)
+	if len(unique) > maxBatchProductIDs {
+		return nil, fmt.Errorf("too many ids: at most %d per request", maxBatchProductIDs)
+	}
+
+	found, err := batchGetProducts(ctx, unique)
+	if err != nil {
+		return nil, err
+	}
+
+	reviews := map[string][]*model.Review{}
+	if fieldRequested(ctx, "reviews") && len(found) > 0 {
+		reviews, err = getReviewsForProducts(ctx, unique)
+		if err != nil {
+			log.Printf("Warning: failed to fetch reviews for products: %v", err)
+			reviews = map[string][]*model.Review{}
+		}
+	}
+
+	return orderProductsByIDs(ids, found, reviews), nil
+}
+
 // GetAllProducts resolver
 func (r *queryResolver) GetAllProducts(ctx context.Context, filter *model.ProductFilter) ([]*model.Product, error) {
 	var input *dynamodb.ScanInput
@@ -501,14 +592,17 @@ func (r *queryResolver) GetAllProducts(ctx context.Context, filter *model.Produc
 		products = append(products, &model.Product{
 			ProductID:   product.ProductID,
 			Name:        product.Name,
-			Price:       product.Price,
+			Price:       productPrice(product),
 			Description: &product.Description,
 			Stock:       product.Stock,
+			Reserved:    product.Reserved,
+			Available:   availableStock(product),
 			SellerID:    product.SellerID,
 			ImageURL:    &product.ImageURL,
 			Reviews:     reviews,
 			CreatedAt:   &product.CreatedAt,
 			UpdatedAt:   &product.UpdatedAt,
+			Version:     product.Version,
 		})
 	}
 
@@ -538,6 +632,11 @@ func (r *mutationResolver) AddProduct(ctx context.Context, input model.AddProduc
 		return nil, fmt.Errorf("forbidden: seller ID mismatch")
 	}
 
+	price, err := validatePrice(input.Price)
+	if err != nil {
+		return nil, err
+	}
+
 	// Create product
 	productID := uuid.New().String()
 	now := time.Now().UTC().Format(time.RFC3339)
@@ -555,13 +654,15 @@ func (r *mutationResolver) AddProduct(ctx context.Context, input model.AddProduc
 	product := DynamoProduct{
 		ProductID:   productID,
 		Name:        input.Name,
-		Price:       input.Price,
+		PriceAmount: price.Amount,
+		Currency:    price.Currency,
 		Description: description,
 		Stock:       input.Stock,
 		SellerID:    input.SellerID,
 		ImageURL:    imageUrl,
 		CreatedAt:   now,
 		UpdatedAt:   now,
+		Version:     1,
 	}
 
 	av, err := attributevalue.MarshalMap(product)
@@ -581,17 +682,64 @@ func (r *mutationResolver) AddProduct(ctx context.Context, input model.AddProduc
 	return &model.Product{
 		ProductID:   product.ProductID,
 		Name:        product.Name,
-		Price:       product.Price,
+		Price:       productPrice(product),
 		Description: &product.Description,
 		Stock:       product.Stock,
+		Reserved:    product.Reserved,
+		Available:   availableStock(product),
 		SellerID:    product.SellerID,
 		ImageURL:    &product.ImageURL,
 		Reviews:     []*model.Review{},
 		CreatedAt:   &product.CreatedAt,
 		UpdatedAt:   &product.UpdatedAt,
+		Version:     product.Version,
 	}, nil
 }
 
+// ErrVersionConflict is returned when editProduct is given an expectedVersion
+// the product is no longer at.
+var ErrVersionConflict = errors.New("version conflict")
+
+// ErrStockBelowReserved is returned when editProduct would set stock below the
+// quantity currently reserved for pending orders.
+var ErrStockBelowReserved = errors.New("stock below reserved")
+
+// versionCondition returns the condition expression and :expectedVersion value
+// for a product still being at version expected. Items written before
+// versioning have no version attribute and are at version 0.
+func versionCondition(expected int) (string, types.AttributeValue) {
+	value := &types.AttributeValueMemberN{Value: strconv.Itoa(expected)}
+	if expected == 0 {
+		return "(attribute_not_exists(version) OR version = :expectedVersion)", value
+	}
+	return "version = :expectedVersion", value
+}
+
+// stockBelowReservedError reports an edit that would set stock below reserved.
+func stockBelowReservedError(productID string, stock, reserved int) error {
+	return fmt.Errorf("%w: product %s has %d reserved, cannot set stock to %d",
+		ErrStockBelowReserved, productID, reserved, stock)
+}
+
+// editConditionError explains why the conditional write in editProduct failed,
+// from the item as it was when the condition was checked.
+func editConditionError(input model.EditProductInput, old map[string]types.AttributeValue) error {
+	if old == nil {
+		return fmt.Errorf("product not found")
+	}
+	if input.Stock != nil {
+		if reserved, ok := old["reserved"].(*types.AttributeValueMemberN); ok {
+			if n, err := strconv.Atoi(reserved.Value); err == nil && n > *input.Stock {
+				return stockBelowReservedError(input.ProductID, *input.Stock, n)
+			}
+		}
+	}
+	if input.ExpectedVersion != nil {
+		return fmt.Errorf("%w: product %s was modified concurrently", ErrVersionConflict, input.ProductID)
+	}
+	return fmt.Errorf("product not found")
+}
+
 // EditProduct resolver (requires JWT and ownership check)
 func (r *mutationResolver) EditProduct(ctx context.Context, input model.EditProductInput) (*model.Product, error) {
 	// Get seller ID from Gin context
@@ -631,12 +779,27 @@ func (r *mutationResolver) EditProduct(ctx context.Context, input model.EditProd
 		return nil, fmt.Errorf("forbidden: you can only edit your own products")
 	}
 
-	// Build update expression
-	updateExpr := "SET updatedAt = :updatedAt"
+	// Reject an edit based on a stale read before writing anything
+	if input.ExpectedVersion != nil && *input.ExpectedVersion != product.Version {
+		return nil, fmt.Errorf("%w: product %s is at version %d, not %d",
+			ErrVersionConflict, input.ProductID, product.Version, *input.ExpectedVersion)
+	}
+
+	// Stock can't drop below what pending orders already hold, or committing
+	// or releasing those reservations would leave it negative
+	if input.Stock != nil && *input.Stock < product.Reserved {
+		return nil, stockBelowReservedError(input.ProductID, *input.Stock, product.Reserved)
+	}
+
+	// Build update expression. Every edit bumps the version; items from
+	// before versioning start from 0.
+	updateExpr := "SET updatedAt = :updatedAt, version = if_not_exists(version, :zero) + :one"
 	exprAttrValues := map[string]types.AttributeValue{
 		":updatedAt": &types.AttributeValueMemberS{
 			Value: time.Now().UTC().Format(time.RFC3339),
 		},
+		":zero": &types.AttributeValueMemberN{Value: "0"},
+		":one":  &types.AttributeValueMemberN{Value: "1"},
 	}
 
 	if input.Name != nil {
@@ -644,11 +807,19 @@ func (r *mutationResolver) EditProduct(ctx context.Context, input model.EditProd
 		exprAttrValues[":name"] = &types.AttributeValueMemberS{Value: *input.Name}
 	}
 
+	// Setting a price also drops the legacy decimal attribute
+	removeExpr := ""
 	if input.Price != nil {
-		updateExpr += ", price = :price"
-		exprAttrValues[":price"] = &types.AttributeValueMemberN{
-			Value: fmt.Sprintf("%f", *input.Price),
+		price, err := validatePrice(*input.Price)
+		if err != nil {
+			return nil, err
 		}
+		updateExpr += ", priceAmount = :priceAmount, currency = :currency"
+		exprAttrValues[":priceAmount"] = &types.AttributeValueMemberN{
+			Value: strconv.FormatInt(price.Amount, 10),
+		}
+		exprAttrValues[":currency"] = &types.AttributeValueMemberS{Value: price.Currency}
+		removeExpr = " REMOVE price"
 	}
 
 	if input.Description != nil {
@@ -672,17 +843,36 @@ func (r *mutationResolver) EditProduct(ctx context.Context, input model.EditProd
 		"#name": "name", // 'name' is a reserved keyword in DynamoDB
 	}
 
+	// The write only applies if the product still exists, still has no more
+	// reserved than the new stock and, when the caller gave one, is still at
+	// the expected version
+	condition := "attribute_exists(productId)"
+	if input.Stock != nil {
+		condition += " AND (attribute_not_exists(reserved) OR reserved <= :stock)"
+	}
+	if input.ExpectedVersion != nil {
+		versionCondition, expected := versionCondition(*input.ExpectedVersion)
+		condition += " AND " + versionCondition
+		exprAttrValues[":expectedVersion"] = expected
+	}
+
 	_, err = dynamoClient.UpdateItem(ctx, &dynamodb.UpdateItemInput{
 		TableName: aws.String(productsTable),
 		Key: map[string]types.AttributeValue{
 			"productId": &types.AttributeValueMemberS{Value: input.ProductID},
 		},
-		UpdateExpression:          aws.String(updateExpr),
-		ExpressionAttributeValues: exprAttrValues,
-		ExpressionAttributeNames:  exprAttrNames,
+		UpdateExpression:                    aws.String(updateExpr + removeExpr),
+		ConditionExpression:                 aws.String(condition),
+		ExpressionAttributeValues:           exprAttrValues,
+		ExpressionAttributeNames:            exprAttrNames,
+		ReturnValuesOnConditionCheckFailure: types.ReturnValuesOnConditionCheckFailureAllOld,
 	})
 
 	if err != nil {
+		var conditionFailed *types.ConditionalCheckFailedException
+		if errors.As(err, &conditionFailed) {
+			return nil, editConditionError(input, conditionFailed.Item)
+		}
 		return nil, fmt.Errorf("failed to update product: %w", err)
 	}
 
@@ -711,14 +901,17 @@ func (r *mutationResolver) EditProduct(ctx context.Context, input model.EditProd
 	return &model.Product{
 		ProductID:   updatedProduct.ProductID,
 		Name:        updatedProduct.Name,
-		Price:       updatedProduct.Price,
+		Price:       productPrice(updatedProduct),
 		Description: &updatedProduct.Description,
 		Stock:       updatedProduct.Stock,
+		Reserved:    updatedProduct.Reserved,
+		Available:   availableStock(updatedProduct),
 		SellerID:    updatedProduct.SellerID,
 		ImageURL:    &updatedProduct.ImageURL,
 		Reviews:     reviews,
 		CreatedAt:   &updatedProduct.CreatedAt,
 		UpdatedAt:   &updatedProduct.UpdatedAt,
+		Version:     updatedProduct.Version,
 	}, nil
 }
 
@@ -822,3 +1015,176 @@ func getReviewsForProduct(ctx context.Context, productID string) ([]*model.Revie
 
 	return reviews, nil
 }
+
+// fieldRequested reports whether the current GraphQL field's selection set
+// includes the named child field. Outside a GraphQL request it returns true.
+func fieldRequested(ctx context.Context, name string) bool {
+	if graphql.GetFieldContext(ctx) == nil {
+		return true
+	}
+	for _, field := range graphql.CollectFieldsCtx(ctx, nil) {
+		if field.Name == name {
+			return true
+		}
+	}
+	return false
+}
+
+// uniqueIDs returns the non-empty IDs with duplicates removed, keeping order.
+func uniqueIDs(ids []string) []string {
+	seen := make(map[string]bool, len(ids))
+	unique := make([]string, 0, len(ids))
+	for _, id := range ids {
+		if id == "" || seen[id] {
+			continue
+		}
+		seen[id] = true
+		unique = append(unique, id)
+	}
+	return unique
+}
+
+// chunkIDs splits ids into slices of at most size elements.
+func chunkIDs(ids []string, size int) [][]string {
+	var chunks [][]string
+	for start := 0; start < len(ids); start += size {
+		end := start + size
+		if end > len(ids) {
+			end = len(ids)
+		}
+		chunks = append(chunks, ids[start:end])
+	}
+	return chunks
+}
+
+// batchGetProducts loads products with BatchGetItem, retrying any keys
+// DynamoDB returns as unprocessed. Missing products are absent from the map.
+func batchGetProducts(ctx context.Context, ids []string) (map[string]DynamoProduct, error) {
+	products := make(map[string]DynamoProduct, len(ids))
+
+	for _, chunk := range chunkIDs(ids, dynamoBatchGetLimit) {
+		keys := make([]map[string]types.AttributeValue, 0, len(chunk))
+		for _, id := range chunk {
+			keys = append(keys, map[string]types.AttributeValue{
+				"productId": &types.AttributeValueMemberS{Value: id},
+			})
+		}
+
+		request := map[string]types.KeysAndAttributes{
+			productsTable: {Keys: keys},
+		}
+
+		for attempt := 0; len(request) > 0; attempt++ {
+			if attempt >= maxBatchGetAttempts {
+				return nil, fmt.Errorf("failed to get products: keys still unprocessed after %d attempts", maxBatchGetAttempts)
+			}
+			if attempt > 0 {
+				time.Sleep(time.Duration(50<<attempt) * time.Millisecond)
+			}
+
+			result, err := dynamoClient.BatchGetItem(ctx, &dynamodb.BatchGetItemInput{RequestItems: request})
+			if err != nil {
+				return nil, fmt.Errorf("failed to get products: %w", err)
+			}
+
+			for _, item := range result.Responses[productsTable] {
+				var product DynamoProduct
+				if err := attributevalue.UnmarshalMap(item, &product); err != nil {
+					log.Printf("Warning: failed to unmarshal product: %v", err)
+					continue
+				}
+				products[product.ProductID] = product
+			}
+
+			request = result.UnprocessedKeys
+		}
+	}
+
+	return products, nil
+}
+
+// getReviewsForProducts loads the reviews of several products with one
+// paginated Scan per chunk of IDs, grouped by product ID.
+func getReviewsForProducts(ctx context.Context, productIDs []string) (map[string][]*model.Review, error) {
+	reviews := make(map[string][]*model.Review, len(productIDs))
+
+	for _, chunk := range chunkIDs(productIDs, dynamoBatchGetLimit) {
+		placeholders := make([]string, len(chunk))
+		values := make(map[string]types.AttributeValue, len(chunk))
+		for i, id := range chunk {
+			placeholder := fmt.Sprintf(":p%d", i)
+			placeholders[i] = placeholder
+			values[placeholder] = &types.AttributeValueMemberS{Value: id}
+		}
+
+		input := &dynamodb.ScanInput{
+			TableName:                 aws.String(reviewsTable),
+			FilterExpression:          aws.String("productId IN (" + strings.Join(placeholders, ", ") + ")"),
+			ExpressionAttributeValues: values,
+		}
+
+		for {
+			result, err := dynamoClient.Scan(ctx, input)
+			if err != nil {
+				return nil, fmt.Errorf("failed to scan reviews: %w", err)
+			}
+
+			for _, item := range result.Items {
+				var review DynamoReview
+				if err := attributevalue.UnmarshalMap(item, &review); err != nil {
+					log.Printf("Warning: failed to unmarshal review: %v", err)
+					continue
+				}
+				reviews[review.ProductID] = append(reviews[review.ProductID], &model.Review{
+					ReviewID:  review.ReviewID,
+					ProductID: review.ProductID,
+					Text:      &review.Text,
+					Rating:    &review.Rating,
+					UserID:    &review.UserID,
+					CreatedAt: &review.CreatedAt,
+				})
+			}
+
+			if len(result.LastEvaluatedKey) == 0 {
+				break
+			}
+			input.ExclusiveStartKey = result.LastEvaluatedKey
+		}
+	}
+
+	return reviews, nil
+}
+
+// orderProductsByIDs builds the getProductsByIds result: one entry per
+// requested ID in request order, nil where the product was not found.
+func orderProductsByIDs(ids []string, found map[string]DynamoProduct, reviews map[string][]*model.Review) []*model.Product {
+	products := make([]*model.Product, len(ids))
+	for i, id := range ids {
+		product, ok := found[id]
+		if !ok {
+			continue
+		}
+
+		productReviews := reviews[id]
+		if productReviews == nil {
+			productReviews = []*model.Review{}
+		}
+
+		products[i] = &model.Product{
+			ProductID:   product.ProductID,
+			Name:        product.Name,
+			Price:       productPrice(product),
+			Description: &product.Description,
+			Stock:       product.Stock,
+			Reserved:    product.Reserved,
+			Available:   availableStock(product),
+			SellerID:    product.SellerID,
+			ImageURL:    &product.ImageURL,
+			Reviews:     productReviews,
+			CreatedAt:   &product.CreatedAt,
+			UpdatedAt:   &product.UpdatedAt,
+			Version:     product.Version,
+		}
+	}
+	return products
+}
@@ -2,12 +2,17 @@ package main
 
 import (
 	"bytes"
+	"context"
 	"encoding/json"
+	"fmt"
 	"net/http"
 	"net/http/httptest"
 	"testing"
 	"time"
 
+	"product_service/graph/model"
+
+	"github.com/aws/aws-sdk-go-v2/service/dynamodb/types"
 	"github.com/gin-gonic/gin"
 	"github.com/stretchr/testify/assert"
 )
@@ -60,7 +65,7 @@ func TestGraphQLEndpointRequiresAuthentication(t *testing.T) {
 	for _, tt := range tests {
 		t.Run(tt.name, func(t *testing.T) {
 			r := setupTestRouter()
-			
+
 			r.POST("/graphql", func(c *gin.Context) {
 				// Simplified test - just check that endpoint exists
 				c.JSON(http.StatusOK, gin.H{"data": nil, "errors": []gin.H{{"message": "unauthorized"}}})
@@ -241,7 +246,8 @@ func TestDynamoProductStructure(t *testing.T) {
 			product: DynamoProduct{
 				ProductID:   "123",
 				Name:        "Test Product",
-				Price:       99.99,
+				PriceAmount: 9999,
+				Currency:    "LKR",
 				Description: "Test description",
 				Stock:       10,
 				SellerID:    "seller-123",
@@ -255,7 +261,8 @@ func TestDynamoProductStructure(t *testing.T) {
 			product: DynamoProduct{
 				ProductID:   "456",
 				Name:        "Out of Stock",
-				Price:       49.99,
+				PriceAmount: 4999,
+				Currency:    "LKR",
 				Description: "No stock",
 				Stock:       0,
 				SellerID:    "seller-456",
@@ -271,7 +278,7 @@ func TestDynamoProductStructure(t *testing.T) {
 			// Validate product structure
 			assert.NotEmpty(t, tt.product.ProductID)
 			assert.NotEmpty(t, tt.product.Name)
-			assert.GreaterOrEqual(t, tt.product.Price, 0.0)
+			assert.GreaterOrEqual(t, tt.product.PriceAmount, int64(0))
 			assert.GreaterOrEqual(t, tt.product.Stock, 0)
 		})
 	}
@@ -321,7 +328,7 @@ func TestDynamoReviewStructure(t *testing.T) {
 func TestJWKSCacheLogic(t *testing.T) {
 	// Test that cache map is initialized
 	assert.NotNil(t, jwksCache)
-	
+
 	// Test cache TTL is set
 	assert.Equal(t, 1*time.Hour, jwksCacheTTL)
 }
@@ -357,3 +364,84 @@ func TestEnvironmentVariables(t *testing.T) {
 		})
 	}
 }
+
+func TestUniqueIDs(t *testing.T) {
+	assert.Equal(t, []string{"a", "b", "c"}, uniqueIDs([]string{"a", "b", "a", "", "c", "b"}))
+	assert.Equal(t, []string{}, uniqueIDs(nil))
+}
+
+func TestVersionCondition(t *testing.T) {
+	condition, value := versionCondition(3)
+	assert.Equal(t, "version = :expectedVersion", condition)
+	assert.Equal(t, &types.AttributeValueMemberN{Value: "3"}, value)
+
+	condition, value = versionCondition(0)
+	assert.Contains(t, condition, "attribute_not_exists(version)", "items from before versioning are at version 0")
+	assert.Equal(t, &types.AttributeValueMemberN{Value: "0"}, value)
+}
+
+func TestEditConditionError(t *testing.T) {
+	stock, version := 2, 3
+	item := map[string]types.AttributeValue{
+		"productId": &types.AttributeValueMemberS{Value: "prod-1"},
+		"reserved":  &types.AttributeValueMemberN{Value: "5"},
+		"version":   &types.AttributeValueMemberN{Value: "4"},
+	}
+
+	err := editConditionError(model.EditProductInput{ProductID: "prod-1", Stock: &stock}, item)
+	assert.ErrorIs(t, err, ErrStockBelowReserved)
+
+	err = editConditionError(model.EditProductInput{ProductID: "prod-1", ExpectedVersion: &version}, item)
+	assert.ErrorIs(t, err, ErrVersionConflict)
+
+	enough := 5
+	err = editConditionError(model.EditProductInput{ProductID: "prod-1", Stock: &enough, ExpectedVersion: &version}, item)
+	assert.ErrorIs(t, err, ErrVersionConflict, "stock covers reserved, so the version check failed")
+
+	err = editConditionError(model.EditProductInput{ProductID: "prod-1", Stock: &stock}, nil)
+	assert.EqualError(t, err, "product not found")
+}
+
+func TestChunkIDs(t *testing.T) {
+	ids := make([]string, 250)
+	for i := range ids {
+		ids[i] = fmt.Sprintf("p%d", i)
+	}
+
+	chunks := chunkIDs(ids, dynamoBatchGetLimit)
+	assert.Len(t, chunks, 3)
+	assert.Len(t, chunks[0], 100)
+	assert.Len(t, chunks[1], 100)
+	assert.Len(t, chunks[2], 50)
+	assert.Equal(t, "p249", chunks[2][49])
+
+	assert.Empty(t, chunkIDs(nil, dynamoBatchGetLimit))
+}
+
+func TestOrderProductsByIDs(t *testing.T) {
+	found := map[string]DynamoProduct{
+		"p1": {ProductID: "p1", Name: "Headphones", PriceAmount: 1799700, Currency: "LKR", Stock: 3, SellerID: "seller-1"},
+		"p2": {ProductID: "p2", Name: "Charger", PriceAmount: 899700, Currency: "LKR", Stock: 0, SellerID: "seller-2"},
+	}
+	text := "Great"
+	reviews := map[string][]*model.Review{
+		"p2": {{ReviewID: "r1", ProductID: "p2", Text: &text}},
+	}
+
+	products := orderProductsByIDs([]string{"p2", "missing", "p1", "p2"}, found, reviews)
+
+	assert.Len(t, products, 4, "one entry per requested ID")
+	assert.Equal(t, "p2", products[0].ProductID)
+	assert.Len(t, products[0].Reviews, 1)
+	assert.Nil(t, products[1], "unknown IDs map to null")
+	assert.Equal(t, "p1", products[2].ProductID)
+	assert.Equal(t, model.Money{Amount: 1799700, Currency: "LKR"}, products[2].Price)
+	assert.NotNil(t, products[2].Reviews, "reviews is non-null in the schema")
+	assert.Empty(t, products[2].Reviews)
+	assert.Equal(t, "p2", products[3].ProductID, "duplicate IDs are repeated")
+}
+
+func TestFieldRequestedOutsideGraphQL(t *testing.T) {
+	// Without a GraphQL field context every field is treated as requested
+	assert.True(t, fieldRequested(context.Background(), "reviews"))
+}
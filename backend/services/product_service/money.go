@@ -0,0 +1,106 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"math"
+	"strconv"
+
+	"product_service/graph/model"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/feature/dynamodb/attributevalue"
+	"github.com/aws/aws-sdk-go-v2/service/dynamodb"
+	"github.com/aws/aws-sdk-go-v2/service/dynamodb/types"
+)
+
+// Prices are stored as priceAmount (integer minor units) and currency.
+// Products written before that have a decimal "price" attribute instead;
+// productPrice converts it on read, and migrateProductPrices rewrites those
+// items once at startup.
+
+// productPrice returns a product's price, converting the legacy decimal price
+// of items that have not been migrated yet.
+func productPrice(product DynamoProduct) model.Money {
+	if product.Currency != "" {
+		return model.Money{Amount: product.PriceAmount, Currency: product.Currency}
+	}
+	return legacyPrice(product.LegacyPrice)
+}
+
+// legacyPrice converts a decimal price in the default currency to minor units.
+// Legacy prices were written with fmt's %f, so rounding to the currency's
+// minor unit recovers the price the seller entered.
+func legacyPrice(price float64) model.Money {
+	currency := model.DefaultCurrency
+	scale := math.Pow10(model.CurrencyExponent(currency))
+	return model.Money{Amount: int64(math.Round(price * scale)), Currency: currency}
+}
+
+// validatePrice checks a price sent by a seller.
+func validatePrice(price model.Money) (model.Money, error) {
+	currency, err := model.NormalizeCurrency(price.Currency)
+	if err != nil {
+		return model.Money{}, err
+	}
+	if price.Amount < 0 {
+		return model.Money{}, errors.New("price cannot be negative")
+	}
+	return model.Money{Amount: price.Amount, Currency: currency}, nil
+}
+
+// migrateProductPrices rewrites every product that still has a legacy decimal
+// price to priceAmount and currency, and returns how many it changed. Each
+// update is conditional on the item still being unmigrated, so replicas
+// running it at the same time, or a seller editing the price meanwhile, are
+// safe.
+func migrateProductPrices(ctx context.Context) (int, error) {
+	migrated := 0
+	var startKey map[string]types.AttributeValue
+
+	for {
+		page, err := dynamoClient.Scan(ctx, &dynamodb.ScanInput{
+			TableName:         aws.String(productsTable),
+			FilterExpression:  aws.String("attribute_not_exists(currency) AND attribute_exists(price)"),
+			ExclusiveStartKey: startKey,
+		})
+		if err != nil {
+			return migrated, fmt.Errorf("failed to scan products: %w", err)
+		}
+
+		for _, item := range page.Items {
+			var product DynamoProduct
+			if err := attributevalue.UnmarshalMap(item, &product); err != nil {
+				return migrated, fmt.Errorf("failed to unmarshal product: %w", err)
+			}
+
+			price := legacyPrice(product.LegacyPrice)
+			_, err := dynamoClient.UpdateItem(ctx, &dynamodb.UpdateItemInput{
+				TableName: aws.String(productsTable),
+				Key: map[string]types.AttributeValue{
+					"productId": &types.AttributeValueMemberS{Value: product.ProductID},
+				},
+				UpdateExpression:    aws.String("SET priceAmount = :amount, currency = :currency REMOVE price"),
+				ConditionExpression: aws.String("attribute_not_exists(currency)"),
+				ExpressionAttributeValues: map[string]types.AttributeValue{
+					":amount":   &types.AttributeValueMemberN{Value: strconv.FormatInt(price.Amount, 10)},
+					":currency": &types.AttributeValueMemberS{Value: price.Currency},
+				},
+			})
+			if err != nil {
+				var conditionFailed *types.ConditionalCheckFailedException
+				if errors.As(err, &conditionFailed) {
+					continue
+				}
+				return migrated, fmt.Errorf("failed to migrate price of product %s: %w", product.ProductID, err)
+			}
+			migrated++
+		}
+
+		if len(page.LastEvaluatedKey) == 0 {
+			return migrated, nil
+		}
+		startKey = page.LastEvaluatedKey
+	}
+}
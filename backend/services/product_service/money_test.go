@@ -0,0 +1,91 @@
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"testing"
+
+	"product_service/graph/model"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestParseMoney(t *testing.T) {
+	tests := []struct {
+		decimal  string
+		currency string
+		want     model.Money
+		wantErr  bool
+	}{
+		{"17997", "LKR", model.Money{Amount: 1799700, Currency: "LKR"}, false},
+		{"17997.5", "lkr", model.Money{Amount: 1799750, Currency: "LKR"}, false},
+		{"0.10", "", model.Money{Amount: 10, Currency: "LKR"}, false},
+		{"9.990000", "USD", model.Money{Amount: 999, Currency: "USD"}, false},
+		{"1500", "JPY", model.Money{Amount: 1500, Currency: "JPY"}, false},
+		{"-2.25", "LKR", model.Money{Amount: -225, Currency: "LKR"}, false},
+		{"1.005", "LKR", model.Money{}, true},
+		{"12a", "LKR", model.Money{}, true},
+		{"10", "RUPEES", model.Money{}, true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.decimal+"_"+tt.currency, func(t *testing.T) {
+			got, err := model.ParseMoney(tt.decimal, tt.currency)
+			if tt.wantErr {
+				assert.Error(t, err)
+				return
+			}
+			require.NoError(t, err)
+			assert.Equal(t, tt.want, got)
+		})
+	}
+}
+
+func TestMoneyDecimal(t *testing.T) {
+	assert.Equal(t, "17997.00", model.Money{Amount: 1799700, Currency: "LKR"}.Decimal())
+	assert.Equal(t, "0.05", model.Money{Amount: 5, Currency: "LKR"}.Decimal())
+	assert.Equal(t, "-1.50", model.Money{Amount: -150, Currency: "USD"}.Decimal())
+	assert.Equal(t, "1500", model.Money{Amount: 1500, Currency: "JPY"}.Decimal())
+	assert.Equal(t, "LKR 89.97", model.Money{Amount: 8997, Currency: "LKR"}.String())
+}
+
+func TestMoneyGQL(t *testing.T) {
+	var buf bytes.Buffer
+	model.Money{Amount: 1799700, Currency: "LKR"}.MarshalGQL(&buf)
+	assert.JSONEq(t, `{"amount":1799700,"currency":"LKR"}`, buf.String())
+
+	var m model.Money
+	require.NoError(t, m.UnmarshalGQL(map[string]any{"amount": json.Number("2500"), "currency": "usd"}))
+	assert.Equal(t, model.Money{Amount: 2500, Currency: "USD"}, m)
+
+	require.NoError(t, m.UnmarshalGQL(map[string]any{"amount": int64(99)}))
+	assert.Equal(t, model.Money{Amount: 99, Currency: "LKR"}, m)
+
+	// Plain numbers are major units of the default currency
+	require.NoError(t, m.UnmarshalGQL(10.5))
+	assert.Equal(t, model.Money{Amount: 1050, Currency: "LKR"}, m)
+	require.NoError(t, m.UnmarshalGQL(json.Number("17997")))
+	assert.Equal(t, model.Money{Amount: 1799700, Currency: "LKR"}, m)
+
+	assert.Error(t, m.UnmarshalGQL(map[string]any{"amount": 10.5, "currency": "LKR"}), "object amounts are minor units")
+	assert.Error(t, m.UnmarshalGQL(true))
+}
+
+func TestProductPrice(t *testing.T) {
+	migrated := DynamoProduct{PriceAmount: 899700, Currency: "LKR"}
+	assert.Equal(t, model.Money{Amount: 899700, Currency: "LKR"}, productPrice(migrated))
+
+	// Legacy items were written with %f
+	legacy := DynamoProduct{LegacyPrice: 17997.990000}
+	assert.Equal(t, model.Money{Amount: 1799799, Currency: "LKR"}, productPrice(legacy))
+}
+
+func TestValidatePrice(t *testing.T) {
+	price, err := validatePrice(model.Money{Amount: 100, Currency: "usd"})
+	require.NoError(t, err)
+	assert.Equal(t, model.Money{Amount: 100, Currency: "USD"}, price)
+
+	_, err = validatePrice(model.Money{Amount: -1, Currency: "LKR"})
+	assert.Error(t, err)
+}
@@ -0,0 +1,569 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log"
+	"time"
+
+	"product_service/graph/model"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/feature/dynamodb/attributevalue"
+	"github.com/aws/aws-sdk-go-v2/service/dynamodb"
+	"github.com/aws/aws-sdk-go-v2/service/dynamodb/types"
+	"github.com/gin-gonic/gin"
+)
+
+// Stock reservations hold units of a product for a checkout between placing
+// the order and paying for it. A product's stock only goes down once the
+// reservation is committed (by the stock updater Lambda on order-paid); until
+// then the units are counted in the product's reserved attribute so no one
+// else can buy them. Unpaid reservations expire and are released by the
+// sweeper.
+//
+// Each reservation is stored as one item per product in the reservations
+// table, keyed by reservationId (the checkout ID) and productId.
+
+// Reservation line statuses.
+const (
+	ReservationActive    = "active"
+	ReservationCommitted = "committed"
+	ReservationReleased  = "released"
+	ReservationRestocked = "restocked"
+)
+
+const (
+	// maxReservationProducts caps the distinct products in one reservation.
+	// Each product takes two of the 100 actions DynamoDB allows per transaction.
+	maxReservationProducts = 50
+	// maxReserveAttempts bounds the retries when stock changes between reading
+	// the products and writing the reservation.
+	maxReserveAttempts = 3
+	// reservationRetention is how long finished reservation lines are kept
+	// before DynamoDB TTL deletes them.
+	reservationRetention = 7 * 24 * time.Hour
+	// reservationStatusIndex is the GSI on (status, expiresAt) used by the sweeper.
+	reservationStatusIndex = "StatusExpiresAtIndex"
+)
+
+var (
+	reservationsTable        string
+	reservationTTL           = 15 * time.Minute
+	reservationSweepInterval = 1 * time.Minute
+)
+
+// ErrInsufficientStock is returned when a product does not have enough
+// unreserved stock for a reservation.
+var ErrInsufficientStock = errors.New("insufficient stock")
+
+// DynamoDB Reservation struct (one line of a reservation)
+type DynamoReservation struct {
+	ReservationID string `dynamodbav:"reservationId"`
+	ProductID     string `dynamodbav:"productId"`
+	UserID        string `dynamodbav:"userId"`
+	Quantity      int    `dynamodbav:"quantity"`
+	Status        string `dynamodbav:"status"`
+	ExpiresAt     int64  `dynamodbav:"expiresAt"` // Unix seconds
+	CreatedAt     string `dynamodbav:"createdAt"`
+	UpdatedAt     string `dynamodbav:"updatedAt"`
+	TTL           int64  `dynamodbav:"ttl,omitempty"` // Set once the line is finished
+}
+
+// stockLine is a requested quantity of one product.
+type stockLine struct {
+	ProductID string
+	Quantity  int
+}
+
+// ReserveStock resolver (requires JWT). All lines are reserved in a single
+// DynamoDB transaction, so either every product is held or none is.
+func (r *mutationResolver) ReserveStock(ctx context.Context, reservationID string, items []*model.StockItemInput) (*model.Reservation, error) {
+	userID, err := authenticatedUserID(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	if reservationID == "" {
+		return nil, fmt.Errorf("reservationId is required")
+	}
+
+	lines, err := aggregateStockItems(items)
+	if err != nil {
+		return nil, err
+	}
+
+	productIDs := make([]string, len(lines))
+	for i, line := range lines {
+		productIDs[i] = line.ProductID
+	}
+
+	now := time.Now().UTC()
+	expiresAt := now.Add(reservationTTL)
+
+	for attempt := 1; ; attempt++ {
+		products, err := batchGetProducts(ctx, productIDs)
+		if err != nil {
+			return nil, err
+		}
+
+		if err := checkAvailability(lines, products); err != nil {
+			return nil, err
+		}
+
+		input, err := buildReserveTransaction(reservationID, userID, lines, products, now, expiresAt)
+		if err != nil {
+			return nil, err
+		}
+
+		_, err = dynamoClient.TransactWriteItems(ctx, input)
+		if err == nil {
+			break
+		}
+
+		failed := failedTransactionItems(err)
+		if failed == nil {
+			return nil, fmt.Errorf("failed to reserve stock: %w", err)
+		}
+		for _, index := range failed {
+			// Items alternate product update, reservation put
+			if index%2 == 1 {
+				return nil, fmt.Errorf("reservation %s already exists", reservationID)
+			}
+		}
+		if attempt == maxReserveAttempts {
+			return nil, fmt.Errorf("failed to reserve stock: stock changed concurrently, please retry")
+		}
+	}
+
+	reserved := make([]DynamoReservation, len(lines))
+	for i, line := range lines {
+		reserved[i] = DynamoReservation{
+			ReservationID: reservationID,
+			ProductID:     line.ProductID,
+			Quantity:      line.Quantity,
+			Status:        ReservationActive,
+			ExpiresAt:     expiresAt.Unix(),
+		}
+	}
+
+	log.Printf("🔒 Reserved stock: ReservationID=%s, Products=%d, ExpiresAt=%s",
+		reservationID, len(lines), expiresAt.Format(time.RFC3339))
+
+	return toModelReservation(reservationID, reserved), nil
+}
+
+// ReleaseReservation resolver (requires JWT of the user who made the
+// reservation). Active lines are released; committed lines are left alone.
+func (r *mutationResolver) ReleaseReservation(ctx context.Context, reservationID string) (*model.Reservation, error) {
+	userID, err := authenticatedUserID(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	lines, err := getReservationLines(ctx, reservationID)
+	if err != nil {
+		return nil, err
+	}
+
+	if len(lines) == 0 {
+		return nil, fmt.Errorf("reservation not found")
+	}
+
+	if lines[0].UserID != userID {
+		return nil, fmt.Errorf("forbidden: you can only release your own reservations")
+	}
+
+	now := time.Now().UTC()
+	for i := range lines {
+		if lines[i].Status != ReservationActive {
+			continue
+		}
+		released, err := releaseReservationLine(ctx, lines[i], now, false)
+		if err != nil {
+			return nil, err
+		}
+		if released {
+			lines[i].Status = ReservationReleased
+		}
+	}
+
+	return toModelReservation(reservationID, lines), nil
+}
+
+// runReservationSweeper releases expired reservations every interval until
+// ctx is cancelled. Every replica may run one: each release is conditional on
+// the line still being active, so a line is only ever released once.
+func runReservationSweeper(ctx context.Context, interval time.Duration) {
+	log.Printf("🧹 Reservation sweeper started (every %s)", interval)
+
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ctx.Done():
+			log.Println("Reservation sweeper stopped")
+			return
+		case <-ticker.C:
+			released, err := sweepExpiredReservations(ctx, time.Now().UTC())
+			if err != nil {
+				log.Printf("Warning: reservation sweep failed: %v", err)
+				continue
+			}
+			if released > 0 {
+				log.Printf("🧹 Released %d expired reservation lines", released)
+			}
+		}
+	}
+}
+
+// sweepExpiredReservations releases every active reservation line that expired
+// before now and returns how many were released.
+func sweepExpiredReservations(ctx context.Context, now time.Time) (int, error) {
+	input := &dynamodb.QueryInput{
+		TableName:              aws.String(reservationsTable),
+		IndexName:              aws.String(reservationStatusIndex),
+		KeyConditionExpression: aws.String("#status = :active AND expiresAt <= :now"),
+		ExpressionAttributeNames: map[string]string{
+			"#status": "status",
+		},
+		ExpressionAttributeValues: map[string]types.AttributeValue{
+			":active": &types.AttributeValueMemberS{Value: ReservationActive},
+			":now":    &types.AttributeValueMemberN{Value: fmt.Sprintf("%d", now.Unix())},
+		},
+	}
+
+	released := 0
+	for {
+		result, err := dynamoClient.Query(ctx, input)
+		if err != nil {
+			return released, fmt.Errorf("failed to query expired reservations: %w", err)
+		}
+
+		for _, item := range result.Items {
+			var line DynamoReservation
+			if err := attributevalue.UnmarshalMap(item, &line); err != nil {
+				log.Printf("Warning: failed to unmarshal reservation: %v", err)
+				continue
+			}
+
+			ok, err := releaseReservationLine(ctx, line, now, true)
+			if err != nil {
+				log.Printf("Warning: failed to release reservation %s/%s: %v", line.ReservationID, line.ProductID, err)
+				continue
+			}
+			if ok {
+				released++
+			}
+		}
+
+		if len(result.LastEvaluatedKey) == 0 {
+			return released, nil
+		}
+		input.ExclusiveStartKey = result.LastEvaluatedKey
+	}
+}
+
+// releaseReservationLine gives a line's units back to the product and marks it
+// released. It reports false when the line was no longer active (already
+// committed or released by someone else). With onlyExpired set, the release
+// also requires the line to have expired by now.
+func releaseReservationLine(ctx context.Context, line DynamoReservation, now time.Time, onlyExpired bool) (bool, error) {
+	reservationUpdate := releaseReservationUpdate(line, now, onlyExpired)
+
+	_, err := dynamoClient.TransactWriteItems(ctx, &dynamodb.TransactWriteItemsInput{
+		TransactItems: []types.TransactWriteItem{
+			{Update: releaseProductUpdate(line, now)},
+			{Update: reservationUpdate},
+		},
+	})
+	if err == nil {
+		return true, nil
+	}
+
+	failed := failedTransactionItems(err)
+	if failed == nil {
+		return false, fmt.Errorf("failed to release reservation: %w", err)
+	}
+	for _, index := range failed {
+		if index == 1 {
+			// The line changed state first; nothing to release
+			return false, nil
+		}
+	}
+
+	// The product no longer holds these units (e.g. it was deleted), so only
+	// the reservation line is closed.
+	log.Printf("Warning: product %s does not hold %d reserved units for %s; closing reservation only",
+		line.ProductID, line.Quantity, line.ReservationID)
+	_, err = dynamoClient.UpdateItem(ctx, &dynamodb.UpdateItemInput{
+		TableName:                 reservationUpdate.TableName,
+		Key:                       reservationUpdate.Key,
+		UpdateExpression:          reservationUpdate.UpdateExpression,
+		ConditionExpression:       reservationUpdate.ConditionExpression,
+		ExpressionAttributeNames:  reservationUpdate.ExpressionAttributeNames,
+		ExpressionAttributeValues: reservationUpdate.ExpressionAttributeValues,
+	})
+	if err != nil {
+		var conditionFailed *types.ConditionalCheckFailedException
+		if errors.As(err, &conditionFailed) {
+			return false, nil
+		}
+		return false, fmt.Errorf("failed to release reservation: %w", err)
+	}
+
+	return true, nil
+}
+
+// getReservationLines loads every line of a reservation.
+func getReservationLines(ctx context.Context, reservationID string) ([]DynamoReservation, error) {
+	input := &dynamodb.QueryInput{
+		TableName:              aws.String(reservationsTable),
+		KeyConditionExpression: aws.String("reservationId = :reservationId"),
+		ExpressionAttributeValues: map[string]types.AttributeValue{
+			":reservationId": &types.AttributeValueMemberS{Value: reservationID},
+		},
+	}
+
+	var lines []DynamoReservation
+	for {
+		result, err := dynamoClient.Query(ctx, input)
+		if err != nil {
+			return nil, fmt.Errorf("failed to get reservation: %w", err)
+		}
+
+		for _, item := range result.Items {
+			var line DynamoReservation
+			if err := attributevalue.UnmarshalMap(item, &line); err != nil {
+				return nil, fmt.Errorf("failed to unmarshal reservation: %w", err)
+			}
+			lines = append(lines, line)
+		}
+
+		if len(result.LastEvaluatedKey) == 0 {
+			return lines, nil
+		}
+		input.ExclusiveStartKey = result.LastEvaluatedKey
+	}
+}
+
+// authenticatedUserID returns the subject of the request's JWT.
+func authenticatedUserID(ctx context.Context) (string, error) {
+	ginCtx, ok := ctx.Value("GinContextKey").(*gin.Context)
+	if !ok {
+		return "", fmt.Errorf("unauthorized: missing authentication")
+	}
+
+	userID, exists := ginCtx.Get("sellerId") // Subject of the token, buyer or seller
+	if !exists {
+		return "", fmt.Errorf("unauthorized: missing user ID in token")
+	}
+
+	return userID.(string), nil
+}
+
+// aggregateStockItems validates the requested items and merges repeated
+// products, keeping the order in which products first appear.
+func aggregateStockItems(items []*model.StockItemInput) ([]stockLine, error) {
+	if len(items) == 0 {
+		return nil, fmt.Errorf("at least one item is required")
+	}
+
+	var lines []stockLine
+	index := make(map[string]int, len(items))
+	for _, item := range items {
+		if item == nil || item.ProductID == "" {
+			return nil, fmt.Errorf("productId is required")
+		}
+		if item.Quantity <= 0 {
+			return nil, fmt.Errorf("quantity for product %s must be positive", item.ProductID)
+		}
+
+		if i, ok := index[item.ProductID]; ok {
+			lines[i].Quantity += item.Quantity
+			continue
+		}
+		index[item.ProductID] = len(lines)
+		lines = append(lines, stockLine{ProductID: item.ProductID, Quantity: item.Quantity})
+	}
+
+	if len(lines) > maxReservationProducts {
+		return nil, fmt.Errorf("too many products: at most %d per reservation", maxReservationProducts)
+	}
+
+	return lines, nil
+}
+
+// availableStock is the number of units of a product that are not reserved.
+func availableStock(product DynamoProduct) int {
+	if product.Stock <= product.Reserved {
+		return 0
+	}
+	return product.Stock - product.Reserved
+}
+
+// checkAvailability verifies every line's product exists and has enough
+// unreserved stock.
+func checkAvailability(lines []stockLine, products map[string]DynamoProduct) error {
+	for _, line := range lines {
+		product, ok := products[line.ProductID]
+		if !ok {
+			return fmt.Errorf("product not found: %s", line.ProductID)
+		}
+		if available := availableStock(product); available < line.Quantity {
+			return fmt.Errorf("%w for product %s: available=%d, requested=%d",
+				ErrInsufficientStock, line.ProductID, available, line.Quantity)
+		}
+	}
+	return nil
+}
+
+// buildReserveTransaction builds the transaction that holds stock for every
+// line: for each product, an update raising its reserved count followed by the
+// put of the reservation line. Each update is conditional on the reserved
+// count read from the product being unchanged and the new count fitting in
+// stock, so a concurrent reservation makes the whole transaction fail instead
+// of overselling.
+func buildReserveTransaction(reservationID, userID string, lines []stockLine, products map[string]DynamoProduct, now, expiresAt time.Time) (*dynamodb.TransactWriteItemsInput, error) {
+	timestamp := now.Format(time.RFC3339)
+	items := make([]types.TransactWriteItem, 0, 2*len(lines))
+
+	for _, line := range lines {
+		product := products[line.ProductID]
+		newReserved := product.Reserved + line.Quantity
+
+		// Products created before reservations existed have no reserved attribute
+		reservedUnchanged := "reserved = :reserved"
+		if product.Reserved == 0 {
+			reservedUnchanged = "(attribute_not_exists(reserved) OR reserved = :reserved)"
+		}
+
+		items = append(items, types.TransactWriteItem{
+			Update: &types.Update{
+				TableName: aws.String(productsTable),
+				Key: map[string]types.AttributeValue{
+					"productId": &types.AttributeValueMemberS{Value: line.ProductID},
+				},
+				UpdateExpression:    aws.String("SET reserved = :newReserved, updatedAt = :updatedAt"),
+				ConditionExpression: aws.String("attribute_exists(productId) AND stock >= :newReserved AND " + reservedUnchanged),
+				ExpressionAttributeValues: map[string]types.AttributeValue{
+					":reserved":    &types.AttributeValueMemberN{Value: fmt.Sprintf("%d", product.Reserved)},
+					":newReserved": &types.AttributeValueMemberN{Value: fmt.Sprintf("%d", newReserved)},
+					":updatedAt":   &types.AttributeValueMemberS{Value: timestamp},
+				},
+			},
+		})
+
+		reservation, err := attributevalue.MarshalMap(DynamoReservation{
+			ReservationID: reservationID,
+			ProductID:     line.ProductID,
+			UserID:        userID,
+			Quantity:      line.Quantity,
+			Status:        ReservationActive,
+			ExpiresAt:     expiresAt.Unix(),
+			CreatedAt:     timestamp,
+			UpdatedAt:     timestamp,
+		})
+		if err != nil {
+			return nil, fmt.Errorf("failed to marshal reservation: %w", err)
+		}
+
+		items = append(items, types.TransactWriteItem{
+			Put: &types.Put{
+				TableName:           aws.String(reservationsTable),
+				Item:                reservation,
+				ConditionExpression: aws.String("attribute_not_exists(reservationId)"),
+			},
+		})
+	}
+
+	return &dynamodb.TransactWriteItemsInput{TransactItems: items}, nil
+}
+
+// releaseProductUpdate returns a line's units to the product's unreserved stock.
+func releaseProductUpdate(line DynamoReservation, now time.Time) *types.Update {
+	return &types.Update{
+		TableName: aws.String(productsTable),
+		Key: map[string]types.AttributeValue{
+			"productId": &types.AttributeValueMemberS{Value: line.ProductID},
+		},
+		UpdateExpression:    aws.String("SET reserved = reserved - :qty, updatedAt = :updatedAt"),
+		ConditionExpression: aws.String("reserved >= :qty"),
+		ExpressionAttributeValues: map[string]types.AttributeValue{
+			":qty":       &types.AttributeValueMemberN{Value: fmt.Sprintf("%d", line.Quantity)},
+			":updatedAt": &types.AttributeValueMemberS{Value: now.Format(time.RFC3339)},
+		},
+	}
+}
+
+// releaseReservationUpdate marks an active line released and schedules it for
+// deletion by TTL.
+func releaseReservationUpdate(line DynamoReservation, now time.Time, onlyExpired bool) *types.Update {
+	condition := "#status = :active"
+	values := map[string]types.AttributeValue{
+		":active":    &types.AttributeValueMemberS{Value: ReservationActive},
+		":released":  &types.AttributeValueMemberS{Value: ReservationReleased},
+		":updatedAt": &types.AttributeValueMemberS{Value: now.Format(time.RFC3339)},
+		":ttl":       &types.AttributeValueMemberN{Value: fmt.Sprintf("%d", now.Add(reservationRetention).Unix())},
+	}
+	if onlyExpired {
+		condition += " AND expiresAt <= :now"
+		values[":now"] = &types.AttributeValueMemberN{Value: fmt.Sprintf("%d", now.Unix())}
+	}
+
+	return &types.Update{
+		TableName: aws.String(reservationsTable),
+		Key: map[string]types.AttributeValue{
+			"reservationId": &types.AttributeValueMemberS{Value: line.ReservationID},
+			"productId":     &types.AttributeValueMemberS{Value: line.ProductID},
+		},
+		UpdateExpression:    aws.String("SET #status = :released, updatedAt = :updatedAt, #ttl = :ttl"),
+		ConditionExpression: aws.String(condition),
+		ExpressionAttributeNames: map[string]string{
+			"#status": "status", // 'status' and 'ttl' are reserved keywords in DynamoDB
+			"#ttl":    "ttl",
+		},
+		ExpressionAttributeValues: values,
+	}
+}
+
+// failedTransactionItems returns the indexes of the transaction items whose
+// condition check failed, or nil when err is not a cancelled transaction
+// caused by conditions.
+func failedTransactionItems(err error) []int {
+	var cancelled *types.TransactionCanceledException
+	if !errors.As(err, &cancelled) {
+		return nil
+	}
+
+	var failed []int
+	for i, reason := range cancelled.CancellationReasons {
+		if aws.ToString(reason.Code) == "ConditionalCheckFailed" {
+			failed = append(failed, i)
+		}
+	}
+	return failed
+}
+
+// toModelReservation converts reservation lines to the GraphQL type.
+func toModelReservation(reservationID string, lines []DynamoReservation) *model.Reservation {
+	reservation := &model.Reservation{
+		ReservationID: reservationID,
+		Items:         make([]*model.ReservationItem, 0, len(lines)),
+	}
+
+	for _, line := range lines {
+		if reservation.ExpiresAt == "" {
+			reservation.ExpiresAt = time.Unix(line.ExpiresAt, 0).UTC().Format(time.RFC3339)
+		}
+		reservation.Items = append(reservation.Items, &model.ReservationItem{
+			ProductID: line.ProductID,
+			Quantity:  line.Quantity,
+			Status:    line.Status,
+		})
+	}
+
+	return reservation
+}
@@ -0,0 +1,167 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"testing"
+	"time"
+
+	"product_service/graph/model"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/service/dynamodb/types"
+	"github.com/gin-gonic/gin"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestAggregateStockItems(t *testing.T) {
+	lines, err := aggregateStockItems([]*model.StockItemInput{
+		{ProductID: "p1", Quantity: 2},
+		{ProductID: "p2", Quantity: 1},
+		{ProductID: "p1", Quantity: 3},
+	})
+	require.NoError(t, err)
+	assert.Equal(t, []stockLine{{ProductID: "p1", Quantity: 5}, {ProductID: "p2", Quantity: 1}}, lines)
+
+	tests := []struct {
+		name  string
+		items []*model.StockItemInput
+	}{
+		{name: "empty", items: nil},
+		{name: "missing_product", items: []*model.StockItemInput{{Quantity: 1}}},
+		{name: "zero_quantity", items: []*model.StockItemInput{{ProductID: "p1", Quantity: 0}}},
+		{name: "negative_quantity", items: []*model.StockItemInput{{ProductID: "p1", Quantity: -2}}},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			_, err := aggregateStockItems(tt.items)
+			assert.Error(t, err)
+		})
+	}
+
+	tooMany := make([]*model.StockItemInput, maxReservationProducts+1)
+	for i := range tooMany {
+		tooMany[i] = &model.StockItemInput{ProductID: fmt.Sprintf("p%d", i), Quantity: 1}
+	}
+	_, err = aggregateStockItems(tooMany)
+	assert.ErrorContains(t, err, "too many products")
+}
+
+func TestAvailableStock(t *testing.T) {
+	assert.Equal(t, 7, availableStock(DynamoProduct{Stock: 10, Reserved: 3}))
+	assert.Equal(t, 10, availableStock(DynamoProduct{Stock: 10}))
+	assert.Equal(t, 0, availableStock(DynamoProduct{Stock: 2, Reserved: 5}), "stock lowered below reservations")
+}
+
+func TestCheckAvailability(t *testing.T) {
+	products := map[string]DynamoProduct{
+		"p1": {ProductID: "p1", Stock: 10, Reserved: 8},
+		"p2": {ProductID: "p2", Stock: 5},
+	}
+
+	assert.NoError(t, checkAvailability([]stockLine{{"p1", 2}, {"p2", 5}}, products))
+
+	err := checkAvailability([]stockLine{{"p1", 3}}, products)
+	assert.True(t, errors.Is(err, ErrInsufficientStock))
+	assert.ErrorContains(t, err, "available=2, requested=3")
+
+	err = checkAvailability([]stockLine{{"missing", 1}}, products)
+	assert.ErrorContains(t, err, "product not found: missing")
+}
+
+func TestBuildReserveTransaction(t *testing.T) {
+	now := time.Date(2026, 3, 1, 12, 0, 0, 0, time.UTC)
+	expiresAt := now.Add(15 * time.Minute)
+	products := map[string]DynamoProduct{
+		"p1": {ProductID: "p1", Stock: 10, Reserved: 4},
+		"p2": {ProductID: "p2", Stock: 5},
+	}
+
+	input, err := buildReserveTransaction("checkout-1", "user-1", []stockLine{{"p1", 2}, {"p2", 1}}, products, now, expiresAt)
+	require.NoError(t, err)
+	require.Len(t, input.TransactItems, 4)
+
+	// Product update guarded on the reserved count that was read
+	update := input.TransactItems[0].Update
+	require.NotNil(t, update)
+	assert.Equal(t, "attribute_exists(productId) AND stock >= :newReserved AND reserved = :reserved", aws.ToString(update.ConditionExpression))
+	assert.Equal(t, "4", update.ExpressionAttributeValues[":reserved"].(*types.AttributeValueMemberN).Value)
+	assert.Equal(t, "6", update.ExpressionAttributeValues[":newReserved"].(*types.AttributeValueMemberN).Value)
+
+	// Reservation line written only if it does not exist yet
+	put := input.TransactItems[1].Put
+	require.NotNil(t, put)
+	assert.Equal(t, "attribute_not_exists(reservationId)", aws.ToString(put.ConditionExpression))
+	assert.Equal(t, "checkout-1", put.Item["reservationId"].(*types.AttributeValueMemberS).Value)
+	assert.Equal(t, "p1", put.Item["productId"].(*types.AttributeValueMemberS).Value)
+	assert.Equal(t, ReservationActive, put.Item["status"].(*types.AttributeValueMemberS).Value)
+	assert.Equal(t, fmt.Sprintf("%d", expiresAt.Unix()), put.Item["expiresAt"].(*types.AttributeValueMemberN).Value)
+	_, hasTTL := put.Item["ttl"]
+	assert.False(t, hasTTL, "active lines must not be deleted by TTL")
+
+	// A product without a reserved attribute yet
+	assert.Contains(t, aws.ToString(input.TransactItems[2].Update.ConditionExpression), "attribute_not_exists(reserved)")
+}
+
+func TestReleaseReservationUpdate(t *testing.T) {
+	now := time.Date(2026, 3, 1, 12, 0, 0, 0, time.UTC)
+	line := DynamoReservation{ReservationID: "checkout-1", ProductID: "p1", Quantity: 2, Status: ReservationActive}
+
+	update := releaseReservationUpdate(line, now, false)
+	assert.Equal(t, "#status = :active", aws.ToString(update.ConditionExpression))
+
+	expired := releaseReservationUpdate(line, now, true)
+	assert.Equal(t, "#status = :active AND expiresAt <= :now", aws.ToString(expired.ConditionExpression))
+	assert.Equal(t, fmt.Sprintf("%d", now.Unix()), expired.ExpressionAttributeValues[":now"].(*types.AttributeValueMemberN).Value)
+	assert.Equal(t, fmt.Sprintf("%d", now.Add(reservationRetention).Unix()), expired.ExpressionAttributeValues[":ttl"].(*types.AttributeValueMemberN).Value)
+
+	product := releaseProductUpdate(line, now)
+	assert.Equal(t, "reserved >= :qty", aws.ToString(product.ConditionExpression))
+	assert.Equal(t, "2", product.ExpressionAttributeValues[":qty"].(*types.AttributeValueMemberN).Value)
+}
+
+func TestFailedTransactionItems(t *testing.T) {
+	err := fmt.Errorf("wrapped: %w", &types.TransactionCanceledException{
+		CancellationReasons: []types.CancellationReason{
+			{Code: aws.String("None")},
+			{Code: aws.String("ConditionalCheckFailed")},
+			{Code: aws.String("None")},
+			{Code: aws.String("ConditionalCheckFailed")},
+		},
+	})
+	assert.Equal(t, []int{1, 3}, failedTransactionItems(err))
+
+	assert.Nil(t, failedTransactionItems(errors.New("throttled")))
+}
+
+func TestToModelReservation(t *testing.T) {
+	expiresAt := time.Date(2026, 3, 1, 12, 15, 0, 0, time.UTC)
+	reservation := toModelReservation("checkout-1", []DynamoReservation{
+		{ProductID: "p1", Quantity: 2, Status: ReservationActive, ExpiresAt: expiresAt.Unix()},
+		{ProductID: "p2", Quantity: 1, Status: ReservationCommitted, ExpiresAt: expiresAt.Unix()},
+	})
+
+	assert.Equal(t, "checkout-1", reservation.ReservationID)
+	assert.Equal(t, "2026-03-01T12:15:00Z", reservation.ExpiresAt)
+	require.Len(t, reservation.Items, 2)
+	assert.Equal(t, "p2", reservation.Items[1].ProductID)
+	assert.Equal(t, ReservationCommitted, reservation.Items[1].Status)
+}
+
+func TestReservationMutationsRequireAuthentication(t *testing.T) {
+	resolver := &mutationResolver{&Resolver{}}
+	items := []*model.StockItemInput{{ProductID: "p1", Quantity: 1}}
+
+	_, err := resolver.ReserveStock(context.Background(), "checkout-1", items)
+	assert.ErrorContains(t, err, "unauthorized")
+
+	gin.SetMode(gin.TestMode)
+	ginCtx, _ := gin.CreateTestContext(nil)
+	ctx := context.WithValue(context.Background(), "GinContextKey", ginCtx)
+
+	_, err = resolver.ReleaseReservation(ctx, "checkout-1")
+	assert.ErrorContains(t, err, "unauthorized")
+}
@@ -1,7 +1,7 @@
 // Package main provides the entry point for the seller microservice.
 // This service handles seller-specific operations: authentication,
-// product management (via ProductService GraphQL), and order management
-// (via OrderService REST). JWT validation uses Cognito JWKS.
+// product management (via ProductService GraphQL), and order and coupon
+// management (via OrderService REST). JWT validation uses Cognito JWKS.
 //
 // Suggested folder structure for scaling:
 //
@@ -29,13 +29,17 @@ import (
 	"crypto/rsa"
 	"crypto/sha256"
 	"encoding/base64"
+	"encoding/csv"
 	"encoding/json"
 	"fmt"
 	"io"
 	"log"
+	"math"
 	"math/big"
 	"net/http"
+	neturl "net/url"
 	"os"
+	"strconv"
 	"strings"
 	"sync"
 	"time"
@@ -79,12 +83,60 @@ type SellerRegisterResponse struct {
 	UserSub string `json:"userSub"`
 }
 
+// Money is an exact amount in minor units (cents) of an ISO 4217 currency, as
+// used by ProductService and OrderService. An empty currency means their
+// default currency.
+type Money struct {
+	Amount   int64  `json:"amount"`
+	Currency string `json:"currency,omitempty"`
+}
+
+// UnmarshalJSON also accepts a plain number in major units, as prices were
+// sent before they had a currency.
+func (m *Money) UnmarshalJSON(data []byte) error {
+	var legacy float64
+	if err := json.Unmarshal(data, &legacy); err == nil {
+		*m = Money{Amount: int64(math.Round(legacy * 100))}
+		return nil
+	}
+
+	type money Money
+	return json.Unmarshal(data, (*money)(m))
+}
+
+// currencyExponents lists the currencies whose minor unit is not a hundredth,
+// as in OrderService.
+var currencyExponents = map[string]int{
+	"BHD": 3, "JOD": 3, "KWD": 3, "OMR": 3, "TND": 3,
+	"JPY": 0, "KRW": 0, "VND": 0, "CLP": 0, "ISK": 0,
+}
+
+// Decimal formats the amount in major units, e.g. "17997.00".
+func (m Money) Decimal() string {
+	exp, ok := currencyExponents[m.Currency]
+	if !ok {
+		exp = 2
+	}
+	sign := ""
+	amount := m.Amount
+	if amount < 0 {
+		sign = "-"
+		amount = -amount
+	}
+	if exp == 0 {
+		return fmt.Sprintf("%s%d", sign, amount)
+	}
+
+	unit := int64(math.Pow10(exp))
+	return fmt.Sprintf("%s%d.%0*d", sign, amount/unit, exp, amount%unit)
+}
+
 // AddProductInput represents the expected JSON body for adding a product.
 type AddProductInput struct {
-	Name        string  `json:"name" binding:"required"`
-	Price       float64 `json:"price" binding:"required"`
-	Description string  `json:"description" binding:"required"`
-	Stock       int     `json:"stock" binding:"required"`
+	Name        string `json:"name" binding:"required"`
+	Price       *Money `json:"price" binding:"required"`
+	Description string `json:"description" binding:"required"`
+	Stock       int    `json:"stock" binding:"required"`
 }
 
 // AddProductResponse represents the response after adding a product.
@@ -94,30 +146,155 @@ type AddProductResponse struct {
 
 // EditProductInput represents the expected JSON body for editing a product.
 type EditProductInput struct {
-	Name        *string  `json:"name,omitempty"`
-	Price       *float64 `json:"price,omitempty"`
-	Description *string  `json:"description,omitempty"`
-	Stock       *int     `json:"stock,omitempty"`
+	Name        *string `json:"name,omitempty"`
+	Price       *Money  `json:"price,omitempty"`
+	Description *string `json:"description,omitempty"`
+	Stock       *int    `json:"stock,omitempty"`
 }
 
-// OrderItem represents an item in an order.
+// OrderItem represents an item in an order, with name and unit price as they
+// were when the order was placed.
 type OrderItem struct {
-	ProductID string  `json:"productId"`
-	Name      string  `json:"name"`
-	Quantity  int     `json:"quantity"`
-	Price     float64 `json:"price"`
+	ProductID string `json:"productId"`
+	Name      string `json:"name"`
+	Quantity  int    `json:"quantity"`
+	Price     Money  `json:"price"`
+	LineTotal Money  `json:"lineTotal"`
+}
+
+// Address is the postal address an order ships to, as snapshotted by
+// OrderService when the order was placed.
+type Address struct {
+	Name       string `json:"name,omitempty"`
+	Line1      string `json:"line1,omitempty"`
+	Line2      string `json:"line2,omitempty"`
+	City       string `json:"city,omitempty"`
+	Region     string `json:"region,omitempty"`
+	PostalCode string `json:"postalCode,omitempty"`
+	Country    string `json:"country"`
+	Phone      string `json:"phone,omitempty"`
 }
 
 // Order represents an order from OrderService.
 type Order struct {
-	OrderID string      `json:"orderId"`
-	Status  string      `json:"status"`
-	Items   []OrderItem `json:"items"`
+	OrderID         string      `json:"orderId"`
+	Status          string      `json:"status"`
+	Items           []OrderItem `json:"items"`
+	TotalPrice      Money       `json:"totalPrice"`
+	ShippingAddress *Address    `json:"shippingAddress,omitempty"`
+	CreatedAt       time.Time   `json:"createdAt"`
+	Version         int64       `json:"version"`
+}
+
+// OrderPage represents a page of orders from OrderService.
+type OrderPage struct {
+	Orders     []Order `json:"orders"`
+	NextCursor string  `json:"nextCursor,omitempty"`
 }
 
 // UpdateOrderStatusInput represents the expected JSON body for updating order status.
+// Marking an order shipped ships every unit left on it, optionally with a
+// carrier and tracking number.
 type UpdateOrderStatusInput struct {
-	Status string `json:"status" binding:"required"`
+	Status         string `json:"status" binding:"required"`
+	Carrier        string `json:"carrier,omitempty"`
+	TrackingNumber string `json:"trackingNumber,omitempty"`
+}
+
+// ShipmentItem is a quantity of one of the order's products in a shipment.
+type ShipmentItem struct {
+	ProductID string `json:"productId" binding:"required"`
+	Quantity  int    `json:"quantity" binding:"required,min=1"`
+}
+
+// CreateShipmentInput represents the expected JSON body for shipping part or
+// all of an order. Without Items the shipment covers every unit left to ship.
+type CreateShipmentInput struct {
+	Carrier        string         `json:"carrier" binding:"required"`
+	TrackingNumber string         `json:"trackingNumber" binding:"required"`
+	Items          []ShipmentItem `json:"items,omitempty" binding:"dive"`
+}
+
+// ReturnActionInput represents the optional JSON body of a return action. A
+// note is required to reject a return; Restock only applies when receiving
+// one.
+type ReturnActionInput struct {
+	Note    string `json:"note,omitempty"`
+	Restock bool   `json:"restock,omitempty"`
+}
+
+// CreateCouponInput represents the expected JSON body for creating a coupon.
+// Type is "percentage" (using Value), "fixed" (using Amount), or "buy_x_get_y"
+// (using BuyQuantity and GetQuantity). Without ProductIDs the coupon applies
+// to all of the seller's products. Limits of 0 mean unlimited.
+type CreateCouponInput struct {
+	Code          string     `json:"code" binding:"required"`
+	Type          string     `json:"type" binding:"required"`
+	Value         float64    `json:"value,omitempty"`
+	Amount        *Money     `json:"amount,omitempty"`
+	BuyQuantity   int        `json:"buyQuantity,omitempty"`
+	GetQuantity   int        `json:"getQuantity,omitempty"`
+	ProductIDs    []string   `json:"productIds,omitempty"`
+	UsageLimit    int        `json:"usageLimit,omitempty"`
+	PerBuyerLimit int        `json:"perBuyerLimit,omitempty"`
+	StartsAt      *time.Time `json:"startsAt,omitempty"`
+	EndsAt        *time.Time `json:"endsAt,omitempty"`
+}
+
+// WebhookInput represents the expected JSON body for creating a webhook. The
+// URL must use HTTPS; EventTypes may be "*" for every event.
+type WebhookInput struct {
+	URL        string   `json:"url" binding:"required"`
+	EventTypes []string `json:"eventTypes" binding:"required,min=1"`
+}
+
+// UpdateWebhookInput represents the expected JSON body for changing a
+// webhook. Omitted fields are left as they are.
+type UpdateWebhookInput struct {
+	URL        *string  `json:"url,omitempty"`
+	EventTypes []string `json:"eventTypes,omitempty"`
+	Active     *bool    `json:"active,omitempty"`
+}
+
+// SalesBucket holds a seller's sales figures for one period, or for the whole
+// range when Period is empty.
+type SalesBucket struct {
+	Period            string `json:"period,omitempty"`
+	Orders            int64  `json:"orders"`
+	Units             int64  `json:"units"`
+	Revenue           Money  `json:"revenue"`
+	AverageOrderValue Money  `json:"averageOrderValue"`
+}
+
+// SalesReport represents OrderService's sales over time for a seller.
+type SalesReport struct {
+	From     string        `json:"from"`
+	To       string        `json:"to"`
+	Interval string        `json:"interval"`
+	Timezone string        `json:"timezone"`
+	Currency string        `json:"currency"`
+	Totals   SalesBucket   `json:"totals"`
+	Buckets  []SalesBucket `json:"buckets"`
+}
+
+// ProductSales holds the sales figures of one product.
+type ProductSales struct {
+	ProductID string `json:"productId"`
+	Name      string `json:"name"`
+	Units     int64  `json:"units"`
+	Orders    int64  `json:"orders"`
+	Revenue   Money  `json:"revenue"`
+}
+
+// TopProductsReport represents OrderService's best-selling products for a
+// seller.
+type TopProductsReport struct {
+	From     string         `json:"from"`
+	To       string         `json:"to"`
+	Timezone string         `json:"timezone"`
+	Currency string         `json:"currency"`
+	Sort     string         `json:"sort"`
+	Products []ProductSales `json:"products"`
 }
 
 // HealthResponse represents the health check response.
@@ -136,13 +313,13 @@ type ErrorResponse struct {
 
 // Config holds all service configuration loaded from environment variables.
 type Config struct {
-	CognitoUserPoolID string
-	CognitoClientID   string
+	CognitoUserPoolID   string
+	CognitoClientID     string
 	CognitoClientSecret string
-	CognitoRegion     string
-	ProductGraphQLURL string
-	OrderRESTURL      string
-	Port              string
+	CognitoRegion       string
+	ProductGraphQLURL   string
+	OrderRESTURL        string
+	Port                string
 }
 
 var config Config
@@ -372,6 +549,12 @@ func graphQLRequest(ctx context.Context, query string, variables map[string]inte
 
 // authenticatedHTTPRequest sends an HTTP request with the auth header forwarded.
 func authenticatedHTTPRequest(method, url string, body interface{}, authHeader string) (*http.Response, error) {
+	return authenticatedHTTPRequestWithHeaders(method, url, body, authHeader, nil)
+}
+
+// authenticatedHTTPRequestWithHeaders is authenticatedHTTPRequest with extra
+// request headers, such as a forwarded If-Match.
+func authenticatedHTTPRequestWithHeaders(method, url string, body interface{}, authHeader string, headers http.Header) (*http.Response, error) {
 	var bodyReader io.Reader
 	if body != nil {
 		jsonBody, err := json.Marshal(body)
@@ -386,6 +569,11 @@ func authenticatedHTTPRequest(method, url string, body interface{}, authHeader s
 		return nil, err
 	}
 
+	for key, values := range headers {
+		for _, value := range values {
+			req.Header.Add(key, value)
+		}
+	}
 	req.Header.Set("Content-Type", "application/json")
 	if authHeader != "" {
 		req.Header.Set("Authorization", authHeader)
@@ -675,15 +863,19 @@ func HandleAddProduct(c *gin.Context) {
 
 // HandleEditProduct godoc
 // @Summary Edit an existing product
-// @Description Updates product fields via ProductService GraphQL, verifies seller ownership
+// @Description Updates product fields via ProductService GraphQL, verifies seller ownership. Send the product's version in If-Match to reject the edit if someone changed the product since it was read.
 // @Tags products
 // @Accept json
 // @Produce json
 // @Param productId path string true "Product ID"
+// @Param If-Match header string false "Product version the edit expects, as returned in ETag"
 // @Param request body EditProductInput true "Fields to update"
-// @Success 200 {object} map[string]string
+// @Success 200 {object} map[string]interface{}
+// @Header 200 {string} ETag "New product version"
 // @Failure 400 {object} ErrorResponse
 // @Failure 401 {object} ErrorResponse
+// @Failure 409 {object} ErrorResponse
+// @Failure 412 {object} ErrorResponse
 // @Failure 500 {object} ErrorResponse
 // @Router /editProduct/{productId} [put]
 func HandleEditProduct(c *gin.Context) {
@@ -699,6 +891,12 @@ func HandleEditProduct(c *gin.Context) {
 		return
 	}
 
+	expectedVersion, err := parseIfMatch(c.GetHeader("If-Match"))
+	if err != nil {
+		c.JSON(http.StatusBadRequest, ErrorResponse{Error: err.Error()})
+		return
+	}
+
 	authHeader := c.GetHeader("Authorization")
 
 	// Step 1: Verify ownership via GraphQL query
@@ -739,35 +937,99 @@ func HandleEditProduct(c *gin.Context) {
 	if input.Stock != nil {
 		editInput["stock"] = *input.Stock
 	}
+	if expectedVersion != 0 {
+		editInput["expectedVersion"] = expectedVersion
+	}
 
 	editQuery := `mutation EditProduct($input: EditProductInput!) {
-		editProduct(input: $input) { productId }
+		editProduct(input: $input) { productId version }
 	}`
 
 	editVars := map[string]interface{}{"input": editInput}
-	_, err = graphQLRequest(context.Background(), editQuery, editVars, authHeader)
+	editData, err := graphQLRequest(context.Background(), editQuery, editVars, authHeader)
+	if isVersionConflict(err) {
+		c.JSON(http.StatusPreconditionFailed, ErrorResponse{Error: "Failed to update product: " + err.Error()})
+		return
+	}
+	if isStockBelowReserved(err) {
+		c.JSON(http.StatusConflict, ErrorResponse{Error: "Failed to update product: " + err.Error()})
+		return
+	}
 	if err != nil {
 		c.JSON(http.StatusInternalServerError, ErrorResponse{Error: "Failed to update product: " + err.Error()})
 		return
 	}
 
-	c.JSON(http.StatusOK, gin.H{"message": "Product updated successfully", "productId": productID})
+	// Extract the new version from the response
+	var version int64
+	if edited, ok := editData["editProduct"].(map[string]interface{}); ok {
+		if v, ok := edited["version"].(float64); ok {
+			version = int64(v)
+		}
+	}
+
+	c.Header("ETag", fmt.Sprintf(`"%d"`, version))
+	c.JSON(http.StatusOK, gin.H{"message": "Product updated successfully", "productId": productID, "version": version})
+}
+
+// parseIfMatch reads the version from an If-Match header, as sent back from
+// an ETag. An empty header or "*" returns 0, meaning any version.
+func parseIfMatch(header string) (int64, error) {
+	header = strings.TrimSpace(header)
+	if header == "" || header == "*" {
+		return 0, nil
+	}
+
+	tag := strings.TrimPrefix(header, "W/")
+	if len(tag) >= 2 && tag[0] == '"' && tag[len(tag)-1] == '"' {
+		if version, err := strconv.ParseInt(tag[1:len(tag)-1], 10, 64); err == nil && version > 0 {
+			return version, nil
+		}
+	}
+	return 0, fmt.Errorf(`If-Match must be a single quoted version such as "3"`)
+}
+
+// isVersionConflict reports whether a ProductService error is an edit
+// rejected because the product is no longer at the expected version.
+func isVersionConflict(err error) bool {
+	return err != nil && strings.Contains(err.Error(), "version conflict")
+}
+
+// isStockBelowReserved reports whether a ProductService error is an edit
+// rejected because it would set stock below the quantity reserved.
+func isStockBelowReserved(err error) bool {
+	return err != nil && strings.Contains(err.Error(), "stock below reserved")
 }
 
 // HandleGetOrders godoc
 // @Summary Get seller's orders
-// @Description Fetches orders from OrderService REST API for the authenticated seller
+// @Description Fetches a page of orders from OrderService REST API for the authenticated seller, with the address each order ships to
 // @Tags orders
 // @Produce json
-// @Success 200 {array} Order
+// @Param limit query int false "Page size (default 20, max 100)"
+// @Param cursor query string false "Cursor from a previous page's nextCursor"
+// @Param status query string false "Comma-separated statuses to include"
+// @Param from query string false "Created at or after (RFC3339 or YYYY-MM-DD)"
+// @Param to query string false "Created before (RFC3339, or YYYY-MM-DD inclusive)"
+// @Param sort query string false "asc or desc by creation time (default desc)"
+// @Success 200 {object} OrderPage
 // @Failure 500 {object} ErrorResponse
 // @Router /orders [get]
 func HandleGetOrders(c *gin.Context) {
 	sellerID := c.GetString("sellerId")
 	authHeader := c.GetHeader("Authorization")
 
+	// Forward pagination, filter and sort parameters
+	query := neturl.Values{}
+	query.Set("sellerId", sellerID)
+	for _, key := range []string{"limit", "cursor", "status", "from", "to", "sort"} {
+		if value := c.Query(key); value != "" {
+			query.Set(key, value)
+		}
+	}
+
 	// Call OrderService REST API with auth header forwarded
-	url := fmt.Sprintf("%s/getOrders?sellerId=%s", config.OrderRESTURL, sellerID)
+	url := fmt.Sprintf("%s/getOrders?%s", config.OrderRESTURL, query.Encode())
 	resp, err := authenticatedHTTPRequest("GET", url, nil, authHeader)
 	if err != nil {
 		c.JSON(http.StatusInternalServerError, ErrorResponse{Error: "Failed to fetch orders: " + err.Error()})
@@ -781,26 +1043,123 @@ func HandleGetOrders(c *gin.Context) {
 		return
 	}
 
-	var orders []Order
-	if err := json.NewDecoder(resp.Body).Decode(&orders); err != nil {
+	var page OrderPage
+	if err := json.NewDecoder(resp.Body).Decode(&page); err != nil {
 		c.JSON(http.StatusInternalServerError, ErrorResponse{Error: "Failed to decode orders response."})
 		return
 	}
 
-	c.JSON(http.StatusOK, orders)
+	c.JSON(http.StatusOK, page)
+}
+
+// exportHTTPClient streams order exports from OrderService. Unlike
+// authenticatedHTTPRequest it has no overall timeout, since an export of a
+// long date range can take minutes, and it relays gzip bodies as they are.
+var exportHTTPClient = func() *http.Client {
+	transport := http.DefaultTransport.(*http.Transport).Clone()
+	transport.ResponseHeaderTimeout = 15 * time.Second
+	transport.DisableCompression = true
+	return &http.Client{Transport: transport}
+}()
+
+// exportHeaders are the OrderService export response headers relayed to the
+// client.
+var exportHeaders = []string{"Content-Type", "Content-Disposition", "Content-Encoding", "Cache-Control", "Vary"}
+
+// HandleExportOrders godoc
+// @Summary Export orders
+// @Description Streams the seller's orders as CSV or NDJSON from OrderService, one row per order line, gzip-encoded when the client accepts it
+// @Tags orders
+// @Produce text/csv
+// @Produce application/x-ndjson
+// @Param format query string false "csv or ndjson (default csv)"
+// @Param status query string false "Comma-separated statuses"
+// @Param from query string false "Created at or after (RFC3339 or YYYY-MM-DD)"
+// @Param to query string false "Created before (RFC3339, or YYYY-MM-DD inclusive)"
+// @Success 200 {string} string "CSV or NDJSON rows"
+// @Failure 400 {object} ErrorResponse
+// @Failure 500 {object} ErrorResponse
+// @Router /orders/export [get]
+func HandleExportOrders(c *gin.Context) {
+	format := strings.ToLower(c.DefaultQuery("format", "csv"))
+	if format != "csv" && format != "ndjson" {
+		c.JSON(http.StatusBadRequest, ErrorResponse{Error: "Invalid format. Use csv or ndjson."})
+		return
+	}
+
+	query := neturl.Values{}
+	query.Set("format", format)
+	for _, key := range []string{"status", "from", "to"} {
+		if value := c.Query(key); value != "" {
+			query.Set(key, value)
+		}
+	}
+
+	// The request is cancelled with the client's, which stops the export
+	url := fmt.Sprintf("%s/seller/orders/export?%s", config.OrderRESTURL, query.Encode())
+	req, err := http.NewRequestWithContext(c.Request.Context(), http.MethodGet, url, nil)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, ErrorResponse{Error: "Failed to export orders: " + err.Error()})
+		return
+	}
+	req.Header.Set("Authorization", c.GetHeader("Authorization"))
+	if encoding := c.GetHeader("Accept-Encoding"); encoding != "" {
+		req.Header.Set("Accept-Encoding", encoding)
+	}
+
+	resp, err := exportHTTPClient.Do(req)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, ErrorResponse{Error: "Failed to export orders: " + err.Error()})
+		return
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		relayOrderServiceResponse(c, resp)
+		return
+	}
+
+	for _, header := range exportHeaders {
+		if value := resp.Header.Get(header); value != "" {
+			c.Header(header, value)
+		}
+	}
+	c.Status(http.StatusOK)
+
+	// Relay the stream as it arrives rather than buffering the export
+	buf := make([]byte, 32*1024)
+	for {
+		n, readErr := resp.Body.Read(buf)
+		if n > 0 {
+			if _, err := c.Writer.Write(buf[:n]); err != nil {
+				return
+			}
+			c.Writer.Flush()
+		}
+		if readErr == io.EOF {
+			return
+		}
+		if readErr != nil {
+			log.Printf("Order export for seller %s was cut short: %v", c.GetString("sellerId"), readErr)
+			return
+		}
+	}
 }
 
 // HandleUpdateOrderStatus godoc
 // @Summary Update order status
-// @Description Updates order status via OrderService REST API, verifies seller ownership
+// @Description Updates order status via OrderService REST API, verifies seller ownership. If-Match is forwarded so the update is rejected if the order changed since it was read.
 // @Tags orders
 // @Accept json
 // @Produce json
 // @Param orderId path string true "Order ID"
+// @Param If-Match header string false "Order version the update expects, as returned in ETag"
 // @Param request body UpdateOrderStatusInput true "New status"
-// @Success 200 {object} map[string]string
+// @Success 200 {object} map[string]interface{}
+// @Header 200 {string} ETag "New order version"
 // @Failure 400 {object} ErrorResponse
 // @Failure 401 {object} ErrorResponse
+// @Failure 412 {object} ErrorResponse
 // @Failure 500 {object} ErrorResponse
 // @Router /updateOrderStatus/{orderId} [put]
 func HandleUpdateOrderStatus(c *gin.Context) {
@@ -832,8 +1191,19 @@ func HandleUpdateOrderStatus(c *gin.Context) {
 		"status":   input.Status,
 		"sellerId": sellerID,
 	}
+	if input.Carrier != "" {
+		payload["carrier"] = input.Carrier
+	}
+	if input.TrackingNumber != "" {
+		payload["trackingNumber"] = input.TrackingNumber
+	}
 
-	resp, err := authenticatedHTTPRequest("PUT", url, payload, authHeader)
+	headers := http.Header{}
+	if ifMatch := c.GetHeader("If-Match"); ifMatch != "" {
+		headers.Set("If-Match", ifMatch)
+	}
+
+	resp, err := authenticatedHTTPRequestWithHeaders("PUT", url, payload, authHeader, headers)
 	if err != nil {
 		c.JSON(http.StatusInternalServerError, ErrorResponse{Error: "Failed to update order status: " + err.Error()})
 		return
@@ -846,7 +1216,609 @@ func HandleUpdateOrderStatus(c *gin.Context) {
 		return
 	}
 
-	c.JSON(http.StatusOK, gin.H{"message": "Order status updated", "orderId": orderID, "status": input.Status})
+	var updated struct {
+		Version int64 `json:"version"`
+	}
+	json.NewDecoder(resp.Body).Decode(&updated)
+
+	if etag := resp.Header.Get("ETag"); etag != "" {
+		c.Header("ETag", etag)
+	}
+	c.JSON(http.StatusOK, gin.H{"message": "Order status updated", "orderId": orderID, "status": input.Status, "version": updated.Version})
+}
+
+// HandleCreateShipment godoc
+// @Summary Ship an order
+// @Description Ships some or all of an order's remaining units with a carrier and tracking number via OrderService REST API
+// @Tags orders
+// @Accept json
+// @Produce json
+// @Param orderId path string true "Order ID"
+// @Param request body CreateShipmentInput true "Carrier, tracking number and lines"
+// @Success 201 {object} map[string]interface{}
+// @Failure 400 {object} ErrorResponse
+// @Failure 404 {object} ErrorResponse
+// @Failure 409 {object} ErrorResponse
+// @Failure 500 {object} ErrorResponse
+// @Router /orders/{orderId}/shipments [post]
+func HandleCreateShipment(c *gin.Context) {
+	var input CreateShipmentInput
+	if err := c.ShouldBindJSON(&input); err != nil {
+		c.JSON(http.StatusBadRequest, ErrorResponse{Error: "Invalid request. Carrier and tracking number are required."})
+		return
+	}
+
+	url := fmt.Sprintf("%s/orders/%s/shipments", config.OrderRESTURL, neturl.PathEscape(c.Param("orderId")))
+	resp, err := authenticatedHTTPRequest("POST", url, input, c.GetHeader("Authorization"))
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, ErrorResponse{Error: "Failed to create shipment: " + err.Error()})
+		return
+	}
+	defer resp.Body.Close()
+
+	relayOrderServiceResponse(c, resp, http.StatusCreated)
+}
+
+// HandleGetShipments godoc
+// @Summary List an order's shipments
+// @Description Lists an order's shipments with their tracking status via OrderService REST API
+// @Tags orders
+// @Produce json
+// @Param orderId path string true "Order ID"
+// @Success 200 {array} map[string]interface{}
+// @Failure 404 {object} ErrorResponse
+// @Failure 500 {object} ErrorResponse
+// @Router /orders/{orderId}/shipments [get]
+func HandleGetShipments(c *gin.Context) {
+	url := fmt.Sprintf("%s/orders/%s/shipments", config.OrderRESTURL, neturl.PathEscape(c.Param("orderId")))
+	resp, err := authenticatedHTTPRequest("GET", url, nil, c.GetHeader("Authorization"))
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, ErrorResponse{Error: "Failed to fetch shipments: " + err.Error()})
+		return
+	}
+	defer resp.Body.Close()
+
+	relayOrderServiceResponse(c, resp, http.StatusOK)
+}
+
+// HandleGetReturns godoc
+// @Summary List returns
+// @Description Lists returns on the seller's orders, newest first, via OrderService REST API
+// @Tags returns
+// @Produce json
+// @Param status query string false "Only returns with this status"
+// @Param orderId query string false "Only returns of this order"
+// @Success 200 {array} map[string]interface{}
+// @Failure 500 {object} ErrorResponse
+// @Router /returns [get]
+func HandleGetReturns(c *gin.Context) {
+	query := neturl.Values{}
+	for _, key := range []string{"status", "orderId"} {
+		if value := c.Query(key); value != "" {
+			query.Set(key, value)
+		}
+	}
+
+	url := fmt.Sprintf("%s/returns?%s", config.OrderRESTURL, query.Encode())
+	resp, err := authenticatedHTTPRequest("GET", url, nil, c.GetHeader("Authorization"))
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, ErrorResponse{Error: "Failed to fetch returns: " + err.Error()})
+		return
+	}
+	defer resp.Body.Close()
+
+	relayOrderServiceResponse(c, resp, http.StatusOK)
+}
+
+// HandleGetReturn godoc
+// @Summary Get a return
+// @Description Returns one of the seller's returns with its status history via OrderService REST API
+// @Tags returns
+// @Produce json
+// @Param returnId path string true "Return ID"
+// @Success 200 {object} map[string]interface{}
+// @Failure 404 {object} ErrorResponse
+// @Failure 500 {object} ErrorResponse
+// @Router /returns/{returnId} [get]
+func HandleGetReturn(c *gin.Context) {
+	url := fmt.Sprintf("%s/returns/%s", config.OrderRESTURL, neturl.PathEscape(c.Param("returnId")))
+	resp, err := authenticatedHTTPRequest("GET", url, nil, c.GetHeader("Authorization"))
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, ErrorResponse{Error: "Failed to fetch return: " + err.Error()})
+		return
+	}
+	defer resp.Body.Close()
+
+	relayOrderServiceResponse(c, resp, http.StatusOK)
+}
+
+// HandleApproveReturn godoc
+// @Summary Approve a return
+// @Description Accepts a buyer's return request via OrderService REST API
+// @Tags returns
+// @Accept json
+// @Produce json
+// @Param returnId path string true "Return ID"
+// @Param request body ReturnActionInput false "Optional note"
+// @Success 200 {object} map[string]interface{}
+// @Failure 400 {object} ErrorResponse
+// @Failure 404 {object} ErrorResponse
+// @Failure 409 {object} ErrorResponse
+// @Failure 500 {object} ErrorResponse
+// @Router /returns/{returnId}/approve [post]
+func HandleApproveReturn(c *gin.Context) {
+	forwardReturnAction(c, "approve", false, http.StatusOK)
+}
+
+// HandleRejectReturn godoc
+// @Summary Reject a return
+// @Description Turns down a buyer's return request with a note via OrderService REST API
+// @Tags returns
+// @Accept json
+// @Produce json
+// @Param returnId path string true "Return ID"
+// @Param request body ReturnActionInput true "Reason for rejecting"
+// @Success 200 {object} map[string]interface{}
+// @Failure 400 {object} ErrorResponse
+// @Failure 404 {object} ErrorResponse
+// @Failure 409 {object} ErrorResponse
+// @Failure 500 {object} ErrorResponse
+// @Router /returns/{returnId}/reject [post]
+func HandleRejectReturn(c *gin.Context) {
+	forwardReturnAction(c, "reject", true, http.StatusOK)
+}
+
+// HandleReceiveReturn godoc
+// @Summary Receive a return
+// @Description Confirms an approved return arrived, optionally restocking its units, and refunds the buyer via OrderService REST API. 202 means the refund failed and can be retried.
+// @Tags returns
+// @Accept json
+// @Produce json
+// @Param returnId path string true "Return ID"
+// @Param request body ReturnActionInput false "Restock flag and optional note"
+// @Success 200 {object} map[string]interface{}
+// @Success 202 {object} map[string]interface{}
+// @Failure 400 {object} ErrorResponse
+// @Failure 404 {object} ErrorResponse
+// @Failure 409 {object} ErrorResponse
+// @Failure 500 {object} ErrorResponse
+// @Router /returns/{returnId}/receive [post]
+func HandleReceiveReturn(c *gin.Context) {
+	forwardReturnAction(c, "receive", false, http.StatusOK, http.StatusAccepted)
+}
+
+// HandleRefundReturn godoc
+// @Summary Retry a return's refund
+// @Description Retries the refund of a received return via OrderService REST API
+// @Tags returns
+// @Produce json
+// @Param returnId path string true "Return ID"
+// @Success 200 {object} map[string]interface{}
+// @Failure 404 {object} ErrorResponse
+// @Failure 409 {object} ErrorResponse
+// @Failure 502 {object} ErrorResponse
+// @Router /returns/{returnId}/refund [post]
+func HandleRefundReturn(c *gin.Context) {
+	forwardReturnAction(c, "refund", false, http.StatusOK)
+}
+
+// forwardReturnAction validates the optional body of a return action and
+// forwards it to OrderService's POST /returns/{returnId}/{action}.
+func forwardReturnAction(c *gin.Context, action string, noteRequired bool, expected ...int) {
+	var input ReturnActionInput
+	if c.Request.ContentLength != 0 {
+		if err := c.ShouldBindJSON(&input); err != nil {
+			c.JSON(http.StatusBadRequest, ErrorResponse{Error: "Invalid request body."})
+			return
+		}
+	}
+	if noteRequired && strings.TrimSpace(input.Note) == "" {
+		c.JSON(http.StatusBadRequest, ErrorResponse{Error: "Invalid request. A note is required to " + action + " a return."})
+		return
+	}
+
+	url := fmt.Sprintf("%s/returns/%s/%s", config.OrderRESTURL, neturl.PathEscape(c.Param("returnId")), action)
+	resp, err := authenticatedHTTPRequest("POST", url, input, c.GetHeader("Authorization"))
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, ErrorResponse{Error: "Failed to " + action + " return: " + err.Error()})
+		return
+	}
+	defer resp.Body.Close()
+
+	relayOrderServiceResponse(c, resp, expected...)
+}
+
+// HandleCreateCoupon godoc
+// @Summary Create a coupon
+// @Description Creates a coupon for the seller's products via OrderService REST API
+// @Tags coupons
+// @Accept json
+// @Produce json
+// @Param request body CreateCouponInput true "Coupon definition"
+// @Success 201 {object} map[string]interface{}
+// @Failure 400 {object} ErrorResponse
+// @Failure 409 {object} ErrorResponse
+// @Failure 500 {object} ErrorResponse
+// @Router /coupons [post]
+func HandleCreateCoupon(c *gin.Context) {
+	var input CreateCouponInput
+	if err := c.ShouldBindJSON(&input); err != nil {
+		c.JSON(http.StatusBadRequest, ErrorResponse{Error: "Invalid request. Code and type are required."})
+		return
+	}
+
+	url := fmt.Sprintf("%s/coupons", config.OrderRESTURL)
+	resp, err := authenticatedHTTPRequest("POST", url, input, c.GetHeader("Authorization"))
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, ErrorResponse{Error: "Failed to create coupon: " + err.Error()})
+		return
+	}
+	defer resp.Body.Close()
+
+	relayOrderServiceResponse(c, resp, http.StatusCreated)
+}
+
+// HandleGetCoupons godoc
+// @Summary List coupons
+// @Description Lists the seller's coupons with their usage counts via OrderService REST API
+// @Tags coupons
+// @Produce json
+// @Success 200 {array} map[string]interface{}
+// @Failure 500 {object} ErrorResponse
+// @Router /coupons [get]
+func HandleGetCoupons(c *gin.Context) {
+	url := fmt.Sprintf("%s/coupons", config.OrderRESTURL)
+	resp, err := authenticatedHTTPRequest("GET", url, nil, c.GetHeader("Authorization"))
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, ErrorResponse{Error: "Failed to fetch coupons: " + err.Error()})
+		return
+	}
+	defer resp.Body.Close()
+
+	relayOrderServiceResponse(c, resp, http.StatusOK)
+}
+
+// HandleDeactivateCoupon godoc
+// @Summary Deactivate a coupon
+// @Description Stops one of the seller's coupons from being used via OrderService REST API
+// @Tags coupons
+// @Produce json
+// @Param code path string true "Coupon code"
+// @Success 200 {object} map[string]string
+// @Failure 404 {object} ErrorResponse
+// @Failure 500 {object} ErrorResponse
+// @Router /coupons/{code} [delete]
+func HandleDeactivateCoupon(c *gin.Context) {
+	url := fmt.Sprintf("%s/coupons/%s", config.OrderRESTURL, neturl.PathEscape(c.Param("code")))
+	resp, err := authenticatedHTTPRequest("DELETE", url, nil, c.GetHeader("Authorization"))
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, ErrorResponse{Error: "Failed to deactivate coupon: " + err.Error()})
+		return
+	}
+	defer resp.Body.Close()
+
+	relayOrderServiceResponse(c, resp, http.StatusOK)
+}
+
+// HandleGetWebhooks godoc
+// @Summary List webhooks
+// @Description Lists the seller's webhook subscriptions via OrderService REST API
+// @Tags webhooks
+// @Produce json
+// @Success 200 {array} map[string]interface{}
+// @Failure 500 {object} ErrorResponse
+// @Router /webhooks [get]
+func HandleGetWebhooks(c *gin.Context) {
+	url := fmt.Sprintf("%s/webhooks", config.OrderRESTURL)
+	resp, err := authenticatedHTTPRequest("GET", url, nil, c.GetHeader("Authorization"))
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, ErrorResponse{Error: "Failed to fetch webhooks: " + err.Error()})
+		return
+	}
+	defer resp.Body.Close()
+
+	relayOrderServiceResponse(c, resp, http.StatusOK)
+}
+
+// HandleCreateWebhook godoc
+// @Summary Create a webhook
+// @Description Subscribes an HTTPS endpoint to the seller's order events via OrderService REST API. The response carries the signing secret, which is not shown again.
+// @Tags webhooks
+// @Accept json
+// @Produce json
+// @Param request body WebhookInput true "Endpoint URL and event types"
+// @Success 201 {object} map[string]interface{}
+// @Failure 400 {object} ErrorResponse
+// @Failure 409 {object} ErrorResponse
+// @Failure 500 {object} ErrorResponse
+// @Router /webhooks [post]
+func HandleCreateWebhook(c *gin.Context) {
+	var input WebhookInput
+	if err := c.ShouldBindJSON(&input); err != nil {
+		c.JSON(http.StatusBadRequest, ErrorResponse{Error: "Invalid request. URL and event types are required."})
+		return
+	}
+
+	url := fmt.Sprintf("%s/webhooks", config.OrderRESTURL)
+	resp, err := authenticatedHTTPRequest("POST", url, input, c.GetHeader("Authorization"))
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, ErrorResponse{Error: "Failed to create webhook: " + err.Error()})
+		return
+	}
+	defer resp.Body.Close()
+
+	relayOrderServiceResponse(c, resp, http.StatusCreated)
+}
+
+// HandleUpdateWebhook godoc
+// @Summary Update a webhook
+// @Description Changes a webhook's URL or event types, or enables or disables it, via OrderService REST API
+// @Tags webhooks
+// @Accept json
+// @Produce json
+// @Param webhookId path string true "Webhook ID"
+// @Param request body UpdateWebhookInput true "Fields to change"
+// @Success 200 {object} map[string]interface{}
+// @Failure 400 {object} ErrorResponse
+// @Failure 404 {object} ErrorResponse
+// @Failure 500 {object} ErrorResponse
+// @Router /webhooks/{webhookId} [put]
+func HandleUpdateWebhook(c *gin.Context) {
+	var input UpdateWebhookInput
+	if err := c.ShouldBindJSON(&input); err != nil {
+		c.JSON(http.StatusBadRequest, ErrorResponse{Error: "Invalid request body."})
+		return
+	}
+
+	url := fmt.Sprintf("%s/webhooks/%s", config.OrderRESTURL, neturl.PathEscape(c.Param("webhookId")))
+	resp, err := authenticatedHTTPRequest("PUT", url, input, c.GetHeader("Authorization"))
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, ErrorResponse{Error: "Failed to update webhook: " + err.Error()})
+		return
+	}
+	defer resp.Body.Close()
+
+	relayOrderServiceResponse(c, resp, http.StatusOK)
+}
+
+// HandleDeleteWebhook godoc
+// @Summary Delete a webhook
+// @Description Removes a webhook subscription and its delivery log via OrderService REST API
+// @Tags webhooks
+// @Produce json
+// @Param webhookId path string true "Webhook ID"
+// @Success 200 {object} map[string]string
+// @Failure 404 {object} ErrorResponse
+// @Failure 500 {object} ErrorResponse
+// @Router /webhooks/{webhookId} [delete]
+func HandleDeleteWebhook(c *gin.Context) {
+	url := fmt.Sprintf("%s/webhooks/%s", config.OrderRESTURL, neturl.PathEscape(c.Param("webhookId")))
+	resp, err := authenticatedHTTPRequest("DELETE", url, nil, c.GetHeader("Authorization"))
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, ErrorResponse{Error: "Failed to delete webhook: " + err.Error()})
+		return
+	}
+	defer resp.Body.Close()
+
+	relayOrderServiceResponse(c, resp, http.StatusOK)
+}
+
+// HandleGetWebhookDeliveries godoc
+// @Summary List webhook deliveries
+// @Description Returns a webhook's delivery log, newest first, via OrderService REST API
+// @Tags webhooks
+// @Produce json
+// @Param webhookId path string true "Webhook ID"
+// @Param status query string false "Only deliveries with this status (pending, succeeded, failed)"
+// @Param limit query int false "Number of deliveries (default 50, max 100)"
+// @Success 200 {array} map[string]interface{}
+// @Failure 400 {object} ErrorResponse
+// @Failure 404 {object} ErrorResponse
+// @Failure 500 {object} ErrorResponse
+// @Router /webhooks/{webhookId}/deliveries [get]
+func HandleGetWebhookDeliveries(c *gin.Context) {
+	query := neturl.Values{}
+	for _, key := range []string{"status", "limit"} {
+		if value := c.Query(key); value != "" {
+			query.Set(key, value)
+		}
+	}
+
+	url := fmt.Sprintf("%s/webhooks/%s/deliveries?%s", config.OrderRESTURL, neturl.PathEscape(c.Param("webhookId")), query.Encode())
+	resp, err := authenticatedHTTPRequest("GET", url, nil, c.GetHeader("Authorization"))
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, ErrorResponse{Error: "Failed to fetch webhook deliveries: " + err.Error()})
+		return
+	}
+	defer resp.Body.Close()
+
+	relayOrderServiceResponse(c, resp, http.StatusOK)
+}
+
+// HandleRedeliverWebhook godoc
+// @Summary Redeliver a webhook event
+// @Description Posts a delivery to the webhook again right away via OrderService REST API and returns the updated delivery
+// @Tags webhooks
+// @Produce json
+// @Param webhookId path string true "Webhook ID"
+// @Param deliveryId path string true "Delivery ID"
+// @Success 200 {object} map[string]interface{}
+// @Failure 404 {object} ErrorResponse
+// @Failure 500 {object} ErrorResponse
+// @Router /webhooks/{webhookId}/deliveries/{deliveryId}/redeliver [post]
+func HandleRedeliverWebhook(c *gin.Context) {
+	url := fmt.Sprintf("%s/webhooks/%s/deliveries/%s/redeliver", config.OrderRESTURL,
+		neturl.PathEscape(c.Param("webhookId")), neturl.PathEscape(c.Param("deliveryId")))
+	resp, err := authenticatedHTTPRequest("POST", url, nil, c.GetHeader("Authorization"))
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, ErrorResponse{Error: "Failed to redeliver webhook: " + err.Error()})
+		return
+	}
+	defer resp.Body.Close()
+
+	relayOrderServiceResponse(c, resp, http.StatusOK)
+}
+
+// HandleGetSalesAnalytics godoc
+// @Summary Get sales over time
+// @Description Returns the seller's orders, units sold, revenue and average order value per day, week or month via OrderService REST API, as JSON or a CSV download
+// @Tags analytics
+// @Produce json
+// @Produce text/csv
+// @Param from query string false "First date, YYYY-MM-DD (default 29 days before to)"
+// @Param to query string false "Last date, YYYY-MM-DD (default today)"
+// @Param interval query string false "day, week or month (default day)"
+// @Param tz query string false "IANA time zone of the dates and periods (default UTC)"
+// @Param currency query string false "Currency of the orders to include"
+// @Param format query string false "json or csv (default json)"
+// @Success 200 {object} SalesReport
+// @Failure 400 {object} ErrorResponse
+// @Failure 500 {object} ErrorResponse
+// @Router /analytics/sales [get]
+func HandleGetSalesAnalytics(c *gin.Context) {
+	forwardAnalytics(c, "sales", []string{"from", "to", "interval", "tz", "currency"}, salesReportCSV)
+}
+
+// HandleGetTopProducts godoc
+// @Summary Get top products
+// @Description Returns the seller's best-selling products by revenue or units via OrderService REST API, as JSON or a CSV download
+// @Tags analytics
+// @Produce json
+// @Produce text/csv
+// @Param from query string false "First date, YYYY-MM-DD (default 29 days before to)"
+// @Param to query string false "Last date, YYYY-MM-DD (default today)"
+// @Param tz query string false "IANA time zone of the dates (default UTC)"
+// @Param currency query string false "Currency of the orders to include"
+// @Param sort query string false "revenue or units (default revenue)"
+// @Param limit query int false "Number of products (default 10, max 100)"
+// @Param format query string false "json or csv (default json)"
+// @Success 200 {object} TopProductsReport
+// @Failure 400 {object} ErrorResponse
+// @Failure 500 {object} ErrorResponse
+// @Router /analytics/top-products [get]
+func HandleGetTopProducts(c *gin.Context) {
+	forwardAnalytics(c, "top-products", []string{"from", "to", "tz", "currency", "sort", "limit"}, topProductsCSV)
+}
+
+// forwardAnalytics fetches an OrderService analytics report with the given
+// query parameters and relays it, or with ?format=csv converts it with toCSV
+// and sends it as a file download.
+func forwardAnalytics(c *gin.Context, report string, keys []string, toCSV func([]byte) (string, [][]string, error)) {
+	format := strings.ToLower(c.DefaultQuery("format", "json"))
+	if format != "json" && format != "csv" {
+		c.JSON(http.StatusBadRequest, ErrorResponse{Error: "Invalid format. Use json or csv."})
+		return
+	}
+
+	query := neturl.Values{}
+	for _, key := range keys {
+		if value := c.Query(key); value != "" {
+			query.Set(key, value)
+		}
+	}
+
+	url := fmt.Sprintf("%s/analytics/%s?%s", config.OrderRESTURL, report, query.Encode())
+	resp, err := authenticatedHTTPRequest("GET", url, nil, c.GetHeader("Authorization"))
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, ErrorResponse{Error: "Failed to fetch analytics: " + err.Error()})
+		return
+	}
+	defer resp.Body.Close()
+
+	if format == "json" || resp.StatusCode != http.StatusOK {
+		relayOrderServiceResponse(c, resp, http.StatusOK)
+		return
+	}
+
+	body, err := io.ReadAll(resp.Body)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, ErrorResponse{Error: "Failed to read OrderService response."})
+		return
+	}
+	filename, rows, err := toCSV(body)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, ErrorResponse{Error: "Failed to decode analytics response."})
+		return
+	}
+
+	c.Header("Content-Type", "text/csv; charset=utf-8")
+	c.Header("Content-Disposition", fmt.Sprintf("attachment; filename=%q", filename))
+	c.Status(http.StatusOK)
+	w := csv.NewWriter(c.Writer)
+	if err := w.WriteAll(rows); err != nil {
+		log.Printf("Failed to write analytics CSV: %v", err)
+	}
+}
+
+// salesReportCSV lays a sales report out as one row per period followed by a
+// total row. Amounts are in major units of the report's currency.
+func salesReportCSV(body []byte) (string, [][]string, error) {
+	var report SalesReport
+	if err := json.Unmarshal(body, &report); err != nil {
+		return "", nil, err
+	}
+
+	rows := [][]string{{"period", "orders", "units", "revenue", "average_order_value", "currency"}}
+	for _, b := range append(report.Buckets, report.Totals) {
+		period := b.Period
+		if period == "" {
+			period = "total"
+		}
+		rows = append(rows, []string{
+			period,
+			fmt.Sprint(b.Orders),
+			fmt.Sprint(b.Units),
+			b.Revenue.Decimal(),
+			b.AverageOrderValue.Decimal(),
+			report.Currency,
+		})
+	}
+
+	filename := fmt.Sprintf("sales_%s_%s_%s.csv", report.Interval, report.From, report.To)
+	return filename, rows, nil
+}
+
+// topProductsCSV lays a top products report out as one row per product.
+func topProductsCSV(body []byte) (string, [][]string, error) {
+	var report TopProductsReport
+	if err := json.Unmarshal(body, &report); err != nil {
+		return "", nil, err
+	}
+
+	rows := [][]string{{"product_id", "name", "units", "orders", "revenue", "currency"}}
+	for _, p := range report.Products {
+		rows = append(rows, []string{
+			p.ProductID,
+			p.Name,
+			fmt.Sprint(p.Units),
+			fmt.Sprint(p.Orders),
+			p.Revenue.Decimal(),
+			report.Currency,
+		})
+	}
+
+	filename := fmt.Sprintf("top_products_%s_%s.csv", report.From, report.To)
+	return filename, rows, nil
+}
+
+// relayOrderServiceResponse passes an OrderService JSON response through when
+// it has one of the expected statuses, and wraps it in an ErrorResponse
+// otherwise.
+func relayOrderServiceResponse(c *gin.Context, resp *http.Response, expected ...int) {
+	body, err := io.ReadAll(resp.Body)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, ErrorResponse{Error: "Failed to read OrderService response."})
+		return
+	}
+
+	for _, status := range expected {
+		if resp.StatusCode == status {
+			c.Data(resp.StatusCode, "application/json; charset=utf-8", body)
+			return
+		}
+	}
+
+	c.JSON(resp.StatusCode, ErrorResponse{Error: "OrderService error: " + string(body)})
 }
 
 // HandleHealth godoc
@@ -902,7 +1874,35 @@ func main() {
 
 		// Order management
 		protected.GET("/orders", HandleGetOrders)
+		protected.GET("/orders/export", HandleExportOrders)
 		protected.PUT("/updateOrderStatus/:orderId", HandleUpdateOrderStatus)
+		protected.GET("/orders/:orderId/shipments", HandleGetShipments)
+		protected.POST("/orders/:orderId/shipments", HandleCreateShipment)
+
+		// Returns
+		protected.GET("/returns", HandleGetReturns)
+		protected.GET("/returns/:returnId", HandleGetReturn)
+		protected.POST("/returns/:returnId/approve", HandleApproveReturn)
+		protected.POST("/returns/:returnId/reject", HandleRejectReturn)
+		protected.POST("/returns/:returnId/receive", HandleReceiveReturn)
+		protected.POST("/returns/:returnId/refund", HandleRefundReturn)
+
+		// Coupons
+		protected.GET("/coupons", HandleGetCoupons)
+		protected.POST("/coupons", HandleCreateCoupon)
+		protected.DELETE("/coupons/:code", HandleDeactivateCoupon)
+
+		// Webhooks
+		protected.GET("/webhooks", HandleGetWebhooks)
+		protected.POST("/webhooks", HandleCreateWebhook)
+		protected.PUT("/webhooks/:webhookId", HandleUpdateWebhook)
+		protected.DELETE("/webhooks/:webhookId", HandleDeleteWebhook)
+		protected.GET("/webhooks/:webhookId/deliveries", HandleGetWebhookDeliveries)
+		protected.POST("/webhooks/:webhookId/deliveries/:deliveryId/redeliver", HandleRedeliverWebhook)
+
+		// Analytics
+		protected.GET("/analytics/sales", HandleGetSalesAnalytics)
+		protected.GET("/analytics/top-products", HandleGetTopProducts)
 	}
 
 	// Start server
@@ -2,6 +2,7 @@ package main
 
 import (
 	"bytes"
+	"compress/gzip"
 	"encoding/json"
 	"net/http"
 	"net/http/httptest"
@@ -43,7 +44,27 @@ func setupProtectedTestRouter(sellerID string) *gin.Engine {
 	r.POST("/addProduct", HandleAddProduct)
 	r.PUT("/editProduct/:productId", HandleEditProduct)
 	r.GET("/orders", HandleGetOrders)
+	r.GET("/orders/export", HandleExportOrders)
 	r.PUT("/updateOrderStatus/:orderId", HandleUpdateOrderStatus)
+	r.GET("/orders/:orderId/shipments", HandleGetShipments)
+	r.POST("/orders/:orderId/shipments", HandleCreateShipment)
+	r.GET("/returns", HandleGetReturns)
+	r.GET("/returns/:returnId", HandleGetReturn)
+	r.POST("/returns/:returnId/approve", HandleApproveReturn)
+	r.POST("/returns/:returnId/reject", HandleRejectReturn)
+	r.POST("/returns/:returnId/receive", HandleReceiveReturn)
+	r.POST("/returns/:returnId/refund", HandleRefundReturn)
+	r.GET("/coupons", HandleGetCoupons)
+	r.POST("/coupons", HandleCreateCoupon)
+	r.DELETE("/coupons/:code", HandleDeactivateCoupon)
+	r.GET("/webhooks", HandleGetWebhooks)
+	r.POST("/webhooks", HandleCreateWebhook)
+	r.PUT("/webhooks/:webhookId", HandleUpdateWebhook)
+	r.DELETE("/webhooks/:webhookId", HandleDeleteWebhook)
+	r.GET("/webhooks/:webhookId/deliveries", HandleGetWebhookDeliveries)
+	r.POST("/webhooks/:webhookId/deliveries/:deliveryId/redeliver", HandleRedeliverWebhook)
+	r.GET("/analytics/sales", HandleGetSalesAnalytics)
+	r.GET("/analytics/top-products", HandleGetTopProducts)
 
 	return r
 }
@@ -248,6 +269,34 @@ func TestAddProductValidation(t *testing.T) {
 	}
 }
 
+func TestMoneyUnmarshalJSON(t *testing.T) {
+	tests := []struct {
+		body     string
+		expected Money
+	}{
+		{`{"amount":1799700,"currency":"LKR"}`, Money{Amount: 1799700, Currency: "LKR"}},
+		{`{"amount":999}`, Money{Amount: 999}},
+		{`17997.99`, Money{Amount: 1799799}},
+		{`9.99`, Money{Amount: 999}},
+	}
+
+	for _, tt := range tests {
+		var m Money
+		if err := json.Unmarshal([]byte(tt.body), &m); err != nil {
+			t.Errorf("Unmarshal(%s) failed: %v", tt.body, err)
+			continue
+		}
+		if m != tt.expected {
+			t.Errorf("Unmarshal(%s) = %+v, expected %+v", tt.body, m, tt.expected)
+		}
+	}
+
+	var m Money
+	if err := json.Unmarshal([]byte(`"9.99"`), &m); err == nil {
+		t.Errorf("Expected a string amount to be rejected")
+	}
+}
+
 // =============================================================================
 // Update Order Status Validation Tests
 // =============================================================================
@@ -320,6 +369,825 @@ func TestUpdateOrderStatusValidation(t *testing.T) {
 	}
 }
 
+func TestUpdateOrderStatusForwardsIfMatch(t *testing.T) {
+	var receivedIfMatch string
+	orderService := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		receivedIfMatch = r.Header.Get("If-Match")
+		w.Header().Set("Content-Type", "application/json")
+		if receivedIfMatch != `"2"` {
+			w.WriteHeader(http.StatusPreconditionFailed)
+			w.Write([]byte(`{"error":"Cannot update order status: order version conflict"}`))
+			return
+		}
+		w.Header().Set("ETag", `"3"`)
+		w.Write([]byte(`{"message":"Order status updated successfully","orderId":"order-1","status":"shipped","version":3}`))
+	}))
+	defer orderService.Close()
+
+	previous := config
+	config.OrderRESTURL = orderService.URL
+	defer func() { config = previous }()
+
+	router := setupProtectedTestRouter("seller-123")
+	update := func(ifMatch string) *httptest.ResponseRecorder {
+		req, _ := http.NewRequest(http.MethodPut, "/updateOrderStatus/order-1", bytes.NewBufferString(`{"status":"shipped"}`))
+		req.Header.Set("Content-Type", "application/json")
+		req.Header.Set("If-Match", ifMatch)
+		w := httptest.NewRecorder()
+		router.ServeHTTP(w, req)
+		return w
+	}
+
+	w := update(`"1"`)
+	if w.Code != http.StatusPreconditionFailed {
+		t.Errorf("Expected status %d for a stale version, got %d. Body: %s", http.StatusPreconditionFailed, w.Code, w.Body.String())
+	}
+
+	w = update(`"2"`)
+	if w.Code != http.StatusOK {
+		t.Fatalf("Expected status %d, got %d. Body: %s", http.StatusOK, w.Code, w.Body.String())
+	}
+	if receivedIfMatch != `"2"` {
+		t.Errorf("Expected If-Match to be forwarded, got '%s'", receivedIfMatch)
+	}
+	if etag := w.Header().Get("ETag"); etag != `"3"` {
+		t.Errorf("Expected the new ETag to be relayed, got '%s'", etag)
+	}
+	if !bytes.Contains(w.Body.Bytes(), []byte(`"version":3`)) {
+		t.Errorf("Expected the new version in the response, got %s", w.Body.String())
+	}
+}
+
+// =============================================================================
+// Edit Product Tests
+// =============================================================================
+
+func TestEditProductExpectedVersion(t *testing.T) {
+	var editInput map[string]interface{}
+	productService := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		var request struct {
+			Query     string                 `json:"query"`
+			Variables map[string]interface{} `json:"variables"`
+		}
+		json.NewDecoder(r.Body).Decode(&request)
+		w.Header().Set("Content-Type", "application/json")
+
+		if containsSubstring(request.Query, "getProductById") {
+			w.Write([]byte(`{"data":{"getProductById":{"sellerId":"seller-123"}}}`))
+			return
+		}
+		editInput, _ = request.Variables["input"].(map[string]interface{})
+		if stock, ok := editInput["stock"].(float64); ok && stock < 2 {
+			w.Write([]byte(`{"data":null,"errors":[{"message":"stock below reserved: product prod-1 has 2 reserved, cannot set stock to 1"}]}`))
+			return
+		}
+		if editInput["expectedVersion"] != float64(4) {
+			w.Write([]byte(`{"data":null,"errors":[{"message":"version conflict: product prod-1 is at version 4, not 3"}]}`))
+			return
+		}
+		w.Write([]byte(`{"data":{"editProduct":{"productId":"prod-1","version":5}}}`))
+	}))
+	defer productService.Close()
+
+	previous := config
+	config.ProductGraphQLURL = productService.URL
+	defer func() { config = previous }()
+
+	router := setupProtectedTestRouter("seller-123")
+	editBody := func(ifMatch, body string) *httptest.ResponseRecorder {
+		req, _ := http.NewRequest(http.MethodPut, "/editProduct/prod-1", bytes.NewBufferString(body))
+		req.Header.Set("Content-Type", "application/json")
+		req.Header.Set("If-Match", ifMatch)
+		w := httptest.NewRecorder()
+		router.ServeHTTP(w, req)
+		return w
+	}
+	edit := func(ifMatch string) *httptest.ResponseRecorder {
+		return editBody(ifMatch, `{"price":12.5}`)
+	}
+
+	w := edit("3")
+	if w.Code != http.StatusBadRequest {
+		t.Errorf("Expected status %d for an unquoted If-Match, got %d", http.StatusBadRequest, w.Code)
+	}
+
+	w = edit(`"3"`)
+	if w.Code != http.StatusPreconditionFailed {
+		t.Errorf("Expected status %d for a stale version, got %d. Body: %s", http.StatusPreconditionFailed, w.Code, w.Body.String())
+	}
+
+	w = edit(`"4"`)
+	if w.Code != http.StatusOK {
+		t.Fatalf("Expected status %d, got %d. Body: %s", http.StatusOK, w.Code, w.Body.String())
+	}
+	if etag := w.Header().Get("ETag"); etag != `"5"` {
+		t.Errorf("Expected ETag \"5\", got '%s'", etag)
+	}
+	if !bytes.Contains(w.Body.Bytes(), []byte(`"version":5`)) {
+		t.Errorf("Expected the new version in the response, got %s", w.Body.String())
+	}
+
+	w = editBody(`"4"`, `{"stock":1}`)
+	if w.Code != http.StatusConflict {
+		t.Errorf("Expected status %d for stock below reserved, got %d. Body: %s", http.StatusConflict, w.Code, w.Body.String())
+	}
+}
+
+// =============================================================================
+// Get Orders Tests
+// =============================================================================
+
+func TestGetOrdersForwardsPagination(t *testing.T) {
+	var receivedQuery map[string]string
+	orderService := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		receivedQuery = map[string]string{}
+		for key := range r.URL.Query() {
+			receivedQuery[key] = r.URL.Query().Get(key)
+		}
+		w.Header().Set("Content-Type", "application/json")
+		w.Write([]byte(`{"orders":[{"orderId":"order-1","status":"paid","items":[],"totalPrice":{"amount":4250,"currency":"LKR"},"shippingAddress":{"name":"Nimal Perera","line1":"12 Galle Rd","city":"Colombo","country":"LK"}}],"nextCursor":"abc"}`))
+	}))
+	defer orderService.Close()
+
+	previous := config
+	config.OrderRESTURL = orderService.URL
+	defer func() { config = previous }()
+
+	router := setupProtectedTestRouter("seller-123")
+	req, _ := http.NewRequest(http.MethodGet, "/orders?limit=5&status=paid&sort=asc&cursor=xyz&ignored=1", nil)
+	w := httptest.NewRecorder()
+	router.ServeHTTP(w, req)
+
+	if w.Code != http.StatusOK {
+		t.Fatalf("Expected status %d, got %d. Body: %s", http.StatusOK, w.Code, w.Body.String())
+	}
+
+	expected := map[string]string{"sellerId": "seller-123", "limit": "5", "status": "paid", "sort": "asc", "cursor": "xyz"}
+	for key, value := range expected {
+		if receivedQuery[key] != value {
+			t.Errorf("Expected %s=%s forwarded, got '%s'", key, value, receivedQuery[key])
+		}
+	}
+	if _, ok := receivedQuery["ignored"]; ok {
+		t.Errorf("Expected unknown query parameters not to be forwarded")
+	}
+
+	var page OrderPage
+	if err := json.Unmarshal(w.Body.Bytes(), &page); err != nil {
+		t.Fatalf("Failed to unmarshal response: %v", err)
+	}
+	if len(page.Orders) != 1 || page.Orders[0].TotalPrice != (Money{Amount: 4250, Currency: "LKR"}) {
+		t.Errorf("Expected one order with totalPrice LKR 42.50, got %+v", page.Orders)
+	}
+	if len(page.Orders) == 1 && (page.Orders[0].ShippingAddress == nil || page.Orders[0].ShippingAddress.Line1 != "12 Galle Rd") {
+		t.Errorf("Expected the order's shipping address to be passed through, got %+v", page.Orders[0].ShippingAddress)
+	}
+	if page.NextCursor != "abc" {
+		t.Errorf("Expected nextCursor 'abc', got '%s'", page.NextCursor)
+	}
+}
+
+func TestExportOrdersStreamsFromOrderService(t *testing.T) {
+	csvBody := "order_id,line,product_id\norder-1,1,prod-1\norder-1,2,prod-2\n"
+	orderService := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path != "/seller/orders/export" {
+			t.Errorf("Unexpected path %s", r.URL.Path)
+		}
+		query := r.URL.Query()
+		if query.Get("format") != "csv" || query.Get("status") != "paid,shipped" || query.Get("from") != "2026-01-01" || query.Has("ignored") {
+			t.Errorf("Unexpected query %s", r.URL.RawQuery)
+		}
+		if r.Header.Get("Authorization") != "Bearer test-token" {
+			t.Errorf("Expected the auth header to be forwarded")
+		}
+		w.Header().Set("Content-Type", "text/csv; charset=utf-8")
+		w.Header().Set("Content-Disposition", `attachment; filename="orders_20260301T000000Z.csv"`)
+		w.Header().Set("X-Internal", "1")
+		w.Write([]byte(csvBody))
+	}))
+	defer orderService.Close()
+
+	previous := config
+	config.OrderRESTURL = orderService.URL
+	defer func() { config = previous }()
+
+	router := setupProtectedTestRouter("seller-123")
+	req, _ := http.NewRequest(http.MethodGet, "/orders/export?status=paid,shipped&from=2026-01-01&ignored=1", nil)
+	req.Header.Set("Authorization", "Bearer test-token")
+	w := httptest.NewRecorder()
+	router.ServeHTTP(w, req)
+
+	if w.Code != http.StatusOK {
+		t.Fatalf("Expected status %d, got %d. Body: %s", http.StatusOK, w.Code, w.Body.String())
+	}
+	if w.Body.String() != csvBody {
+		t.Errorf("Expected the export to be relayed as is, got:\n%s", w.Body.String())
+	}
+	if w.Header().Get("Content-Disposition") != `attachment; filename="orders_20260301T000000Z.csv"` {
+		t.Errorf("Unexpected Content-Disposition %s", w.Header().Get("Content-Disposition"))
+	}
+	if w.Header().Get("X-Internal") != "" {
+		t.Errorf("Expected other OrderService headers not to be relayed")
+	}
+}
+
+func TestExportOrdersRelaysGzip(t *testing.T) {
+	var compressed bytes.Buffer
+	gz := gzip.NewWriter(&compressed)
+	gz.Write([]byte(`{"orderId":"order-1","line":1}` + "\n"))
+	gz.Close()
+
+	orderService := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Query().Get("format") != "ndjson" {
+			t.Errorf("Expected format=ndjson, got %s", r.URL.RawQuery)
+		}
+		if r.Header.Get("Accept-Encoding") != "gzip" {
+			t.Errorf("Expected Accept-Encoding to be forwarded, got '%s'", r.Header.Get("Accept-Encoding"))
+		}
+		w.Header().Set("Content-Type", "application/x-ndjson")
+		w.Header().Set("Content-Encoding", "gzip")
+		w.Write(compressed.Bytes())
+	}))
+	defer orderService.Close()
+
+	previous := config
+	config.OrderRESTURL = orderService.URL
+	defer func() { config = previous }()
+
+	router := setupProtectedTestRouter("seller-123")
+	req, _ := http.NewRequest(http.MethodGet, "/orders/export?format=NDJSON", nil)
+	req.Header.Set("Accept-Encoding", "gzip")
+	w := httptest.NewRecorder()
+	router.ServeHTTP(w, req)
+
+	if w.Code != http.StatusOK {
+		t.Fatalf("Expected status %d, got %d", http.StatusOK, w.Code)
+	}
+	if w.Header().Get("Content-Encoding") != "gzip" {
+		t.Errorf("Expected Content-Encoding gzip, got '%s'", w.Header().Get("Content-Encoding"))
+	}
+	if !bytes.Equal(w.Body.Bytes(), compressed.Bytes()) {
+		t.Errorf("Expected the compressed body to be relayed unchanged")
+	}
+}
+
+func TestExportOrdersRejectsUnknownFormat(t *testing.T) {
+	router := setupProtectedTestRouter("seller-123")
+	req, _ := http.NewRequest(http.MethodGet, "/orders/export?format=xlsx", nil)
+	w := httptest.NewRecorder()
+	router.ServeHTTP(w, req)
+
+	if w.Code != http.StatusBadRequest {
+		t.Errorf("Expected status %d, got %d", http.StatusBadRequest, w.Code)
+	}
+}
+
+func TestExportOrdersRelaysErrors(t *testing.T) {
+	orderService := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusBadRequest)
+		w.Write([]byte(`{"error":"Invalid query: invalid date \"March\": use RFC3339 or YYYY-MM-DD"}`))
+	}))
+	defer orderService.Close()
+
+	previous := config
+	config.OrderRESTURL = orderService.URL
+	defer func() { config = previous }()
+
+	router := setupProtectedTestRouter("seller-123")
+	req, _ := http.NewRequest(http.MethodGet, "/orders/export?from=March", nil)
+	w := httptest.NewRecorder()
+	router.ServeHTTP(w, req)
+
+	if w.Code != http.StatusBadRequest {
+		t.Errorf("Expected status %d, got %d", http.StatusBadRequest, w.Code)
+	}
+	if w.Header().Get("Content-Disposition") != "" {
+		t.Errorf("Expected an error not to be sent as a download")
+	}
+}
+
+// =============================================================================
+// Shipment Tests
+// =============================================================================
+
+func TestCreateShipmentValidation(t *testing.T) {
+	router := setupProtectedTestRouter("seller-123")
+
+	tests := []struct {
+		name string
+		body string
+	}{
+		{name: "Missing carrier", body: `{"trackingNumber":"1Z999"}`},
+		{name: "Missing tracking number", body: `{"carrier":"dhl"}`},
+		{name: "Zero quantity", body: `{"carrier":"dhl","trackingNumber":"1Z999","items":[{"productId":"prod-1","quantity":0}]}`},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			req, _ := http.NewRequest(http.MethodPost, "/orders/order-1/shipments", bytes.NewBufferString(tt.body))
+			req.Header.Set("Content-Type", "application/json")
+			w := httptest.NewRecorder()
+			router.ServeHTTP(w, req)
+
+			if w.Code != http.StatusBadRequest {
+				t.Errorf("Expected status %d, got %d", http.StatusBadRequest, w.Code)
+			}
+		})
+	}
+}
+
+func TestCreateShipmentForwardsToOrderService(t *testing.T) {
+	var received CreateShipmentInput
+	orderService := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.Method != http.MethodPost || r.URL.Path != "/orders/order-1/shipments" {
+			t.Errorf("Unexpected request %s %s", r.Method, r.URL.Path)
+		}
+		json.NewDecoder(r.Body).Decode(&received)
+		w.Header().Set("Content-Type", "application/json")
+		w.WriteHeader(http.StatusCreated)
+		w.Write([]byte(`{"shipment":{"shipmentId":"ship-1","carrier":"dhl"},"orderStatus":"partially_shipped"}`))
+	}))
+	defer orderService.Close()
+
+	previous := config
+	config.OrderRESTURL = orderService.URL
+	defer func() { config = previous }()
+
+	router := setupProtectedTestRouter("seller-123")
+	body := `{"carrier":"dhl","trackingNumber":"1Z999","items":[{"productId":"prod-1","quantity":2}]}`
+	req, _ := http.NewRequest(http.MethodPost, "/orders/order-1/shipments", bytes.NewBufferString(body))
+	req.Header.Set("Content-Type", "application/json")
+	w := httptest.NewRecorder()
+	router.ServeHTTP(w, req)
+
+	if w.Code != http.StatusCreated {
+		t.Fatalf("Expected status %d, got %d. Body: %s", http.StatusCreated, w.Code, w.Body.String())
+	}
+	if received.TrackingNumber != "1Z999" || len(received.Items) != 1 || received.Items[0].Quantity != 2 {
+		t.Errorf("Expected shipment to be forwarded, got %+v", received)
+	}
+	if !bytes.Contains(w.Body.Bytes(), []byte(`"orderStatus":"partially_shipped"`)) {
+		t.Errorf("Expected OrderService response to be relayed, got %s", w.Body.String())
+	}
+}
+
+// =============================================================================
+// Return Tests
+// =============================================================================
+
+func TestReturnActionValidation(t *testing.T) {
+	router := setupProtectedTestRouter("seller-123")
+
+	tests := []struct {
+		name string
+		path string
+		body string
+	}{
+		{name: "Reject without note", path: "/returns/return-1/reject", body: `{}`},
+		{name: "Reject with blank note", path: "/returns/return-1/reject", body: `{"note":"  "}`},
+		{name: "Invalid JSON", path: "/returns/return-1/receive", body: `{bad}`},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			req, _ := http.NewRequest(http.MethodPost, tt.path, bytes.NewBufferString(tt.body))
+			req.Header.Set("Content-Type", "application/json")
+			w := httptest.NewRecorder()
+			router.ServeHTTP(w, req)
+
+			if w.Code != http.StatusBadRequest {
+				t.Errorf("Expected status %d, got %d", http.StatusBadRequest, w.Code)
+			}
+		})
+	}
+}
+
+func TestReceiveReturnForwardsToOrderService(t *testing.T) {
+	var received ReturnActionInput
+	orderService := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.Method != http.MethodPost || r.URL.Path != "/returns/return-1/receive" {
+			t.Errorf("Unexpected request %s %s", r.Method, r.URL.Path)
+		}
+		json.NewDecoder(r.Body).Decode(&received)
+		w.Header().Set("Content-Type", "application/json")
+		w.WriteHeader(http.StatusAccepted)
+		w.Write([]byte(`{"returnId":"return-1","status":"received","restock":true}`))
+	}))
+	defer orderService.Close()
+
+	previous := config
+	config.OrderRESTURL = orderService.URL
+	defer func() { config = previous }()
+
+	router := setupProtectedTestRouter("seller-123")
+	req, _ := http.NewRequest(http.MethodPost, "/returns/return-1/receive", bytes.NewBufferString(`{"restock":true,"note":"Unopened"}`))
+	req.Header.Set("Content-Type", "application/json")
+	w := httptest.NewRecorder()
+	router.ServeHTTP(w, req)
+
+	if w.Code != http.StatusAccepted {
+		t.Fatalf("Expected status %d, got %d. Body: %s", http.StatusAccepted, w.Code, w.Body.String())
+	}
+	if !received.Restock || received.Note != "Unopened" {
+		t.Errorf("Expected restock flag and note to be forwarded, got %+v", received)
+	}
+	if !bytes.Contains(w.Body.Bytes(), []byte(`"status":"received"`)) {
+		t.Errorf("Expected OrderService response to be relayed, got %s", w.Body.String())
+	}
+}
+
+func TestGetReturnsForwardsFilters(t *testing.T) {
+	var receivedQuery string
+	orderService := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path != "/returns" {
+			t.Errorf("Unexpected request %s %s", r.Method, r.URL.Path)
+		}
+		receivedQuery = r.URL.RawQuery
+		w.Header().Set("Content-Type", "application/json")
+		w.Write([]byte(`[]`))
+	}))
+	defer orderService.Close()
+
+	previous := config
+	config.OrderRESTURL = orderService.URL
+	defer func() { config = previous }()
+
+	router := setupProtectedTestRouter("seller-123")
+	req, _ := http.NewRequest(http.MethodGet, "/returns?status=requested&ignored=1", nil)
+	w := httptest.NewRecorder()
+	router.ServeHTTP(w, req)
+
+	if w.Code != http.StatusOK {
+		t.Fatalf("Expected status %d, got %d. Body: %s", http.StatusOK, w.Code, w.Body.String())
+	}
+	if receivedQuery != "status=requested" {
+		t.Errorf("Expected only the status filter to be forwarded, got '%s'", receivedQuery)
+	}
+}
+
+// =============================================================================
+// Coupon Tests
+// =============================================================================
+
+func TestCreateCouponValidation(t *testing.T) {
+	router := setupProtectedTestRouter("seller-123")
+
+	tests := []struct {
+		name string
+		body string
+	}{
+		{name: "Missing code", body: `{"type":"percentage","value":10}`},
+		{name: "Missing type", body: `{"code":"SPRING10"}`},
+		{name: "Invalid JSON", body: `{bad}`},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			req, _ := http.NewRequest(http.MethodPost, "/coupons", bytes.NewBufferString(tt.body))
+			req.Header.Set("Content-Type", "application/json")
+			w := httptest.NewRecorder()
+			router.ServeHTTP(w, req)
+
+			if w.Code != http.StatusBadRequest {
+				t.Errorf("Expected status %d, got %d", http.StatusBadRequest, w.Code)
+			}
+		})
+	}
+}
+
+func TestCreateCouponForwardsToOrderService(t *testing.T) {
+	var receivedAuth string
+	var received map[string]interface{}
+	orderService := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.Method != http.MethodPost || r.URL.Path != "/coupons" {
+			t.Errorf("Unexpected request %s %s", r.Method, r.URL.Path)
+		}
+		receivedAuth = r.Header.Get("Authorization")
+		json.NewDecoder(r.Body).Decode(&received)
+		w.Header().Set("Content-Type", "application/json")
+		w.WriteHeader(http.StatusCreated)
+		w.Write([]byte(`{"code":"SPRING10","type":"percentage","value":10,"usedCount":0}`))
+	}))
+	defer orderService.Close()
+
+	previous := config
+	config.OrderRESTURL = orderService.URL
+	defer func() { config = previous }()
+
+	router := setupProtectedTestRouter("seller-123")
+	body := `{"code":"SPRING10","type":"percentage","value":10,"productIds":["prod-1"],"usageLimit":100}`
+	req, _ := http.NewRequest(http.MethodPost, "/coupons", bytes.NewBufferString(body))
+	req.Header.Set("Content-Type", "application/json")
+	req.Header.Set("Authorization", "Bearer token")
+	w := httptest.NewRecorder()
+	router.ServeHTTP(w, req)
+
+	if w.Code != http.StatusCreated {
+		t.Fatalf("Expected status %d, got %d. Body: %s", http.StatusCreated, w.Code, w.Body.String())
+	}
+	if receivedAuth != "Bearer token" {
+		t.Errorf("Expected Authorization header to be forwarded, got '%s'", receivedAuth)
+	}
+	if received["code"] != "SPRING10" || received["usageLimit"] != float64(100) {
+		t.Errorf("Expected coupon definition to be forwarded, got %v", received)
+	}
+	if !bytes.Contains(w.Body.Bytes(), []byte(`"code":"SPRING10"`)) {
+		t.Errorf("Expected OrderService response to be relayed, got %s", w.Body.String())
+	}
+}
+
+func TestDeactivateCouponRelaysErrors(t *testing.T) {
+	orderService := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.Method != http.MethodDelete || r.URL.Path != "/coupons/SPRING10" {
+			t.Errorf("Unexpected request %s %s", r.Method, r.URL.Path)
+		}
+		w.WriteHeader(http.StatusNotFound)
+		w.Write([]byte(`{"error":"Coupon not found"}`))
+	}))
+	defer orderService.Close()
+
+	previous := config
+	config.OrderRESTURL = orderService.URL
+	defer func() { config = previous }()
+
+	router := setupProtectedTestRouter("seller-123")
+	req, _ := http.NewRequest(http.MethodDelete, "/coupons/SPRING10", nil)
+	w := httptest.NewRecorder()
+	router.ServeHTTP(w, req)
+
+	if w.Code != http.StatusNotFound {
+		t.Errorf("Expected status %d, got %d", http.StatusNotFound, w.Code)
+	}
+}
+
+func TestCreateWebhookValidation(t *testing.T) {
+	router := setupProtectedTestRouter("seller-123")
+
+	tests := []struct {
+		name string
+		body string
+	}{
+		{name: "Missing URL", body: `{"eventTypes":["order-paid"]}`},
+		{name: "Missing event types", body: `{"url":"https://seller.example.com/hooks"}`},
+		{name: "Empty event types", body: `{"url":"https://seller.example.com/hooks","eventTypes":[]}`},
+		{name: "Invalid JSON", body: `{bad}`},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			req, _ := http.NewRequest(http.MethodPost, "/webhooks", bytes.NewBufferString(tt.body))
+			req.Header.Set("Content-Type", "application/json")
+			w := httptest.NewRecorder()
+			router.ServeHTTP(w, req)
+
+			if w.Code != http.StatusBadRequest {
+				t.Errorf("Expected status %d, got %d", http.StatusBadRequest, w.Code)
+			}
+		})
+	}
+}
+
+func TestCreateWebhookForwardsToOrderService(t *testing.T) {
+	var received map[string]interface{}
+	orderService := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.Method != http.MethodPost || r.URL.Path != "/webhooks" {
+			t.Errorf("Unexpected request %s %s", r.Method, r.URL.Path)
+		}
+		json.NewDecoder(r.Body).Decode(&received)
+		w.Header().Set("Content-Type", "application/json")
+		w.WriteHeader(http.StatusCreated)
+		w.Write([]byte(`{"webhookId":"wh-1","secret":"whsec_abc","active":true}`))
+	}))
+	defer orderService.Close()
+
+	previous := config
+	config.OrderRESTURL = orderService.URL
+	defer func() { config = previous }()
+
+	router := setupProtectedTestRouter("seller-123")
+	body := `{"url":"https://seller.example.com/hooks","eventTypes":["order-paid","order-shipped"]}`
+	req, _ := http.NewRequest(http.MethodPost, "/webhooks", bytes.NewBufferString(body))
+	req.Header.Set("Content-Type", "application/json")
+	w := httptest.NewRecorder()
+	router.ServeHTTP(w, req)
+
+	if w.Code != http.StatusCreated {
+		t.Fatalf("Expected status %d, got %d. Body: %s", http.StatusCreated, w.Code, w.Body.String())
+	}
+	if received["url"] != "https://seller.example.com/hooks" {
+		t.Errorf("Expected webhook definition to be forwarded, got %v", received)
+	}
+	if !bytes.Contains(w.Body.Bytes(), []byte(`"secret":"whsec_abc"`)) {
+		t.Errorf("Expected the signing secret to be relayed, got %s", w.Body.String())
+	}
+}
+
+func TestGetWebhookDeliveriesForwardsFilters(t *testing.T) {
+	var receivedQuery map[string][]string
+	orderService := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path != "/webhooks/wh-1/deliveries" {
+			t.Errorf("Unexpected request %s %s", r.Method, r.URL.Path)
+		}
+		receivedQuery = r.URL.Query()
+		w.Header().Set("Content-Type", "application/json")
+		w.Write([]byte(`[]`))
+	}))
+	defer orderService.Close()
+
+	previous := config
+	config.OrderRESTURL = orderService.URL
+	defer func() { config = previous }()
+
+	router := setupProtectedTestRouter("seller-123")
+	req, _ := http.NewRequest(http.MethodGet, "/webhooks/wh-1/deliveries?status=failed&limit=10&other=x", nil)
+	w := httptest.NewRecorder()
+	router.ServeHTTP(w, req)
+
+	if w.Code != http.StatusOK {
+		t.Fatalf("Expected status %d, got %d", http.StatusOK, w.Code)
+	}
+	if len(receivedQuery) != 2 || receivedQuery["status"][0] != "failed" || receivedQuery["limit"][0] != "10" {
+		t.Errorf("Expected only status and limit to be forwarded, got %v", receivedQuery)
+	}
+}
+
+func TestRedeliverWebhookForwardsToOrderService(t *testing.T) {
+	orderService := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.Method != http.MethodPost || r.URL.Path != "/webhooks/wh-1/deliveries/dl-1/redeliver" {
+			t.Errorf("Unexpected request %s %s", r.Method, r.URL.Path)
+		}
+		w.Header().Set("Content-Type", "application/json")
+		w.Write([]byte(`{"deliveryId":"dl-1","status":"succeeded"}`))
+	}))
+	defer orderService.Close()
+
+	previous := config
+	config.OrderRESTURL = orderService.URL
+	defer func() { config = previous }()
+
+	router := setupProtectedTestRouter("seller-123")
+	req, _ := http.NewRequest(http.MethodPost, "/webhooks/wh-1/deliveries/dl-1/redeliver", nil)
+	w := httptest.NewRecorder()
+	router.ServeHTTP(w, req)
+
+	if w.Code != http.StatusOK {
+		t.Errorf("Expected status %d, got %d", http.StatusOK, w.Code)
+	}
+}
+
+func TestMoneyDecimal(t *testing.T) {
+	tests := []struct {
+		money    Money
+		expected string
+	}{
+		{Money{Amount: 1799700, Currency: "LKR"}, "17997.00"},
+		{Money{Amount: 5, Currency: "USD"}, "0.05"},
+		{Money{Amount: -250, Currency: "LKR"}, "-2.50"},
+		{Money{Amount: 1500, Currency: "JPY"}, "1500"},
+		{Money{Amount: 1234, Currency: "KWD"}, "1.234"},
+	}
+
+	for _, tt := range tests {
+		if got := tt.money.Decimal(); got != tt.expected {
+			t.Errorf("Decimal() of %+v = %s, expected %s", tt.money, got, tt.expected)
+		}
+	}
+}
+
+const salesReportJSON = `{"from":"2026-03-01","to":"2026-03-02","interval":"day","timezone":"Asia/Colombo","currency":"LKR",` +
+	`"totals":{"orders":3,"units":5,"revenue":{"amount":450000,"currency":"LKR"},"averageOrderValue":{"amount":150000,"currency":"LKR"}},` +
+	`"buckets":[{"period":"2026-03-01","orders":3,"units":5,"revenue":{"amount":450000,"currency":"LKR"},"averageOrderValue":{"amount":150000,"currency":"LKR"}},` +
+	`{"period":"2026-03-02","orders":0,"units":0,"revenue":{"amount":0,"currency":"LKR"},"averageOrderValue":{"amount":0,"currency":"LKR"}}]}`
+
+func TestSalesAnalyticsForwardsToOrderService(t *testing.T) {
+	var receivedQuery map[string][]string
+	orderService := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path != "/analytics/sales" {
+			t.Errorf("Unexpected request %s %s", r.Method, r.URL.Path)
+		}
+		receivedQuery = r.URL.Query()
+		w.Header().Set("Content-Type", "application/json")
+		w.Write([]byte(salesReportJSON))
+	}))
+	defer orderService.Close()
+
+	previous := config
+	config.OrderRESTURL = orderService.URL
+	defer func() { config = previous }()
+
+	router := setupProtectedTestRouter("seller-123")
+	req, _ := http.NewRequest(http.MethodGet, "/analytics/sales?from=2026-03-01&to=2026-03-02&tz=Asia/Colombo&limit=5", nil)
+	w := httptest.NewRecorder()
+	router.ServeHTTP(w, req)
+
+	if w.Code != http.StatusOK {
+		t.Fatalf("Expected status %d, got %d. Body: %s", http.StatusOK, w.Code, w.Body.String())
+	}
+	if len(receivedQuery) != 3 || receivedQuery["tz"][0] != "Asia/Colombo" {
+		t.Errorf("Expected from, to and tz to be forwarded, got %v", receivedQuery)
+	}
+	if !bytes.Contains(w.Body.Bytes(), []byte(`"interval":"day"`)) {
+		t.Errorf("Expected OrderService response to be relayed, got %s", w.Body.String())
+	}
+}
+
+func TestSalesAnalyticsCSV(t *testing.T) {
+	orderService := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Query().Get("format") != "" {
+			t.Errorf("Expected format not to be forwarded")
+		}
+		w.Header().Set("Content-Type", "application/json")
+		w.Write([]byte(salesReportJSON))
+	}))
+	defer orderService.Close()
+
+	previous := config
+	config.OrderRESTURL = orderService.URL
+	defer func() { config = previous }()
+
+	router := setupProtectedTestRouter("seller-123")
+	req, _ := http.NewRequest(http.MethodGet, "/analytics/sales?format=csv", nil)
+	w := httptest.NewRecorder()
+	router.ServeHTTP(w, req)
+
+	if w.Code != http.StatusOK {
+		t.Fatalf("Expected status %d, got %d. Body: %s", http.StatusOK, w.Code, w.Body.String())
+	}
+	if w.Header().Get("Content-Type") != "text/csv; charset=utf-8" {
+		t.Errorf("Expected a CSV content type, got %s", w.Header().Get("Content-Type"))
+	}
+	if w.Header().Get("Content-Disposition") != `attachment; filename="sales_day_2026-03-01_2026-03-02.csv"` {
+		t.Errorf("Unexpected Content-Disposition %s", w.Header().Get("Content-Disposition"))
+	}
+
+	expected := "period,orders,units,revenue,average_order_value,currency\n" +
+		"2026-03-01,3,5,4500.00,1500.00,LKR\n" +
+		"2026-03-02,0,0,0.00,0.00,LKR\n" +
+		"total,3,5,4500.00,1500.00,LKR\n"
+	if w.Body.String() != expected {
+		t.Errorf("Unexpected CSV:\n%s", w.Body.String())
+	}
+}
+
+func TestTopProductsCSV(t *testing.T) {
+	orderService := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path != "/analytics/top-products" || r.URL.Query().Get("sort") != "units" {
+			t.Errorf("Unexpected request %s", r.URL.String())
+		}
+		w.Header().Set("Content-Type", "application/json")
+		w.Write([]byte(`{"from":"2026-03-01","to":"2026-03-31","currency":"LKR","sort":"units","products":[` +
+			`{"productId":"prod-1","name":"Cable, USB-C","units":12,"orders":9,"revenue":{"amount":1200000,"currency":"LKR"}}]}`))
+	}))
+	defer orderService.Close()
+
+	previous := config
+	config.OrderRESTURL = orderService.URL
+	defer func() { config = previous }()
+
+	router := setupProtectedTestRouter("seller-123")
+	req, _ := http.NewRequest(http.MethodGet, "/analytics/top-products?sort=units&format=CSV", nil)
+	w := httptest.NewRecorder()
+	router.ServeHTTP(w, req)
+
+	expected := "product_id,name,units,orders,revenue,currency\n" +
+		"prod-1,\"Cable, USB-C\",12,9,12000.00,LKR\n"
+	if w.Code != http.StatusOK || w.Body.String() != expected {
+		t.Errorf("Unexpected response %d:\n%s", w.Code, w.Body.String())
+	}
+}
+
+func TestAnalyticsRejectsUnknownFormat(t *testing.T) {
+	router := setupProtectedTestRouter("seller-123")
+	req, _ := http.NewRequest(http.MethodGet, "/analytics/sales?format=xlsx", nil)
+	w := httptest.NewRecorder()
+	router.ServeHTTP(w, req)
+
+	if w.Code != http.StatusBadRequest {
+		t.Errorf("Expected status %d, got %d", http.StatusBadRequest, w.Code)
+	}
+}
+
+func TestAnalyticsCSVRelaysErrors(t *testing.T) {
+	orderService := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusBadRequest)
+		w.Write([]byte(`{"error":"Invalid query: interval must be day, week or month"}`))
+	}))
+	defer orderService.Close()
+
+	previous := config
+	config.OrderRESTURL = orderService.URL
+	defer func() { config = previous }()
+
+	router := setupProtectedTestRouter("seller-123")
+	req, _ := http.NewRequest(http.MethodGet, "/analytics/sales?interval=hour&format=csv", nil)
+	w := httptest.NewRecorder()
+	router.ServeHTTP(w, req)
+
+	if w.Code != http.StatusBadRequest {
+		t.Errorf("Expected status %d, got %d", http.StatusBadRequest, w.Code)
+	}
+}
+
 // =============================================================================
 // JWT Middleware Tests
 // =============================================================================
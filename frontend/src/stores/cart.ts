@@ -1,11 +1,12 @@
 import { defineStore } from 'pinia'
 import { ref, computed } from 'vue'
+import { type Money, toMoney, multiplyMoney, sumMoney } from '@/utils/money'
 
 export interface CartItem {
   productId: string
   quantity: number
   name?: string
-  price?: number
+  price?: Money
   sellerId?: string
 }
 
@@ -19,9 +20,7 @@ export const useCartStore = defineStore('cart', () => {
   })
 
   const total = computed(() => {
-    return items.value.reduce((total, item) => {
-      return total + (item.price || 0) * item.quantity
-    }, 0)
+    return sumMoney(items.value.map(item => multiplyMoney(item.price, item.quantity)))
   })
 
   const isEmpty = computed(() => items.value.length === 0)
@@ -30,7 +29,9 @@ export const useCartStore = defineStore('cart', () => {
   function loadCartFromStorage(): CartItem[] {
     try {
       const stored = localStorage.getItem('cart')
-      return stored ? JSON.parse(stored) : []
+      const items: CartItem[] = stored ? JSON.parse(stored) : []
+      // Carts saved before prices had a currency hold plain numbers
+      return items.map(item => item.price === undefined ? item : { ...item, price: toMoney(item.price) })
     } catch {
       return []
     }
@@ -79,7 +80,7 @@ export const useCartStore = defineStore('cart', () => {
     localStorage.removeItem('cart')
   }
 
-  function getTotal(): number {
+  function getTotal(): Money {
     return total.value
   }
 
@@ -0,0 +1,54 @@
+// Amounts are exchanged with the backend as integer minor units (cents) plus
+// an ISO 4217 currency code, e.g. { amount: 1799700, currency: 'LKR' }.
+export interface Money {
+  amount: number
+  currency: string
+}
+
+export const DEFAULT_CURRENCY = 'LKR'
+
+// Currencies whose minor unit is not a hundredth
+const CURRENCY_EXPONENTS: Record<string, number> = {
+  BHD: 3, JOD: 3, KWD: 3, OMR: 3, TND: 3,
+  JPY: 0, KRW: 0, VND: 0, CLP: 0, ISK: 0
+}
+
+export function currencyExponent(currency: string): number {
+  return CURRENCY_EXPONENTS[currency] ?? 2
+}
+
+// Accepts a Money or a legacy plain number in major units of the default
+// currency, as stored carts and older responses contain.
+export function toMoney(value: Money | number | null | undefined): Money {
+  if (typeof value === 'number') {
+    return fromMajorUnits(value, DEFAULT_CURRENCY)
+  }
+  return value ?? { amount: 0, currency: DEFAULT_CURRENCY }
+}
+
+export function fromMajorUnits(value: number, currency: string = DEFAULT_CURRENCY): Money {
+  return { amount: Math.round(value * 10 ** currencyExponent(currency)), currency }
+}
+
+export function toMajorUnits(money: Money): number {
+  return money.amount / 10 ** currencyExponent(money.currency)
+}
+
+export function multiplyMoney(money: Money | number | null | undefined, quantity: number): Money {
+  const m = toMoney(money)
+  return { amount: m.amount * quantity, currency: m.currency }
+}
+
+// Sums amounts of one currency; the result takes the first amount's currency.
+export function sumMoney(values: Array<Money | number | null | undefined>): Money {
+  const moneys = values.map(toMoney)
+  const currency = moneys[0]?.currency ?? DEFAULT_CURRENCY
+  return { amount: moneys.reduce((sum, m) => sum + m.amount, 0), currency }
+}
+
+// Formats an amount as e.g. "LKR 17997.00".
+export function formatMoney(value: Money | number | null | undefined): string {
+  const money = toMoney(value)
+  const exp = currencyExponent(money.currency)
+  return `${money.currency} ${toMajorUnits(money).toFixed(exp)}`
+}
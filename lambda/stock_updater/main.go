@@ -3,9 +3,13 @@ package main
 import (
 	"context"
 	"encoding/json"
+	"errors"
 	"fmt"
 	"log"
+	"math"
 	"os"
+	"strconv"
+	"time"
 
 	"github.com/aws/aws-lambda-go/events"
 	"github.com/aws/aws-lambda-go/lambda"
@@ -15,25 +19,103 @@ import (
 	"github.com/aws/aws-sdk-go-v2/service/dynamodb/types"
 )
 
+// Money mirrors order_service's amount type: integer minor units of an ISO
+// 4217 currency
+type Money struct {
+	Amount   int64  `json:"amount"`
+	Currency string `json:"currency"`
+}
+
+// UnmarshalJSON also accepts the plain decimal numbers that events published
+// before amounts had a currency carry. Those were major units of a two-digit
+// currency, and the currency is left empty.
+func (m *Money) UnmarshalJSON(data []byte) error {
+	var legacy float64
+	if err := json.Unmarshal(data, &legacy); err == nil {
+		*m = Money{Amount: int64(math.Round(legacy * 100))}
+		return nil
+	}
+
+	type money Money
+	return json.Unmarshal(data, (*money)(m))
+}
+
 // OrderItem mirrors the order_service item structure
 type OrderItem struct {
 	ProductID string `json:"productId"`
 	Quantity  int    `json:"quantity"`
 	Name      string `json:"name"`
-	Price     float64 `json:"price"`
+	Price     Money  `json:"price"`
+	SellerID  string `json:"sellerId"`
+	LineTotal Money  `json:"lineTotal"`
 }
 
-// OrderPlacedDetail is the EventBridge detail payload
+// OrderPlacedDetail is the EventBridge detail payload of order-placed and
+// order-paid events
 type OrderPlacedDetail struct {
-	OrderID string      `json:"orderId"`
-	UserID  string      `json:"userId"`
-	Items   []OrderItem `json:"items"`
-	Total   float64     `json:"total"`
+	OrderID    string      `json:"orderId"`
+	CheckoutID string      `json:"checkoutId"`
+	UserID     string      `json:"userId"`
+	SellerID   string      `json:"sellerId"`
+	Items      []OrderItem `json:"items"`
+	Total      Money       `json:"total"`
+}
+
+// OrderCancelledDetail is the detail payload of order-cancelled and
+// order-expired events. Expired orders have no cancelledBy.
+type OrderCancelledDetail struct {
+	OrderPlacedDetail
+	CancelledBy string `json:"cancelledBy"`
+	Reason      string `json:"reason"`
+}
+
+// ReturnRestockedDetail is the detail payload of return-restocked events, sent
+// when a seller puts the units of a received return back in stock
+type ReturnRestockedDetail struct {
+	ReturnID  string `json:"returnId"`
+	OrderID   string `json:"orderId"`
+	SellerID  string `json:"sellerId"`
+	ProductID string `json:"productId"`
+	Quantity  int    `json:"quantity"`
+}
+
+// Reservation line statuses, as written by product_service
+const (
+	reservationActive    = "active"
+	reservationCommitted = "committed"
+	reservationReleased  = "released"
+	reservationRestocked = "restocked"
+)
+
+// reservationRetention is how long finished reservation lines are kept
+// before DynamoDB TTL deletes them
+const reservationRetention = 7 * 24 * time.Hour
+
+// maxLineAttempts bounds the retries when a reservation line changes state
+// (e.g. the product_service sweeper releases it) while it is being updated
+const maxLineAttempts = 3
+
+// reservationLine is one product of a stock reservation. Reservations are
+// keyed by the checkout ID.
+type reservationLine struct {
+	ReservationID string
+	ProductID     string
+	Quantity      int
+	Status        string
+}
+
+// dynamoAPI is the part of the DynamoDB client the handlers use, so tests
+// can stub it
+type dynamoAPI interface {
+	GetItem(ctx context.Context, params *dynamodb.GetItemInput, optFns ...func(*dynamodb.Options)) (*dynamodb.GetItemOutput, error)
+	UpdateItem(ctx context.Context, params *dynamodb.UpdateItemInput, optFns ...func(*dynamodb.Options)) (*dynamodb.UpdateItemOutput, error)
+	TransactWriteItems(ctx context.Context, params *dynamodb.TransactWriteItemsInput, optFns ...func(*dynamodb.Options)) (*dynamodb.TransactWriteItemsOutput, error)
 }
 
 var (
-	ddbClient      *dynamodb.Client
-	productsTable  string
+	ddbClient         dynamoAPI
+	productsTable     string
+	reservationsTable string
 )
 
 func init() {
@@ -42,6 +124,11 @@ func init() {
 		productsTable = "Products"
 	}
 
+	reservationsTable = os.Getenv("RESERVATIONS_TABLE")
+	if reservationsTable == "" {
+		reservationsTable = "Reservations"
+	}
+
 	cfg, err := config.LoadDefaultConfig(context.Background())
 	if err != nil {
 		log.Fatalf("unable to load AWS config: %v", err)
@@ -52,33 +139,343 @@ func init() {
 func handler(ctx context.Context, event events.CloudWatchEvent) error {
 	log.Printf("Received event: source=%s, detail-type=%s", event.Source, event.DetailType)
 
+	switch event.DetailType {
+	case "order-paid":
+		return handleOrderPaid(ctx, event.Detail)
+	case "order-cancelled", "order-expired":
+		return handleOrderCancelled(ctx, event.DetailType, event.Detail)
+	case "return-restocked":
+		return handleReturnRestocked(ctx, event.Detail)
+	default:
+		log.Printf("Ignoring unhandled event type %s", event.DetailType)
+		return nil
+	}
+}
+
+// handleOrderPaid commits the stock reserved for a paid order: the units
+// leave both the product's stock and its reserved count. Products that fail
+// don't stop the rest, but the errors are returned so EventBridge retries
+// the event; lines already committed are skipped on redelivery.
+func handleOrderPaid(ctx context.Context, raw json.RawMessage) error {
 	var detail OrderPlacedDetail
-	if err := json.Unmarshal(event.Detail, &detail); err != nil {
+	if err := json.Unmarshal(raw, &detail); err != nil {
 		return fmt.Errorf("failed to unmarshal detail: %w", err)
 	}
 
-	log.Printf("Processing order %s with %d items", detail.OrderID, len(detail.Items))
+	log.Printf("Committing stock for paid order %s with %d items", detail.OrderID, len(detail.Items))
 
-	for _, item := range detail.Items {
-		if err := decrementStock(ctx, item.ProductID, item.Quantity); err != nil {
-			log.Printf("ERROR: failed to update stock for product %s: %v", item.ProductID, err)
-			// Continue processing other items even if one fails
+	var errs []error
+	productIDs, quantities := sumQuantities(detail.Items)
+	for _, productID := range productIDs {
+		if err := commitStock(ctx, detail.CheckoutID, productID, quantities[productID]); err != nil {
+			log.Printf("ERROR: failed to commit stock for product %s: %v", productID, err)
+			errs = append(errs, fmt.Errorf("product %s: %w", productID, err))
 			continue
 		}
-		log.Printf("Decremented stock for product %s by %d", item.ProductID, item.Quantity)
+		log.Printf("Committed %d units of product %s", quantities[productID], productID)
+	}
+	if len(errs) > 0 {
+		return fmt.Errorf("failed to commit stock for order %s: %w", detail.OrderID, errors.Join(errs...))
 	}
 
 	log.Printf("Successfully processed order %s", detail.OrderID)
 	return nil
 }
 
+// handleOrderCancelled returns the stock of an order that was cancelled, or
+// that expired without being paid. Like handleOrderPaid it returns the
+// errors of failed products so the event is retried.
+func handleOrderCancelled(ctx context.Context, detailType string, raw json.RawMessage) error {
+	var detail OrderCancelledDetail
+	if err := json.Unmarshal(raw, &detail); err != nil {
+		return fmt.Errorf("failed to unmarshal detail: %w", err)
+	}
+
+	log.Printf("Restoring stock for order %s after %s (%d items, reason: %s)",
+		detail.OrderID, detailType, len(detail.Items), detail.Reason)
+
+	var errs []error
+	productIDs, quantities := sumQuantities(detail.Items)
+	for _, productID := range productIDs {
+		if err := restoreStock(ctx, detail.CheckoutID, productID, quantities[productID]); err != nil {
+			log.Printf("ERROR: failed to restore stock for product %s: %v", productID, err)
+			errs = append(errs, fmt.Errorf("product %s: %w", productID, err))
+			continue
+		}
+		log.Printf("Restored %d units of product %s", quantities[productID], productID)
+	}
+	if len(errs) > 0 {
+		return fmt.Errorf("failed to restore stock for order %s: %w", detail.OrderID, errors.Join(errs...))
+	}
+
+	log.Printf("Successfully restored stock for order %s", detail.OrderID)
+	return nil
+}
+
+// handleReturnRestocked puts a returned product's units back in stock. The
+// restock is recorded as a reservation line keyed by the return ID, so a
+// redelivered event is only applied once.
+func handleReturnRestocked(ctx context.Context, raw json.RawMessage) error {
+	var detail ReturnRestockedDetail
+	if err := json.Unmarshal(raw, &detail); err != nil {
+		return fmt.Errorf("failed to unmarshal detail: %w", err)
+	}
+	if detail.ReturnID == "" || detail.ProductID == "" || detail.Quantity <= 0 {
+		log.Printf("Ignoring invalid return-restocked event for return %q", detail.ReturnID)
+		return nil
+	}
+
+	err := restockReturn(ctx, detail.ReturnID, detail.ProductID, detail.Quantity)
+	if isConditionFailure(err) {
+		log.Printf("Return %s already restocked or product %s no longer exists", detail.ReturnID, detail.ProductID)
+		return nil
+	}
+	if err != nil {
+		return fmt.Errorf("failed to restock return %s: %w", detail.ReturnID, err)
+	}
+
+	log.Printf("Restocked %d units of product %s from return %s (order %s)",
+		detail.Quantity, detail.ProductID, detail.ReturnID, detail.OrderID)
+	return nil
+}
+
+// commitStock takes a paid order's units out of stock. An active hold is
+// converted into a stock decrement; a hold that already expired is charged
+// against stock directly. Orders without a reservation line (placed before
+// reservations existed) fall back to a plain decrement.
+func commitStock(ctx context.Context, reservationID, productID string, quantity int) error {
+	for attempt := 1; attempt <= maxLineAttempts; attempt++ {
+		line, err := getReservationLine(ctx, reservationID, productID)
+		if err != nil {
+			return err
+		}
+
+		if line == nil {
+			return decrementStock(ctx, productID, quantity)
+		}
+
+		switch line.Status {
+		case reservationActive:
+			err = transitionLine(ctx, line, quantity, reservationCommitted,
+				"SET stock = stock - :qty, reserved = reserved - :qty, updatedAt = :updatedAt",
+				"reserved >= :qty AND stock >= :qty")
+		case reservationReleased:
+			err = transitionLine(ctx, line, quantity, reservationCommitted,
+				"SET stock = stock - :qty, updatedAt = :updatedAt",
+				"stock >= :qty")
+		default:
+			log.Printf("Reservation %s for product %s already %s", reservationID, productID, line.Status)
+			return nil
+		}
+
+		if !isConditionFailure(err) {
+			return err
+		}
+	}
+
+	return fmt.Errorf("reservation %s for product %s kept changing", reservationID, productID)
+}
+
+// restoreStock gives a cancelled order's units back. An active hold is
+// released; committed units are added back to stock. Without a reservation
+// line the units were taken from stock directly and are added back.
+func restoreStock(ctx context.Context, reservationID, productID string, quantity int) error {
+	for attempt := 1; attempt <= maxLineAttempts; attempt++ {
+		line, err := getReservationLine(ctx, reservationID, productID)
+		if err != nil {
+			return err
+		}
+
+		if line == nil {
+			return incrementStock(ctx, productID, quantity)
+		}
+
+		switch line.Status {
+		case reservationActive:
+			err = transitionLine(ctx, line, quantity, reservationReleased,
+				"SET reserved = reserved - :qty, updatedAt = :updatedAt",
+				"reserved >= :qty")
+		case reservationCommitted:
+			err = transitionLine(ctx, line, quantity, reservationRestocked,
+				"SET stock = stock + :qty, updatedAt = :updatedAt",
+				"attribute_exists(productId)")
+		default:
+			log.Printf("Reservation %s for product %s already %s", reservationID, productID, line.Status)
+			return nil
+		}
+
+		if !isConditionFailure(err) {
+			return err
+		}
+	}
+
+	return fmt.Errorf("reservation %s for product %s kept changing", reservationID, productID)
+}
+
+// transitionLine applies a stock update to the product and moves the
+// reservation line to a new status in one transaction. The line must still
+// be in the status it was read with, so a redelivered event or a concurrent
+// sweep cannot apply the same change twice.
+func transitionLine(ctx context.Context, line *reservationLine, quantity int, to, productUpdate, productCondition string) error {
+	now := time.Now().UTC()
+
+	_, err := ddbClient.TransactWriteItems(ctx, &dynamodb.TransactWriteItemsInput{
+		TransactItems: []types.TransactWriteItem{
+			{
+				Update: &types.Update{
+					TableName: aws.String(productsTable),
+					Key: map[string]types.AttributeValue{
+						"productId": &types.AttributeValueMemberS{Value: line.ProductID},
+					},
+					UpdateExpression:    aws.String(productUpdate),
+					ConditionExpression: aws.String(productCondition),
+					ExpressionAttributeValues: map[string]types.AttributeValue{
+						":qty":       &types.AttributeValueMemberN{Value: fmt.Sprintf("%d", quantity)},
+						":updatedAt": &types.AttributeValueMemberS{Value: now.Format(time.RFC3339)},
+					},
+				},
+			},
+			{
+				Update: &types.Update{
+					TableName: aws.String(reservationsTable),
+					Key: map[string]types.AttributeValue{
+						"reservationId": &types.AttributeValueMemberS{Value: line.ReservationID},
+						"productId":     &types.AttributeValueMemberS{Value: line.ProductID},
+					},
+					UpdateExpression:    aws.String("SET #status = :to, updatedAt = :updatedAt, #ttl = :ttl"),
+					ConditionExpression: aws.String("#status = :from"),
+					ExpressionAttributeNames: map[string]string{
+						"#status": "status",
+						"#ttl":    "ttl",
+					},
+					ExpressionAttributeValues: map[string]types.AttributeValue{
+						":from":      &types.AttributeValueMemberS{Value: line.Status},
+						":to":        &types.AttributeValueMemberS{Value: to},
+						":updatedAt": &types.AttributeValueMemberS{Value: now.Format(time.RFC3339)},
+						":ttl":       &types.AttributeValueMemberN{Value: fmt.Sprintf("%d", now.Add(reservationRetention).Unix())},
+					},
+				},
+			},
+		},
+	})
+	if err != nil {
+		return fmt.Errorf("DynamoDB TransactWriteItems failed: %w", err)
+	}
+	return nil
+}
+
+// restockReturn adds a return's units back to the product's stock and writes
+// a restocked reservation line for the return in one transaction. The line
+// must not exist yet and the product must.
+func restockReturn(ctx context.Context, returnID, productID string, quantity int) error {
+	now := time.Now().UTC()
+
+	_, err := ddbClient.TransactWriteItems(ctx, &dynamodb.TransactWriteItemsInput{
+		TransactItems: []types.TransactWriteItem{
+			{
+				Update: &types.Update{
+					TableName: aws.String(productsTable),
+					Key: map[string]types.AttributeValue{
+						"productId": &types.AttributeValueMemberS{Value: productID},
+					},
+					UpdateExpression:    aws.String("SET stock = stock + :qty, updatedAt = :updatedAt"),
+					ConditionExpression: aws.String("attribute_exists(productId)"),
+					ExpressionAttributeValues: map[string]types.AttributeValue{
+						":qty":       &types.AttributeValueMemberN{Value: fmt.Sprintf("%d", quantity)},
+						":updatedAt": &types.AttributeValueMemberS{Value: now.Format(time.RFC3339)},
+					},
+				},
+			},
+			{
+				Put: &types.Put{
+					TableName: aws.String(reservationsTable),
+					Item: map[string]types.AttributeValue{
+						"reservationId": &types.AttributeValueMemberS{Value: returnID},
+						"productId":     &types.AttributeValueMemberS{Value: productID},
+						"quantity":      &types.AttributeValueMemberN{Value: fmt.Sprintf("%d", quantity)},
+						"status":        &types.AttributeValueMemberS{Value: reservationRestocked},
+						"updatedAt":     &types.AttributeValueMemberS{Value: now.Format(time.RFC3339)},
+						"ttl":           &types.AttributeValueMemberN{Value: fmt.Sprintf("%d", now.Add(reservationRetention).Unix())},
+					},
+					ConditionExpression: aws.String("attribute_not_exists(reservationId)"),
+				},
+			},
+		},
+	})
+	if err != nil {
+		return fmt.Errorf("DynamoDB TransactWriteItems failed: %w", err)
+	}
+	return nil
+}
+
+// getReservationLine reads one product's line of a reservation, or nil if
+// there is none.
+func getReservationLine(ctx context.Context, reservationID, productID string) (*reservationLine, error) {
+	if reservationID == "" {
+		return nil, nil
+	}
+
+	out, err := ddbClient.GetItem(ctx, &dynamodb.GetItemInput{
+		TableName: aws.String(reservationsTable),
+		Key: map[string]types.AttributeValue{
+			"reservationId": &types.AttributeValueMemberS{Value: reservationID},
+			"productId":     &types.AttributeValueMemberS{Value: productID},
+		},
+		ConsistentRead: aws.Bool(true),
+	})
+	if err != nil {
+		return nil, fmt.Errorf("DynamoDB GetItem failed: %w", err)
+	}
+	if out.Item == nil {
+		return nil, nil
+	}
+
+	line := &reservationLine{ReservationID: reservationID, ProductID: productID}
+	if v, ok := out.Item["status"].(*types.AttributeValueMemberS); ok {
+		line.Status = v.Value
+	}
+	if v, ok := out.Item["quantity"].(*types.AttributeValueMemberN); ok {
+		line.Quantity, _ = strconv.Atoi(v.Value)
+	}
+	return line, nil
+}
+
+// isConditionFailure reports whether a transaction was cancelled because one
+// of its conditions no longer held.
+func isConditionFailure(err error) bool {
+	var cancelled *types.TransactionCanceledException
+	if !errors.As(err, &cancelled) {
+		return false
+	}
+	for _, reason := range cancelled.CancellationReasons {
+		if aws.ToString(reason.Code) == "ConditionalCheckFailed" {
+			return true
+		}
+	}
+	return false
+}
+
+// sumQuantities totals the quantity per product, keeping the order in which
+// products first appear. Reservations hold one line per product.
+func sumQuantities(items []OrderItem) ([]string, map[string]int) {
+	var productIDs []string
+	quantities := make(map[string]int, len(items))
+	for _, item := range items {
+		if _, seen := quantities[item.ProductID]; !seen {
+			productIDs = append(productIDs, item.ProductID)
+		}
+		quantities[item.ProductID] += item.Quantity
+	}
+	return productIDs, quantities
+}
+
 func decrementStock(ctx context.Context, productID string, quantity int) error {
 	_, err := ddbClient.UpdateItem(ctx, &dynamodb.UpdateItemInput{
 		TableName: aws.String(productsTable),
 		Key: map[string]types.AttributeValue{
 			"productId": &types.AttributeValueMemberS{Value: productID},
 		},
-		UpdateExpression: aws.String("SET stock = stock - :qty"),
+		UpdateExpression:    aws.String("SET stock = stock - :qty"),
 		ConditionExpression: aws.String("stock >= :qty"),
 		ExpressionAttributeValues: map[string]types.AttributeValue{
 			":qty": &types.AttributeValueMemberN{Value: fmt.Sprintf("%d", quantity)},
@@ -90,6 +487,32 @@ func decrementStock(ctx context.Context, productID string, quantity int) error {
 	return nil
 }
 
+// incrementStock atomically adds quantity back to a product's stock. The
+// condition stops a deleted product from being recreated by the update; a
+// deleted product has nothing to restore, so that is not an error.
+func incrementStock(ctx context.Context, productID string, quantity int) error {
+	_, err := ddbClient.UpdateItem(ctx, &dynamodb.UpdateItemInput{
+		TableName: aws.String(productsTable),
+		Key: map[string]types.AttributeValue{
+			"productId": &types.AttributeValueMemberS{Value: productID},
+		},
+		UpdateExpression:    aws.String("SET stock = stock + :qty"),
+		ConditionExpression: aws.String("attribute_exists(productId)"),
+		ExpressionAttributeValues: map[string]types.AttributeValue{
+			":qty": &types.AttributeValueMemberN{Value: fmt.Sprintf("%d", quantity)},
+		},
+	})
+	var conditionFailed *types.ConditionalCheckFailedException
+	if errors.As(err, &conditionFailed) {
+		log.Printf("Product %s no longer exists, nothing to restore", productID)
+		return nil
+	}
+	if err != nil {
+		return fmt.Errorf("DynamoDB UpdateItem failed: %w", err)
+	}
+	return nil
+}
+
 func main() {
 	lambda.Start(handler)
 }
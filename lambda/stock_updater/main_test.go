@@ -0,0 +1,143 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"strings"
+	"testing"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/service/dynamodb"
+	"github.com/aws/aws-sdk-go-v2/service/dynamodb/types"
+)
+
+// stubDynamo keeps the reservation lines of one checkout by product and
+// fails writes to the products in fail.
+type stubDynamo struct {
+	lines   map[string]string // productID -> line status
+	fail    map[string]error
+	writes  []string // products written, in order
+	updates []string // products written without a reservation line
+}
+
+func (s *stubDynamo) GetItem(ctx context.Context, params *dynamodb.GetItemInput, optFns ...func(*dynamodb.Options)) (*dynamodb.GetItemOutput, error) {
+	productID := params.Key["productId"].(*types.AttributeValueMemberS).Value
+	status, ok := s.lines[productID]
+	if !ok {
+		return &dynamodb.GetItemOutput{}, nil
+	}
+	return &dynamodb.GetItemOutput{Item: map[string]types.AttributeValue{
+		"status":   &types.AttributeValueMemberS{Value: status},
+		"quantity": &types.AttributeValueMemberN{Value: "1"},
+	}}, nil
+}
+
+func (s *stubDynamo) UpdateItem(ctx context.Context, params *dynamodb.UpdateItemInput, optFns ...func(*dynamodb.Options)) (*dynamodb.UpdateItemOutput, error) {
+	productID := params.Key["productId"].(*types.AttributeValueMemberS).Value
+	if err := s.fail[productID]; err != nil {
+		return nil, err
+	}
+	s.updates = append(s.updates, productID)
+	return &dynamodb.UpdateItemOutput{}, nil
+}
+
+func (s *stubDynamo) TransactWriteItems(ctx context.Context, params *dynamodb.TransactWriteItemsInput, optFns ...func(*dynamodb.Options)) (*dynamodb.TransactWriteItemsOutput, error) {
+	productID := params.TransactItems[0].Update.Key["productId"].(*types.AttributeValueMemberS).Value
+	if err := s.fail[productID]; err != nil {
+		return nil, err
+	}
+	line := params.TransactItems[1].Update
+	s.lines[productID] = line.ExpressionAttributeValues[":to"].(*types.AttributeValueMemberS).Value
+	s.writes = append(s.writes, productID)
+	return &dynamodb.TransactWriteItemsOutput{}, nil
+}
+
+func useStubDynamo(t *testing.T, stub *stubDynamo) {
+	previous := ddbClient
+	ddbClient = stub
+	t.Cleanup(func() { ddbClient = previous })
+}
+
+const twoProductOrder = `{"orderId":"ord-1","checkoutId":"chk-1","items":[` +
+	`{"productId":"prod-1","quantity":1},{"productId":"prod-2","quantity":1}]}`
+
+func TestHandleOrderPaidCommitsEveryLine(t *testing.T) {
+	stub := &stubDynamo{lines: map[string]string{"prod-1": reservationActive, "prod-2": reservationReleased}}
+	useStubDynamo(t, stub)
+
+	if err := handleOrderPaid(context.Background(), json.RawMessage(twoProductOrder)); err != nil {
+		t.Fatalf("handleOrderPaid: %v", err)
+	}
+	for _, productID := range []string{"prod-1", "prod-2"} {
+		if stub.lines[productID] != reservationCommitted {
+			t.Errorf("line for %s is %s, want %s", productID, stub.lines[productID], reservationCommitted)
+		}
+	}
+}
+
+func TestHandleOrderPaidReturnsPartialFailure(t *testing.T) {
+	stub := &stubDynamo{
+		lines: map[string]string{"prod-1": reservationActive, "prod-2": reservationActive},
+		fail:  map[string]error{"prod-2": errors.New("throttled")},
+	}
+	useStubDynamo(t, stub)
+
+	err := handleOrderPaid(context.Background(), json.RawMessage(twoProductOrder))
+	if err == nil || !strings.Contains(err.Error(), "prod-2") {
+		t.Fatalf("expected an error for prod-2, got %v", err)
+	}
+	if stub.lines["prod-1"] != reservationCommitted {
+		t.Errorf("prod-1 should still be committed, line is %s", stub.lines["prod-1"])
+	}
+
+	// The retried event only commits the line that failed
+	stub.fail = nil
+	stub.writes = nil
+	if err := handleOrderPaid(context.Background(), json.RawMessage(twoProductOrder)); err != nil {
+		t.Fatalf("redelivered handleOrderPaid: %v", err)
+	}
+	if len(stub.writes) != 1 || stub.writes[0] != "prod-2" {
+		t.Errorf("redelivery wrote %v, want only prod-2", stub.writes)
+	}
+}
+
+func TestHandleOrderCancelledReturnsPartialFailure(t *testing.T) {
+	stub := &stubDynamo{
+		lines: map[string]string{"prod-1": reservationActive},
+		fail:  map[string]error{"prod-1": errors.New("throttled")},
+	}
+	useStubDynamo(t, stub)
+
+	// prod-1 has a line and fails; prod-2 has none and is added back to stock
+	err := handleOrderCancelled(context.Background(), "order-cancelled", json.RawMessage(twoProductOrder))
+	if err == nil || !strings.Contains(err.Error(), "prod-1") {
+		t.Fatalf("expected an error for prod-1, got %v", err)
+	}
+	if len(stub.updates) != 1 || stub.updates[0] != "prod-2" {
+		t.Errorf("updated %v, want prod-2", stub.updates)
+	}
+
+	stub.fail = nil
+	if err := handleOrderCancelled(context.Background(), "order-cancelled", json.RawMessage(twoProductOrder)); err != nil {
+		t.Fatalf("redelivered handleOrderCancelled: %v", err)
+	}
+	if stub.lines["prod-1"] != reservationReleased {
+		t.Errorf("line for prod-1 is %s, want %s", stub.lines["prod-1"], reservationReleased)
+	}
+}
+
+func TestHandleOrderCancelledSkipsDeletedProduct(t *testing.T) {
+	stub := &stubDynamo{
+		lines: map[string]string{"prod-1": reservationCommitted},
+		fail:  map[string]error{"prod-2": &types.ConditionalCheckFailedException{Message: aws.String("gone")}},
+	}
+	useStubDynamo(t, stub)
+
+	if err := handleOrderCancelled(context.Background(), "order-expired", json.RawMessage(twoProductOrder)); err != nil {
+		t.Fatalf("handleOrderCancelled: %v", err)
+	}
+	if stub.lines["prod-1"] != reservationRestocked {
+		t.Errorf("line for prod-1 is %s, want %s", stub.lines["prod-1"], reservationRestocked)
+	}
+}
@@ -127,6 +127,21 @@ resource "aws_lb_listener_rule" "seller" {
   }
 }
 
+# Seller coupons, webhooks and analytics → seller_service, which forwards them
+# to order_service
+resource "aws_lb_listener_rule" "seller_extra" {
+  listener_arn = aws_lb_listener.http.arn
+  priority     = 210
+
+  condition {
+    path_pattern { values = ["/coupons*", "/webhooks*", "/analytics*"] }
+  }
+  action {
+    type             = "forward"
+    target_group_arn = aws_lb_target_group.seller.arn
+  }
+}
+
 # /graphql → product_service (GraphQL)
 resource "aws_lb_listener_rule" "product" {
   listener_arn = aws_lb_listener.http.arn
@@ -141,13 +156,60 @@ resource "aws_lb_listener_rule" "product" {
   }
 }
 
+# Order status SSE streams and the seller order export live on order_service;
+# matched before the seller rule, which would otherwise claim /orders* and /seller*
+resource "aws_lb_listener_rule" "order_stream" {
+  listener_arn = aws_lb_listener.http.arn
+  priority     = 150
+
+  condition {
+    path_pattern { values = ["/orders/stream*", "/seller/orders/*"] }
+  }
+  action {
+    type             = "forward"
+    target_group_arn = aws_lb_target_group.order.arn
+  }
+}
+
+# Per-order endpoints buyers use (cancel, history, returns, shipment tracking)
+# live on order_service, which also serves sellers for them; matched before the
+# seller rule's /orders*
+resource "aws_lb_listener_rule" "order_lifecycle" {
+  listener_arn = aws_lb_listener.http.arn
+  priority     = 160
+
+  condition {
+    path_pattern { values = ["/orders/*/cancel", "/orders/*/history", "/orders/*/returns", "/orders/*/shipments"] }
+  }
+  action {
+    type             = "forward"
+    target_group_arn = aws_lb_target_group.order.arn
+  }
+}
+
+# Buyer checkouts, cart and address book → order_service. Returns go here too:
+# buyers open and cancel them, and SellerService's /returns only forwards to
+# order_service for sellers
+resource "aws_lb_listener_rule" "order_buyer" {
+  listener_arn = aws_lb_listener.http.arn
+  priority     = 170
+
+  condition {
+    path_pattern { values = ["/checkouts*", "/cart*", "/addresses*", "/returns*"] }
+  }
+  action {
+    type             = "forward"
+    target_group_arn = aws_lb_target_group.order.arn
+  }
+}
+
 # /order* → order_service (split into two rules – AWS allows max 5 path values per rule)
 resource "aws_lb_listener_rule" "order" {
   listener_arn = aws_lb_listener.http.arn
   priority     = 400
 
   condition {
-    path_pattern { values = ["/createOrder*", "/simulatePayment*", "/markPaymentDone*", "/orderConfirmed*", "/getOrders*"] }
+    path_pattern { values = ["/createOrder*", "/payments*", "/orderConfirmed*", "/getOrders*"] }
   }
   action {
     type             = "forward"
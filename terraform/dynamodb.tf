@@ -57,3 +57,51 @@ resource "aws_dynamodb_table" "reviews" {
 
   tags = { Name = "Reviews" }
 }
+
+# Stock held for unpaid checkouts: one item per (checkout, product). Active
+# lines are swept by product_service once expiresAt passes; finished lines
+# are removed by TTL.
+resource "aws_dynamodb_table" "reservations" {
+  name         = "Reservations"
+  billing_mode = "PAY_PER_REQUEST"
+  hash_key     = "reservationId"
+  range_key    = "productId"
+
+  attribute {
+    name = "reservationId"
+    type = "S"
+  }
+
+  attribute {
+    name = "productId"
+    type = "S"
+  }
+
+  attribute {
+    name = "status"
+    type = "S"
+  }
+
+  attribute {
+    name = "expiresAt"
+    type = "N"
+  }
+
+  global_secondary_index {
+    name            = "StatusExpiresAtIndex"
+    hash_key        = "status"
+    range_key       = "expiresAt"
+    projection_type = "ALL"
+  }
+
+  ttl {
+    attribute_name = "ttl"
+    enabled        = true
+  }
+
+  point_in_time_recovery {
+    enabled = true
+  }
+
+  tags = { Name = "Reservations" }
+}
@@ -227,6 +227,8 @@ resource "aws_ecs_task_definition" "product" {
       { name = "DYNAMODB_ENDPOINT", value = "" },
       { name = "PRODUCTS_TABLE", value = aws_dynamodb_table.products.name },
       { name = "REVIEWS_TABLE", value = aws_dynamodb_table.reviews.name },
+      { name = "RESERVATIONS_TABLE", value = aws_dynamodb_table.reservations.name },
+      { name = "RESERVATION_TTL", value = "15m" },
       { name = "EVENT_BUS_NAME", value = aws_cloudwatch_event_bus.main.name },
     ]
     logConfiguration = {
@@ -261,6 +263,10 @@ resource "aws_ecs_task_definition" "order" {
       { name = "RDS_DSN", value = "postgres://${var.db_master_username}:${var.db_master_password}@${aws_db_instance.main.endpoint}/${var.db_name}?sslmode=require" },
       { name = "PRODUCT_GRAPHQL_URL", value = "http://product-service.${local.name}.local:8082/graphql" },
       { name = "EVENTBRIDGE_BUS_ARN", value = aws_cloudwatch_event_bus.main.arn },
+      { name = "PAYMENT_PROVIDER", value = var.payment_provider },
+      { name = "ORDER_EXPIRY_WINDOW", value = "15m" },
+      { name = "STRIPE_SECRET_KEY", value = var.stripe_secret_key },
+      { name = "STRIPE_WEBHOOK_SECRET", value = var.stripe_webhook_secret },
     ]
     logConfiguration = {
       logDriver = "awslogs"
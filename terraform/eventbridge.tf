@@ -7,22 +7,22 @@ resource "aws_cloudwatch_event_bus" "main" {
   tags = { Name = "${local.name}-event-bus" }
 }
 
-# Rule: capture order-placed events → trigger Lambda stock updater
-resource "aws_cloudwatch_event_rule" "order_placed" {
-  name           = "${local.name}-order-placed"
+# Rule: capture order-paid events → trigger Lambda stock updater (commit reservation)
+resource "aws_cloudwatch_event_rule" "order_paid" {
+  name           = "${local.name}-order-paid"
   event_bus_name = aws_cloudwatch_event_bus.main.name
-  description    = "Captures order-placed events to update product stock"
+  description    = "Captures order-paid events to commit reserved product stock"
 
   event_pattern = jsonencode({
     source      = ["cloudretail.order-service"]
-    detail-type = ["order-placed"]
+    detail-type = ["order-paid"]
   })
 
-  tags = { Name = "${local.name}-order-placed-rule" }
+  tags = { Name = "${local.name}-order-paid-rule" }
 }
 
 resource "aws_cloudwatch_event_target" "stock_updater" {
-  rule           = aws_cloudwatch_event_rule.order_placed.name
+  rule           = aws_cloudwatch_event_rule.order_paid.name
   event_bus_name = aws_cloudwatch_event_bus.main.name
   target_id      = "stock-updater-lambda"
   arn            = aws_lambda_function.stock_updater.arn
@@ -33,5 +33,63 @@ resource "aws_lambda_permission" "eventbridge" {
   action        = "lambda:InvokeFunction"
   function_name = aws_lambda_function.stock_updater.function_name
   principal     = "events.amazonaws.com"
-  source_arn    = aws_cloudwatch_event_rule.order_placed.arn
+  source_arn    = aws_cloudwatch_event_rule.order_paid.arn
+}
+
+# Rule: capture order-cancelled and order-expired events → trigger Lambda stock updater (restock)
+resource "aws_cloudwatch_event_rule" "order_cancelled" {
+  name           = "${local.name}-order-cancelled"
+  event_bus_name = aws_cloudwatch_event_bus.main.name
+  description    = "Captures order-cancelled and order-expired events to restore product stock"
+
+  event_pattern = jsonencode({
+    source      = ["cloudretail.order-service"]
+    detail-type = ["order-cancelled", "order-expired"]
+  })
+
+  tags = { Name = "${local.name}-order-cancelled-rule" }
+}
+
+resource "aws_cloudwatch_event_target" "stock_updater_cancelled" {
+  rule           = aws_cloudwatch_event_rule.order_cancelled.name
+  event_bus_name = aws_cloudwatch_event_bus.main.name
+  target_id      = "stock-updater-lambda"
+  arn            = aws_lambda_function.stock_updater.arn
+}
+
+resource "aws_lambda_permission" "eventbridge_cancelled" {
+  statement_id  = "AllowEventBridgeInvokeCancelled"
+  action        = "lambda:InvokeFunction"
+  function_name = aws_lambda_function.stock_updater.function_name
+  principal     = "events.amazonaws.com"
+  source_arn    = aws_cloudwatch_event_rule.order_cancelled.arn
+}
+
+# Rule: capture return-restocked events → trigger Lambda stock updater (restock returned units)
+resource "aws_cloudwatch_event_rule" "return_restocked" {
+  name           = "${local.name}-return-restocked"
+  event_bus_name = aws_cloudwatch_event_bus.main.name
+  description    = "Captures return-restocked events to put returned units back in stock"
+
+  event_pattern = jsonencode({
+    source      = ["cloudretail.order-service"]
+    detail-type = ["return-restocked"]
+  })
+
+  tags = { Name = "${local.name}-return-restocked-rule" }
+}
+
+resource "aws_cloudwatch_event_target" "stock_updater_returns" {
+  rule           = aws_cloudwatch_event_rule.return_restocked.name
+  event_bus_name = aws_cloudwatch_event_bus.main.name
+  target_id      = "stock-updater-lambda"
+  arn            = aws_lambda_function.stock_updater.arn
+}
+
+resource "aws_lambda_permission" "eventbridge_returns" {
+  statement_id  = "AllowEventBridgeInvokeReturns"
+  action        = "lambda:InvokeFunction"
+  function_name = aws_lambda_function.stock_updater.function_name
+  principal     = "events.amazonaws.com"
+  source_arn    = aws_cloudwatch_event_rule.return_restocked.arn
 }
@@ -52,12 +52,15 @@ resource "aws_iam_policy" "ecs_task" {
           "dynamodb:Scan",
           "dynamodb:BatchGetItem",
           "dynamodb:BatchWriteItem",
+          "dynamodb:TransactWriteItems",
         ]
         Resource = [
           aws_dynamodb_table.products.arn,
           "${aws_dynamodb_table.products.arn}/index/*",
           aws_dynamodb_table.reviews.arn,
           "${aws_dynamodb_table.reviews.arn}/index/*",
+          aws_dynamodb_table.reservations.arn,
+          "${aws_dynamodb_table.reservations.arn}/index/*",
         ]
       },
       {
@@ -164,10 +167,13 @@ resource "aws_iam_policy" "lambda" {
         Effect = "Allow"
         Action = [
           "dynamodb:GetItem",
+          "dynamodb:PutItem",
           "dynamodb:UpdateItem",
+          "dynamodb:TransactWriteItems",
         ]
         Resource = [
           aws_dynamodb_table.products.arn,
+          aws_dynamodb_table.reservations.arn,
         ]
       },
       {
@@ -16,8 +16,9 @@ resource "aws_lambda_function" "stock_updater" {
 
   environment {
     variables = {
-      PRODUCTS_TABLE = aws_dynamodb_table.products.name
-      AWS_REGION_VAL = var.aws_region
+      PRODUCTS_TABLE     = aws_dynamodb_table.products.name
+      RESERVATIONS_TABLE = aws_dynamodb_table.reservations.name
+      AWS_REGION_VAL     = var.aws_region
     }
   }
 
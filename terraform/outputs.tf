@@ -30,8 +30,9 @@ output "ecr_repositories" {
 output "dynamodb_tables" {
   description = "DynamoDB table names"
   value = {
-    products = aws_dynamodb_table.products.name
-    reviews  = aws_dynamodb_table.reviews.name
+    products     = aws_dynamodb_table.products.name
+    reviews      = aws_dynamodb_table.reviews.name
+    reservations = aws_dynamodb_table.reservations.name
   }
 }
 
@@ -61,6 +61,28 @@ variable "db_name" {
   default     = "cloudretail"
 }
 
+# ── Payments ─────────────────────────────────────────────────────────────────
+
+variable "payment_provider" {
+  description = "Order service payment provider: stripe, or fake for the built-in test server (development only)"
+  type        = string
+  default     = "stripe"
+}
+
+variable "stripe_secret_key" {
+  description = "Stripe secret API key (required when payment_provider is stripe)"
+  type        = string
+  default     = ""
+  sensitive   = true
+}
+
+variable "stripe_webhook_secret" {
+  description = "Stripe webhook signing secret (required by both providers; a random value for fake)"
+  type        = string
+  default     = ""
+  sensitive   = true
+}
+
 # ── ECS ──────────────────────────────────────────────────────────────────────
 
 variable "ecs_cpu" {